@@ -4,21 +4,48 @@ import (
 	"bufio"
 	"flag"
 	"fmt"
+	"io"
+	"maps"
 	"os"
 	"os/exec"
 	"os/user"
 	"path/filepath"
 	"runtime"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/charmbracelet/lipgloss"
+	"github.com/madhav/servctl/internal/advisor"
+	"github.com/madhav/servctl/internal/bootstrap"
+	"github.com/madhav/servctl/internal/burnin"
+	"github.com/madhav/servctl/internal/checklist"
+	"github.com/madhav/servctl/internal/client"
 	"github.com/madhav/servctl/internal/compose"
 	"github.com/madhav/servctl/internal/directory"
+	"github.com/madhav/servctl/internal/events"
+	"github.com/madhav/servctl/internal/export"
+	"github.com/madhav/servctl/internal/exposure"
+	"github.com/madhav/servctl/internal/gitops"
+	"github.com/madhav/servctl/internal/hooks"
+	"github.com/madhav/servctl/internal/inventory"
 	"github.com/madhav/servctl/internal/maintenance"
+	"github.com/madhav/servctl/internal/ops"
+	"github.com/madhav/servctl/internal/paths"
+	"github.com/madhav/servctl/internal/pkgmgr"
 	"github.com/madhav/servctl/internal/preflight"
+	"github.com/madhav/servctl/internal/recording"
 	"github.com/madhav/servctl/internal/report"
+	"github.com/madhav/servctl/internal/rescue"
+	"github.com/madhav/servctl/internal/runlock"
+	"github.com/madhav/servctl/internal/status"
 	"github.com/madhav/servctl/internal/storage"
+	"github.com/madhav/servctl/internal/terminal"
+	"github.com/madhav/servctl/internal/timing"
+	"github.com/madhav/servctl/internal/trash"
 	"github.com/madhav/servctl/internal/tui"
+	"github.com/madhav/servctl/internal/ups"
 	"github.com/madhav/servctl/internal/utils"
 )
 
@@ -65,17 +92,78 @@ var (
 func main() {
 	// Command line flags
 	startSetup := flag.Bool("start-setup", false, "Launch interactive installation wizard")
-	status := flag.Bool("status", false, "Display current system status")
+	showStatus := flag.Bool("status", false, "Display current system status")
+	watch := flag.Bool("watch", false, "With -status, refresh the view every few seconds")
+	statusBadge := flag.String("status-badge", "", "Write status.svg and status.json for a phone widget into DIR")
 	getConfig := flag.Bool("get-config", false, "Display current configuration")
 	getArch := flag.Bool("get-architecture", false, "Display folder structure and disk mapping")
+	advise := flag.Bool("advise", false, "Inventory the hardware and recommend upgrades before setup")
+	burninRun := flag.Bool("burnin", false, "Stress-test new hardware (memory, CPU, disks) before setup and report pass/fail")
+	burninCPU := flag.Duration("burnin-cpu", burnin.DefaultStressDuration, "With -burnin, how long to keep the CPUs at full load")
 	manualBackup := flag.Bool("manual-backup", false, "Trigger immediate backup")
+	backupPrune := flag.Bool("backup-prune", false, "Delete backup sets outside the retention policy")
 	logs := flag.Bool("logs", false, "Display service logs")
+	networkRefresh := flag.Bool("network-refresh", false, "Re-detect host IP and update services")
+	permissions := flag.String("permissions", "", "Check or repair directory modes and owners (check|fix)")
+	snapshotAction := flag.String("snapshot", "", "List data snapshots or roll back the last risky change (list|rollback)")
+	maintenanceAction := flag.String("maintenance", "", "Show recorded runs of the maintenance scripts or check them after edits (history [SCRIPT] | validate)")
+	analyzeTarget := flag.String("analyze", "", "Report space the library could give back, or Nextcloud files that cannot sync to Windows/macOS (photos|filenames)")
+	maintenanceMode := flag.String("maintenance-mode", "", "Hold data still: Nextcloud maintenance mode and Immich jobs paused (on|off)")
+	diskEmergency := flag.String("disk-emergency", "", "Pause or resume Immich's background jobs for a nearly full disk; disk_alert.sh runs it (on|off)")
+	exportFormat := flag.String("export", "", "Export the setup as infrastructure as code (ansible|cloud-init) [DIR]")
+	gitopsAction := flag.String("gitops", "", "Keep ~/infra under git (init [REMOTE]|push|log)")
+	inventoryAction := flag.String("inventory", "", "Show the recorded image digests and versions, or what changed since a date (show|diff DATE)")
+	showChecklist := flag.Bool("checklist", false, "Resume the first-boot checklist (services, URLs, logins, first backup)")
+	showEvents := flag.Bool("events", false, "Show a timeline of servctl actions, container, backup and SMART events")
+	since := flag.String("since", "24h", "With -events, start of the time range (e.g. 12h, 7d, 2024-05-01 03:00)")
+	until := flag.String("until", "", "With -events, end of the time range (default now)")
+	eventSource := flag.String("source", "", "With -events, comma-separated sources (servctl,docker,backup,smart)")
+	rescueDoc := flag.Bool("rescue-doc", false, "Write the break-glass recovery document to the backup drive, or into [DIR]")
+	exposureCheck := flag.Bool("exposure", false, "Check whether a web interface is reachable from the internet, optionally from an SSH [RELAY]")
+	portForward := flag.String("port-forward", "", "Keep a router forward of port 443 to a TLS reverse proxy here over UPnP/NAT-PMP (on|off|status) [RELAY]")
+	countries := flag.String("countries", "", "With -port-forward on, only let these countries reach port 443 (e.g. DE,AT; 'any' to drop the filter)")
+	clientProfile := flag.Bool("client-profile", false, "Write servctl-client.json describing this server for -client-setup [FILE]")
+	clientSetup := flag.Bool("client-setup", false, "On a laptop: find the server, check it answers, set up desktop apps [PROFILE|HOST]")
+	migrateConfig := flag.Bool("migrate-config", false, "Upgrade configuration saved by older servctl releases")
+	validateConfig := flag.Bool("validate-config", false, "Check a hand-edited .env and apply it to the affected containers")
+	trashAction := flag.String("trash", "", "Manage files kept from overwrites and deletions (list|restore ID|empty)")
 	version := flag.Bool("version", false, "Display version information")
 	preflightOnly := flag.Bool("preflight", false, "Run preflight checks only")
 	dryRun := flag.Bool("dry-run", false, "Preview changes without making them")
+	onlyPhases := flag.String("only", "", "With -start-setup, run only these phases (comma-separated: "+strings.Join(setupPhaseNames(), ",")+")")
+	skipPhases := flag.String("skip", "", "With -start-setup, run every phase but these")
+	noSudo := flag.Bool("no-sudo", false, "Rootless setup: skip privileged phases and use rootless Docker")
+	dockerKey := flag.String("docker-key-fingerprint", preflight.DockerKeyFingerprint, "Expected fingerprint of Docker's apt signing key")
+	offlineBundle := flag.String("offline-bundle", "", "Install Docker from a directory of .deb files with SHA256SUMS")
+	eventWebhook := flag.String("event-webhook", "", "POST lifecycle events as JSON to this URL (saved with the setup)")
+	credentials := flag.String("credentials", report.DeliverPrint, "How the setup hands over passwords (print|file|link)")
+	yes := flag.Bool("yes", false, "Accept the default answer at every prompt, for scripted runs")
 
 	flag.Parse()
 
+	assumeYes = *yes
+	session = terminal.Detect()
+	if session.Plain() {
+		if restore, err := terminal.UsePlainOutput(); err == nil {
+			restoreOutput = restore
+			defer restore()
+		}
+	}
+	restoreModes := terminal.SaveModes()
+	utils.HandleInterrupts(func(os.Signal) {
+		if recorder != nil {
+			recorder.Discard()
+		}
+		restoreModes()
+		printInterrupted()
+		restoreOutput()
+	})
+
+	preflight.Verification.DockerKeyFingerprint = *dockerKey
+	preflight.Verification.OfflineBundle = *offlineBundle
+	initTrash()
+	initLifecycleHooks(*eventWebhook, *dryRun)
+
 	// Handle version flag
 	if *version {
 		printVersion()
@@ -84,26 +172,48 @@ func main() {
 
 	// Handle preflight only
 	if *preflightOnly {
-		runPreflightChecks()
-		return
+		exit(runPreflightChecks())
 	}
 
 	// Handle start-setup (main wizard)
 	if *startSetup {
-		runSetupWizard(*dryRun)
-		return
+		if !isDeliveryMode(*credentials) {
+			fmt.Println(errorStyle.Render("Unknown -credentials mode: " + *credentials + " (use print, file or link)"))
+			exit(utils.ExitUsage)
+		}
+		phases, err := parseSetupPhases(*onlyPhases, *skipPhases)
+		if err != nil {
+			fmt.Println(errorStyle.Render("Error: " + err.Error()))
+			exit(utils.ExitUsage)
+		}
+		exit(withRunLock("-start-setup", *dryRun, func() int {
+			return runSetupWizard(*dryRun, *noSudo, *credentials, phases)
+		}))
 	}
 
 	// Handle status
-	if *status {
-		runStatusCommand()
-		return
+	if *showStatus {
+		exit(runStatusCommand(*watch))
+	}
+
+	// Handle status-badge
+	if *statusBadge != "" {
+		exit(runStatusBadgeCommand(*statusBadge, *dryRun))
 	}
 
 	// Handle get-config
 	if *getConfig {
-		runGetConfigCommand()
-		return
+		exit(runGetConfigCommand())
+	}
+
+	// Handle advise
+	if *advise {
+		exit(runAdviseCommand())
+	}
+
+	// Handle burnin
+	if *burninRun {
+		exit(runBurninCommand(*burninCPU, *dryRun))
 	}
 
 	// Handle get-architecture
@@ -114,20 +224,197 @@ func main() {
 
 	// Handle manual-backup
 	if *manualBackup {
-		runManualBackupCommand()
-		return
+		exit(withRunLock("-manual-backup", false, runManualBackupCommand))
+	}
+
+	// Handle backup-prune
+	if *backupPrune {
+		exit(withRunLock("-backup-prune", *dryRun, func() int { return runBackupPruneCommand(*dryRun) }))
 	}
 
 	// Handle logs
 	if *logs {
-		runLogsCommand()
-		return
+		exit(runLogsCommand())
+	}
+
+	// Handle network-refresh
+	if *networkRefresh {
+		exit(withRunLock("-network-refresh", *dryRun, func() int { return runNetworkRefreshCommand(*dryRun) }))
+	}
+
+	// Handle permissions check/fix
+	if *permissions != "" {
+		readOnly := *dryRun || *permissions != "fix"
+		exit(withRunLock("-permissions "+*permissions, readOnly, func() int { return runPermissionsCommand(*permissions, *dryRun) }))
+	}
+
+	// Handle snapshot list/rollback
+	if *snapshotAction != "" {
+		readOnly := *dryRun || *snapshotAction != "rollback"
+		exit(withRunLock("-snapshot "+*snapshotAction, readOnly, func() int { return runSnapshotCommand(*snapshotAction, *dryRun) }))
+	}
+
+	// Handle maintenance mode on/off
+	if *maintenanceMode != "" {
+		exit(withRunLock("-maintenance-mode "+*maintenanceMode, *dryRun, func() int { return runMaintenanceModeCommand(*maintenanceMode, *dryRun) }))
+	}
+
+	// Handle the disk-full emergency; no run lock, as it cannot wait
+	if *diskEmergency != "" {
+		exit(runDiskEmergencyCommand(*diskEmergency, *dryRun))
+	}
+
+	// Handle maintenance history and validate
+	if *maintenanceAction != "" {
+		exit(runMaintenanceCommand(*maintenanceAction, flag.Arg(0)))
+	}
+
+	// Handle photo analysis
+	if *analyzeTarget != "" {
+		exit(runAnalyzeCommand(*analyzeTarget, *dryRun))
+	}
+
+	// Handle trash list/restore/empty
+	if *trashAction != "" {
+		readOnly := *dryRun || *trashAction == "list"
+		exit(withRunLock("-trash "+*trashAction, readOnly, func() int { return runTrashCommand(*trashAction, flag.Arg(0), *dryRun) }))
+	}
+
+	// Handle export ansible/cloud-init
+	if *exportFormat != "" {
+		exit(runExportCommand(*exportFormat, flag.Arg(0), *dryRun))
+	}
+
+	// Handle gitops init/push/log
+	if *gitopsAction != "" {
+		exit(runGitOpsCommand(*gitopsAction, flag.Arg(0), *dryRun))
+	}
+
+	// Handle inventory
+	if *inventoryAction != "" {
+		exit(runInventoryCommand(*inventoryAction, flag.Arg(0)))
+	}
+
+	// Handle first-boot checklist
+	if *showChecklist {
+		exit(runChecklistCommand())
+	}
+
+	// Handle events timeline
+	if *showEvents {
+		exit(runEventsCommand(*since, *until, *eventSource))
+	}
+
+	// Handle rescue-doc
+	if *rescueDoc {
+		exit(runRescueDocCommand(flag.Arg(0), *dryRun))
+	}
+
+	// Handle exposure
+	if *exposureCheck {
+		exit(runExposureCommand(flag.Arg(0), *dryRun))
+	}
+
+	// Handle port-forward
+	if *portForward != "" {
+		exit(runPortForwardCommand(*portForward, flag.Arg(0), *countries, *dryRun))
+	}
+
+	// Handle client profile (server) and client setup (laptop)
+	if *clientProfile {
+		exit(runClientProfileCommand(flag.Arg(0)))
+	}
+	if *clientSetup {
+		exit(runClientSetupCommand(flag.Arg(0)))
+	}
+
+	// Handle migrate-config
+	if *migrateConfig {
+		exit(withRunLock("-migrate-config", *dryRun, func() int { return runMigrateConfigCommand(*dryRun) }))
+	}
+	if *validateConfig {
+		exit(withRunLock("-validate-config", *dryRun, func() int { return runValidateConfigCommand(*dryRun) }))
 	}
 
 	// No flags provided, show help
 	printUsage()
 }
 
+// session is where the output is shown; over SSH and on the console emoji
+// are replaced so nothing depends on the client's emoji widths
+var session terminal.Session
+
+// restoreOutput undoes terminal.UsePlainOutput and shows what is still
+// buffered; os.Exit skips deferred calls, so exit calls it
+var restoreOutput = func() {}
+
+// exit ends servctl with code once all output is shown
+func exit(code int) {
+	restoreOutput()
+	os.Exit(code)
+}
+
+// resumeHint is the command that picks an interrupted run up again; empty
+// means running the same command again
+var resumeHint string
+
+// printInterrupted says where servctl was interrupted and how to go on
+func printInterrupted() {
+	message := "Interrupted"
+	if phase := timings.Phase(); phase != "" {
+		message += " during " + phase
+	}
+	hint := resumeHint
+	if hint == "" {
+		hint = strings.Join(append([]string{"servctl"}, os.Args[1:]...), " ")
+		if os.Geteuid() == 0 && os.Getenv("SUDO_USER") != "" {
+			hint = "sudo " + hint
+		}
+	}
+	fmt.Println()
+	fmt.Println(warningStyle.Render("⚠️  " + message + ". Changes in progress were finished or undone."))
+	fmt.Println(descStyle.Render("Resume with: " + hint))
+}
+
+// timings records how long each setup phase and slow command takes
+var timings = &timing.Recorder{}
+
+// waitClock reads answers to prompts and counts the time spent waiting for
+// them, so phase timings show the work apart from the owner's reading time
+type waitClock struct {
+	r io.Reader
+}
+
+func (w waitClock) Read(p []byte) (int, error) {
+	start := time.Now()
+	n, err := w.r.Read(p)
+	timings.Waited(time.Since(start))
+	return n, err
+}
+
+// assumeYes answers every prompt with its default (-yes)
+var assumeYes bool
+
+// defaultAnswers stands in for the keyboard with -yes: each prompt reads
+// Enter, which picks its default, and the answer is shown after the prompt
+type defaultAnswers struct{}
+
+func (defaultAnswers) Read(p []byte) (int, error) {
+	fmt.Println(descStyle.Render("(default)"))
+	p[0] = '\n'
+	return 1, nil
+}
+
+// promptReader reads answers to prompts: from the keyboard, or with -yes
+// the default of every prompt
+func promptReader() *bufio.Reader {
+	if assumeYes {
+		// One byte at a time, so each prompt shows its own answer
+		return bufio.NewReaderSize(defaultAnswers{}, 16)
+	}
+	return bufio.NewReader(waitClock{os.Stdin})
+}
+
 func printVersion() {
 	fmt.Println()
 	fmt.Println(titleStyle.Render("servctl") + " - Home Server Provisioning CLI")
@@ -144,20 +431,62 @@ func printUsage() {
 	fmt.Println()
 	fmt.Println("Usage:")
 	fmt.Printf("  %s    %s\n", cmdStyle.Render("servctl -start-setup"), descStyle.Render("Launch interactive installation wizard"))
-	fmt.Printf("  %s          %s\n", cmdStyle.Render("servctl -status"), descStyle.Render("Display current system status"))
+	fmt.Printf("  %s          %s\n", cmdStyle.Render("servctl -status"), descStyle.Render("Display current system status (-watch to refresh)"))
+	fmt.Printf("  %s %s\n", cmdStyle.Render("servctl -status-badge DIR"), descStyle.Render("Write a green/yellow/red status badge for a phone widget"))
 	fmt.Printf("  %s       %s\n", cmdStyle.Render("servctl -preflight"), descStyle.Render("Run pre-flight checks only"))
+	fmt.Printf("  %s           %s\n", cmdStyle.Render("servctl -burnin"), descStyle.Render("Stress-test new hardware before setup (-burnin-cpu 1h)"))
 	fmt.Printf("  %s      %s\n", cmdStyle.Render("servctl -get-config"), descStyle.Render("Display current configuration"))
 	fmt.Printf("  %s %s\n", cmdStyle.Render("servctl -get-architecture"), descStyle.Render("Display folder structure"))
 	fmt.Printf("  %s   %s\n", cmdStyle.Render("servctl -manual-backup"), descStyle.Render("Trigger immediate backup"))
+	fmt.Printf("  %s    %s\n", cmdStyle.Render("servctl -backup-prune"), descStyle.Render("Apply backup retention (preview with -dry-run)"))
 	fmt.Printf("  %s            %s\n", cmdStyle.Render("servctl -logs"), descStyle.Render("Display service logs"))
+	fmt.Printf("  %s %s\n", cmdStyle.Render("servctl -network-refresh"), descStyle.Render("Update services after the LAN IP changes"))
+	fmt.Printf("  %s %s\n", cmdStyle.Render("servctl -permissions check"), descStyle.Render("Report directory mode/owner drift"))
+	fmt.Printf("  %s   %s\n", cmdStyle.Render("servctl -permissions fix"), descStyle.Render("Repair drift without touching file contents"))
+	fmt.Printf("  %s   %s\n", cmdStyle.Render("servctl -snapshot list"), descStyle.Render("Show Btrfs/ZFS snapshots taken before risky changes"))
+	fmt.Printf("  %s %s\n", cmdStyle.Render("servctl -snapshot rollback"), descStyle.Render("Revert the data to the newest snapshot"))
+	fmt.Printf("  %s %s\n", cmdStyle.Render("servctl -maintenance-mode on"), descStyle.Render("Nextcloud maintenance page, Immich jobs paused"))
+	fmt.Printf("  %s %s\n", cmdStyle.Render("servctl -maintenance-mode off"), descStyle.Render("Back to normal, resuming the jobs servctl paused"))
+	fmt.Printf("  %s %s\n", cmdStyle.Render("servctl -disk-emergency off"), descStyle.Render("Resume the Immich jobs a nearly full disk paused"))
+	fmt.Printf("  %s %s\n", cmdStyle.Render("servctl -maintenance history"), descStyle.Render("Recent script runs, exit codes and failure streaks"))
+	fmt.Printf("  %s %s\n", cmdStyle.Render("servctl -maintenance validate"), descStyle.Render("Check hand-edited scripts and the cron jobs that run them"))
+	fmt.Printf("  %s  %s\n", cmdStyle.Render("servctl -analyze photos"), descStyle.Render("Duplicates, screenshots and large videos in Immich"))
+	fmt.Printf("  %s %s\n", cmdStyle.Render("servctl -analyze filenames"), descStyle.Render("Nextcloud files Windows/macOS clients cannot sync"))
+	fmt.Printf("  %s      %s\n", cmdStyle.Render("servctl -trash list"), descStyle.Render("Show files kept from overwrites and deletions"))
+	fmt.Printf("  %s %s\n", cmdStyle.Render("servctl -trash restore ID"), descStyle.Render("Put a trashed file back where it was"))
+	fmt.Printf("  %s     %s\n", cmdStyle.Render("servctl -trash empty"), descStyle.Render("Permanently delete everything in the trash"))
+	fmt.Printf("  %s %s\n", cmdStyle.Render("servctl -export ansible DIR"), descStyle.Render("Write a playbook that rebuilds this server (or cloud-init)"))
+	fmt.Printf("  %s %s\n", cmdStyle.Render("servctl -gitops init [URL]"), descStyle.Render("Keep ~/infra in git, optionally pushing to a private remote"))
+	fmt.Printf("  %s      %s\n", cmdStyle.Render("servctl -gitops log"), descStyle.Render("Show the history of servctl's config changes"))
+	fmt.Printf("  %s  %s\n", cmdStyle.Render("servctl -inventory show"), descStyle.Render("Image digests and versions the stack runs now"))
+	fmt.Printf("  %s %s\n", cmdStyle.Render("servctl -inventory diff 7d"), descStyle.Render("What changed since a date (7d, 2024-05-01)"))
+	fmt.Printf("  %s      %s\n", cmdStyle.Render("servctl -rescue-doc"), descStyle.Render("Write the break-glass recovery document to the backup drive"))
+	fmt.Printf("  %s        %s\n", cmdStyle.Render("servctl -exposure"), descStyle.Render("Check whether a web interface is reachable from the internet"))
+	fmt.Printf("  %s %s\n", cmdStyle.Render("servctl -port-forward on"), descStyle.Render("Forward port 443 to a reverse proxy here (UPnP/NAT-PMP)"))
+	fmt.Printf("  %s %s\n", cmdStyle.Render("servctl -port-forward off"), descStyle.Render("Remove the forward from the router"))
+	fmt.Printf("  %s       %s\n", cmdStyle.Render("servctl -checklist"), descStyle.Render("Resume the first-boot checklist"))
+	fmt.Printf("  %s          %s\n", cmdStyle.Render("servctl -events"), descStyle.Render("Timeline of servctl, container, backup and SMART events"))
+	fmt.Printf("  %s  %s\n", cmdStyle.Render("servctl -client-profile"), descStyle.Render("Write servctl-client.json for your laptops"))
+	fmt.Printf("  %s    %s\n", cmdStyle.Render("servctl -client-setup"), descStyle.Render("On a laptop: find the server, check it, set up apps"))
+	fmt.Printf("  %s  %s\n", cmdStyle.Render("servctl -migrate-config"), descStyle.Render("Upgrade config from older releases (preview with -dry-run)"))
+	fmt.Printf("  %s %s\n", cmdStyle.Render("servctl -validate-config"), descStyle.Render("Check a hand-edited .env, recreate what it affects"))
 	fmt.Printf("  %s         %s\n", cmdStyle.Render("servctl -version"), descStyle.Render("Display version info"))
 	fmt.Println()
 	fmt.Println("Options:")
 	fmt.Printf("  %s         %s\n", cmdStyle.Render("-dry-run"), descStyle.Render("Preview changes without making them"))
+	fmt.Printf("  %s         %s\n", cmdStyle.Render("-no-sudo"), descStyle.Render("Rootless setup for shared machines (skips privileged phases)"))
+	fmt.Printf("  %s             %s\n", cmdStyle.Render("-yes"), descStyle.Render("Accept the default at every prompt (scripted runs)"))
+	fmt.Printf("  %s       %s\n", cmdStyle.Render("-only LIST"), descStyle.Render("Run only these setup phases, e.g. -only compose"))
+	fmt.Printf("  %s       %s\n", cmdStyle.Render("-skip LIST"), descStyle.Render("Run every setup phase but these"))
+	fmt.Printf("  %s %s\n", cmdStyle.Render("-docker-key-fingerprint FPR"), descStyle.Render("Override the pinned Docker signing key"))
+	fmt.Printf("  %s   %s\n", cmdStyle.Render("-offline-bundle DIR"), descStyle.Render("Install Docker from checksummed .deb files"))
+	fmt.Printf("  %s  %s\n", cmdStyle.Render("-since/-until TIME"), descStyle.Render("Time range for -events: 12h, 7d or 2024-05-01 03:00"))
+	fmt.Printf("  %s      %s\n", cmdStyle.Render("-source LIST"), descStyle.Render("Sources for -events: servctl,docker,backup,smart"))
+	fmt.Printf("  %s    %s\n", cmdStyle.Render("-event-webhook URL"), descStyle.Render("POST lifecycle events as JSON (saved by setup)"))
 	fmt.Println()
 }
 
-func runPreflightChecks() {
+func runPreflightChecks() int {
 	fmt.Println()
 
 	// Check if running on Linux
@@ -180,11 +509,12 @@ func runPreflightChecks() {
 
 	// Exit with appropriate code
 	if preflight.HasBlockers(results) {
-		os.Exit(1)
+		return utils.ExitPreflight
 	}
+	return utils.ExitOK
 }
 
-func runSetupWizard(dryRun bool) {
+func runSetupWizard(dryRun, noSudo bool, credentials string, phases phaseSet) int {
 	fmt.Println()
 
 	// Get current user and paths
@@ -205,6 +535,30 @@ func runSetupWizard(dryRun bool) {
 		}
 	}
 
+	// Optionally record the session; secrets are masked when it is saved
+	var config *compose.ServiceConfig
+	if !dryRun && promptRecordSession(infraRoot) {
+		session, err := recording.Start(filepath.Join(infraRoot, recording.SessionFile), "servctl -start-setup")
+		if err != nil {
+			fmt.Println(warningStyle.Render("Warning: Could not record the session: " + err.Error()))
+		} else {
+			recorder = session
+			defer func() {
+				if config != nil {
+					recorder.Mask(config.Secrets()...)
+				}
+				err := recorder.Stop()
+				recorder = nil
+				if err != nil {
+					fmt.Println(warningStyle.Render("Warning: Could not save the session recording: " + err.Error()))
+					return
+				}
+				fmt.Println(descStyle.Render("Session recorded (passwords masked): " + session.Path()))
+				fmt.Println(descStyle.Render("Replay with: asciinema play " + session.Path()))
+			}()
+		}
+	}
+
 	// Banner
 	banner := `
    _____ ______ ______     _______ _     
@@ -218,535 +572,4186 @@ func runSetupWizard(dryRun bool) {
 `
 	fmt.Println(titleStyle.Render(banner))
 
+	// Failures take the criticality of their phase. A critical one ends the
+	// wizard with the summary and the phase's exit code; the rest are listed
+	// after the mission report.
+	var failures utils.Failures
+	resume := setupResumeCommand(noSudo)
+	resumeHint = resume
+	record := func(err *utils.ServctlError) bool {
+		emit(hooks.Event{Event: hooks.PhaseFailed, Phase: err.Phase, Critical: err.IsCritical,
+			Message: err.Operation + ": " + err.Err.Error()})
+		return failures.Add(err)
+	}
+	stop := func() int {
+		fmt.Println()
+		fmt.Print(errorStyle.Render(utils.FormatSummary(failures, resume)))
+		critical := failures.Critical()
+		if logger != nil {
+			logger.Error("Setup stopped: %v", critical)
+		}
+		return criticalPhases[critical.Phase]
+	}
+
+	pkgmgr.Observe = timings.Command
+	emit(hooks.Event{Event: hooks.SetupStarted, Details: map[string]string{"rootless": fmt.Sprint(noSudo)}})
+
 	if dryRun {
 		fmt.Println(warningStyle.Render("🔍 DRY RUN MODE - No changes will be made"))
 		fmt.Println()
 	}
+	fmt.Println(descStyle.Render("Session: " + session.Kind()))
+	if assumeYes {
+		fmt.Println(descStyle.Render("Answering every prompt with its default (-yes); disks are never erased without a typed confirmation"))
+	}
+	fmt.Println()
 
-	// Phase 1: Preflight checks with auto-installation
-	fmt.Println(sectionStyle.Render("📋 Phase 1: System Preparation"))
+	if noSudo {
+		// Rootless: nothing outside $HOME is touched, Docker runs as this user
+		fmt.Println(warningStyle.Render("👤 ROOTLESS MODE - These steps will be skipped:"))
+		for _, s := range preflight.RootlessSkipped() {
+			fmt.Println(descStyle.Render("    • " + s.Name))
+		}
+		preflight.UseRootlessDocker()
+		directory.Rootless = true
+	} else {
+		// Ask for sudo once, before anything runs, and keep it alive so no
+		// password prompt interrupts a later phase
+		fmt.Print(renderPrivilegedOps(preflight.PlannedPrivilegedOps()))
+	}
+	if !noSudo && !dryRun && !preflight.IsRoot() {
+		if err := preflight.AcquireSudo(); err != nil {
+			fmt.Println(errorStyle.Render("Error: " + err.Error()))
+			fmt.Println(descStyle.Render("servctl needs sudo for the steps above."))
+			return utils.ExitPreflight
+		}
+		stopSudo := preflight.KeepSudoAlive(preflight.SudoRefreshInterval)
+		defer stopSudo()
+		fmt.Println(successStyle.Render("✓ sudo access confirmed for this session"))
+	}
 	fmt.Println()
 
-	// Check for missing dependencies first
-	missing := preflight.GetMissingDependencies()
-	if len(missing) > 0 {
-		fmt.Println(descStyle.Render("Found missing dependencies, installing..."))
+	// Phases left out with -only or -skip take what they would have set up
+	// from the last run's saved state
+	reader := promptReader()
+	var sysctlRecord *compose.SysctlRecord
+	var spindown []storage.Disk // Drives the chosen layout leaves idle between backups
+	var surfaceScans []storage.SurfaceScan
+	if saved, err := compose.LoadState(infraRoot); err == nil {
+		// Disks scanned on an earlier run are not offered again
+		surfaceScans = saved.SurfaceScans
+	}
+	backupMount := storage.DefaultStrategyConfig().BackupMount
+	var serviceRoots paths.Roots     // Services kept off the data root
+	var placement *storage.Placement // Where the applied layout puts the data
+	dataRoot := "/mnt/data"
+	if noSudo {
+		dataRoot = filepath.Join(homeDir, "data")
+	}
+	// Who the containers run as and the directories belong to (PUID/PGID)
+	owner, err := directory.GetOwnerInfo()
+	if err != nil {
+		fmt.Println(warningStyle.Render("Warning: " + err.Error()))
+	}
+	var shareGroup string
+	if phases != nil {
+		fmt.Println(descStyle.Render("Running only: " + strings.Join(phases.names(), ", ")))
+		fmt.Println()
+		saved, err := compose.LoadState(infraRoot)
+		switch {
+		case err == nil:
+			config = saved
+			sysctlRecord = saved.Sysctl
+			dataRoot = saved.DataRoot
+			serviceRoots = saved.ServiceRoots
+			if owner != nil && !noSudo {
+				owner.UID, owner.GID = saved.PUID, saved.PGID
+				shareGroup = saved.ShareGroup
+			}
+		case !phases.runs(phaseServices) && (phases.runs(phaseMaintenance) || phases.runs(phaseBootstrap)):
+			fmt.Println(errorStyle.Render("Error: " + err.Error()))
+			fmt.Println(descStyle.Render("Maintenance and bootstrap use the service configuration; include the services phase."))
+			return utils.ExitNotConfigured
+		}
+	}
+
+	// continueTo asks before each phase after the first one this run does.
+	// It is true when the wizard should go on, whether or not phase runs.
+	ran := false
+	continueTo := func(phase, question string) bool {
+		if !phases.runs(phase) {
+			return true
+		}
+		if ran && !promptContinue(question) {
+			return false
+		}
+		ran = true
+		return true
+	}
+
+	// Phase 1: Preflight checks with auto-installation
+	packageVersions := preflight.InstalledPackageVersions()
+	if continueTo(phasePreparation, "") && phases.runs(phasePreparation) {
+		timings.BeginPhase(phasePreparation)
+		fmt.Println(sectionStyle.Render("📋 Phase 1: System Preparation"))
 		fmt.Println()
 
-		for _, dep := range missing {
-			fmt.Printf("  📦 Installing %s...", dep.Name)
-			if dryRun {
-				fmt.Println(successStyle.Render(" [DRY RUN]"))
-			} else {
-				err := preflight.InstallDependency(dep)
-				if err != nil {
-					fmt.Println(errorStyle.Render(" FAILED"))
-					fmt.Printf("    Error: %v\n", err)
-				} else {
-					fmt.Println(successStyle.Render(" ✓"))
+		// Package installs redraw a single progress line
+		progress := &packageProgress{}
+		preflight.PackageProgress = progress.update
+
+		var results []preflight.CheckResult
+		var installResults []preflight.InstallResult
+		if noSudo {
+			// Nothing can be installed without root; only check what is there
+			results = preflight.RunRootlessPreflightChecks()
+		} else {
+			// A slow or dead mirror would stall every install below
+			preflight.PromptMirrorSwitch(reader, dryRun)
+
+			// Check for missing dependencies first
+			missing := preflight.GetMissingDependencies()
+			if len(missing) > 0 {
+				fmt.Println(descStyle.Render("Found missing dependencies, installing..."))
+				fmt.Println()
+
+				for _, dep := range missing {
+					ops.Execute(dryRun, ops.Func{Description: "install " + dep.Name, Fn: func() error {
+						fmt.Printf("  📦 Installing %s...\n", dep.Name)
+						err := preflight.InstallDependency(dep)
+						progress.clear()
+						if err != nil {
+							fmt.Println(errorStyle.Render("    ✗ FAILED"))
+							fmt.Printf("    Error: %v\n", err)
+						} else {
+							fmt.Println(successStyle.Render("    ✓ Installed"))
+						}
+						return nil
+					}})
 				}
+				fmt.Println()
 			}
+
+			// Run preflight checks with auto-fix
+			results, installResults, _ = preflight.RunPreflightWithAutoFix(dryRun)
+			progress.clear()
 		}
+		packageVersions = preflight.InstalledPackageVersions()
+		fmt.Print(tui.RenderPreflightResults(results))
 		fmt.Println()
-	}
-
-	// Run preflight checks with auto-fix
-	results, installResults, _ := preflight.RunPreflightWithAutoFix(dryRun)
-	fmt.Print(tui.RenderPreflightResults(results))
-	fmt.Println()
 
-	// Show installation summary if any dependencies were installed
-	if len(installResults) > 0 {
-		successCount := 0
-		for _, r := range installResults {
-			if r.Success {
-				successCount++
+		// Show installation summary if any dependencies were installed
+		if len(installResults) > 0 {
+			successCount := 0
+			for _, r := range installResults {
+				if r.Success {
+					successCount++
+				}
 			}
+			fmt.Printf("  %s Installed %d/%d dependencies\n\n",
+				successStyle.Render("✓"),
+				successCount,
+				len(installResults))
 		}
-		fmt.Printf("  %s Installed %d/%d dependencies\n\n",
-			successStyle.Render("✓"),
-			successCount,
-			len(installResults))
-	}
 
-	if preflight.HasBlockers(results) {
-		fmt.Println(errorStyle.Render("Critical issues remain. Please resolve manually:"))
-		for _, r := range results {
-			if r.Status == preflight.StatusFail {
-				fmt.Printf("  ✗ %s: %s\n", r.Name, r.Message)
-				for _, d := range r.Details {
-					if d != "" {
-						fmt.Printf("    %s\n", d)
+		if preflight.HasBlockers(results) {
+			for _, r := range results {
+				if r.Status == preflight.StatusFail {
+					var fixes []string
+					for _, d := range r.Details {
+						if d != "" {
+							fixes = append(fixes, d)
+						}
 					}
+					record(setupFailure(phasePreparation, r.Name, fmt.Errorf("%s", r.Message), fixes...))
 				}
 			}
+			return stop()
 		}
-		os.Exit(1)
-	}
 
-	// Interactive: Prompt for static IP configuration if DHCP detected
-	reader := bufio.NewReader(os.Stdin)
-	preflight.PromptStaticIPSetup(reader, dryRun)
+		// Interactive: Prompt for static IP configuration if DHCP detected
+		if !noSudo {
+			preflight.PromptStaticIPSetup(reader, dryRun)
 
-	if !promptContinue("Continue to disk selection?") {
-		fmt.Println("Setup cancelled.")
-		return
+			var err error
+			if sysctlRecord, err = setupSysctl(infraRoot, dryRun); err != nil {
+				fmt.Println(warningStyle.Render("  Warning: " + err.Error()))
+				record(utils.NewWarningError(phasePreparation, "Tune kernel parameters", err,
+					"The defaults work; Nextcloud and Syncthing may stop noticing changes in very large folders"))
+			}
+		}
 	}
 
-	// Phase 2: Disk Selection
-	fmt.Println()
-	fmt.Println(sectionStyle.Render("💾 Phase 2: Storage Configuration"))
-	fmt.Println()
-
-	disks, err := storage.DiscoverDisks()
-	if err != nil {
-		fmt.Println(warningStyle.Render("Error discovering disks: " + err.Error()))
+	if !continueTo(phaseStorage, "Continue to disk selection?") {
+		fmt.Println("Setup cancelled.")
+		return utils.ExitCancelled
 	}
 
-	// Show discovered disks first
-	if len(disks) > 0 {
-		fmt.Print(tui.RenderDiskDiscovery(disks))
+	// Phase 2: Disk Selection
+	if phases.runs(phaseStorage) {
 		fmt.Println()
-	}
-
-	// Generate and display storage strategy recommendations
-	sysInfo := storage.GetSystemInfo()
-	strategies := storage.GenerateStrategies(disks, sysInfo)
-
-	if len(strategies) > 0 {
-		fmt.Print(tui.RenderStrategies(strategies))
+		timings.BeginPhase(phaseStorage)
+		fmt.Println(sectionStyle.Render("💾 Phase 2: Storage Configuration"))
 		fmt.Println()
 
-		// Interactive strategy selection
-		selectedStrategy, ok := storage.PromptStrategySelection(reader, strategies)
-		if !ok {
-			fmt.Println(descStyle.Render("  Skipping storage configuration."))
-		} else {
+		if noSudo {
+			fmt.Println(warningStyle.Render("Skipped in rootless mode: formatting and mounting disks need root."))
+			fmt.Println(descStyle.Render("Data will be stored under ~/data on the existing filesystem."))
 			fmt.Println()
-			fmt.Printf("  Selected: %s\n", successStyle.Render(selectedStrategy.Name))
+		} else {
+			disks, err := storage.DiscoverDisks()
+			if err != nil {
+				fmt.Println(warningStyle.Render("Error discovering disks: " + err.Error()))
+			}
 
-			// Show preview and offer customization
-			strategyConfig, proceed := storage.PromptStrategyConfirmation(reader, selectedStrategy)
-			if !proceed {
-				fmt.Println(descStyle.Render("  Skipping storage configuration."))
-			} else {
-				// Confirm destructive operation
-				needsConfirmation := len(selectedStrategy.Disks) > 0
-				if needsConfirmation && !dryRun {
-					confirmed := true
-					for _, disk := range selectedStrategy.Disks {
-						if !storage.PromptEraseConfirmation(reader, disk) {
-							confirmed = false
-							fmt.Println(warningStyle.Render("  Operation cancelled."))
-							break
-						}
+			// Show discovered disks first
+			if len(disks) > 0 {
+				fmt.Print(tui.RenderDiskDiscovery(disks))
+				fmt.Println()
+			}
+
+			// Used disks can be scanned for bad blocks before a layout relies on them
+			if candidates := storage.SurfaceScanCandidates(disks, surfaceScans); len(candidates) > 0 {
+				fmt.Println("  These disks have been used before; disks a scan finds bad blocks on")
+				fmt.Println("  are kept out of mirrors and backups:")
+				scans := runSurfaceScan(reader, candidates, dryRun)
+				for _, s := range scans {
+					if s.BadBlocks > 0 {
+						record(utils.NewWarningError(phaseStorage, "Surface scan "+s.Path,
+							fmt.Errorf("%d bad blocks on %s %s", s.BadBlocks, s.Model, s.Serial),
+							"Use the disk only for data you can replace, or return it",
+							"Check its SMART data: sudo smartctl -a "+s.Path))
 					}
+				}
+				surfaceScans = storage.RecordSurfaceScans(surfaceScans, scans)
+				fmt.Println()
+			}
+			disks = storage.ApplySurfaceScans(disks, surfaceScans)
+
+			// Generate and display storage strategy recommendations
+			sysInfo := storage.GetSystemInfo()
+			strategies := storage.GenerateStrategies(disks, sysInfo)
+
+			if len(strategies) > 0 {
+				fmt.Print(tui.RenderStrategies(strategies))
+				fmt.Println()
 
-					if confirmed {
-						// Apply the strategy with user config
-						results := storage.ApplyStrategy(selectedStrategy, strategyConfig.ToConfigMap(), dryRun)
-						fmt.Println()
-						for _, r := range results {
-							if r.Success {
-								fmt.Println(successStyle.Render("  ✓ " + r.Message))
-							} else {
-								fmt.Println(errorStyle.Render("  ✗ " + r.Message))
+				// Interactive strategy selection
+				selectedStrategy, ok := storage.PromptStrategySelection(reader, strategies)
+				if !ok {
+					fmt.Println(descStyle.Render("  Skipping storage configuration."))
+				} else {
+					fmt.Println()
+					fmt.Printf("  Selected: %s\n", successStyle.Render(selectedStrategy.Name))
+
+					// Show preview and offer customization
+					strategyConfig, proceed := storage.PromptStrategyConfirmation(reader, selectedStrategy)
+					if !proceed {
+						fmt.Println(descStyle.Render("  Skipping storage configuration."))
+					} else {
+						backupMount = strategyConfig.BackupMount
+
+						// Confirm destructive operation; a dry run only prints it
+						needsConfirmation := len(selectedStrategy.Disks) > 0
+						if needsConfirmation || dryRun {
+							confirmed := true
+							for _, disk := range selectedStrategy.Disks {
+								if !dryRun && !storage.PromptEraseConfirmation(reader, disk) {
+									confirmed = false
+									fmt.Println(warningStyle.Render("  Operation cancelled."))
+									break
+								}
+							}
+
+							if confirmed {
+								spindown = storage.SpindownCandidates(selectedStrategy)
+								planned := storage.PlanPlacement(selectedStrategy, strategyConfig)
+								placement = &planned
+
+								// Apply the strategy with user config
+								started := time.Now()
+								// Disks format side by side; one line shows them all
+								var progress func([]storage.FormatStatus)
+								if !dryRun {
+									lastWidth := 0
+									progress = func(s []storage.FormatStatus) {
+										line := storage.RenderFormatProgress(s)
+										fmt.Printf("\r%-*s", lastWidth, line)
+										lastWidth = len(line)
+									}
+								}
+								results := storage.ApplyStrategyProgress(selectedStrategy, strategyConfig.ToConfigMap(), dryRun, progress)
+								var applyErr error
+								fmt.Println()
+								for _, r := range results {
+									switch {
+									case r.Success && !dryRun:
+										fmt.Println(successStyle.Render("  ✓ " + r.Message))
+									case !r.Success:
+										applyErr = fmt.Errorf("%s", r.Message)
+										fmt.Println(errorStyle.Render("  ✗ " + r.Message))
+										record(setupFailure(phaseStorage, "Apply "+selectedStrategy.Name, fmt.Errorf("%s", r.Message),
+											"Check the disks with lsblk and dmesg",
+											"Or skip storage configuration on the next run to keep the current layout"))
+									}
+								}
+								timings.Command("Format and mount disks ("+selectedStrategy.Name+")", started, applyErr)
 							}
 						}
 					}
-				} else if dryRun {
-					// Dry run - show what would happen
-					results := storage.ApplyStrategy(selectedStrategy, strategyConfig.ToConfigMap(), true)
-					fmt.Println()
-					fmt.Println(descStyle.Render("  [Dry Run] Operations that would be performed:"))
-					for _, r := range results {
-						fmt.Println("    → " + r.Message)
-					}
 				}
+			} else {
+				fmt.Println(warningStyle.Render("No storage strategies available for your hardware."))
 			}
 		}
-	} else {
-		fmt.Println(warningStyle.Render("No storage strategies available for your hardware."))
-	}
 
-	if !promptContinue("Continue to directory setup?") {
-		fmt.Println("Setup cancelled.")
-		return
+		if failures.Critical() != nil {
+			return stop()
+		}
 	}
 
-	// Phase 3: Directory Structure
-	fmt.Println()
-	fmt.Println(sectionStyle.Render("📁 Phase 3: Directory Structure"))
-	fmt.Println()
-
-	// Interactive service selection
-	serviceSelection := directory.PromptServiceSelection(reader)
-	fmt.Println()
+	// Services follow the disks: the applied layout's mounts, or the fast
+	// and scratch disks set up on an earlier run
+	if !noSudo {
+		if placement == nil {
+			detected := storage.DetectPlacement(dataRoot)
+			placement = &detected
+		}
+		dataRoot = placement.DataRoot
+		if phases.runs(phaseStorage) {
+			fmt.Println()
+			fmt.Print(tui.RenderPlacement(*placement))
+		}
+	}
 
-	// Allow customization of data root
-	dataRoot := "/mnt/data"
-	fmt.Print("Press Enter to use default paths, or 'c' to customize: ")
-	customInput, _ := reader.ReadString('\n')
-	if strings.TrimSpace(strings.ToLower(customInput)) == "c" {
-		dataRoot = directory.PromptCustomDataRoot(reader, dataRoot)
+	if !continueTo(phaseDirectories, "Continue to directory setup?") {
+		fmt.Println("Setup cancelled.")
+		return utils.ExitCancelled
 	}
 
-	// Generate directories based on selection
-	allDirs := directory.GetDirectoriesForServices(serviceSelection, homeDir, dataRoot)
+	// Phase 3: Directory Structure
+	var allDirs []directory.DirectorySpec
+	if phases.runs(phaseDirectories) {
+		fmt.Println()
+		timings.BeginPhase(phaseDirectories)
+		fmt.Println(sectionStyle.Render("📁 Phase 3: Directory Structure"))
+		fmt.Println()
 
-	fmt.Println()
-	fmt.Printf("Creating directories for: %s\n", strings.Join(serviceSelection.SelectedNames(), ", "))
-	fmt.Println()
-	fmt.Print(tui.RenderDirectoryPlan(allDirs))
-	fmt.Println()
+		// Interactive service selection
+		serviceSelection := directory.PromptServiceSelection(reader, setupCapacity(dataRoot))
+		fmt.Println()
 
-	if !dryRun {
-		fmt.Println(descStyle.Render("Creating directories..."))
-		var results []directory.DirectoryResult
-		for _, spec := range allDirs {
-			results = append(results, directory.CreateDirectory(spec, dryRun))
+		// Throwaway downloads go to the scratch disk unless already placed
+		if placement != nil && placement.ScratchRoot != "" && serviceSelection.Downloads && serviceRoots["downloads"] == "" {
+			if serviceRoots == nil {
+				serviceRoots = make(paths.Roots)
+			}
+			serviceRoots["downloads"] = placement.ScratchRoot
+			fmt.Printf("Downloads go to the scratch disk at %s.\n", placement.ScratchRoot)
 		}
-		fmt.Print(tui.RenderDirectoryComplete(results, nil))
-	} else {
-		fmt.Println(warningStyle.Render("[DRY RUN] Would create directories listed above"))
-	}
 
-	if !promptContinue("Continue to service configuration?") {
-		fmt.Println("Setup cancelled.")
-		return
-	}
+		// Allow customization of data root
+		fmt.Print("Press Enter to use default paths, or 'c' to customize: ")
+		customInput, _ := reader.ReadString('\n')
+		if strings.TrimSpace(strings.ToLower(customInput)) == "c" {
+			dataRoot = directory.PromptCustomDataRoot(reader, dataRoot)
+			if !noSudo {
+				serviceRoots = directory.PromptServiceRoots(reader, serviceSelection, dataRoot, serviceRoots, func(root string) error {
+					return validateServiceRoot(root, dataRoot, backupMount)
+				})
+			}
+		}
 
-	// Phase 4: Service Composition
-	fmt.Println()
-	fmt.Println(sectionStyle.Render("🐳 Phase 4: Service Configuration"))
-	fmt.Println()
+		// Generate directories based on selection
+		directory.ServiceRoots = serviceRoots
+		allDirs = directory.GetDirectoriesForServices(serviceSelection, homeDir, dataRoot)
 
-	config := compose.DefaultConfig()
-	config.AutoFillDefaults()
-	config.InfraRoot = filepath.Join(homeDir, "infra")
-	config.DataRoot = dataRoot
+		fmt.Println()
 
-	// Detect host IP
-	if ip, err := compose.DetectHostIP(); err == nil {
-		config.HostIP = ip
-		fmt.Printf("Detected Host IP: %s\n", successStyle.Render(ip))
-	}
+		// The owner's own group, or one shared with other people
+		if owner != nil && !noSudo {
+			invoker := owner.Username
+			var group *directory.SharedGroup
+			owner, group = directory.PromptOwnership(reader, owner)
+			shareGroup = ""
+			if group != nil {
+				members := []string{invoker}
+				if _, err := user.Lookup(owner.Username); err == nil && owner.Username != invoker {
+					members = append(members, owner.Username)
+				}
+				if err := group.Ensure(members, dryRun); err != nil {
+					fmt.Println(errorStyle.Render("Error: " + err.Error()))
+					record(setupFailure(phaseDirectories, "Set up group "+group.Name, err,
+						"Create it with 'sudo groupadd "+group.Name+"', or keep the default group"))
+					return stop()
+				}
+				if group.Exists {
+					owner.GID = group.GID
+				}
+				shareGroup = group.Name
+			}
+		}
 
-	// Generate credentials
-	config.NextcloudAdminPass = compose.GenerateDBPassword()
+		fmt.Printf("Creating directories for: %s\n", strings.Join(serviceSelection.SelectedNames(), ", "))
+		fmt.Println()
+		fmt.Print(tui.RenderDirectoryPlan(allDirs))
+		fmt.Println()
 
-	// Interactive config confirmation
-	config, proceed := compose.PromptConfigConfirmation(reader, config)
-	if !proceed {
-		fmt.Println(descStyle.Render("  Skipping Docker Compose generation."))
-	} else {
-		composeDir := filepath.Join(homeDir, "infra", "compose")
+		fmt.Println(descStyle.Render("Creating directories..."))
+		// New directories get their owner as they are created; existing
+		// ones (and the data inside them) are left untouched
+		results := directory.CreateDirectories(allDirs, owner, dryRun)
 		if !dryRun {
-			fmt.Println(descStyle.Render("Generating Docker Compose files..."))
-			if err := compose.WriteAllConfigFiles(config, composeDir, dryRun); err != nil {
-				fmt.Println(errorStyle.Render("Error: " + err.Error()))
-			} else {
-				fmt.Println(tui.RenderComposeGenerated(composeDir))
+			fmt.Print(tui.RenderDirectoryComplete(results, owner))
+		}
+		for _, r := range results {
+			if r.Error != nil {
+				record(setupFailure(phaseDirectories, "Create "+r.Spec.Path, r.Error,
+					"Check that "+filepath.Dir(r.Spec.Path)+" exists and is writable"))
 			}
-		} else {
-			fmt.Println(warningStyle.Render("[DRY RUN] Would generate Docker Compose files"))
-			compose.WriteAllConfigFiles(config, composeDir, dryRun)
+		}
+		if failures.Critical() != nil {
+			return stop()
 		}
 	}
 
-	if !promptContinue("Continue to maintenance setup?") {
+	if !continueTo(phaseServices, "Continue to service configuration?") {
 		fmt.Println("Setup cancelled.")
-		return
+		return utils.ExitCancelled
 	}
 
-	// Phase 5: Maintenance
-	fmt.Println()
-	fmt.Println(sectionStyle.Render("🔧 Phase 5: Maintenance Scripts"))
-	fmt.Println()
+	// Phase 4: Service Composition
+	composeDir := filepath.Join(homeDir, "infra", "compose")
+	proceed := config != nil
+	if phases.runs(phaseServices) {
+		fmt.Println()
+		timings.BeginPhase(phaseServices)
+		fmt.Println(sectionStyle.Render("🐳 Phase 4: Service Configuration"))
+		fmt.Println()
 
-	// Interactive script selection
-	scriptSelection := maintenance.PromptScriptSelection(reader)
-	fmt.Println()
+		// A phase re-run on its own starts from the saved answers, keeping the
+		// passwords the databases were created with
+		if config == nil {
+			config = compose.DefaultConfig()
+			config.AutoFillDefaults()
+			config.InfraRoot = filepath.Join(homeDir, "infra")
+			config.DataRoot = dataRoot
+			config.UploadPath = config.Path(paths.Gallery)
 
-	mConfig := maintenance.DefaultScriptConfig()
-	mConfig.LogDir = filepath.Join(homeDir, "infra", "logs")
-	mConfig.InfraRoot = filepath.Join(homeDir, "infra")
-	mConfig.DataRoot = dataRoot
+			// Generate credentials
+			config.NextcloudAdminPass = compose.GenerateDBPassword()
 
-	// Prompt for backup schedule if backup selected
-	if scriptSelection.DailyBackup {
-		schedule := maintenance.PromptBackupSchedule(reader)
-		fmt.Printf("  Backup schedule: %s\n", schedule)
-	}
+			// Size Immich's ML models to this machine's memory
+			config.MLModels = compose.RecommendMLPreset(storage.GetSystemInfo().TotalRAM)
+		} else {
+			fmt.Println(descStyle.Render("Starting from the saved configuration; passwords are kept."))
+			if config.DataRoot != dataRoot {
+				config.DataRoot = dataRoot
+				config.UploadPath = config.Path(paths.Gallery)
+			}
+		}
+		config.Sysctl = sysctlRecord
+		config.SurfaceScans = surfaceScans
+		config.ServiceRoots = serviceRoots
+		config.UploadPath = config.Path(paths.Gallery)
+		if owner != nil && !noSudo {
+			config.PUID, config.PGID = owner.UID, owner.GID
+			config.ShareGroup = shareGroup
+		}
+		if noSudo {
+			config.Rootless = true
+			config.DockerSocket = preflight.RootlessDockerSocket()
+		}
 
-	// Prompt for webhook URL
-	webhookURL := maintenance.PromptWebhookURL(reader)
-	if webhookURL != "" {
-		mConfig.WebhookURL = webhookURL
-		fmt.Println(successStyle.Render("  ✓ Webhook configured"))
-	}
-	fmt.Println()
+		// Detect host IP
+		if ip, err := compose.DetectHostIP(); err == nil {
+			config.HostIP = ip
+			fmt.Printf("Detected Host IP: %s\n", successStyle.Render(ip))
+		}
 
-	// Generate selected scripts only
-	scripts, _ := maintenance.GetScriptsForSelection(scriptSelection, mConfig)
-	if len(scripts) > 0 {
-		fmt.Print(tui.RenderAllScripts(scripts))
+		// Speed-tiered storage: keep databases and caches on the fast pool
+		if placement != nil && placement.FastRoot != "" &&
+			promptContinue(fmt.Sprintf("Place databases and caches on %s (symlinked from %s)?", placement.FastRoot, dataRoot)) {
+			config.FastRoot = placement.FastRoot
+		}
+
+		// Ports the web interfaces are published on
 		fmt.Println()
+		config = compose.PromptPorts(reader, config)
 
-		scriptsDir := filepath.Join(homeDir, "infra", "scripts")
-		if !dryRun {
-			fmt.Println(descStyle.Render("Generating maintenance scripts..."))
+		// Interactive config confirmation
+		config, proceed = compose.PromptConfigConfirmation(reader, config)
+		if errs := config.ValidatePorts(); proceed && len(errs) > 0 {
+			for _, err := range errs {
+				fmt.Println(errorStyle.Render("Error: " + err.Error()))
+			}
+			record(setupFailure(phaseServices, "Check service ports", errs[0],
+				"Run the services phase again and choose a free port: "+setupResumeCommand(noSudo)+" -only services"))
+			return stop()
+		}
+		if !proceed {
+			fmt.Println(descStyle.Render("  Skipping Docker Compose generation."))
+		} else {
+			// A dry run takes the same path; the writes below only print
+			fmt.Println(descStyle.Render("Generating Docker Compose files..."))
+			if err := compose.WriteAllConfigFiles(config, composeDir, dryRun); err != nil {
+				fmt.Println(errorStyle.Render("Error: " + err.Error()))
+				record(setupFailure(phaseServices, "Write Docker Compose files", err,
+					"Check that "+composeDir+" is writable and the disk is not full"))
+				return stop()
+			}
+			if !dryRun {
+				fmt.Println(tui.RenderComposeGenerated(composeDir))
+			}
+
+			// Docker Compose reads the files the way 'up' will: a schema error
+			// or a credential missing from .env stops here
+			if r := bootstrap.CheckComposeConfig(composeDir, dryRun); r.Success {
+				fmt.Println(successStyle.Render("  ✓ ") + r.Message)
+			} else {
+				fmt.Println(errorStyle.Render("  ✗ ") + r.Message)
+				record(setupFailure(phaseServices, "Check Docker Compose files", r.Error,
+					"Fix the reported line or value in "+composeDir+", or run the services phase again: "+setupResumeCommand(noSudo)+" -only services"))
+				return stop()
+			}
+			config.PackageVersions = packageVersions
+			if lifecycle != nil {
+				config.EventWebhookURL = lifecycle.URL
+			}
+			if err := compose.SaveState(config, dryRun); err != nil {
+				fmt.Println(warningStyle.Render("Warning: " + err.Error()))
+				record(utils.NewWarningError(phaseServices, "Save setup state", err,
+					"Commands such as -status and -checklist read it; check "+config.InfraRoot+" is writable"))
+			}
+			ensureMountedDirectories(config, dryRun)
+
+			// An active firewall would hide the web interfaces on their ports
+			if !noSudo && compose.IsUFWInstalled() {
+				if active, err := compose.IsUFWEnabled(); err == nil && active {
+					if r := compose.ConfigureFirewall(compose.FirewallRules(config), false, dryRun); len(r.Errors) > 0 {
+						record(utils.NewWarningError(phaseServices, "Open service ports in UFW", r.Errors[0],
+							fmt.Sprintf("Allow each by hand with 'sudo ufw allow PORT/tcp' for ports %d, %d and %d",
+								config.ImmichPort, config.NextcloudPort, config.GlancesPort)))
+					}
+				}
+			}
+
+			// Images and models are fetched on first start if these fail
+			if r := bootstrap.CheckImageRegistries(composeDir, dryRun); !r.Success {
+				fmt.Println(warningStyle.Render("  ⚠ ") + r.Message)
+				record(utils.NewWarningError(phaseServices, "Reach image registries", r.Error,
+					"Check DNS and the internet connection, then 'docker compose pull' in "+composeDir))
+			} else {
+				fmt.Println(successStyle.Render("  ✓ ") + r.Message)
+				if err := runImagePrePull(composeDir, dryRun); err != nil {
+					record(utils.NewWarningError(phaseServices, "Pre-pull images", err,
+						"Images are pulled on first start instead; check the network and free space"))
+				}
+			}
+
+			if config.MLEnabled() {
+				fmt.Println(descStyle.Render("  Downloading Immich ML models..."))
+				if r := bootstrap.PreloadMLModels(config, composeDir, dryRun); r.Success {
+					fmt.Println(successStyle.Render("  ✓ ") + r.Message)
+				} else {
+					fmt.Println(warningStyle.Render("  ⚠ ") + r.Message)
+					record(utils.NewWarningError(phaseServices, "Download Immich ML models", fmt.Errorf("%s", r.Message),
+						"Immich downloads them on first use instead"))
+				}
+			}
+		}
+	}
+
+	if !continueTo(phaseMaintenance, "Continue to maintenance setup?") {
+		fmt.Println("Setup cancelled.")
+		return utils.ExitCancelled
+	}
+
+	// Phase 5: Maintenance
+	var scripts []maintenance.ScriptInfo
+	var backupKey, powerSummary string
+	if phases.runs(phaseMaintenance) {
+		fmt.Println()
+		timings.BeginPhase(phaseMaintenance)
+		fmt.Println(sectionStyle.Render("🔧 Phase 5: Maintenance Scripts"))
+		fmt.Println()
+
+		// Interactive script selection. Without filesystem checksums, bit rot
+		// in the photo library would go unnoticed, so the scrub starts selected.
+		defaultScripts := maintenance.DefaultScriptSelection()
+		dataFS := storage.FilesystemAt(dataRoot)
+		if maintenance.ScrubRecommended(dataFS) {
+			defaultScripts.BitrotScrub = true
+			fmt.Println(descStyle.Render(fmt.Sprintf("  %s has no data checksums; the bit-rot scrub is preselected.", dataFS)))
+		}
+		scriptSelection := maintenance.PromptScriptSelectionFrom(reader, defaultScripts)
+		if noSudo && scriptSelection.SmartAlert {
+			scriptSelection.SmartAlert = false
+			fmt.Println(descStyle.Render("  SMART alerts need root to read disks; not scheduled in rootless mode."))
+		}
+		if noSudo && scriptSelection.DriveTemp {
+			scriptSelection.DriveTemp = false
+			fmt.Println(descStyle.Render("  Drive temperatures need root to read disks; not scheduled in rootless mode."))
+		}
+		if noSudo && scriptSelection.RebootWindow {
+			scriptSelection.RebootWindow = false
+			fmt.Println(descStyle.Render("  Rebooting needs root; the reboot window is not scheduled in rootless mode."))
+		}
+		if !scriptSelection.DailyBackup && scriptSelection.RestoreDrill {
+			scriptSelection.RestoreDrill = false
+			fmt.Println(descStyle.Render("  The restore drill tests the data backup; not scheduled without it."))
+		}
+		fmt.Println()
+
+		// Drives in closed cabinets overheat; let the case fans follow them
+		if !noSudo {
+			if err := setupFanControl(reader, dryRun); err != nil {
+				fmt.Println(warningStyle.Render("  Warning: " + err.Error()))
+				record(setupFailure(phaseMaintenance, "Configure fan control", err,
+					"Set a fan curve in the BIOS instead, or edit "+storage.FancontrolConfigPath+" and run 'sudo systemctl restart fancontrol'"))
+			}
+
+			// A power cut should stop the databases cleanly, not crash them
+			if err := setupUPS(reader, config, dryRun); err != nil {
+				fmt.Println(warningStyle.Render("  Warning: " + err.Error()))
+				record(setupFailure(phaseMaintenance, "Configure UPS monitoring", err,
+					"Check the UPS is plugged in over USB, then see 'journalctl -u nut-driver -u nut-server'"))
+			}
+		}
+
+		// Idle power: estimate, and tune when allowed
+		var err error
+		powerSummary, err = setupPower(reader, spindown, noSudo, dryRun)
+		if err != nil {
+			fmt.Println(warningStyle.Render("  Warning: " + err.Error()))
+			record(setupFailure(phaseMaintenance, "Tune idle power", err,
+				"See 'systemctl status servctl-powertune' and 'sudo powertop' for what can be tuned"))
+		}
+
+		mConfig := maintenance.DefaultScriptConfig()
+		mConfig.LogDir = filepath.Join(homeDir, "infra", "logs")
+		mConfig.InfraRoot = filepath.Join(homeDir, "infra")
+		mConfig.DataRoot = dataRoot
+		mConfig.FastRoot = config.FastRoot
+		mConfig.ServiceRoots = config.ServiceRoots
+		if config.DockerSocket != "" {
+			mConfig.DockerSocket = config.DockerSocket
+		}
+		mConfig.ScrubPaths = maintenance.DefaultScrubPaths(dataRoot, config.ServiceRoots)
+		if exe, err := os.Executable(); err == nil {
+			mConfig.ServctlPath = exe // disk_alert.sh pauses Immich through it
+		}
+		mConfig.WebPorts = make(map[string]int)
+		for _, s := range exposure.Services(config) {
+			mConfig.WebPorts[s.Name] = s.Port
+		}
+		if !noSudo && storage.SnapshotFS(dataRoot) == "btrfs" {
+			mConfig.SnapshotDir = storage.SnapshotDir
+		}
+
+		// Prompt for backup schedule if backup selected
+		backupSchedule := "daily"
+		if scriptSelection.DailyBackup {
+			backupSchedule = maintenance.PromptBackupSchedule(reader)
+			fmt.Printf("  Backup schedule: %s\n", backupSchedule)
+			mConfig.Retention = maintenance.PromptRetentionPolicy(reader)
+			fmt.Printf("  Retention: %s\n", mConfig.Retention)
+			mConfig.AutoPruneOnLowSpace = maintenance.PromptAutoPrune(reader)
+			mConfig.BackupManifest = maintenance.PromptBackupExcludes(reader)
+		}
+
+		// Databases and configs offsite, for when every local disk is lost
+		if scriptSelection.CriticalOffsite {
+			fmt.Println()
+			maintenance.PromptOffsiteRemote(reader, mConfig)
+			if mConfig.OffsiteRemote == "" {
+				scriptSelection.CriticalOffsite = false
+				fmt.Println(descStyle.Render("  No remote given; the critical data offsite sync is not scheduled."))
+			} else if _, err := exec.LookPath("rclone"); err != nil {
+				fmt.Println(warningStyle.Render("  rclone is not installed: install it and run 'rclone config' before the first sync."))
+			}
+		}
+
+		if scriptSelection.RebootWindow {
+			maintenance.PromptRebootWindow(reader, mConfig)
+			fmt.Printf("  Reboot window: first %s of the month at %d:00\n", maintenance.WeekdayName(mConfig.RebootWeekday), mConfig.RebootHour)
+		}
+
+		// Prompt for webhook URL
+		webhookURL := maintenance.PromptWebhookURL(reader)
+		if webhookURL != "" {
+			mConfig.WebhookURL = webhookURL
+			recorder.Mask(webhookURL)
+			fmt.Println(successStyle.Render("  ✓ Webhook configured"))
+		}
+		fmt.Println()
+
+		// Dead-man-switch for backups
+		maintenance.PromptHeartbeatURLs(reader, scriptSelection, mConfig)
+		recorder.Mask(mConfig.BackupHeartbeatURL, mConfig.ConfigBackupHeartbeatURL)
+		for _, url := range []string{mConfig.BackupHeartbeatURL, mConfig.ConfigBackupHeartbeatURL} {
+			if url == "" {
+				continue
+			}
+			if err := maintenance.PingHeartbeat(url, dryRun); err != nil {
+				fmt.Println(warningStyle.Render("  Warning: " + err.Error()))
+				record(setupFailure(phaseMaintenance, "Ping heartbeat "+url, err,
+					"Check the URL in "+maintenance.ConfigPath(mConfig.InfraRoot)))
+			} else {
+				fmt.Println(successStyle.Render("  ✓ Heartbeat reachable: ") + url)
+			}
+		}
+		fmt.Println()
+
+		// Generate selected scripts only
+		scripts, _ = maintenance.GetScriptsForSelection(scriptSelection, mConfig)
+		if len(scripts) > 0 {
+			scriptsDir := filepath.Join(homeDir, "infra", "scripts")
+
+			// Spread the nightly jobs out in the server's local time
+			jobs := maintenance.CronJobsForSelection(scriptSelection, scriptsDir, backupSchedule)
+			if scriptSelection.RebootWindow {
+				jobs = append(jobs, maintenance.RebootWindowJobs(mConfig, scriptsDir)...)
+			}
+			jobs = maintenance.StaggerJobs(jobs, time.Local)
+			maintenance.ScheduleScripts(scripts, jobs)
+			mConfig.Schedule = jobs
+
+			// Every job runs through the wrapper that keeps its history
+			runner, err := maintenance.RunJobScriptInfo(mConfig)
+			if err != nil {
+				record(setupFailure(phaseMaintenance, "Generate "+maintenance.RunJobScript, err))
+			} else {
+				scripts = append(scripts, runner)
+			}
+			scheduled := maintenance.WrapJobs(jobs, scriptsDir)
+
+			fmt.Print(tui.RenderAllScripts(scripts))
+			fmt.Println()
+
+			fmt.Println(descStyle.Render("Generating maintenance scripts..."))
+			written := 0
 			for _, script := range scripts {
-				maintenance.WriteScript(script, scriptsDir, dryRun)
+				if err := maintenance.WriteScript(script, scriptsDir, dryRun); err != nil {
+					fmt.Println(errorStyle.Render("  ✗ " + err.Error()))
+					record(setupFailure(phaseMaintenance, "Write "+script.Filename, err,
+						"Check that "+scriptsDir+" is writable"))
+					continue
+				}
+				written++
+			}
+			if !dryRun {
+				fmt.Println(successStyle.Render(fmt.Sprintf("  ✓ Generated %d scripts in %s", written, scriptsDir)))
+			} else {
+				problems := 0
+				for _, script := range scripts {
+					for _, issue := range maintenance.LintScript(script.Content) {
+						fmt.Println(warningStyle.Render("  ⚠ " + script.Filename + ": " + issue.String()))
+						problems++
+					}
+				}
+				if problems == 0 {
+					fmt.Println(successStyle.Render(fmt.Sprintf("  ✓ %d scripts pass lint", len(scripts))))
+				}
+			}
+
+			// The config backup and the offsite archives are encrypted; the key
+			// stays on this machine
+			if scriptSelection.InfraConfig || scriptSelection.CriticalOffsite {
+				key, err := maintenance.EnsureBackupKey(mConfig.InfraRoot, dryRun)
+				if err != nil {
+					fmt.Println(warningStyle.Render("  Warning: " + err.Error()))
+					record(setupFailure(phaseMaintenance, "Create config backup key", err,
+						"The config backup cannot be encrypted until the key exists"))
+				}
+				backupKey = key
+				recorder.Mask(key)
+			}
+
+			if err := maintenance.SaveConfig(mConfig, dryRun); err != nil {
+				fmt.Println(warningStyle.Render("  Warning: " + err.Error()))
+				record(setupFailure(phaseMaintenance, "Save maintenance config", err,
+					"Check that "+mConfig.InfraRoot+" is writable"))
+			}
+
+			if noSudo {
+				if err := maintenance.WriteUserTimers(scheduled, maintenance.UserUnitDir(homeDir), dryRun); err != nil {
+					fmt.Println(warningStyle.Render("  Warning: " + err.Error()))
+					record(setupFailure(phaseMaintenance, "Schedule user systemd timers", err,
+						"Check that the systemd user instance runs: systemctl --user status"))
+				} else if !dryRun {
+					fmt.Println(successStyle.Render(fmt.Sprintf("  ✓ Scheduled %d user systemd timers", len(jobs))))
+				}
+			} else if err := maintenance.WriteCronFile(scheduled, dryRun); err != nil {
+				fmt.Println(warningStyle.Render("  Warning: " + err.Error()))
+				record(setupFailure(phaseMaintenance, "Schedule cron jobs", err,
+					"The scripts will not run on their own until they are scheduled"))
+			} else if !dryRun {
+				fmt.Println(successStyle.Render(fmt.Sprintf("  ✓ Scheduled %d cron jobs", len(jobs))))
+			}
+
+			// Recovery instructions live with the backups, not on the server
+			if !noSudo && storage.IsMountPoint(mConfig.BackupDest) {
+				user := currentUser.Username
+				if owner != nil {
+					user = owner.Username
+				}
+				path, err := rescue.Write(filepath.Join(mConfig.BackupDest, rescue.Dir), rescue.Collect(config, mConfig, user, Version), dryRun)
+				if err != nil {
+					fmt.Println(warningStyle.Render("  Warning: " + err.Error()))
+					record(utils.NewWarningError(phaseMaintenance, "Write rescue document", err,
+						"Write it later with: sudo servctl -rescue-doc"))
+				} else if !dryRun {
+					fmt.Println(successStyle.Render("  ✓ Rescue document: " + path))
+				}
+			}
+		} else {
+			fmt.Println(descStyle.Render("  No scripts selected."))
+		}
+	}
+
+	// Phase 6: Service Bootstrap
+	if proceed && phases.runs(phaseBootstrap) && promptContinue("Start services and apply first-run configuration?") {
+		fmt.Println()
+		timings.BeginPhase(phaseBootstrap)
+		fmt.Println(sectionStyle.Render("🚀 Phase 6: Service Bootstrap"))
+		fmt.Println()
+
+		if !noSudo {
+			snapshotBeforeRisky(config, "container upgrade", dryRun)
+		}
+
+		// A database image of another release series cannot open the old
+		// files, so nothing starts until they are upgraded
+		started := time.Now()
+		var results []bootstrap.StepResult
+		if err := upgradeDatabases(config, filepath.Join(composeDir, "docker-compose.yml"), dryRun); err != nil {
+			fmt.Println(errorStyle.Render("  ✗ Upgrade databases: ") + err.Error())
+			record(setupFailure(phaseBootstrap, "Upgrade databases", err,
+				"A dump, and for Postgres the old files, are kept next to each database's directory",
+				"Files whose version cannot be read need sudo, or the database container running",
+				"Run servctl -start-setup again to retry; the services stay stopped until then"))
+		} else {
+			results = bootstrap.RunBootstrap(config, composeDir, dryRun)
+		}
+		var bootstrapErr error
+		for _, r := range results {
+			if r.Success {
+				fmt.Println(successStyle.Render("  ✓ "+r.Name+": ") + r.Message)
+			} else {
+				bootstrapErr = fmt.Errorf("%s", r.Message)
+				fmt.Println(errorStyle.Render("  ✗ "+r.Name+": ") + r.Message)
+				record(setupFailure(phaseBootstrap, r.Name, fmt.Errorf("%s", r.Message),
+					"See the container logs: servctl -logs",
+					"servctl -checklist starts the stack and checks it again"))
+			}
+		}
+		if !dryRun {
+			timings.Command("Start services (image pulls, first-run configuration)", started, bootstrapErr)
+		}
+
+		// A router forward left over from an old setup, or opened by UPnP,
+		// puts a plain-HTTP login page on the internet
+		if _, err := exec.LookPath("upnpc"); err == nil && !dryRun {
+			for _, f := range exposure.Check(exposure.Services(config), "").Findings {
+				fmt.Println(errorStyle.Render("  ✗ " + f.String()))
+				record(utils.NewWarningError(phaseBootstrap, "Check internet exposure", fmt.Errorf("%s", f.String()),
+					"Remove the forward on the router (upnpc -d PORT TCP for UPnP ones)",
+					"Reach the services remotely through the Cloudflare Tunnel or Tailscale instead"))
+			}
+		}
+
+		// Keep the Immich API keys bootstrap created; Immich shows them only once
+		if config.ImmichAPIKeys && !dryRun {
+			if err := compose.SaveState(config, false); err != nil {
+				record(setupFailure(phaseBootstrap, "Save API keys", err))
+			}
+		}
+	}
+
+	commitInfra("Setup wizard: regenerate compose files and maintenance scripts", dryRun)
+
+	// Keep this run's timings for servctl -status
+	timings.EndPhase()
+	if !dryRun {
+		config.Timings = timings.Entries()
+		if err := compose.SaveState(config, false); err != nil {
+			record(utils.NewWarningError(phaseBootstrap, "Save setup timings", err))
+		}
+	}
+
+	// Final Summary - Mission Report
+	fmt.Println()
+
+	missionReport := report.NewMissionReport(config, infraRoot)
+	missionReport.DirsCreated = len(allDirs)
+	missionReport.ScriptsGen = len(scripts)
+	missionReport.ConfigBackupKey = backupKey
+	missionReport.Power = powerSummary
+	if noSudo {
+		missionReport.Skipped = preflight.RootlessSkipped()
+	}
+	if len(config.Users) > 0 && !dryRun {
+		missionReport.ShowQRCodes = promptContinue("Include QR invites for the mobile apps in the report?")
+	}
+
+	var link *report.OneTimeLink
+	ops.Execute(dryRun, ops.Func{Description: "deliver the credentials by " + credentials, Fn: func() error {
+		var err *utils.ServctlError
+		link, err = deliverCredentials(missionReport, credentials, infraRoot)
+		if err != nil {
+			record(err)
+		}
+		return nil
+	}})
+
+	if dryRun {
+		fmt.Print(report.RenderCompactReport(missionReport))
+		fmt.Println()
+		fmt.Println(warningStyle.Render("DRY RUN complete. No actual changes were made."))
+	} else {
+		fmt.Print(report.RenderMissionReport(missionReport))
+	}
+	fmt.Print(renderTimings(timings.Entries()))
+
+	// The link is served last, after everything else is on screen
+	if link != nil {
+		fmt.Println()
+		fmt.Println(report.RenderOneTimeLink(link))
+		fmt.Println(descStyle.Render("  Waiting for the link to be opened (Ctrl+C to give up)..."))
+		if link.Wait(report.LinkTimeout) {
+			fmt.Println(successStyle.Render("  ✓ Credentials delivered; the link no longer works"))
+		} else {
+			record(utils.NewWarningError(phaseBootstrap, "Credentials link", fmt.Errorf("the one-time link expired unused"),
+				"The credentials are in "+filepath.Join(infraRoot, "compose", ".env")+" (mode 0600)"))
+		}
+	}
+
+	// Anything that still needs fixing comes last, where it is seen
+	if len(failures) > 0 {
+		fmt.Println()
+		fmt.Print(warningStyle.Render(utils.FormatSummary(failures, resume)))
+	}
+
+	completed := hooks.Event{Event: hooks.SetupCompleted, Status: "ok"}
+	if len(failures) > 0 {
+		completed.Status = "partial"
+		completed.Message = fmt.Sprintf("%d problem(s)", len(failures))
+	}
+	emit(completed)
+
+	// Log completion
+	if logger != nil {
+		if len(failures) > 0 {
+			logger.Warn("Setup completed with %d problem(s)", len(failures))
+		} else {
+			logger.Info("Setup completed successfully")
+		}
+	}
+
+	// The checklist waits for things done by hand, so -yes leaves it for later
+	if !dryRun && !assumeYes && promptContinue("Walk through the first-boot checklist now? (resume any time with servctl -checklist)") {
+		runChecklist(config)
+	}
+	if len(failures) > 0 {
+		return utils.ExitPartial
+	}
+	return utils.ExitOK
+}
+
+// Setup wizard phases, as named in failure summaries
+const (
+	phasePreparation = "System Preparation"
+	phaseStorage     = "Storage Configuration"
+	phaseDirectories = "Directory Structure"
+	phaseServices    = "Service Configuration"
+	phaseMaintenance = "Maintenance Scripts"
+	phaseBootstrap   = "Service Bootstrap"
+)
+
+// setupPhases are the phases -only and -skip name, in the order they run,
+// with other names they answer to
+var setupPhases = []struct {
+	phase   string
+	name    string
+	aliases []string
+}{
+	{phasePreparation, "preparation", []string{"preflight", "system"}},
+	{phaseStorage, "storage", nil},
+	{phaseDirectories, "directories", []string{"dirs"}},
+	{phaseServices, "services", []string{"compose"}},
+	{phaseMaintenance, "maintenance", []string{"scripts"}},
+	{phaseBootstrap, "bootstrap", []string{"start"}},
+}
+
+// setupPhaseNames lists the names -only and -skip take
+func setupPhaseNames() []string {
+	names := make([]string, len(setupPhases))
+	for i, p := range setupPhases {
+		names[i] = p.name
+	}
+	return names
+}
+
+// phaseSet is the phases one run of the wizard goes through; nil is all
+type phaseSet map[string]bool
+
+func (s phaseSet) runs(phase string) bool {
+	return s == nil || s[phase]
+}
+
+// names lists the set's phases by their -only name, in run order
+func (s phaseSet) names() []string {
+	var names []string
+	for _, p := range setupPhases {
+		if s.runs(p.phase) {
+			names = append(names, p.name)
+		}
+	}
+	return names
+}
+
+// parseSetupPhases turns the -only and -skip lists into the phases to run
+func parseSetupPhases(only, skip string) (phaseSet, error) {
+	if only != "" && skip != "" {
+		return nil, fmt.Errorf("use either -only or -skip, not both")
+	}
+	list := only + skip
+	if list == "" {
+		return nil, nil
+	}
+	named := phaseSet{}
+	for _, name := range strings.Split(list, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		found := false
+		for _, p := range setupPhases {
+			if name == p.name || slices.Contains(p.aliases, name) {
+				named[p.phase], found = true, true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown setup phase %q (phases: %s)", name, strings.Join(setupPhaseNames(), ", "))
+		}
+	}
+	if len(named) == 0 {
+		return nil, fmt.Errorf("no setup phase named in %q", list)
+	}
+	if only != "" {
+		return named, nil
+	}
+	phases := phaseSet{}
+	for _, p := range setupPhases {
+		if !named[p.phase] {
+			phases[p.phase] = true
+		}
+	}
+	if len(phases) == 0 {
+		return nil, fmt.Errorf("-skip leaves no phase to run")
+	}
+	return phases, nil
+}
+
+// criticalPhases are the phases the later ones build on, with the exit code
+// a failure there ends the wizard with: without the data disks, directories
+// and compose files there is nothing to start. Maintenance and bootstrap
+// failures leave a working server and are collected for the summary instead.
+var criticalPhases = map[string]int{
+	phasePreparation: utils.ExitPreflight,
+	phaseStorage:     utils.ExitStorage,
+	phaseDirectories: utils.ExitFilesystem,
+	phaseServices:    utils.ExitFilesystem,
+}
+
+// setupFailure records a failure with the criticality of its phase
+func setupFailure(phase, operation string, err error, remediation ...string) *utils.ServctlError {
+	if _, critical := criticalPhases[phase]; critical {
+		return utils.NewCriticalError(phase, operation, err, remediation...)
+	}
+	return utils.NewWarningError(phase, operation, err, remediation...)
+}
+
+// setupResumeCommand is the command that runs the wizard again; every
+// phase skips or reuses what an earlier run already set up
+func setupResumeCommand(noSudo bool) string {
+	if noSudo {
+		return "servctl -start-setup -no-sudo" + yesFlag()
+	}
+	return "sudo servctl -start-setup" + yesFlag()
+}
+
+// yesFlag repeats -yes in suggested commands when this run used it
+func yesFlag() string {
+	if assumeYes {
+		return " -yes"
+	}
+	return ""
+}
+
+func runChecklistCommand() int {
+	owner, err := directory.GetOwnerInfo()
+	if err != nil {
+		fmt.Println(errorStyle.Render("Error: " + err.Error()))
+		return utils.ExitError
+	}
+	config, err := compose.LoadState(filepath.Join(owner.HomeDir, "infra"))
+	if err != nil {
+		fmt.Println(errorStyle.Render("Error: " + err.Error()))
+		return utils.ExitNotConfigured
+	}
+	return runChecklist(config)
+}
+
+// runChecklist walks through the first-boot checklist, saving progress in
+// the state file. Stopping before the end counts as cancelled.
+func runChecklist(config *compose.ServiceConfig) int {
+	fmt.Println()
+	fmt.Println(sectionStyle.Render("✅ First-Boot Checklist"))
+
+	if config.InfraRoot == "" {
+		if owner, err := directory.GetOwnerInfo(); err == nil {
+			config.InfraRoot = filepath.Join(owner.HomeDir, "infra")
+		}
+	}
+	scriptsDir := filepath.Join(config.InfraRoot, "scripts")
+	backupDest := maintenance.DefaultScriptConfig().BackupDest
+	if mConfig, err := maintenance.LoadConfig(config.InfraRoot); err == nil {
+		backupDest = mConfig.BackupDest
+	}
+
+	items := checklist.Items(config, scriptsDir, backupDest)
+	if config.Checklist == nil {
+		config.Checklist = make(map[string]time.Time)
+	}
+	finished := checklist.Run(bufio.NewReader(os.Stdin), items, config.Checklist, func() error {
+		return compose.SaveState(config, false)
+	})
+
+	fmt.Println()
+	if left := checklist.Remaining(items, config.Checklist); left == 0 {
+		fmt.Println(successStyle.Render("🎉 Checklist complete - your server is ready for everyday use."))
+	} else if finished {
+		fmt.Println(warningStyle.Render(fmt.Sprintf("%d item(s) skipped. Pick up again with: servctl -checklist", left)))
+	} else {
+		fmt.Println(descStyle.Render(fmt.Sprintf("%d item(s) left. Resume with: servctl -checklist", left)))
+	}
+	fmt.Println()
+	if !finished {
+		return utils.ExitCancelled
+	}
+	return utils.ExitOK
+}
+
+// statusWatchInterval is how often 'servctl -status -watch' refreshes
+const statusWatchInterval = 5 * time.Second
+
+// statusSources reads what -status looks at from the saved setup; config
+// and mConfig are nil before setup has run
+func statusSources() (opts status.Options, config *compose.ServiceConfig, mConfig *maintenance.ScriptConfig, infraRoot string) {
+	opts = status.Options{Paths: []string{"/", "/mnt/data", "/mnt/backup"}}
+	if owner, err := directory.GetOwnerInfo(); err == nil {
+		infraRoot = filepath.Join(owner.HomeDir, "infra")
+		if c, err := compose.LoadState(infraRoot); err == nil {
+			config = c
+			opts.DockerSocket = c.DockerSocket
+			opts.UPS = c.UPS
+			opts.Paths = []string{"/", c.DataRoot, c.FastRoot, "/mnt/backup"}
+		}
+		if m, err := maintenance.LoadConfig(infraRoot); err == nil {
+			mConfig = m
+			opts.Paths[len(opts.Paths)-1] = m.BackupDest
+		}
+	}
+	return opts, config, mConfig, infraRoot
+}
+
+func runStatusCommand(watch bool) int {
+	opts, config, mConfig, infraRoot := statusSources()
+	report := status.Collect(opts)
+	for {
+		if watch {
+			fmt.Print("\033[H\033[2J")
+		}
+		fmt.Println()
+		fmt.Println(sectionStyle.Render("📊 System Status"))
+		fmt.Print(tui.RenderStatus(report))
+
+		// Speed-tiered storage links
+		if config != nil && config.FastRoot != "" {
+			fmt.Println(titleStyle.Render("Storage Tiering:"))
+			links := directory.TierLinks(config.DataRoot, config.FastRoot, config.MountedPaths())
+			problems := directory.VerifyTierLinks(links)
+			for _, p := range problems {
+				fmt.Println(errorStyle.Render("  ✗ ") + p.Error())
+			}
+			if len(problems) == 0 {
+				fmt.Printf("  %s %d hot paths on %s\n", successStyle.Render("✓"), len(links), config.FastRoot)
+			}
+		}
+
+		// Each web interface answers on the port it was set up with
+		if config != nil && report.DockerError == "" {
+			fmt.Println(titleStyle.Render("Service Ports:"))
+			fmt.Println(portHealth(config))
+		}
+
+		// Remote access through the Cloudflare Tunnel
+		if config != nil && config.TunnelEnabled() && report.DockerError == "" {
+			fmt.Println(titleStyle.Render("Remote Access:"))
+			fmt.Println(tunnelHealth(report, config))
+		}
+
+		// Nextcloud answers every request with its maintenance page
+		if config != nil {
+			if state, _ := bootstrap.LoadMaintenance(infraRoot); state != nil {
+				fmt.Println(titleStyle.Render("Maintenance Mode:"))
+				fmt.Println(warningStyle.Render("  ⚠ ") + fmt.Sprintf("On since %s (%s); turn off with: servctl -maintenance-mode off",
+					state.Since.Format("2006-01-02 15:04"), state.Reason))
+			}
+			if state, _ := bootstrap.LoadDiskFull(infraRoot); state != nil {
+				fmt.Println(titleStyle.Render("Disk Emergency:"))
+				fmt.Println(errorStyle.Render("  ✗ ") + fmt.Sprintf("Since %s (%s); backups are held and Immich jobs paused until the disk is under %d%%",
+					state.Since.Format("2006-01-02 15:04"), state.Reason, maintenance.DiskEmergencyClearPercent))
+			}
+		}
+
+		// When the maintenance jobs run, in the server's local time
+		if mConfig != nil && len(mConfig.Schedule) > 0 {
+			fmt.Println(titleStyle.Render("Maintenance Schedule:"))
+			for _, e := range maintenance.Calendar(mConfig.Schedule) {
+				span := e.Start
+				if e.End != "" {
+					span += "-" + e.End
+				}
+				fmt.Printf("  %-11s  %-24s %s\n", span, e.When, descStyle.Render(e.Description))
+			}
+			if note := maintenance.DSTNote(time.Local); note != "" {
+				fmt.Println(descStyle.Render("  " + note))
+			}
+		}
+
+		// Setup steps that took much longer than usual
+		if config != nil {
+			if findings := timing.Abnormal(config.Timings); len(findings) > 0 {
+				fmt.Println(titleStyle.Render("Last Setup:"))
+				for _, finding := range findings {
+					fmt.Println(warningStyle.Render("  ⚠ ") + finding)
+				}
+			}
+		}
+
+		// Battery backup
+		if u := report.UPS; u != nil {
+			fmt.Println(titleStyle.Render("UPS:"))
+			switch {
+			case u.Error != "":
+				fmt.Println(errorStyle.Render("  ✗ ") + u.Error)
+			case u.LowBattery() || u.OnBattery():
+				fmt.Println(warningStyle.Render("  ⚠ ") + u.Summary())
+			default:
+				fmt.Println(successStyle.Render("  ✓ ") + u.Summary())
+			}
+		}
+		fmt.Println()
+
+		if !watch {
+			return utils.ExitOK
+		}
+		fmt.Println(descStyle.Render(fmt.Sprintf("Updated %s, refreshing every %s. Ctrl+C to stop.",
+			report.Time.Format("15:04:05"), statusWatchInterval)))
+
+		// SMART health checks are slow and need sudo; health is read once,
+		// only temperatures are re-read
+		time.Sleep(statusWatchInterval)
+		opts.SkipDrives = true
+		drives := report.Drives
+		report = status.Collect(opts)
+		report.Drives = status.RefreshTemperatures(drives)
+	}
+}
+
+// runStatusBadgeCommand writes the status badge into dir for a phone
+// widget, and has Nextcloud pick it up when dir is in someone's files
+func runStatusBadgeCommand(dir string, dryRun bool) int {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		fmt.Println(errorStyle.Render("Error: " + err.Error()))
+		return utils.ExitUsage
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		fmt.Println(errorStyle.Render("Error: " + dir + " is not a directory"))
+		return utils.ExitUsage
+	}
+
+	opts, config, _, _ := statusSources()
+	label, err := os.Hostname()
+	if err != nil {
+		label = "servctl"
+	}
+	badge := status.Collect(opts).Badge(label)
+	if err := status.WriteBadge(dir, badge, dryRun); err != nil {
+		fmt.Println(errorStyle.Render("Error: " + err.Error()))
+		return utils.ExitError
+	}
+
+	if config != nil {
+		if path, ok := bootstrap.NextcloudFilesPath(config, dir); ok {
+			if err := bootstrap.ScanNextcloudFiles(path, dryRun); err != nil {
+				fmt.Println(warningStyle.Render("  Warning: Nextcloud did not rescan " + path + ": " + err.Error()))
+			}
+		}
+	}
+
+	style := successStyle
+	switch badge.Color {
+	case status.BadgeYellow:
+		style = warningStyle
+	case status.BadgeRed:
+		style = errorStyle
+	}
+	if !dryRun {
+		fmt.Println(style.Render("● "+badge.Message) + descStyle.Render(" → "+filepath.Join(dir, status.BadgeSVGFile)))
+	}
+	for _, reason := range badge.Reasons {
+		fmt.Println(descStyle.Render("  " + reason))
+	}
+	return utils.ExitOK
+}
+
+// tunnelHealth describes the Cloudflare Tunnel from cloudflared's
+// healthcheck, which passes once the tunnel is connected to Cloudflare
+// portHealth checks that something answers on each configured web port; a
+// port changed in .env without restarting the stack shows up here
+func portHealth(config *compose.ServiceConfig) string {
+	var lines []string
+	for _, p := range config.ServicePorts() {
+		if p.Field == nil {
+			continue
+		}
+		if compose.PortListening(p.Port) {
+			lines = append(lines, successStyle.Render("  ✓ ")+fmt.Sprintf("%s on port %d", p.Service, p.Port))
+		} else {
+			lines = append(lines, errorStyle.Render("  ✗ ")+fmt.Sprintf("%s: nothing answers on port %d (after changing a port, run 'docker compose up -d' in the compose directory)", p.Service, p.Port))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func tunnelHealth(report status.Report, config *compose.ServiceConfig) string {
+	s, ok := report.Service(compose.TunnelService)
+	switch {
+	case !ok || s.State != "running":
+		return errorStyle.Render("  ✗ ") + "cloudflared is not running - remote access is down"
+	case s.Health == "unhealthy":
+		return errorStyle.Render("  ✗ ") + "cloudflared cannot connect to Cloudflare (check the token: docker logs cloudflared)"
+	case s.Health == "starting":
+		return warningStyle.Render("  ⏳ ") + "Tunnel connecting"
+	}
+	var names []string
+	for _, r := range compose.TunnelRoutes(config) {
+		names = append(names, r.Hostname)
+	}
+	return successStyle.Render("  ✓ ") + "Tunnel connected: " + strings.Join(names, ", ")
+}
+
+func runGetConfigCommand() int {
+	fmt.Println()
+	fmt.Println(sectionStyle.Render("⚙️  Current Configuration"))
+	fmt.Println()
+
+	currentUser, _ := user.Current()
+	homeDir := currentUser.HomeDir
+	composeDir := filepath.Join(homeDir, "infra", "compose")
+
+	// Read .env
+	envPath := filepath.Join(composeDir, ".env")
+	if content, err := os.ReadFile(envPath); err == nil {
+		fmt.Println(titleStyle.Render(".env Configuration:"))
+		fmt.Println()
+
+		// Mask passwords
+		lines := strings.Split(string(content), "\n")
+		for _, line := range lines {
+			if strings.Contains(strings.ToUpper(line), "PASSWORD") ||
+				strings.Contains(strings.ToUpper(line), "SECRET") ||
+				strings.Contains(strings.ToUpper(line), "TOKEN") {
+				parts := strings.SplitN(line, "=", 2)
+				if len(parts) == 2 {
+					fmt.Printf("  %s=%s\n", parts[0], strings.Repeat("*", len(parts[1])))
+				}
+			} else if strings.TrimSpace(line) != "" && !strings.HasPrefix(line, "#") {
+				fmt.Printf("  %s\n", line)
+			}
+		}
+		fmt.Println()
+	} else {
+		fmt.Println(warningStyle.Render("No .env file found at " + envPath))
+	}
+
+	// Check docker-compose.yml
+	composePath := filepath.Join(composeDir, "docker-compose.yml")
+	if _, err := os.Stat(composePath); err != nil {
+		fmt.Println(warningStyle.Render("No docker-compose.yml found"))
+		fmt.Println()
+		return utils.ExitNotConfigured
+	}
+	fmt.Println(successStyle.Render("✓ docker-compose.yml exists"))
+	fmt.Printf("  Path: %s\n", composePath)
+	fmt.Println()
+	return utils.ExitOK
+}
+
+func runAdviseCommand() int {
+	fmt.Println()
+	fmt.Println(sectionStyle.Render("🛒 Hardware Advisor"))
+	fmt.Println()
+
+	inv, err := advisor.Gather()
+	if err != nil {
+		fmt.Println(errorStyle.Render("✗ " + err.Error()))
+		return utils.ExitStorage
+	}
+
+	fmt.Println(titleStyle.Render("Inventory:"))
+	fmt.Printf("  CPU:     %s (%d threads)\n", inv.CPUModel, inv.Cores)
+	fmt.Printf("  Memory:  %s\n", storage.FormatBytes(inv.TotalRAM))
+	for _, d := range inv.Disks {
+		role := "data"
+		if d.IsOSDisk {
+			role = "OS"
+		} else if d.Removable {
+			role = "removable"
+		}
+		fmt.Printf("  Disk:    %-10s %-8s %-5s %s (%s)\n", d.Name, d.SizeHuman, d.Type, d.Model, role)
+	}
+	for _, n := range inv.NICs {
+		link := "no link"
+		if n.SpeedMbps > 0 {
+			link = fmt.Sprintf("%d Mb/s", n.SpeedMbps)
+		}
+		if n.Wireless {
+			link = "Wi-Fi"
+		}
+		fmt.Printf("  Network: %-10s %s\n", n.Name, link)
+	}
+	fmt.Printf("  Power:   %s\n", advisor.EstimatePower(inv, advisor.PowerOptions{}).Summary(0))
+	fmt.Println()
+
+	fmt.Println(titleStyle.Render("Advice:"))
+	for _, a := range advisor.Advise(inv) {
+		var line string
+		switch a.Level {
+		case advisor.LevelRecommend:
+			line = errorStyle.Render("  ● " + a.Topic + ": ")
+		case advisor.LevelConsider:
+			line = warningStyle.Render("  ● " + a.Topic + ": ")
+		default:
+			line = successStyle.Render("  ✓ " + a.Topic + ": ")
+		}
+		fmt.Println(line + a.Text)
+		if len(a.Unlocks) > 0 {
+			fmt.Println(descStyle.Render("      Unlocks: " + strings.Join(a.Unlocks, ", ")))
+		}
+	}
+	fmt.Println()
+	fmt.Println(descStyle.Render("Nothing was changed. Run 'servctl -start-setup' when ready."))
+	return utils.ExitOK
+}
+
+// runBurninCommand stress-tests a new machine before setup: one memtester
+// pass, the CPUs at full load with the temperature watched, then surface
+// scans of the data disks. It prints and saves a pass/fail report.
+func runBurninCommand(stress time.Duration, dryRun bool) int {
+	fmt.Println()
+	fmt.Println(sectionStyle.Render("🔥 Burn-in"))
+	fmt.Println()
+
+	if os.Geteuid() != 0 && !dryRun {
+		fmt.Println(errorStyle.Render("✗ Burn-in locks memory and reads the disks directly; run it as root: sudo servctl -burnin"))
+		return utils.ExitPreflight
+	}
+	if missing := burnin.MissingPackages(); len(missing) > 0 {
+		err := ops.Execute(dryRun, ops.Func{Description: "install " + strings.Join(missing, ", "), Fn: func() error {
+			fmt.Println(descStyle.Render("Installing " + strings.Join(missing, ", ") + "..."))
+			_, err := pkgmgr.Default().Install(missing, nil)
+			return err
+		}})
+		if err != nil {
+			fmt.Println(errorStyle.Render("✗ " + err.Error()))
+			return utils.ExitPreflight
+		}
+	}
+
+	disks, err := storage.DiscoverDisks()
+	if err != nil {
+		fmt.Println(warningStyle.Render("Warning: " + err.Error()))
+	}
+	disks = storage.FilterAvailableDisks(disks)
+	memSize := burnin.MemTestSize()
+
+	fmt.Println(titleStyle.Render("Plan:"))
+	fmt.Printf("  1. Memory: one memtester pass over %s\n", storage.FormatBytes(memSize))
+	fmt.Printf("  2. CPU:    %s at full load, stopped if it reaches %d°C\n", stress, burnin.CPUTempLimit)
+	fmt.Printf("  3. Disks:  a surface scan of %d data disk(s)\n", len(disks))
+	fmt.Println()
+
+	// Asked up front so the hours of testing need no one at the keyboard
+	reader := promptReader()
+	scanMode := ""
+	if len(disks) > 0 {
+		scanMode = chooseSurfaceScan(reader, disks, dryRun)
+		fmt.Println()
+	}
+
+	host, _ := os.Hostname()
+	report := burnin.Report{Host: host, Started: time.Now()}
+	lastWidth := 0
+	redraw := func(line string) {
+		fmt.Printf("\r%-*s", lastWidth, line)
+		lastWidth = len(line)
+	}
+
+	report.Results = append(report.Results, burnin.TestMemory(memSize, dryRun, func(done, total int, test string) {
+		redraw(fmt.Sprintf("  🧠 Memory: %d/%d tests passed (%s)", done, total, test))
+	}))
+	lastWidth = 0
+	fmt.Println()
+
+	cpu, maxTemp := burnin.StressCPU(stress, dryRun, func(elapsed time.Duration, tempC int) {
+		line := fmt.Sprintf("  🔥 CPU: %s of %s", elapsed.Round(time.Second), stress)
+		if tempC > 0 {
+			line += fmt.Sprintf(", %d°C", tempC)
+		}
+		redraw(line)
+	})
+	report.Results = append(report.Results, cpu)
+	report.MaxCPUTemp = maxTemp
+	fmt.Println()
+
+	if scanMode != "" {
+		report.Scans = scanDisks(disks, scanMode)
+		// SMART's verdict after the scan, which exercised every sector
+		if rescanned, err := storage.DiscoverDisks(); err == nil {
+			disks = storage.FilterAvailableDisks(rescanned)
+		}
+	}
+	report.Results = append(report.Results, burnin.DiskResult(disks, report.Scans))
+
+	fmt.Println()
+	fmt.Println(titleStyle.Render("Report:"))
+	for _, r := range report.Results {
+		switch {
+		case r.Skipped:
+			fmt.Println(descStyle.Render("  – " + r.Name + ": " + r.Detail))
+		case r.Passed:
+			fmt.Println(successStyle.Render("  ✓ "+r.Name+": ") + r.Detail)
+		default:
+			fmt.Println(errorStyle.Render("  ✗ "+r.Name+": ") + r.Detail)
+		}
+	}
+	fmt.Println()
+
+	reportPath := filepath.Join("infra", burnin.ReportFile)
+	if owner, err := directory.GetOwnerInfo(); err == nil {
+		reportPath = filepath.Join(owner.HomeDir, reportPath)
+	}
+	if err := burnin.WriteReport(reportPath, report, dryRun); err != nil {
+		fmt.Println(warningStyle.Render("Warning: " + err.Error()))
+	} else if !dryRun {
+		fmt.Println(descStyle.Render("Report saved to " + reportPath))
+	}
+
+	if !report.Passed() {
+		fmt.Println(errorStyle.Render("✗ FAIL: fix or return the failing hardware before putting data on it"))
+		return utils.ExitError
+	}
+	fmt.Println(successStyle.Render("✓ PASS: the hardware is ready for servctl -start-setup"))
+	return utils.ExitOK
+}
+
+func runGetArchitectureCommand() {
+	fmt.Println()
+	fmt.Println(sectionStyle.Render("🏗️  System Architecture"))
+	fmt.Println()
+
+	currentUser, _ := user.Current()
+	homeDir := currentUser.HomeDir
+
+	// Directory tree, as set up when servctl has run here
+	dataRoot := "/mnt/data"
+	var roots paths.Roots
+	if config, err := compose.LoadState(filepath.Join(homeDir, "infra")); err == nil && config.DataRoot != "" {
+		dataRoot, roots = config.DataRoot, config.ServiceRoots
+	}
+	fmt.Print(tui.RenderDirectoryTree(homeDir, dataRoot, roots))
+	fmt.Println()
+
+	// Service relationships
+	fmt.Println(titleStyle.Render("Service Relationships:"))
+	fmt.Println()
+
+	services := `
+  ┌─────────────────────────────────────────────────────────────┐
+  │                     servctl-network                         │
+  ├─────────────────────────────────────────────────────────────┤
+  │                                                             │
+  │  ┌─────────────┐    ┌─────────────┐    ┌─────────────┐     │
+  │  │   Immich    │───▶│    Redis    │    │  Nextcloud  │     │
+  │  │   :2283     │    │   (cache)   │    │   :8080     │     │
+  │  └──────┬──────┘    └─────────────┘    └──────┬──────┘     │
+  │         │                                      │            │
+  │         ▼                                      ▼            │
+  │  ┌─────────────┐                        ┌─────────────┐     │
+  │  │ PostgreSQL  │                        │  MariaDB    │     │
+  │  │  (Immich)   │                        │ (Nextcloud) │     │
+  │  └─────────────┘                        └─────────────┘     │
+  │                                                             │
+  │  ┌─────────────┐    ┌─────────────┐                        │
+  │  │   Glances   │    │    Diun     │                        │
+  │  │   :61208    │    │  (updates)  │                        │
+  │  └─────────────┘    └─────────────┘                        │
+  │                                                             │
+  └─────────────────────────────────────────────────────────────┘
+`
+	fmt.Println(services)
+}
+
+func runManualBackupCommand() int {
+	fmt.Println()
+	fmt.Println(sectionStyle.Render("💾 Manual Backup"))
+	fmt.Println()
+
+	currentUser, _ := user.Current()
+	homeDir := currentUser.HomeDir
+	scriptPath := filepath.Join(homeDir, "infra", "scripts", "daily_backup.sh")
+
+	if _, err := os.Stat(scriptPath); os.IsNotExist(err) {
+		fmt.Println(errorStyle.Render("Backup script not found: " + scriptPath))
+		fmt.Println(descStyle.Render("Run 'servctl -start-setup' first to generate maintenance scripts."))
+		return utils.ExitNotConfigured
+	}
+
+	fmt.Println("Running backup script...")
+	fmt.Println(descStyle.Render("Script: " + scriptPath))
+	fmt.Println()
+
+	return withMaintenance("backup", false, func() int {
+		// The script would otherwise wait for the lock this run holds; sudo
+		// resets the environment, so pass the marker explicitly
+		cmd := exec.Command("sudo", "env", runlock.HeldEnv+"=1", "bash", scriptPath)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+
+		if err := cmd.Run(); err != nil {
+			fmt.Println()
+			fmt.Println(errorStyle.Render("Backup failed: " + err.Error()))
+			return utils.ExitBackup
+		}
+		fmt.Println()
+		fmt.Println(successStyle.Render("✅ Backup completed successfully!"))
+		return utils.ExitOK
+	})
+}
+
+func runBackupPruneCommand(dryRun bool) int {
+	fmt.Println()
+	fmt.Println(sectionStyle.Render("🗂  Backup Retention"))
+	fmt.Println()
+
+	currentUser, _ := user.Current()
+	infraRoot := filepath.Join(currentUser.HomeDir, "infra")
+
+	mConfig, err := maintenance.LoadConfig(infraRoot)
+	if err != nil {
+		fmt.Println(errorStyle.Render("Error: " + err.Error()))
+		return utils.ExitNotConfigured
+	}
+
+	plan, err := maintenance.PlanPrune(mConfig.BackupDest, mConfig.Retention)
+	if err != nil {
+		fmt.Println(errorStyle.Render("Error: " + err.Error()))
+		return utils.ExitBackup
+	}
+
+	fmt.Printf("  Policy:   %s\n", mConfig.Retention)
+	fmt.Printf("  Location: %s\n", maintenance.SnapshotsPath(mConfig.BackupDest))
+	fmt.Println()
+	for _, snap := range plan.Keep {
+		fmt.Println(successStyle.Render("  keep   ") + snap.Name)
+	}
+	for _, snap := range plan.Prune {
+		fmt.Println(warningStyle.Render("  delete ") + snap.Name)
+	}
+	fmt.Println()
+
+	if len(plan.Prune) == 0 {
+		fmt.Println(successStyle.Render("✓ Nothing to prune"))
+		return utils.ExitOK
+	}
+
+	fmt.Printf("  %d of %d sets would be deleted, reclaiming %s\n",
+		len(plan.Prune), len(plan.Keep)+len(plan.Prune), storage.FormatBytes(plan.ReclaimBytes))
+
+	if dryRun {
+		fmt.Println(warningStyle.Render("DRY RUN complete. No backup sets were deleted."))
+		return utils.ExitOK
+	}
+	if !promptContinue("Delete these backup sets?") {
+		fmt.Println("Prune cancelled.")
+		return utils.ExitCancelled
+	}
+
+	if err := maintenance.ApplyPrune(plan, dryRun); err != nil {
+		fmt.Println(errorStyle.Render("Error: " + err.Error()))
+		return utils.ExitBackup
+	}
+	fmt.Println(successStyle.Render(fmt.Sprintf("✅ Deleted %d backup sets", len(plan.Prune))))
+	return utils.ExitOK
+}
+
+func runLogsCommand() int {
+	fmt.Println()
+	fmt.Println(sectionStyle.Render("📋 Service Logs"))
+	fmt.Println()
+
+	currentUser, _ := user.Current()
+	homeDir := currentUser.HomeDir
+	composeDir := filepath.Join(homeDir, "infra", "compose")
+
+	// Check if docker-compose.yml exists
+	if _, err := os.Stat(filepath.Join(composeDir, "docker-compose.yml")); os.IsNotExist(err) {
+		fmt.Println(warningStyle.Render("No docker-compose.yml found"))
+		fmt.Println(descStyle.Render("Run 'servctl -start-setup' first."))
+		return utils.ExitNotConfigured
+	}
+
+	fmt.Println("Showing last 50 lines (Ctrl+C to exit)...")
+	fmt.Println()
+
+	cmd := exec.Command("docker", "compose", "-f",
+		filepath.Join(composeDir, "docker-compose.yml"),
+		"logs", "--tail=50", "-f")
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	// Run interactively
+	if err := cmd.Run(); err != nil {
+		return utils.ExitDocker
+	}
+	return utils.ExitOK
+}
+
+func runNetworkRefreshCommand(dryRun bool) int {
+	fmt.Println()
+	fmt.Println(sectionStyle.Render("🌐 Network Refresh"))
+	fmt.Println()
+
+	currentUser, _ := user.Current()
+	infraRoot := filepath.Join(currentUser.HomeDir, "infra")
+	composeDir := filepath.Join(infraRoot, "compose")
+
+	config, err := compose.LoadState(infraRoot)
+	if err != nil {
+		fmt.Println(errorStyle.Render("Error: " + err.Error()))
+		return utils.ExitNotConfigured
+	}
+
+	newIP, err := compose.DetectHostIP()
+	if err != nil {
+		fmt.Println(errorStyle.Render("Could not detect host IP: " + err.Error()))
+		return utils.ExitNetwork
+	}
+	if err := compose.ValidateIP(newIP); err != nil {
+		fmt.Println(errorStyle.Render("Detected IP is not usable: " + err.Error()))
+		return utils.ExitNetwork
+	}
+
+	if newIP == config.HostIP {
+		fmt.Println(successStyle.Render("✓ Host IP unchanged: ") + newIP)
+		return utils.ExitOK
+	}
+
+	fmt.Printf("  Host IP changed: %s → %s\n", config.HostIP, successStyle.Render(newIP))
+	if !promptContinue("Update configuration and restart services?") {
+		fmt.Println("Network refresh cancelled.")
+		return utils.ExitCancelled
+	}
+	fmt.Println()
+
+	oldIP := config.HostIP
+	code := utils.ExitOK
+	for _, r := range bootstrap.RefreshNetwork(config, composeDir, newIP, dryRun) {
+		if r.Success {
+			fmt.Println(successStyle.Render("  ✓ "+r.Name+": ") + r.Message)
+		} else {
+			fmt.Println(errorStyle.Render("  ✗ "+r.Name+": ") + r.Message)
+			code = utils.ExitDocker
+		}
+	}
+	if config.PortForward != "" {
+		// The router's forward points at the old address, and UPnP routers
+		// refuse a second one for the same port
+		exposure.RemoveForward(config.PortForward, dryRun)
+		if err := exposure.InstallRenewal(config.PortForward, newIP, dryRun); err != nil {
+			fmt.Println(errorStyle.Render("  ✗ Port forward: ") + err.Error())
+			code = utils.ExitNetwork
+		} else {
+			fmt.Println(successStyle.Render("  ✓ Port forward: ") + "port " + fmt.Sprint(exposure.ForwardPort) + " now forwarded to " + newIP)
+		}
+	}
+	commitInfra("Network refresh: host IP is now "+newIP, dryRun)
+	emit(hooks.Event{Event: hooks.NetworkChanged, Status: exitStatus(code),
+		Details: map[string]string{"old_ip": oldIP, "new_ip": newIP}})
+	fmt.Println()
+
+	missionReport := report.NewMissionReport(config, infraRoot)
+	if dryRun {
+		fmt.Print(report.RenderCompactReport(missionReport))
+	} else {
+		fmt.Print(report.RenderMissionReport(missionReport))
+	}
+	return code
+}
+
+func runPermissionsCommand(action string, dryRun bool) int {
+	fmt.Println()
+	fmt.Println(sectionStyle.Render("🔐 Directory Permissions"))
+	fmt.Println()
+
+	if action != "check" && action != "fix" {
+		fmt.Println(errorStyle.Render("Unknown action " + action + ": use -permissions check or -permissions fix"))
+		return utils.ExitUsage
+	}
+
+	// Under sudo, look up the invoking user's tree rather than root's
+	owner, err := directory.GetOwnerInfo()
+	if err != nil {
+		fmt.Println(errorStyle.Render("Error: " + err.Error()))
+		return utils.ExitError
+	}
+	infraRoot := filepath.Join(owner.HomeDir, "infra")
+
+	config, err := compose.LoadState(infraRoot)
+	if err != nil {
+		fmt.Println(errorStyle.Render("Error: " + err.Error()))
+		return utils.ExitNotConfigured
+	}
+	owner.UID, owner.GID = config.PUID, config.PGID
+	directory.Rootless = config.Rootless
+	directory.ServiceRoots = config.ServiceRoots
+
+	// Check every known directory; ones never created are just counted
+	sel := directory.DefaultServiceSelection()
+	sel.Media, sel.Downloads, sel.Books = true, true, true
+	specs := directory.DedupSpecs(append(
+		directory.GetDirectoriesForServices(sel, owner.HomeDir, config.DataRoot),
+		append(directory.GetAllDirectories(owner.HomeDir, config.DataRoot),
+			directory.GetPathDirectories(config.DataRoot, config.MountedPaths())...)...))
+	drift := directory.CheckDrift(specs, owner)
+
+	for _, d := range drift.Drifts {
+		var issues []string
+		if d.ModeDrift() {
+			issues = append(issues, fmt.Sprintf("mode %o → %o", d.Mode, d.Spec.Mode))
+		}
+		if d.OwnerDrift() {
+			issues = append(issues, fmt.Sprintf("owner %d:%d → %d:%d", d.UID, d.GID, d.Want.UID, d.Want.GID))
+		}
+		fmt.Println(warningStyle.Render("  ✗ ") + d.Spec.Path + descStyle.Render("  "+strings.Join(issues, ", ")))
+	}
+	if len(drift.Drifts) > 0 {
+		fmt.Println()
+	}
+	fmt.Printf("  %d directories checked, %d drifted, %d not present\n",
+		drift.Checked, len(drift.Drifts), len(drift.Missing))
+	fmt.Println()
+
+	if len(drift.Drifts) == 0 {
+		fmt.Println(successStyle.Render("✓ All directories match the permission matrix"))
+		return utils.ExitOK
+	}
+	if action == "check" {
+		fmt.Println(descStyle.Render("Run 'servctl -permissions fix' to repair."))
+		return utils.ExitFilesystem
+	}
+
+	stats := directory.FixDrift(drift.Drifts, dryRun)
+	if dryRun {
+		fmt.Println(warningStyle.Render(fmt.Sprintf("DRY RUN complete. Would fix %d modes and %d owners.",
+			stats.ModeChanged, stats.OwnerChanged)))
+		return utils.ExitOK
+	}
+	if stats.Failed > 0 {
+		fmt.Println(errorStyle.Render(fmt.Sprintf("%d directories could not be fixed, first: %v", stats.Failed, stats.FirstError)))
+		fmt.Println(descStyle.Render("Changing owners usually needs sudo: sudo servctl -permissions fix"))
+		return utils.ExitFilesystem
+	}
+	fmt.Println(successStyle.Render(fmt.Sprintf("✅ Fixed %d modes and %d owners", stats.ModeChanged, stats.OwnerChanged)))
+	return utils.ExitOK
+}
+
+// initTrash routes overwrites and deletions under ~/infra and the data root
+// through the trash
+func initTrash() {
+	owner, err := directory.GetOwnerInfo()
+	if err != nil {
+		return
+	}
+	infraRoot := filepath.Join(owner.HomeDir, "infra")
+	trash.Roots = []string{infraRoot}
+	if config, err := compose.LoadState(infraRoot); err == nil && config.DataRoot != "" {
+		trash.Roots = append(trash.Roots, config.DataRoot)
+	}
+}
+
+func runTrashCommand(action, id string, dryRun bool) int {
+	fmt.Println()
+	fmt.Println(sectionStyle.Render("🗑️  Trash"))
+	fmt.Println()
+
+	entries, err := trash.ListAll()
+	if err != nil {
+		fmt.Println(errorStyle.Render("Error: " + err.Error()))
+		return utils.ExitFilesystem
+	}
+
+	switch action {
+	case "list":
+		if len(entries) == 0 {
+			fmt.Println(descStyle.Render("  Trash is empty"))
+			fmt.Println()
+			return utils.ExitOK
+		}
+		now := time.Now()
+		for _, e := range entries {
+			expires := e.TrashedAt.Add(trash.Retention)
+			fmt.Printf("  %s\n", cmdStyle.Render(e.ID))
+			fmt.Printf("    %s %s\n", e.Original, descStyle.Render(fmt.Sprintf("(%s, trashed %s, purged in %d days)",
+				storage.FormatBytes(uint64(e.Size)), e.TrashedAt.Format("2006-01-02 15:04"),
+				int(expires.Sub(now).Hours()/24))))
+		}
+		fmt.Println()
+		fmt.Println(descStyle.Render("Restore with: servctl -trash restore ID"))
+
+	case "restore":
+		if id == "" {
+			fmt.Println(errorStyle.Render("Usage: servctl -trash restore ID (see servctl -trash list)"))
+			return utils.ExitUsage
+		}
+		entry, err := trash.Find(id)
+		if err != nil {
+			fmt.Println(errorStyle.Render("Error: " + err.Error()))
+			return utils.ExitUsage
+		}
+		restore := ops.Func{Description: "restore " + entry.Original, Fn: func() error {
+			if config, err := compose.LoadState(trash.Roots[0]); err == nil && entry.Root == config.DataRoot {
+				snapshotBeforeRisky(config, "trash restore", false)
+			}
+			if err := trash.Restore(entry); err != nil {
+				return err
+			}
+			fmt.Println(successStyle.Render("✅ Restored " + entry.Original))
+			fmt.Println(descStyle.Render("The version it replaced is now in the trash."))
+			return nil
+		}}
+		if err := ops.Execute(dryRun, restore); err != nil {
+			fmt.Println(errorStyle.Render("Error: " + err.Error()))
+			return utils.ExitFilesystem
+		}
+		commitInfra("Restore "+entry.Original+" from the trash", dryRun)
+
+	case "empty":
+		if len(entries) == 0 {
+			fmt.Println(descStyle.Render("  Trash is already empty"))
+			return utils.ExitOK
+		}
+		if !dryRun && !promptContinue(fmt.Sprintf("Permanently delete %d trash entries?", len(entries))) {
+			return utils.ExitCancelled
+		}
+		empty := ops.Func{Description: fmt.Sprintf("permanently delete %d trash entries", len(entries)), Fn: func() error {
+			for _, e := range entries {
+				if err := trash.Delete(e); err != nil {
+					return err
+				}
+			}
+			fmt.Println(successStyle.Render(fmt.Sprintf("✅ Deleted %d trash entries", len(entries))))
+			return nil
+		}}
+		if err := ops.Execute(dryRun, empty); err != nil {
+			fmt.Println(errorStyle.Render("Error: " + err.Error()))
+			return utils.ExitFilesystem
+		}
+
+	default:
+		fmt.Println(errorStyle.Render("Unknown action " + action + ": use -trash list, -trash restore ID or -trash empty"))
+		return utils.ExitUsage
+	}
+	return utils.ExitOK
+}
+
+// snapshotBeforeRisky takes read-only snapshots of the data root and of
+// Docker's named volumes before a change that is hard to undo, when they
+// live on Btrfs or ZFS, and registers them in the state file for
+// -snapshot rollback
+func snapshotBeforeRisky(config *compose.ServiceConfig, reason string, dryRun bool) {
+	if config.Rootless {
+		return
+	}
+
+	var taken []storage.Snapshot
+	at := time.Now()
+	if storage.SnapshotFS(config.DataRoot) != "" {
+		snap, result := storage.TakeSnapshot(config.DataRoot, reason, dryRun)
+		if result.Success {
+			// A dry run has printed the snapshot command instead
+			if result.Message != "" {
+				fmt.Println(successStyle.Render("  ✓ ") + result.Message)
+			}
+			taken = append(taken, snap)
+			at = snap.CreatedAt
+		} else {
+			fmt.Println(warningStyle.Render("  ⚠ Snapshot skipped: ") + result.Message)
+		}
+	}
+
+	// Named volumes (e.g. Diun's database) live under Docker's data
+	// directory, usually on the OS disk rather than the data root
+	if root := bootstrap.DockerRootDir(); root != "" {
+		volumes := filepath.Join(root, "volumes")
+		if !isUnder(volumes, config.DataRoot) && storage.SnapshotFS(volumes) != "" {
+			snap, result := storage.TakeVolumeSnapshot(volumes, reason, at, dryRun)
+			if result.Success {
+				if result.Message != "" {
+					fmt.Println(successStyle.Render("  ✓ ") + result.Message)
+				}
+				taken = append(taken, snap)
+			} else {
+				fmt.Println(warningStyle.Render("  ⚠ Volume snapshot skipped: ") + result.Message)
+			}
+		}
+	}
+	if dryRun || len(taken) == 0 {
+		return
+	}
+
+	var results []storage.OperationResult
+	config.Snapshots, results = storage.PruneSnapshots(append(taken, config.Snapshots...), storage.SnapshotKeep, false)
+	for _, r := range results {
+		if !r.Success {
+			fmt.Println(warningStyle.Render("  ⚠ Old snapshot not deleted: ") + r.Message)
+		}
+	}
+	if err := compose.SaveState(config, false); err != nil {
+		fmt.Println(warningStyle.Render("  Warning: " + err.Error()))
+	}
+}
+
+// isUnder reports whether path is root or inside it
+func isUnder(path, root string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, "../")
+}
+
+func runSnapshotCommand(action string, dryRun bool) int {
+	fmt.Println()
+	fmt.Println(sectionStyle.Render("📸 Data Snapshots"))
+	fmt.Println()
+
+	if action != "list" && action != "rollback" {
+		fmt.Println(errorStyle.Render("Unknown action " + action + ": use -snapshot list or -snapshot rollback"))
+		return utils.ExitUsage
+	}
+
+	// Under sudo, use the invoking user's state rather than root's
+	owner, err := directory.GetOwnerInfo()
+	if err != nil {
+		fmt.Println(errorStyle.Render("Error: " + err.Error()))
+		return utils.ExitError
+	}
+	infraRoot := filepath.Join(owner.HomeDir, "infra")
+	config, err := compose.LoadState(infraRoot)
+	if err != nil {
+		fmt.Println(errorStyle.Render("Error: " + err.Error()))
+		return utils.ExitNotConfigured
+	}
+
+	if len(config.Snapshots) == 0 {
+		if storage.SnapshotFS(config.DataRoot) == "" {
+			fmt.Println(descStyle.Render("  " + config.DataRoot + " is not on Btrfs or ZFS, so no data snapshots are taken."))
+		} else {
+			fmt.Println(descStyle.Render("  No snapshots yet. One is taken before each container upgrade."))
+		}
+		fmt.Println()
+		return utils.ExitOK
+	}
+
+	if action == "list" {
+		for _, snap := range config.Snapshots {
+			fmt.Printf("  %s  %s\n", cmdStyle.Render(snap.Name), descStyle.Render(fmt.Sprintf("before %s, %s",
+				snap.Reason, snap.CreatedAt.Format("2006-01-02 15:04"))))
+			fmt.Printf("    %s\n", snap.Path)
+		}
+		fmt.Println()
+		fmt.Println(descStyle.Render("Revert the newest with: sudo servctl -snapshot rollback"))
+		return utils.ExitOK
+	}
+
+	set := storage.NewestSnapshots(config.Snapshots)
+	snap := set[0]
+	fmt.Printf("  Newest snapshot: %s (before %s, %s)\n", snap.Name, snap.Reason, snap.CreatedAt.Format("2006-01-02 15:04"))
+	for _, s := range set {
+		fmt.Println(warningStyle.Render("  Every change to " + s.Target() + " since then will be lost."))
+	}
+	if !dryRun && !promptContinue("Stop services and roll back?") {
+		fmt.Println("Rollback cancelled.")
+		return utils.ExitCancelled
+	}
+	fmt.Println()
+
+	composeDir := filepath.Join(infraRoot, "compose")
+	stop := bootstrap.StopServices(composeDir, dryRun)
+	if !stop.Success {
+		fmt.Println(errorStyle.Render("  ✗ " + stop.Message))
+		return utils.ExitDocker
+	}
+	fmt.Println(successStyle.Render("  ✓ ") + stop.Message)
+
+	code := utils.ExitOK
+	for _, s := range set {
+		result := storage.RollbackSnapshot(s, dryRun)
+		switch {
+		case result.Success && result.Message != "":
+			fmt.Println(successStyle.Render("  ✓ ") + result.Message)
+		case !result.Success:
+			fmt.Println(errorStyle.Render("  ✗ ") + result.Message)
+			code = utils.ExitStorage
+		}
+	}
+
+	// Services come back either way; check the data before relying on it
+	// after a failed rollback
+	if r := bootstrap.StartServices(composeDir, dryRun); r.Success {
+		fmt.Println(successStyle.Render("  ✓ ") + r.Message)
+	} else {
+		fmt.Println(errorStyle.Render("  ✗ ") + r.Message)
+		if code == utils.ExitOK {
+			code = utils.ExitDocker
+		}
+	}
+	emit(hooks.Event{Event: hooks.SnapshotRolledBack, Status: exitStatus(code), Message: snap.Name})
+	return code
+}
+
+func runMaintenanceModeCommand(action string, dryRun bool) int {
+	fmt.Println()
+	fmt.Println(sectionStyle.Render("🚧 Maintenance Mode"))
+	fmt.Println()
+
+	if action != "on" && action != "off" {
+		fmt.Println(errorStyle.Render("Unknown action " + action + ": use -maintenance-mode on or -maintenance-mode off"))
+		return utils.ExitUsage
+	}
+
+	// Under sudo, use the invoking user's state rather than root's
+	owner, err := directory.GetOwnerInfo()
+	if err != nil {
+		fmt.Println(errorStyle.Render("Error: " + err.Error()))
+		return utils.ExitError
+	}
+	infraRoot := filepath.Join(owner.HomeDir, "infra")
+	config, err := compose.LoadState(infraRoot)
+	if err != nil {
+		fmt.Println(errorStyle.Render("Error: " + err.Error()))
+		return utils.ExitNotConfigured
+	}
+
+	if action == "on" {
+		if state, _ := bootstrap.LoadMaintenance(infraRoot); state != nil {
+			fmt.Println(descStyle.Render(fmt.Sprintf("  Already on since %s (%s)", state.Since.Format("2006-01-02 15:04"), state.Reason)))
+		}
+		if err := bootstrap.EnableMaintenance(config, infraRoot, "manual", dryRun); err != nil {
+			fmt.Println(errorStyle.Render("  ✗ " + err.Error()))
+			return utils.ExitDocker
+		}
+		fmt.Println(successStyle.Render("  ✓ Nextcloud shows its maintenance page; Immich background jobs are paused"))
+		fmt.Println(descStyle.Render("  Immich still serves photos and accepts uploads. Turn off with: servctl -maintenance-mode off"))
+		return utils.ExitOK
+	}
+
+	if err := bootstrap.DisableMaintenance(config, infraRoot, dryRun); err != nil {
+		fmt.Println(errorStyle.Render("  ✗ " + err.Error()))
+		return utils.ExitDocker
+	}
+	fmt.Println(successStyle.Render("  ✓ Nextcloud is back and Immich jobs are running again"))
+	return utils.ExitOK
+}
+
+// runDiskEmergencyCommand pauses Immich's writers while disk_alert.sh
+// reports a mount over the emergency threshold, and resumes them after
+func runDiskEmergencyCommand(action string, dryRun bool) int {
+	fmt.Println()
+	fmt.Println(sectionStyle.Render("🚨 Disk Emergency"))
+	fmt.Println()
+
+	if action != "on" && action != "off" {
+		fmt.Println(errorStyle.Render("Unknown action " + action + ": use -disk-emergency on or -disk-emergency off"))
+		return utils.ExitUsage
+	}
+
+	owner, err := directory.GetOwnerInfo()
+	if err != nil {
+		fmt.Println(errorStyle.Render("Error: " + err.Error()))
+		return utils.ExitError
+	}
+	infraRoot := filepath.Join(owner.HomeDir, "infra")
+	config, err := compose.LoadState(infraRoot)
+	if err != nil {
+		fmt.Println(errorStyle.Render("Error: " + err.Error()))
+		return utils.ExitNotConfigured
+	}
+
+	if action == "on" {
+		reason := "disk full"
+		if data, err := os.ReadFile(filepath.Join(infraRoot, maintenance.DiskEmergencyFile)); err == nil {
+			reason = "disk full: " + strings.Join(strings.Fields(string(data)), ", ")
+		}
+		paused, err := bootstrap.PauseForDiskFull(config, infraRoot, reason, dryRun)
+		if len(paused) > 0 {
+			fmt.Println(successStyle.Render("  ✓ Paused Immich jobs: " + strings.Join(paused, ", ")))
+		}
+		emit(hooks.Event{Event: hooks.DiskEmergency, Critical: true, Message: reason})
+		if err != nil {
+			fmt.Println(errorStyle.Render("  ✗ " + err.Error()))
+			return utils.ExitDocker
+		}
+		fmt.Println(descStyle.Render("  Backups are held until the disk is under " + strconv.Itoa(maintenance.DiskEmergencyClearPercent) + "%. Resume early with: servctl -disk-emergency off"))
+		return utils.ExitOK
+	}
+
+	resumed, err := bootstrap.ResumeAfterDiskFull(config, infraRoot, dryRun)
+	if len(resumed) > 0 {
+		fmt.Println(successStyle.Render("  ✓ Resumed Immich jobs: " + strings.Join(resumed, ", ")))
+	}
+	if err != nil {
+		fmt.Println(errorStyle.Render("  ✗ " + err.Error()))
+		return utils.ExitDocker
+	}
+	if !dryRun && len(resumed) == 0 {
+		fmt.Println(descStyle.Render("  No Immich jobs were paused for a full disk"))
+	}
+	return utils.ExitOK
+}
+
+// upgradeDatabases dumps and reloads the databases whose image in the
+// compose file is another release series than their files, after
+// asking. Declining, or files whose version cannot be read, return an
+// error, so the stack is not started on files its databases cannot open.
+func upgradeDatabases(config *compose.ServiceConfig, composeFile string, dryRun bool) error {
+	changes, err := bootstrap.PlanDatabaseUpgrades(config, composeFile)
+	if err != nil {
+		return fmt.Errorf("cannot tell which version wrote the database files, so the services were not started: %w", err)
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+
+	fmt.Println(titleStyle.Render("  Database upgrades:"))
+	for _, c := range changes {
+		fmt.Println(descStyle.Render("    • " + c.String()))
+	}
+	if !dryRun && !promptContinue("Stop the apps, dump these databases and upgrade them?") {
+		return fmt.Errorf("declined; the new images cannot open the old files, so the services were not started")
+	}
+	for _, c := range changes {
+		r := bootstrap.UpgradeDatabase(c, composeFile, dryRun)
+		if !r.Success {
+			return r.Error
+		}
+		fmt.Println(successStyle.Render("  ✓ "+r.Name+": ") + r.Message)
+	}
+	return nil
+}
+
+// withMaintenance runs fn with the stack in maintenance mode, unless it is
+// already on: then whoever turned it on also turns it off. Failing to
+// enable it is reported but does not stop fn.
+func withMaintenance(reason string, dryRun bool, fn func() int) int {
+	owner, err := directory.GetOwnerInfo()
+	if err != nil {
+		return fn()
+	}
+	infraRoot := filepath.Join(owner.HomeDir, "infra")
+	config, err := compose.LoadState(infraRoot)
+	if err != nil {
+		return fn()
+	}
+	if state, _ := bootstrap.LoadMaintenance(infraRoot); state != nil {
+		return fn()
+	}
+
+	if err := bootstrap.EnableMaintenance(config, infraRoot, reason, dryRun); err != nil {
+		fmt.Println(warningStyle.Render("  Warning: maintenance mode: " + err.Error()))
+	} else {
+		fmt.Println(descStyle.Render("  Maintenance mode on for the " + reason))
+	}
+	code := fn()
+	if err := bootstrap.DisableMaintenance(config, infraRoot, dryRun); err != nil {
+		fmt.Println(warningStyle.Render("  Warning: maintenance mode: " + err.Error()))
+		fmt.Println(descStyle.Render("  Retry with: servctl -maintenance-mode off"))
+	}
+	return code
+}
+
+// withRunLock runs fn holding the run lock, so it cannot interleave with
+// another servctl command or a maintenance script changing the same
+// files and containers. While someone else holds it, the holder is shown
+// and fn waits. Dry runs and read-only actions (readOnly) skip the lock, as
+// does the first setup, before ~/infra exists.
+func withRunLock(command string, readOnly bool, fn func() int) int {
+	if readOnly {
+		return fn()
+	}
+	owner, err := directory.GetOwnerInfo()
+	if err != nil {
+		return fn()
+	}
+	infraRoot := filepath.Join(owner.HomeDir, "infra")
+	if _, err := os.Stat(infraRoot); err != nil {
+		return fn()
+	}
+
+	lock, err := runlock.Acquire(infraRoot, "servctl "+command, func(h runlock.Holder) {
+		fmt.Println(warningStyle.Render("⏳ Waiting for " + h.String()))
+	})
+	if err != nil {
+		fmt.Println(warningStyle.Render("  Warning: run lock: " + err.Error()))
+		return fn()
+	}
+	defer lock.Release()
+	return fn()
+}
+
+func runMigrateConfigCommand(dryRun bool) int {
+	fmt.Println()
+	fmt.Println(sectionStyle.Render("🔄 Configuration Migration"))
+	fmt.Println()
+
+	// Under sudo, migrate the invoking user's files rather than root's
+	owner, err := directory.GetOwnerInfo()
+	if err != nil {
+		fmt.Println(errorStyle.Render("Error: " + err.Error()))
+		return utils.ExitError
+	}
+	infraRoot := filepath.Join(owner.HomeDir, "infra")
+
+	plans, err := compose.PlanMigrations(infraRoot)
+	if err != nil {
+		fmt.Println(errorStyle.Render("Error: " + err.Error()))
+		return utils.ExitFilesystem
+	}
+	if len(plans) == 0 {
+		fmt.Println(successStyle.Render(fmt.Sprintf("  ✓ Configuration is up to date (schema v%d)", compose.SchemaVersion)))
+		fmt.Println()
+		return utils.ExitOK
+	}
+
+	for _, plan := range plans {
+		fmt.Println(titleStyle.Render("  " + plan.Path))
+		for _, step := range plan.Steps {
+			fmt.Println(descStyle.Render("    • " + step))
+		}
+		removed, added := plan.ChangedLines()
+		for _, line := range removed {
+			fmt.Println(errorStyle.Render("    - " + line))
+		}
+		for _, line := range added {
+			fmt.Println(successStyle.Render("    + " + line))
+		}
+		fmt.Println()
+	}
+
+	if !dryRun && !promptContinue("Apply these changes?") {
+		return utils.ExitCancelled
+	}
+	code := utils.ExitOK
+	for _, plan := range plans {
+		if err := compose.ApplyMigration(plan, dryRun); err != nil {
+			fmt.Println(errorStyle.Render("  ✗ " + plan.Path + ": " + err.Error()))
+			code = utils.ExitFilesystem
+			continue
+		}
+		if !dryRun {
+			fmt.Println(successStyle.Render("  ✓ Upgraded " + plan.Path))
+		}
+	}
+	if !dryRun {
+		fmt.Println(descStyle.Render("  Previous versions are in the trash ('servctl -trash list')."))
+	}
+	commitInfra(fmt.Sprintf("Migrate configuration to schema v%d", compose.SchemaVersion), dryRun)
+	emit(hooks.Event{Event: hooks.UpgradeApplied, Status: exitStatus(code),
+		Message: fmt.Sprintf("schema v%d", compose.SchemaVersion)})
+	fmt.Println()
+	return code
+}
+
+func runValidateConfigCommand(dryRun bool) int {
+	fmt.Println()
+	fmt.Println(sectionStyle.Render("🔎 Validate .env"))
+	fmt.Println()
+
+	owner, err := directory.GetOwnerInfo()
+	if err != nil {
+		fmt.Println(errorStyle.Render("Error: " + err.Error()))
+		return utils.ExitError
+	}
+	infraRoot := filepath.Join(owner.HomeDir, "infra")
+	composeDir := filepath.Join(infraRoot, "compose")
+
+	config, err := compose.LoadState(infraRoot)
+	if err != nil {
+		fmt.Println(errorStyle.Render("Error: " + err.Error()))
+		return utils.ExitNotConfigured
+	}
+	envPath := filepath.Join(composeDir, ".env")
+	data, err := os.ReadFile(envPath)
+	if err != nil {
+		fmt.Println(errorStyle.Render("Error: " + err.Error()))
+		return utils.ExitNotConfigured
+	}
+
+	env, issues := compose.ParseEnv(string(data))
+	issues = append(issues, compose.CheckEnv(env, config)...)
+	slices.SortStableFunc(issues, func(a, b compose.EnvIssue) int { return a.Line - b.Line })
+	for _, issue := range issues {
+		if issue.Warning {
+			fmt.Println(warningStyle.Render("  ⚠ " + issue.String()))
+		} else {
+			fmt.Println(errorStyle.Render("  ✗ " + issue.String()))
+		}
+	}
+	if compose.HasEnvErrors(issues) {
+		fmt.Println()
+		fmt.Println(descStyle.Render("  Fix " + envPath + " and run 'servctl -validate-config' again."))
+		return utils.ExitInvalidConfig
+	}
+
+	changes, applied, err := compose.DiffEnv(config, env)
+	if err != nil {
+		fmt.Println(errorStyle.Render("Error: " + err.Error()))
+		return utils.ExitError
+	}
+	if len(changes) == 0 {
+		fmt.Println(successStyle.Render("  ✓ " + envPath + " matches the saved configuration"))
+		fmt.Println()
+		return utils.ExitOK
+	}
+	if len(issues) > 0 {
+		fmt.Println()
+	}
+
+	for _, c := range changes {
+		if c.Secret {
+			fmt.Println(titleStyle.Render("  "+c.Key) + " changed")
+		} else {
+			fmt.Println(titleStyle.Render("  "+c.Key) + fmt.Sprintf(" %s → %s", c.Old, successStyle.Render(c.New)))
+		}
+		if len(c.Services) > 0 {
+			fmt.Println(descStyle.Render("    Recreates: " + strings.Join(c.Services, ", ")))
+		} else {
+			fmt.Println(descStyle.Render("    No container uses it directly"))
+		}
+		if c.Caution != "" {
+			fmt.Println(warningStyle.Render("    Note: " + c.Caution))
+		}
+	}
+	fmt.Println()
+
+	if errs := applied.Validate(); len(errs) > 0 {
+		for _, err := range errs {
+			fmt.Println(errorStyle.Render("  ✗ " + err.Error()))
+		}
+		return utils.ExitInvalidConfig
+	}
+
+	recreated := compose.RecreatedServices(changes)
+	question := "Save these changes?"
+	if len(recreated) > 0 {
+		question = fmt.Sprintf("Save these changes and recreate %d container(s)?", len(recreated))
+	}
+	if !dryRun && !promptContinue(question) {
+		return utils.ExitCancelled
+	}
+
+	if err := compose.SaveState(applied, dryRun); err != nil {
+		fmt.Println(errorStyle.Render("  ✗ " + err.Error()))
+		return utils.ExitFilesystem
+	}
+	if err := compose.WriteAllConfigFiles(applied, composeDir, dryRun); err != nil {
+		fmt.Println(errorStyle.Render("  ✗ " + err.Error()))
+		return utils.ExitFilesystem
+	}
+	code := utils.ExitOK
+	if len(recreated) > 0 {
+		// Compose recreates only the containers whose definition changed
+		result := bootstrap.StartServices(composeDir, dryRun)
+		if result.Success {
+			fmt.Println(successStyle.Render("  ✓ " + result.Message))
+		} else {
+			fmt.Println(errorStyle.Render("  ✗ " + result.Message))
+			code = utils.ExitDocker
+		}
+	}
+
+	keys := make([]string, len(changes))
+	for i, c := range changes {
+		keys[i] = c.Key
+	}
+	commitInfra("Apply hand-edited .env: "+strings.Join(keys, ", "), dryRun)
+	fmt.Println()
+	return code
+}
+
+// commitInfra records servctl's changes in the audit log read by -events,
+// the signed inventory read by -inventory diff and, when GitOps mode is on,
+// the ~/infra git history (see runGitOpsCommand)
+func commitInfra(message string, dryRun bool) {
+	if dryRun {
+		return
+	}
+	owner, err := directory.GetOwnerInfo()
+	if err != nil {
+		return
+	}
+	infraRoot := filepath.Join(owner.HomeDir, "infra")
+	if logger, err := utils.NewLogger(filepath.Join(infraRoot, "logs")); err == nil {
+		logger.Info("%s", message)
+		logger.Close()
+	}
+	inv := inventory.Collect(infraRoot, Version, message, preflight.InstalledPackageVersions())
+	if _, err := inventory.Record(infraRoot, inv); err != nil {
+		fmt.Println(warningStyle.Render("  Warning: " + err.Error()))
+	}
+	committed, err := gitops.Commit(infraRoot, message)
+	if err != nil {
+		fmt.Println(warningStyle.Render("  Warning: " + err.Error()))
+	} else if committed {
+		fmt.Println(descStyle.Render("  ✓ Recorded in the ~/infra git history"))
+	}
+}
+
+// lifecycle receives servctl's lifecycle events; nil when no webhook is set
+var lifecycle *hooks.Client
+
+// initLifecycleHooks points lifecycle at the -event-webhook URL, or else the
+// one saved by an earlier setup
+func initLifecycleHooks(url string, dryRun bool) {
+	if url == "" {
+		owner, err := directory.GetOwnerInfo()
+		if err != nil {
+			return
+		}
+		config, err := compose.LoadState(filepath.Join(owner.HomeDir, "infra"))
+		if err != nil || config.EventWebhookURL == "" {
+			return
+		}
+		url = config.EventWebhookURL
+	}
+	lifecycle = &hooks.Client{URL: url, Version: Version, DryRun: dryRun}
+}
+
+// emit posts a lifecycle event; a receiver that is down never fails the
+// command
+func emit(ev hooks.Event) {
+	if err := lifecycle.Send(ev); err != nil {
+		fmt.Println(warningStyle.Render("  Warning: " + err.Error()))
+	}
+}
+
+// exitStatus is the event status matching a command's exit code
+func exitStatus(code int) string {
+	if code == utils.ExitOK {
+		return "ok"
+	}
+	return "failed"
+}
+
+// runRescueDocCommand writes the break-glass document into dir, by default
+// the servctl-rescue folder on the backup drive
+func runRescueDocCommand(dir string, dryRun bool) int {
+	fmt.Println()
+	fmt.Println(sectionStyle.Render("🆘 Rescue Document"))
+	fmt.Println()
+
+	owner, err := directory.GetOwnerInfo()
+	if err != nil {
+		fmt.Println(errorStyle.Render("Error: " + err.Error()))
+		return utils.ExitError
+	}
+	infraRoot := filepath.Join(owner.HomeDir, "infra")
+	config, err := compose.LoadState(infraRoot)
+	if err != nil {
+		fmt.Println(errorStyle.Render("Error: " + err.Error()))
+		return utils.ExitNotConfigured
+	}
+	if config.InfraRoot == "" {
+		config.InfraRoot = infraRoot
+	}
+	mConfig, err := maintenance.LoadConfig(infraRoot)
+	if err != nil {
+		mConfig = maintenance.DefaultScriptConfig()
+	}
+
+	if dir == "" {
+		if !storage.IsMountPoint(mConfig.BackupDest) && !dryRun {
+			fmt.Println(errorStyle.Render("Error: the backup drive is not mounted at " + mConfig.BackupDest))
+			fmt.Println(descStyle.Render("Mount it, or write the document elsewhere: servctl -rescue-doc /media/usb"))
+			return utils.ExitStorage
+		}
+		dir = filepath.Join(mConfig.BackupDest, rescue.Dir)
+	}
+
+	path, err := rescue.Write(dir, rescue.Collect(config, mConfig, owner.Username, Version), dryRun)
+	if err != nil {
+		fmt.Println(errorStyle.Render("Error: " + err.Error()))
+		return utils.ExitFilesystem
+	}
+	if !dryRun {
+		fmt.Println(successStyle.Render("  ✓ " + path))
+		fmt.Println(descStyle.Render("  It holds no passwords. Print it or keep a copy off the server too."))
+	}
+	fmt.Println()
+	return utils.ExitOK
+}
+
+// runExposureCommand looks for web interfaces reachable from the internet:
+// router forwards to this machine over UPnP and, with relay set, the
+// ports as seen from that SSH host outside the LAN
+func runExposureCommand(relay string, dryRun bool) int {
+	fmt.Println()
+	fmt.Println(sectionStyle.Render("🌍 Internet Exposure"))
+	fmt.Println()
+
+	owner, err := directory.GetOwnerInfo()
+	if err != nil {
+		fmt.Println(errorStyle.Render("Error: " + err.Error()))
+		return utils.ExitError
+	}
+	config, err := compose.LoadState(filepath.Join(owner.HomeDir, "infra"))
+	if err != nil {
+		fmt.Println(errorStyle.Render("Error: " + err.Error()))
+		return utils.ExitNotConfigured
+	}
+
+	if _, err := exec.LookPath("upnpc"); err != nil {
+		if os.Geteuid() != 0 && !dryRun {
+			fmt.Println(warningStyle.Render("  upnpc is not installed; the router's forwards are not checked"))
+			fmt.Println(descStyle.Render("  Install it with: sudo apt install " + exposure.Package))
+		} else if err := ops.Execute(dryRun, installOp(exposure.Package)); err != nil {
+			fmt.Println(warningStyle.Render("  Warning: " + err.Error()))
+		}
+	}
+
+	services := exposure.Services(config)
+	report := exposure.Check(services, relay)
+
+	if report.UPnP {
+		fmt.Println(successStyle.Render("  ✓ ") + fmt.Sprintf("Router answered over UPnP (external address %s)", report.ExternalIP))
+		for _, m := range report.Mappings {
+			fmt.Println(descStyle.Render(fmt.Sprintf("    %s %d -> %s:%d '%s'", m.Protocol, m.External, m.InternalIP, m.Internal, m.Description)))
+		}
+		if len(report.Mappings) == 0 {
+			fmt.Println(descStyle.Render("    No forwards to this machine"))
+		}
+	} else {
+		fmt.Println(warningStyle.Render("  - " + report.UPnPError))
+	}
+	if relay != "" {
+		if report.RelayError != "" {
+			fmt.Println(warningStyle.Render("  ! " + report.RelayError))
+		}
+		if len(report.Probed) > 0 {
+			fmt.Println(successStyle.Render("  ✓ ") + fmt.Sprintf("Tried %d ports from %s", len(report.Probed), relay))
+		}
+	} else {
+		fmt.Println(descStyle.Render("  Forwards set by hand are only found from outside: servctl -exposure user@vps"))
+	}
+	fmt.Println()
+
+	if len(report.Findings) == 0 {
+		fmt.Println(successStyle.Render("  ✓ No web interface is reachable from the internet"))
+		fmt.Println()
+		return utils.ExitOK
+	}
+	for _, f := range report.Findings {
+		style := warningStyle
+		if f.Service.Critical() {
+			style = errorStyle
+		}
+		fmt.Println(style.Render("  ✗ " + f.String()))
+	}
+	fmt.Println()
+	fmt.Println(descStyle.Render("  Remove the forwards on the router (upnpc -d PORT TCP for UPnP ones) and reach"))
+	fmt.Println(descStyle.Render("  the services remotely through the Cloudflare Tunnel or Tailscale instead."))
+	fmt.Println()
+
+	var messages []string
+	for _, f := range report.Findings {
+		messages = append(messages, f.String())
+	}
+	emit(hooks.Event{Event: hooks.ServiceExposed, Critical: len(report.Critical()) > 0,
+		Message: strings.Join(messages, "; ")})
+	return utils.ExitError
+}
+
+// runPortForwardCommand keeps, checks or removes the router's forward of
+// port 443 to this machine and the firewall rules in front of it. relay, a
+// host outside the LAN reachable over SSH, confirms the port answers from
+// the internet; countries, when set, replaces the saved allow-list.
+func runPortForwardCommand(action, relay, countryList string, dryRun bool) int {
+	fmt.Println()
+	fmt.Println(sectionStyle.Render("🔀 Port Forward"))
+	fmt.Println()
+
+	if action != "on" && action != "off" && action != "status" {
+		fmt.Println(errorStyle.Render("Unknown action " + action + ": use -port-forward on, off or status"))
+		return utils.ExitUsage
+	}
+
+	owner, err := directory.GetOwnerInfo()
+	if err != nil {
+		fmt.Println(errorStyle.Render("Error: " + err.Error()))
+		return utils.ExitError
+	}
+	config, err := compose.LoadState(filepath.Join(owner.HomeDir, "infra"))
+	if err != nil {
+		fmt.Println(errorStyle.Render("Error: " + err.Error()))
+		return utils.ExitNotConfigured
+	}
+	port := fmt.Sprint(exposure.ForwardPort)
+
+	switch action {
+	case "off":
+		if config.PortForward == "" {
+			fmt.Println(descStyle.Render("  servctl keeps no forward on the router"))
+			return utils.ExitOK
+		}
+		code := utils.ExitOK
+		if err := exposure.RemoveEdge(dryRun); err != nil {
+			fmt.Println(errorStyle.Render("  ✗ " + err.Error()))
+			return utils.ExitError
+		}
+		if err := exposure.RemoveRenewal(dryRun); err != nil {
+			fmt.Println(errorStyle.Render("  ✗ " + err.Error()))
+			return utils.ExitError
+		}
+		if err := exposure.RemoveForward(config.PortForward, dryRun); err != nil {
+			// Without renewal the lease runs out within the hour anyway
+			fmt.Println(warningStyle.Render("  ! " + err.Error()))
+			fmt.Println(descStyle.Render("  The lease is no longer renewed and ends within the hour"))
+			code = utils.ExitNetwork
+		} else if !dryRun {
+			fmt.Println(successStyle.Render("  ✓ ") + "Port " + port + " is no longer forwarded")
+		}
+		if dryRun {
+			return code
+		}
+		config.PortForward = ""
+		if err := compose.SaveState(config, false); err != nil {
+			fmt.Println(errorStyle.Render("  ✗ " + err.Error()))
+			return utils.ExitError
+		}
+		return code
+
+	case "status":
+		if config.PortForward == "" {
+			fmt.Println(descStyle.Render("  servctl keeps no forward on the router. Turn it on with: sudo servctl -port-forward on"))
+			return utils.ExitOK
+		}
+		externalIP, err := exposure.ForwardStatus(config.PortForward, config.HostIP)
+		if err != nil {
+			fmt.Println(errorStyle.Render("  ✗ " + err.Error()))
+			fmt.Println(descStyle.Render("  See 'systemctl status servctl-port-forward' for the last renewal"))
+			return utils.ExitNetwork
+		}
+		fmt.Println(successStyle.Render("  ✓ ") + fmt.Sprintf("Router forwards %s:%s to %s:%s (%s)", externalIP, port, config.HostIP, port, config.PortForward))
+		printEdgeCounters(config.PortForwardCountries)
+		return checkForwardReachable(relay, externalIP)
+	}
+
+	if countryList != "" {
+		list := countryList
+		if list == "any" {
+			list = ""
+		}
+		parsed, err := exposure.ParseCountries(list)
+		if err != nil {
+			fmt.Println(errorStyle.Render("Error: " + err.Error()))
+			return utils.ExitUsage
+		}
+		config.PortForwardCountries = parsed
+	}
+
+	if !exposure.Listening(config.HostIP) && !dryRun {
+		fmt.Println(errorStyle.Render("  ✗ Nothing answers on port " + port + " at " + config.HostIP))
+		fmt.Println(descStyle.Render("  servctl forwards only to a TLS reverse proxy (Caddy, nginx, Traefik) running here;"))
+		fmt.Println(descStyle.Render("  the services' own ports speak plain HTTP and stay on the LAN. Start the proxy first."))
+		return utils.ExitNetwork
+	}
+
+	var missing []string
+	for _, tool := range [][2]string{{"upnpc", exposure.Package}, {"natpmpc", exposure.NATPMPPackage}, {"nft", "nftables"}} {
+		if _, err := exec.LookPath(tool[0]); err != nil {
+			missing = append(missing, tool[1])
+		}
+	}
+	if len(missing) > 0 {
+		if err := ops.Execute(dryRun, installOp(missing...)); err != nil {
+			fmt.Println(warningStyle.Render("  Warning: " + err.Error()))
+		}
+	}
+
+	// The rules go in before the port opens
+	if err := exposure.InstallEdge(config.PortForwardCountries, dryRun); err != nil {
+		fmt.Println(errorStyle.Render("  ✗ " + err.Error()))
+		return utils.ExitError
+	}
+	if !dryRun {
+		limits := "Each address may open 30 connections a minute; those that keep going are blocked for 15 minutes"
+		fmt.Println(successStyle.Render("  ✓ ") + limits)
+		if len(config.PortForwardCountries) > 0 {
+			fmt.Println(successStyle.Render("  ✓ ") + "Only " + strings.Join(config.PortForwardCountries, ", ") + " and the LAN reach port " + port)
+		}
+	}
+
+	method, externalIP, err := exposure.AddForward(config.HostIP, dryRun)
+	if err != nil {
+		fmt.Println(errorStyle.Render("  ✗ " + err.Error()))
+		if config.PortForward == "" {
+			exposure.RemoveEdge(dryRun)
+		}
+		fmt.Println(descStyle.Render("  Turn on UPnP or NAT-PMP in the router's settings, or forward port " + port + " there by hand"))
+		return utils.ExitNetwork
+	}
+	if dryRun {
+		// Which protocol the router answers is only known once it is asked
+		method = exposure.MethodUPnP
+	} else {
+		fmt.Println(successStyle.Render("  ✓ ") + fmt.Sprintf("Router forwards %s:%s to %s:%s (%s)", externalIP, port, config.HostIP, port, method))
+	}
+
+	if err := exposure.InstallRenewal(method, config.HostIP, dryRun); err != nil {
+		fmt.Println(errorStyle.Render("  ✗ " + err.Error()))
+		return utils.ExitError
+	}
+	if dryRun {
+		return utils.ExitOK
+	}
+	fmt.Println(successStyle.Render("  ✓ ") + "Lease renewed every 20 minutes (servctl-port-forward.timer)")
+
+	config.PortForward = method
+	if err := compose.SaveState(config, false); err != nil {
+		fmt.Println(errorStyle.Render("  ✗ " + err.Error()))
+		return utils.ExitError
+	}
+	code := checkForwardReachable(relay, externalIP)
+	fmt.Println(descStyle.Render("  Remove it again with: sudo servctl -port-forward off"))
+	fmt.Println()
+	return code
+}
+
+// printEdgeCounters shows what the rules in front of the forwarded port
+// dropped since the weekly report last reset them
+func printEdgeCounters(countries []string) {
+	counters, err := exposure.EdgeCounters()
+	if err != nil {
+		fmt.Println(warningStyle.Render("  ! " + err.Error()))
+		return
+	}
+	line := fmt.Sprintf("Dropped this week: %d rate-limited, %d from banned sources", counters["rate_limited"], counters["banned"])
+	if len(countries) > 0 {
+		line += fmt.Sprintf(", %d from outside %s", counters["geo_blocked"], strings.Join(countries, ", "))
+	}
+	fmt.Println(descStyle.Render("  " + line))
+}
+
+// checkForwardReachable confirms from relay that the forwarded port answers
+// from the internet; without a relay it only warns when the router sits
+// behind the carrier's NAT
+func checkForwardReachable(relay, externalIP string) int {
+	port := fmt.Sprint(exposure.ForwardPort)
+	if exposure.BehindCGNAT(externalIP) {
+		fmt.Println(warningStyle.Render("  ! The router's external address " + externalIP + " is private: your provider's NAT"))
+		fmt.Println(warningStyle.Render("    sits in front, so the forward cannot reach the internet. Use the Cloudflare Tunnel instead."))
+	}
+	if relay == "" {
+		fmt.Println(descStyle.Render("  Confirm it answers from outside: servctl -port-forward status user@vps"))
+		return utils.ExitOK
+	}
+	publicIP, open, err := exposure.Reachable(relay)
+	switch {
+	case err != nil:
+		fmt.Println(warningStyle.Render("  ! " + err.Error()))
+		return utils.ExitNetwork
+	case !open:
+		fmt.Println(errorStyle.Render("  ✗ " + relay + " cannot reach " + publicIP + ":" + port))
+		if publicIP != externalIP {
+			fmt.Println(descStyle.Render("  The internet sees this network as " + publicIP + ", not the router's " + externalIP + ": the provider's NAT is in front"))
+		}
+		return utils.ExitNetwork
+	}
+	fmt.Println(successStyle.Render("  ✓ ") + fmt.Sprintf("%s reaches %s:%s", relay, publicIP, port))
+	return utils.ExitOK
+}
+
+func runClientProfileCommand(path string) int {
+	fmt.Println()
+	fmt.Println(sectionStyle.Render("💻 Client Profile"))
+	fmt.Println()
+
+	if path == "" {
+		path = client.ProfileFile
+	}
+	owner, err := directory.GetOwnerInfo()
+	if err != nil {
+		fmt.Println(errorStyle.Render("Error: " + err.Error()))
+		return utils.ExitError
+	}
+	config, err := compose.LoadState(filepath.Join(owner.HomeDir, "infra"))
+	if err != nil {
+		fmt.Println(errorStyle.Render("Error: " + err.Error()))
+		return utils.ExitNotConfigured
+	}
+	if err := client.WriteProfile(client.NewProfile(config), path); err != nil {
+		fmt.Println(errorStyle.Render("Error: " + err.Error()))
+		return utils.ExitFilesystem
+	}
+	fmt.Println(successStyle.Render("  ✓ " + path))
+	fmt.Println(descStyle.Render("  It holds addresses and user names, no passwords. Copy it to a laptop and run:"))
+	if abs, err := filepath.Abs(path); err == nil {
+		if cmd := session.CopyCommand(abs); cmd != "" {
+			fmt.Println("    " + cmd)
+		}
+	}
+	fmt.Println("    servctl -client-setup " + filepath.Base(path))
+	fmt.Println()
+	return utils.ExitOK
+}
+
+func runClientSetupCommand(arg string) int {
+	fmt.Println()
+	fmt.Println(sectionStyle.Render("💻 Client Setup"))
+	fmt.Println()
+
+	var dirs []string
+	if cwd, err := os.Getwd(); err == nil {
+		dirs = append(dirs, cwd)
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		dirs = append(dirs, filepath.Join(home, "Downloads"))
+	}
+	profile, from, err := client.Discover(arg, dirs)
+	if err != nil {
+		fmt.Println(errorStyle.Render("Error: " + err.Error()))
+		return utils.ExitNetwork
+	}
+	fmt.Printf("  Server: %s %s\n", successStyle.Render(profile.Host), descStyle.Render("(from "+from+")"))
+	fmt.Println()
+
+	// Connectivity from this machine
+	fmt.Println(titleStyle.Render("Connectivity:"))
+	code := utils.ExitOK
+	for _, c := range client.Verify(profile) {
+		if c.Err != nil {
+			fmt.Println(errorStyle.Render("  ✗ "+c.Service.Name+" ") + c.Service.URL + descStyle.Render("  "+c.Err.Error()))
+			code = utils.ExitNetwork
+		} else {
+			fmt.Println(successStyle.Render("  ✓ "+c.Service.Name+" ") + c.Service.URL + descStyle.Render("  "+c.Status))
+		}
+	}
+	fmt.Println()
+
+	// Friendly names, when the server does not serve them itself
+	hostsFile := client.HostsFile(runtime.GOOS)
+	if profile.HostsEntries != "" && !client.HasHostsEntries(hostsFile) {
+		fmt.Println(titleStyle.Render("Friendly names:"))
+		fmt.Println(descStyle.Render("  Append this block to " + hostsFile + " (as administrator) to use photos.home.arpa and friends:"))
+		for _, line := range strings.Split(strings.TrimSpace(profile.HostsEntries), "\n") {
+			fmt.Println("    " + line)
+		}
+		fmt.Println()
+	}
+
+	// Desktop apps
+	fmt.Println(titleStyle.Render("Desktop apps:"))
+	reader := promptReader()
+	for _, app := range client.DesktopApps(profile, runtime.GOOS) {
+		fmt.Printf("  %s %s\n", app.Name, descStyle.Render("- "+app.Purpose))
+		if app.Path == "" {
+			fmt.Println(warningStyle.Render("    Not installed. Install with: ") + app.Install)
+			continue
+		}
+		value := ""
+		if app.LinkPrompt != "" {
+			fmt.Printf("    %s: ", app.LinkPrompt)
+			line, _ := reader.ReadString('\n')
+			if value = strings.TrimSpace(line); value == "" {
+				continue
+			}
+		} else if !promptContinue("    Open " + app.Name + " set up for this server?") {
+			continue
+		}
+		if err := app.Link(value); err != nil {
+			fmt.Println(errorStyle.Render("    ✗ " + err.Error()))
+		} else {
+			fmt.Println(successStyle.Render("    ✓ Linked to " + profile.Host))
+		}
+	}
+	fmt.Println()
+
+	if profile.NextcloudUser != "" {
+		fmt.Println(descStyle.Render("Sign in to Nextcloud as " + profile.NextcloudUser + "; the Immich app on your phone uses " + profile.URL(client.ServiceImmich) + "."))
+		fmt.Println()
+	}
+	return code
+}
+
+// historyRuns is how many runs -maintenance history shows
+const historyRuns = 30
+
+func runMaintenanceCommand(action, script string) int {
+	switch action {
+	case "history":
+		return runMaintenanceHistory(script)
+	case "validate":
+		return runMaintenanceValidate()
+	}
+	fmt.Println(errorStyle.Render("Unknown -maintenance action: " + action + " (use history or validate)"))
+	return utils.ExitUsage
+}
+
+// runMaintenanceHistory shows the recorded runs, of one script when given
+func runMaintenanceHistory(script string) int {
+	fmt.Println()
+	fmt.Println(sectionStyle.Render("🧾 Maintenance History"))
+	fmt.Println()
+
+	owner, err := directory.GetOwnerInfo()
+	if err != nil {
+		fmt.Println(errorStyle.Render("Error: " + err.Error()))
+		return utils.ExitError
+	}
+	records, err := maintenance.ReadHistory(filepath.Join(owner.HomeDir, "infra"))
+	if err != nil {
+		fmt.Println(errorStyle.Render("Error: " + err.Error()))
+		return utils.ExitError
+	}
+	streaks := maintenance.FailureStreaks(records)
+	records = maintenance.FilterHistory(records, script)
+	if len(records) == 0 {
+		fmt.Println(descStyle.Render("  No recorded runs yet. Jobs scheduled by servctl -start-setup are recorded as they run."))
+		fmt.Println()
+		return utils.ExitOK
+	}
+	if len(records) > historyRuns {
+		records = records[len(records)-historyRuns:]
+	}
+
+	for _, r := range records {
+		mark, style := "✓", successStyle
+		if r.Failed() {
+			mark, style = "✗", errorStyle
+		}
+		fmt.Printf("  %s %s  %-20s %8s  exit %-3d %s\n", style.Render(mark), r.Start.Format("2006-01-02 15:04"),
+			r.Script, r.Duration().Round(time.Second), r.ExitCode, descStyle.Render(r.Summary))
+	}
+	fmt.Println()
+
+	failing := 0
+	for _, name := range slices.Sorted(maps.Keys(streaks)) {
+		if script != "" && name != script {
+			continue
+		}
+		failing++
+		style := warningStyle
+		if streaks[name] >= maintenance.FailureStreakAlert {
+			style = errorStyle
+		}
+		fmt.Println(style.Render(fmt.Sprintf("  %s: %d failed run(s) in a row", name, streaks[name])))
+	}
+	if failing > 0 {
+		fmt.Println(descStyle.Render("  Each script's own log in ~/infra/logs has the details."))
+		fmt.Println()
+		return utils.ExitError
+	}
+	return utils.ExitOK
+}
+
+// analyzeListed is how many of the largest videos -analyze photos names
+const analyzeListed = 5
+
+func runAnalyzeCommand(target string, dryRun bool) int {
+	switch target {
+	case "photos":
+	case "filenames":
+		return runFilenameCheck(dryRun)
+	default:
+		fmt.Println(errorStyle.Render("Unknown -analyze target: " + target + " (use photos or filenames)"))
+		return utils.ExitUsage
+	}
+
+	fmt.Println()
+	fmt.Println(sectionStyle.Render("📷 Photo Analysis"))
+	fmt.Println()
+
+	owner, err := directory.GetOwnerInfo()
+	if err != nil {
+		fmt.Println(errorStyle.Render("Error: " + err.Error()))
+		return utils.ExitError
+	}
+	config, err := compose.LoadState(filepath.Join(owner.HomeDir, "infra"))
+	if err != nil {
+		fmt.Println(errorStyle.Render("Error: " + err.Error()))
+		return utils.ExitNotConfigured
+	}
+	libraries, skipped, err := bootstrap.PhotoLibraries(config)
+	if err != nil {
+		fmt.Println(errorStyle.Render("Error: " + err.Error()))
+		return utils.ExitDocker
+	}
+
+	type analyzed struct {
+		library  bootstrap.PhotoLibrary
+		analysis bootstrap.PhotoAnalysis
+	}
+	var results []analyzed
+	var savings, videoSize uint64
+	groups, shots := 0, 0
+	for _, lib := range libraries {
+		fmt.Println(titleStyle.Render(lib.Owner))
+		a, err := lib.Client.AnalyzePhotos()
+		if err != nil {
+			fmt.Println(errorStyle.Render("  ✗ " + err.Error()))
+			fmt.Println()
+			continue
+		}
+		results = append(results, analyzed{lib, a})
+		savings += a.DuplicateSavings() + a.ScreenshotSize()
+		videoSize += a.LargeVideoSize()
+		groups += len(a.Duplicates)
+		shots += len(a.Screenshots)
+
+		fmt.Printf("  Duplicates:   %d group(s), %s in extra copies\n", len(a.Duplicates), storage.FormatBytes(a.DuplicateSavings()))
+		fmt.Printf("  Screenshots:  %d, %s\n", len(a.Screenshots), storage.FormatBytes(a.ScreenshotSize()))
+		fmt.Printf("  Large videos: %d over %s, %s\n", len(a.LargeVideos),
+			storage.FormatBytes(bootstrap.LargeVideoMinSize), storage.FormatBytes(a.LargeVideoSize()))
+		for i, v := range a.LargeVideos {
+			if i == analyzeListed {
+				fmt.Println(descStyle.Render(fmt.Sprintf("    and %d more", len(a.LargeVideos)-analyzeListed)))
+				break
+			}
+			fmt.Println(descStyle.Render(fmt.Sprintf("    %-40s %s", v.Name, storage.FormatBytes(v.Size))))
+		}
+		fmt.Println()
+	}
+	if len(skipped) > 0 {
+		fmt.Println(warningStyle.Render("  Not analyzed (no API key): " + strings.Join(skipped, ", ")))
+		fmt.Println(descStyle.Render("  Members are reached through the per-member API keys the setup can create (Immich sharing)."))
+		fmt.Println()
+	}
+	if len(results) == 0 {
+		return utils.ExitError
+	}
+
+	fmt.Println(successStyle.Render("  Deleting extra duplicate copies and screenshots would free " + storage.FormatBytes(savings)))
+	if videoSize > 0 {
+		fmt.Println(descStyle.Render("  Large videos take " + storage.FormatBytes(videoSize) + "; the Immich app can keep them on the phone only."))
+	}
+	fmt.Println(descStyle.Render("  Duplicates come from Immich's duplicate detection job, which needs smart search."))
+	fmt.Println(descStyle.Render("  Review and delete them under Utilities > Review duplicates in the web interface."))
+
+	if groups == 0 && shots == 0 {
+		fmt.Println()
+		return utils.ExitOK
+	}
+	if dryRun {
+		fmt.Println()
+		fmt.Println(descStyle.Render(fmt.Sprintf("  [Dry Run] Would offer to stack %d duplicate group(s) and archive %d screenshot(s)", groups, shots)))
+		fmt.Println()
+		return utils.ExitOK
+	}
+
+	reader := promptReader()
+	ask := func(question string) bool {
+		fmt.Print("  " + question + " [y/N]: ")
+		response, _ := reader.ReadString('\n')
+		response = strings.TrimSpace(strings.ToLower(response))
+		return response == "y" || response == "yes"
+	}
+	fmt.Println()
+	stack := groups > 0 && ask(fmt.Sprintf("Stack the %d duplicate group(s) under their largest copy? Nothing is deleted.", groups))
+	archive := shots > 0 && ask(fmt.Sprintf("Archive the %d screenshot(s)? They leave the timeline but stay in albums and search.", shots))
+
+	code := utils.ExitOK
+	for _, r := range results {
+		if stack && len(r.analysis.Duplicates) > 0 {
+			n, err := r.library.Client.StackDuplicates(r.analysis.Duplicates)
+			if err != nil {
+				fmt.Println(errorStyle.Render(fmt.Sprintf("  ✗ %s: stacked %d group(s), then: %v", r.library.Owner, n, err)))
+				code = utils.ExitError
+			} else {
+				fmt.Println(successStyle.Render(fmt.Sprintf("  ✓ %s: stacked %d group(s)", r.library.Owner, n)))
+			}
+		}
+		if archive && len(r.analysis.Screenshots) > 0 {
+			if err := r.library.Client.ArchiveAssets(r.analysis.Screenshots); err != nil {
+				fmt.Println(errorStyle.Render(fmt.Sprintf("  ✗ %s: archiving screenshots: %v", r.library.Owner, err)))
+				code = utils.ExitError
+			} else {
+				fmt.Println(successStyle.Render(fmt.Sprintf("  ✓ %s: archived %d screenshot(s)", r.library.Owner, len(r.analysis.Screenshots))))
+			}
+		}
+	}
+	fmt.Println()
+	return code
+}
+
+// filenameReport lists every name -analyze filenames found, in ~/infra/logs
+const filenameReport = "filename_check.txt"
+
+// runFilenameCheck finds Nextcloud files the Windows and macOS desktop
+// clients cannot sync and offers to rename them
+func runFilenameCheck(dryRun bool) int {
+	fmt.Println()
+	fmt.Println(sectionStyle.Render("🗂  Filename Check"))
+	fmt.Println()
+
+	owner, err := directory.GetOwnerInfo()
+	if err != nil {
+		fmt.Println(errorStyle.Render("Error: " + err.Error()))
+		return utils.ExitError
+	}
+	infraRoot := filepath.Join(owner.HomeDir, "infra")
+	config, err := compose.LoadState(infraRoot)
+	if err != nil {
+		fmt.Println(errorStyle.Render("Error: " + err.Error()))
+		return utils.ExitNotConfigured
+	}
+	issues, err := bootstrap.CheckFilenames(config)
+	if err != nil {
+		fmt.Println(errorStyle.Render("Error: " + err.Error()))
+		if os.IsPermission(err) {
+			fmt.Println(descStyle.Render("  Nextcloud's files belong to its web server user; run with sudo"))
+		}
+		return utils.ExitFilesystem
+	}
+	if len(issues) == 0 {
+		fmt.Println(successStyle.Render("  ✓ Every file name syncs to Windows and macOS"))
+		fmt.Println()
+		return utils.ExitOK
+	}
+
+	var report strings.Builder
+	perUser := make(map[string]int)
+	for _, issue := range issues {
+		if perUser[issue.User] == analyzeListed {
+			fmt.Println(descStyle.Render("    and more, see the report below"))
+		}
+		if perUser[issue.User] == 0 {
+			fmt.Println(titleStyle.Render(issue.User))
+		}
+		if perUser[issue.User] < analyzeListed {
+			fmt.Printf("  %s\n", filepath.Base(issue.Path))
+			fmt.Println(descStyle.Render(fmt.Sprintf("    %s → %s", issue.Reason, issue.Rename)))
+		}
+		perUser[issue.User]++
+		fmt.Fprintf(&report, "%s\t%s\t%s\n", issue.Path, issue.Reason, issue.Rename)
+	}
+	fmt.Println()
+	fmt.Println(warningStyle.Render(fmt.Sprintf("  %d name(s) never reach Windows or macOS clients; the desktop client only lists them in its activity log", len(issues))))
+	reportPath := filepath.Join(infraRoot, "logs", filenameReport)
+	if err := utils.AtomicWrite(reportPath, []byte(report.String()), 0644); err != nil {
+		fmt.Println(warningStyle.Render("  Warning: " + err.Error()))
+	} else {
+		fmt.Println(descStyle.Render("  Full list (path, problem, new name): " + reportPath))
+	}
+
+	if dryRun {
+		fmt.Println()
+		fmt.Println(descStyle.Render(fmt.Sprintf("  [Dry Run] Would offer to rename %d file(s) and folder(s)", len(issues))))
+		fmt.Println()
+		return utils.ExitOK
+	}
+	reader := promptReader()
+	fmt.Println()
+	fmt.Print("  Rename them as shown? Shares and comments on a renamed file start over. [y/N]: ")
+	response, _ := reader.ReadString('\n')
+	if response = strings.TrimSpace(strings.ToLower(response)); response != "y" && response != "yes" {
+		fmt.Println()
+		return utils.ExitCancelled
+	}
+
+	code := utils.ExitOK
+	users, errs := bootstrap.RenameFilenames(issues)
+	for _, err := range errs {
+		fmt.Println(errorStyle.Render("  ✗ " + err.Error()))
+		code = utils.ExitFilesystem
+	}
+	fmt.Println(successStyle.Render(fmt.Sprintf("  ✓ Renamed %d of %d", len(issues)-len(errs), len(issues))))
+	// Nextcloud only sees files renamed behind its back after a rescan
+	for _, user := range users {
+		if err := bootstrap.ScanNextcloudFiles(user+"/files", false); err != nil {
+			fmt.Println(errorStyle.Render("  ✗ " + err.Error()))
+			code = utils.ExitDocker
+		} else {
+			fmt.Println(successStyle.Render("  ✓ Nextcloud rescanned the files of " + user))
+		}
+	}
+	fmt.Println()
+	return code
+}
+
+func runEventsCommand(sinceArg, untilArg, sourceArg string) int {
+	fmt.Println()
+	fmt.Println(sectionStyle.Render("🕑 Events"))
+	fmt.Println()
+
+	now := time.Now()
+	since, err := events.ParseTime(sinceArg, now)
+	if err != nil {
+		fmt.Println(errorStyle.Render("Error: " + err.Error()))
+		return utils.ExitUsage
+	}
+	until, err := events.ParseTime(untilArg, now)
+	if err != nil {
+		fmt.Println(errorStyle.Render("Error: " + err.Error()))
+		return utils.ExitUsage
+	}
+	sources, err := events.ParseSources(sourceArg)
+	if err != nil {
+		fmt.Println(errorStyle.Render("Error: " + err.Error()))
+		return utils.ExitUsage
+	}
+
+	owner, err := directory.GetOwnerInfo()
+	if err != nil {
+		fmt.Println(errorStyle.Render("Error: " + err.Error()))
+		return utils.ExitError
+	}
+	infraRoot := filepath.Join(owner.HomeDir, "infra")
+	opts := events.Options{LogDir: filepath.Join(infraRoot, "logs"), Since: since, Until: until, Sources: sources}
+	if config, err := compose.LoadState(infraRoot); err == nil {
+		opts.DockerSocket = config.DockerSocket
+	}
+
+	timeline, errs := events.Collect(opts)
+	for _, err := range errs {
+		fmt.Println(warningStyle.Render("  Warning: " + err.Error()))
+	}
+	if len(timeline) == 0 {
+		fmt.Println(descStyle.Render("  No events since " + since.Format("2006-01-02 15:04")))
+		fmt.Println()
+		return utils.ExitOK
+	}
+
+	day := ""
+	for _, e := range timeline {
+		if d := e.Time.Format("Mon 2006-01-02"); d != day {
+			day = d
+			fmt.Println(titleStyle.Render(day))
+		}
+		style := descStyle
+		switch e.Level {
+		case events.LevelWarn:
+			style = warningStyle
+		case events.LevelError:
+			style = errorStyle
+		}
+		fmt.Printf("  %s  %-8s %s\n", e.Time.Format("15:04:05"), e.Source, style.Render(e.Message))
+	}
+	fmt.Println()
+	return utils.ExitOK
+}
+
+func runExportCommand(format, dir string, dryRun bool) int {
+	fmt.Println()
+	fmt.Println(sectionStyle.Render("📤 Export"))
+	fmt.Println()
+
+	if !slices.Contains(export.Formats, format) {
+		fmt.Println(errorStyle.Render("Unknown format " + format + ": use -export " + strings.Join(export.Formats, " or -export ")))
+		return utils.ExitUsage
+	}
+	if dir == "" {
+		dir = "servctl-" + format
+	}
+	owner, err := directory.GetOwnerInfo()
+	if err != nil {
+		fmt.Println(errorStyle.Render("Error: " + err.Error()))
+		return utils.ExitError
+	}
+
+	bundle, err := export.Collect(filepath.Join(owner.HomeDir, "infra"), owner.Username)
+	if err != nil {
+		fmt.Println(errorStyle.Render("Error: " + err.Error()))
+		return utils.ExitNotConfigured
+	}
+	written, err := export.Write(bundle, format, dir, dryRun)
+	if err != nil {
+		fmt.Println(errorStyle.Render("Error: " + err.Error()))
+		return utils.ExitFilesystem
+	}
+	if dryRun {
+		return utils.ExitOK
+	}
+
+	for _, path := range written {
+		if filepath.Dir(path) == filepath.Clean(dir) {
+			fmt.Println(successStyle.Render("  ✓ " + path))
+		}
+	}
+	if format == "ansible" {
+		fmt.Println(descStyle.Render(fmt.Sprintf("  ✓ %d generated files under %s", len(bundle.Files), filepath.Join(dir, "files"))))
+		fmt.Println()
+		fmt.Println(descStyle.Render("Run with: ansible-playbook -i " + filepath.Join(dir, "inventory.ini") + " " + filepath.Join(dir, "playbook.yml")))
+	} else {
+		fmt.Println()
+		fmt.Println(descStyle.Render("Pass it as user-data when creating the new machine."))
+	}
+	fmt.Println(warningStyle.Render("The export contains every password: encrypt it (e.g. ansible-vault) before storing it."))
+	fmt.Println(descStyle.Render("Disks are not included: mount the data root at " + bundle.Config.DataRoot + " on the new machine first."))
+	fmt.Println()
+	return utils.ExitOK
+}
+
+func runGitOpsCommand(action, remote string, dryRun bool) int {
+	fmt.Println()
+	fmt.Println(sectionStyle.Render("🌿 GitOps"))
+	fmt.Println()
+
+	owner, err := directory.GetOwnerInfo()
+	if err != nil {
+		fmt.Println(errorStyle.Render("Error: " + err.Error()))
+		return utils.ExitError
+	}
+	infraRoot := filepath.Join(owner.HomeDir, "infra")
+
+	switch action {
+	case "init":
+		if err := gitops.Init(infraRoot, remote, dryRun); err != nil {
+			fmt.Println(errorStyle.Render("Error: " + err.Error()))
+			return utils.ExitError
+		}
+		if dryRun {
+			return utils.ExitOK
+		}
+		fmt.Println(successStyle.Render("✅ " + infraRoot + " is under git"))
+		fmt.Println(descStyle.Render("Every change servctl makes there is now committed. .env, the state file"))
+		fmt.Println(descStyle.Render("and keys are ignored; passwords and webhook URLs in other files are redacted."))
+		if remote != "" {
+			fmt.Println(descStyle.Render("Commits are pushed to " + remote + " - keep it private."))
+		}
+
+	case "push":
+		push := ops.Func{Description: "push " + infraRoot + " history to its remote", Fn: func() error {
+			if err := gitops.Push(infraRoot); err != nil {
+				return err
+			}
+			fmt.Println(successStyle.Render("✅ Pushed"))
+			return nil
+		}}
+		if err := ops.Execute(dryRun, push); err != nil {
+			fmt.Println(errorStyle.Render("Error: " + err.Error()))
+			return utils.ExitNetwork
+		}
+
+	case "log":
+		commits, err := gitops.Log(infraRoot, 20)
+		if err != nil {
+			fmt.Println(errorStyle.Render("Error: " + err.Error()))
+			return utils.ExitError
+		}
+		for _, c := range commits {
+			fmt.Println("  " + c)
+		}
+		fmt.Println()
+		fmt.Println(descStyle.Render("Inspect a change with: git -C " + infraRoot + " show HASH"))
+
+	default:
+		fmt.Println(errorStyle.Render("Unknown action " + action + ": use -gitops init [REMOTE], -gitops push or -gitops log"))
+		return utils.ExitUsage
+	}
+	fmt.Println()
+	return utils.ExitOK
+}
+
+func runInventoryCommand(action, date string) int {
+	fmt.Println()
+	fmt.Println(sectionStyle.Render("📦 Inventory"))
+	fmt.Println()
+
+	owner, err := directory.GetOwnerInfo()
+	if err != nil {
+		fmt.Println(errorStyle.Render("Error: " + err.Error()))
+		return utils.ExitError
+	}
+	infraRoot := filepath.Join(owner.HomeDir, "infra")
+	current := inventory.Collect(infraRoot, Version, "", preflight.InstalledPackageVersions())
+
+	switch action {
+	case "show":
+		fmt.Printf("  %-20s %s\n", "servctl", current.ServctlVersion)
+		fmt.Printf("  %-20s %s\n", "kernel", current.Kernel)
+		fmt.Printf("  %-20s %s\n", "docker-compose.yml", current.ComposeHash)
+		for _, img := range current.Images {
+			digest := img.Digest
+			if digest == "" {
+				digest = descStyle.Render("not pulled from a registry")
+			}
+			fmt.Printf("  %-20s %s\n", img.Ref, digest)
+		}
+		for _, name := range slices.Sorted(maps.Keys(current.Packages)) {
+			fmt.Printf("  %-20s %s\n", name, current.Packages[name])
+		}
+		if entries, err := inventory.List(infraRoot); err == nil && len(entries) > 0 {
+			fmt.Println()
+			fmt.Println(descStyle.Render(fmt.Sprintf("  %d record(s) in %s, the last from %s",
+				len(entries), filepath.Join(infraRoot, inventory.Dir), entries[len(entries)-1].Time.Format("2006-01-02 15:04"))))
+		}
+
+	case "diff":
+		if date == "" {
+			fmt.Println(errorStyle.Render("Usage: servctl -inventory diff DATE (e.g. 7d, 2024-05-01 or \"2024-05-01 03:00\")"))
+			return utils.ExitUsage
+		}
+		at, err := events.ParseTime(date, time.Now())
+		if err != nil {
+			fmt.Println(errorStyle.Render("Error: " + err.Error()))
+			return utils.ExitUsage
+		}
+		old, verified, err := inventory.At(infraRoot, at)
+		if err != nil {
+			fmt.Println(errorStyle.Render("Error: " + err.Error()))
+			return utils.ExitError
+		}
+		if !verified {
+			fmt.Println(warningStyle.Render("  Warning: the record's signature does not match; it was edited after servctl wrote it"))
+		}
+		fmt.Println(descStyle.Render(fmt.Sprintf("  Since %s (%s):", old.Time.Format("2006-01-02 15:04"), old.Reason)))
+		changes := inventory.Diff(old, current)
+		if len(changes) == 0 {
+			fmt.Println(successStyle.Render("  ✓ Nothing changed"))
+		}
+		for _, c := range changes {
+			switch {
+			case c.Old == "":
+				fmt.Printf("  + %-30s %s\n", c.What, c.New)
+			case c.New == "":
+				fmt.Printf("  - %-30s %s\n", c.What, c.Old)
+			default:
+				fmt.Printf("  ~ %-30s %s → %s\n", c.What, c.Old, c.New)
+			}
+		}
+
+	default:
+		fmt.Println(errorStyle.Render("Unknown action " + action + ": use -inventory show or -inventory diff DATE"))
+		return utils.ExitUsage
+	}
+	fmt.Println()
+	return utils.ExitOK
+}
+
+// setupCapacity is the memory and the free space on the data root's disk
+// the service selection is weighed against
+func setupCapacity(dataRoot string) directory.Capacity {
+	capacity := directory.Capacity{TotalRAM: storage.GetSystemInfo().TotalRAM}
+	if usage, err := status.DiskUsage(storage.MountPointOf(dataRoot)); err == nil {
+		capacity.DataFree = usage.Free
+	}
+	return capacity
+}
+
+// validateServiceRoot refuses a per-service root that is not a mounted
+// data drive: the system disk, the backup drive, or inside the data root
+func validateServiceRoot(root, dataRoot, backupMount string) error {
+	if !filepath.IsAbs(root) {
+		return fmt.Errorf("%s is not an absolute path", root)
+	}
+	if root == dataRoot || strings.HasPrefix(root, dataRoot+"/") || strings.HasPrefix(dataRoot, root+"/") {
+		return fmt.Errorf("%s overlaps the data root %s", root, dataRoot)
+	}
+	mount := storage.MountPointOf(root)
+	if mount == "/" {
+		return fmt.Errorf("%s is on the system disk; mount a data drive first (Phase 2)", root)
+	}
+	if storage.IsMountPoint(backupMount) && mount == backupMount {
+		return fmt.Errorf("%s is on the backup drive %s", root, backupMount)
+	}
+	return nil
+}
+
+// ensureMountedDirectories creates any directory the compose file mounts
+// that the Phase 3 selection left out, so Docker never creates one as root.
+// In speed-tiered setups hot data is linked to fast storage first.
+func ensureMountedDirectories(config *compose.ServiceConfig, dryRun bool) {
+	owner, err := directory.GetOwnerInfo()
+	if err != nil {
+		fmt.Println(warningStyle.Render("Warning: " + err.Error()))
+	}
+
+	// Relocated hot data first, so its canonical paths become symlinks
+	// rather than empty directories
+	if config.FastRoot != "" {
+		for _, link := range directory.TierLinks(config.DataRoot, config.FastRoot, config.MountedPaths()) {
+			if r := directory.ApplyTierLink(link, owner, dryRun); r.Error != nil {
+				fmt.Println(warningStyle.Render("Warning: " + r.Error.Error()))
 			}
-			fmt.Println(successStyle.Render(fmt.Sprintf("  ✓ Generated %d scripts in %s", len(scripts), scriptsDir)))
-		} else {
-			fmt.Println(warningStyle.Render("[DRY RUN] Would generate scripts in " + scriptsDir))
 		}
-	} else {
-		fmt.Println(descStyle.Render("  No scripts selected."))
 	}
 
-	// Final Summary - Mission Report
+	directory.ServiceRoots = config.ServiceRoots
+	specs := directory.GetPathDirectories(config.DataRoot, config.MountedPaths())
+	results := directory.CreateDirectories(specs, owner, dryRun)
+	if created := directory.CountCreated(results); created > 0 && !dryRun {
+		fmt.Println(descStyle.Render(fmt.Sprintf("Created %d more directories mounted by Docker Compose", created)))
+	}
+	for _, r := range results {
+		if r.Error != nil {
+			fmt.Println(warningStyle.Render("Warning: " + r.Error.Error()))
+		}
+	}
+}
+
+// runImagePrePull estimates the image download against free disk space,
+// then pulls every image in parallel so the first start is not a silent wait.
+// It returns an error when the pull was attempted and failed.
+func runImagePrePull(composeDir string, dryRun bool) error {
 	fmt.Println()
+	fmt.Println(titleStyle.Render("📥 Image Pre-pull"))
 
-	missionReport := report.NewMissionReport(config, infraRoot)
-	missionReport.DirsCreated = len(allDirs)
-	missionReport.ScriptsGen = len(scripts)
+	// The compose file a dry run would have written is not on disk to read
+	description := fmt.Sprintf("estimate the download size and pull images, %d at a time", bootstrap.PullConcurrency)
+	return ops.Execute(dryRun, ops.Func{Description: description, Fn: func() error {
+		images, err := bootstrap.ComposeImages(filepath.Join(composeDir, "docker-compose.yml"))
+		if err != nil {
+			fmt.Println(warningStyle.Render("  Warning: " + err.Error()))
+			return err
+		}
 
-	if dryRun {
-		fmt.Print(report.RenderCompactReport(missionReport))
-		fmt.Println()
-		fmt.Println(warningStyle.Render("DRY RUN complete. No actual changes were made."))
-	} else {
-		fmt.Print(report.RenderMissionReport(missionReport))
-	}
+		fmt.Println(descStyle.Render("  Checking image sizes..."))
+		estimate := bootstrap.EstimatePull(images)
 
-	// Log completion
-	if logger != nil {
-		logger.Info("Setup completed successfully")
-	}
+		present := 0
+		for _, img := range estimate.Images {
+			if img.Present {
+				present++
+			}
+		}
+		fmt.Printf("  Images:   %d (%d already downloaded)\n", len(images), present)
+		download := "~" + storage.FormatBytes(estimate.DownloadBytes)
+		if estimate.Unknown > 0 {
+			download += fmt.Sprintf(" (+%d of unknown size)", estimate.Unknown)
+		}
+		fmt.Printf("  Download: %s\n", download)
+		fmt.Printf("  Time:     ~%s at 50 Mbit/s, ~%s at 500 Mbit/s\n", estimate.DownloadTime(50), estimate.DownloadTime(500))
+		if estimate.DockerRoot != "" {
+			fmt.Printf("  Disk:     ~%s needed, %s free on %s\n",
+				storage.FormatBytes(estimate.DiskNeeded()), storage.FormatBytes(estimate.DiskFree), estimate.DockerRoot)
+		}
+
+		if !estimate.Fits() {
+			fmt.Println(errorStyle.Render("  ✗ Not enough space for the images under " + estimate.DockerRoot))
+			if !promptContinue("Pull anyway?") {
+				return nil
+			}
+		} else if !promptContinue("Pull images now?") {
+			fmt.Println(descStyle.Render("  Images will be pulled on first start instead."))
+			return nil
+		}
+
+		r := bootstrap.PrePullImages(images, false)
+		if !r.Success {
+			fmt.Println(errorStyle.Render("  ✗ " + r.Message))
+			return fmt.Errorf("%s", r.Message)
+		}
+		fmt.Println(successStyle.Render("  ✓ " + r.Message))
+		return nil
+	}})
 }
 
-func runStatusCommand() {
-	fmt.Println()
-	fmt.Println(sectionStyle.Render("📊 System Status"))
-	fmt.Println()
+// recorder is the setup session being recorded, nil when there is none
+var recorder *recording.Session
 
-	// Docker status
-	fmt.Println(titleStyle.Render("Docker Containers:"))
-	fmt.Println()
+// promptRecordSession asks whether to record the setup wizard
+func promptRecordSession(infraRoot string) bool {
+	fmt.Printf("Record this session to %s for later review (passwords masked)? [y/N]: ",
+		filepath.Join(infraRoot, recording.SessionFile))
+	response, _ := promptReader().ReadString('\n')
+	response = strings.TrimSpace(strings.ToLower(response))
+	return response == "y" || response == "yes"
+}
 
-	cmd := exec.Command("docker", "ps", "--format", "table {{.Names}}\t{{.Status}}\t{{.Ports}}")
-	output, err := cmd.Output()
-	if err != nil {
-		fmt.Println(warningStyle.Render("Docker not available or no containers running"))
-	} else {
-		fmt.Println(string(output))
+// isDeliveryMode reports whether mode is a valid -credentials value
+func isDeliveryMode(mode string) bool {
+	for _, m := range report.DeliveryModes {
+		if mode == m {
+			return true
+		}
 	}
+	return false
+}
 
-	// Disk usage
-	fmt.Println(titleStyle.Render("Disk Usage:"))
-	fmt.Println()
+// deliverCredentials hands the credentials over as chosen with -credentials
+// instead of printing them, for terminals that may be recorded or reached
+// over an unencrypted serial line. When that fails they are printed after
+// all, so they are never lost. A link is returned for the caller to serve
+// once the report is on screen.
+func deliverCredentials(r *report.MissionReport, mode, infraRoot string) (*report.OneTimeLink, *utils.ServctlError) {
+	text := report.CredentialsText(r)
 
-	paths := []string{"/mnt/data", "/mnt/backup", "/"}
-	for _, path := range paths {
-		var stat struct {
-			Total uint64
-			Free  uint64
+	switch mode {
+	case report.DeliverFile:
+		enc, err := report.WriteEncryptedCredentials(filepath.Join(infraRoot, report.CredentialsFile), text)
+		if err != nil {
+			return nil, setupFailure(phaseBootstrap, "Encrypt credentials", err,
+				"Install age or openssl, or use -credentials print")
 		}
-		// Simple check if path exists
-		if _, err := os.Stat(path); err == nil {
-			cmd := exec.Command("df", "-h", path)
-			output, _ := cmd.Output()
-			lines := strings.Split(string(output), "\n")
-			if len(lines) > 1 {
-				fmt.Printf("  %s: %s\n", path, strings.TrimSpace(lines[1]))
-			}
+		recorder.Mask(enc.Key)
+		fmt.Println(report.RenderEncryptedCredentials(enc))
+		if cmd := session.CopyCommand(enc.Path); cmd != "" {
+			fmt.Println(descStyle.Render("  On your computer: " + cmd))
+		}
+		fmt.Println()
+		r.CredentialsDelivered = "encrypted in " + enc.Path
+	case report.DeliverLink:
+		link, err := report.ServeOnce(r.HostIP, text)
+		if err != nil {
+			return nil, setupFailure(phaseBootstrap, "Serve credentials link", err,
+				"Use -credentials file, or print them with -credentials print")
 		}
-		_ = stat // avoid unused warning
+		recorder.Mask(link.URL)
+		r.CredentialsDelivered = "served once at the link below"
+		return link, nil
 	}
-	fmt.Println()
+	return nil, nil
+}
 
-	// SMART status (if available)
-	fmt.Println(titleStyle.Render("Drive Health:"))
-	fmt.Println()
+// renderPrivilegedOps lists the operations that will run with sudo, grouped by phase
+func renderPrivilegedOps(ops []preflight.PrivilegedOp) string {
+	var b strings.Builder
+	b.WriteString(titleStyle.Render("🔐 This setup uses sudo to:") + "\n")
 
-	smartCmd := exec.Command("sudo", "smartctl", "--scan")
-	smartOutput, err := smartCmd.Output()
-	if err != nil {
-		fmt.Println(descStyle.Render("SMART not available (try running with sudo)"))
-	} else {
-		drives := strings.Split(strings.TrimSpace(string(smartOutput)), "\n")
-		for _, drive := range drives {
-			parts := strings.Fields(drive)
-			if len(parts) > 0 {
-				healthCmd := exec.Command("sudo", "smartctl", "-H", parts[0])
-				healthOutput, _ := healthCmd.Output()
-				if strings.Contains(string(healthOutput), "PASSED") {
-					fmt.Printf("  %s: %s\n", parts[0], successStyle.Render("PASSED"))
-				} else {
-					fmt.Printf("  %s: %s\n", parts[0], warningStyle.Render("CHECK REQUIRED"))
-				}
+	lastPhase := ""
+	for _, op := range ops {
+		if op.Phase != lastPhase {
+			b.WriteString("  " + op.Phase + "\n")
+			lastPhase = op.Phase
+		}
+		b.WriteString(descStyle.Render("    • "+op.Description) + "\n")
+	}
+	return b.String()
+}
+
+// renderTimings summarizes how long the setup took: each phase, the time
+// spent on prompts, the commands that took more than a few seconds, and
+// anything that took much longer than usual
+func renderTimings(entries []timing.Entry) string {
+	if len(entries) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("\n" + titleStyle.Render("⏱  Setup Timing:") + "\n")
+	for _, e := range entries {
+		switch {
+		case e.Kind == timing.KindPhase:
+			line := fmt.Sprintf("  %-24s %s", e.Name, timing.Round(e.Duration()))
+			if e.Waited >= 1 {
+				line += descStyle.Render(fmt.Sprintf("  (%s on prompts)", timing.Round(e.Duration()-e.Working())))
 			}
+			b.WriteString(line + "\n")
+		case e.Duration() >= 5*time.Second:
+			b.WriteString(descStyle.Render(fmt.Sprintf("    %s: %s", e.Name, timing.Round(e.Duration()))) + "\n")
 		}
 	}
-	fmt.Println()
+	b.WriteString(fmt.Sprintf("  %-24s %s\n", "Total", timing.Round(timing.Total(entries))))
+	for _, finding := range timing.Abnormal(entries) {
+		b.WriteString(warningStyle.Render("  ⚠ "+finding) + "\n")
+	}
+	return b.String()
 }
 
-func runGetConfigCommand() {
-	fmt.Println()
-	fmt.Println(sectionStyle.Render("⚙️  Current Configuration"))
-	fmt.Println()
+// packageProgress redraws package manager progress in place on one line
+type packageProgress struct {
+	width int
+}
 
-	currentUser, _ := user.Current()
-	homeDir := currentUser.HomeDir
-	composeDir := filepath.Join(homeDir, "infra", "compose")
+func (pp *packageProgress) update(p pkgmgr.Progress) {
+	line := tui.RenderPackageProgress(p)
+	w := lipgloss.Width(line)
+	fmt.Print("\r" + line + strings.Repeat(" ", max(0, pp.width-w)))
+	pp.width = w
+}
 
-	// Read .env
-	envPath := filepath.Join(composeDir, ".env")
-	if content, err := os.ReadFile(envPath); err == nil {
-		fmt.Println(titleStyle.Render(".env Configuration:"))
-		fmt.Println()
+// clear erases the progress line so regular output can continue
+func (pp *packageProgress) clear() {
+	if pp.width > 0 {
+		fmt.Print("\r" + strings.Repeat(" ", pp.width) + "\r")
+		pp.width = 0
+	}
+}
 
-		// Mask passwords
-		lines := strings.Split(string(content), "\n")
-		for _, line := range lines {
-			if strings.Contains(strings.ToUpper(line), "PASSWORD") ||
-				strings.Contains(strings.ToUpper(line), "SECRET") ||
-				strings.Contains(strings.ToUpper(line), "TOKEN") {
-				parts := strings.SplitN(line, "=", 2)
-				if len(parts) == 2 {
-					fmt.Printf("  %s=%s\n", parts[0], strings.Repeat("*", len(parts[1])))
-				}
-			} else if strings.TrimSpace(line) != "" && !strings.HasPrefix(line, "#") {
-				fmt.Printf("  %s\n", line)
-			}
+// setupFanControl offers to drive the case fans from the hottest drive's
+// temperature with fancontrol, on boards whose fan outputs Linux can control
+func setupFanControl(reader *bufio.Reader, dryRun bool) error {
+	fans, sensors := storage.DetectFanControl()
+	if len(fans) == 0 {
+		fmt.Println(titleStyle.Render("Fan Control:"))
+		for _, line := range storage.FanControlAdvice() {
+			fmt.Println(descStyle.Render("  " + line))
 		}
 		fmt.Println()
-	} else {
-		fmt.Println(warningStyle.Render("No .env file found at " + envPath))
+		return nil
 	}
 
-	// Check docker-compose.yml
-	composePath := filepath.Join(composeDir, "docker-compose.yml")
-	if _, err := os.Stat(composePath); err == nil {
-		fmt.Println(successStyle.Render("✓ docker-compose.yml exists"))
-		fmt.Printf("  Path: %s\n", composePath)
-	} else {
-		fmt.Println(warningStyle.Render("No docker-compose.yml found"))
-	}
+	fmt.Println(titleStyle.Render("Fan Control:"))
+	fmt.Printf("  Found %d controllable fan output(s) on %s.\n", len(fans), fans[0].Chip)
+	fmt.Println("  fancontrol can speed them up with the drives: minimum speed up to 35°C,")
+	fmt.Println("  full speed from 45°C. Fans never stop completely.")
+	fmt.Print("  Configure fancontrol? [y/N]: ")
+	response, _ := reader.ReadString('\n')
+	response = strings.TrimSpace(strings.ToLower(response))
 	fmt.Println()
-}
+	if response != "y" && response != "yes" {
+		return nil
+	}
 
-func runGetArchitectureCommand() {
-	fmt.Println()
-	fmt.Println(sectionStyle.Render("🏗️  System Architecture"))
+	if len(sensors) == 0 {
+		if err := storage.EnableDriveTempSensors(dryRun); err != nil {
+			return err
+		}
+	}
+
+	var steps []ops.Operation
+	if _, err := exec.LookPath("fancontrol"); err != nil {
+		steps = append(steps, installOp("fancontrol"))
+	}
+	// The curve follows a sensor that only appears once drivetemp is loaded
+	steps = append(steps, ops.Func{
+		Description: "write " + storage.FancontrolConfigPath + " for the hottest drive and restart fancontrol",
+		Fn: func() error {
+			if len(sensors) == 0 {
+				_, sensors = storage.DetectFanControl()
+			}
+			sensor, ok := storage.HottestSensor(sensors)
+			if !ok {
+				return fmt.Errorf("no drive temperature sensors after loading drivetemp (drives behind USB or RAID controllers are not supported)")
+			}
+			if err := storage.ConfigureFancontrol(fans, sensor, false); err != nil {
+				return err
+			}
+			fmt.Println(successStyle.Render("  ✓ ") + fmt.Sprintf("Fans follow %s (%d°C now)", sensor.ID(), sensor.Celsius))
+			return nil
+		},
+	})
+	if err := ops.Execute(dryRun, steps...); err != nil {
+		return err
+	}
 	fmt.Println()
+	return nil
+}
 
-	currentUser, _ := user.Current()
-	homeDir := currentUser.HomeDir
+// installOp installs packages with the system package manager
+func installOp(packages ...string) ops.Operation {
+	return ops.Func{Description: "install " + strings.Join(packages, ", "), Fn: func() error {
+		_, err := pkgmgr.Default().Install(packages, nil)
+		return err
+	}}
+}
 
-	// Directory tree
-	fmt.Print(tui.RenderDirectoryTree(homeDir, "/mnt/data"))
-	fmt.Println()
+// setupUPS offers to monitor a USB-connected UPS with Network UPS Tools, so
+// the server stops the containers and powers off before the battery runs out
+func setupUPS(reader *bufio.Reader, config *compose.ServiceConfig, dryRun bool) error {
+	devices := ups.Detect()
+	if len(devices) == 0 {
+		return nil
+	}
+	device := devices[0]
 
-	// Service relationships
-	fmt.Println(titleStyle.Render("Service Relationships:"))
+	fmt.Println(titleStyle.Render("UPS:"))
+	fmt.Printf("  Found %s.\n", device)
+	fmt.Println("  NUT can watch its battery: when it runs low, the containers are stopped,")
+	fmt.Println("  disks are synced and the server powers off cleanly.")
+	fmt.Print("  Configure UPS monitoring? [y/N]: ")
+	response, _ := reader.ReadString('\n')
+	response = strings.TrimSpace(strings.ToLower(response))
 	fmt.Println()
+	if response != "y" && response != "yes" {
+		return nil
+	}
 
-	services := `
-  ┌─────────────────────────────────────────────────────────────┐
-  │                     servctl-network                         │
-  ├─────────────────────────────────────────────────────────────┤
-  │                                                             │
-  │  ┌─────────────┐    ┌─────────────┐    ┌─────────────┐     │
-  │  │   Immich    │───▶│    Redis    │    │  Nextcloud  │     │
-  │  │   :2283     │    │   (cache)   │    │   :8080     │     │
-  │  └──────┬──────┘    └─────────────┘    └──────┬──────┘     │
-  │         │                                      │            │
-  │         ▼                                      ▼            │
-  │  ┌─────────────┐                        ┌─────────────┐     │
-  │  │ PostgreSQL  │                        │  MariaDB    │     │
-  │  │  (Immich)   │                        │ (Nextcloud) │     │
-  │  └─────────────┘                        └─────────────┘     │
-  │                                                             │
-  │  ┌─────────────┐    ┌─────────────┐                        │
-  │  │   Glances   │    │    Diun     │                        │
-  │  │   :61208    │    │  (updates)  │                        │
-  │  └─────────────┘    └─────────────┘                        │
-  │                                                             │
-  └─────────────────────────────────────────────────────────────┘
-`
-	fmt.Println(services)
-}
+	opts := ups.Options{
+		Device:      device,
+		MonPassword: compose.GeneratePassword(24),
+	}
+	install := func(packages []string) error {
+		_, err := pkgmgr.Default().Install(packages, nil)
+		return err
+	}
+	if err := ups.Configure(opts, install, dryRun); err != nil {
+		return err
+	}
+	if dryRun {
+		return nil
+	}
 
-func runManualBackupCommand() {
-	fmt.Println()
-	fmt.Println(sectionStyle.Render("💾 Manual Backup"))
+	config.UPS = ups.Address
+	if err := compose.SaveState(config, false); err != nil {
+		return err
+	}
+	fmt.Println(successStyle.Render("  ✓ ") + "UPS: " + ups.Query(ups.Address).Summary())
 	fmt.Println()
+	return nil
+}
 
-	currentUser, _ := user.Current()
-	homeDir := currentUser.HomeDir
-	scriptPath := filepath.Join(homeDir, "infra", "scripts", "daily_backup.sh")
+// setupSysctl offers the kernel parameters tuned for a home server, showing
+// what each changes from and why. It returns what servctl has changed so
+// far, merged with earlier runs, for the state file.
+func setupSysctl(infraRoot string, dryRun bool) (*compose.SysctlRecord, error) {
+	rec := &compose.SysctlRecord{DropIn: preflight.SysctlDropIn, Previous: make(map[string]string)}
+	if prev, err := compose.LoadState(infraRoot); err == nil && prev.Sysctl != nil {
+		rec = prev.Sysctl
+	}
+	if rec.Previous == nil {
+		rec.Previous = make(map[string]string)
+	}
+	// The preflight auto-fix may already have raised the inotify limits
+	for key, value := range preflight.SysctlDropInPrevious() {
+		if _, ok := rec.Previous[key]; !ok {
+			rec.Previous[key] = value
+		}
+	}
+	keep := func() *compose.SysctlRecord {
+		if len(rec.Previous) == 0 {
+			return nil
+		}
+		return rec
+	}
 
-	if _, err := os.Stat(scriptPath); os.IsNotExist(err) {
-		fmt.Println(errorStyle.Render("Backup script not found: " + scriptPath))
-		fmt.Println(descStyle.Render("Run 'servctl -start-setup' first to generate maintenance scripts."))
-		return
+	changes := preflight.PlanSysctl(preflight.TunedSysctls())
+	fmt.Println(titleStyle.Render("Kernel Tuning:"))
+	if len(changes) == 0 {
+		fmt.Println(successStyle.Render("  ✓ ") + "Kernel parameters already suit a home server")
+		fmt.Println()
+		return keep(), nil
+	}
+	for _, c := range changes {
+		fmt.Printf("  %-32s %s → %s\n", c.Key, c.Current, c.Value)
+		fmt.Println(descStyle.Render("    " + c.Reason))
+	}
+	if !promptContinue("Write these to " + preflight.SysctlDropIn + "?") {
+		fmt.Println()
+		return keep(), nil
 	}
 
-	fmt.Println("Running backup script...")
-	fmt.Println(descStyle.Render("Script: " + scriptPath))
+	previous, err := preflight.ApplySysctl(changes, dryRun)
+	if err != nil {
+		return keep(), err
+	}
+	for key, value := range previous {
+		if _, ok := rec.Previous[key]; !ok {
+			rec.Previous[key] = value
+		}
+	}
+	fmt.Println(successStyle.Render("  ✓ ") + fmt.Sprintf("%d kernel parameter(s) tuned", len(changes)))
 	fmt.Println()
+	return keep(), nil
+}
 
-	cmd := exec.Command("sudo", "bash", scriptPath)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+// runSurfaceScan offers a badblocks scan of the disks and runs the chosen
+// one. It returns the scans to record; a dry run or a skipped scan records
+// none.
+func runSurfaceScan(reader *bufio.Reader, disks []storage.Disk, dryRun bool) []storage.SurfaceScan {
+	mode := chooseSurfaceScan(reader, disks, dryRun)
+	if mode == "" {
+		return nil
+	}
+	return scanDisks(disks, mode)
+}
 
-	if err := cmd.Run(); err != nil {
-		fmt.Println()
-		fmt.Println(errorStyle.Render("Backup failed: " + err.Error()))
-	} else {
-		fmt.Println()
-		fmt.Println(successStyle.Render("✅ Backup completed successfully!"))
+// chooseSurfaceScan asks which scan to run, and for each disk's erase
+// confirmation before a destructive one. It returns the mode, or "" when
+// the scan is skipped or only previewed.
+func chooseSurfaceScan(reader *bufio.Reader, disks []storage.Disk, dryRun bool) string {
+	mode := storage.PromptSurfaceScan(reader, disks)
+	if mode == "" {
+		fmt.Println(descStyle.Render("  Skipping the surface scan."))
+		return ""
+	}
+	if dryRun {
+		// The scans run under scanDisks with their progress; a dry run lists them
+		var scans []ops.Operation
+		for _, d := range disks {
+			scans = append(scans, ops.Command{Args: storage.SurfaceScanArgs(d, mode)})
+		}
+		ops.Execute(dryRun, scans...)
+		return ""
+	}
+	if mode == storage.ScanDestructive {
+		for _, d := range disks {
+			if !storage.PromptEraseConfirmation(reader, d) {
+				fmt.Println(warningStyle.Render("  Surface scan cancelled."))
+				return ""
+			}
+		}
 	}
+	return mode
 }
 
-func runLogsCommand() {
+// scanDisks runs the surface scans side by side, showing every disk's
+// progress on one line, and prints each disk's outcome
+func scanDisks(disks []storage.Disk, mode string) []storage.SurfaceScan {
 	fmt.Println()
-	fmt.Println(sectionStyle.Render("📋 Service Logs"))
+	lastWidth := 0
+	scans := storage.RunSurfaceScans(disks, mode, func(done []float64) {
+		line := storage.RenderScanProgress(disks, done)
+		fmt.Printf("\r%-*s", lastWidth, line)
+		lastWidth = len(line)
+	})
 	fmt.Println()
+	for _, s := range scans {
+		switch {
+		case s.Error != "":
+			fmt.Println(warningStyle.Render(fmt.Sprintf("  ⚠ %s: scan did not finish: %s", s.Path, s.Error)))
+		case s.BadBlocks > 0:
+			fmt.Println(errorStyle.Render(fmt.Sprintf("  ✗ %s: %d bad blocks", s.Path, s.BadBlocks)))
+		default:
+			fmt.Println(successStyle.Render(fmt.Sprintf("  ✓ %s: no bad blocks (%s)", s.Path, s.Duration)))
+		}
+	}
+	return scans
+}
 
-	currentUser, _ := user.Current()
-	homeDir := currentUser.HomeDir
-	composeDir := filepath.Join(homeDir, "infra", "compose")
-
-	// Check if docker-compose.yml exists
-	if _, err := os.Stat(filepath.Join(composeDir, "docker-compose.yml")); os.IsNotExist(err) {
-		fmt.Println(warningStyle.Render("No docker-compose.yml found"))
-		fmt.Println(descStyle.Render("Run 'servctl -start-setup' first."))
-		return
+// setupPower estimates the server's idle draw and, with root, offers to tune
+// it: powertop auto-tune with PCIe ASPM, and spinning down the drives only
+// backups use. It returns the estimate, with the monthly cost when a price
+// is given, for the mission report.
+func setupPower(reader *bufio.Reader, spindown []storage.Disk, noSudo, dryRun bool) (string, error) {
+	inv, err := advisor.Gather()
+	if err != nil {
+		return "", nil // No estimate without the disk list; nothing to tune either
 	}
+	opts := advisor.PowerOptions{SpunDown: make(map[string]bool)}
 
-	fmt.Println("Showing last 50 lines (Ctrl+C to exit)...")
-	fmt.Println()
+	fmt.Println(titleStyle.Render("Idle Power:"))
+	fmt.Println("  Estimated now: " + advisor.EstimatePower(inv, opts).Summary(0))
 
-	cmd := exec.Command("docker", "compose", "-f",
-		filepath.Join(composeDir, "docker-compose.yml"),
-		"logs", "--tail=50", "-f")
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	ask := func(question string) bool {
+		fmt.Print("  " + question + " [y/N]: ")
+		response, _ := reader.ReadString('\n')
+		response = strings.TrimSpace(strings.ToLower(response))
+		return response == "y" || response == "yes"
+	}
+	install := func(packages []string) error {
+		_, err := pkgmgr.Default().Install(packages, nil)
+		return err
+	}
 
-	// Run interactively
-	cmd.Run()
+	var tuneErr error
+	if !noSudo {
+		if policy := storage.ASPMPolicy(); policy != "" {
+			fmt.Println(descStyle.Render("  PCIe ASPM policy: " + policy))
+		}
+		if ask("Tune for idle power (powertop auto-tune, deepest PCIe ASPM; USB stays awake)?") {
+			if tuneErr = storage.ConfigurePowerTuning(install, dryRun); tuneErr == nil {
+				opts.Tuned = true
+				fmt.Println(successStyle.Render("  ✓ ") + "Tuning applied now and at every boot")
+			}
+		}
+		if len(spindown) > 0 {
+			var names []string
+			for _, d := range spindown {
+				names = append(names, d.Name)
+			}
+			fmt.Println(descStyle.Render("  Data drives keep spinning: the services wake them constantly, and spin-ups wear them."))
+			if ask("Spin down the backup drive (" + strings.Join(names, ", ") + ") after 30 idle minutes between backups?") {
+				if err := storage.ConfigureSpindown(spindown, install, dryRun); err != nil && tuneErr == nil {
+					tuneErr = err
+				} else if err == nil {
+					for _, d := range spindown {
+						opts.SpunDown[d.Name] = true
+					}
+				}
+			}
+		}
+	}
+
+	estimate := advisor.EstimatePower(inv, opts)
+	price := 0.0
+	fmt.Print("  Electricity price per kWh, to estimate the monthly cost [Enter to skip]: ")
+	response, _ := reader.ReadString('\n')
+	if p, err := strconv.ParseFloat(strings.TrimSpace(strings.Replace(response, ",", ".", 1)), 64); err == nil && p > 0 {
+		price = p
+	}
+	summary := estimate.Summary(price)
+	fmt.Println(successStyle.Render("  ✓ ") + summary)
+	fmt.Println()
+	return summary, tuneErr
 }
 
 // promptContinue asks user to continue and returns true if yes
 func promptContinue(message string) bool {
 	fmt.Printf("\n%s [Y/n]: ", message)
-	reader := bufio.NewReader(os.Stdin)
+	reader := promptReader()
 	response, _ := reader.ReadString('\n')
 	response = strings.TrimSpace(strings.ToLower(response))
 	return response == "" || response == "y" || response == "yes"
 }
+
+// runMaintenanceValidate checks the scripts in ~/infra/scripts and the cron
+// jobs after they were edited by hand
+func runMaintenanceValidate() int {
+	fmt.Println()
+	fmt.Println(sectionStyle.Render("🩺 Maintenance Script Check"))
+	fmt.Println()
+
+	owner, err := directory.GetOwnerInfo()
+	if err != nil {
+		fmt.Println(errorStyle.Render("Error: " + err.Error()))
+		return utils.ExitError
+	}
+	infraRoot := filepath.Join(owner.HomeDir, "infra")
+	mConfig, err := maintenance.LoadConfig(infraRoot)
+	if err != nil {
+		fmt.Println(errorStyle.Render("Error: " + err.Error()))
+		return utils.ExitNotConfigured
+	}
+	scriptsDir := filepath.Join(infraRoot, "scripts")
+	issues, err := maintenance.ValidateScripts(mConfig, scriptsDir, maintenance.CronFilePath)
+	if err != nil {
+		fmt.Println(errorStyle.Render("Error: " + err.Error()))
+		return utils.ExitError
+	}
+
+	failures := 0
+	for _, issue := range issues {
+		if issue.Warning {
+			fmt.Println(warningStyle.Render("  ⚠ " + issue.String()))
+			continue
+		}
+		fmt.Println(errorStyle.Render("  ✗ " + issue.String()))
+		failures++
+	}
+	if len(issues) > 0 {
+		fmt.Println()
+	}
+	if failures > 0 {
+		fmt.Println(errorStyle.Render(fmt.Sprintf("  %d problem(s) will make scheduled jobs fail.", failures)))
+		fmt.Println(descStyle.Render("  Fix the scripts, or run 'servctl -start-setup -only maintenance' to regenerate them."))
+		fmt.Println()
+		return utils.ExitError
+	}
+	fmt.Println(successStyle.Render("  ✓ Scripts in " + scriptsDir + " parse and their jobs are scheduled"))
+	fmt.Println()
+	return utils.ExitOK
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseSetupPhases(t *testing.T) {
+	tests := []struct {
+		only, skip string
+		want       []string // nil: every phase
+		err        string
+	}{
+		{"", "", nil, ""},
+		{"bootstrap", "", []string{"bootstrap"}, ""},
+		{"Services, storage", "", []string{"storage", "services"}, ""},
+		{"preflight,dirs,compose,scripts,start", "", []string{"preparation", "directories", "services", "maintenance", "bootstrap"}, ""},
+		{"system", "", []string{"preparation"}, ""},
+		{"", "storage,start", []string{"preparation", "directories", "services", "maintenance"}, ""},
+		{"", "preflight, ,dirs", []string{"storage", "services", "maintenance", "bootstrap"}, ""},
+		{"network", "", nil, `unknown setup phase "network"`},
+		{"", "storage,backups", nil, `unknown setup phase "backups"`},
+		{"bootstrap", "storage", nil, "not both"},
+		{",", "", nil, "no setup phase named"},
+		{"", "preparation,storage,directories,services,maintenance,bootstrap", nil, "no phase to run"},
+		{"", "system,preflight,storage,dirs,compose,scripts,start", nil, "no phase to run"},
+	}
+	for _, tt := range tests {
+		phases, err := parseSetupPhases(tt.only, tt.skip)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("parseSetupPhases(%q, %q) error = %v, want %q", tt.only, tt.skip, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseSetupPhases(%q, %q) error = %v", tt.only, tt.skip, err)
+			continue
+		}
+		want := tt.want
+		if want == nil {
+			if phases != nil {
+				t.Errorf("parseSetupPhases(%q, %q) = %v, want nil for every phase", tt.only, tt.skip, phases.names())
+			}
+			want = setupPhaseNames()
+		}
+		if got := phases.names(); !slices.Equal(got, want) {
+			t.Errorf("parseSetupPhases(%q, %q) = %v, want %v", tt.only, tt.skip, got, want)
+		}
+	}
+}
+
+func TestPhaseSet_Runs(t *testing.T) {
+	var all phaseSet
+	for _, p := range setupPhases {
+		if !all.runs(p.phase) {
+			t.Errorf("A nil phase set should run %s", p.phase)
+		}
+	}
+
+	only := phaseSet{phaseBootstrap: true}
+	if !only.runs(phaseBootstrap) || only.runs(phaseStorage) {
+		t.Errorf("phaseSet{bootstrap} runs bootstrap=%v storage=%v, want true and false", only.runs(phaseBootstrap), only.runs(phaseStorage))
+	}
+}
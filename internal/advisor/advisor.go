@@ -0,0 +1,325 @@
+// Package advisor inventories the machine before setup and recommends
+// hardware changes for 'servctl -advise'. Storage advice runs the wizard's
+// strategy engine on the disks found, and on them plus a hypothetical disk,
+// to show which layouts an extra drive would make possible. Nothing is
+// changed on the machine.
+package advisor
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/madhav/servctl/internal/compose"
+	"github.com/madhav/servctl/internal/storage"
+)
+
+// Roots of the files the inventory is read from; tests point them at fakes
+var (
+	procRoot   = "/proc"
+	netRoot    = "/sys/class/net"
+	renderNode = "/dev/dri/renderD128"
+)
+
+// NIC is a physical network interface
+type NIC struct {
+	Name      string
+	SpeedMbps int  // Negotiated link speed, 0 when down or unknown
+	Wireless  bool // Wi-Fi
+}
+
+// Inventory is the hardware the advice is based on
+type Inventory struct {
+	CPUModel string
+	Cores    int
+	TotalRAM uint64 // Bytes
+	Disks    []storage.Disk
+	NICs     []NIC
+	GPU      bool // A render node for hardware video transcoding
+}
+
+// Gather inventories this machine
+func Gather() (*Inventory, error) {
+	inv := &Inventory{Cores: runtime.NumCPU()}
+	inv.CPUModel, inv.Cores = readCPU(inv.Cores)
+	inv.TotalRAM = readMemTotal()
+
+	disks, err := storage.DiscoverDisks()
+	if err != nil {
+		return nil, fmt.Errorf("disk discovery failed: %w", err)
+	}
+	inv.Disks = disks
+	inv.NICs = readNICs()
+	if _, err := os.Stat(renderNode); err == nil {
+		inv.GPU = true
+	}
+	return inv, nil
+}
+
+// readCPU returns the CPU model and logical core count from /proc/cpuinfo
+func readCPU(fallbackCores int) (string, int) {
+	f, err := os.Open(filepath.Join(procRoot, "cpuinfo"))
+	if err != nil {
+		return "", fallbackCores
+	}
+	defer f.Close()
+
+	model, cores := "", 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		switch strings.TrimSpace(key) {
+		case "processor":
+			cores++
+		case "model name", "Model", "Hardware":
+			if model == "" {
+				model = strings.TrimSpace(value)
+			}
+		}
+	}
+	if cores == 0 {
+		cores = fallbackCores
+	}
+	return model, cores
+}
+
+// readMemTotal returns MemTotal from /proc/meminfo in bytes
+func readMemTotal() uint64 {
+	data, err := os.ReadFile(filepath.Join(procRoot, "meminfo"))
+	if err != nil {
+		return 0
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[0] == "MemTotal:" {
+			kb, _ := strconv.ParseUint(fields[1], 10, 64)
+			return kb * 1024
+		}
+	}
+	return 0
+}
+
+// readNICs lists physical interfaces: those backed by a device, which
+// leaves out lo, bridges, veths and VPN tunnels
+func readNICs() []NIC {
+	dirs, _ := filepath.Glob(filepath.Join(netRoot, "*"))
+	sort.Strings(dirs)
+
+	var nics []NIC
+	for _, dir := range dirs {
+		if _, err := os.Stat(filepath.Join(dir, "device")); err != nil {
+			continue
+		}
+		nic := NIC{Name: filepath.Base(dir)}
+		if _, err := os.Stat(filepath.Join(dir, "wireless")); err == nil {
+			nic.Wireless = true
+		}
+		if data, err := os.ReadFile(filepath.Join(dir, "speed")); err == nil {
+			if speed, err := strconv.Atoi(strings.TrimSpace(string(data))); err == nil && speed > 0 {
+				nic.SpeedMbps = speed
+			}
+		}
+		nics = append(nics, nic)
+	}
+	return nics
+}
+
+// Advice levels, most urgent first
+const (
+	LevelRecommend = "recommend" // Setup works poorly or unsafely without it
+	LevelConsider  = "consider"  // An upgrade worth its price
+	LevelOK        = "ok"        // Fine as is
+)
+
+// Advice is one recommendation
+type Advice struct {
+	Level   string
+	Topic   string   // CPU, Memory, Storage, Network
+	Text    string   // What to do, or what is fine
+	Unlocks []string // Storage strategies or services this would make possible
+}
+
+const gb = 1 << 30
+
+// Advise turns an inventory into recommendations, most urgent first
+func Advise(inv *Inventory) []Advice {
+	var advice []Advice
+	advice = append(advice, adviseMemory(inv)...)
+	advice = append(advice, adviseCPU(inv)...)
+	advice = append(advice, adviseStorage(inv)...)
+	advice = append(advice, adviseNetwork(inv)...)
+
+	rank := map[string]int{LevelRecommend: 0, LevelConsider: 1, LevelOK: 2}
+	sort.SliceStable(advice, func(i, j int) bool { return rank[advice[i].Level] < rank[advice[j].Level] })
+	return advice
+}
+
+// adviseMemory compares RAM with what the services and ML presets need
+func adviseMemory(inv *Inventory) []Advice {
+	ram := fmt.Sprintf("%dGB", (inv.TotalRAM+gb/2)/gb)
+	preset := compose.RecommendMLPreset(inv.TotalRAM)
+
+	switch {
+	case inv.TotalRAM == 0:
+		return nil
+	case inv.TotalRAM < 4*gb:
+		return []Advice{{Level: LevelRecommend, Topic: "Memory",
+			Text:    ram + " RAM is below the 4GB Immich and Nextcloud need together; add RAM (8GB or more)",
+			Unlocks: []string{"Immich and Nextcloud side by side", "Immich ML (small models)"}}}
+	case inv.TotalRAM < 8*gb:
+		return []Advice{{Level: LevelRecommend, Topic: "Memory",
+			Text:    ram + " RAM is marginal for Immich ML: the wizard will suggest the '" + preset + "' models. 8GB runs the default models",
+			Unlocks: []string{"Immich ML (default models)", "Single sign-on (Authentik) alongside ML"}}}
+	case inv.TotalRAM < 16*gb:
+		return []Advice{{Level: LevelConsider, Topic: "Memory",
+			Text:    ram + " RAM runs every service with the '" + preset + "' ML models; 16GB adds headroom for the large ones",
+			Unlocks: []string{"Immich ML (large models)", "ZFS ARC cache for a mirror"}}}
+	}
+	return []Advice{{Level: LevelOK, Topic: "Memory", Text: ram + " RAM is plenty, including the large ML models"}}
+}
+
+// adviseCPU checks core count and hardware transcoding
+func adviseCPU(inv *Inventory) []Advice {
+	var advice []Advice
+	name := inv.CPUModel
+	if name == "" {
+		name = "CPU"
+	}
+	if inv.Cores < 4 {
+		advice = append(advice, Advice{Level: LevelConsider, Topic: "CPU",
+			Text: fmt.Sprintf("%s has %d threads: the first Immich ML and thumbnail run over a large library will take days", name, inv.Cores)})
+	} else {
+		advice = append(advice, Advice{Level: LevelOK, Topic: "CPU", Text: fmt.Sprintf("%s, %d threads", name, inv.Cores)})
+	}
+	if inv.GPU {
+		advice = append(advice, Advice{Level: LevelOK, Topic: "CPU", Text: "A GPU render node is present: Immich can transcode video in hardware"})
+	}
+	return advice
+}
+
+// strategyNames returns the names of the strategies the wizard would offer
+func strategyNames(disks []storage.Disk, inv *Inventory) []string {
+	var names []string
+	for _, s := range storage.GenerateStrategies(disks, storage.SystemInfo{TotalRAM: inv.TotalRAM}) {
+		names = append(names, s.Name)
+	}
+	return names
+}
+
+// unlockedBy returns the strategies offered with extra added that are not
+// offered now
+func unlockedBy(inv *Inventory, extra storage.Disk) []string {
+	now := make(map[string]bool)
+	for _, name := range strategyNames(inv.Disks, inv) {
+		now[name] = true
+	}
+	var unlocked []string
+	for _, name := range strategyNames(append(append([]storage.Disk(nil), inv.Disks...), extra), inv) {
+		if !now[name] {
+			unlocked = append(unlocked, name)
+		}
+	}
+	return unlocked
+}
+
+// hypotheticalDisk is a drive the user could add
+func hypotheticalDisk(diskType storage.DiskType, size uint64) storage.Disk {
+	return storage.Disk{
+		Name: "new", Path: "/dev/new", Size: size, SizeHuman: storage.FormatBytes(size),
+		Type: diskType, Rotational: diskType == storage.DiskTypeHDD, IsAvailable: true,
+	}
+}
+
+// adviseStorage recommends drives by what they would let the wizard set up
+func adviseStorage(inv *Inventory) []Advice {
+	var advice []Advice
+	available := storage.FilterAvailableDisks(inv.Disks)
+
+	if osDisk := storage.GetOSDisk(inv.Disks); osDisk != nil && osDisk.Type == storage.DiskTypeHDD {
+		advice = append(advice, Advice{Level: LevelConsider, Topic: "Storage",
+			Text: "The OS runs from a hard drive (" + osDisk.Name + "): databases and thumbnails will be slow. An SSD boot drive fixes that"})
+	}
+
+	var fast, slow int
+	var largest uint64
+	for _, d := range available {
+		if storage.GetDiskSpeedClass(d) == storage.SpeedClassFast {
+			fast++
+		} else {
+			slow++
+		}
+		if d.Size > largest {
+			largest = d.Size
+		}
+	}
+
+	switch len(available) {
+	case 0:
+		size := uint64(2000e9)
+		advice = append(advice, Advice{Level: LevelRecommend, Topic: "Storage",
+			Text:    "No data drive: photos and files would share the OS drive. Add a " + storage.FormatBytes(size) + " or larger HDD",
+			Unlocks: unlockedBy(inv, hypotheticalDisk(storage.DiskTypeHDD, size))})
+	case 1:
+		d := available[0]
+		advice = append(advice, Advice{Level: LevelRecommend, Topic: "Storage",
+			Text:    fmt.Sprintf("One data drive and nowhere to back it up. Add a %s or larger HDD as a backup drive", d.SizeHuman),
+			Unlocks: unlockedBy(inv, hypotheticalDisk(storage.DiskTypeHDD, d.Size))})
+	default:
+		advice = append(advice, Advice{Level: LevelOK, Topic: "Storage",
+			Text: fmt.Sprintf("%d data drives; the wizard will offer: %s", len(available), strings.Join(strategyNames(inv.Disks, inv), ", "))})
+	}
+
+	// Databases on an SSD, bulk data on HDDs
+	if slow > 0 && fast == 0 {
+		if unlocked := unlockedBy(inv, hypotheticalDisk(storage.DiskTypeSSD, 500e9)); len(unlocked) > 0 {
+			advice = append(advice, Advice{Level: LevelConsider, Topic: "Storage",
+				Text:    "Only hard drives for data: a 500GB SSD for databases and thumbnails makes Immich and Nextcloud feel much faster",
+				Unlocks: unlocked})
+		}
+	}
+
+	if largest > 0 && largest < 1000e9 {
+		advice = append(advice, Advice{Level: LevelConsider, Topic: "Storage",
+			Text: "The largest data drive is " + storage.FormatBytes(largest) + ": a phone's photo library alone can reach that. Plan for 2TB or more"})
+	}
+	return advice
+}
+
+// adviseNetwork checks for a wired gigabit link
+func adviseNetwork(inv *Inventory) []Advice {
+	var wired []NIC
+	for _, n := range inv.NICs {
+		if !n.Wireless {
+			wired = append(wired, n)
+		}
+	}
+	if len(inv.NICs) > 0 && len(wired) == 0 {
+		return []Advice{{Level: LevelRecommend, Topic: "Network",
+			Text: "Only Wi-Fi: uploads, backups and the fixed IP the wizard sets up are all more reliable over Ethernet. Add a wired or USB Ethernet adapter"}}
+	}
+
+	best := 0
+	for _, n := range wired {
+		if n.SpeedMbps > best {
+			best = n.SpeedMbps
+		}
+	}
+	switch {
+	case len(wired) == 0:
+		return nil
+	case best == 0:
+		return []Advice{{Level: LevelConsider, Topic: "Network", Text: "No Ethernet link detected: plug in a cable before setup"}}
+	case best < 1000:
+		return []Advice{{Level: LevelRecommend, Topic: "Network",
+			Text: fmt.Sprintf("The Ethernet link runs at %d Mb/s: check the cable and switch port (gigabit needs all 8 wires)", best)}}
+	}
+	return []Advice{{Level: LevelOK, Topic: "Network", Text: fmt.Sprintf("Wired link at %d Mb/s", best)}}
+}
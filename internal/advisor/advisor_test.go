@@ -0,0 +1,106 @@
+package advisor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/madhav/servctl/internal/storage"
+)
+
+func write(t *testing.T, path, content string) {
+	t.Helper()
+	os.MkdirAll(filepath.Dir(path), 0755)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInventoryFiles(t *testing.T) {
+	oldProc, oldNet := procRoot, netRoot
+	defer func() { procRoot, netRoot = oldProc, oldNet }()
+	procRoot, netRoot = t.TempDir(), t.TempDir()
+
+	write(t, filepath.Join(procRoot, "cpuinfo"), "processor\t: 0\nmodel name\t: Intel(R) N100\n\nprocessor\t: 1\nmodel name\t: Intel(R) N100\n")
+	write(t, filepath.Join(procRoot, "meminfo"), "MemTotal:       16286412 kB\nMemFree:         1000000 kB\n")
+	write(t, filepath.Join(netRoot, "enp1s0", "device", "vendor"), "0x8086\n")
+	write(t, filepath.Join(netRoot, "enp1s0", "speed"), "1000\n")
+	write(t, filepath.Join(netRoot, "wlp2s0", "device", "vendor"), "0x8086\n")
+	write(t, filepath.Join(netRoot, "wlp2s0", "wireless", "x"), "")
+	write(t, filepath.Join(netRoot, "docker0", "speed"), "10000\n")
+
+	if model, cores := readCPU(8); model != "Intel(R) N100" || cores != 2 {
+		t.Errorf("readCPU() = %q, %d", model, cores)
+	}
+	if ram := readMemTotal(); ram != 16286412*1024 {
+		t.Errorf("readMemTotal() = %d", ram)
+	}
+	nics := readNICs()
+	if len(nics) != 2 || nics[0].Name != "enp1s0" || nics[0].SpeedMbps != 1000 || !nics[1].Wireless {
+		t.Errorf("readNICs() = %+v, want enp1s0 and wlp2s0 without docker0", nics)
+	}
+}
+
+// find returns the first advice on topic whose text contains substr
+func find(advice []Advice, topic, substr string) *Advice {
+	for i := range advice {
+		if advice[i].Topic == topic && strings.Contains(advice[i].Text, substr) {
+			return &advice[i]
+		}
+	}
+	return nil
+}
+
+func TestAdvise_BackupDriveUnlocksStrategies(t *testing.T) {
+	inv := &Inventory{
+		Cores:    4,
+		TotalRAM: 16 << 30,
+		Disks: []storage.Disk{
+			{Name: "nvme0n1", Size: 500e9, SizeHuman: "500 GB", Type: storage.DiskTypeNVMe, IsOSDisk: true},
+			{Name: "sda", Size: 4000e9, SizeHuman: "4 TB", Type: storage.DiskTypeHDD, Rotational: true},
+		},
+		NICs: []NIC{{Name: "eth0", SpeedMbps: 1000}},
+	}
+	advice := Advise(inv)
+
+	a := find(advice, "Storage", "backup drive")
+	if a == nil || a.Level != LevelRecommend {
+		t.Fatalf("want a backup drive recommendation, got %+v", advice)
+	}
+	unlocks := strings.Join(a.Unlocks, ", ")
+	for _, want := range []string{"Primary + Nightly Backup", "Mirror"} {
+		if !strings.Contains(unlocks, want) {
+			t.Errorf("Unlocks = %q, want %q", unlocks, want)
+		}
+	}
+	if advice[0].Level != LevelRecommend || advice[len(advice)-1].Level != LevelOK {
+		t.Errorf("advice not ordered by urgency: %+v", advice)
+	}
+}
+
+func TestAdvise_Marginal(t *testing.T) {
+	inv := &Inventory{
+		Cores:    2,
+		TotalRAM: 6 << 30,
+		Disks:    []storage.Disk{{Name: "sda", Size: 256e9, Type: storage.DiskTypeHDD, IsOSDisk: true}},
+		NICs:     []NIC{{Name: "wlan0", Wireless: true}},
+	}
+	advice := Advise(inv)
+
+	for _, c := range []struct{ topic, text, level string }{
+		{"Memory", "marginal for Immich ML", LevelRecommend},
+		{"CPU", "2 threads", LevelConsider},
+		{"Storage", "No data drive", LevelRecommend},
+		{"Storage", "OS runs from a hard drive", LevelConsider},
+		{"Network", "Only Wi-Fi", LevelRecommend},
+	} {
+		a := find(advice, c.topic, c.text)
+		if a == nil || a.Level != c.level {
+			t.Errorf("want %s advice %q at level %s, got %+v", c.topic, c.text, c.level, a)
+		}
+	}
+	if a := find(advice, "Storage", "No data drive"); a != nil && len(a.Unlocks) == 0 {
+		t.Error("a data drive should unlock a strategy")
+	}
+}
@@ -0,0 +1,119 @@
+package advisor
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/madhav/servctl/internal/storage"
+)
+
+// Typical idle draw, in watts, of the parts the estimate adds up. They are
+// ballpark figures from published measurements of home-server hardware;
+// the estimate is meant to be right within a few watts, not exact.
+const (
+	hddActiveWatts  = 5.0 // 3.5" drive spinning, idle
+	hddStandbyWatts = 0.8 // Spun down
+	ssdWatts        = 0.5 // SATA SSD idle
+	nvmeWatts       = 2.0 // NVMe idle without ASPM
+	nvmeTunedWatts  = 0.5 // NVMe in its low-power state once ASPM allows it
+	tunedFactor     = 0.8 // Platform draw after powertop and ASPM tuning
+
+	// Hours a day a spun-down drive still spins, for backups and scrubs
+	spinningHoursPerDay = 2.0
+)
+
+// cpuClasses estimate the platform's idle draw (board, CPU, RAM, fans, PSU
+// losses) from the CPU model, first match wins
+var cpuClasses = []struct {
+	pattern *regexp.Regexp
+	class   string
+	watts   float64
+}{
+	{regexp.MustCompile(`(?i)xeon|epyc|threadripper|opteron`), "server", 45},
+	{regexp.MustCompile(`(?i)\b[NJ]\d{3,4}\b|celeron|atom|pentium (silver|gold [NJ])|cortex|bcm|raspberry|rockchip|\barm`), "low-power", 6},
+	{regexp.MustCompile(`(?i)i[3579]-\d{4,5}(U|T|H|G\d)|ryzen.*\d{4}(U|H|HS|GE)\b`), "mobile or T-series", 10},
+	{regexp.MustCompile(`(?i)core|ryzen`), "desktop", 20},
+}
+
+// PowerItem is one part of the estimate
+type PowerItem struct {
+	Name  string
+	Watts float64
+}
+
+// PowerEstimate is the estimated draw of the server at idle
+type PowerEstimate struct {
+	Items []PowerItem
+	Watts float64
+}
+
+// PowerOptions are the power settings the estimate assumes
+type PowerOptions struct {
+	Tuned    bool            // powertop auto-tune and ASPM applied
+	SpunDown map[string]bool // Drives (by name) that spin down between backups
+}
+
+// EstimatePower estimates the server's idle draw
+func EstimatePower(inv *Inventory, opts PowerOptions) PowerEstimate {
+	var est PowerEstimate
+	add := func(name string, watts float64) {
+		est.Items = append(est.Items, PowerItem{Name: name, Watts: watts})
+		est.Watts += watts
+	}
+
+	class, platform := "unknown", 15.0
+	for _, c := range cpuClasses {
+		if c.pattern.MatchString(inv.CPUModel) {
+			class, platform = c.class, c.watts
+			break
+		}
+	}
+	if opts.Tuned {
+		platform *= tunedFactor
+	}
+	name := strings.TrimSpace(inv.CPUModel)
+	if name == "" {
+		name = "CPU"
+	}
+	add(fmt.Sprintf("Platform (%s, %s)", name, class), platform)
+
+	for _, d := range inv.Disks {
+		if d.Removable {
+			continue
+		}
+		switch d.Type {
+		case storage.DiskTypeHDD:
+			if opts.SpunDown[d.Name] {
+				spinning := spinningHoursPerDay / 24
+				add(d.Name+" (HDD, spins down)", hddActiveWatts*spinning+hddStandbyWatts*(1-spinning))
+			} else {
+				add(d.Name+" (HDD)", hddActiveWatts)
+			}
+		case storage.DiskTypeNVMe:
+			if opts.Tuned {
+				add(d.Name+" (NVMe)", nvmeTunedWatts)
+			} else {
+				add(d.Name+" (NVMe)", nvmeWatts)
+			}
+		default:
+			add(d.Name+" (SSD)", ssdWatts)
+		}
+	}
+	return est
+}
+
+// MonthlyKWh is the energy used in an average month at this draw
+func (e PowerEstimate) MonthlyKWh() float64 {
+	return e.Watts * 24 * 365 / 12 / 1000
+}
+
+// Summary describes the estimate, with the monthly cost when the price per
+// kWh is known (pricePerKWh > 0)
+func (e PowerEstimate) Summary(pricePerKWh float64) string {
+	s := fmt.Sprintf("~%.0f W at idle, ~%.0f kWh a month", e.Watts, e.MonthlyKWh())
+	if pricePerKWh > 0 {
+		s += fmt.Sprintf(", ~%.2f a month at %.2f per kWh", e.MonthlyKWh()*pricePerKWh, pricePerKWh)
+	}
+	return s
+}
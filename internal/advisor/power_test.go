@@ -0,0 +1,60 @@
+package advisor
+
+import (
+	"math"
+	"testing"
+
+	"github.com/madhav/servctl/internal/storage"
+)
+
+func TestEstimatePower(t *testing.T) {
+	inv := &Inventory{
+		CPUModel: "Intel(R) N100",
+		Disks: []storage.Disk{
+			{Name: "nvme0n1", Type: storage.DiskTypeNVMe, IsOSDisk: true},
+			{Name: "sda", Type: storage.DiskTypeHDD},
+			{Name: "sdb", Type: storage.DiskTypeHDD},
+			{Name: "sdc", Type: storage.DiskTypeUSB, Removable: true},
+		},
+	}
+
+	base := EstimatePower(inv, PowerOptions{})
+	if want := 6 + nvmeWatts + 2*hddActiveWatts; math.Abs(base.Watts-want) > 0.01 {
+		t.Errorf("Watts = %.2f, want %.2f (%+v)", base.Watts, want, base.Items)
+	}
+	if len(base.Items) != 4 {
+		t.Errorf("Items = %+v, want platform, NVMe and two HDDs (USB skipped)", base.Items)
+	}
+
+	tuned := EstimatePower(inv, PowerOptions{Tuned: true, SpunDown: map[string]bool{"sdb": true}})
+	if tuned.Watts >= base.Watts-5 {
+		t.Errorf("tuning and spin-down should save several watts: %.1f vs %.1f", tuned.Watts, base.Watts)
+	}
+}
+
+func TestEstimatePower_CPUClasses(t *testing.T) {
+	for model, want := range map[string]float64{
+		"Intel(R) Celeron(R) J4125 CPU @ 2.00GHz":   6,
+		"11th Gen Intel(R) Core(TM) i5-1135G7":      10,
+		"Intel(R) Core(TM) i5-8500T CPU @ 2.10GHz":  10,
+		"Intel(R) Core(TM) i7-10700 CPU @ 2.90GHz":  20,
+		"AMD Ryzen 7 5700U with Radeon Graphics":    10,
+		"Intel(R) Xeon(R) CPU E5-2680 v4 @ 2.40GHz": 45,
+		"Cortex-A76": 6,
+		"":           15,
+	} {
+		if got := EstimatePower(&Inventory{CPUModel: model}, PowerOptions{}).Watts; got != want {
+			t.Errorf("%q: %.0f W, want %.0f W", model, got, want)
+		}
+	}
+}
+
+func TestPowerEstimate_Summary(t *testing.T) {
+	e := PowerEstimate{Watts: 20}
+	if got, want := e.Summary(0), "~20 W at idle, ~15 kWh a month"; got != want {
+		t.Errorf("Summary(0) = %q, want %q", got, want)
+	}
+	if got, want := e.Summary(0.30), "~20 W at idle, ~15 kWh a month, ~4.38 a month at 0.30 per kWh"; got != want {
+		t.Errorf("Summary(0.30) = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,284 @@
+package bootstrap
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/madhav/servctl/internal/compose"
+)
+
+// LargeVideoMinSize is the size from which a video is listed as large
+const LargeVideoMinSize = 500 << 20
+
+// screenshotNames are file name fragments phones and desktops give
+// screenshots (matched case-insensitively)
+var screenshotNames = []string{"screenshot", "screen shot"}
+
+// searchPageSize is how many assets each metadata search page returns
+const searchPageSize = 1000
+
+// PhotoAsset is one photo or video found by the analysis
+type PhotoAsset struct {
+	ID    string
+	Name  string
+	Size  uint64
+	Video bool
+}
+
+// DuplicateGroup is a set of assets Immich detected as the same picture.
+// Assets are largest first: the copy that stays on top when stacked.
+type DuplicateGroup struct {
+	ID     string
+	Assets []PhotoAsset
+}
+
+// Savings is the space freed by keeping only the first asset of the group
+func (g DuplicateGroup) Savings() uint64 {
+	var total uint64
+	for _, a := range g.Assets[1:] {
+		total += a.Size
+	}
+	return total
+}
+
+// PhotoAnalysis is what one library could give back: duplicate copies,
+// screenshots and large videos
+type PhotoAnalysis struct {
+	Duplicates  []DuplicateGroup
+	Screenshots []PhotoAsset
+	LargeVideos []PhotoAsset
+}
+
+// DuplicateSavings is the space freed by deleting every extra duplicate copy
+func (a PhotoAnalysis) DuplicateSavings() uint64 {
+	var total uint64
+	for _, g := range a.Duplicates {
+		total += g.Savings()
+	}
+	return total
+}
+
+// ScreenshotSize is the space the screenshots take
+func (a PhotoAnalysis) ScreenshotSize() uint64 {
+	return assetsSize(a.Screenshots)
+}
+
+// LargeVideoSize is the space the large videos take
+func (a PhotoAnalysis) LargeVideoSize() uint64 {
+	return assetsSize(a.LargeVideos)
+}
+
+func assetsSize(assets []PhotoAsset) uint64 {
+	var total uint64
+	for _, a := range assets {
+		total += a.Size
+	}
+	return total
+}
+
+// immichAsset is the part of Immich's asset response the analysis reads
+type immichAsset struct {
+	ID               string `json:"id"`
+	Type             string `json:"type"`
+	OriginalFileName string `json:"originalFileName"`
+	ExifInfo         *struct {
+		FileSizeInByte uint64 `json:"fileSizeInByte"`
+	} `json:"exifInfo"`
+}
+
+func (a immichAsset) photoAsset() PhotoAsset {
+	asset := PhotoAsset{ID: a.ID, Name: a.OriginalFileName, Video: a.Type == "VIDEO"}
+	if a.ExifInfo != nil {
+		asset.Size = a.ExifInfo.FileSizeInByte
+	}
+	return asset
+}
+
+// isScreenshot reports whether a file name looks like a screenshot
+func isScreenshot(name string) bool {
+	name = strings.ToLower(name)
+	for _, s := range screenshotNames {
+		if strings.Contains(name, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// sortBySize orders assets largest first
+func sortBySize(assets []PhotoAsset) {
+	sort.SliceStable(assets, func(i, j int) bool { return assets[i].Size > assets[j].Size })
+}
+
+// Duplicates returns the logged-in user's duplicate groups, as found by
+// Immich's duplicate detection job
+func (c *ImmichClient) Duplicates() ([]DuplicateGroup, error) {
+	var resp []struct {
+		DuplicateID string        `json:"duplicateId"`
+		Assets      []immichAsset `json:"assets"`
+	}
+	if err := c.do(http.MethodGet, "/api/duplicates", nil, &resp); err != nil {
+		return nil, err
+	}
+
+	var groups []DuplicateGroup
+	for _, d := range resp {
+		if len(d.Assets) < 2 {
+			continue
+		}
+		g := DuplicateGroup{ID: d.DuplicateID}
+		for _, a := range d.Assets {
+			g.Assets = append(g.Assets, a.photoAsset())
+		}
+		sortBySize(g.Assets)
+		groups = append(groups, g)
+	}
+	sort.SliceStable(groups, func(i, j int) bool { return groups[i].Savings() > groups[j].Savings() })
+	return groups, nil
+}
+
+// searchMetadata runs a metadata search and returns every page of results.
+// Archived and trashed assets are not searched.
+func (c *ImmichClient) searchMetadata(query map[string]interface{}) ([]immichAsset, error) {
+	var assets []immichAsset
+	for page := 1; ; page++ {
+		body := map[string]interface{}{"page": page, "size": searchPageSize, "withExif": true}
+		for k, v := range query {
+			body[k] = v
+		}
+		var resp struct {
+			Assets struct {
+				Items    []immichAsset `json:"items"`
+				NextPage *string       `json:"nextPage"`
+			} `json:"assets"`
+		}
+		if err := c.do(http.MethodPost, "/api/search/metadata", body, &resp); err != nil {
+			return nil, err
+		}
+		assets = append(assets, resp.Assets.Items...)
+		if resp.Assets.NextPage == nil || len(resp.Assets.Items) == 0 {
+			return assets, nil
+		}
+	}
+}
+
+// Screenshots returns the logged-in user's screenshots, largest first
+func (c *ImmichClient) Screenshots() ([]PhotoAsset, error) {
+	seen := make(map[string]bool)
+	var shots []PhotoAsset
+	for _, name := range screenshotNames {
+		found, err := c.searchMetadata(map[string]interface{}{"originalFileName": name, "type": "IMAGE"})
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range found {
+			if seen[a.ID] || !isScreenshot(a.OriginalFileName) {
+				continue
+			}
+			seen[a.ID] = true
+			shots = append(shots, a.photoAsset())
+		}
+	}
+	sortBySize(shots)
+	return shots, nil
+}
+
+// LargeVideos returns the logged-in user's videos of at least minSize
+// bytes, largest first
+func (c *ImmichClient) LargeVideos(minSize uint64) ([]PhotoAsset, error) {
+	found, err := c.searchMetadata(map[string]interface{}{"type": "VIDEO"})
+	if err != nil {
+		return nil, err
+	}
+	var videos []PhotoAsset
+	for _, a := range found {
+		if asset := a.photoAsset(); asset.Size >= minSize {
+			videos = append(videos, asset)
+		}
+	}
+	sortBySize(videos)
+	return videos, nil
+}
+
+// AnalyzePhotos gathers the logged-in user's duplicates, screenshots and
+// large videos. Nothing is changed.
+func (c *ImmichClient) AnalyzePhotos() (PhotoAnalysis, error) {
+	var a PhotoAnalysis
+	var err error
+	if a.Duplicates, err = c.Duplicates(); err != nil {
+		return a, fmt.Errorf("duplicates: %w", err)
+	}
+	if a.Screenshots, err = c.Screenshots(); err != nil {
+		return a, fmt.Errorf("screenshots: %w", err)
+	}
+	if a.LargeVideos, err = c.LargeVideos(LargeVideoMinSize); err != nil {
+		return a, fmt.Errorf("large videos: %w", err)
+	}
+	return a, nil
+}
+
+// StackDuplicates stacks each duplicate group under its largest copy, so
+// the timeline shows one picture per group. Nothing is deleted. It
+// returns how many groups were stacked.
+func (c *ImmichClient) StackDuplicates(groups []DuplicateGroup) (int, error) {
+	stacked := 0
+	for _, g := range groups {
+		ids := make([]string, 0, len(g.Assets))
+		for _, a := range g.Assets {
+			ids = append(ids, a.ID)
+		}
+		if err := c.do(http.MethodPost, "/api/stacks", map[string][]string{"assetIds": ids}, nil); err != nil {
+			return stacked, err
+		}
+		stacked++
+	}
+	return stacked, nil
+}
+
+// ArchiveAssets moves assets out of the timeline into the archive. They
+// stay in albums, search and backups.
+func (c *ImmichClient) ArchiveAssets(assets []PhotoAsset) error {
+	if len(assets) == 0 {
+		return nil
+	}
+	ids := make([]string, 0, len(assets))
+	for _, a := range assets {
+		ids = append(ids, a.ID)
+	}
+	body := map[string]interface{}{"ids": ids, "visibility": "archive"}
+	return c.do(http.MethodPut, "/api/assets", body, nil)
+}
+
+// PhotoLibrary is one Immich user's library with a client acting as them
+type PhotoLibrary struct {
+	Owner  string
+	Client *ImmichClient
+}
+
+// PhotoLibraries connects to every library servctl can reach: the admin's,
+// signed in with its password, and each family member's through the API
+// key created at setup (ImmichAPIKeys). Members without a key are
+// returned in skipped.
+func PhotoLibraries(config *compose.ServiceConfig) (libraries []PhotoLibrary, skipped []string, err error) {
+	admin := NewImmichClient(config.ImmichPort)
+	if err := admin.Ping(); err != nil {
+		return nil, nil, fmt.Errorf("immich is not answering on port %d: %w", config.ImmichPort, err)
+	}
+	if err := admin.Login(config.ImmichAdminEmail, config.ImmichAdminPass); err != nil {
+		return nil, nil, fmt.Errorf("immich admin login failed: %w", err)
+	}
+	libraries = append(libraries, PhotoLibrary{Owner: config.ImmichAdminEmail, Client: admin})
+
+	for _, m := range config.Users {
+		if m.ImmichAPIKey == "" {
+			skipped = append(skipped, m.Email)
+			continue
+		}
+		client := NewImmichClient(config.ImmichPort)
+		client.APIKey = m.ImmichAPIKey
+		libraries = append(libraries, PhotoLibrary{Owner: m.Email, Client: client})
+	}
+	return libraries, skipped, nil
+}
@@ -0,0 +1,146 @@
+package bootstrap
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAnalyzePhotos(t *testing.T) {
+	var stacks [][]string
+	var archived []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.Path {
+		case "GET /api/duplicates":
+			w.Write([]byte(`[
+				{"duplicateId":"d1","assets":[
+					{"id":"small","type":"IMAGE","originalFileName":"IMG_1.jpg","exifInfo":{"fileSizeInByte":1000}},
+					{"id":"big","type":"IMAGE","originalFileName":"IMG_1 (1).jpg","exifInfo":{"fileSizeInByte":3000}}]},
+				{"duplicateId":"d2","assets":[
+					{"id":"lonely","type":"IMAGE","originalFileName":"IMG_2.jpg"}]}]`))
+		case "POST /api/search/metadata":
+			var body map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&body)
+			switch {
+			case body["originalFileName"] == "screenshot" && body["page"] == 1.0:
+				w.Write([]byte(`{"assets":{"items":[
+					{"id":"s1","type":"IMAGE","originalFileName":"Screenshot_2024.png","exifInfo":{"fileSizeInByte":200}}],"nextPage":"2"}}`))
+			case body["originalFileName"] == "screenshot":
+				w.Write([]byte(`{"assets":{"items":[
+					{"id":"s2","type":"IMAGE","originalFileName":"screenshot-2.png","exifInfo":{"fileSizeInByte":500}}],"nextPage":null}}`))
+			case body["originalFileName"] == "screen shot":
+				w.Write([]byte(`{"assets":{"items":[
+					{"id":"s1","type":"IMAGE","originalFileName":"Screenshot_2024.png","exifInfo":{"fileSizeInByte":200}},
+					{"id":"s3","type":"IMAGE","originalFileName":"Screen Shot 2019.png","exifInfo":{"fileSizeInByte":100}}],"nextPage":null}}`))
+			case body["type"] == "VIDEO":
+				w.Write([]byte(`{"assets":{"items":[
+					{"id":"v1","type":"VIDEO","originalFileName":"clip.mp4","exifInfo":{"fileSizeInByte":1048576}},
+					{"id":"v2","type":"VIDEO","originalFileName":"wedding.mov","exifInfo":{"fileSizeInByte":2147483648}}],"nextPage":null}}`))
+			default:
+				t.Errorf("unexpected search %v", body)
+			}
+		case "POST /api/stacks":
+			var body map[string][]string
+			json.NewDecoder(r.Body).Decode(&body)
+			stacks = append(stacks, body["assetIds"])
+		case "PUT /api/assets":
+			var body struct {
+				IDs        []string `json:"ids"`
+				Visibility string   `json:"visibility"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			if body.Visibility != "archive" {
+				t.Errorf("visibility = %q, want archive", body.Visibility)
+			}
+			archived = append(archived, body.IDs...)
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client := &ImmichClient{BaseURL: server.URL, HTTP: server.Client()}
+	a, err := client.AnalyzePhotos()
+	if err != nil {
+		t.Fatalf("AnalyzePhotos() error: %v", err)
+	}
+
+	if len(a.Duplicates) != 1 || a.Duplicates[0].Assets[0].ID != "big" {
+		t.Fatalf("duplicates = %+v, want one group led by the largest copy", a.Duplicates)
+	}
+	if got := a.DuplicateSavings(); got != 1000 {
+		t.Errorf("DuplicateSavings() = %d, want 1000", got)
+	}
+
+	var shots []string
+	for _, s := range a.Screenshots {
+		shots = append(shots, s.ID)
+	}
+	if len(shots) != 3 || shots[0] != "s2" || shots[2] != "s3" {
+		t.Errorf("screenshots = %v, want s2, s1, s3 (every page, no repeats, largest first)", shots)
+	}
+	if got := a.ScreenshotSize(); got != 800 {
+		t.Errorf("ScreenshotSize() = %d, want 800", got)
+	}
+
+	if len(a.LargeVideos) != 1 || a.LargeVideos[0].ID != "v2" {
+		t.Errorf("large videos = %+v, want only the 2 GiB one", a.LargeVideos)
+	}
+
+	if n, err := client.StackDuplicates(a.Duplicates); err != nil || n != 1 {
+		t.Fatalf("StackDuplicates() = %d, %v", n, err)
+	}
+	if len(stacks) != 1 || stacks[0][0] != "big" || len(stacks[0]) != 2 {
+		t.Errorf("stacks = %v, want the largest copy first", stacks)
+	}
+
+	if err := client.ArchiveAssets(a.Screenshots); err != nil {
+		t.Fatalf("ArchiveAssets() error: %v", err)
+	}
+	if len(archived) != 3 {
+		t.Errorf("archived = %v, want the three screenshots", archived)
+	}
+}
+
+func TestPhotoLibraries(t *testing.T) {
+	var keys []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.Path {
+		case "GET /api/server/ping":
+			w.Write([]byte(`{"res":"pong"}`))
+		case "POST /api/auth/login":
+			w.Write([]byte(`{"accessToken":"token123"}`))
+		case "GET /api/duplicates":
+			keys = append(keys, r.Header.Get("x-api-key"))
+			w.Write([]byte(`[]`))
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	config := sharingTestConfig(t, server)
+	config.Users[0].ImmichAPIKey = "jane-key"
+
+	libraries, skipped, err := PhotoLibraries(config)
+	if err != nil {
+		t.Fatalf("PhotoLibraries() error: %v", err)
+	}
+	if len(libraries) != 2 || libraries[0].Owner != config.ImmichAdminEmail || libraries[1].Owner != "jane@example.com" {
+		t.Fatalf("libraries = %+v, want the admin's and jane's", libraries)
+	}
+	if len(skipped) != 1 || skipped[0] != "john@example.com" {
+		t.Errorf("skipped = %v, want john, who has no API key", skipped)
+	}
+
+	if _, err := libraries[1].Client.Duplicates(); err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0] != "jane-key" {
+		t.Errorf("x-api-key = %v, want jane's key", keys)
+	}
+}
@@ -0,0 +1,331 @@
+// Package bootstrap brings up the generated Docker Compose stack and applies
+// first-run configuration to services once their containers are running.
+package bootstrap
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/madhav/servctl/internal/compose"
+	"github.com/madhav/servctl/internal/ops"
+	"github.com/madhav/servctl/internal/paths"
+	"github.com/madhav/servctl/templates"
+)
+
+// NextcloudContainer is the container name used by the generated compose file
+const NextcloudContainer = "nextcloud"
+
+// StepResult represents the result of a bootstrap step
+type StepResult struct {
+	Name    string
+	Success bool
+	Message string
+	Error   error
+}
+
+// runStep does the work of a step through the ops engine, as one operation
+// that description names: a real run returns what apply reports, a dry
+// run prints the description and changes nothing
+func runStep(result StepResult, dryRun bool, description string, apply func() StepResult) StepResult {
+	result.Success = true
+	result.Message = "[Dry Run] Nothing changed"
+	ops.Execute(dryRun, ops.Func{Description: description, Fn: func() error {
+		result = apply()
+		return result.Error
+	}})
+	return result
+}
+
+// StartServices runs `docker compose up -d` for the generated stack
+func StartServices(composeDir string, dryRun bool) StepResult {
+	result := StepResult{Name: "Start services"}
+	composeFile := filepath.Join(composeDir, "docker-compose.yml")
+
+	return runStep(result, dryRun, "run: docker compose -f "+composeFile+" up -d", func() StepResult {
+		cmd := exec.Command("docker", "compose", "-f", composeFile, "up", "-d")
+		if output, err := cmd.CombinedOutput(); err != nil {
+			result.Error = fmt.Errorf("docker compose up failed: %s: %w", strings.TrimSpace(string(output)), err)
+			result.Message = result.Error.Error()
+			return result
+		}
+
+		result.Success = true
+		result.Message = "Services started"
+		return result
+	})
+}
+
+// StopServices runs `docker compose stop` so nothing writes to the data
+// while it is being reverted
+func StopServices(composeDir string, dryRun bool) StepResult {
+	result := StepResult{Name: "Stop services"}
+	composeFile := filepath.Join(composeDir, "docker-compose.yml")
+
+	return runStep(result, dryRun, "run: docker compose -f "+composeFile+" stop", func() StepResult {
+		cmd := exec.Command("docker", "compose", "-f", composeFile, "stop")
+		if output, err := cmd.CombinedOutput(); err != nil {
+			result.Error = fmt.Errorf("docker compose stop failed: %s: %w", strings.TrimSpace(string(output)), err)
+			result.Message = result.Error.Error()
+			return result
+		}
+
+		result.Success = true
+		result.Message = "Services stopped"
+		return result
+	})
+}
+
+// occCommand builds the docker exec invocation for a Nextcloud occ command.
+// Environment variable names are forwarded with -e; values come from the caller's env.
+// An argument refers to a forwarded variable as ${NAME}; occ then runs
+// through the container's shell, which puts the value in.
+func occCommand(args []string, envNames ...string) []string {
+	cmdArgs := []string{"exec", "-u", "www-data"}
+	for _, name := range envNames {
+		cmdArgs = append(cmdArgs, "-e", name)
+	}
+	cmdArgs = append(cmdArgs, NextcloudContainer)
+	for _, arg := range args {
+		if envRefPattern.MatchString(arg) {
+			return append(cmdArgs, "sh", "-c", occScript(args))
+		}
+	}
+	cmdArgs = append(cmdArgs, "php", "occ")
+	return append(cmdArgs, args...)
+}
+
+// envRefPattern matches a ${NAME} reference in an occ argument
+var envRefPattern = regexp.MustCompile(`\$\{[A-Z_][A-Z0-9_]*\}`)
+
+// occScript is the sh -c script that runs occ with args, quoted for the
+// shell except for their ${NAME} references
+func occScript(args []string) string {
+	words := []string{"exec", "php", "occ"}
+	for _, arg := range args {
+		var word strings.Builder
+		last := 0
+		for _, ref := range envRefPattern.FindAllStringIndex(arg, -1) {
+			if ref[0] > last {
+				word.WriteString(templates.ShellQuote(arg[last:ref[0]]))
+			}
+			word.WriteString(`"` + arg[ref[0]:ref[1]] + `"`)
+			last = ref[1]
+		}
+		if last < len(arg) || last == 0 {
+			word.WriteString(templates.ShellQuote(arg[last:]))
+		}
+		words = append(words, word.String())
+	}
+	return strings.Join(words, " ")
+}
+
+// RunOCC runs a Nextcloud occ command inside the running container
+func RunOCC(args []string, dryRun bool) error {
+	return runOCC(nil, args, dryRun)
+}
+
+// NextcloudFilesPath returns the files:scan path ("alice/files/Status") of
+// a host directory inside a user's Nextcloud files; ok is false elsewhere
+func NextcloudFilesPath(config *compose.ServiceConfig, dir string) (path string, ok bool) {
+	rel, err := filepath.Rel(filepath.Join(config.Path(paths.CloudData), "data"), dir)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return "", false
+	}
+	rel = filepath.ToSlash(rel)
+	if parts := strings.Split(rel, "/"); len(parts) < 2 || parts[1] != "files" {
+		return "", false
+	}
+	return rel, true
+}
+
+// ScanNextcloudFiles has Nextcloud pick up files written straight into its
+// data directory under path (see NextcloudFilesPath)
+func ScanNextcloudFiles(path string, dryRun bool) error {
+	return RunOCC([]string{"files:scan", "--path=" + path}, dryRun)
+}
+
+// runOCC runs an occ command with extra environment variables. Values are
+// passed through the docker client's environment so secrets never appear
+// in the process list.
+func runOCC(env map[string]string, args []string, dryRun bool) error {
+	var names, cmdEnv []string
+	for name := range env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		cmdEnv = append(cmdEnv, name+"="+env[name])
+	}
+
+	cmd := ops.Command{Args: append([]string{"docker"}, occCommand(args, names...)...), Env: cmdEnv}
+	if err := ops.Execute(dryRun, cmd); err != nil {
+		return fmt.Errorf("occ %s: %w", args[0], err)
+	}
+	return nil
+}
+
+// WaitForNextcloudInstalled polls `occ status` until Nextcloud reports that
+// its first-run installation has finished, or the timeout expires
+func WaitForNextcloudInstalled(timeout time.Duration, dryRun bool) error {
+	if dryRun {
+		return nil
+	}
+
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		cmd := exec.Command("docker", occCommand([]string{"status", "--output=json"})...)
+		output, err := cmd.Output()
+		if err == nil && strings.Contains(string(output), `"installed":true`) {
+			return nil
+		}
+		time.Sleep(5 * time.Second)
+	}
+
+	return fmt.Errorf("nextcloud did not finish installing within %s", timeout)
+}
+
+// ConfigureNextcloudMail applies the SMTP settings to Nextcloud via occ
+func ConfigureNextcloudMail(config *compose.ServiceConfig, dryRun bool) StepResult {
+	result := StepResult{Name: "Nextcloud mail"}
+
+	if !config.SMTPEnabled() {
+		result.Success = true
+		result.Message = "SMTP not configured, skipped"
+		return result
+	}
+
+	if err := WaitForNextcloudInstalled(5*time.Minute, dryRun); err != nil {
+		result.Error = err
+		result.Message = err.Error()
+		return result
+	}
+
+	// The password goes through the environment, never the process list
+	env := map[string]string{compose.SMTPPasswordEnv: config.SMTPPassword}
+	for _, args := range compose.GenerateNextcloudMailCommands(config) {
+		if err := runOCC(env, args, dryRun); err != nil {
+			result.Error = err
+			result.Message = err.Error()
+			return result
+		}
+	}
+
+	result.Success = true
+	result.Message = fmt.Sprintf("Nextcloud will send mail via %s:%d", config.SMTPHost, config.SMTPPort)
+	return result
+}
+
+// ConfigureNextcloudLocale sets Nextcloud's default language, locale and
+// phone region from the household's locale via occ
+func ConfigureNextcloudLocale(config *compose.ServiceConfig, dryRun bool) StepResult {
+	result := StepResult{Name: "Nextcloud language"}
+
+	commands := compose.GenerateNextcloudLocaleCommands(config)
+	if len(commands) == 0 {
+		result.Success = true
+		result.Message = "No locale configured, skipped"
+		return result
+	}
+
+	if err := WaitForNextcloudInstalled(5*time.Minute, dryRun); err != nil {
+		result.Error = err
+		result.Message = err.Error()
+		return result
+	}
+
+	for _, args := range commands {
+		if err := RunOCC(args, dryRun); err != nil {
+			result.Error = err
+			result.Message = err.Error()
+			return result
+		}
+	}
+
+	result.Success = true
+	result.Message = fmt.Sprintf("Nextcloud defaults to %s", config.Locale)
+	return result
+}
+
+// ConfigureSystemMail writes msmtp config and sends a test message
+func ConfigureSystemMail(config *compose.ServiceConfig, dryRun bool) StepResult {
+	result := StepResult{Name: "System mail"}
+
+	if !config.SMTPEnabled() {
+		result.Success = true
+		result.Message = "SMTP not configured, skipped"
+		return result
+	}
+	if config.Rootless {
+		result.Success = true
+		result.Message = "Needs root to write /etc/msmtprc, skipped (rootless mode)"
+		return result
+	}
+
+	if err := compose.WriteMsmtpConfig(config, dryRun); err != nil {
+		result.Error = err
+		result.Message = err.Error()
+		return result
+	}
+
+	if err := compose.SendTestMail(config, dryRun); err != nil {
+		result.Error = err
+		result.Message = err.Error()
+		return result
+	}
+
+	result.Success = true
+	result.Message = fmt.Sprintf("Test message sent to %s", config.SMTPRecipient)
+	return result
+}
+
+// RunBootstrap starts the stack and applies all first-run configuration
+func RunBootstrap(config *compose.ServiceConfig, composeDir string, dryRun bool) []StepResult {
+	var results []StepResult
+
+	start := StartServices(composeDir, dryRun)
+	results = append(results, start)
+	if !start.Success {
+		return results
+	}
+
+	// First boot initializes databases and runs the Nextcloud installer,
+	// which can take several minutes on slow disks
+	ready := WaitForServices(config, 10*time.Minute, dryRun)
+	results = append(results, ready)
+	if !ready.Success {
+		return results
+	}
+
+	results = append(results, ConfigureNextcloudMail(config, dryRun))
+	results = append(results, ConfigureNextcloudLocale(config, dryRun))
+	results = append(results, ConfigureSystemMail(config, dryRun))
+	results = append(results, ProvisionNextcloudUsers(config, dryRun))
+	results = append(results, ProvisionImmichUsers(config, dryRun))
+	results = append(results, ConfigureImmichSharing(config, dryRun))
+	results = append(results, ConfigureImmichLibrary(config, dryRun))
+	results = append(results, ConfigureImmichML(config, dryRun))
+	results = append(results, ConfigureNextcloudOIDC(config, dryRun))
+	results = append(results, ConfigureImmichOIDC(config, dryRun))
+	results = append(results, ConfigureLocalDNS(config, dryRun))
+	results = append(results, ConfigureExternalURLs(config, dryRun))
+
+	// Last, so the test photo and file go through the configured services
+	results = append(results, RunSmokeTests(config, dryRun)...)
+
+	return results
+}
+
+// HasFailures checks if any bootstrap step failed
+func HasFailures(results []StepResult) bool {
+	for _, r := range results {
+		if !r.Success {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,176 @@
+package bootstrap
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/madhav/servctl/internal/compose"
+)
+
+func TestOCCCommand(t *testing.T) {
+	args := occCommand([]string{"status"})
+	got := strings.Join(args, " ")
+	want := "exec -u www-data nextcloud php occ status"
+	if got != want {
+		t.Errorf("occCommand() = %q, want %q", got, want)
+	}
+
+	args = occCommand([]string{"user:add", "jane"}, "OC_PASS")
+	got = strings.Join(args, " ")
+	want = "exec -u www-data -e OC_PASS nextcloud php occ user:add jane"
+	if got != want {
+		t.Errorf("occCommand() with env = %q, want %q", got, want)
+	}
+
+	// A reference to a forwarded variable is expanded by the container's shell
+	args = occCommand([]string{"config:system:set", "mail_smtppassword", "--value=${SMTP_PASSWORD}"}, "SMTP_PASSWORD")
+	got = strings.Join(args, " ")
+	want = `exec -u www-data -e SMTP_PASSWORD nextcloud sh -c exec php occ config:system:set mail_smtppassword --value="${SMTP_PASSWORD}"`
+	if got != want {
+		t.Errorf("occCommand() with a reference = %q, want %q", got, want)
+	}
+	if got := occScript([]string{"it's", "${A}x${B}", ""}); got != `exec php occ 'it'\''s' "${A}"x"${B}" ''` {
+		t.Errorf("occScript() = %q", got)
+	}
+}
+
+func TestNextcloudFilesPath(t *testing.T) {
+	config := compose.DefaultConfig()
+	config.DataRoot = "/mnt/data"
+	data := config.Path("cloud-data") + "/data"
+
+	tests := []struct {
+		dir  string
+		want string
+		ok   bool
+	}{
+		{data + "/admin/files/Server Status", "admin/files/Server Status", true},
+		{data + "/admin/files", "admin/files", true},
+		{data + "/admin", "", false},
+		{data + "/appdata_abc/preview", "", false},
+		{"/home/admin/status", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := NextcloudFilesPath(config, tt.dir)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("NextcloudFilesPath(%q) = %q, %v, want %q, %v", tt.dir, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestStartServices_DryRun(t *testing.T) {
+	var result StepResult
+	output := captureStdout(t, func() { result = StartServices("/tmp/infra/compose", true) })
+	if !result.Success {
+		t.Errorf("StartServices dry run failed: %s", result.Message)
+	}
+	if !strings.Contains(output, "/tmp/infra/compose/docker-compose.yml") {
+		t.Errorf("Dry run should print the compose path, got %q", output)
+	}
+}
+
+func TestRunBootstrap_DryRun_Defaults(t *testing.T) {
+	config := compose.DefaultConfig()
+	config.MLModels = compose.MLOff // ML and the folder layout are on by default; off makes every optional step skip
+	config.ImmichStorageTemplate = ""
+	config.Locale = ""
+	results := RunBootstrap(config, "/tmp/infra/compose", true)
+
+	if len(results) != 15 {
+		t.Fatalf("RunBootstrap() returned %d steps, want 15", len(results))
+	}
+	if HasFailures(results) {
+		t.Errorf("Dry run bootstrap should not fail: %+v", results)
+	}
+	for _, r := range results[2:14] {
+		if !strings.Contains(r.Message, "skipped") {
+			t.Errorf("%s should be skipped without optional features, got %q", r.Name, r.Message)
+		}
+	}
+	if smoke := results[14]; smoke.Name != "Smoke tests" || !strings.Contains(smoke.Message, "Dry Run") {
+		t.Errorf("last step = %+v, want the smoke tests", smoke)
+	}
+}
+
+func TestRunBootstrap_DryRun_SMTP(t *testing.T) {
+	config := compose.DefaultConfig()
+	config.SMTPHost = "smtp.example.com"
+	config.SMTPFrom = "server@example.com"
+	config.SMTPRecipient = "admin@example.com"
+
+	results := RunBootstrap(config, "/tmp/infra/compose", true)
+	if HasFailures(results) {
+		t.Errorf("Dry run bootstrap should not fail: %+v", results)
+	}
+}
+
+func TestHasFailures(t *testing.T) {
+	if HasFailures(nil) {
+		t.Error("HasFailures(nil) should be false")
+	}
+	if !HasFailures([]StepResult{{Success: true}, {Success: false}}) {
+		t.Error("HasFailures should detect a failed step")
+	}
+}
+
+func TestReadinessChecks(t *testing.T) {
+	config := compose.DefaultConfig()
+	if got := len(ReadinessChecks(config)); got != 5 {
+		t.Errorf("ReadinessChecks() = %d checks, want 5", got)
+	}
+
+	config.SSOEnabled = true
+	checks := ReadinessChecks(config)
+	last := checks[len(checks)-1]
+	if last.Container != "authentik_server" || !strings.Contains(last.URL, ":9000/") {
+		t.Errorf("SSO should add an Authentik readiness check, got %+v", last)
+	}
+}
+
+func TestRenderReadinessProgress(t *testing.T) {
+	line := renderReadinessProgress(3, 5, 42*time.Second, []string{"Nextcloud", "Immich"})
+	for _, check := range []string{"3/5", "42s", "Nextcloud, Immich"} {
+		if !strings.Contains(line, check) {
+			t.Errorf("Progress line missing %q: %s", check, line)
+		}
+	}
+}
+
+func TestUpdateNextcloudHost_DryRun(t *testing.T) {
+	config := compose.DefaultConfig()
+	config.HostIP = "10.0.0.20"
+
+	commands := nextcloudHostCommands(config)
+	if got := strings.Join(commands[0], " "); got != "config:system:set trusted_domains 0 --value=10.0.0.20" {
+		t.Errorf("trusted domain command = %q", got)
+	}
+
+	if result := UpdateNextcloudHost(config, true); !result.Success {
+		t.Errorf("UpdateNextcloudHost dry run failed: %s", result.Message)
+	}
+}
+
+func TestNextcloudHostCommands_External(t *testing.T) {
+	config := compose.DefaultConfig()
+	config.HostIP = "10.0.0.20"
+	config.NextcloudExternalURL = "https://cloud.example.com"
+
+	var got []string
+	for _, cmd := range nextcloudHostCommands(config) {
+		got = append(got, strings.Join(cmd, " "))
+	}
+	want := []string{
+		"config:system:set trusted_domains 0 --value=10.0.0.20",
+		"config:system:set trusted_domains 2 --value=cloud.example.com",
+		"config:system:set overwrite.cli.url --value=https://cloud.example.com",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("nextcloudHostCommands() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	result := ConfigureExternalURLs(config, true)
+	if !result.Success || !strings.Contains(result.Message, "https://cloud.example.com") {
+		t.Errorf("ConfigureExternalURLs dry run = %+v", result)
+	}
+}
@@ -0,0 +1,103 @@
+package bootstrap
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// unsetVariable matches Docker Compose's warning for a ${VAR} that .env
+// does not set, which it replaces with an empty string
+var unsetVariable = regexp.MustCompile(`The "(\w+)" variable is not set`)
+
+// composeUnsetVariables returns the variables docker compose config warned
+// about, in order and without duplicates
+func composeUnsetVariables(output string) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, m := range unsetVariable.FindAllStringSubmatch(output, -1) {
+		if !seen[m[1]] {
+			seen[m[1]] = true
+			names = append(names, m[1])
+		}
+	}
+	return names
+}
+
+// composePullErrors returns the lines of docker compose pull output that
+// report a failure, without duplicates
+func composePullErrors(output string) []string {
+	seen := make(map[string]bool)
+	var errs []string
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		lower := strings.ToLower(line)
+		if !strings.Contains(lower, "error") && !strings.Contains(lower, "denied") && !strings.Contains(lower, "not found") {
+			continue
+		}
+		if !seen[line] {
+			seen[line] = true
+			errs = append(errs, line)
+		}
+	}
+	return errs
+}
+
+// CheckComposeConfig has Docker Compose parse the generated files with the
+// .env next to them, so schema errors and credentials missing from .env
+// show up now rather than at the first 'docker compose up'
+func CheckComposeConfig(composeDir string, dryRun bool) StepResult {
+	result := StepResult{Name: "Check compose files"}
+	composeFile := filepath.Join(composeDir, "docker-compose.yml")
+
+	return runStep(result, dryRun, "run: docker compose -f "+composeFile+" config --quiet", func() StepResult {
+		output, err := exec.Command("docker", "compose", "-f", composeFile, "config", "--quiet").CombinedOutput()
+		if err != nil {
+			result.Error = fmt.Errorf("docker compose rejected %s: %s", composeFile, strings.TrimSpace(string(output)))
+			result.Message = result.Error.Error()
+			return result
+		}
+		if unset := composeUnsetVariables(string(output)); len(unset) > 0 {
+			result.Error = fmt.Errorf("%s has no value for %s", filepath.Join(composeDir, ".env"), strings.Join(unset, ", "))
+			result.Message = result.Error.Error()
+			return result
+		}
+
+		result.Success = true
+		result.Message = "Docker Compose accepts the generated files"
+		return result
+	})
+}
+
+// CheckImageRegistries resolves every image against its registry with
+// 'docker compose --dry-run pull', which downloads nothing. A registry
+// that cannot be reached or an image that does not exist fails the step.
+// Compose before 2.21 has no --dry-run; the check is then skipped.
+func CheckImageRegistries(composeDir string, dryRun bool) StepResult {
+	result := StepResult{Name: "Check image registries"}
+	composeFile := filepath.Join(composeDir, "docker-compose.yml")
+
+	return runStep(result, dryRun, "run: docker compose -f "+composeFile+" --dry-run pull", func() StepResult {
+		output, err := exec.Command("docker", "compose", "-f", composeFile, "--dry-run", "pull").CombinedOutput()
+		if err != nil && strings.Contains(string(output), "unknown flag: --dry-run") {
+			result.Success = true
+			result.Message = "Skipped: this Docker Compose has no --dry-run (2.21 or later)"
+			return result
+		}
+		if err != nil {
+			problems := composePullErrors(string(output))
+			if len(problems) == 0 {
+				problems = []string{strings.TrimSpace(string(output))}
+			}
+			result.Error = fmt.Errorf("images cannot be pulled: %s", strings.Join(problems, "; "))
+			result.Message = result.Error.Error()
+			return result
+		}
+
+		result.Success = true
+		result.Message = "Every image resolves on its registry"
+		return result
+	})
+}
@@ -0,0 +1,38 @@
+package bootstrap
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestComposeUnsetVariables(t *testing.T) {
+	output := `time="2025-01-01T00:00:00Z" level=warning msg="The \"IMMICH_DB_PASSWORD\" variable is not set. Defaulting to a blank string."
+time="2025-01-01T00:00:00Z" level=warning msg="The \"TUNNEL_TOKEN\" variable is not set. Defaulting to a blank string."
+time="2025-01-01T00:00:00Z" level=warning msg="The \"IMMICH_DB_PASSWORD\" variable is not set. Defaulting to a blank string."`
+	output = strings.ReplaceAll(output, `\"`, `"`)
+
+	got := composeUnsetVariables(output)
+	if strings.Join(got, ",") != "IMMICH_DB_PASSWORD,TUNNEL_TOKEN" {
+		t.Errorf("composeUnsetVariables() = %v, want IMMICH_DB_PASSWORD, TUNNEL_TOKEN", got)
+	}
+	if got := composeUnsetVariables(""); got != nil {
+		t.Errorf("composeUnsetVariables(\"\") = %v, want none", got)
+	}
+}
+
+func TestComposePullErrors(t *testing.T) {
+	output := ` immich-server Pulling
+ nextcloud Pulling
+ immich-server Error Get "https://ghcr.io/v2/": dial tcp: lookup ghcr.io: no such host
+ nextcloud Pulled
+Error response from daemon: pull access denied for nextcloudd, repository does not exist
+Error response from daemon: pull access denied for nextcloudd, repository does not exist`
+
+	got := composePullErrors(output)
+	if len(got) != 2 {
+		t.Fatalf("composePullErrors() = %q, want the two distinct failures", got)
+	}
+	if !strings.Contains(got[0], "ghcr.io") || !strings.Contains(got[1], "nextcloudd") {
+		t.Errorf("composePullErrors() = %q", got)
+	}
+}
@@ -0,0 +1,469 @@
+package bootstrap
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/madhav/servctl/internal/compose"
+	"github.com/madhav/servctl/internal/paths"
+)
+
+// Database engines servctl knows how to upgrade
+const (
+	EnginePostgres = "postgres"
+	EngineMariaDB  = "mariadb"
+)
+
+// Database is one of the stack's database containers
+type Database struct {
+	Name      string   // Display name
+	Service   string   // In the compose file
+	Container string   // container_name
+	Engine    string   // EnginePostgres or EngineMariaDB
+	User      string   // Postgres superuser the dump and reload run as
+	DataDir   string   // On the host
+	Clients   []string // Containers that write to it, stopped before the dump
+}
+
+// Databases returns the stack's databases
+func Databases(config *compose.ServiceConfig) []Database {
+	dbs := []Database{
+		{Name: "Immich database", Service: "immich-postgres", Container: "immich_postgres", Engine: EnginePostgres,
+			User: "immich", DataDir: config.Path(paths.ImmichDB), Clients: []string{"immich_server"}},
+		{Name: "Nextcloud database", Service: "nextcloud-mariadb", Container: "nextcloud_mariadb", Engine: EngineMariaDB,
+			DataDir: config.Path(paths.NextcloudDB), Clients: []string{NextcloudContainer}},
+	}
+	if config.SSOEnabled {
+		dbs = append(dbs, Database{Name: "Authentik database", Service: "authentik-postgres", Container: "authentik_postgres",
+			Engine: EnginePostgres, User: "authentik", DataDir: config.Path(paths.AuthentikDB),
+			Clients: []string{"authentik_server", "authentik_worker"}})
+	}
+	return dbs
+}
+
+// DatabaseChange is a database whose image in the compose file is another
+// release series than the one that wrote its files. Postgres opens files
+// of its own major version only, so starting the new image on them leaves
+// the stack down; MariaDB upgrades its files on start but cannot go back.
+type DatabaseChange struct {
+	Database
+	Image string // The new image
+	From  string // Version that wrote the files
+	To    string // Version of the new image
+}
+
+// Downgrade reports whether the new image is older than the files, which
+// neither engine can open
+func (c DatabaseChange) Downgrade() bool {
+	return compareVersions(versionParts(c.To), versionParts(c.From), seriesParts(c.Engine)) < 0
+}
+
+func (c DatabaseChange) String() string {
+	engine := "Postgres"
+	if c.Engine == EngineMariaDB {
+		engine = "MariaDB"
+	}
+	return fmt.Sprintf("%s: %s %s → %s (%s)", c.Name, engine, c.From, c.To, c.Image)
+}
+
+// seriesParts is how many leading version numbers name a release series
+// whose files another series must convert: 16 for Postgres, 11.4 for
+// MariaDB
+func seriesParts(engine string) int {
+	if engine == EngineMariaDB {
+		return 2
+	}
+	return 1
+}
+
+// versionNumber finds the version in a tag ("pg14-v0.2.0", "16-alpine")
+// or a version string ("11.4.2-MariaDB", "1:11.4.2+maria~ubu2404")
+var versionNumber = regexp.MustCompile(`\d+(\.\d+)*`)
+
+// versionParts returns the numbers of the first version in s, nil when it
+// has none ("latest")
+func versionParts(s string) []int {
+	if _, rest, found := strings.Cut(s, ":"); found {
+		s = rest // Debian epoch
+	}
+	var parts []int
+	for _, p := range strings.Split(versionNumber.FindString(s), ".") {
+		if n, err := strconv.Atoi(p); err == nil {
+			parts = append(parts, n)
+		}
+	}
+	return parts
+}
+
+// compareVersions compares the first n numbers of a and b, as far as both
+// have them
+func compareVersions(a, b []int, n int) int {
+	for i := 0; i < n && i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			if a[i] < b[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// containerImages maps each container_name in a compose file to the image
+// that follows it
+func containerImages(composeFile string) (map[string]string, error) {
+	content, err := os.ReadFile(composeFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", composeFile, err)
+	}
+	images := make(map[string]string)
+	container := ""
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if name, found := strings.CutPrefix(line, "container_name:"); found {
+			container = strings.Trim(strings.TrimSpace(name), `"'`)
+		} else if image, found := strings.CutPrefix(line, "image:"); found && container != "" {
+			images[container] = strings.Trim(strings.TrimSpace(image), `"'`)
+			container = ""
+		}
+	}
+	return images, nil
+}
+
+// dataVersion returns the version that wrote a database's files, "" when
+// there are none yet
+func dataVersion(db Database) (string, error) {
+	files := []string{"PG_VERSION"}
+	if db.Engine == EngineMariaDB {
+		files = []string{"mariadb_upgrade_info", "mysql_upgrade_info"}
+	}
+	for _, name := range files {
+		data, err := os.ReadFile(filepath.Join(db.DataDir, name))
+		if os.IsPermission(err) {
+			// Owned by the container's user; ask the container instead
+			data, err = exec.Command("docker", "exec", db.Container, "cat", filepath.Join(containerDataDir(db), name)).Output()
+			if err != nil {
+				return "", fmt.Errorf("cannot read %s: start %s or run with sudo", filepath.Join(db.DataDir, name), db.Container)
+			}
+		} else if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return "", err
+		}
+		version := strings.TrimSpace(string(data))
+		version, _, _ = strings.Cut(version, "-") // 11.4.2-MariaDB
+		return version, nil
+	}
+	return "", nil
+}
+
+// containerDataDir is where the image keeps its files
+func containerDataDir(db Database) string {
+	if db.Engine == EngineMariaDB {
+		return "/var/lib/mysql"
+	}
+	return "/var/lib/postgresql/data"
+}
+
+// imageVersion returns the version an image runs: the PG_MAJOR or
+// MARIADB_VERSION the official images set, when it is pulled, otherwise
+// the version its tag names
+func imageVersion(image, engine string) string {
+	tag := ""
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		tag = image[i+1:]
+	}
+	key := "PG_MAJOR="
+	if engine == EngineMariaDB {
+		key = "MARIADB_VERSION="
+	}
+	output, err := exec.Command("docker", "image", "inspect", "--format", "{{range .Config.Env}}{{println .}}{{end}}", image).Output()
+	if err == nil {
+		for _, line := range strings.Split(string(output), "\n") {
+			if value, found := strings.CutPrefix(line, key); found {
+				// 1:11.4.2+maria~ubu2404
+				if _, rest, found := strings.Cut(value, ":"); found {
+					value = rest
+				}
+				return versionNumber.FindString(value)
+			}
+		}
+	}
+	return versionNumber.FindString(tag)
+}
+
+// PlanDatabaseUpgrades compares each database's files with the image the
+// compose file runs it with and returns those that change release series.
+// Databases without files yet, or whose image names no version, are left
+// out. Files whose version cannot be read are an error, for each such
+// database, as starting the stack on them is what this check prevents.
+func PlanDatabaseUpgrades(config *compose.ServiceConfig, composeFile string) ([]DatabaseChange, error) {
+	images, err := containerImages(composeFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil // Nothing to start yet (a dry run of a first setup)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var changes []DatabaseChange
+	var errs []error
+	for _, db := range Databases(config) {
+		image, ok := images[db.Container]
+		if !ok {
+			continue
+		}
+		from, err := dataVersion(db)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", db.Name, err))
+			continue
+		}
+		to := imageVersion(image, db.Engine)
+		if from == "" || to == "" {
+			continue
+		}
+		if compareVersions(versionParts(from), versionParts(to), seriesParts(db.Engine)) != 0 {
+			changes = append(changes, DatabaseChange{Database: db, Image: image, From: from, To: to})
+		}
+	}
+	return changes, errors.Join(errs...)
+}
+
+// dumpPath is where a database is dumped before it changes version, next
+// to its files so the dump lands on the same disk
+func dumpPath(c DatabaseChange, at time.Time) string {
+	return filepath.Join(filepath.Dir(c.DataDir),
+		fmt.Sprintf("%s-%s%s-%s.sql", filepath.Base(c.DataDir), c.Engine, c.From, at.Format("20060102-150405")))
+}
+
+// searchPathReset is the line pg_dumpall starts each database with. Left
+// as is, Immich's vectors extension cannot find its types while indexes
+// are rebuilt, so the restore keeps public on the search path.
+const (
+	searchPathReset = "SELECT pg_catalog.set_config('search_path', '', false);"
+	searchPathKeep  = "SELECT pg_catalog.set_config('search_path', 'public, pg_catalog', true);"
+)
+
+// expectedRestoreErrors are what reloading a pg_dumpall --clean into a
+// fresh cluster as user always reports: the entrypoint already created
+// user, who cannot drop themselves. Any other "already exists" means the
+// cluster was not empty.
+func expectedRestoreErrors(user string) []string {
+	return []string{
+		fmt.Sprintf(`role "%s" already exists`, user),
+		"current user cannot be dropped",
+		"cannot drop the currently open database",
+	}
+}
+
+// unexpectedRestoreErrors returns the psql errors in output other than the
+// expected ones
+func unexpectedRestoreErrors(output, user string) []string {
+	var unexpected []string
+	for _, line := range strings.Split(output, "\n") {
+		if !strings.Contains(line, "ERROR:") || containsAny(line, expectedRestoreErrors(user)) {
+			continue
+		}
+		unexpected = append(unexpected, strings.TrimSpace(line))
+	}
+	return unexpected
+}
+
+// UpgradeDatabase moves a database to its new image. Writers stop and the
+// old image dumps everything first. MariaDB then upgrades its files when
+// the stack starts (MARIADB_AUTO_UPGRADE). Postgres cannot: its files
+// move aside, the new image starts on an empty directory and the dump is
+// reloaded into it. The old files and the dump are kept, so going back
+// is putting them in place with the old image.
+func UpgradeDatabase(c DatabaseChange, composeFile string, dryRun bool) StepResult {
+	result := StepResult{Name: "Upgrade " + c.Name}
+	if c.Downgrade() {
+		result.Error = fmt.Errorf("%s files are from version %s and cannot be opened by %s; keep the image at %s",
+			c.Name, c.From, c.To, c.From)
+		result.Message = result.Error.Error()
+		return result
+	}
+
+	dump := dumpPath(c, time.Now())
+	oldDir := c.DataDir + "." + c.Engine + c.From
+	description := fmt.Sprintf("stop %s, dump %s to %s", strings.Join(c.Clients, ", "), c.Container, dump)
+	if c.Engine == EnginePostgres {
+		description += fmt.Sprintf(", move its files to %s and reload the dump into %s", oldDir, c.Image)
+	}
+	return runStep(result, dryRun, description, func() StepResult {
+		fail := func(err error) StepResult {
+			result.Error = err
+			result.Message = err.Error()
+			return result
+		}
+
+		// Writes after the dump would be lost
+		for _, client := range c.Clients {
+			if containerHealth(client) != "missing" {
+				if output, err := exec.Command("docker", "stop", client).CombinedOutput(); err != nil {
+					return fail(fmt.Errorf("docker stop %s failed: %s", client, strings.TrimSpace(string(output))))
+				}
+			}
+		}
+
+		// The container still runs the old image: compose has not recreated it
+		switch containerHealth(c.Container) {
+		case "missing":
+			return fail(fmt.Errorf("no %s container to dump with; set its image back to version %s and start it first", c.Container, c.From))
+		case "healthy", "running":
+		default:
+			if output, err := exec.Command("docker", "start", c.Container).CombinedOutput(); err != nil {
+				return fail(fmt.Errorf("docker start %s failed: %s", c.Container, strings.TrimSpace(string(output))))
+			}
+			if err := waitForDatabase(c.Database, 2*time.Minute); err != nil {
+				return fail(err)
+			}
+		}
+		if err := dumpDatabase(c.Database, dump); err != nil {
+			return fail(err)
+		}
+
+		if c.Engine == EngineMariaDB {
+			result.Success = true
+			result.Message = fmt.Sprintf("Dumped to %s; MariaDB %s upgrades the files when it starts", dump, c.To)
+			return result
+		}
+
+		if output, err := exec.Command("docker", "stop", c.Container).CombinedOutput(); err != nil {
+			return fail(fmt.Errorf("docker stop %s failed: %s", c.Container, strings.TrimSpace(string(output))))
+		}
+		if _, err := os.Stat(oldDir); err == nil {
+			oldDir += "-" + time.Now().Format("20060102-150405")
+		}
+		if err := os.Rename(c.DataDir, oldDir); err != nil {
+			return fail(fmt.Errorf("cannot move the old files aside: %w", err))
+		}
+		if err := os.Mkdir(c.DataDir, 0700); err != nil {
+			return fail(err)
+		}
+
+		// Only the database: the apps must not create tables before the reload
+		if output, err := exec.Command("docker", "compose", "-f", composeFile, "up", "-d", c.Service).CombinedOutput(); err != nil {
+			return fail(fmt.Errorf("docker compose up %s failed: %s", c.Service, strings.TrimSpace(string(output))))
+		}
+		if err := waitForDatabase(c.Database, 5*time.Minute); err != nil {
+			return fail(fmt.Errorf("%w; the old files are in %s", err, oldDir))
+		}
+		if err := restoreDatabase(c.Database, dump); err != nil {
+			return fail(fmt.Errorf("%w; the old files are in %s", err, oldDir))
+		}
+
+		result.Success = true
+		result.Message = fmt.Sprintf("Reloaded into Postgres %s; the %s files are in %s and the dump in %s, delete both once the apps work",
+			c.To, c.From, oldDir, dump)
+		return result
+	})
+}
+
+// waitForDatabase waits until a database accepts connections. For
+// Postgres it asks over TCP: while the entrypoint initializes an empty
+// directory, a temporary server answers on the socket only.
+func waitForDatabase(db Database, timeout time.Duration) error {
+	check := []string{"exec", db.Container, "pg_isready", "-h", "127.0.0.1", "-U", db.User}
+	if db.Engine == EngineMariaDB {
+		check = []string{"exec", db.Container, "healthcheck.sh", "--connect", "--innodb_initialized"}
+	}
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if exec.Command("docker", check...).Run() == nil {
+			return nil
+		}
+		time.Sleep(2 * time.Second)
+	}
+	return fmt.Errorf("%s did not accept connections within %s", db.Container, timeout)
+}
+
+// dumpDatabase writes everything in a database to path with the tools of
+// the image it runs
+func dumpDatabase(db Database, path string) error {
+	args := []string{"exec", db.Container, "pg_dumpall", "--clean", "--if-exists", "-U", db.User}
+	if db.Engine == EngineMariaDB {
+		args = []string{"exec", db.Container, "sh", "-c",
+			`exec mariadb-dump --all-databases --single-transaction --routines --events -uroot -p"$MYSQL_ROOT_PASSWORD"`}
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var stderr strings.Builder
+	cmd := exec.Command("docker", args...)
+	cmd.Stdout = f
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("dumping %s failed: %s: %w", db.Container, strings.TrimSpace(stderr.String()), err)
+	}
+	return f.Sync()
+}
+
+// restoreDatabase reloads a pg_dumpall into a fresh cluster. psql keeps
+// going past errors, so they are collected instead and all but the
+// expected ones fail the restore; the full output is kept next to the
+// dump.
+func restoreDatabase(db Database, dump string) error {
+	f, err := os.Open(dump)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	reader, writer := io.Pipe()
+	go func() {
+		in := bufio.NewReader(f)
+		for {
+			line, err := in.ReadString('\n')
+			if strings.TrimSpace(line) == searchPathReset {
+				line = searchPathKeep + "\n"
+			}
+			if _, werr := io.WriteString(writer, line); werr != nil {
+				return
+			}
+			if err != nil {
+				writer.CloseWithError(err)
+				return
+			}
+		}
+	}()
+
+	var output strings.Builder
+	cmd := exec.Command("docker", "exec", "-i", db.Container, "psql", "-U", db.User, "-d", "postgres", "-q")
+	cmd.Stdin = reader
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	runErr := cmd.Run()
+	reader.Close()
+	os.WriteFile(dump+".restore.log", []byte(output.String()), 0600)
+
+	unexpected := unexpectedRestoreErrors(output.String(), db.User)
+	if runErr != nil {
+		return fmt.Errorf("reloading %s failed: %w (see %s.restore.log)", db.Container, runErr, dump)
+	}
+	if len(unexpected) > 0 {
+		return fmt.Errorf("reloading %s reported %d errors, first: %s (see %s.restore.log)", db.Container, len(unexpected), unexpected[0], dump)
+	}
+	return nil
+}
+
+// containsAny reports whether s contains any of subs
+func containsAny(s string, subs []string) bool {
+	for _, sub := range subs {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
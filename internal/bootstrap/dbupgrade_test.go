@@ -0,0 +1,116 @@
+package bootstrap
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/madhav/servctl/internal/compose"
+	"github.com/madhav/servctl/internal/paths"
+)
+
+func TestVersionParts(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []int
+	}{
+		{"pg14-v0.2.0", []int{14}},
+		{"16-alpine", []int{16}},
+		{"11.4.2", []int{11, 4, 2}},
+		{"1:11.4.2+maria~ubu2404", []int{11, 4, 2}},
+		{"latest", nil},
+	}
+	for _, tt := range tests {
+		got := versionParts(tt.in)
+		if len(got) != len(tt.want) || compareVersions(got, tt.want, len(tt.want)) != 0 {
+			t.Errorf("versionParts(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestPlanDatabaseUpgrades(t *testing.T) {
+	config := compose.DefaultConfig()
+	config.DataRoot = t.TempDir()
+	config.SSOEnabled = true
+	write := func(path, content string) {
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(filepath.Join(config.Path(paths.ImmichDB), "PG_VERSION"), "14\n")
+	write(filepath.Join(config.Path(paths.NextcloudDB), "mariadb_upgrade_info"), "11.4.2-MariaDB")
+	write(filepath.Join(config.Path(paths.AuthentikDB), "PG_VERSION"), "16\n")
+
+	composeFile := filepath.Join(t.TempDir(), "docker-compose.yml")
+	write(composeFile, `services:
+  immich-postgres:
+    container_name: immich_postgres
+    image: docker.io/tensorchord/pgvecto-rs:pg16-v0.3.0
+  nextcloud-mariadb:
+    container_name: nextcloud_mariadb
+    image: mariadb:10.11
+  authentik-postgres:
+    container_name: authentik_postgres
+    image: docker.io/library/postgres:16-alpine
+`)
+
+	changes, err := PlanDatabaseUpgrades(config, composeFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 2 {
+		t.Fatalf("PlanDatabaseUpgrades() = %v, want the Immich and Nextcloud databases", changes)
+	}
+	immich, nextcloud := changes[0], changes[1]
+	if immich.Container != "immich_postgres" || immich.From != "14" || immich.To != "16" || immich.Downgrade() {
+		t.Errorf("Immich change = %+v, want an upgrade from 14 to 16", immich)
+	}
+	if nextcloud.Container != "nextcloud_mariadb" || !nextcloud.Downgrade() {
+		t.Errorf("Nextcloud change = %+v, want a downgrade", nextcloud)
+	}
+	if r := UpgradeDatabase(nextcloud, composeFile, true); r.Success {
+		t.Error("UpgradeDatabase() accepted a downgrade")
+	}
+}
+
+func TestPlanDatabaseUpgrades_UnreadableBlocks(t *testing.T) {
+	config := compose.DefaultConfig()
+	config.DataRoot = t.TempDir()
+	config.SSOEnabled = true
+	// Unreadable: a directory where the version file should be
+	os.MkdirAll(filepath.Join(config.Path(paths.ImmichDB), "PG_VERSION"), 0755)
+	os.MkdirAll(config.Path(paths.AuthentikDB), 0755)
+	os.WriteFile(filepath.Join(config.Path(paths.AuthentikDB), "PG_VERSION"), []byte("15\n"), 0644)
+
+	composeFile := filepath.Join(t.TempDir(), "docker-compose.yml")
+	os.WriteFile(composeFile, []byte(`services:
+  immich-postgres:
+    container_name: immich_postgres
+    image: docker.io/tensorchord/pgvecto-rs:pg16-v0.3.0
+  authentik-postgres:
+    container_name: authentik_postgres
+    image: docker.io/library/postgres:16-alpine
+`), 0644)
+
+	changes, err := PlanDatabaseUpgrades(config, composeFile)
+	if err == nil || !strings.Contains(err.Error(), "Immich database") {
+		t.Errorf("PlanDatabaseUpgrades() error = %v, want one for the Immich database", err)
+	}
+	if len(changes) != 1 || changes[0].Container != "authentik_postgres" {
+		t.Errorf("PlanDatabaseUpgrades() = %v, want the Authentik database checked after the Immich error", changes)
+	}
+}
+
+func TestUnexpectedRestoreErrors(t *testing.T) {
+	output := `ERROR:  current user cannot be dropped
+ERROR:  role "immich" already exists
+ERROR:  relation "assets" already exists
+ERROR:  type "vector" does not exist
+`
+	got := unexpectedRestoreErrors(output, "immich")
+	if len(got) != 2 || !strings.Contains(got[0], `relation "assets"`) || !strings.Contains(got[1], "vector") {
+		t.Errorf("unexpectedRestoreErrors() = %q, want the relation and type errors", got)
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !windows
+
+package bootstrap
+
+import "syscall"
+
+// diskFree returns the space available to unprivileged users on the
+// filesystem holding path, or 0 when it cannot be read
+func diskFree(path string) uint64 {
+	var stat syscall.Statfs_t
+	if syscall.Statfs(path, &stat) != nil {
+		return 0
+	}
+	return stat.Bavail * uint64(stat.Bsize)
+}
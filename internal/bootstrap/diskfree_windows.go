@@ -0,0 +1,6 @@
+package bootstrap
+
+// diskFree is not measured on Windows; images are only pulled on the server
+func diskFree(path string) uint64 {
+	return 0
+}
@@ -0,0 +1,151 @@
+package bootstrap
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/madhav/servctl/internal/compose"
+	"github.com/madhav/servctl/internal/ops"
+	"github.com/madhav/servctl/internal/utils"
+)
+
+// DiskFullJobs are the Immich queues paused while a disk is nearly full:
+// machine learning, video transcoding and thumbnails write steadily and
+// catch up once space is back. Uploads and the web app keep working.
+var DiskFullJobs = []string{
+	"thumbnailGeneration",
+	"videoConversion",
+	"smartSearch",
+	"faceDetection",
+	"facialRecognition",
+	"duplicateDetection",
+}
+
+// DiskFullFile records, relative to ~/infra, the Immich queues
+// PauseForDiskFull paused, so ResumeAfterDiskFull resumes only those and
+// leaves queues paused by maintenance mode or the admin alone
+const DiskFullFile = "disk-emergency-jobs.json"
+
+// LoadDiskFull returns what PauseForDiskFull recorded, nil when nothing is
+// paused for a full disk
+func LoadDiskFull(infraRoot string) (*MaintenanceState, error) {
+	data, err := os.ReadFile(filepath.Join(infraRoot, DiskFullFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var state MaintenanceState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", DiskFullFile, err)
+	}
+	return &state, nil
+}
+
+// PauseForDiskFull pauses the DiskFullJobs queues that are running and
+// returns their names. reason names the mounts that are full.
+func PauseForDiskFull(config *compose.ServiceConfig, infraRoot, reason string, dryRun bool) ([]string, error) {
+	path := filepath.Join(infraRoot, DiskFullFile)
+	var paused []string
+	err := ops.Execute(dryRun, ops.Func{
+		Description: "pause the running Immich jobs among " + strings.Join(DiskFullJobs, ", ") + " and record them in " + path,
+		Fn: func() error {
+			state, err := LoadDiskFull(infraRoot)
+			if err != nil {
+				return err
+			}
+			if state == nil {
+				state = &MaintenanceState{Since: time.Now()}
+			}
+			state.Reason = reason
+
+			client, err := loginImmichForMaintenance(config)
+			if err != nil {
+				return err
+			}
+			paused, err = pauseQueues(client, DiskFullJobs)
+			state.PausedJobs = append(state.PausedJobs, paused...)
+
+			// Recorded even after a failure, so what was paused is resumed
+			data, merr := json.MarshalIndent(state, "", "  ")
+			if merr != nil {
+				return merr
+			}
+			if werr := utils.AtomicWrite(path, data, 0644); werr != nil {
+				return werr
+			}
+			return err
+		},
+	})
+	return paused, err
+}
+
+// pauseQueues pauses those of names that are running and returns them;
+// queues already paused, or absent from this Immich version, are skipped
+func pauseQueues(client *ImmichClient, names []string) ([]string, error) {
+	queues, err := client.JobQueues()
+	if err != nil {
+		return nil, err
+	}
+	var paused []string
+	for _, name := range names {
+		if isPaused, ok := queues[name]; !ok || isPaused {
+			continue
+		}
+		if err := client.SetJobPaused(name, true); err != nil {
+			return paused, err
+		}
+		paused = append(paused, name)
+	}
+	return paused, nil
+}
+
+// ResumeAfterDiskFull resumes the queues PauseForDiskFull paused and
+// returns their names. Queues that fail to resume stay recorded, for the
+// next try.
+func ResumeAfterDiskFull(config *compose.ServiceConfig, infraRoot string, dryRun bool) ([]string, error) {
+	state, err := LoadDiskFull(infraRoot)
+	if err != nil || state == nil {
+		return nil, err
+	}
+
+	path := filepath.Join(infraRoot, DiskFullFile)
+	var resumed []string
+	err = ops.Execute(dryRun, ops.Func{
+		Description: "resume Immich jobs: " + strings.Join(state.PausedJobs, ", ") + " and remove " + path,
+		Fn: func() error {
+			var failed []string
+			if len(state.PausedJobs) > 0 {
+				client, err := loginImmichForMaintenance(config)
+				if err != nil {
+					return err
+				}
+				for _, name := range state.PausedJobs {
+					if err := client.SetJobPaused(name, false); err != nil {
+						failed = append(failed, name)
+					} else {
+						resumed = append(resumed, name)
+					}
+				}
+			}
+
+			if len(failed) > 0 {
+				state.PausedJobs = failed
+				if data, err := json.MarshalIndent(state, "", "  "); err == nil {
+					utils.AtomicWrite(path, data, 0644)
+				}
+				return fmt.Errorf("Immich job queues still paused: %s (resume them under Administration → Jobs)", strings.Join(failed, ", "))
+			}
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			return nil
+		},
+	})
+	return resumed, err
+}
@@ -0,0 +1,75 @@
+package bootstrap
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/madhav/servctl/internal/compose"
+)
+
+func TestPauseQueues_DiskFull(t *testing.T) {
+	queues := map[string]bool{"videoConversion": false, "smartSearch": true, "thumbnailGeneration": false, "library": false}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/api/jobs":
+			out := map[string]interface{}{}
+			for name, paused := range queues {
+				out[name] = map[string]interface{}{"queueStatus": map[string]bool{"isPaused": paused}}
+			}
+			json.NewEncoder(w).Encode(out)
+		case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, "/api/jobs/"):
+			var body struct{ Command string }
+			json.NewDecoder(r.Body).Decode(&body)
+			queues[strings.TrimPrefix(r.URL.Path, "/api/jobs/")] = body.Command == "pause"
+			w.Write([]byte(`{}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client := &ImmichClient{BaseURL: server.URL, HTTP: server.Client()}
+	paused, err := pauseQueues(client, DiskFullJobs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Only the writers: smart search was paused already, the library scan
+	// and queues this Immich lacks are left alone
+	if want := []string{"thumbnailGeneration", "videoConversion"}; !reflect.DeepEqual(paused, want) {
+		t.Errorf("paused = %v, want %v", paused, want)
+	}
+	if queues["library"] {
+		t.Error("the library queue was paused")
+	}
+}
+
+func TestDiskFull_DryRun(t *testing.T) {
+	infraRoot := t.TempDir()
+	config := compose.DefaultConfig()
+
+	var err error
+	out := captureStdout(t, func() { _, err = PauseForDiskFull(config, infraRoot, "disk full: /mnt/data", true) })
+	if err != nil || !strings.Contains(out, "[DRY RUN] Would pause the running Immich jobs among thumbnailGeneration") {
+		t.Errorf("PauseForDiskFull dry run = %v, printed %q", err, out)
+	}
+	if state, _ := LoadDiskFull(infraRoot); state != nil {
+		t.Error("a dry run recorded paused jobs")
+	}
+
+	state := MaintenanceState{PausedJobs: []string{"videoConversion"}}
+	data, _ := json.Marshal(state)
+	os.WriteFile(filepath.Join(infraRoot, DiskFullFile), data, 0644)
+	out = captureStdout(t, func() { _, err = ResumeAfterDiskFull(config, infraRoot, true) })
+	if err != nil || !strings.Contains(out, "[DRY RUN] Would resume Immich jobs: videoConversion") {
+		t.Errorf("ResumeAfterDiskFull dry run = %v, printed %q", err, out)
+	}
+	if _, err := os.Stat(filepath.Join(infraRoot, DiskFullFile)); err != nil {
+		t.Error("a dry run removed the record of paused jobs")
+	}
+}
@@ -0,0 +1,58 @@
+package bootstrap
+
+import (
+	"fmt"
+	"os/exec"
+
+	"github.com/madhav/servctl/internal/compose"
+	"github.com/madhav/servctl/internal/ops"
+	"github.com/madhav/servctl/internal/pkgmgr"
+)
+
+// ConfigureLocalDNS installs and (re)starts dnsmasq serving the local names
+func ConfigureLocalDNS(config *compose.ServiceConfig, dryRun bool) StepResult {
+	result := StepResult{Name: "Local DNS"}
+
+	if !config.LocalDNSEnabled {
+		result.Success = true
+		result.Message = "Local DNS not enabled, skipped"
+		return result
+	}
+	if config.Rootless {
+		result.Success = true
+		result.Message = "dnsmasq needs root to bind port 53, skipped (rootless mode)"
+		return result
+	}
+
+	// Written before installing so dnsmasq never starts on all interfaces,
+	// where it would clash with systemd-resolved on 127.0.0.53
+	if err := compose.WriteDnsmasqConfig(config, dryRun); err != nil {
+		result.Error = err
+		result.Message = err.Error()
+		return result
+	}
+
+	var steps []ops.Operation
+	if _, err := exec.LookPath("dnsmasq"); err != nil {
+		steps = append(steps, ops.Func{Description: "install dnsmasq", Fn: func() error {
+			_, err := pkgmgr.Default().Install([]string{"dnsmasq"}, nil)
+			return err
+		}})
+	}
+
+	subnet := compose.LANSubnet(config.HostIP)
+	steps = append(steps, ops.Command{Args: []string{"sudo", "systemctl", "restart", "dnsmasq"}})
+	if compose.IsUFWInstalled() {
+		steps = append(steps, ops.Command{Args: []string{"sudo", "ufw", "allow", "from", subnet, "to", "any", "port", "53"}})
+	}
+
+	if err := ops.Execute(dryRun, steps...); err != nil {
+		result.Error = err
+		result.Message = err.Error()
+		return result
+	}
+
+	result.Success = true
+	result.Message = fmt.Sprintf("Serving *.%s on %s:53 to %s", config.LocalDomain, config.HostIP, subnet)
+	return result
+}
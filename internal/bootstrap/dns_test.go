@@ -0,0 +1,37 @@
+package bootstrap
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/madhav/servctl/internal/compose"
+)
+
+func TestConfigureLocalDNS_DryRun(t *testing.T) {
+	config := compose.DefaultConfig()
+	config.HostIP = "192.168.1.100"
+
+	if result := ConfigureLocalDNS(config, true); !strings.Contains(result.Message, "skipped") {
+		t.Errorf("Local DNS should be skipped when disabled, got %q", result.Message)
+	}
+
+	config.LocalDNSEnabled = true
+	result := ConfigureLocalDNS(config, true)
+	if !result.Success {
+		t.Fatalf("ConfigureLocalDNS dry run failed: %s", result.Message)
+	}
+	if !strings.Contains(result.Message, "*.home.arpa") {
+		t.Errorf("Message should name the domain, got %q", result.Message)
+	}
+}
+
+func TestConfigureLocalDNS_Rootless(t *testing.T) {
+	config := compose.DefaultConfig()
+	config.LocalDNSEnabled = true
+	config.Rootless = true
+
+	result := ConfigureLocalDNS(config, true)
+	if !result.Success || !strings.Contains(result.Message, "rootless") {
+		t.Errorf("Local DNS should be skipped in rootless mode, got %q", result.Message)
+	}
+}
@@ -0,0 +1,192 @@
+package bootstrap
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/madhav/servctl/internal/compose"
+	"github.com/madhav/servctl/internal/paths"
+)
+
+// windowsReserved are device names Windows refuses as a file name, with or
+// without an extension ("NUL.txt" too)
+var windowsReserved = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// illegalChars cannot appear in a Windows file name; ':' is also the one
+// character macOS refuses
+const illegalChars = `<>:"\|?*`
+
+// FilenameIssue is a file or folder in a user's Nextcloud files that the
+// desktop client on Windows or macOS cannot create, so it never syncs
+// there and the client only says so in its activity log
+type FilenameIssue struct {
+	Path   string // On the host
+	User   string
+	Reason string
+	Rename string // A name that syncs everywhere, in the same folder
+}
+
+// FilenameProblem reports why Windows or macOS cannot hold a file named
+// name, or "" when they can
+func FilenameProblem(name string) string {
+	for _, r := range name {
+		if r < 0x20 {
+			return "control character in the name"
+		}
+		if strings.ContainsRune(illegalChars, r) {
+			return fmt.Sprintf("contains %q", r)
+		}
+	}
+	if strings.HasSuffix(name, ".") || strings.HasSuffix(name, " ") {
+		return "ends with a dot or space"
+	}
+	if stem, _, _ := strings.Cut(name, "."); windowsReserved[strings.ToUpper(stem)] {
+		return "reserved name on Windows"
+	}
+	return ""
+}
+
+// SafeFilename returns name with what FilenameProblem objects to replaced:
+// illegal characters become '_', trailing dots and spaces are dropped and
+// reserved names get a '_' ("CON.txt" becomes "CON_.txt")
+func SafeFilename(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		if r < 0x20 || strings.ContainsRune(illegalChars, r) {
+			r = '_'
+		}
+		b.WriteRune(r)
+	}
+	safe := strings.TrimRight(b.String(), ". ")
+	if safe == "" {
+		safe = "_"
+	}
+	if stem, rest, found := strings.Cut(safe, "."); windowsReserved[strings.ToUpper(stem)] {
+		safe = stem + "_"
+		if found {
+			safe += "." + rest
+		}
+	}
+	return safe
+}
+
+// uniqueName returns name, or "name (2).ext" and so on when a name that
+// differs only in case is taken in the folder
+func uniqueName(name string, taken map[string]bool) string {
+	ext := filepath.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	candidate := name
+	for n := 2; taken[strings.ToLower(candidate)]; n++ {
+		candidate = fmt.Sprintf("%s (%d)%s", stem, n, ext)
+	}
+	taken[strings.ToLower(candidate)] = true
+	return candidate
+}
+
+// CheckFilenames scans every user's Nextcloud files for names the Windows
+// and macOS clients cannot sync: those FilenameProblem rejects, and names
+// that differ only in case, which the case-insensitive file systems of
+// both cannot hold side by side
+func CheckFilenames(config *compose.ServiceConfig) ([]FilenameIssue, error) {
+	dataDir := filepath.Join(config.Path(paths.CloudData), "data")
+	users, err := os.ReadDir(dataDir)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read Nextcloud's data directory: %w", err)
+	}
+	var issues []FilenameIssue
+	for _, u := range users {
+		files := filepath.Join(dataDir, u.Name(), "files")
+		if info, err := os.Stat(files); err != nil || !info.IsDir() {
+			continue // appdata_*, files_external and the like
+		}
+		found, err := checkDir(files, u.Name())
+		if err != nil {
+			return nil, err
+		}
+		issues = append(issues, found...)
+	}
+	return issues, nil
+}
+
+// checkDir checks the names in dir and every folder below it
+func checkDir(dir, user string) ([]FilenameIssue, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	taken := make(map[string]bool)
+	for _, e := range entries {
+		taken[strings.ToLower(e.Name())] = true
+	}
+
+	var issues []FilenameIssue
+	seen := make(map[string]string) // Lower-case name to the first name seen
+	for _, e := range entries {
+		name := e.Name()
+		reason := FilenameProblem(name)
+		rename := ""
+		if reason != "" {
+			rename = uniqueName(SafeFilename(name), taken)
+		} else if first, clash := seen[strings.ToLower(name)]; clash {
+			reason = "differs only in case from " + first
+			rename = uniqueName(name, taken)
+		} else {
+			seen[strings.ToLower(name)] = name
+		}
+		if reason != "" {
+			issues = append(issues, FilenameIssue{Path: filepath.Join(dir, name), User: user, Reason: reason, Rename: rename})
+		}
+
+		// Type() does not follow symlinks, so links are not descended into
+		if e.Type().IsDir() {
+			below, err := checkDir(filepath.Join(dir, name), user)
+			if err != nil {
+				return nil, err
+			}
+			issues = append(issues, below...)
+		}
+	}
+	return issues, nil
+}
+
+// RenameFilenames gives each issue's file its suggested name, deepest
+// first so a renamed folder's contents are renamed before it moves. It
+// returns the users whose files changed, for a files:scan, and the
+// renames that failed.
+func RenameFilenames(issues []FilenameIssue) ([]string, []error) {
+	sorted := append([]FilenameIssue(nil), issues...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return strings.Count(sorted[i].Path, string(filepath.Separator)) > strings.Count(sorted[j].Path, string(filepath.Separator))
+	})
+
+	users := make(map[string]bool)
+	var errs []error
+	for _, issue := range sorted {
+		target := filepath.Join(filepath.Dir(issue.Path), issue.Rename)
+		if _, err := os.Lstat(target); err == nil {
+			errs = append(errs, fmt.Errorf("%s: %s already exists", issue.Path, issue.Rename))
+			continue
+		}
+		if err := os.Rename(issue.Path, target); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		users[issue.User] = true
+	}
+
+	var changed []string
+	for user := range users {
+		changed = append(changed, user)
+	}
+	sort.Strings(changed)
+	return changed, errs
+}
@@ -0,0 +1,97 @@
+package bootstrap
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/madhav/servctl/internal/compose"
+	"github.com/madhav/servctl/internal/paths"
+)
+
+func TestFilenameProblem(t *testing.T) {
+	tests := []struct {
+		name string
+		bad  bool
+		safe string
+	}{
+		{"holiday.jpg", false, "holiday.jpg"},
+		{"Q3: plan.docx", true, "Q3_ plan.docx"},
+		{`what?*.txt`, true, "what__.txt"},
+		{"notes.", true, "notes"},
+		{"draft ", true, "draft"},
+		{"CON", true, "CON_"},
+		{"nul.tar.gz", true, "nul_.tar.gz"},
+		{"console.log", false, "console.log"},
+		{"...", true, "_"},
+	}
+	for _, tt := range tests {
+		if got := FilenameProblem(tt.name) != ""; got != tt.bad {
+			t.Errorf("FilenameProblem(%q) = %q, want a problem: %v", tt.name, FilenameProblem(tt.name), tt.bad)
+		}
+		if got := SafeFilename(tt.name); got != tt.safe {
+			t.Errorf("SafeFilename(%q) = %q, want %q", tt.name, got, tt.safe)
+		}
+		if FilenameProblem(SafeFilename(tt.name)) != "" {
+			t.Errorf("SafeFilename(%q) = %q is still a problem", tt.name, SafeFilename(tt.name))
+		}
+	}
+}
+
+func TestCheckAndRenameFilenames(t *testing.T) {
+	config := compose.DefaultConfig()
+	config.DataRoot = t.TempDir()
+	dataDir := filepath.Join(config.Path(paths.CloudData), "data")
+	for _, p := range []string{
+		"alice/files/Work: 2024/plan?.txt",
+		"alice/files/Work: 2024/Work_ 2024.txt",
+		"alice/files/Report.pdf",
+		"alice/files/report.pdf",
+		"alice/files/fine.txt",
+		"bob/files/ok.txt",
+		"appdata_oc123/preview/x:y.png",
+	} {
+		path := filepath.Join(dataDir, p)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte("x"), 0644)
+	}
+
+	issues, err := CheckFilenames(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	renames := make(map[string]string)
+	for _, issue := range issues {
+		rel, _ := filepath.Rel(dataDir, issue.Path)
+		renames[rel] = issue.Rename
+	}
+	want := map[string]string{
+		"alice/files/Work: 2024":           "Work_ 2024",
+		"alice/files/Work: 2024/plan?.txt": "plan_.txt",
+		"alice/files/report.pdf":           "report (2).pdf",
+	}
+	if len(renames) != len(want) {
+		t.Errorf("CheckFilenames() = %v, want %v", renames, want)
+	}
+	for path, rename := range want {
+		if renames[path] != rename {
+			t.Errorf("%s: rename to %q, want %q", path, renames[path], rename)
+		}
+	}
+
+	users, errs := RenameFilenames(issues)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	if len(users) != 1 || users[0] != "alice" {
+		t.Errorf("RenameFilenames() users = %v, want [alice]", users)
+	}
+	for _, p := range []string{"alice/files/Work_ 2024/plan_.txt", "alice/files/Work_ 2024/Work_ 2024.txt", "alice/files/report (2).pdf"} {
+		if _, err := os.Stat(filepath.Join(dataDir, p)); err != nil {
+			t.Errorf("%s missing after the renames", p)
+		}
+	}
+	if issues, _ := CheckFilenames(config); len(issues) != 0 {
+		t.Errorf("CheckFilenames() after the renames = %v, want none", issues)
+	}
+}
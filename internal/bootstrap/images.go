@@ -0,0 +1,361 @@
+package bootstrap
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PullConcurrency is how many images are pulled at once
+const PullConcurrency = 4
+
+// UnpackFactor estimates disk use from compressed layer sizes; image layers
+// typically unpack to about twice their download size
+const UnpackFactor = 2
+
+// ComposeImages returns the images referenced by a compose file, in order
+// and without duplicates
+func ComposeImages(composeFile string) ([]string, error) {
+	content, err := os.ReadFile(composeFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", composeFile, err)
+	}
+
+	seen := make(map[string]bool)
+	var images []string
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "image:") {
+			continue
+		}
+		image := strings.Trim(strings.TrimSpace(strings.TrimPrefix(line, "image:")), `"'`)
+		if image != "" && !seen[image] {
+			seen[image] = true
+			images = append(images, image)
+		}
+	}
+	return images, nil
+}
+
+// ImageEstimate is the expected download for one image
+type ImageEstimate struct {
+	Image   string
+	Present bool   // Already in the local image store
+	Bytes   uint64 // Compressed layer total for this platform
+	Known   bool   // Bytes came from the registry manifest
+}
+
+// PullEstimate summarizes what pre-pulling will download and where it lands
+type PullEstimate struct {
+	Images        []ImageEstimate
+	DownloadBytes uint64
+	Unknown       int    // Images whose size could not be read
+	DockerRoot    string // Docker's data directory
+	DiskFree      uint64 // Free space under DockerRoot
+}
+
+// DiskNeeded estimates the space the unpacked images will take
+func (e PullEstimate) DiskNeeded() uint64 {
+	return e.DownloadBytes * UnpackFactor
+}
+
+// Fits reports whether the estimated images fit on Docker's disk
+func (e PullEstimate) Fits() bool {
+	return e.DiskFree == 0 || e.DiskNeeded() < e.DiskFree
+}
+
+// DownloadTime estimates how long the download takes at mbps megabits per second
+func (e PullEstimate) DownloadTime(mbps float64) time.Duration {
+	if mbps <= 0 {
+		return 0
+	}
+	seconds := float64(e.DownloadBytes) * 8 / (mbps * 1e6)
+	return time.Duration(seconds * float64(time.Second)).Round(time.Second)
+}
+
+// manifestEntry is one platform entry of `docker manifest inspect -v`
+type manifestEntry struct {
+	Descriptor struct {
+		Platform struct {
+			Architecture string `json:"architecture"`
+			OS           string `json:"os"`
+		} `json:"platform"`
+	}
+	SchemaV2Manifest *layerManifest
+	OCIManifest      *layerManifest
+}
+
+type layerManifest struct {
+	Layers []struct {
+		Size uint64 `json:"size"`
+	} `json:"layers"`
+}
+
+// parseManifestSize sums the compressed layers for linux/arch from
+// `docker manifest inspect -v` output, which is a single entry for plain
+// images and an array for multi-platform ones
+func parseManifestSize(data []byte, arch string) (uint64, bool) {
+	var entries []manifestEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		var single manifestEntry
+		if err := json.Unmarshal(data, &single); err != nil {
+			return 0, false
+		}
+		entries = []manifestEntry{single}
+	}
+
+	for _, entry := range entries {
+		platform := entry.Descriptor.Platform
+		if len(entries) > 1 && (platform.Architecture != arch || platform.OS != "linux") {
+			continue
+		}
+		manifest := entry.SchemaV2Manifest
+		if manifest == nil {
+			manifest = entry.OCIManifest
+		}
+		if manifest == nil {
+			continue
+		}
+		var total uint64
+		for _, layer := range manifest.Layers {
+			total += layer.Size
+		}
+		return total, true
+	}
+	return 0, false
+}
+
+// estimateImage checks the local store, then the registry manifest
+func estimateImage(image string) ImageEstimate {
+	estimate := ImageEstimate{Image: image}
+	if exec.Command("docker", "image", "inspect", image).Run() == nil {
+		estimate.Present = true
+		estimate.Known = true
+		return estimate
+	}
+
+	output, err := exec.Command("docker", "manifest", "inspect", "-v", image).Output()
+	if err != nil {
+		return estimate
+	}
+	estimate.Bytes, estimate.Known = parseManifestSize(output, runtime.GOARCH)
+	return estimate
+}
+
+// EstimatePull reads image sizes from the registry and free space on
+// Docker's data directory, without downloading any layers
+func EstimatePull(images []string) PullEstimate {
+	var estimate PullEstimate
+	for _, image := range images {
+		e := estimateImage(image)
+		estimate.Images = append(estimate.Images, e)
+		estimate.DownloadBytes += e.Bytes
+		if !e.Known {
+			estimate.Unknown++
+		}
+	}
+
+	if root := DockerRootDir(); root != "" {
+		estimate.DockerRoot = root
+		estimate.DiskFree = diskFree(root)
+	}
+	return estimate
+}
+
+// DockerRootDir returns Docker's data directory (images, containers and
+// named volumes), or "" when the daemon cannot be reached
+func DockerRootDir() string {
+	output, err := exec.Command("docker", "info", "--format", "{{.DockerRootDir}}").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// PullStatus is the progress of one image pull
+type PullStatus struct {
+	Image       string
+	LayersDone  int
+	LayersTotal int
+	Done        bool
+	Err         error
+}
+
+// pullLayerStates maps the per-layer lines of non-interactive `docker pull`
+// output to whether the layer is finished
+var pullLayerStates = map[string]bool{
+	"Pulling fs layer":   false,
+	"Waiting":            false,
+	"Downloading":        false,
+	"Verifying Checksum": false,
+	"Download complete":  false,
+	"Extracting":         false,
+	"Pull complete":      true,
+	"Already exists":     true,
+}
+
+// parsePullLine updates layer states from one line of `docker pull` output
+func parsePullLine(line string, layers map[string]bool) {
+	id, state, ok := strings.Cut(line, ": ")
+	if !ok || strings.Contains(id, " ") {
+		return
+	}
+	for prefix, done := range pullLayerStates {
+		if strings.HasPrefix(state, prefix) {
+			layers[id] = layers[id] || done
+			return
+		}
+	}
+}
+
+// PullImages pulls images concurrently, calling progress with a snapshot of
+// every image's status whenever a layer changes state
+func PullImages(images []string, concurrency int, progress func([]PullStatus)) []PullStatus {
+	statuses := make([]PullStatus, len(images))
+	for i, image := range images {
+		statuses[i].Image = image
+	}
+
+	var mu sync.Mutex
+	report := func() {
+		if progress != nil {
+			progress(append([]PullStatus(nil), statuses...))
+		}
+	}
+
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < max(concurrency, 1); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				err := pullImage(images[i], func(layers map[string]bool) {
+					mu.Lock()
+					defer mu.Unlock()
+					statuses[i].LayersTotal = len(layers)
+					statuses[i].LayersDone = 0
+					for _, done := range layers {
+						if done {
+							statuses[i].LayersDone++
+						}
+					}
+					report()
+				})
+
+				mu.Lock()
+				statuses[i].Done = true
+				statuses[i].Err = err
+				report()
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for i := range images {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+
+	return statuses
+}
+
+// pullImage runs `docker pull` for one image, reporting layer changes
+func pullImage(image string, update func(map[string]bool)) error {
+	cmd := exec.Command("docker", "pull", image)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	layers := make(map[string]bool)
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		parsePullLine(scanner.Text(), layers)
+		update(layers)
+	}
+
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("docker pull %s failed: %s", image, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// RenderPullProgress formats the single-line combined pull display
+func RenderPullProgress(statuses []PullStatus) string {
+	done, layersDone, layersTotal := 0, 0, 0
+	var pulling []string
+	for _, s := range statuses {
+		layersDone += s.LayersDone
+		layersTotal += s.LayersTotal
+		if s.Done {
+			done++
+		} else if s.LayersTotal > 0 {
+			pulling = append(pulling, imageShortName(s.Image))
+		}
+	}
+
+	line := fmt.Sprintf("  ⬇ %d/%d images", done, len(statuses))
+	if layersTotal > 0 {
+		line += fmt.Sprintf(" (%d/%d layers)", layersDone, layersTotal)
+	}
+	if len(pulling) > 0 {
+		line += " - pulling " + strings.Join(pulling, ", ")
+	}
+	return line
+}
+
+// imageShortName drops the registry, namespace and tag for display
+func imageShortName(image string) string {
+	name := image[strings.LastIndex(image, "/")+1:]
+	if i := strings.IndexAny(name, ":@"); i > 0 {
+		name = name[:i]
+	}
+	return name
+}
+
+// PrePullImages pulls every image in the compose file before the stack is
+// started, redrawing a combined progress line as layers complete
+func PrePullImages(images []string, dryRun bool) StepResult {
+	result := StepResult{Name: "Pull images"}
+
+	return runStep(result, dryRun, fmt.Sprintf("pull %d images, %d at a time", len(images), PullConcurrency), func() StepResult {
+		start := time.Now()
+		lastWidth := 0
+		statuses := PullImages(images, PullConcurrency, func(s []PullStatus) {
+			line := RenderPullProgress(s)
+			fmt.Printf("\r%-*s", lastWidth, line)
+			lastWidth = len(line)
+		})
+		fmt.Println()
+
+		var failed []string
+		for _, s := range statuses {
+			if s.Err != nil {
+				failed = append(failed, s.Err.Error())
+			}
+		}
+		if len(failed) > 0 {
+			result.Error = fmt.Errorf("%d of %d images failed: %s", len(failed), len(images), strings.Join(failed, "; "))
+			result.Message = result.Error.Error()
+			return result
+		}
+
+		result.Success = true
+		result.Message = fmt.Sprintf("%d images pulled in %s", len(images), time.Since(start).Round(time.Second))
+		return result
+	})
+}
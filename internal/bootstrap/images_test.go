@@ -0,0 +1,105 @@
+package bootstrap
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestComposeImages(t *testing.T) {
+	composeFile := filepath.Join(t.TempDir(), "docker-compose.yml")
+	content := `services:
+  immich-server:
+    image: ghcr.io/immich-app/immich-server:release
+  redis:
+    image: "docker.io/redis:6.2-alpine"
+  other:
+    image: ghcr.io/immich-app/immich-server:release
+`
+	if err := os.WriteFile(composeFile, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	images, err := ComposeImages(composeFile)
+	if err != nil {
+		t.Fatalf("ComposeImages() error: %v", err)
+	}
+	want := []string{"ghcr.io/immich-app/immich-server:release", "docker.io/redis:6.2-alpine"}
+	if !reflect.DeepEqual(images, want) {
+		t.Errorf("ComposeImages() = %v, want %v", images, want)
+	}
+}
+
+func TestParseManifestSize(t *testing.T) {
+	multi := `[
+  {"Descriptor": {"platform": {"architecture": "arm64", "os": "linux"}},
+   "SchemaV2Manifest": {"layers": [{"size": 999}]}},
+  {"Descriptor": {"platform": {"architecture": "amd64", "os": "linux"}},
+   "OCIManifest": {"layers": [{"size": 100}, {"size": 250}]}}
+]`
+	if size, ok := parseManifestSize([]byte(multi), "amd64"); !ok || size != 350 {
+		t.Errorf("multi-platform size = %d, %v; want 350, true", size, ok)
+	}
+
+	single := `{"Descriptor": {}, "SchemaV2Manifest": {"layers": [{"size": 42}]}}`
+	if size, ok := parseManifestSize([]byte(single), "amd64"); !ok || size != 42 {
+		t.Errorf("single-platform size = %d, %v; want 42, true", size, ok)
+	}
+
+	if _, ok := parseManifestSize([]byte("not json"), "amd64"); ok {
+		t.Error("invalid output should not produce a size")
+	}
+}
+
+func TestParsePullLine(t *testing.T) {
+	layers := make(map[string]bool)
+	for _, line := range []string{
+		"release: Pulling from immich-app/immich-server",
+		"a1b2c3: Already exists",
+		"d4e5f6: Pulling fs layer",
+		"d4e5f6: Download complete",
+		"Digest: sha256:0123",
+	} {
+		parsePullLine(line, layers)
+	}
+
+	if len(layers) != 2 || !layers["a1b2c3"] || layers["d4e5f6"] {
+		t.Errorf("layers = %v", layers)
+	}
+
+	parsePullLine("d4e5f6: Pull complete", layers)
+	if !layers["d4e5f6"] {
+		t.Error("layer should be done after Pull complete")
+	}
+}
+
+func TestRenderPullProgress(t *testing.T) {
+	line := RenderPullProgress([]PullStatus{
+		{Image: "docker.io/redis:6.2-alpine", LayersDone: 3, LayersTotal: 3, Done: true},
+		{Image: "ghcr.io/immich-app/immich-server:release", LayersDone: 4, LayersTotal: 10},
+		{Image: "nextcloud:29"},
+	})
+
+	for _, want := range []string{"1/3 images", "7/13 layers", "pulling immich-server"} {
+		if !strings.Contains(line, want) {
+			t.Errorf("progress line missing %q: %s", want, line)
+		}
+	}
+}
+
+func TestPullEstimate(t *testing.T) {
+	e := PullEstimate{DownloadBytes: 1e9, DiskFree: 3e9}
+	if !e.Fits() {
+		t.Error("2 GB unpacked should fit in 3 GB free")
+	}
+	e.DiskFree = 1.5e9
+	if e.Fits() {
+		t.Error("2 GB unpacked should not fit in 1.5 GB free")
+	}
+	if got := e.DownloadTime(100); got != 80*time.Second {
+		t.Errorf("DownloadTime(100) = %s, want 80s", got)
+	}
+}
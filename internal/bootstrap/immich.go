@@ -0,0 +1,190 @@
+package bootstrap
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/madhav/servctl/internal/compose"
+)
+
+// ImmichClient talks to the Immich REST API on the local host
+type ImmichClient struct {
+	BaseURL     string
+	AccessToken string
+	APIKey      string // Used instead of AccessToken to act as a family member
+	HTTP        *http.Client
+}
+
+// NewImmichClient creates a client for the Immich instance on the given port
+func NewImmichClient(port int) *ImmichClient {
+	return &ImmichClient{
+		BaseURL: fmt.Sprintf("http://127.0.0.1:%d", port),
+		HTTP:    &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+// do sends a JSON request and decodes the JSON response into out (if non-nil)
+func (c *ImmichClient) do(method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, c.BaseURL+path, reader)
+	if err != nil {
+		return fmt.Errorf("failed to build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if c.AccessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.AccessToken)
+	} else if c.APIKey != "" {
+		req.Header.Set("x-api-key", c.APIKey)
+	}
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s %s failed: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s %s returned %d: %s", method, path, resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+
+	if out != nil && len(respBody) > 0 {
+		if err := json.Unmarshal(respBody, out); err != nil {
+			return fmt.Errorf("failed to decode response: %w", err)
+		}
+	}
+	return nil
+}
+
+// Ping checks whether the Immich server is answering API requests
+func (c *ImmichClient) Ping() error {
+	var resp struct {
+		Res string `json:"res"`
+	}
+	if err := c.do(http.MethodGet, "/api/server/ping", nil, &resp); err != nil {
+		return err
+	}
+	if resp.Res != "pong" {
+		return fmt.Errorf("unexpected ping response: %q", resp.Res)
+	}
+	return nil
+}
+
+// WaitUntilReady polls the ping endpoint until Immich answers or timeout expires
+func (c *ImmichClient) WaitUntilReady(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if c.Ping() == nil {
+			return nil
+		}
+		time.Sleep(5 * time.Second)
+	}
+	return fmt.Errorf("immich did not become ready within %s", timeout)
+}
+
+// AdminSignUp creates the initial Immich admin account. It fails if an
+// admin already exists, which callers treat as non-fatal.
+func (c *ImmichClient) AdminSignUp(email, password, name string) error {
+	body := map[string]string{
+		"email":    email,
+		"password": password,
+		"name":     name,
+	}
+	return c.do(http.MethodPost, "/api/auth/admin-sign-up", body, nil)
+}
+
+// Login authenticates and stores the access token on the client
+func (c *ImmichClient) Login(email, password string) error {
+	var resp struct {
+		AccessToken string `json:"accessToken"`
+	}
+	body := map[string]string{"email": email, "password": password}
+	if err := c.do(http.MethodPost, "/api/auth/login", body, &resp); err != nil {
+		return err
+	}
+	if resp.AccessToken == "" {
+		return fmt.Errorf("login succeeded but no access token was returned")
+	}
+	c.AccessToken = resp.AccessToken
+	return nil
+}
+
+// immichUserRequest builds the admin user-create payload for a family member
+func immichUserRequest(m compose.FamilyMember) (map[string]interface{}, error) {
+	quota, err := compose.ParseQuota(m.Quota)
+	if err != nil {
+		return nil, err
+	}
+
+	body := map[string]interface{}{
+		"email":                m.Email,
+		"name":                 m.Name,
+		"password":             m.Password,
+		"shouldChangePassword": true,
+	}
+	if quota > 0 {
+		body["quotaSizeInBytes"] = quota
+	}
+	return body, nil
+}
+
+// CreateUser creates a family member account (requires an admin login)
+func (c *ImmichClient) CreateUser(m compose.FamilyMember) error {
+	body, err := immichUserRequest(m)
+	if err != nil {
+		return err
+	}
+	return c.do(http.MethodPost, "/api/admin/users", body, nil)
+}
+
+// UpdateSystemConfig merges values into one section of Immich's system
+// configuration. The full config is fetched and written back because the
+// API replaces it wholesale.
+func (c *ImmichClient) UpdateSystemConfig(section string, values map[string]interface{}) error {
+	var systemConfig map[string]interface{}
+	if err := c.do(http.MethodGet, "/api/system-config", nil, &systemConfig); err != nil {
+		return err
+	}
+
+	current, _ := systemConfig[section].(map[string]interface{})
+	systemConfig[section] = mergeConfig(current, values)
+
+	return c.do(http.MethodPut, "/api/system-config", systemConfig, nil)
+}
+
+// mergeConfig overlays values onto current, descending into nested sections
+// so settings that are not mentioned keep their values
+func mergeConfig(current, values map[string]interface{}) map[string]interface{} {
+	if current == nil {
+		current = make(map[string]interface{})
+	}
+	for k, v := range values {
+		nested, isMap := v.(map[string]interface{})
+		existing, hasMap := current[k].(map[string]interface{})
+		if isMap && hasMap {
+			current[k] = mergeConfig(existing, nested)
+		} else {
+			current[k] = v
+		}
+	}
+	return current
+}
+
+// UpdateOAuthConfig enables OAuth login in Immich's system configuration
+func (c *ImmichClient) UpdateOAuthConfig(oauth map[string]interface{}) error {
+	return c.UpdateSystemConfig("oauth", oauth)
+}
@@ -0,0 +1,95 @@
+package bootstrap
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/madhav/servctl/internal/compose"
+)
+
+// immichStorageTemplateSettings is the storageTemplate section of Immich's
+// system configuration for a template
+func immichStorageTemplateSettings(template string) map[string]interface{} {
+	return map[string]interface{}{
+		"enabled":                 true,
+		"hashVerificationEnabled": true,
+		"template":                template,
+	}
+}
+
+// SetStorageLabel names a user's library folder (gallery/library/<label>)
+// instead of the user's UUID (requires an admin login)
+func (c *ImmichClient) SetStorageLabel(userID, label string) error {
+	return c.do(http.MethodPut, "/api/admin/users/"+userID, map[string]string{"storageLabel": label}, nil)
+}
+
+// StartStorageMigration starts the job that moves existing originals into
+// the current storage template's layout
+func (c *ImmichClient) StartStorageMigration() error {
+	body := map[string]interface{}{"command": "start", "force": false}
+	return c.do(http.MethodPut, "/api/jobs/storageTemplateMigration", body, nil)
+}
+
+// ConfigureImmichLibrary applies the storage template, labels each family
+// member's library folder with their username, and starts the migration
+// job so files uploaded before (or under an older template) follow the
+// layout too
+func ConfigureImmichLibrary(config *compose.ServiceConfig, dryRun bool) StepResult {
+	result := StepResult{Name: "Immich folder layout"}
+
+	if config.ImmichStorageTemplate == "" {
+		result.Success = true
+		result.Message = "Immich default layout, skipped"
+		return result
+	}
+	if err := compose.ValidateStorageTemplate(config.ImmichStorageTemplate); err != nil {
+		result.Error = err
+		result.Message = err.Error()
+		return result
+	}
+
+	return runStep(result, dryRun, "have Immich file originals as library/<user>/"+config.ImmichStorageTemplate, func() StepResult {
+		client, err := loginImmichAdmin(config)
+		if err != nil {
+			result.Error = err
+			result.Message = err.Error()
+			return result
+		}
+		if err := client.UpdateSystemConfig("storageTemplate", immichStorageTemplateSettings(config.ImmichStorageTemplate)); err != nil {
+			result.Error = fmt.Errorf("failed to set the storage template: %w", err)
+			result.Message = result.Error.Error()
+			return result
+		}
+
+		var failed []string
+		if len(config.Users) > 0 {
+			ids, err := client.UserIDs()
+			if err != nil {
+				failed = append(failed, fmt.Sprintf("storage labels (%v)", err))
+			}
+			for _, m := range config.Users {
+				id := ids[strings.ToLower(m.Email)]
+				if id == "" {
+					continue
+				}
+				if err := client.SetStorageLabel(id, m.Username); err != nil {
+					failed = append(failed, fmt.Sprintf("%s label (%v)", m.Email, err))
+				}
+			}
+		}
+		if err := client.StartStorageMigration(); err != nil {
+			failed = append(failed, fmt.Sprintf("migration job (%v)", err))
+		}
+
+		if len(failed) > 0 {
+			result.Error = fmt.Errorf("template set, but failed: %s", strings.Join(failed, ", "))
+			result.Message = result.Error.Error()
+			return result
+		}
+
+		result.Success = true
+		result.Message = fmt.Sprintf("Originals filed as library/<user>/%s", config.ImmichStorageTemplate)
+		return result
+	})
+}
@@ -0,0 +1,77 @@
+package bootstrap
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/madhav/servctl/internal/compose"
+)
+
+func TestConfigureImmichLibrary(t *testing.T) {
+	var systemConfig map[string]interface{}
+	labels := map[string]string{}
+	migrated := false
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.Path {
+		case "GET /api/server/ping":
+			w.Write([]byte(`{"res":"pong"}`))
+		case "POST /api/auth/admin-sign-up":
+			w.WriteHeader(http.StatusBadRequest)
+		case "POST /api/auth/login":
+			w.Write([]byte(`{"accessToken":"token123"}`))
+		case "GET /api/system-config":
+			w.Write([]byte(`{"storageTemplate":{"enabled":false,"template":"old"},"ffmpeg":{"crf":23}}`))
+		case "PUT /api/system-config":
+			json.NewDecoder(r.Body).Decode(&systemConfig)
+		case "GET /api/admin/users":
+			w.Write([]byte(`[{"id":"id-jane","email":"jane@example.com"}]`))
+		case "PUT /api/admin/users/id-jane":
+			var body map[string]string
+			json.NewDecoder(r.Body).Decode(&body)
+			labels["id-jane"] = body["storageLabel"]
+		case "PUT /api/jobs/storageTemplateMigration":
+			migrated = true
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	config := sharingTestConfig(t, server)
+	r := ConfigureImmichLibrary(config, false)
+	if !r.Success {
+		t.Fatalf("ConfigureImmichLibrary() failed: %s", r.Message)
+	}
+
+	tmpl := systemConfig["storageTemplate"].(map[string]interface{})
+	if tmpl["enabled"] != true || tmpl["template"] != compose.DefaultStorageTemplate {
+		t.Errorf("storageTemplate = %v", tmpl)
+	}
+	if systemConfig["ffmpeg"] == nil {
+		t.Error("other sections of the system config should be kept")
+	}
+	if labels["id-jane"] != "jane.doe" {
+		t.Errorf("storage labels = %v, want jane's username", labels)
+	}
+	if !migrated {
+		t.Error("the storage template migration job should be started")
+	}
+}
+
+func TestConfigureImmichLibrary_Skipped(t *testing.T) {
+	config := compose.DefaultConfig()
+	config.ImmichStorageTemplate = ""
+	if r := ConfigureImmichLibrary(config, false); !r.Success || !strings.Contains(r.Message, "skipped") {
+		t.Errorf("without a template the step should skip: %+v", r)
+	}
+
+	config.ImmichStorageTemplate = "{{y}}/{{bogus}}/{{filename}}"
+	if r := ConfigureImmichLibrary(config, true); r.Success {
+		t.Error("an invalid template should fail before touching Immich")
+	}
+}
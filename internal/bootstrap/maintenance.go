@@ -0,0 +1,191 @@
+package bootstrap
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/madhav/servctl/internal/compose"
+	"github.com/madhav/servctl/internal/ops"
+	"github.com/madhav/servctl/internal/utils"
+)
+
+// MaintenanceFile records, relative to ~/infra, that maintenance mode is on
+// and which Immich job queues servctl paused, so turning it off resumes
+// only those and leaves queues the admin paused alone
+const MaintenanceFile = "maintenance-mode.json"
+
+// MaintenanceState is what MaintenanceFile holds
+type MaintenanceState struct {
+	Since      time.Time
+	Reason     string
+	PausedJobs []string `json:",omitempty"`
+}
+
+// MaintenancePath returns the maintenance mode record under infraRoot
+func MaintenancePath(infraRoot string) string {
+	return filepath.Join(infraRoot, MaintenanceFile)
+}
+
+// LoadMaintenance returns the maintenance mode record, nil when it is off
+func LoadMaintenance(infraRoot string) (*MaintenanceState, error) {
+	data, err := os.ReadFile(MaintenancePath(infraRoot))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var state MaintenanceState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", MaintenanceFile, err)
+	}
+	return &state, nil
+}
+
+// JobQueues returns Immich's background job queues and whether each is paused
+func (c *ImmichClient) JobQueues() (map[string]bool, error) {
+	var jobs map[string]struct {
+		QueueStatus struct {
+			IsPaused bool `json:"isPaused"`
+		} `json:"queueStatus"`
+	}
+	if err := c.do(http.MethodGet, "/api/jobs", nil, &jobs); err != nil {
+		return nil, err
+	}
+	queues := make(map[string]bool, len(jobs))
+	for name, job := range jobs {
+		queues[name] = job.QueueStatus.IsPaused
+	}
+	return queues, nil
+}
+
+// SetJobPaused pauses or resumes one Immich job queue. Jobs already running
+// finish; nothing new starts while the queue is paused.
+func (c *ImmichClient) SetJobPaused(name string, paused bool) error {
+	command := "resume"
+	if paused {
+		command = "pause"
+	}
+	return c.do(http.MethodPut, "/api/jobs/"+name, map[string]interface{}{"command": command, "force": false}, nil)
+}
+
+// loginImmichForMaintenance logs in as the Immich admin without waiting for
+// Immich or signing up: maintenance mode is for a stack that is running
+func loginImmichForMaintenance(config *compose.ServiceConfig) (*ImmichClient, error) {
+	client := NewImmichClient(config.ImmichPort)
+	if err := client.Login(config.ImmichAdminEmail, config.ImmichAdminPass); err != nil {
+		return nil, fmt.Errorf("immich admin login failed: %w", err)
+	}
+	return client, nil
+}
+
+// pauseImmichJobs pauses every running job queue and returns their names
+func pauseImmichJobs(client *ImmichClient) ([]string, error) {
+	queues, err := client.JobQueues()
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for name, paused := range queues {
+		if !paused {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var paused []string
+	for _, name := range names {
+		if err := client.SetJobPaused(name, true); err != nil {
+			return paused, err
+		}
+		paused = append(paused, name)
+	}
+	return paused, nil
+}
+
+// EnableMaintenance puts Nextcloud into maintenance mode (clients get its
+// maintenance page and retry later) and pauses Immich's background jobs, so
+// files and databases hold still for a backup or restore. Immich keeps
+// serving its web app and accepting uploads; it has no maintenance mode.
+func EnableMaintenance(config *compose.ServiceConfig, infraRoot, reason string, dryRun bool) error {
+	return ops.Execute(dryRun, ops.Func{
+		Description: "put Nextcloud into maintenance mode, pause Immich background jobs and write " + MaintenancePath(infraRoot),
+		Fn: func() error {
+			state, err := LoadMaintenance(infraRoot)
+			if err != nil {
+				return err
+			}
+			if state == nil {
+				state = &MaintenanceState{Since: time.Now(), Reason: reason}
+			}
+
+			if err := RunOCC([]string{"maintenance:mode", "--on"}, false); err != nil {
+				return err
+			}
+
+			var immichErr error
+			client, err := loginImmichForMaintenance(config)
+			if err == nil {
+				var paused []string
+				paused, err = pauseImmichJobs(client)
+				state.PausedJobs = append(state.PausedJobs, paused...)
+			}
+			if err != nil {
+				immichErr = fmt.Errorf("Nextcloud is in maintenance mode, but Immich jobs were not paused: %w", err)
+			}
+
+			data, err := json.MarshalIndent(state, "", "  ")
+			if err != nil {
+				return err
+			}
+			if err := utils.AtomicWrite(MaintenancePath(infraRoot), data, 0644); err != nil {
+				return err
+			}
+			return immichErr
+		},
+	})
+}
+
+// DisableMaintenance takes Nextcloud out of maintenance mode and resumes the
+// Immich queues EnableMaintenance paused
+func DisableMaintenance(config *compose.ServiceConfig, infraRoot string, dryRun bool) error {
+	return ops.Execute(dryRun, ops.Func{
+		Description: "take Nextcloud out of maintenance mode, resume Immich background jobs and remove " + MaintenancePath(infraRoot),
+		Fn: func() error {
+			state, err := LoadMaintenance(infraRoot)
+			if err != nil {
+				return err
+			}
+			if err := RunOCC([]string{"maintenance:mode", "--off"}, false); err != nil {
+				return err
+			}
+
+			if state != nil && len(state.PausedJobs) > 0 {
+				client, err := loginImmichForMaintenance(config)
+				if err != nil {
+					return fmt.Errorf("Nextcloud is back, but Immich jobs are still paused: %w", err)
+				}
+				var failed []string
+				for _, name := range state.PausedJobs {
+					if err := client.SetJobPaused(name, false); err != nil {
+						failed = append(failed, name)
+					}
+				}
+				if len(failed) > 0 {
+					return fmt.Errorf("Immich job queues still paused: %s (resume them under Administration → Jobs)", strings.Join(failed, ", "))
+				}
+			}
+
+			if err := os.Remove(MaintenancePath(infraRoot)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			return nil
+		},
+	})
+}
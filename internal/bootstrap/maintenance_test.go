@@ -0,0 +1,80 @@
+package bootstrap
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPauseImmichJobs(t *testing.T) {
+	queues := map[string]bool{"thumbnailGeneration": false, "smartSearch": true, "library": false}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/api/jobs":
+			out := map[string]interface{}{}
+			for name, paused := range queues {
+				out[name] = map[string]interface{}{
+					"jobCounts":   map[string]int{"active": 0},
+					"queueStatus": map[string]bool{"isActive": false, "isPaused": paused},
+				}
+			}
+			json.NewEncoder(w).Encode(out)
+		case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, "/api/jobs/"):
+			var body struct{ Command string }
+			json.NewDecoder(r.Body).Decode(&body)
+			queues[strings.TrimPrefix(r.URL.Path, "/api/jobs/")] = body.Command == "pause"
+			w.Write([]byte(`{}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client := &ImmichClient{BaseURL: server.URL, HTTP: server.Client()}
+	paused, err := pauseImmichJobs(client)
+	if err != nil {
+		t.Fatalf("pauseImmichJobs: %v", err)
+	}
+	// The queue the admin paused is not ours to resume later
+	if want := []string{"library", "thumbnailGeneration"}; !reflect.DeepEqual(paused, want) {
+		t.Errorf("paused = %v, want %v", paused, want)
+	}
+	for name, isPaused := range queues {
+		if !isPaused {
+			t.Errorf("queue %s still running", name)
+		}
+	}
+
+	for _, name := range paused {
+		if err := client.SetJobPaused(name, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if queues["library"] || !queues["smartSearch"] {
+		t.Errorf("after resume: %v", queues)
+	}
+}
+
+func TestLoadMaintenance(t *testing.T) {
+	dir := t.TempDir()
+	state, err := LoadMaintenance(dir)
+	if state != nil || err != nil {
+		t.Fatalf("LoadMaintenance() without a record = %v, %v; want off", state, err)
+	}
+
+	os.WriteFile(filepath.Join(dir, MaintenanceFile), []byte(`{"Reason":"backup","PausedJobs":["library"]}`), 0644)
+	state, err = LoadMaintenance(dir)
+	if err != nil || state == nil || state.Reason != "backup" || len(state.PausedJobs) != 1 {
+		t.Errorf("LoadMaintenance() = %+v, %v", state, err)
+	}
+
+	os.WriteFile(filepath.Join(dir, MaintenanceFile), []byte(`{`), 0644)
+	if _, err := LoadMaintenance(dir); err == nil {
+		t.Error("LoadMaintenance() should reject a damaged record")
+	}
+}
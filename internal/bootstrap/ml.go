@@ -0,0 +1,111 @@
+package bootstrap
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/madhav/servctl/internal/compose"
+	"github.com/madhav/servctl/internal/storage"
+)
+
+// MLService is the compose service that runs Immich's models
+const MLService = "immich-machine-learning"
+
+// mlDownloadScript fetches both models into the layout the ML container
+// expects (/cache/<type>/<model>), using the container's own
+// huggingface_hub so nothing extra is installed on the host
+func mlDownloadScript(preset compose.MLPreset) string {
+	return fmt.Sprintf(`from huggingface_hub import snapshot_download
+for kind, name in [("clip", %q), ("facial-recognition", %q)]:
+    path = f"/cache/{kind}/{name}"
+    snapshot_download(f"immich-app/{name}", cache_dir=path, local_dir=path)
+    print(f"downloaded {kind} model {name}")`, preset.CLIPModel, preset.FaceModel)
+}
+
+// mlDownloadCommand runs the download script in a throwaway ML container
+// that shares the model-cache volume with the real one
+func mlDownloadCommand(composeFile string, preset compose.MLPreset) []string {
+	return []string{"compose", "-f", composeFile, "run", "--rm", "--no-deps",
+		"--entrypoint", "python3", MLService, "-c", mlDownloadScript(preset)}
+}
+
+// PreloadMLModels downloads the selected models into the model-cache volume
+// before first start, so the ML container is ready as soon as it boots
+func PreloadMLModels(config *compose.ServiceConfig, composeDir string, dryRun bool) StepResult {
+	result := StepResult{Name: "ML models"}
+
+	if !config.MLEnabled() {
+		result.Success = true
+		result.Message = "Machine learning disabled, skipped"
+		return result
+	}
+
+	preset := config.MLPreset()
+	return runStep(result, dryRun, fmt.Sprintf("download %s and %s (~%s) into the model cache", preset.CLIPModel, preset.FaceModel, storage.FormatBytes(preset.ApproxBytes)), func() StepResult {
+		args := mlDownloadCommand(filepath.Join(composeDir, "docker-compose.yml"), preset)
+		if output, err := exec.Command("docker", args...).CombinedOutput(); err != nil {
+			result.Error = fmt.Errorf("model download failed: %s", lastLine(string(output)))
+			result.Message = result.Error.Error() + " (models will download on first start instead)"
+			return result
+		}
+
+		result.Success = true
+		result.Message = fmt.Sprintf("Downloaded %s and %s", preset.CLIPModel, preset.FaceModel)
+		return result
+	})
+}
+
+// lastLine returns the last non-empty line of command output
+func lastLine(output string) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
+
+// immichMLSettings returns the system-config section that selects the models
+func immichMLSettings(preset compose.MLPreset) map[string]interface{} {
+	return map[string]interface{}{
+		"enabled": true,
+		"clip": map[string]interface{}{
+			"enabled":   true,
+			"modelName": preset.CLIPModel,
+		},
+		"facialRecognition": map[string]interface{}{
+			"enabled":   true,
+			"modelName": preset.FaceModel,
+		},
+	}
+}
+
+// ConfigureImmichML points Immich's smart search and face recognition at
+// the selected models, which are otherwise only chosen in the admin UI
+func ConfigureImmichML(config *compose.ServiceConfig, dryRun bool) StepResult {
+	result := StepResult{Name: "Immich ML"}
+
+	if !config.MLEnabled() {
+		result.Success = true
+		result.Message = "Machine learning disabled, skipped"
+		return result
+	}
+
+	preset := config.MLPreset()
+	return runStep(result, dryRun, fmt.Sprintf("select %s for search and %s for faces in Immich", preset.CLIPModel, preset.FaceModel), func() StepResult {
+		client, err := loginImmichAdmin(config)
+		if err != nil {
+			result.Error = err
+			result.Message = err.Error()
+			return result
+		}
+
+		if err := client.UpdateSystemConfig("machineLearning", immichMLSettings(preset)); err != nil {
+			result.Error = fmt.Errorf("failed to update Immich ML settings: %w", err)
+			result.Message = result.Error.Error()
+			return result
+		}
+
+		result.Success = true
+		result.Message = fmt.Sprintf("Smart search uses %s, faces use %s", preset.CLIPModel, preset.FaceModel)
+		return result
+	})
+}
@@ -0,0 +1,50 @@
+package bootstrap
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/madhav/servctl/internal/compose"
+)
+
+func TestMLDownloadCommand(t *testing.T) {
+	preset, _ := compose.FindMLPreset(compose.MLDefault)
+	args := mlDownloadCommand("/infra/compose/docker-compose.yml", preset)
+
+	cmd := strings.Join(args, " ")
+	for _, want := range []string{"run --rm --no-deps", "--entrypoint python3 immich-machine-learning", `"ViT-B-32__openai"`, `"buffalo_l"`} {
+		if !strings.Contains(cmd, want) {
+			t.Errorf("command missing %q: %s", want, cmd)
+		}
+	}
+}
+
+func TestMergeConfig(t *testing.T) {
+	current := map[string]interface{}{
+		"enabled": false,
+		"clip":    map[string]interface{}{"enabled": true, "modelName": "old"},
+		"urls":    []interface{}{"http://immich-machine-learning:3003"},
+	}
+	preset, _ := compose.FindMLPreset(compose.MLSmall)
+	merged := mergeConfig(current, immichMLSettings(preset))
+
+	if merged["enabled"] != true {
+		t.Error("enabled should be overwritten")
+	}
+	if merged["urls"] == nil {
+		t.Error("settings not mentioned should be kept")
+	}
+	clip := merged["clip"].(map[string]interface{})
+	if clip["modelName"] != "ViT-B-32__openai" {
+		t.Errorf("clip model = %v", clip["modelName"])
+	}
+}
+
+func TestPreloadMLModels_Disabled(t *testing.T) {
+	config := compose.DefaultConfig()
+	config.MLModels = compose.MLOff
+
+	if r := PreloadMLModels(config, "/tmp", false); !r.Success || !strings.Contains(r.Message, "skipped") {
+		t.Errorf("disabled ML should be skipped, got %q", r.Message)
+	}
+}
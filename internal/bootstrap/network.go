@@ -0,0 +1,177 @@
+package bootstrap
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/madhav/servctl/internal/compose"
+	"github.com/madhav/servctl/internal/ops"
+)
+
+// nextcloudHostCommands returns the occ commands that point Nextcloud at a
+// new host address. Trusted domain 0 is the IP set by the installer; the
+// external name, when there is one, is domain 2 (1 is localhost).
+func nextcloudHostCommands(config *compose.ServiceConfig) [][]string {
+	cmds := [][]string{
+		{"config:system:set", "trusted_domains", "0", "--value=" + config.HostIP},
+	}
+	domains := strings.Fields(compose.NextcloudTrustedDomains(config))
+	if len(domains) > 2 {
+		cmds = append(cmds, []string{"config:system:set", "trusted_domains", "2", "--value=" + domains[2]})
+	}
+	return append(cmds, []string{"config:system:set", "overwrite.cli.url", "--value=" + config.NextcloudCLIURL()})
+}
+
+// UpdateNextcloudHost updates trusted domains and the CLI URL after an IP change
+func UpdateNextcloudHost(config *compose.ServiceConfig, dryRun bool) StepResult {
+	result := StepResult{Name: "Nextcloud trusted domains"}
+
+	for _, args := range nextcloudHostCommands(config) {
+		if err := RunOCC(args, dryRun); err != nil {
+			result.Error = err
+			result.Message = err.Error()
+			return result
+		}
+	}
+
+	result.Success = true
+	result.Message = fmt.Sprintf("Trusted domain set to %s", config.HostIP)
+	return result
+}
+
+// ConfigureExternalURLs makes the apps build links that work away from
+// home: Nextcloud trusts the external name and uses it in mails, and Immich
+// puts its external URL in shared links
+func ConfigureExternalURLs(config *compose.ServiceConfig, dryRun bool) StepResult {
+	result := StepResult{Name: "External URLs"}
+
+	if !config.HasExternalURLs() {
+		result.Success = true
+		result.Message = "No remote access configured, skipped"
+		return result
+	}
+
+	var done []string
+	if config.NextcloudExternalURL != "" {
+		if err := WaitForNextcloudInstalled(5*time.Minute, dryRun); err != nil {
+			result.Error = err
+			result.Message = err.Error()
+			return result
+		}
+		for _, args := range nextcloudHostCommands(config) {
+			if err := RunOCC(args, dryRun); err != nil {
+				result.Error = err
+				result.Message = err.Error()
+				return result
+			}
+		}
+		done = append(done, "Nextcloud "+config.NextcloudExternalURL)
+	}
+
+	if config.ImmichExternalURL != "" {
+		err := ops.Execute(dryRun, ops.Func{
+			Description: "set Immich's external domain to " + config.ImmichExternalURL,
+			Fn: func() error {
+				client, err := loginImmichAdmin(config)
+				if err == nil {
+					err = client.UpdateSystemConfig("server", map[string]interface{}{"externalDomain": config.ImmichExternalURL})
+				}
+				return err
+			},
+		})
+		if err != nil {
+			result.Error = err
+			result.Message = err.Error()
+			return result
+		}
+		done = append(done, "Immich "+config.ImmichExternalURL)
+	}
+
+	result.Success = true
+	result.Message = "Links use " + strings.Join(done, ", ")
+	return result
+}
+
+// UpdateFirewallSubnet moves LAN-restricted UFW rules to the new subnet
+func UpdateFirewallSubnet(oldIP, newIP string, dryRun bool) StepResult {
+	result := StepResult{Name: "Firewall LAN rules"}
+
+	if !compose.IsUFWInstalled() {
+		result.Success = true
+		result.Message = "UFW not installed, skipped"
+		return result
+	}
+
+	newSubnet := compose.LANSubnet(newIP)
+	oldSubnet := compose.SubnetWithPrefix(oldIP, compose.PrefixLength(newSubnet))
+	if oldSubnet == newSubnet {
+		result.Success = true
+		result.Message = fmt.Sprintf("Subnet unchanged (%s)", newSubnet)
+		return result
+	}
+
+	moved, err := compose.MoveFirewallSubnet(oldSubnet, newSubnet, dryRun)
+	if err != nil {
+		result.Error = err
+		result.Message = err.Error()
+		return result
+	}
+
+	result.Success = true
+	result.Message = fmt.Sprintf("Moved %d rule(s) from %s to %s", moved, oldSubnet, newSubnet)
+	return result
+}
+
+// RefreshNetwork points an existing installation at a new host IP:
+// regenerates config files, recreates containers, and updates everything
+// that embedded the old address
+func RefreshNetwork(config *compose.ServiceConfig, composeDir, newIP string, dryRun bool) []StepResult {
+	var results []StepResult
+	oldIP := config.HostIP
+	config.HostIP = newIP
+
+	regen := StepResult{Name: "Regenerate config"}
+	if err := compose.WriteAllConfigFiles(config, composeDir, dryRun); err != nil {
+		regen.Error = err
+	} else if err := compose.SaveState(config, dryRun); err != nil {
+		regen.Error = err
+	}
+	if regen.Error != nil {
+		regen.Message = regen.Error.Error()
+		return append(results, regen)
+	}
+	regen.Success = true
+	regen.Message = fmt.Sprintf("HOST_IP changed from %s to %s", oldIP, newIP)
+	results = append(results, regen)
+
+	results = append(results, UpdateFirewallSubnet(oldIP, newIP, dryRun))
+
+	// Recreates containers whose environment mentions the host IP
+	start := StartServices(composeDir, dryRun)
+	results = append(results, start)
+	if !start.Success {
+		return results
+	}
+
+	ready := WaitForServices(config, 10*time.Minute, dryRun)
+	results = append(results, ready)
+	if !ready.Success {
+		return results
+	}
+
+	results = append(results, UpdateNextcloudHost(config, dryRun))
+
+	// Issuer and redirect URLs contain the host IP
+	if config.SSOEnabled {
+		results = append(results, ConfigureNextcloudOIDC(config, dryRun))
+		results = append(results, ConfigureImmichOIDC(config, dryRun))
+	}
+
+	// Local names must resolve to the new address
+	if config.LocalDNSEnabled {
+		results = append(results, ConfigureLocalDNS(config, dryRun))
+	}
+
+	return results
+}
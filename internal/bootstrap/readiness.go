@@ -0,0 +1,127 @@
+package bootstrap
+
+import (
+	"fmt"
+	"net/http"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/madhav/servctl/internal/compose"
+)
+
+// ReadinessCheck describes how to tell that one service is ready for use
+type ReadinessCheck struct {
+	Name      string // Display name
+	Container string // Container whose health status must be "healthy"
+	URL       string // Optional endpoint probed from the host
+}
+
+// ReadinessChecks returns the checks that must pass before first-run
+// configuration starts. Databases come first so the progress display
+// mirrors the order in which services come up.
+func ReadinessChecks(config *compose.ServiceConfig) []ReadinessCheck {
+	checks := []ReadinessCheck{
+		{Name: "Immich database", Container: "immich_postgres"},
+		{Name: "Immich cache", Container: "immich_redis"},
+		{Name: "Nextcloud database", Container: "nextcloud_mariadb"},
+		{Name: "Immich", Container: "immich_server",
+			URL: fmt.Sprintf("http://127.0.0.1:%d/api/server/ping", config.ImmichPort)},
+		{Name: "Nextcloud", Container: NextcloudContainer,
+			URL: fmt.Sprintf("http://127.0.0.1:%d/status.php", config.NextcloudPort)},
+	}
+
+	if config.SSOEnabled {
+		checks = append(checks,
+			ReadinessCheck{Name: "Authentik database", Container: "authentik_postgres"},
+			ReadinessCheck{Name: "Authentik", Container: "authentik_server",
+				URL: fmt.Sprintf("http://127.0.0.1:%d/-/health/ready/", config.AuthentikPort)},
+		)
+	}
+
+	return checks
+}
+
+// containerHealth returns the Docker health status of a container, or its
+// run state when the container has no healthcheck
+func containerHealth(container string) string {
+	format := "{{if .State.Health}}{{.State.Health.Status}}{{else}}{{.State.Status}}{{end}}"
+	output, err := exec.Command("docker", "inspect", "--format", format, container).Output()
+	if err != nil {
+		return "missing"
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// probeHTTP reports whether url answers with a non-error status
+func probeHTTP(url string) bool {
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode < 400
+}
+
+// isReady runs a single readiness check
+func isReady(check ReadinessCheck) bool {
+	if status := containerHealth(check.Container); status != "healthy" && status != "running" {
+		return false
+	}
+	return check.URL == "" || probeHTTP(check.URL)
+}
+
+// renderReadinessProgress formats the single-line progress display
+func renderReadinessProgress(ready, total int, elapsed time.Duration, waiting []string) string {
+	line := fmt.Sprintf("  ⏳ %d/%d services ready (%s)", ready, total, elapsed.Round(time.Second))
+	if len(waiting) > 0 {
+		line += " - waiting for " + strings.Join(waiting, ", ")
+	}
+	return line
+}
+
+// WaitForServices polls container health and readiness endpoints until every
+// service is ready or the timeout expires, redrawing a progress line as it goes
+func WaitForServices(config *compose.ServiceConfig, timeout time.Duration, dryRun bool) StepResult {
+	result := StepResult{Name: "Wait for services"}
+	checks := ReadinessChecks(config)
+
+	return runStep(result, dryRun, fmt.Sprintf("wait up to %s for %d services to become ready", timeout, len(checks)), func() StepResult {
+		start := time.Now()
+		ready := make(map[string]bool)
+		lastWidth := 0
+
+		for {
+			var waiting []string
+			for _, check := range checks {
+				if !ready[check.Name] && isReady(check) {
+					ready[check.Name] = true
+				}
+				if !ready[check.Name] {
+					waiting = append(waiting, check.Name)
+				}
+			}
+
+			line := renderReadinessProgress(len(ready), len(checks), time.Since(start), waiting)
+			fmt.Printf("\r%-*s", lastWidth, line)
+			lastWidth = len(line)
+
+			if len(waiting) == 0 {
+				fmt.Println()
+				result.Success = true
+				result.Message = fmt.Sprintf("%d services ready after %s", len(checks), time.Since(start).Round(time.Second))
+				return result
+			}
+
+			if time.Since(start) > timeout {
+				fmt.Println()
+				result.Error = fmt.Errorf("not ready after %s: %s (check: docker compose logs)", timeout, strings.Join(waiting, ", "))
+				result.Message = result.Error.Error()
+				return result
+			}
+
+			time.Sleep(5 * time.Second)
+		}
+	})
+}
@@ -0,0 +1,228 @@
+package bootstrap
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/madhav/servctl/internal/compose"
+)
+
+// ImmichAPIKeyName names the API key created for each family member
+const ImmichAPIKeyName = "servctl uploads"
+
+// UserIDs returns the Immich user ID of every account by lowercase email
+// (requires an admin login)
+func (c *ImmichClient) UserIDs() (map[string]string, error) {
+	var users []struct {
+		ID    string `json:"id"`
+		Email string `json:"email"`
+	}
+	if err := c.do(http.MethodGet, "/api/admin/users", nil, &users); err != nil {
+		return nil, err
+	}
+	ids := make(map[string]string, len(users))
+	for _, u := range users {
+		ids[strings.ToLower(u.Email)] = u.ID
+	}
+	return ids, nil
+}
+
+// EnsureSharedAlbum creates an album shared with userIDs as editors, so
+// everyone can add photos to it. It reports false when an album with that
+// name already exists; that album is left as it is.
+func (c *ImmichClient) EnsureSharedAlbum(name string, userIDs []string) (bool, error) {
+	var albums []struct {
+		AlbumName string `json:"albumName"`
+	}
+	if err := c.do(http.MethodGet, "/api/albums", nil, &albums); err != nil {
+		return false, err
+	}
+	for _, a := range albums {
+		if a.AlbumName == name {
+			return false, nil
+		}
+	}
+
+	users := make([]map[string]string, 0, len(userIDs))
+	for _, id := range userIDs {
+		users = append(users, map[string]string{"userId": id, "role": "editor"})
+	}
+	body := map[string]interface{}{
+		"albumName":   name,
+		"description": "Shared with the whole family",
+		"albumUsers":  users,
+	}
+	return true, c.do(http.MethodPost, "/api/albums", body, nil)
+}
+
+// SharedWith returns the IDs of the users the logged-in user already shares
+// their library with
+func (c *ImmichClient) SharedWith() (map[string]bool, error) {
+	var partners []struct {
+		ID string `json:"id"`
+	}
+	if err := c.do(http.MethodGet, "/api/partners?direction=shared-by", nil, &partners); err != nil {
+		return nil, err
+	}
+	ids := make(map[string]bool, len(partners))
+	for _, p := range partners {
+		ids[p.ID] = true
+	}
+	return ids, nil
+}
+
+// SharePartner shares the logged-in user's library with another user
+func (c *ImmichClient) SharePartner(userID string) error {
+	return c.do(http.MethodPost, "/api/partners", map[string]string{"sharedWithId": userID}, nil)
+}
+
+// CreateAPIKey creates an API key for the logged-in user and returns its
+// secret, which Immich only reveals once
+func (c *ImmichClient) CreateAPIKey(name string) (string, error) {
+	var resp struct {
+		Secret string `json:"secret"`
+	}
+	body := map[string]interface{}{"name": name, "permissions": []string{"all"}}
+	if err := c.do(http.MethodPost, "/api/api-keys", body, &resp); err != nil {
+		return "", err
+	}
+	if resp.Secret == "" {
+		return "", fmt.Errorf("no API key secret was returned")
+	}
+	return resp.Secret, nil
+}
+
+// ConfigureImmichSharing applies the sharing starter to the family accounts:
+// the shared family album, partner sharing between members and an API key
+// per member. Partner sharing and API keys are set up as each member, with
+// their initial password; a member who already changed it is skipped and
+// named in the message. Created API keys are stored on config.Users.
+func ConfigureImmichSharing(config *compose.ServiceConfig, dryRun bool) StepResult {
+	result := StepResult{Name: "Immich sharing"}
+
+	if len(config.Users) == 0 || !config.ImmichSharingEnabled() {
+		result.Success = true
+		result.Message = "Not configured, skipped"
+		return result
+	}
+
+	var plan []string
+	if config.ImmichFamilyAlbum != "" {
+		plan = append(plan, fmt.Sprintf("share album %q", config.ImmichFamilyAlbum))
+	}
+	if config.ImmichPartnerSharing {
+		plan = append(plan, "turn on partner sharing")
+	}
+	if config.ImmichAPIKeys {
+		plan = append(plan, "create API keys")
+	}
+	return runStep(result, dryRun, fmt.Sprintf("%s for %d user(s)", strings.Join(plan, ", "), len(config.Users)), func() StepResult {
+		admin, err := loginImmichAdmin(config)
+		if err != nil {
+			result.Error = err
+			result.Message = err.Error()
+			return result
+		}
+		ids, err := admin.UserIDs()
+		if err != nil {
+			result.Error = err
+			result.Message = err.Error()
+			return result
+		}
+
+		var done, failed, skipped []string
+		if config.ImmichFamilyAlbum != "" {
+			var members []string
+			for _, m := range config.Users {
+				if id := ids[strings.ToLower(m.Email)]; id != "" {
+					members = append(members, id)
+				}
+			}
+			created, err := admin.EnsureSharedAlbum(config.ImmichFamilyAlbum, members)
+			switch {
+			case err != nil:
+				failed = append(failed, fmt.Sprintf("album (%v)", err))
+			case created:
+				done = append(done, fmt.Sprintf("album %q shared with %d user(s)", config.ImmichFamilyAlbum, len(members)))
+			default:
+				done = append(done, fmt.Sprintf("album %q already exists", config.ImmichFamilyAlbum))
+			}
+		}
+
+		if config.ImmichPartnerSharing || config.ImmichAPIKeys {
+			partners, keys := 0, 0
+			for i := range config.Users {
+				m := &config.Users[i]
+				client := &ImmichClient{BaseURL: admin.BaseURL, HTTP: admin.HTTP}
+				if err := client.Login(m.Email, m.Password); err != nil {
+					skipped = append(skipped, m.Email)
+					continue
+				}
+
+				if config.ImmichPartnerSharing {
+					n, err := sharePartners(client, m.Email, config.Users, ids)
+					partners += n
+					if err != nil {
+						failed = append(failed, fmt.Sprintf("%s partner sharing (%v)", m.Email, err))
+					}
+				}
+
+				if config.ImmichAPIKeys && m.ImmichAPIKey == "" {
+					key, err := client.CreateAPIKey(ImmichAPIKeyName)
+					if err != nil {
+						failed = append(failed, fmt.Sprintf("%s API key (%v)", m.Email, err))
+						continue
+					}
+					m.ImmichAPIKey = key
+					keys++
+				}
+			}
+			if config.ImmichPartnerSharing {
+				done = append(done, fmt.Sprintf("%d partner share(s)", partners))
+			}
+			if config.ImmichAPIKeys {
+				done = append(done, fmt.Sprintf("%d API key(s)", keys))
+			}
+		}
+
+		message := strings.Join(done, ", ")
+		if len(skipped) > 0 {
+			message += fmt.Sprintf("; skipped %s (password already changed)", strings.Join(skipped, ", "))
+		}
+		if len(failed) > 0 {
+			result.Error = fmt.Errorf("failed: %s", strings.Join(failed, ", "))
+			result.Message = result.Error.Error()
+			if message != "" {
+				result.Message += "; " + message
+			}
+			return result
+		}
+
+		result.Success = true
+		result.Message = message
+		return result
+	})
+}
+
+// sharePartners shares the library of the member logged in on client with
+// every other member it does not share with yet, returning how many new
+// shares were made
+func sharePartners(client *ImmichClient, email string, members []compose.FamilyMember, ids map[string]string) (int, error) {
+	existing, err := client.SharedWith()
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, other := range members {
+		id := ids[strings.ToLower(other.Email)]
+		if strings.EqualFold(other.Email, email) || id == "" || existing[id] {
+			continue
+		}
+		if err := client.SharePartner(id); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
@@ -0,0 +1,171 @@
+package bootstrap
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/madhav/servctl/internal/compose"
+)
+
+// fakeImmich serves the endpoints the sharing starter uses. Each account's
+// access token is "token-" plus its email; changed lists members whose
+// initial password no longer works.
+type fakeImmich struct {
+	changed  map[string]bool
+	albums   []map[string]interface{}
+	partners map[string][]string // email -> user IDs shared with
+	keys     map[string]int      // email -> API keys created
+}
+
+func (f *fakeImmich) handler(t *testing.T) http.HandlerFunc {
+	users := []map[string]string{
+		{"id": "id-admin", "email": "admin@servctl.local"},
+		{"id": "id-jane", "email": "jane@example.com"},
+		{"id": "id-john", "email": "John@example.com"},
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		me := strings.TrimPrefix(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "), "token-")
+		switch r.Method + " " + r.URL.Path {
+		case "GET /api/server/ping":
+			w.Write([]byte(`{"res":"pong"}`))
+		case "POST /api/auth/admin-sign-up":
+			w.WriteHeader(http.StatusBadRequest)
+		case "POST /api/auth/login":
+			var body map[string]string
+			json.NewDecoder(r.Body).Decode(&body)
+			if f.changed[body["email"]] {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]string{"accessToken": "token-" + body["email"]})
+		case "GET /api/admin/users":
+			json.NewEncoder(w).Encode(users)
+		case "GET /api/albums":
+			json.NewEncoder(w).Encode(f.albums)
+		case "POST /api/albums":
+			var body map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&body)
+			f.albums = append(f.albums, body)
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{}`))
+		case "GET /api/partners":
+			var out []map[string]string
+			for _, id := range f.partners[me] {
+				out = append(out, map[string]string{"id": id})
+			}
+			json.NewEncoder(w).Encode(out)
+		case "POST /api/partners":
+			var body map[string]string
+			json.NewDecoder(r.Body).Decode(&body)
+			f.partners[me] = append(f.partners[me], body["sharedWithId"])
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{}`))
+		case "POST /api/api-keys":
+			f.keys[me]++
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"secret":"key-` + me + `"}`))
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}
+}
+
+func sharingTestConfig(t *testing.T, server *httptest.Server) *compose.ServiceConfig {
+	u, _ := url.Parse(server.URL)
+	port, err := strconv.Atoi(u.Port())
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := compose.DefaultConfig()
+	config.ImmichPort = port
+	config.ImmichAdminEmail = "admin@servctl.local"
+	config.ImmichAdminPass = "adminpass"
+	config.Users = []compose.FamilyMember{
+		testMember(),
+		{Name: "John Doe", Username: "john.doe", Email: "john@example.com", Password: "johnpass"},
+	}
+	config.ImmichFamilyAlbum = "Family"
+	config.ImmichPartnerSharing = true
+	config.ImmichAPIKeys = true
+	return config
+}
+
+func TestConfigureImmichSharing(t *testing.T) {
+	fake := &fakeImmich{partners: map[string][]string{}, keys: map[string]int{}}
+	server := httptest.NewServer(fake.handler(t))
+	defer server.Close()
+	config := sharingTestConfig(t, server)
+
+	r := ConfigureImmichSharing(config, false)
+	if !r.Success {
+		t.Fatalf("ConfigureImmichSharing() failed: %s", r.Message)
+	}
+
+	if len(fake.albums) != 1 || fake.albums[0]["albumName"] != "Family" {
+		t.Fatalf("albums = %v, want one Family album", fake.albums)
+	}
+	if users := fake.albums[0]["albumUsers"].([]interface{}); len(users) != 2 {
+		t.Errorf("album shared with %d users, want 2 (emails match case-insensitively)", len(users))
+	}
+	if got := fake.partners["jane@example.com"]; len(got) != 1 || got[0] != "id-john" {
+		t.Errorf("jane shares with %v, want [id-john]", got)
+	}
+	if got := fake.partners["john@example.com"]; len(got) != 1 || got[0] != "id-jane" {
+		t.Errorf("john shares with %v, want [id-jane]", got)
+	}
+	if config.Users[0].ImmichAPIKey != "key-jane@example.com" {
+		t.Errorf("jane's API key = %q", config.Users[0].ImmichAPIKey)
+	}
+
+	// A second run changes nothing that already exists
+	r = ConfigureImmichSharing(config, false)
+	if !r.Success || !strings.Contains(r.Message, "already exists") {
+		t.Errorf("second run = %+v", r)
+	}
+	if len(fake.albums) != 1 || len(fake.partners["jane@example.com"]) != 1 || fake.keys["jane@example.com"] != 1 {
+		t.Errorf("second run duplicated work: albums %d, partners %v, keys %v", len(fake.albums), fake.partners, fake.keys)
+	}
+}
+
+func TestConfigureImmichSharing_PasswordChanged(t *testing.T) {
+	fake := &fakeImmich{
+		changed:  map[string]bool{"john@example.com": true},
+		partners: map[string][]string{},
+		keys:     map[string]int{},
+	}
+	server := httptest.NewServer(fake.handler(t))
+	defer server.Close()
+	config := sharingTestConfig(t, server)
+
+	r := ConfigureImmichSharing(config, false)
+	if !r.Success {
+		t.Fatalf("a member who changed their password should be skipped, not fail: %s", r.Message)
+	}
+	if !strings.Contains(r.Message, "skipped john@example.com") {
+		t.Errorf("message should name the skipped member: %q", r.Message)
+	}
+	if config.Users[1].ImmichAPIKey != "" {
+		t.Error("no API key can be created for a member who could not log in")
+	}
+}
+
+func TestConfigureImmichSharing_Skipped(t *testing.T) {
+	config := compose.DefaultConfig()
+	config.Users = []compose.FamilyMember{testMember()}
+	if r := ConfigureImmichSharing(config, false); !r.Success || !strings.Contains(r.Message, "skipped") {
+		t.Errorf("without a sharing starter the step should skip: %+v", r)
+	}
+
+	config.ImmichFamilyAlbum = "Family"
+	var r StepResult
+	output := captureStdout(t, func() { r = ConfigureImmichSharing(config, true) })
+	if !r.Success || !strings.Contains(output, `"Family"`) {
+		t.Errorf("dry run = %+v, printed %q", r, output)
+	}
+}
@@ -0,0 +1,241 @@
+package bootstrap
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/madhav/servctl/internal/compose"
+	"github.com/madhav/servctl/internal/ops"
+)
+
+// smokeThumbnailTimeout is how long Immich gets to make the test photo's
+// thumbnail; the job queue is busy right after first boot
+const smokeThumbnailTimeout = 3 * time.Minute
+
+// smokeImage returns a small PNG for the Immich upload test. It is drawn
+// fresh each time: Immich rejects a second upload of the same file as a
+// duplicate, which would not exercise thumbnail generation.
+func smokeImage() []byte {
+	var seed [3]byte
+	rand.Read(seed[:])
+	img := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			img.Set(x, y, color.RGBA{seed[0] + uint8(x*4), seed[1] + uint8(y*4), seed[2], 255})
+		}
+	}
+	var buf bytes.Buffer
+	png.Encode(&buf, img)
+	return buf.Bytes()
+}
+
+// UploadAsset uploads a photo and returns the new asset's ID
+func (c *ImmichClient) UploadAsset(name string, data []byte) (string, error) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	now := time.Now().UTC().Format(time.RFC3339)
+	for key, value := range map[string]string{
+		"deviceAssetId":  name,
+		"deviceId":       "servctl",
+		"fileCreatedAt":  now,
+		"fileModifiedAt": now,
+	} {
+		form.WriteField(key, value)
+	}
+	part, err := form.CreateFormFile("assetData", name)
+	if err != nil {
+		return "", err
+	}
+	part.Write(data)
+	form.Close()
+
+	req, err := http.NewRequest(http.MethodPost, c.BaseURL+"/api/assets", &body)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", "Bearer "+c.AccessToken)
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("upload failed: %w", err)
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode >= 300 {
+		return "", fmt.Errorf("upload returned %d: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+	var asset struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(respBody, &asset); err != nil || asset.ID == "" {
+		return "", fmt.Errorf("upload returned no asset ID: %s", strings.TrimSpace(string(respBody)))
+	}
+	return asset.ID, nil
+}
+
+// WaitForThumbnail polls until Immich serves the asset's thumbnail
+func (c *ImmichClient) WaitForThumbnail(id string, timeout time.Duration, interval time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		req, err := http.NewRequest(http.MethodGet, c.BaseURL+"/api/assets/"+id+"/thumbnail?size=thumbnail", nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+c.AccessToken)
+		if resp, err := c.HTTP.Do(req); err == nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK && strings.HasPrefix(resp.Header.Get("Content-Type"), "image/") {
+				return nil
+			}
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("no thumbnail after %s: check the immich_server logs for the thumbnail job", timeout)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// DeleteAssets removes assets for good, skipping the trash
+func (c *ImmichClient) DeleteAssets(ids ...string) error {
+	return c.do(http.MethodDelete, "/api/assets", map[string]interface{}{"ids": ids, "force": true}, nil)
+}
+
+// smokeImmich uploads a photo, waits for its thumbnail and deletes it
+func smokeImmich(client *ImmichClient, thumbnailTimeout, interval time.Duration) error {
+	id, err := client.UploadAsset(fmt.Sprintf("servctl-smoke-%d.png", time.Now().Unix()), smokeImage())
+	if err != nil {
+		return err
+	}
+	defer client.DeleteAssets(id)
+	return client.WaitForThumbnail(id, thumbnailTimeout, interval)
+}
+
+// smokeWebDAV writes a file through Nextcloud's WebDAV endpoint, reads it
+// back and deletes it
+func smokeWebDAV(baseURL, user, password string) error {
+	token := make([]byte, 8)
+	rand.Read(token)
+	content := "servctl smoke test " + hex.EncodeToString(token) + "\n"
+	url := fmt.Sprintf("%s/remote.php/dav/files/%s/servctl-smoke-%s.txt", baseURL, user, hex.EncodeToString(token))
+	client := &http.Client{Timeout: 30 * time.Second}
+
+	send := func(method string, body io.Reader) (*http.Response, error) {
+		req, err := http.NewRequest(method, url, body)
+		if err != nil {
+			return nil, err
+		}
+		req.SetBasicAuth(user, password)
+		return client.Do(req)
+	}
+
+	resp, err := send(http.MethodPut, strings.NewReader(content))
+	if err != nil {
+		return fmt.Errorf("WebDAV upload failed: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("WebDAV upload returned %d", resp.StatusCode)
+	}
+	defer func() {
+		if resp, err := send(http.MethodDelete, nil); err == nil {
+			resp.Body.Close()
+		}
+	}()
+
+	resp, err = send(http.MethodGet, nil)
+	if err != nil {
+		return fmt.Errorf("WebDAV download failed: %w", err)
+	}
+	got, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("WebDAV download returned %d", resp.StatusCode)
+	}
+	if string(got) != content {
+		return fmt.Errorf("WebDAV returned different content than was written")
+	}
+	return nil
+}
+
+// smokeGlances asks the Glances API for the CPU load
+func smokeGlances(baseURL string) error {
+	client := &http.Client{Timeout: 15 * time.Second}
+	resp, err := client.Get(baseURL + "/api/4/cpu")
+	if err != nil {
+		return fmt.Errorf("Glances API failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Glances API returned %d", resp.StatusCode)
+	}
+	var cpu map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&cpu); err != nil {
+		return fmt.Errorf("Glances API returned invalid JSON: %w", err)
+	}
+	if _, ok := cpu["total"]; !ok {
+		return fmt.Errorf("Glances API returned no CPU total")
+	}
+	return nil
+}
+
+// smokeResult turns one smoke test into a step result
+func smokeResult(name, passed string, err error) StepResult {
+	result := StepResult{Name: "Smoke test: " + name}
+	if err != nil {
+		result.Error = err
+		result.Message = err.Error()
+		return result
+	}
+	result.Success = true
+	result.Message = passed
+	return result
+}
+
+// RunSmokeTests checks that each service does its job, not only that it
+// answers: Immich stores a photo and makes its thumbnail, Nextcloud stores
+// and returns a file over WebDAV, and Glances reports the CPU. Everything
+// the tests create is deleted again.
+func RunSmokeTests(config *compose.ServiceConfig, dryRun bool) []StepResult {
+	results := []StepResult{{Name: "Smoke tests", Success: true, Message: "[Dry Run] Nothing changed"}}
+	ops.Execute(dryRun, ops.Func{
+		Description: "upload a test photo to Immich, a test file to Nextcloud and query Glances",
+		Fn: func() error {
+			results = runSmokeTests(config)
+			return nil
+		},
+	})
+	return results
+}
+
+// runSmokeTests runs the smoke tests of RunSmokeTests
+func runSmokeTests(config *compose.ServiceConfig) []StepResult {
+	var results []StepResult
+
+	client, err := loginImmichAdmin(config)
+	if err == nil {
+		err = smokeImmich(client, smokeThumbnailTimeout, 5*time.Second)
+	}
+	results = append(results, smokeResult("Immich", "Photo uploaded and thumbnail generated", err))
+
+	err = smokeWebDAV(fmt.Sprintf("http://localhost:%d", config.NextcloudPort),
+		config.NextcloudAdminUser, config.NextcloudAdminPass)
+	results = append(results, smokeResult("Nextcloud", "File written and read back over WebDAV", err))
+
+	err = smokeGlances(fmt.Sprintf("http://127.0.0.1:%d", config.GlancesPort))
+	results = append(results, smokeResult("Glances", "CPU metrics reported", err))
+
+	return results
+}
@@ -0,0 +1,208 @@
+package bootstrap
+
+import (
+	"bytes"
+	"encoding/json"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSmokeImage_IsPNG(t *testing.T) {
+	a, b := smokeImage(), smokeImage()
+	if _, err := png.Decode(bytes.NewReader(a)); err != nil {
+		t.Fatalf("smoke image is not a PNG: %v", err)
+	}
+	if bytes.Equal(a, b) {
+		t.Error("two smoke images are identical; Immich would reject the second as a duplicate")
+	}
+}
+
+func TestSmokeImmich(t *testing.T) {
+	var mu sync.Mutex
+	polls, deleted := 0, []string(nil)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.Method + " " + r.URL.Path {
+		case "POST /api/assets":
+			file, header, err := r.FormFile("assetData")
+			if err != nil || r.FormValue("deviceId") == "" || r.FormValue("fileCreatedAt") == "" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			defer file.Close()
+			if !strings.HasSuffix(header.Filename, ".png") {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"id":"asset-1","status":"created"}`))
+		case "GET /api/assets/asset-1/thumbnail":
+			// The thumbnail job finishes on the third poll
+			polls++
+			if polls < 3 {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Content-Type", "image/webp")
+			w.Write([]byte("webp"))
+		case "DELETE /api/assets":
+			var body struct {
+				IDs   []string `json:"ids"`
+				Force bool     `json:"force"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			if body.Force {
+				deleted = append(deleted, body.IDs...)
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client := &ImmichClient{BaseURL: server.URL, AccessToken: "token", HTTP: server.Client()}
+	if err := smokeImmich(client, time.Second, time.Millisecond); err != nil {
+		t.Fatalf("smokeImmich: %v", err)
+	}
+	if polls != 3 {
+		t.Errorf("thumbnail polled %d times, want 3", polls)
+	}
+	if len(deleted) != 1 || deleted[0] != "asset-1" {
+		t.Errorf("deleted = %v, want the test asset removed for good", deleted)
+	}
+}
+
+func TestSmokeImmich_NoThumbnail(t *testing.T) {
+	deleted := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.Path {
+		case "POST /api/assets":
+			w.Write([]byte(`{"id":"asset-1"}`))
+		case "DELETE /api/assets":
+			deleted = true
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client := &ImmichClient{BaseURL: server.URL, AccessToken: "token", HTTP: server.Client()}
+	err := smokeImmich(client, 20*time.Millisecond, time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "no thumbnail") {
+		t.Errorf("err = %v, want a missing thumbnail", err)
+	}
+	if !deleted {
+		t.Error("test asset not deleted after a failed check")
+	}
+}
+
+// fakeWebDAV stores files in memory for one user
+type fakeWebDAV struct {
+	mu      sync.Mutex
+	files   map[string][]byte
+	corrupt bool
+}
+
+func (f *fakeWebDAV) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if user, pass, ok := r.BasicAuth(); !ok || user != "admin" || pass != "secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if !strings.HasPrefix(r.URL.Path, "/remote.php/dav/files/admin/") {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	switch r.Method {
+	case http.MethodPut:
+		data, _ := io.ReadAll(r.Body)
+		if f.corrupt {
+			data = data[1:]
+		}
+		f.files[r.URL.Path] = data
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodGet:
+		data, ok := f.files[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(data)
+	case http.MethodDelete:
+		delete(f.files, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func TestSmokeWebDAV(t *testing.T) {
+	dav := &fakeWebDAV{files: map[string][]byte{}}
+	server := httptest.NewServer(dav)
+	defer server.Close()
+
+	if err := smokeWebDAV(server.URL, "admin", "secret"); err != nil {
+		t.Fatalf("smokeWebDAV: %v", err)
+	}
+	if len(dav.files) != 0 {
+		t.Errorf("test file left behind: %v", dav.files)
+	}
+
+	if err := smokeWebDAV(server.URL, "admin", "wrong"); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("bad password: err = %v, want 401", err)
+	}
+
+	dav.corrupt = true
+	if err := smokeWebDAV(server.URL, "admin", "secret"); err == nil || !strings.Contains(err.Error(), "different content") {
+		t.Errorf("corrupted file: err = %v", err)
+	}
+	if len(dav.files) != 0 {
+		t.Errorf("test file left behind after a failed check: %v", dav.files)
+	}
+}
+
+func TestSmokeGlances(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		wantErr string
+	}{
+		{"healthy", http.StatusOK, `{"total": 3.2, "user": 1.0}`, ""},
+		{"not json", http.StatusOK, `<html>`, "invalid JSON"},
+		{"no total", http.StatusOK, `{}`, "no CPU total"},
+		{"error", http.StatusInternalServerError, ``, "500"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/api/4/cpu" {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			err := smokeGlances(server.URL)
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
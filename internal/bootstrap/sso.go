@@ -0,0 +1,105 @@
+package bootstrap
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/madhav/servctl/internal/compose"
+)
+
+// nextcloudOIDCSecretEnv carries the client secret to occ, so it never
+// shows in the process list
+const nextcloudOIDCSecretEnv = "NEXTCLOUD_OIDC_SECRET"
+
+// nextcloudOIDCCommands returns the occ commands that register Authentik
+// as a login provider through the user_oidc app
+func nextcloudOIDCCommands(config *compose.ServiceConfig) [][]string {
+	return [][]string{
+		// The provider lives on a LAN address, which Nextcloud blocks by default
+		{"config:system:set", "allow_local_remote_servers", "--type=boolean", "--value=true"},
+		{"app:install", "user_oidc"},
+		{"app:enable", "user_oidc"},
+		{"user_oidc:provider", "Authentik",
+			"--clientid=" + compose.NextcloudOIDCClientID,
+			"--clientsecret=${" + nextcloudOIDCSecretEnv + "}",
+			"--discoveryuri=" + config.OIDCDiscoveryURL(compose.NextcloudOIDCClientID),
+			"--unique-uid=0",
+		},
+	}
+}
+
+// immichOAuthSettings returns the oauth block merged into Immich's system config
+func immichOAuthSettings(config *compose.ServiceConfig) map[string]interface{} {
+	return map[string]interface{}{
+		"enabled":               true,
+		"issuerUrl":             config.OIDCIssuerURL(compose.ImmichOIDCClientID),
+		"clientId":              compose.ImmichOIDCClientID,
+		"clientSecret":          config.ImmichOIDCSecret,
+		"scope":                 "openid email profile",
+		"buttonText":            "Login with Authentik",
+		"autoRegister":          true,
+		"autoLaunch":            false,
+		"mobileOverrideEnabled": false,
+	}
+}
+
+// ConfigureNextcloudOIDC wires Nextcloud to Authentik as an OIDC client
+func ConfigureNextcloudOIDC(config *compose.ServiceConfig, dryRun bool) StepResult {
+	result := StepResult{Name: "Nextcloud SSO"}
+
+	if !config.SSOEnabled {
+		result.Success = true
+		result.Message = "SSO not enabled, skipped"
+		return result
+	}
+
+	if err := WaitForNextcloudInstalled(5*time.Minute, dryRun); err != nil {
+		result.Error = err
+		result.Message = err.Error()
+		return result
+	}
+
+	env := map[string]string{nextcloudOIDCSecretEnv: config.NextcloudOIDCSecret}
+	for _, args := range nextcloudOIDCCommands(config) {
+		// app:install fails when the app is already present; app:enable covers it
+		if err := runOCC(env, args, dryRun); err != nil && args[0] != "app:install" {
+			result.Error = err
+			result.Message = err.Error()
+			return result
+		}
+	}
+
+	result.Success = true
+	result.Message = "Login with Authentik enabled"
+	return result
+}
+
+// ConfigureImmichOIDC enables OAuth login in Immich against Authentik
+func ConfigureImmichOIDC(config *compose.ServiceConfig, dryRun bool) StepResult {
+	result := StepResult{Name: "Immich SSO"}
+
+	if !config.SSOEnabled {
+		result.Success = true
+		result.Message = "SSO not enabled, skipped"
+		return result
+	}
+
+	return runStep(result, dryRun, "enable OAuth in Immich with issuer "+config.OIDCIssuerURL(compose.ImmichOIDCClientID), func() StepResult {
+		client, err := loginImmichAdmin(config)
+		if err != nil {
+			result.Error = err
+			result.Message = err.Error()
+			return result
+		}
+
+		if err := client.UpdateOAuthConfig(immichOAuthSettings(config)); err != nil {
+			result.Error = fmt.Errorf("failed to update Immich OAuth settings: %w", err)
+			result.Message = result.Error.Error()
+			return result
+		}
+
+		result.Success = true
+		result.Message = "Login with Authentik enabled"
+		return result
+	})
+}
@@ -0,0 +1,107 @@
+package bootstrap
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/madhav/servctl/internal/compose"
+)
+
+func ssoTestConfig() *compose.ServiceConfig {
+	config := compose.DefaultConfig()
+	config.HostIP = "192.168.1.100"
+	config.SSOEnabled = true
+	config.NextcloudOIDCSecret = "nextcloud-secret-0123456789"
+	config.ImmichOIDCSecret = "immich-secret-0123456789"
+	return config
+}
+
+func TestNextcloudOIDCCommands(t *testing.T) {
+	commands := nextcloudOIDCCommands(ssoTestConfig())
+
+	last := strings.Join(commands[len(commands)-1], " ")
+	checks := []string{
+		"user_oidc:provider Authentik",
+		"--clientid=nextcloud",
+		"--clientsecret=${NEXTCLOUD_OIDC_SECRET}",
+		"--discoveryuri=http://192.168.1.100:9000/application/o/nextcloud/.well-known/openid-configuration",
+	}
+	for _, check := range checks {
+		if !strings.Contains(last, check) {
+			t.Errorf("provider command missing %q: %s", check, last)
+		}
+	}
+	if strings.Contains(last, "nextcloud-secret-0123456789") {
+		t.Error("The client secret would show in the process list")
+	}
+}
+
+func TestRunBootstrap_DryRun_SSO(t *testing.T) {
+	var results []StepResult
+	output := captureStdout(t, func() {
+		results = RunBootstrap(ssoTestConfig(), "/tmp/infra/compose", true)
+	})
+	if HasFailures(results) {
+		t.Errorf("Dry run bootstrap should not fail: %+v", results)
+	}
+
+	if !strings.Contains(output, "Would enable OAuth in Immich with issuer http://192.168.1.100:9000/application/o/immich/") {
+		t.Errorf("Immich SSO dry run should mention the issuer, got:\n%s", output)
+	}
+}
+
+// captureStdout returns what fn prints, as the ops engine does in a dry run
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	done := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(r)
+		done <- string(data)
+	}()
+	fn()
+	w.Close()
+	return <-done
+}
+
+func TestImmichClient_UpdateOAuthConfig(t *testing.T) {
+	var saved map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			w.Write([]byte(`{"ffmpeg":{"crf":23},"oauth":{"enabled":false,"storageLabelClaim":"preferred_username"}}`))
+		case http.MethodPut:
+			json.NewDecoder(r.Body).Decode(&saved)
+			w.Write([]byte(`{}`))
+		}
+	}))
+	defer server.Close()
+
+	client := &ImmichClient{BaseURL: server.URL, HTTP: server.Client()}
+	if err := client.UpdateOAuthConfig(immichOAuthSettings(ssoTestConfig())); err != nil {
+		t.Fatalf("UpdateOAuthConfig() error = %v", err)
+	}
+
+	if _, ok := saved["ffmpeg"]; !ok {
+		t.Error("Unrelated settings should be preserved")
+	}
+	oauth := saved["oauth"].(map[string]interface{})
+	if oauth["enabled"] != true || oauth["clientId"] != "immich" {
+		t.Errorf("OAuth settings not applied: %+v", oauth)
+	}
+	if oauth["storageLabelClaim"] != "preferred_username" {
+		t.Error("Existing OAuth fields should be preserved")
+	}
+}
@@ -0,0 +1,113 @@
+package bootstrap
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/madhav/servctl/internal/compose"
+)
+
+// NextcloudFamilyGroup is the Nextcloud group all family members join
+const NextcloudFamilyGroup = "family"
+
+// nextcloudUserCommands returns the occ commands that create and configure a user.
+// The password is passed via the OC_PASS environment variable, never as an argument.
+func nextcloudUserCommands(m compose.FamilyMember) [][]string {
+	return [][]string{
+		{"user:add", "--password-from-env", "--display-name=" + m.Name, "--group=" + NextcloudFamilyGroup, m.Username},
+		{"user:setting", m.Username, "settings", "email", m.Email},
+		{"user:setting", m.Username, "files", "quota", compose.NextcloudQuota(m.Quota)},
+	}
+}
+
+// ProvisionNextcloudUsers creates Nextcloud accounts for all family members
+func ProvisionNextcloudUsers(config *compose.ServiceConfig, dryRun bool) StepResult {
+	result := StepResult{Name: "Nextcloud users"}
+
+	if len(config.Users) == 0 {
+		result.Success = true
+		result.Message = "No family users configured, skipped"
+		return result
+	}
+
+	if err := WaitForNextcloudInstalled(5*time.Minute, dryRun); err != nil {
+		result.Error = err
+		result.Message = err.Error()
+		return result
+	}
+
+	var failed []string
+	for _, m := range config.Users {
+		env := map[string]string{"OC_PASS": m.Password}
+		for _, args := range nextcloudUserCommands(m) {
+			if err := runOCC(env, args, dryRun); err != nil {
+				failed = append(failed, fmt.Sprintf("%s (%v)", m.Username, err))
+				break
+			}
+		}
+	}
+
+	if len(failed) > 0 {
+		result.Error = fmt.Errorf("failed to create: %s", strings.Join(failed, ", "))
+		result.Message = result.Error.Error()
+		return result
+	}
+
+	result.Success = true
+	result.Message = fmt.Sprintf("Created %d user(s) in group '%s'", len(config.Users), NextcloudFamilyGroup)
+	return result
+}
+
+// loginImmichAdmin waits for Immich, creates the admin account on a fresh
+// install, and returns a client authenticated as that admin
+func loginImmichAdmin(config *compose.ServiceConfig) (*ImmichClient, error) {
+	client := NewImmichClient(config.ImmichPort)
+	if err := client.WaitUntilReady(5 * time.Minute); err != nil {
+		return nil, err
+	}
+
+	// An existing admin makes sign-up fail; login below tells us if that matters
+	_ = client.AdminSignUp(config.ImmichAdminEmail, config.ImmichAdminPass, "Admin")
+	if err := client.Login(config.ImmichAdminEmail, config.ImmichAdminPass); err != nil {
+		return nil, fmt.Errorf("immich admin login failed: %w", err)
+	}
+	return client, nil
+}
+
+// ProvisionImmichUsers creates the Immich admin (if needed) and family accounts
+func ProvisionImmichUsers(config *compose.ServiceConfig, dryRun bool) StepResult {
+	result := StepResult{Name: "Immich users"}
+
+	if len(config.Users) == 0 {
+		result.Success = true
+		result.Message = "No family users configured, skipped"
+		return result
+	}
+
+	return runStep(result, dryRun, fmt.Sprintf("create Immich admin %s and %d user(s)", config.ImmichAdminEmail, len(config.Users)), func() StepResult {
+		client, err := loginImmichAdmin(config)
+		if err != nil {
+			result.Error = err
+			result.Message = err.Error()
+			return result
+		}
+
+		var failed []string
+		for _, m := range config.Users {
+			if err := client.CreateUser(m); err != nil {
+				failed = append(failed, fmt.Sprintf("%s (%v)", m.Email, err))
+			}
+		}
+
+		if len(failed) > 0 {
+			result.Error = fmt.Errorf("failed to create: %s", strings.Join(failed, ", "))
+			result.Message = result.Error.Error()
+			return result
+		}
+
+		result.Success = true
+		result.Message = fmt.Sprintf("Created %d user(s)", len(config.Users))
+		return result
+	})
+}
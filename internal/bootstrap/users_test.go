@@ -0,0 +1,123 @@
+package bootstrap
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/madhav/servctl/internal/compose"
+)
+
+func testMember() compose.FamilyMember {
+	return compose.FamilyMember{
+		Name:     "Jane Doe",
+		Username: "jane.doe",
+		Email:    "jane@example.com",
+		Quota:    "50GB",
+		Password: "initial-password",
+	}
+}
+
+func TestNextcloudUserCommands(t *testing.T) {
+	cmds := nextcloudUserCommands(testMember())
+	if len(cmds) != 3 {
+		t.Fatalf("nextcloudUserCommands() returned %d commands, want 3", len(cmds))
+	}
+
+	add := strings.Join(cmds[0], " ")
+	if !strings.Contains(add, "--password-from-env") || !strings.HasSuffix(add, "jane.doe") {
+		t.Errorf("user:add command unexpected: %s", add)
+	}
+	if strings.Contains(add, "initial-password") {
+		t.Error("Password must not be passed as an argument")
+	}
+
+	quota := strings.Join(cmds[2], " ")
+	if !strings.HasSuffix(quota, "51200 MB") {
+		t.Errorf("quota command unexpected: %s", quota)
+	}
+}
+
+func TestProvisionUsers_NoUsers(t *testing.T) {
+	config := compose.DefaultConfig()
+
+	if r := ProvisionNextcloudUsers(config, false); !r.Success {
+		t.Errorf("Nextcloud provisioning without users should succeed: %s", r.Message)
+	}
+	if r := ProvisionImmichUsers(config, false); !r.Success {
+		t.Errorf("Immich provisioning without users should succeed: %s", r.Message)
+	}
+}
+
+func TestProvisionUsers_DryRun(t *testing.T) {
+	config := compose.DefaultConfig()
+	config.Users = []compose.FamilyMember{testMember()}
+
+	if r := ProvisionNextcloudUsers(config, true); !r.Success {
+		t.Errorf("Nextcloud dry run failed: %s", r.Message)
+	}
+	if r := ProvisionImmichUsers(config, true); !r.Success {
+		t.Errorf("Immich dry run failed: %s", r.Message)
+	}
+}
+
+func TestImmichClient_CreateUser(t *testing.T) {
+	var created map[string]interface{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/server/ping":
+			w.Write([]byte(`{"res":"pong"}`))
+		case "/api/auth/login":
+			w.Write([]byte(`{"accessToken":"token123"}`))
+		case "/api/admin/users":
+			if r.Header.Get("Authorization") != "Bearer token123" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			json.NewDecoder(r.Body).Decode(&created)
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client := NewImmichClient(2283)
+	client.BaseURL = server.URL
+
+	if err := client.Ping(); err != nil {
+		t.Fatalf("Ping() error: %v", err)
+	}
+	if err := client.Login("admin@servctl.local", "pass"); err != nil {
+		t.Fatalf("Login() error: %v", err)
+	}
+	if err := client.CreateUser(testMember()); err != nil {
+		t.Fatalf("CreateUser() error: %v", err)
+	}
+
+	if created["email"] != "jane@example.com" {
+		t.Errorf("email = %v, want jane@example.com", created["email"])
+	}
+	if created["quotaSizeInBytes"] != float64(50<<30) {
+		t.Errorf("quotaSizeInBytes = %v, want %d", created["quotaSizeInBytes"], int64(50<<30))
+	}
+}
+
+func TestImmichClient_ErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"message":"bad"}`))
+	}))
+	defer server.Close()
+
+	client := NewImmichClient(2283)
+	client.BaseURL = server.URL
+
+	if err := client.Login("a@b.c", "x"); err == nil {
+		t.Error("Login() should fail on HTTP 400")
+	}
+}
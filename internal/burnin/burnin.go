@@ -0,0 +1,349 @@
+// Package burnin stress-tests a new machine before setup: a memtester pass
+// over most of the RAM, a CPU stress run with the temperature watched and
+// surface scans of the data disks, ending in a pass/fail report. Hardware
+// that fails here is returned before family data lands on it.
+package burnin
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/madhav/servctl/internal/ops"
+	"github.com/madhav/servctl/internal/storage"
+)
+
+// ReportFile is where the last burn-in report is kept, in the infra directory
+const ReportFile = "burnin.json"
+
+// DefaultStressDuration is how long the CPUs are kept at full load; long
+// enough for a cooler that cannot keep up to reach its limit
+const DefaultStressDuration = 30 * time.Minute
+
+// CPU temperatures: sustained load above CPUTempWarn is worth a look at the
+// cooler; reaching CPUTempLimit stops the stress run and fails it
+const (
+	CPUTempWarn  = 85
+	CPUTempLimit = 95
+)
+
+// memReserve is memory left to the system while memtester locks the rest
+const memReserve = 512 * 1024 * 1024
+
+// memtesterTests is how many tests one memtester pass runs
+const memtesterTests = 18
+
+// Packages the burn-in runs
+var Packages = map[string]string{"memtester": "memtester", "stress-ng": "stress-ng"}
+
+// procRoot and hwmonRoot are where the kernel reports memory and sensors;
+// tests point them at fake trees
+var (
+	procRoot  = "/proc"
+	hwmonRoot = "/sys/class/hwmon"
+)
+
+// Result is the outcome of one burn-in step
+type Result struct {
+	Name     string
+	Passed   bool
+	Skipped  bool   `json:",omitempty"`
+	Detail   string // What was tested and what was found
+	Duration time.Duration
+}
+
+// Report is a whole burn-in run
+type Report struct {
+	Host       string
+	Started    time.Time
+	Results    []Result
+	Scans      []storage.SurfaceScan `json:",omitempty"`
+	MaxCPUTemp int                   `json:",omitempty"` // °C, 0 when no sensor was found
+}
+
+// Passed reports whether no step failed; skipped steps do not count
+func (r Report) Passed() bool {
+	for _, res := range r.Results {
+		if !res.Passed && !res.Skipped {
+			return false
+		}
+	}
+	return true
+}
+
+// WriteReport saves the report as JSON at path
+func WriteReport(path string, r Report, dryRun bool) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode the burn-in report: %w", err)
+	}
+	return ops.Execute(dryRun,
+		ops.Mkdir{Path: filepath.Dir(path), Mode: 0755},
+		ops.WriteFile{Path: path, Content: append(data, '\n'), Mode: 0644})
+}
+
+// MissingPackages returns the packages whose commands are not installed
+func MissingPackages() []string {
+	var missing []string
+	for command, pkg := range Packages {
+		if _, err := exec.LookPath(command); err != nil {
+			missing = append(missing, pkg)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// MemTestSize returns how much memory memtester can lock: what is
+// available less memReserve, in bytes
+func MemTestSize() uint64 {
+	data, err := os.ReadFile(filepath.Join(procRoot, "meminfo"))
+	if err != nil {
+		return 0
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[0] == "MemAvailable:" {
+			kb, _ := strconv.ParseUint(fields[1], 10, 64)
+			if kb*1024 <= memReserve {
+				return 0
+			}
+			return kb*1024 - memReserve
+		}
+	}
+	return 0
+}
+
+// memtesterLine reads one line of memtester output: the test it finished
+// and whether that test failed. memtester redraws its progress with
+// backspaces, so the verdict follows the last one.
+func memtesterLine(line string) (test string, failed bool, ok bool) {
+	if strings.HasPrefix(strings.TrimSpace(line), "FAILURE") {
+		return "", true, true
+	}
+	name, rest, found := strings.Cut(line, ":")
+	if !found {
+		return "", false, false
+	}
+	if i := strings.LastIndex(rest, "\b"); i >= 0 {
+		rest = rest[i+1:]
+	}
+	if strings.TrimSpace(rest) != "ok" {
+		return "", false, false
+	}
+	return strings.TrimSpace(name), false, true
+}
+
+// TestMemory runs one memtester pass over size bytes, calling progress
+// with each test as it passes
+func TestMemory(size uint64, dryRun bool, progress func(done, total int, test string)) Result {
+	mb := size / (1024 * 1024)
+	result := Result{Name: "Memory (memtester)"}
+	args := []string{"memtester", fmt.Sprintf("%dM", mb), "1"}
+	if dryRun {
+		result.Passed = true
+		result.Detail = "[Dry Run] Would run: " + strings.Join(args, " ")
+		return result
+	}
+	if mb == 0 {
+		result.Skipped = true
+		result.Detail = "No memory available to test"
+		return result
+	}
+
+	started := time.Now()
+	cmd := exec.Command(args[0], args[1:]...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		result.Detail = err.Error()
+		return result
+	}
+	cmd.Stderr = cmd.Stdout
+	if err := cmd.Start(); err != nil {
+		result.Detail = fmt.Sprintf("cannot run memtester: %v", err)
+		return result
+	}
+
+	done, failures := 0, 0
+	lines := bufio.NewScanner(stdout)
+	for lines.Scan() {
+		test, failed, ok := memtesterLine(lines.Text())
+		switch {
+		case !ok:
+		case failed:
+			failures++
+		default:
+			done++
+			if progress != nil {
+				progress(done, memtesterTests, test)
+			}
+		}
+	}
+	err = cmd.Wait()
+	result.Duration = time.Since(started).Round(time.Second)
+
+	switch {
+	case failures > 0:
+		result.Detail = fmt.Sprintf("%d errors in %s: a memory module is faulty (test each stick alone to find it)", failures, storage.FormatBytes(size))
+	case err != nil:
+		result.Detail = fmt.Sprintf("memtester failed: %v (it needs root to lock memory)", err)
+	default:
+		result.Passed = true
+		result.Detail = fmt.Sprintf("%s tested, %d tests without errors", storage.FormatBytes(size), done)
+	}
+	return result
+}
+
+// cpuSensorChips are the hwmon drivers that report CPU temperatures
+var cpuSensorChips = map[string]bool{
+	"coretemp": true, "k10temp": true, "zenpower": true, "cpu_thermal": true, "acpitz": true,
+}
+
+// CPUTemperature returns the hottest CPU temperature the kernel reports,
+// in °C, and false when there is no CPU sensor
+func CPUTemperature() (int, bool) {
+	dirs, _ := filepath.Glob(filepath.Join(hwmonRoot, "hwmon*"))
+	hottest, found := 0, false
+	for _, dir := range dirs {
+		name, err := os.ReadFile(filepath.Join(dir, "name"))
+		if err != nil || !cpuSensorChips[strings.TrimSpace(string(name))] {
+			continue
+		}
+		inputs, _ := filepath.Glob(filepath.Join(dir, "temp*_input"))
+		for _, input := range inputs {
+			data, err := os.ReadFile(input)
+			if err != nil {
+				continue
+			}
+			milli, err := strconv.Atoi(strings.TrimSpace(string(data)))
+			if err != nil {
+				continue
+			}
+			if !found || milli/1000 > hottest {
+				hottest, found = milli/1000, true
+			}
+		}
+	}
+	return hottest, found
+}
+
+// StressCPU loads every CPU with stress-ng for duration, checking the
+// results of the computations and sampling the temperature every few
+// seconds. progress gets the time elapsed and the temperature (0 when
+// unknown). The run is stopped when the CPU reaches CPUTempLimit.
+func StressCPU(duration time.Duration, dryRun bool, progress func(elapsed time.Duration, tempC int)) (Result, int) {
+	result := Result{Name: "CPU stress (stress-ng)"}
+	args := []string{"stress-ng", "--cpu", "0", "--cpu-method", "all", "--verify",
+		"--timeout", fmt.Sprintf("%ds", int(duration.Seconds())), "--metrics-brief"}
+	if dryRun {
+		result.Passed = true
+		result.Detail = "[Dry Run] Would run: " + strings.Join(args, " ")
+		return result, 0
+	}
+
+	started := time.Now()
+	cmd := exec.Command(args[0], args[1:]...)
+	var output strings.Builder
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	if err := cmd.Start(); err != nil {
+		result.Detail = fmt.Sprintf("cannot run stress-ng: %v", err)
+		return result, 0
+	}
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+
+	maxTemp, overheated := 0, false
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+	var err error
+wait:
+	for {
+		select {
+		case err = <-exited:
+			break wait
+		case <-ticker.C:
+			temp, _ := CPUTemperature()
+			maxTemp = max(maxTemp, temp)
+			if progress != nil {
+				progress(time.Since(started), temp)
+			}
+			if temp >= CPUTempLimit && !overheated {
+				overheated = true
+				cmd.Process.Kill()
+			}
+		}
+	}
+	result.Duration = time.Since(started).Round(time.Second)
+
+	tempNote := ""
+	if maxTemp > 0 {
+		tempNote = fmt.Sprintf(", hottest %d°C", maxTemp)
+	}
+	switch {
+	case overheated:
+		result.Detail = fmt.Sprintf("stopped at %d°C after %s: check the CPU cooler is seated, its fan spins and the case has airflow", maxTemp, result.Duration)
+	case err != nil:
+		result.Detail = fmt.Sprintf("stress-ng reported failures (%v): %s", err, lastLine(output.String()))
+	case maxTemp >= CPUTempWarn:
+		result.Passed = true
+		result.Detail = fmt.Sprintf("%s at full load without errors, but reached %d°C: the cooling has little headroom", result.Duration, maxTemp)
+	default:
+		result.Passed = true
+		result.Detail = fmt.Sprintf("%s at full load without errors%s", result.Duration, tempNote)
+	}
+	return result, maxTemp
+}
+
+// lastLine returns the last non-empty line of output
+func lastLine(output string) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
+
+// DiskResult sums up the surface scans and the drives' SMART verdicts
+func DiskResult(disks []storage.Disk, scans []storage.SurfaceScan) Result {
+	result := Result{Name: "Disks (badblocks)", Passed: true}
+	if len(disks) == 0 {
+		result.Skipped = true
+		result.Detail = "No data disks found"
+		return result
+	}
+
+	var problems []string
+	var longest time.Duration
+	for _, s := range scans {
+		longest = max(longest, s.Duration)
+		switch {
+		case s.Error != "":
+			problems = append(problems, fmt.Sprintf("%s scan did not finish: %s", s.Path, s.Error))
+		case s.BadBlocks > 0:
+			problems = append(problems, fmt.Sprintf("%s has %d bad blocks", s.Path, s.BadBlocks))
+		}
+	}
+	for _, d := range disks {
+		if strings.EqualFold(d.SMARTHealth, "FAILED") {
+			problems = append(problems, d.Path+" fails its SMART self-assessment")
+		}
+	}
+	result.Duration = longest
+
+	switch {
+	case len(problems) > 0:
+		result.Passed = false
+		result.Detail = strings.Join(problems, "; ")
+	case len(scans) == 0:
+		result.Skipped = true
+		result.Detail = "Surface scan skipped"
+	default:
+		result.Detail = fmt.Sprintf("%d disk(s) scanned without bad blocks", len(scans))
+	}
+	return result
+}
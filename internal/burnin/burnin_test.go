@@ -0,0 +1,131 @@
+package burnin
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/madhav/servctl/internal/storage"
+)
+
+func TestMemtesterLine(t *testing.T) {
+	tests := []struct {
+		line   string
+		test   string
+		failed bool
+		ok     bool
+	}{
+		{"  Stuck Address       : testing   1\b\b\b\b\b\b\b\b\b\b\b\bok         ", "Stuck Address", false, true},
+		{"  Random Value        : ok", "Random Value", false, true},
+		{"FAILURE: 0x4ffc0cc3b8c23a52 != 0x4ffc0cc3b8c63a52 at offset 0x0b1e0c40.", "", true, true},
+		{"  Bit Flip            : \b\b\b\b\b\b\b\b\b\b\bsetting  34", "", false, false},
+		{"Loop 1/1:", "", false, false},
+		{"got  15564MB (16319836160 bytes), trying mlock ...locked.", "", false, false},
+	}
+	for _, tt := range tests {
+		test, failed, ok := memtesterLine(tt.line)
+		if test != tt.test || failed != tt.failed || ok != tt.ok {
+			t.Errorf("memtesterLine(%q) = %q, %v, %v; want %q, %v, %v", tt.line, test, failed, ok, tt.test, tt.failed, tt.ok)
+		}
+	}
+}
+
+func TestMemTestSize(t *testing.T) {
+	root := t.TempDir()
+	procRoot = root
+	defer func() { procRoot = "/proc" }()
+
+	os.WriteFile(filepath.Join(root, "meminfo"), []byte("MemTotal:       16384000 kB\nMemAvailable:    8388608 kB\n"), 0644)
+	if got, want := MemTestSize(), uint64(8*1024*1024*1024-memReserve); got != want {
+		t.Errorf("MemTestSize() = %d, want %d", got, want)
+	}
+	os.WriteFile(filepath.Join(root, "meminfo"), []byte("MemAvailable:     262144 kB\n"), 0644)
+	if got := MemTestSize(); got != 0 {
+		t.Errorf("MemTestSize() = %d with less than the reserve available, want 0", got)
+	}
+}
+
+func TestCPUTemperature(t *testing.T) {
+	root := t.TempDir()
+	hwmonRoot = root
+	defer func() { hwmonRoot = "/sys/class/hwmon" }()
+
+	if _, ok := CPUTemperature(); ok {
+		t.Error("found a CPU sensor in an empty tree")
+	}
+	sensor := func(hwmon, chip string, inputs map[string]string) {
+		dir := filepath.Join(root, hwmon)
+		os.MkdirAll(dir, 0755)
+		os.WriteFile(filepath.Join(dir, "name"), []byte(chip+"\n"), 0644)
+		for input, value := range inputs {
+			os.WriteFile(filepath.Join(dir, input), []byte(value+"\n"), 0644)
+		}
+	}
+	sensor("hwmon0", "nvme", map[string]string{"temp1_input": "99000"})
+	sensor("hwmon1", "coretemp", map[string]string{"temp1_input": "61000", "temp2_input": "74500"})
+	if got, ok := CPUTemperature(); !ok || got != 74 {
+		t.Errorf("CPUTemperature() = %d, %v; want the hottest core, 74", got, ok)
+	}
+}
+
+func TestDiskResult(t *testing.T) {
+	disks := []storage.Disk{{Path: "/dev/sdb"}, {Path: "/dev/sdc"}}
+	tests := []struct {
+		name    string
+		disks   []storage.Disk
+		scans   []storage.SurfaceScan
+		passed  bool
+		skipped bool
+		detail  string
+	}{
+		{"no disks", nil, nil, true, true, "No data disks"},
+		{"skipped", disks, nil, true, true, "skipped"},
+		{"clean", disks, []storage.SurfaceScan{{Path: "/dev/sdb"}, {Path: "/dev/sdc"}}, true, false, "2 disk(s)"},
+		{"bad blocks", disks, []storage.SurfaceScan{{Path: "/dev/sdb"}, {Path: "/dev/sdc", BadBlocks: 24}}, false, false, "/dev/sdc has 24 bad blocks"},
+		{"interrupted", disks, []storage.SurfaceScan{{Path: "/dev/sdb", Error: "signal: killed"}}, false, false, "did not finish"},
+		{"SMART", []storage.Disk{{Path: "/dev/sdb", SMARTHealth: "FAILED"}}, []storage.SurfaceScan{{Path: "/dev/sdb"}}, false, false, "SMART"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := DiskResult(tt.disks, tt.scans)
+			if r.Passed != tt.passed || r.Skipped != tt.skipped || !strings.Contains(r.Detail, tt.detail) {
+				t.Errorf("DiskResult() = %+v", r)
+			}
+		})
+	}
+}
+
+func TestReport(t *testing.T) {
+	r := Report{Host: "nas", Results: []Result{
+		{Name: "Memory", Passed: true},
+		{Name: "Disks", Skipped: true},
+	}}
+	if !r.Passed() {
+		t.Error("a skipped step failed the report")
+	}
+	r.Results = append(r.Results, Result{Name: "CPU"})
+	if r.Passed() {
+		t.Error("a failed step passed the report")
+	}
+
+	path := filepath.Join(t.TempDir(), "infra", ReportFile)
+	if err := WriteReport(path, r, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Dir(path)); !os.IsNotExist(err) {
+		t.Fatal("a dry run created the infra directory")
+	}
+	if err := WriteReport(path, r, false); err != nil {
+		t.Fatalf("WriteReport() error: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Report
+	if err := json.Unmarshal(data, &got); err != nil || got.Host != "nas" || len(got.Results) != 3 {
+		t.Errorf("report = %+v, %v", got, err)
+	}
+}
@@ -0,0 +1,282 @@
+// Package checklist walks the owner through the first things to try after
+// setup - services up, URLs answering, first logins, first backup - and
+// remembers what is done so the walk-through can be resumed later.
+package checklist
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/madhav/servctl/internal/bootstrap"
+	"github.com/madhav/servctl/internal/compose"
+	"github.com/madhav/servctl/internal/maintenance"
+	"github.com/madhav/servctl/internal/status"
+)
+
+// Item is one step of the checklist
+type Item struct {
+	ID    string // Key in ServiceConfig.Checklist
+	Title string
+	Hint  string // What to do, shown while the item is open
+
+	// Verify checks the item automatically; nil for items only the owner
+	// can confirm (logging in from a phone, for instance)
+	Verify func() error
+
+	// Action offers to fix a failed Verify, e.g. starting the stack
+	ActionPrompt string
+	Action       func() error
+}
+
+// probeTimeout bounds each URL check
+const probeTimeout = 5 * time.Second
+
+// Items returns the checklist for a setup. scriptsDir and backupDest come
+// from the maintenance config; the backup step is left out when no data
+// backup script was generated.
+func Items(config *compose.ServiceConfig, scriptsDir, backupDest string) []Item {
+	composeDir := filepath.Join(config.InfraRoot, "compose")
+	nextcloudURL := config.ServiceURL(config.NextcloudPort)
+	immichURL := config.ServiceURL(config.ImmichPort)
+
+	items := []Item{
+		{
+			ID:           "stack",
+			Title:        "Start the stack",
+			Hint:         "All containers should be running and healthy.",
+			Verify:       func() error { return verifyStack(config) },
+			ActionPrompt: "Start the services now?",
+			Action: func() error {
+				if r := bootstrap.StartServices(composeDir, false); !r.Success {
+					return fmt.Errorf("%s", r.Message)
+				}
+				return nil
+			},
+		},
+		{
+			ID:     "urls",
+			Title:  "Check every web interface answers",
+			Hint:   "Probed from this machine at the LAN address, and at the external URL too when remote access is set up.",
+			Verify: func() error { return verifyURLs(serviceURLs(config)) },
+		},
+		{
+			ID:    "nextcloud-login",
+			Title: "Log in to Nextcloud",
+			Hint: fmt.Sprintf("Open %s in a browser and sign in as %q. The password is\n"+
+				"NEXTCLOUD_ADMIN_PASSWORD in %s.", nextcloudURL, config.NextcloudAdminUser, filepath.Join(composeDir, ".env")),
+		},
+		{
+			ID:    "immich-app",
+			Title: "Connect the Immich app",
+			Hint: fmt.Sprintf("Install Immich on your phone, enter the server URL %s,\n"+
+				"sign in as %s and turn on backup for your camera roll.", immichURL, config.ImmichAdminEmail),
+		},
+	}
+
+	if script := backupScript(scriptsDir); script != "" {
+		snapshots := maintenance.SnapshotsPath(backupDest)
+		items = append(items, Item{
+			ID:           "first-backup",
+			Title:        "Confirm the first backup",
+			Hint:         "A completed backup set should exist in " + snapshots + ".",
+			Verify:       func() error { return verifyBackup(snapshots) },
+			ActionPrompt: "Run the backup now? (can take a while)",
+			Action: func() error {
+				cmd := exec.Command("sudo", "bash", script)
+				cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+				return cmd.Run()
+			},
+		})
+	}
+	return items
+}
+
+// backupScript returns the generated data backup script in scriptsDir
+func backupScript(scriptsDir string) string {
+	for _, name := range []string{"daily-backup.sh", "daily_backup.sh"} {
+		path := filepath.Join(scriptsDir, name)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// verifyStack checks the containers first-run configuration waits for
+func verifyStack(config *compose.ServiceConfig) error {
+	services, err := status.ListServices(config.DockerSocket)
+	if err != nil {
+		return err
+	}
+	byContainer := make(map[string]status.ServiceStatus)
+	for _, s := range services {
+		byContainer[s.Container] = s
+	}
+	var down []string
+	for _, check := range bootstrap.ReadinessChecks(config) {
+		s, ok := byContainer[check.Container]
+		if !ok || !s.OK() {
+			down = append(down, check.Container)
+		}
+	}
+	if len(down) > 0 {
+		return fmt.Errorf("not running or unhealthy: %s", strings.Join(down, ", "))
+	}
+	return nil
+}
+
+// serviceURL is a web interface the checklist probes
+type serviceURL struct {
+	Name string
+	URL  string
+}
+
+func serviceURLs(config *compose.ServiceConfig) []serviceURL {
+	urls := []serviceURL{
+		{"Immich", config.ServiceURL(config.ImmichPort)},
+		{"Nextcloud", config.ServiceURL(config.NextcloudPort)},
+		{"Glances", config.ServiceURL(config.GlancesPort)},
+	}
+	if config.SSOEnabled {
+		urls = append(urls, serviceURL{"Authentik", config.AuthentikURL()})
+	}
+	// The way in from outside fails on its own (tunnel down, proxy or DNS
+	// misconfigured) while the LAN path works, so both are checked
+	for _, a := range config.Addresses() {
+		if a.External != "" {
+			urls = append(urls, serviceURL{a.Service + " (away)", a.External})
+		}
+	}
+	return urls
+}
+
+// verifyURLs requires an answer below 500 from each URL; redirects to a
+// login page count as answering
+func verifyURLs(urls []serviceURL) error {
+	client := &http.Client{
+		Timeout: probeTimeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	var failed []string
+	for _, u := range urls {
+		resp, err := client.Get(u.URL)
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s (%s): no answer", u.Name, u.URL))
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 500 {
+			failed = append(failed, fmt.Sprintf("%s (%s): %s", u.Name, u.URL, resp.Status))
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%s", strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// verifyBackup requires a completed backup set
+func verifyBackup(snapshots string) error {
+	if _, err := os.Stat(filepath.Join(snapshots, "latest")); err != nil {
+		return fmt.Errorf("no completed backup in %s yet", snapshots)
+	}
+	return nil
+}
+
+// Remaining counts the items not yet done
+func Remaining(items []Item, done map[string]time.Time) int {
+	n := 0
+	for _, item := range items {
+		if _, ok := done[item.ID]; !ok {
+			n++
+		}
+	}
+	return n
+}
+
+// Run walks through the items not yet in done, marking each one finished
+// with the current time and calling save after every change so a stopped
+// walk-through resumes where it left off. It returns false when the owner
+// stopped before the end.
+func Run(reader *bufio.Reader, items []Item, done map[string]time.Time, save func() error) bool {
+	ask := func(prompt string) string {
+		fmt.Print(prompt)
+		line, err := reader.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			return "q"
+		}
+		return strings.ToLower(strings.TrimSpace(line))
+	}
+	markDone := func(item Item) {
+		done[item.ID] = time.Now()
+		if err := save(); err != nil {
+			fmt.Println("  Warning: could not save progress: " + err.Error())
+		}
+	}
+
+	for i, item := range items {
+		if _, ok := done[item.ID]; ok {
+			fmt.Printf("  ✓ %s\n", item.Title)
+			continue
+		}
+
+		fmt.Println()
+		fmt.Printf("  [%d/%d] %s\n", i+1, len(items), item.Title)
+		for _, line := range strings.Split(item.Hint, "\n") {
+			fmt.Println("        " + line)
+		}
+
+		offered := false
+	attempt:
+		for {
+			if item.Verify == nil {
+				switch ask("        Done? [y = done, s = skip, q = stop]: ") {
+				case "y", "yes":
+					markDone(item)
+					fmt.Println("  ✓ " + item.Title)
+					break attempt
+				case "s":
+					break attempt
+				case "q":
+					return false
+				}
+				continue
+			}
+
+			err := item.Verify()
+			if err == nil {
+				markDone(item)
+				fmt.Println("  ✓ " + item.Title)
+				break
+			}
+			fmt.Println("  ✗ " + err.Error())
+
+			if item.Action != nil && !offered {
+				offered = true
+				if answer := ask("        " + item.ActionPrompt + " [Y/n]: "); answer == "" || answer == "y" || answer == "yes" {
+					if err := item.Action(); err != nil {
+						fmt.Println("  ✗ " + err.Error())
+					}
+					continue
+				}
+			}
+
+			switch ask("        [Enter = check again, s = skip, q = stop]: ") {
+			case "s":
+				break attempt
+			case "q":
+				return false
+			}
+		}
+	}
+	return true
+}
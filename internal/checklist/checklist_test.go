@@ -0,0 +1,176 @@
+package checklist
+
+import (
+	"bufio"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/madhav/servctl/internal/compose"
+)
+
+func testConfig(t *testing.T) *compose.ServiceConfig {
+	config := compose.DefaultConfig()
+	config.InfraRoot = t.TempDir()
+	config.HostIP = "192.168.1.50"
+	config.NextcloudAdminUser = "admin"
+	config.ImmichAdminEmail = "admin@example.com"
+	return config
+}
+
+func ids(items []Item) string {
+	var out []string
+	for _, item := range items {
+		out = append(out, item.ID)
+	}
+	return strings.Join(out, ",")
+}
+
+func TestItems(t *testing.T) {
+	config := testConfig(t)
+	scriptsDir := filepath.Join(config.InfraRoot, "scripts")
+
+	items := Items(config, scriptsDir, "/mnt/backup")
+	if got := ids(items); got != "stack,urls,nextcloud-login,immich-app" {
+		t.Errorf("Items() = %s, want no backup step without a backup script", got)
+	}
+	if !strings.Contains(items[3].Hint, "http://192.168.1.50:2283") || !strings.Contains(items[2].Hint, `"admin"`) {
+		t.Errorf("Hints should name the URLs and accounts:\n%s\n%s", items[2].Hint, items[3].Hint)
+	}
+
+	os.MkdirAll(scriptsDir, 0755)
+	os.WriteFile(filepath.Join(scriptsDir, "daily-backup.sh"), []byte("#!/bin/bash\n"), 0755)
+	items = Items(config, scriptsDir, "/mnt/backup")
+	if got := ids(items); !strings.HasSuffix(got, ",first-backup") {
+		t.Errorf("Items() = %s, want the backup step last", got)
+	}
+	if !strings.Contains(items[4].Hint, "/mnt/backup/snapshots") {
+		t.Errorf("Backup hint = %q", items[4].Hint)
+	}
+}
+
+func TestServiceURLs_SSO(t *testing.T) {
+	config := testConfig(t)
+	if n := len(serviceURLs(config)); n != 3 {
+		t.Errorf("serviceURLs() = %d URLs, want 3", n)
+	}
+	config.SSOEnabled = true
+	urls := serviceURLs(config)
+	if last := urls[len(urls)-1]; last.Name != "Authentik" || last.URL != "http://192.168.1.50:9000" {
+		t.Errorf("SSO should add Authentik, got %+v", last)
+	}
+}
+
+func TestServiceURLs_External(t *testing.T) {
+	config := testConfig(t)
+	config.ImmichExternalURL = "https://photos.example.com"
+	urls := serviceURLs(config)
+	if len(urls) != 4 {
+		t.Fatalf("serviceURLs() = %+v, want the LAN URLs and Immich's external URL", urls)
+	}
+	if last := urls[3]; last.Name != "Immich (away)" || last.URL != "https://photos.example.com" {
+		t.Errorf("external URL entry = %+v", last)
+	}
+}
+
+func TestVerifyURLs(t *testing.T) {
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/login", http.StatusFound)
+	}))
+	defer ok.Close()
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer broken.Close()
+
+	if err := verifyURLs([]serviceURL{{"Nextcloud", ok.URL}}); err != nil {
+		t.Errorf("A redirect to the login page should count as answering: %v", err)
+	}
+	err := verifyURLs([]serviceURL{{"Nextcloud", ok.URL}, {"Immich", broken.URL}})
+	if err == nil || !strings.Contains(err.Error(), "Immich") || strings.Contains(err.Error(), "Nextcloud") {
+		t.Errorf("verifyURLs() error = %v, want only Immich reported", err)
+	}
+}
+
+func TestVerifyBackup(t *testing.T) {
+	snapshots := t.TempDir()
+	if err := verifyBackup(snapshots); err == nil {
+		t.Error("verifyBackup() should fail before the first backup")
+	}
+	os.Mkdir(filepath.Join(snapshots, "2024-05-01_030000"), 0755)
+	os.Symlink("2024-05-01_030000", filepath.Join(snapshots, "latest"))
+	if err := verifyBackup(snapshots); err != nil {
+		t.Errorf("verifyBackup() error = %v", err)
+	}
+}
+
+func TestRun(t *testing.T) {
+	running := false
+	checks := 0
+	items := []Item{
+		{ID: "stack", Title: "Start the stack",
+			Verify: func() error {
+				checks++
+				if !running {
+					return errors.New("not running")
+				}
+				return nil
+			},
+			ActionPrompt: "Start now?",
+			Action:       func() error { running = true; return nil },
+		},
+		{ID: "login", Title: "Log in"},
+		{ID: "app", Title: "Connect the app"},
+		{ID: "backup", Title: "First backup"},
+	}
+
+	done := map[string]time.Time{}
+	saves := 0
+	save := func() error { saves++; return nil }
+
+	// Accept the offered fix, confirm the login, skip the app, stop at the backup
+	finished := Run(bufio.NewReader(strings.NewReader("\ny\ns\nq\n")), items, done, save)
+	if finished {
+		t.Error("Run() should report that the owner stopped early")
+	}
+	if checks != 2 {
+		t.Errorf("Verify ran %d times, want 2 (before and after the fix)", checks)
+	}
+	if _, ok := done["stack"]; !ok {
+		t.Error("stack should be done after the fix")
+	}
+	if _, ok := done["login"]; !ok {
+		t.Error("login should be done after confirming")
+	}
+	if _, ok := done["app"]; ok {
+		t.Error("skipped item must not be marked done")
+	}
+	if saves != 2 {
+		t.Errorf("save called %d times, want once per completed item", saves)
+	}
+	if n := Remaining(items, done); n != 2 {
+		t.Errorf("Remaining() = %d, want 2", n)
+	}
+
+	// Resuming only asks about the open items; end of input stops
+	checks = 0
+	finished = Run(bufio.NewReader(strings.NewReader("y\ny\n")), items, done, save)
+	if !finished || Remaining(items, done) != 0 {
+		t.Errorf("Resume should finish the remaining items: finished %v, remaining %d", finished, Remaining(items, done))
+	}
+	if checks != 0 {
+		t.Error("Completed items must not be verified again")
+	}
+}
+
+func TestRun_EOFStops(t *testing.T) {
+	items := []Item{{ID: "manual", Title: "Manual step"}}
+	if Run(bufio.NewReader(strings.NewReader("")), items, map[string]time.Time{}, func() error { return nil }) {
+		t.Error("Run() should stop at end of input instead of looping")
+	}
+}
@@ -0,0 +1,100 @@
+package client
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// App is a desktop app that uses the server
+type App struct {
+	Name    string
+	Path    string // Installed executable or bundle; "" when not installed
+	Install string // Command that installs it on this OS
+	Purpose string
+
+	// Link points the installed app at the server. When LinkPrompt is set
+	// the owner is asked for a value first (an API key, say) and an empty
+	// answer skips linking.
+	LinkPrompt string
+	Link       func(value string) error
+}
+
+// Test seams
+var (
+	lookPath   = exec.LookPath
+	fileExists = func(path string) bool {
+		_, err := os.Stat(path)
+		return err == nil
+	}
+	startCommand = func(name string, args ...string) error {
+		return exec.Command(name, args...).Start()
+	}
+	runCommand = func(name string, args ...string) error {
+		cmd := exec.Command(name, args...)
+		cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+		return cmd.Run()
+	}
+)
+
+// DesktopApps lists the apps to set up on goos for the server in p
+func DesktopApps(p Profile, goos string) []App {
+	var apps []App
+	if url := p.URL(ServiceNextcloud); url != "" {
+		apps = append(apps, nextcloudApp(url, goos))
+	}
+	if url := p.URL(ServiceImmich); url != "" {
+		apps = append(apps, immichCLI(url))
+	}
+	return apps
+}
+
+// nextcloudApp is the Nextcloud desktop sync client. It is started with
+// the server URL filled in, so its account wizard goes straight to login.
+func nextcloudApp(url, goos string) App {
+	app := App{Name: "Nextcloud desktop", Purpose: "syncs a folder with your Nextcloud files"}
+	args := []string{"--overrideserverurl", url}
+
+	switch goos {
+	case "darwin":
+		app.Install = "brew install --cask nextcloud"
+		if bundle := "/Applications/Nextcloud.app"; fileExists(bundle) {
+			app.Path = bundle
+		}
+		app.Link = func(string) error {
+			return startCommand("open", append([]string{"-a", app.Path, "--args"}, args...)...)
+		}
+	case "windows":
+		app.Install = "winget install -e --id Nextcloud.NextcloudDesktop"
+		if exe := filepath.Join(os.Getenv("ProgramFiles"), "Nextcloud", "nextcloud.exe"); fileExists(exe) {
+			app.Path = exe
+		}
+		app.Link = func(string) error { return startCommand(app.Path, args...) }
+	default:
+		app.Install = "sudo apt install nextcloud-desktop"
+		if path, err := lookPath("nextcloud"); err == nil {
+			app.Path = path
+		}
+		app.Link = func(string) error { return startCommand(app.Path, args...) }
+	}
+	return app
+}
+
+// immichCLI is the Immich command-line uploader; Immich has no desktop
+// sync app, photos on a computer are uploaded with the CLI
+func immichCLI(url string) App {
+	app := App{
+		Name:       "Immich CLI",
+		Install:    "npm install -g @immich/cli",
+		Purpose:    "uploads photo folders from this computer (immich upload --recursive DIR)",
+		LinkPrompt: "Immich API key (Account Settings → API Keys, Enter to skip)",
+	}
+	if path, err := lookPath("immich"); err == nil {
+		app.Path = path
+	}
+	app.Link = func(key string) error {
+		return runCommand(app.Path, "login", strings.TrimSuffix(url, "/")+"/api", key)
+	}
+	return app
+}
@@ -0,0 +1,60 @@
+package client
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestDesktopApps(t *testing.T) {
+	var started, ran []string
+	origLook, origExists, origStart, origRun := lookPath, fileExists, startCommand, runCommand
+	lookPath = func(name string) (string, error) {
+		if name == "immich" {
+			return "/usr/bin/immich", nil
+		}
+		return "", errors.New("not found")
+	}
+	fileExists = func(path string) bool { return path == "/Applications/Nextcloud.app" }
+	startCommand = func(name string, args ...string) error {
+		started = append([]string{name}, args...)
+		return nil
+	}
+	runCommand = func(name string, args ...string) error {
+		ran = append([]string{name}, args...)
+		return nil
+	}
+	defer func() { lookPath, fileExists, startCommand, runCommand = origLook, origExists, origStart, origRun }()
+
+	p := NewProfile(testConfig())
+
+	apps := DesktopApps(p, "darwin")
+	if len(apps) != 2 || apps[0].Name != "Nextcloud desktop" || apps[1].Name != "Immich CLI" {
+		t.Fatalf("apps = %+v", apps)
+	}
+	if apps[0].Path != "/Applications/Nextcloud.app" || !strings.Contains(apps[0].Install, "brew") {
+		t.Errorf("macOS Nextcloud = %+v", apps[0])
+	}
+	if err := apps[0].Link(""); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(started, " ") != "open -a /Applications/Nextcloud.app --args --overrideserverurl http://192.168.1.50:8080" {
+		t.Errorf("started %v", started)
+	}
+
+	if apps[1].LinkPrompt == "" {
+		t.Error("Immich CLI login needs an API key")
+	}
+	apps[1].Link("KEY")
+	if strings.Join(ran, " ") != "/usr/bin/immich login http://192.168.1.50:2283/api KEY" {
+		t.Errorf("ran %v", ran)
+	}
+
+	win := DesktopApps(p, "windows")
+	if win[0].Path != "" || !strings.Contains(win[0].Install, "winget") {
+		t.Errorf("Windows Nextcloud = %+v", win[0])
+	}
+	if linux := DesktopApps(p, "linux"); !strings.Contains(linux[0].Install, "apt") {
+		t.Errorf("Linux Nextcloud = %+v", linux[0])
+	}
+}
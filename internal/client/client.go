@@ -0,0 +1,208 @@
+// Package client sets up a laptop or desktop to use a servctl server: it
+// finds the server, checks every web interface answers from this machine
+// and points the desktop apps at it. It runs on the client, so it builds
+// for Windows and macOS as well as Linux.
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/madhav/servctl/internal/compose"
+	"github.com/madhav/servctl/internal/utils"
+)
+
+// ProfileFile is the default name of the profile servctl -client-profile
+// writes on the server
+const ProfileFile = "servctl-client.json"
+
+// probeTimeout bounds each connectivity check
+const probeTimeout = 5 * time.Second
+
+// Service names in a profile
+const (
+	ServiceImmich    = "Immich"
+	ServiceNextcloud = "Nextcloud"
+	ServiceGlances   = "Glances"
+	ServiceAuthentik = "Authentik"
+)
+
+// Service is a web interface of the server
+type Service struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// Profile describes a server to its clients. It is written on the server
+// from the saved setup and holds no passwords, so it can be copied to every
+// machine in the house.
+type Profile struct {
+	Host          string    `json:"host"` // Address clients reach the server at
+	Services      []Service `json:"services"`
+	NextcloudUser string    `json:"nextcloud_user,omitempty"`
+	ImmichEmail   string    `json:"immich_email,omitempty"`
+
+	// Friendly names for the client's hosts file, when the server does not
+	// serve them with local DNS
+	HostsEntries string `json:"hosts_entries,omitempty"`
+}
+
+// NewProfile builds the profile of a saved setup
+func NewProfile(config *compose.ServiceConfig) Profile {
+	p := Profile{
+		Host:          config.HostIP,
+		Services:      services(config),
+		NextcloudUser: config.NextcloudAdminUser,
+		ImmichEmail:   config.ImmichAdminEmail,
+	}
+	if !config.LocalDNSEnabled {
+		p.HostsEntries = compose.GenerateHostsEntries(config)
+	}
+	return p
+}
+
+// ProfileForHost builds a profile for a server known only by its address,
+// assuming servctl's default ports
+func ProfileForHost(host string) Profile {
+	config := compose.DefaultConfig()
+	config.HostIP = host
+	return Profile{Host: host, Services: services(config)}
+}
+
+func services(config *compose.ServiceConfig) []Service {
+	s := []Service{
+		{ServiceImmich, config.ServiceURL(config.ImmichPort)},
+		{ServiceNextcloud, config.ServiceURL(config.NextcloudPort)},
+		{ServiceGlances, config.ServiceURL(config.GlancesPort)},
+	}
+	if config.SSOEnabled {
+		s = append(s, Service{ServiceAuthentik, config.AuthentikURL()})
+	}
+	return s
+}
+
+// URL returns the URL of a named service, or "" when the server has none
+func (p Profile) URL(name string) string {
+	for _, s := range p.Services {
+		if s.Name == name {
+			return s.URL
+		}
+	}
+	return ""
+}
+
+// WriteProfile saves a profile as JSON
+func WriteProfile(p Profile, path string) error {
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	return utils.AtomicWrite(path, append(data, '\n'), 0644)
+}
+
+// LoadProfile reads a profile written by WriteProfile
+func LoadProfile(path string) (Profile, error) {
+	var p Profile
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return p, err
+	}
+	if err := json.Unmarshal(data, &p); err != nil {
+		return p, fmt.Errorf("%s is not a servctl client profile: %w", path, err)
+	}
+	if p.Host == "" || len(p.Services) == 0 {
+		return p, fmt.Errorf("%s has no server address or services", path)
+	}
+	return p, nil
+}
+
+// lookupHost resolves a name with the system resolver, which answers .local
+// names over mDNS on macOS, Windows 10+ and Linux with nss-mdns; a test seam
+var lookupHost = net.LookupHost
+
+// DefaultNames are tried when no server is given: the friendly name servctl
+// sets up with local DNS, then the mDNS names of a typical server
+var DefaultNames = []string{"server." + compose.DefaultLocalDomain, "homeserver.local", "ubuntu.local"}
+
+// Discover finds the server. arg is a profile file, a host name or an IP;
+// when empty, a profile in dirs is used, then DefaultNames are resolved.
+func Discover(arg string, dirs []string) (Profile, string, error) {
+	if arg != "" {
+		if _, err := os.Stat(arg); err == nil {
+			p, err := LoadProfile(arg)
+			return p, "profile " + arg, err
+		}
+		if _, err := lookupHost(arg); err != nil {
+			return Profile{}, "", fmt.Errorf("cannot resolve %s: %w", arg, err)
+		}
+		return ProfileForHost(arg), "host " + arg, nil
+	}
+
+	for _, dir := range dirs {
+		path := filepath.Join(dir, ProfileFile)
+		if _, err := os.Stat(path); err == nil {
+			p, err := LoadProfile(path)
+			return p, "profile " + path, err
+		}
+	}
+	for _, name := range DefaultNames {
+		if _, err := lookupHost(name); err == nil {
+			return ProfileForHost(name), "name " + name, nil
+		}
+	}
+	return Profile{}, "", fmt.Errorf("no server found: copy %s from the server (servctl -client-profile) or pass its name or IP", ProfileFile)
+}
+
+// Check is the result of one connectivity check
+type Check struct {
+	Service Service
+	Status  string // HTTP status, empty when there was no answer
+	Err     error
+}
+
+// Verify checks that every service answers from this machine. Any answer
+// below 500 passes; redirects to a login page count as answering.
+func Verify(p Profile) []Check {
+	client := &http.Client{
+		Timeout: probeTimeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	var checks []Check
+	for _, s := range p.Services {
+		c := Check{Service: s}
+		resp, err := client.Get(s.URL)
+		if err != nil {
+			c.Err = fmt.Errorf("no answer - is this machine on the same network?")
+		} else {
+			resp.Body.Close()
+			c.Status = resp.Status
+			if resp.StatusCode >= 500 {
+				c.Err = fmt.Errorf("answered %s - check the container with servctl -status on the server", resp.Status)
+			}
+		}
+		checks = append(checks, c)
+	}
+	return checks
+}
+
+// HostsFile is where this OS keeps static host names
+func HostsFile(goos string) string {
+	if goos == "windows" {
+		return `C:\Windows\System32\drivers\etc\hosts`
+	}
+	return "/etc/hosts"
+}
+
+// HasHostsEntries reports whether the hosts file already has servctl's block
+func HasHostsEntries(path string) bool {
+	data, err := os.ReadFile(path)
+	return err == nil && strings.Contains(string(data), "# BEGIN servctl")
+}
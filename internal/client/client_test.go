@@ -0,0 +1,154 @@
+package client
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/madhav/servctl/internal/compose"
+)
+
+func testConfig() *compose.ServiceConfig {
+	config := compose.DefaultConfig()
+	config.HostIP = "192.168.1.50"
+	config.NextcloudAdminUser = "admin"
+	config.NextcloudAdminPass = "s3cret-pass"
+	config.ImmichAdminEmail = "admin@example.com"
+	return config
+}
+
+func TestNewProfile(t *testing.T) {
+	config := testConfig()
+	p := NewProfile(config)
+
+	if p.Host != "192.168.1.50" {
+		t.Errorf("Host = %q", p.Host)
+	}
+	if got := p.URL(ServiceNextcloud); got != "http://192.168.1.50:8080" {
+		t.Errorf("Nextcloud URL = %q", got)
+	}
+	if p.URL(ServiceAuthentik) != "" {
+		t.Error("Authentik should only be listed with SSO enabled")
+	}
+	if !strings.Contains(p.HostsEntries, "photos.home.arpa") {
+		t.Errorf("Hosts entries should be included without local DNS:\n%s", p.HostsEntries)
+	}
+
+	config.LocalDNSEnabled = true
+	if NewProfile(config).HostsEntries != "" {
+		t.Error("Hosts entries are not needed when the server runs local DNS")
+	}
+}
+
+func TestProfileRoundTripHasNoSecrets(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ProfileFile)
+	if err := WriteProfile(NewProfile(testConfig()), path); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	if strings.Contains(string(data), "s3cret-pass") {
+		t.Error("Profile must not contain passwords")
+	}
+
+	p, err := LoadProfile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.NextcloudUser != "admin" || p.URL(ServiceImmich) != "http://192.168.1.50:2283" {
+		t.Errorf("Loaded profile = %+v", p)
+	}
+
+	bad := filepath.Join(t.TempDir(), "bad.json")
+	os.WriteFile(bad, []byte(`{"services":[]}`), 0644)
+	if _, err := LoadProfile(bad); err == nil {
+		t.Error("A profile without host or services should be rejected")
+	}
+}
+
+func TestDiscover(t *testing.T) {
+	resolvable := map[string]bool{"nas.local": true, "homeserver.local": true}
+	orig := lookupHost
+	lookupHost = func(name string) ([]string, error) {
+		if resolvable[name] {
+			return []string{"192.168.1.50"}, nil
+		}
+		return nil, errors.New("no such host")
+	}
+	defer func() { lookupHost = orig }()
+
+	// A host given by name uses the default ports
+	p, from, err := Discover("nas.local", nil)
+	if err != nil || p.URL(ServiceImmich) != "http://nas.local:2283" || from != "host nas.local" {
+		t.Errorf("Discover(host) = %+v, %q, %v", p, from, err)
+	}
+	if _, _, err := Discover("missing.local", nil); err == nil {
+		t.Error("An unresolvable host should be an error")
+	}
+
+	// A profile in a searched directory wins over default names
+	dir := t.TempDir()
+	WriteProfile(NewProfile(testConfig()), filepath.Join(dir, ProfileFile))
+	p, _, err = Discover("", []string{t.TempDir(), dir})
+	if err != nil || p.Host != "192.168.1.50" {
+		t.Errorf("Discover(profile dir) = %+v, %v", p, err)
+	}
+
+	// Otherwise the first default name that resolves
+	p, from, err = Discover("", []string{t.TempDir()})
+	if err != nil || p.Host != "homeserver.local" || from != "name homeserver.local" {
+		t.Errorf("Discover(default names) = %+v, %q, %v", p, from, err)
+	}
+
+	resolvable = nil
+	if _, _, err := Discover("", nil); err == nil || !strings.Contains(err.Error(), ProfileFile) {
+		t.Errorf("Without a server the error should explain the profile: %v", err)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/login", http.StatusFound)
+	}))
+	defer ok.Close()
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer broken.Close()
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	checks := Verify(Profile{Host: "x", Services: []Service{
+		{"Nextcloud", ok.URL}, {"Immich", broken.URL}, {"Glances", down.URL},
+	}})
+	if len(checks) != 3 {
+		t.Fatalf("got %d checks", len(checks))
+	}
+	if checks[0].Err != nil {
+		t.Errorf("A redirect to login should pass: %v", checks[0].Err)
+	}
+	if checks[1].Err == nil || checks[1].Status == "" {
+		t.Errorf("A 502 should fail with its status: %+v", checks[1])
+	}
+	if checks[2].Err == nil || checks[2].Status != "" {
+		t.Errorf("No answer should fail without a status: %+v", checks[2])
+	}
+}
+
+func TestHostsEntries(t *testing.T) {
+	if HostsFile("windows") != `C:\Windows\System32\drivers\etc\hosts` || HostsFile("darwin") != "/etc/hosts" {
+		t.Error("Unexpected hosts file paths")
+	}
+	path := filepath.Join(t.TempDir(), "hosts")
+	os.WriteFile(path, []byte("127.0.0.1 localhost\n"), 0644)
+	if HasHostsEntries(path) {
+		t.Error("Plain hosts file has no servctl block")
+	}
+	os.WriteFile(path, []byte("127.0.0.1 localhost\n"+NewProfile(testConfig()).HostsEntries), 0644)
+	if !HasHostsEntries(path) {
+		t.Error("servctl block should be found")
+	}
+}
@@ -1,6 +1,7 @@
 package compose
 
 import (
+	"bufio"
 	"strings"
 	"testing"
 )
@@ -258,6 +259,13 @@ func TestGenerateDockerCompose(t *testing.T) {
 	if !strings.Contains(content, "servctl-network:") {
 		t.Error("Docker Compose missing servctl-network")
 	}
+
+	// Rootless Docker listens on a per-user socket
+	config.DockerSocket = "/run/user/1000/docker.sock"
+	content, _ = GenerateDockerCompose(config)
+	if !strings.Contains(content, "/run/user/1000/docker.sock:/var/run/docker.sock:ro") {
+		t.Error("Docker Compose should mount the configured Docker socket")
+	}
 }
 
 func TestGenerateEnvFile(t *testing.T) {
@@ -275,11 +283,11 @@ func TestGenerateEnvFile(t *testing.T) {
 
 	// Check for expected variables
 	expectedVars := []string{
-		"TZ=Asia/Kolkata",
-		"PUID=1000",
-		"PGID=1000",
-		"HOST_IP=192.168.1.100",
-		"DATA_ROOT=/mnt/data",
+		`TZ="Asia/Kolkata"`,
+		`PUID="1000"`,
+		`PGID="1000"`,
+		`HOST_IP="192.168.1.100"`,
+		`DATA_ROOT="/mnt/data"`,
 	}
 
 	for _, v := range expectedVars {
@@ -365,3 +373,231 @@ func BenchmarkGeneratePassword(b *testing.B) {
 		GeneratePassword(24)
 	}
 }
+
+func TestNormalizeUsername(t *testing.T) {
+	tests := map[string]string{
+		"Jane Doe":    "jane.doe",
+		"  Bob  ":     "bob",
+		"Anne-Marie!": "anne.marie",
+		"José Müller": "jose.muller",
+		"Łukasz Żak":  "lukasz.zak",
+		"Søren Weiß":  "soren.weiss",
+		"李":           "",
+	}
+	for input, want := range tests {
+		if got := NormalizeUsername(input); got != want {
+			t.Errorf("NormalizeUsername(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
+
+func TestPromptFamilyMembers_AsksForLoginName(t *testing.T) {
+	// Name, email, quota, then the login name a Chinese name needs
+	input := "李雷\nli@example.com\n\nLi Lei\n\n\n\n"
+	config := PromptFamilyMembers(bufio.NewReader(strings.NewReader(input)), DefaultConfig())
+	if len(config.Users) != 1 || config.Users[0].Username != "li.lei" || config.Users[0].Name != "李雷" {
+		t.Errorf("Users = %+v, want 李雷 with the login name li.lei", config.Users)
+	}
+}
+
+func TestParseQuota(t *testing.T) {
+	tests := []struct {
+		quota   string
+		want    int64
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"none", 0, false},
+		{"50GB", 50 << 30, false},
+		{"1 TB", 1 << 40, false},
+		{"512M", 512 << 20, false},
+		{"1.5G", 3 << 29, false},
+		{"lots", 0, true},
+		{"-5GB", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseQuota(tt.quota)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseQuota(%q) error = %v, wantErr %v", tt.quota, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseQuota(%q) = %d, want %d", tt.quota, got, tt.want)
+		}
+	}
+}
+
+func TestValidate_Users(t *testing.T) {
+	config := DefaultConfig()
+	config.AutoFillDefaults()
+	config.NextcloudAdminPass = "adminpass123"
+	config.Users = []FamilyMember{
+		{Name: "Jane", Username: "jane", Email: "jane@example.com", Quota: "10GB"},
+		{Name: "Jane", Username: "jane", Email: "jane2@example.com", Quota: "10GB"},
+	}
+
+	errs := config.Validate()
+	if len(errs) != 1 {
+		t.Errorf("Expected 1 duplicate username error, got %v", errs)
+	}
+}
+
+// composeServiceBlocks splits generated compose content into per-service sections
+func composeServiceBlocks(content string) map[string]string {
+	blocks := make(map[string]string)
+	current := ""
+	for _, line := range strings.Split(content, "\n") {
+		if strings.HasPrefix(line, "  ") && !strings.HasPrefix(line, "   ") && strings.HasSuffix(line, ":") {
+			current = strings.TrimSuffix(strings.TrimSpace(line), ":")
+			continue
+		}
+		if !strings.HasPrefix(line, " ") && line != "" {
+			current = ""
+		}
+		if current != "" {
+			blocks[current] += line + "\n"
+		}
+	}
+	return blocks
+}
+
+func TestGenerateDockerCompose_Healthchecks(t *testing.T) {
+	config := DefaultConfig()
+	config.HostIP = "192.168.1.100"
+	config.NextcloudAdminPass = "adminpass"
+	config.SSOEnabled = true
+	config.AutoFillDefaults()
+
+	content, err := GenerateDockerCompose(config)
+	if err != nil {
+		t.Fatalf("GenerateDockerCompose() error: %v", err)
+	}
+	blocks := composeServiceBlocks(content)
+
+	healthchecked := []string{
+		"immich-server", "immich-machine-learning", "immich-redis", "immich-postgres",
+		"nextcloud", "nextcloud-mariadb", "glances",
+		"authentik-postgres", "authentik-redis", "authentik-server", "authentik-worker",
+	}
+	for _, name := range healthchecked {
+		if !strings.Contains(blocks[name], "healthcheck:") {
+			t.Errorf("Service %s has no healthcheck", name)
+		}
+	}
+
+	dependencies := map[string][]string{
+		"immich-server":    {"immich-redis", "immich-postgres"},
+		"nextcloud":        {"nextcloud-mariadb"},
+		"authentik-server": {"authentik-postgres", "authentik-redis"},
+		"authentik-worker": {"authentik-postgres", "authentik-redis"},
+	}
+	for service, deps := range dependencies {
+		for _, dep := range deps {
+			want := dep + ":\n        condition: service_healthy"
+			if !strings.Contains(blocks[service], want) {
+				t.Errorf("%s should wait for %s to be healthy", service, dep)
+			}
+		}
+	}
+}
+
+func TestSubnetWithPrefix(t *testing.T) {
+	if got := SubnetWithPrefix("192.168.1.100", 24); got != "192.168.1.0/24" {
+		t.Errorf("SubnetWithPrefix() = %q, want 192.168.1.0/24", got)
+	}
+	if got := SubnetWithPrefix("10.0.37.5", 16); got != "10.0.0.0/16" {
+		t.Errorf("SubnetWithPrefix() = %q, want 10.0.0.0/16", got)
+	}
+	if got := PrefixLength("10.0.0.0/16"); got != 16 {
+		t.Errorf("PrefixLength() = %d, want 16", got)
+	}
+}
+
+func TestRulesFromSubnet(t *testing.T) {
+	showAdded := `Added user rules (see 'ufw status' for running firewall):
+ufw allow 22/tcp
+ufw allow from 192.168.1.0/24 to any port 61208 proto tcp
+ufw allow 8080/tcp`
+
+	rules := rulesFromSubnet(showAdded, "192.168.1.0/24")
+	if len(rules) != 1 || rules[0] != "allow from 192.168.1.0/24 to any port 61208 proto tcp" {
+		t.Errorf("rulesFromSubnet() = %v", rules)
+	}
+}
+
+func TestGenerateDockerCompose_MLPresets(t *testing.T) {
+	config := DefaultConfig()
+	config.MLModels = MLLarge
+
+	content, err := GenerateDockerCompose(config)
+	if err != nil {
+		t.Fatalf("GenerateDockerCompose() error: %v", err)
+	}
+	for _, want := range []string{
+		"MACHINE_LEARNING_PRELOAD__CLIP__TEXTUAL=ViT-L-16-SigLIP-384__webli",
+		"MACHINE_LEARNING_PRELOAD__FACIAL_RECOGNITION__RECOGNITION=antelopev2",
+	} {
+		if !strings.Contains(content, want) {
+			t.Errorf("Docker Compose missing %q", want)
+		}
+	}
+
+	config.MLModels = MLOff
+	content, _ = GenerateDockerCompose(config)
+	if strings.Contains(content, "immich-machine-learning:") {
+		t.Error("ML container should be omitted when ML is off")
+	}
+	if !strings.Contains(content, "IMMICH_MACHINE_LEARNING_ENABLED=false") {
+		t.Error("Immich server should be told ML is disabled")
+	}
+}
+
+func TestRecommendMLPreset(t *testing.T) {
+	tests := []struct {
+		ramGB uint64
+		want  string
+	}{
+		{2, MLOff},
+		{4, MLSmall},
+		{16, MLDefault},
+		{64, MLDefault},
+	}
+	for _, tt := range tests {
+		if got := RecommendMLPreset(tt.ramGB << 30); got != tt.want {
+			t.Errorf("RecommendMLPreset(%d GB) = %q, want %q", tt.ramGB, got, tt.want)
+		}
+	}
+}
+
+func TestGenerateDockerCompose_MountsAreRegistered(t *testing.T) {
+	config := DefaultConfig()
+	config.DataRoot = "/srv/data"
+	config.SSOEnabled = true
+
+	content, err := GenerateDockerCompose(config)
+	if err != nil {
+		t.Fatalf("GenerateDockerCompose() error: %v", err)
+	}
+
+	declared := make(map[string]bool)
+	for _, key := range config.MountedPaths() {
+		declared[config.Path(key)] = true
+	}
+
+	mounts := 0
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "- "+config.DataRoot) {
+			continue
+		}
+		host, _, _ := strings.Cut(strings.TrimPrefix(line, "- "), ":")
+		if !declared[host] {
+			t.Errorf("compose mounts %s, which MountedPaths does not declare", host)
+		}
+		mounts++
+	}
+	if mounts != len(declared)+1 { // authentik/media is mounted by both server and worker
+		t.Errorf("found %d data mounts, want %d", mounts, len(declared)+1)
+	}
+}
@@ -12,23 +12,42 @@ import (
 	"regexp"
 	"strings"
 	"time"
+
+	"github.com/madhav/servctl/internal/paths"
+
+	"github.com/madhav/servctl/internal/storage"
+	"github.com/madhav/servctl/internal/timing"
 )
 
 // ServiceConfig holds all configuration for servctl services
 type ServiceConfig struct {
+	// Layout version of the saved state (see SchemaVersion in migrate.go)
+	SchemaVersion int
+
 	// System settings
 	Timezone string // TZ (e.g., "Asia/Kolkata")
+	Locale   string // LANG (e.g., "en_IN.UTF-8"), see locale.go
 	PUID     int    // Process User ID
 	PGID     int    // Process Group ID
 	HostIP   string // Static IP address of the host
 
+	// ShareGroup names PGID when it is a group shared with other people
+	// (e.g. "media") rather than the owner's own; empty otherwise
+	ShareGroup string
+
 	// Paths (opinionated, not user-configurable)
 	DataRoot   string // /mnt/data
 	InfraRoot  string // ~/infra
-	UploadPath string // /mnt/data/gallery (Immich uploads)
+	UploadPath string // /mnt/data/gallery (Immich uploads, from the path registry)
+
+	// ServiceRoots moves a service's data off DataRoot, e.g. Nextcloud
+	// onto the SSD (see paths.Separable)
+	ServiceRoots paths.Roots `json:",omitempty"`
 
 	// Immich settings
 	ImmichDBPassword string // Postgres password for Immich
+	ImmichAdminEmail string // Email of the Immich admin created at bootstrap
+	ImmichAdminPass  string // Password of the Immich admin
 
 	// Nextcloud settings
 	NextcloudAdminUser      string // Admin username
@@ -36,30 +55,132 @@ type ServiceConfig struct {
 	NextcloudDBPassword     string // MariaDB password for Nextcloud
 	NextcloudTrustedDomains string // Comma-separated trusted domains
 
+	// Estimated entropy in bits that admin passwords typed in during setup
+	// need (see password.go); 0 uses DefaultPasswordPolicy
+	MinPasswordEntropy int `json:",omitempty"`
+
 	// Notification webhooks
 	DiscordWebhookURL string // Discord webhook for notifications
 	TelegramBotToken  string // Telegram bot token
 	TelegramChatID    string // Telegram chat ID
 
+	// Outgoing mail (SMTP) - optional, used by Nextcloud and system mail
+	SMTPHost      string // SMTP server hostname (empty disables mail)
+	SMTPPort      int    // Default: 587 (STARTTLS), 465 for implicit TLS
+	SMTPUser      string // SMTP username
+	SMTPPassword  string // SMTP password or app password
+	SMTPFrom      string // From address (e.g., "server@example.com")
+	SMTPRecipient string // Where system and cron mail is delivered
+
+	// Single sign-on (Authentik as OIDC provider) - optional
+	SSOEnabled          bool   // Deploy Authentik and wire apps to it
+	AuthentikSecretKey  string // AUTHENTIK_SECRET_KEY
+	AuthentikDBPassword string // Postgres password for Authentik
+	AuthentikAdminPass  string // Password of the akadmin bootstrap user
+	NextcloudOIDCSecret string // OIDC client secret for Nextcloud
+	ImmichOIDCSecret    string // OIDC client secret for Immich
+
+	// Local names for LAN clients
+	LocalDomain     string // Domain for friendly names (default: home.arpa)
+	LocalDNSEnabled bool   // Serve the names to the LAN with dnsmasq
+
+	// Cloudflare Tunnel for remote access without port forwarding - optional
+	TunnelToken  string `json:",omitempty"` // Connector token from the Cloudflare dashboard
+	TunnelDomain string `json:",omitempty"` // Domain on Cloudflare the public names live under
+
+	// Router forward of port 443 to a TLS reverse proxy here, kept by
+	// 'servctl -port-forward on': "upnp" or "natpmp", empty when off
+	PortForward string `json:",omitempty"`
+	// Countries allowed to reach the forwarded port; any when empty
+	PortForwardCountries []string `json:",omitempty"`
+
+	// URLs the services are reached at from outside the LAN (tunnel,
+	// Tailscale, reverse proxy); empty when only the LAN URL exists
+	ImmichExternalURL    string `json:",omitempty"`
+	NextcloudExternalURL string `json:",omitempty"`
+
+	// Family accounts provisioned after services start
+	Users []FamilyMember
+
+	// Immich sharing starter applied to the family accounts
+	ImmichFamilyAlbum    string `json:",omitempty"` // Shared album every member can add to
+	ImmichPartnerSharing bool   `json:",omitempty"` // Members share their libraries with each other
+	ImmichAPIKeys        bool   `json:",omitempty"` // Create an API key per member
+
+	// Container log shipping (see logging.go) - optional
+	LogShipping      string `json:",omitempty"` // "", "loki" or "syslog"
+	SyslogTarget     string `json:",omitempty"` // host[:port], udp:// or tcp:// prefix
+	LogRetentionDays int    `json:",omitempty"` // How long Loki keeps logs
+
+	// Immich ML model preset (off, small, default, large)
+	MLModels string
+
+	// Immich storage template for originals; empty leaves Immich's default
+	ImmichStorageTemplate string `json:",omitempty"`
+
+	// Versions of system packages installed during setup (package -> version)
+	PackageVersions map[string]string `json:",omitempty"`
+
+	// Speed-tiered setups: databases and caches live here, symlinked from
+	// their DataRoot locations (empty keeps everything on DataRoot)
+	FastRoot string `json:",omitempty"`
+
+	// Btrfs/ZFS snapshots of DataRoot taken before risky changes, newest first
+	Snapshots []storage.Snapshot `json:",omitempty"`
+
+	// Surface scans of used disks from Phase 2, one per disk (by serial)
+	SurfaceScans []storage.SurfaceScan `json:",omitempty"`
+
+	// First-boot checklist items the owner has completed, by item ID
+	Checklist map[string]time.Time `json:",omitempty"`
+
+	// Receives servctl's lifecycle events as JSON (see package hooks)
+	EventWebhookURL string `json:",omitempty"`
+
+	// UPS monitored by Network UPS Tools, as "name@host" (see package ups)
+	UPS string `json:",omitempty"`
+
+	// Kernel parameters tuned in Phase 1, kept so they can be undone
+	Sysctl *SysctlRecord `json:",omitempty"`
+
+	// How long the last setup's phases and slow commands took
+	Timings []timing.Entry `json:",omitempty"`
+
+	// Rootless setup (--no-sudo): rootless Docker, no changes outside $HOME
+	Rootless     bool   `json:",omitempty"`
+	DockerSocket string // Default: /var/run/docker.sock
+
 	// Service ports (with sensible defaults)
 	ImmichPort    int // Default: 2283
 	NextcloudPort int // Default: 8080
 	GlancesPort   int // Default: 61208
+	AuthentikPort int // Default: 9000
 }
 
+// DefaultDockerSocket is the rootful Docker daemon socket
+const DefaultDockerSocket = "/var/run/docker.sock"
+
 // DefaultConfig returns a ServiceConfig with sensible defaults
 func DefaultConfig() *ServiceConfig {
 	return &ServiceConfig{
-		Timezone:           detectTimezone(),
-		PUID:               1000,
-		PGID:               1000,
-		DataRoot:           "/mnt/data",
-		InfraRoot:          "",
-		UploadPath:         "/mnt/data/gallery",
-		ImmichPort:         2283,
-		NextcloudPort:      8080,
-		GlancesPort:        61208,
-		NextcloudAdminUser: "admin",
+		Timezone:              detectTimezone(),
+		Locale:                detectLocale(),
+		PUID:                  1000,
+		PGID:                  1000,
+		DataRoot:              "/mnt/data",
+		InfraRoot:             "",
+		UploadPath:            "/mnt/data/gallery",
+		ImmichPort:            2283,
+		NextcloudPort:         8080,
+		GlancesPort:           61208,
+		AuthentikPort:         9000,
+		NextcloudAdminUser:    "admin",
+		ImmichAdminEmail:      "admin@servctl.local",
+		SMTPPort:              587,
+		LocalDomain:           DefaultLocalDomain,
+		DockerSocket:          DefaultDockerSocket,
+		MLModels:              MLDefault,
+		ImmichStorageTemplate: DefaultStorageTemplate,
 	}
 }
 
@@ -225,6 +346,15 @@ func ValidateWebhookURL(url string) error {
 	return nil
 }
 
+// ValidateEmail performs a basic sanity check on an email address
+func ValidateEmail(email string) error {
+	emailPattern := regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`)
+	if !emailPattern.MatchString(email) {
+		return fmt.Errorf("invalid email address: %s", email)
+	}
+	return nil
+}
+
 // ValidatePassword checks password requirements
 func ValidatePassword(password string, minLength int) error {
 	if minLength == 0 {
@@ -314,6 +444,11 @@ func (c *ServiceConfig) Validate() []error {
 	if c.Timezone == "" {
 		errors = append(errors, fmt.Errorf("timezone is required"))
 	}
+	if c.Locale != "" {
+		if err := ValidateLocale(c.Locale); err != nil {
+			errors = append(errors, err)
+		}
+	}
 
 	// Host IP
 	if c.HostIP != "" {
@@ -338,11 +473,81 @@ func (c *ServiceConfig) Validate() []error {
 		errors = append(errors, fmt.Errorf("Nextcloud admin password must be at least 8 characters"))
 	}
 
+	// Published ports
+	errors = append(errors, c.ValidatePorts()...)
+
+	// Single sign-on
+	if c.SSOEnabled {
+		if c.HostIP == "" {
+			errors = append(errors, fmt.Errorf("SSO requires a host IP for OIDC redirect URIs"))
+		}
+		if len(c.NextcloudOIDCSecret) < 16 || len(c.ImmichOIDCSecret) < 16 {
+			errors = append(errors, fmt.Errorf("OIDC client secrets must be at least 16 characters"))
+		}
+	}
+
+	// Local names
+	if c.LocalDomain != "" && !localDomainRegex.MatchString(c.LocalDomain) {
+		errors = append(errors, fmt.Errorf("invalid local domain: %s", c.LocalDomain))
+	}
+	if c.LocalDNSEnabled && c.HostIP == "" {
+		errors = append(errors, fmt.Errorf("local DNS requires a host IP"))
+	}
+
+	// Remote access
+	if c.TunnelEnabled() {
+		if err := ValidateTunnelToken(c.TunnelToken); err != nil {
+			errors = append(errors, err)
+		}
+		if !localDomainRegex.MatchString(c.TunnelDomain) {
+			errors = append(errors, fmt.Errorf("invalid tunnel domain: %q", c.TunnelDomain))
+		}
+	}
+	for _, a := range c.Addresses() {
+		if err := ValidateExternalURL(a.External); err != nil {
+			errors = append(errors, fmt.Errorf("%s external URL: %w", a.Service, err))
+		}
+	}
+
+	if err := ValidateStorageTemplate(c.ImmichStorageTemplate); err != nil {
+		errors = append(errors, err)
+	}
+	if err := ValidateLogShipping(c); err != nil {
+		errors = append(errors, err)
+	}
+
+	// Family accounts
+	seen := make(map[string]bool)
+	for _, u := range c.Users {
+		if err := ValidateFamilyMember(u); err != nil {
+			errors = append(errors, fmt.Errorf("user %q: %w", u.Name, err))
+		}
+		if seen[u.Username] {
+			errors = append(errors, fmt.Errorf("duplicate username: %s", u.Username))
+		}
+		seen[u.Username] = true
+	}
+
 	// Webhook URLs
 	if err := ValidateWebhookURL(c.DiscordWebhookURL); err != nil {
 		errors = append(errors, fmt.Errorf("discord webhook: %w", err))
 	}
 
+	// SMTP (only validated when a host is configured)
+	if c.SMTPHost != "" {
+		if c.SMTPPort <= 0 || c.SMTPPort > 65535 {
+			errors = append(errors, fmt.Errorf("SMTP port must be between 1 and 65535"))
+		}
+		if err := ValidateEmail(c.SMTPFrom); err != nil {
+			errors = append(errors, fmt.Errorf("SMTP from address: %w", err))
+		}
+		if c.SMTPRecipient != "" {
+			if err := ValidateEmail(c.SMTPRecipient); err != nil {
+				errors = append(errors, fmt.Errorf("SMTP recipient: %w", err))
+			}
+		}
+	}
+
 	return errors
 }
 
@@ -351,6 +556,9 @@ func (c *ServiceConfig) AutoFillDefaults() {
 	if c.Timezone == "" {
 		c.Timezone = detectTimezone()
 	}
+	if c.Locale == "" {
+		c.Locale = detectLocale()
+	}
 	if c.PUID == 0 {
 		c.PUID = 1000
 	}
@@ -360,8 +568,9 @@ func (c *ServiceConfig) AutoFillDefaults() {
 	if c.DataRoot == "" {
 		c.DataRoot = "/mnt/data"
 	}
+	c.fillTunnelURLs()
 	if c.UploadPath == "" {
-		c.UploadPath = c.DataRoot + "/gallery"
+		c.UploadPath = c.Path(paths.Gallery)
 	}
 	if c.ImmichDBPassword == "" {
 		c.ImmichDBPassword = GenerateDBPassword()
@@ -372,6 +581,24 @@ func (c *ServiceConfig) AutoFillDefaults() {
 	if c.NextcloudAdminUser == "" {
 		c.NextcloudAdminUser = "admin"
 	}
+	if c.ImmichAdminEmail == "" {
+		c.ImmichAdminEmail = "admin@servctl.local"
+	}
+	if c.LocalDomain == "" {
+		c.LocalDomain = DefaultLocalDomain
+	}
+	if c.DockerSocket == "" {
+		c.DockerSocket = DefaultDockerSocket
+	}
+	if c.MLModels == "" {
+		c.MLModels = MLDefault
+	}
+	if c.LogShipping == LogShippingLoki && c.LogRetentionDays == 0 {
+		c.LogRetentionDays = DefaultLogRetentionDays
+	}
+	if c.ImmichAdminPass == "" {
+		c.ImmichAdminPass = GeneratePassword(16)
+	}
 	if c.ImmichPort == 0 {
 		c.ImmichPort = 2283
 	}
@@ -381,4 +608,64 @@ func (c *ServiceConfig) AutoFillDefaults() {
 	if c.GlancesPort == 0 {
 		c.GlancesPort = 61208
 	}
+	if c.AuthentikPort == 0 {
+		c.AuthentikPort = 9000
+	}
+	if c.SSOEnabled {
+		if c.AuthentikSecretKey == "" {
+			c.AuthentikSecretKey = GeneratePassword(50)
+		}
+		if c.AuthentikDBPassword == "" {
+			c.AuthentikDBPassword = GenerateDBPassword()
+		}
+		if c.AuthentikAdminPass == "" {
+			c.AuthentikAdminPass = GeneratePassword(16)
+		}
+		if c.NextcloudOIDCSecret == "" {
+			c.NextcloudOIDCSecret = GeneratePassword(40)
+		}
+		if c.ImmichOIDCSecret == "" {
+			c.ImmichOIDCSecret = GeneratePassword(40)
+		}
+	}
+	if c.SMTPPort == 0 {
+		c.SMTPPort = 587
+	}
+	if c.SMTPRecipient == "" {
+		c.SMTPRecipient = c.SMTPFrom
+	}
+}
+
+// SysctlRecord is the kernel tuning servctl applied: the drop-in it wrote
+// and the value each parameter had before, first run wins
+type SysctlRecord struct {
+	DropIn   string
+	Previous map[string]string
+}
+
+// Secrets returns every credential in the configuration, so tools that copy
+// generated files elsewhere (e.g. the ~/infra git history) can check none
+// leaked
+func (c *ServiceConfig) Secrets() []string {
+	var secrets []string
+	for _, s := range []string{
+		c.ImmichDBPassword, c.ImmichAdminPass,
+		c.NextcloudAdminPass, c.NextcloudDBPassword,
+		c.DiscordWebhookURL, c.TelegramBotToken, c.SMTPPassword,
+		c.AuthentikSecretKey, c.AuthentikDBPassword, c.AuthentikAdminPass,
+		c.NextcloudOIDCSecret, c.ImmichOIDCSecret, c.TunnelToken,
+	} {
+		if s != "" {
+			secrets = append(secrets, s)
+		}
+	}
+	for _, u := range c.Users {
+		if u.Password != "" {
+			secrets = append(secrets, u.Password)
+		}
+		if u.ImmichAPIKey != "" {
+			secrets = append(secrets, u.ImmichAPIKey)
+		}
+	}
+	return secrets
 }
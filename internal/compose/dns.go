@@ -0,0 +1,130 @@
+package compose
+
+import (
+	"bufio"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/madhav/servctl/internal/ops"
+	"github.com/madhav/servctl/templates"
+)
+
+// DefaultLocalDomain is the special-use domain reserved for home networks (RFC 8375)
+const DefaultLocalDomain = "home.arpa"
+
+// DnsmasqConfigPath is where the local DNS configuration is installed
+const DnsmasqConfigPath = "/etc/dnsmasq.d/servctl.conf"
+
+// ClientHostsFile is the hosts-file snippet written next to docker-compose.yml
+const ClientHostsFile = "client-hosts.txt"
+
+// localDomainRegex matches lowercase dotted DNS names
+var localDomainRegex = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?(\.[a-z0-9]([a-z0-9-]*[a-z0-9])?)*$`)
+
+// HostRecord is a friendly LAN name for a service
+type HostRecord struct {
+	Name    string // Fully qualified name (e.g., "photos.home.arpa")
+	Service string // Service the name points at
+	Port    int    // Port the service listens on
+}
+
+// HostRecords returns the friendly names for all enabled services
+func HostRecords(config *ServiceConfig) []HostRecord {
+	domain := config.LocalDomain
+	if domain == "" {
+		domain = DefaultLocalDomain
+	}
+
+	records := []HostRecord{
+		{Name: "server." + domain, Service: "Server", Port: 0},
+		{Name: "photos." + domain, Service: "Immich", Port: config.ImmichPort},
+		{Name: "cloud." + domain, Service: "Nextcloud", Port: config.NextcloudPort},
+		{Name: "monitor." + domain, Service: "Glances", Port: config.GlancesPort},
+	}
+	if config.SSOEnabled {
+		records = append(records, HostRecord{Name: "auth." + domain, Service: "Authentik", Port: config.AuthentikPort})
+	}
+	return records
+}
+
+// URL returns the browser URL for a record
+func (r HostRecord) URL() string {
+	if r.Port == 0 {
+		return ""
+	}
+	return fmt.Sprintf("http://%s:%d", r.Name, r.Port)
+}
+
+// GenerateHostsEntries generates a block to paste into client hosts files
+func GenerateHostsEntries(config *ServiceConfig) string {
+	data := struct {
+		HostIP  string
+		Records []HostRecord
+	}{config.HostIP, HostRecords(config)}
+	return templates.MustRender("services/hosts-entries.tmpl", data, nil)
+}
+
+// GenerateClientHostsFile generates the hosts snippet with install instructions
+func GenerateClientHostsFile(config *ServiceConfig) string {
+	data := struct{ Entries string }{GenerateHostsEntries(config)}
+	return templates.MustRender("services/hosts.tmpl", data, nil)
+}
+
+// GenerateDnsmasqConfig generates a dnsmasq configuration that answers for
+// the local domain on the LAN address only, leaving systemd-resolved alone
+func GenerateDnsmasqConfig(config *ServiceConfig) string {
+	domain := config.LocalDomain
+	if domain == "" {
+		domain = DefaultLocalDomain
+	}
+
+	data := struct {
+		HostIP, Domain string
+		Records        []HostRecord
+	}{config.HostIP, domain, HostRecords(config)}
+	return templates.MustRender("system/dnsmasq.conf.tmpl", data, nil)
+}
+
+// WriteClientHostsFile writes the hosts snippet into the compose directory
+func WriteClientHostsFile(config *ServiceConfig, outputDir string, dryRun bool) error {
+	outputPath := filepath.Join(outputDir, ClientHostsFile)
+	op := ops.WriteFile{Path: outputPath, Content: []byte(GenerateClientHostsFile(config)), Mode: 0644}
+	if err := ops.Execute(dryRun, op); err != nil {
+		return err
+	}
+	if !dryRun {
+		fmt.Printf("Generated: %s\n", outputPath)
+	}
+	return nil
+}
+
+// WriteDnsmasqConfig installs the dnsmasq configuration
+func WriteDnsmasqConfig(config *ServiceConfig, dryRun bool) error {
+	return ops.Execute(dryRun, systemFile(DnsmasqConfigPath, GenerateDnsmasqConfig(config), 0644))
+}
+
+// PromptLocalDNSConfig asks for the local domain and whether to run a DNS server
+func PromptLocalDNSConfig(reader *bufio.Reader, config *ServiceConfig) *ServiceConfig {
+	fmt.Println("Local Names:")
+	fmt.Printf("  Domain [%s]: ", DefaultLocalDomain)
+
+	domain, _ := reader.ReadString('\n')
+	domain = strings.TrimSpace(strings.ToLower(domain))
+	if domain == "" {
+		domain = DefaultLocalDomain
+	}
+	config.LocalDomain = domain
+
+	fmt.Println("  A DNS server on this machine lets phones use the names too")
+	fmt.Println("  (point your router's DNS at the server afterwards).")
+	fmt.Print("  Run local DNS (dnsmasq)? [y/N]: ")
+
+	response, _ := reader.ReadString('\n')
+	response = strings.TrimSpace(strings.ToLower(response))
+	config.LocalDNSEnabled = response == "y" || response == "yes"
+	fmt.Println()
+
+	return config
+}
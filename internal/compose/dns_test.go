@@ -0,0 +1,66 @@
+package compose
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHostRecords(t *testing.T) {
+	config := DefaultConfig()
+	config.HostIP = "192.168.1.100"
+
+	if got := len(HostRecords(config)); got != 4 {
+		t.Errorf("HostRecords() = %d records, want 4", got)
+	}
+
+	config.SSOEnabled = true
+	records := HostRecords(config)
+	if last := records[len(records)-1]; last.Name != "auth.home.arpa" || last.URL() != "http://auth.home.arpa:9000" {
+		t.Errorf("SSO should add auth.home.arpa, got %+v", last)
+	}
+}
+
+func TestGenerateHostsEntries(t *testing.T) {
+	config := DefaultConfig()
+	config.HostIP = "192.168.1.100"
+	config.LocalDomain = "lan"
+
+	entries := GenerateHostsEntries(config)
+	checks := []string{"# BEGIN servctl", "192.168.1.100   photos.lan", "192.168.1.100   cloud.lan", "# END servctl"}
+	for _, check := range checks {
+		if !strings.Contains(entries, check) {
+			t.Errorf("Hosts entries missing %q:\n%s", check, entries)
+		}
+	}
+}
+
+func TestGenerateDnsmasqConfig(t *testing.T) {
+	config := DefaultConfig()
+	config.HostIP = "192.168.1.100"
+
+	content := GenerateDnsmasqConfig(config)
+	checks := []string{"listen-address=192.168.1.100", "bind-interfaces", "local=/home.arpa/", "address=/photos.home.arpa/192.168.1.100"}
+	for _, check := range checks {
+		if !strings.Contains(content, check) {
+			t.Errorf("dnsmasq config missing %q", check)
+		}
+	}
+}
+
+func TestValidate_LocalDomain(t *testing.T) {
+	config := DefaultConfig()
+	config.NextcloudAdminPass = "testpass123"
+	config.AutoFillDefaults()
+
+	config.LocalDomain = "Home_LAN"
+	if errs := config.Validate(); len(errs) == 0 {
+		t.Error("Invalid local domain should fail validation")
+	}
+
+	config.LocalDomain = "home.arpa"
+	config.LocalDNSEnabled = true
+	config.HostIP = ""
+	if errs := config.Validate(); len(errs) == 0 {
+		t.Error("Local DNS without a host IP should fail validation")
+	}
+}
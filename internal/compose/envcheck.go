@@ -0,0 +1,544 @@
+package compose
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	// Timezones are checked against Go's own copy of the tz database, so a
+	// server without the tzdata package still validates TZ
+	_ "time/tzdata"
+)
+
+// envKeyRegex matches a variable name Docker Compose accepts
+var envKeyRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// EnvIssue is a problem found in a hand-edited .env. Warnings are worth a
+// look; anything else stops the file from being applied.
+type EnvIssue struct {
+	Line    int // 0 when the issue is about a missing key
+	Key     string
+	Message string
+	Warning bool
+}
+
+func (i EnvIssue) String() string {
+	where := i.Key
+	if i.Line > 0 {
+		where = fmt.Sprintf("line %d: %s", i.Line, i.Key)
+	}
+	return where + ": " + i.Message
+}
+
+// EnvFile is a parsed .env: values by key and the line each was set on
+type EnvFile struct {
+	Values map[string]string
+	Lines  map[string]int
+}
+
+// ParseEnv reads .env content the way Docker Compose does for the subset
+// servctl writes: KEY=value lines, comments and blank lines, optional
+// quotes around the value
+func ParseEnv(content string) (EnvFile, []EnvIssue) {
+	env := EnvFile{Values: make(map[string]string), Lines: make(map[string]int)}
+	var issues []EnvIssue
+	for i, raw := range strings.Split(content, "\n") {
+		n := i + 1
+		line := strings.TrimSpace(raw)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		key, value, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || !envKeyRegex.MatchString(key) {
+			issues = append(issues, EnvIssue{Line: n, Key: line, Message: "not a KEY=value line"})
+			continue
+		}
+		value = unquoteEnv(value)
+		if first, dup := env.Lines[key]; dup {
+			issues = append(issues, EnvIssue{Line: n, Key: key, Message: fmt.Sprintf("set again (first on line %d); this value wins", first), Warning: true})
+		}
+		env.Values[key] = value
+		env.Lines[key] = n
+	}
+	return env, issues
+}
+
+// unquoteEnv returns a .env value as Docker Compose reads it: single quotes
+// are literal, and inside double quotes a backslash escapes the next
+// character (templates.EnvQuote)
+func unquoteEnv(value string) string {
+	value = strings.TrimSpace(value)
+	if len(value) < 2 || (value[0] != '"' && value[0] != '\'') || value[len(value)-1] != value[0] {
+		return value
+	}
+	quote, value := value[0], value[1:len(value)-1]
+	if quote == '\'' {
+		return value
+	}
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' && i+1 < len(value) {
+			i++
+		}
+		b.WriteByte(value[i])
+	}
+	return b.String()
+}
+
+// envKind is how a .env value is checked
+type envKind int
+
+const (
+	envString envKind = iota
+	envPort
+	envID
+	envIP
+	envTimezone
+	envLocale
+	envPath
+	envPassword
+	envURL
+	envEmail
+	envVersion
+)
+
+// envField describes one key servctl writes to .env
+type envField struct {
+	kind     envKind
+	required bool
+	secret   bool // Masked when shown
+	// when reports whether the key is written for this configuration
+	when func(c *ServiceConfig) bool
+	get  func(c *ServiceConfig) string
+	// set applies a new value; nil when the value is derived and editing it
+	// has no effect
+	set func(c *ServiceConfig, v string)
+	// caution explains what else a change needs
+	caution string
+}
+
+func itoa(n int) string { return strconv.Itoa(n) }
+
+func atoi(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
+
+func always(*ServiceConfig) bool { return true }
+
+// envFields is the schema of the generated .env (templates/env.tmpl)
+var envFields = map[string]envField{
+	EnvSchemaKey: {kind: envVersion, required: true, when: always,
+		get: func(*ServiceConfig) string { return itoa(SchemaVersion) }},
+
+	"TZ": {kind: envTimezone, required: true, when: always,
+		get: func(c *ServiceConfig) string { return c.Timezone },
+		set: func(c *ServiceConfig, v string) { c.Timezone = v }},
+	"LANG": {kind: envLocale, when: always,
+		get:     func(c *ServiceConfig) string { return c.Locale },
+		set:     func(c *ServiceConfig, v string) { c.Locale = v },
+		caution: "Nextcloud's default language and region are set at setup; change them in its admin settings"},
+	"PUID": {kind: envID, required: true, when: always,
+		get:     func(c *ServiceConfig) string { return itoa(c.PUID) },
+		set:     func(c *ServiceConfig, v string) { c.PUID = atoi(v) },
+		caution: "existing files keep their owner; run 'servctl -permissions fix' after applying"},
+	"PGID": {kind: envID, required: true, when: always,
+		get:     func(c *ServiceConfig) string { return itoa(c.PGID) },
+		set:     func(c *ServiceConfig, v string) { c.PGID = atoi(v) },
+		caution: "existing files keep their group; run 'servctl -permissions fix' after applying"},
+	"HOST_IP": {kind: envIP, when: always,
+		get:     func(c *ServiceConfig) string { return c.HostIP },
+		set:     func(c *ServiceConfig, v string) { c.HostIP = v },
+		caution: "Nextcloud's trusted domains, SSO and the firewall also use it; 'servctl -network-refresh' updates them all"},
+
+	"DATA_ROOT": {kind: envPath, required: true, when: always,
+		get:     func(c *ServiceConfig) string { return c.DataRoot },
+		set:     func(c *ServiceConfig, v string) { c.DataRoot = v; c.UploadPath = c.Path("gallery") },
+		caution: "the data is not moved; copy it to the new location before applying"},
+	"UPLOAD_LOCATION": {kind: envPath, when: always,
+		get: func(c *ServiceConfig) string { return c.Path("gallery") }},
+	"INFRA_ROOT": {kind: envPath, when: always,
+		get: func(c *ServiceConfig) string { return c.InfraRoot }},
+
+	"IMMICH_PORT": {kind: envPort, required: true, when: always,
+		get: func(c *ServiceConfig) string { return itoa(c.ImmichPort) },
+		set: func(c *ServiceConfig, v string) { c.ImmichPort = atoi(v) }},
+	"IMMICH_DB_PASSWORD": {kind: envPassword, secret: true, required: true, when: always,
+		get:     func(c *ServiceConfig) string { return c.ImmichDBPassword },
+		set:     func(c *ServiceConfig, v string) { c.ImmichDBPassword = v },
+		caution: "Postgres keeps the password it was created with; change it inside the database too or Immich cannot connect"},
+
+	"NEXTCLOUD_PORT": {kind: envPort, required: true, when: always,
+		get: func(c *ServiceConfig) string { return itoa(c.NextcloudPort) },
+		set: func(c *ServiceConfig, v string) { c.NextcloudPort = atoi(v) }},
+	"NEXTCLOUD_ADMIN_USER": {kind: envString, required: true, when: always,
+		get:     func(c *ServiceConfig) string { return c.NextcloudAdminUser },
+		set:     func(c *ServiceConfig, v string) { c.NextcloudAdminUser = v },
+		caution: "only used when Nextcloud is first installed; existing accounts are not renamed"},
+	"NEXTCLOUD_ADMIN_PASSWORD": {kind: envPassword, secret: true, required: true, when: always,
+		get:     func(c *ServiceConfig) string { return c.NextcloudAdminPass },
+		set:     func(c *ServiceConfig, v string) { c.NextcloudAdminPass = v },
+		caution: "only used when Nextcloud is first installed; change the password in Nextcloud as well"},
+	"NEXTCLOUD_DB_PASSWORD": {kind: envPassword, secret: true, required: true, when: always,
+		get:     func(c *ServiceConfig) string { return c.NextcloudDBPassword },
+		set:     func(c *ServiceConfig, v string) { c.NextcloudDBPassword = v },
+		caution: "MariaDB keeps the password it was created with; change it inside the database too or Nextcloud cannot connect"},
+
+	"GLANCES_PORT": {kind: envPort, required: true, when: always,
+		get: func(c *ServiceConfig) string { return itoa(c.GlancesPort) },
+		set: func(c *ServiceConfig, v string) { c.GlancesPort = atoi(v) }},
+
+	"DISCORD_WEBHOOK_URL": {kind: envURL, secret: true, when: func(c *ServiceConfig) bool { return c.DiscordWebhookURL != "" },
+		get: func(c *ServiceConfig) string { return c.DiscordWebhookURL },
+		set: func(c *ServiceConfig, v string) { c.DiscordWebhookURL = v }},
+	"TELEGRAM_BOT_TOKEN": {kind: envString, secret: true, when: func(c *ServiceConfig) bool { return c.TelegramBotToken != "" },
+		get: func(c *ServiceConfig) string { return c.TelegramBotToken },
+		set: func(c *ServiceConfig, v string) { c.TelegramBotToken = v }},
+	"TELEGRAM_CHAT_ID": {kind: envString, when: func(c *ServiceConfig) bool { return c.TelegramBotToken != "" },
+		get: func(c *ServiceConfig) string { return c.TelegramChatID },
+		set: func(c *ServiceConfig, v string) { c.TelegramChatID = v }},
+
+	"AUTHENTIK_PORT": {kind: envPort, when: ssoEnabled,
+		get: func(c *ServiceConfig) string { return itoa(c.AuthentikPort) },
+		set: func(c *ServiceConfig, v string) { c.AuthentikPort = atoi(v) }},
+	"AUTHENTIK_SECRET_KEY": {kind: envPassword, secret: true, when: ssoEnabled,
+		get:     func(c *ServiceConfig) string { return c.AuthentikSecretKey },
+		set:     func(c *ServiceConfig, v string) { c.AuthentikSecretKey = v },
+		caution: "signs every Authentik session; everyone is logged out"},
+	"AUTHENTIK_DB_PASSWORD": {kind: envPassword, secret: true, when: ssoEnabled,
+		get:     func(c *ServiceConfig) string { return c.AuthentikDBPassword },
+		set:     func(c *ServiceConfig, v string) { c.AuthentikDBPassword = v },
+		caution: "Postgres keeps the password it was created with; change it inside the database too or Authentik cannot connect"},
+	"AUTHENTIK_ADMIN_PASSWORD": {kind: envPassword, secret: true, when: ssoEnabled,
+		get:     func(c *ServiceConfig) string { return c.AuthentikAdminPass },
+		set:     func(c *ServiceConfig, v string) { c.AuthentikAdminPass = v },
+		caution: "only used when Authentik is first installed; change the password in Authentik as well"},
+	"NEXTCLOUD_OIDC_SECRET": {kind: envString, secret: true, when: ssoEnabled,
+		get:     func(c *ServiceConfig) string { return c.NextcloudOIDCSecret },
+		set:     func(c *ServiceConfig, v string) { c.NextcloudOIDCSecret = v },
+		caution: "Nextcloud's OIDC settings must be updated too; run 'servctl -network-refresh'"},
+	"IMMICH_OIDC_SECRET": {kind: envString, secret: true, when: ssoEnabled,
+		get:     func(c *ServiceConfig) string { return c.ImmichOIDCSecret },
+		set:     func(c *ServiceConfig, v string) { c.ImmichOIDCSecret = v },
+		caution: "Immich's OAuth settings must be updated too; run 'servctl -network-refresh'"},
+
+	"CLOUDFLARE_TUNNEL_TOKEN": {kind: envString, secret: true, when: tunnelEnabled,
+		get: func(c *ServiceConfig) string { return c.TunnelToken },
+		set: func(c *ServiceConfig, v string) { c.TunnelToken = v }},
+	"TUNNEL_DOMAIN": {kind: envString, when: tunnelEnabled,
+		get:     func(c *ServiceConfig) string { return c.TunnelDomain },
+		set:     func(c *ServiceConfig, v string) { c.TunnelDomain = v },
+		caution: "public hostnames are configured in the Cloudflare dashboard; update them there"},
+
+	"SMTP_HOST": {kind: envString, when: smtpEnabled,
+		get: func(c *ServiceConfig) string { return c.SMTPHost },
+		set: func(c *ServiceConfig, v string) { c.SMTPHost = v }},
+	"SMTP_PORT": {kind: envPort, when: smtpEnabled,
+		get: func(c *ServiceConfig) string { return itoa(c.SMTPPort) },
+		set: func(c *ServiceConfig, v string) { c.SMTPPort = atoi(v) }},
+	"SMTP_USER": {kind: envString, when: smtpEnabled,
+		get: func(c *ServiceConfig) string { return c.SMTPUser },
+		set: func(c *ServiceConfig, v string) { c.SMTPUser = v }},
+	"SMTP_PASSWORD": {kind: envString, secret: true, when: smtpEnabled,
+		get: func(c *ServiceConfig) string { return c.SMTPPassword },
+		set: func(c *ServiceConfig, v string) { c.SMTPPassword = v }},
+	"MAIL_FROM": {kind: envEmail, when: smtpEnabled,
+		get: func(c *ServiceConfig) string { return c.SMTPFrom },
+		set: func(c *ServiceConfig, v string) { c.SMTPFrom = v }},
+	"MAIL_TO": {kind: envEmail, when: smtpEnabled,
+		get: func(c *ServiceConfig) string { return c.SMTPRecipient },
+		set: func(c *ServiceConfig, v string) { c.SMTPRecipient = v }},
+}
+
+func ssoEnabled(c *ServiceConfig) bool    { return c.SSOEnabled }
+func tunnelEnabled(c *ServiceConfig) bool { return c.TunnelEnabled() }
+func smtpEnabled(c *ServiceConfig) bool   { return c.SMTPHost != "" }
+
+// envPortKeys are the published ports, which must not collide
+var envPortKeys = []string{"IMMICH_PORT", "NEXTCLOUD_PORT", "GLANCES_PORT", "AUTHENTIK_PORT"}
+
+// checkEnvValue checks one value against its kind
+func checkEnvValue(kind envKind, value string) (msg string, warning bool) {
+	switch kind {
+	case envPort:
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > 65535 {
+			return fmt.Sprintf("%q is not a port (1-65535)", value), false
+		}
+	case envID:
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return fmt.Sprintf("%q is not a user or group ID", value), false
+		}
+		if n == 0 {
+			return "0 runs the containers' files as root", true
+		}
+	case envIP:
+		if value == "" {
+			return "empty; LAN URLs and the firewall rule need the host IP", true
+		}
+		if err := ValidateIP(value); err != nil {
+			return err.Error(), false
+		}
+	case envTimezone:
+		if value == "" {
+			return "timezone is required", false
+		}
+		if _, err := time.LoadLocation(value); err != nil {
+			return fmt.Sprintf("unknown timezone %q (e.g. Europe/Berlin, see 'timedatectl list-timezones')", value), false
+		}
+	case envLocale:
+		if err := ValidateLocale(value); err != nil {
+			return err.Error(), false
+		}
+	case envPath:
+		if !filepath.IsAbs(value) {
+			return fmt.Sprintf("%q is not an absolute path", value), false
+		}
+	case envPassword:
+		if len(value) < 8 {
+			return "must be at least 8 characters", false
+		}
+	case envURL:
+		if err := ValidateWebhookURL(value); err != nil {
+			return err.Error(), false
+		}
+	case envEmail:
+		if err := ValidateEmail(value); err != nil {
+			return err.Error(), false
+		}
+	case envVersion:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Sprintf("%q is not a schema version", value), false
+		}
+		if n != SchemaVersion {
+			return fmt.Sprintf("schema version %d, this servctl writes %d; run 'servctl -migrate-config'", n, SchemaVersion), false
+		}
+	}
+	if strings.Contains(value, "$") && kind != envVersion {
+		return "contains '$', which Docker Compose treats as a variable; write '$$' for a literal dollar sign", true
+	}
+	return "", false
+}
+
+// CheckEnv validates a parsed .env against what servctl writes for config:
+// value types and ranges, port conflicts, missing and unknown keys
+func CheckEnv(env EnvFile, config *ServiceConfig) []EnvIssue {
+	var issues []EnvIssue
+	for _, key := range sortedKeys(env.Values) {
+		value := env.Values[key]
+		field, known := envFields[key]
+		if !known {
+			msg := "not a key servctl uses; nothing reads it"
+			if guess := closestEnvKey(key); guess != "" {
+				msg = fmt.Sprintf("not a key servctl uses; did you mean %s?", guess)
+			}
+			issues = append(issues, EnvIssue{Line: env.Lines[key], Key: key, Message: msg, Warning: true})
+			continue
+		}
+		if msg, warning := checkEnvValue(field.kind, value); msg != "" {
+			issues = append(issues, EnvIssue{Line: env.Lines[key], Key: key, Message: msg, Warning: warning})
+		}
+		if field.set == nil && key != EnvSchemaKey && value != field.get(config) {
+			issues = append(issues, EnvIssue{Line: env.Lines[key], Key: key,
+				Message: fmt.Sprintf("derived from the configuration (%s); the edit will be overwritten", field.get(config)), Warning: true})
+		}
+	}
+
+	for _, key := range sortedKeys(envFields) {
+		field := envFields[key]
+		if _, ok := env.Values[key]; !ok && field.required && field.when(config) {
+			issues = append(issues, EnvIssue{Key: key, Message: "missing"})
+		}
+	}
+
+	used := make(map[string]string)
+	for _, key := range envPortKeys {
+		value, ok := env.Values[key]
+		if !ok || !envFields[key].when(config) {
+			continue
+		}
+		if other, taken := used[value]; taken {
+			issues = append(issues, EnvIssue{Line: env.Lines[key], Key: key, Message: fmt.Sprintf("port %s is already used by %s", value, other)})
+			continue
+		}
+		used[value] = key
+		if n := atoi(value); n > 0 && n < 1024 && config.Rootless {
+			issues = append(issues, EnvIssue{Line: env.Lines[key], Key: key, Message: fmt.Sprintf("port %d is privileged; rootless Docker cannot publish it", n)})
+		}
+	}
+	return issues
+}
+
+// HasEnvErrors reports whether any issue is more than a warning
+func HasEnvErrors(issues []EnvIssue) bool {
+	for _, i := range issues {
+		if !i.Warning {
+			return true
+		}
+	}
+	return false
+}
+
+// closestEnvKey suggests the known key an unknown one is a typo of
+func closestEnvKey(key string) string {
+	best, bestDist := "", 4
+	for known := range envFields {
+		if d := editDistance(strings.ToUpper(key), known); d < bestDist || (d == bestDist && known < best) {
+			best, bestDist = known, d
+		}
+	}
+	if bestDist > len(key)/3 {
+		return ""
+	}
+	return best
+}
+
+// editDistance is the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+// EnvChange is a value in .env that differs from the saved configuration
+type EnvChange struct {
+	Key      string
+	Old, New string
+	Secret   bool
+	// Services are the containers 'docker compose up -d' recreates for it
+	Services []string
+	Caution  string
+}
+
+// DiffEnv compares a hand-edited .env with the saved configuration. It
+// returns the changes and the configuration with them applied. The
+// generated compose file embeds values other than secrets rather than
+// reading .env, so a change only reaches a container once the compose file
+// is regenerated; the containers listed are those whose definition the
+// change alters, with secrets counted as part of the definition.
+func DiffEnv(config *ServiceConfig, env EnvFile) ([]EnvChange, *ServiceConfig, error) {
+	applied := *config
+	before, err := renderCompose(config, config.secretValue)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var changes []EnvChange
+	for _, key := range sortedKeys(env.Values) {
+		field, known := envFields[key]
+		value := env.Values[key]
+		if !known || field.set == nil || value == field.get(&applied) {
+			continue
+		}
+
+		single := *config
+		field.set(&single, value)
+		after, err := renderCompose(&single, single.secretValue)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", key, err)
+		}
+		field.set(&applied, value)
+		changes = append(changes, EnvChange{
+			Key:      key,
+			Old:      field.get(config),
+			New:      value,
+			Secret:   field.secret,
+			Services: changedServices(before, after),
+			Caution:  field.caution,
+		})
+	}
+	return changes, &applied, nil
+}
+
+// RecreatedServices returns every container the changes recreate
+func RecreatedServices(changes []EnvChange) []string {
+	seen := make(map[string]bool)
+	var services []string
+	for _, c := range changes {
+		for _, s := range c.Services {
+			if !seen[s] {
+				seen[s] = true
+				services = append(services, s)
+			}
+		}
+	}
+	sort.Strings(services)
+	return services
+}
+
+// serviceBlocks splits a generated compose file into each service's lines
+func serviceBlocks(content string) map[string]string {
+	blocks := make(map[string]string)
+	inServices := false
+	current := ""
+	for _, line := range strings.Split(content, "\n") {
+		switch {
+		case line == "services:":
+			inServices = true
+			continue
+		case line != "" && !strings.HasPrefix(line, " ") && !strings.HasPrefix(line, "#"):
+			inServices = false
+			current = ""
+		}
+		if !inServices {
+			continue
+		}
+		if strings.HasPrefix(line, "  ") && !strings.HasPrefix(line, "   ") && strings.HasSuffix(line, ":") && !strings.HasPrefix(strings.TrimSpace(line), "#") {
+			current = strings.TrimSuffix(strings.TrimSpace(line), ":")
+		}
+		if current != "" {
+			blocks[current] += line + "\n"
+		}
+	}
+	return blocks
+}
+
+// changedServices returns the services whose definition differs between
+// two generated compose files, including ones added or removed
+func changedServices(before, after string) []string {
+	a, b := serviceBlocks(before), serviceBlocks(after)
+	var changed []string
+	for name, block := range b {
+		if a[name] != block {
+			changed = append(changed, name)
+		}
+	}
+	for name := range a {
+		if _, ok := b[name]; !ok {
+			changed = append(changed, name)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// sortedKeys returns a map's keys in order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
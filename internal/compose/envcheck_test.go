@@ -0,0 +1,192 @@
+package compose
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/madhav/servctl/templates"
+)
+
+func envTestConfig() *ServiceConfig {
+	return goldenConfigs()["minimal"]
+}
+
+// generatedEnv parses the .env servctl would write for config
+func generatedEnv(t *testing.T, config *ServiceConfig) EnvFile {
+	t.Helper()
+	content, err := GenerateEnvFile(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env, issues := ParseEnv(content)
+	if len(issues) > 0 {
+		t.Fatalf("Generated .env should parse cleanly: %v", issues)
+	}
+	return env
+}
+
+func TestCheckEnv_GeneratedFileIsClean(t *testing.T) {
+	for name, config := range goldenConfigs() {
+		env := generatedEnv(t, config)
+		if issues := CheckEnv(env, config); len(issues) > 0 {
+			t.Errorf("%s: generated .env should have no issues, got %v", name, issues)
+		}
+		changes, _, err := DiffEnv(config, env)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(changes) > 0 {
+			t.Errorf("%s: generated .env should match the state, got %+v", name, changes)
+		}
+	}
+}
+
+func TestParseEnv(t *testing.T) {
+	env, issues := ParseEnv("# comment\n\nTZ=\"Europe/Berlin\"\nexport PUID=1001\nnot a line\nTZ=UTC\n")
+	if env.Values["TZ"] != "UTC" || env.Lines["TZ"] != 6 {
+		t.Errorf("Last TZ should win: %q on line %d", env.Values["TZ"], env.Lines["TZ"])
+	}
+	if env.Values["PUID"] != "1001" {
+		t.Errorf("export prefix should be accepted, got %q", env.Values["PUID"])
+	}
+	if len(issues) != 2 || issues[0].Line != 5 || issues[0].Warning || issues[1].Line != 6 || !issues[1].Warning {
+		t.Errorf("Expected a malformed line error and a duplicate warning, got %+v", issues)
+	}
+}
+
+func TestGenerateEnvFile_SymbolPasswordsRoundTrip(t *testing.T) {
+	config := envTestConfig()
+	config.NextcloudAdminPass = `Tr0ub4dor&$HOME #x`
+	config.ImmichAdminPass = `q"u'o\te` + "`date`"
+	config.SMTPHost, config.SMTPPassword = "smtp.example.com", `${PATH}\`
+
+	env := generatedEnv(t, config)
+	for key, want := range map[string]string{
+		"NEXTCLOUD_ADMIN_PASSWORD": config.NextcloudAdminPass,
+		"SMTP_PASSWORD":            config.SMTPPassword,
+	} {
+		if env.Values[key] != want {
+			t.Errorf("%s = %q after the round trip, want %q", key, env.Values[key], want)
+		}
+	}
+	if got := unquoteEnv(templates.EnvQuote(config.ImmichAdminPass)); got != config.ImmichAdminPass {
+		t.Errorf("unquoteEnv(EnvQuote(%q)) = %q", config.ImmichAdminPass, got)
+	}
+}
+
+func TestCheckEnv_Values(t *testing.T) {
+	config := envTestConfig()
+	tests := []struct {
+		key, value string
+		want       string
+		warning    bool
+	}{
+		{"IMMICH_PORT", "70000", "not a port", false},
+		{"NEXTCLOUD_PORT", "2283", "already used by IMMICH_PORT", false},
+		{"TZ", "Mars/Olympus", "unknown timezone", false},
+		{"LANG", "german", "invalid locale", false},
+		{"HOST_IP", "8.8.8.8", "private range", false},
+		{"PUID", "-1", "not a user or group ID", false},
+		{"PUID", "0", "root", true},
+		{"DATA_ROOT", "data", "absolute path", false},
+		{"IMMICH_DB_PASSWORD", "short", "at least 8", false},
+		{"NEXTCLOUD_ADMIN_PASSWORD", "pa$sword123", "'$$'", true},
+		{EnvSchemaKey, "0", "-migrate-config", false},
+		{"IMMICH_PROT", "2283", "did you mean IMMICH_PORT?", true},
+		{"UPLOAD_LOCATION", "/srv/photos", "will be overwritten", true},
+	}
+	for _, tt := range tests {
+		env := generatedEnv(t, config)
+		env.Values[tt.key] = tt.value
+		var found *EnvIssue
+		for _, issue := range CheckEnv(env, config) {
+			if issue.Key == tt.key && strings.Contains(issue.Message, tt.want) {
+				found = &issue
+			}
+		}
+		if found == nil {
+			t.Errorf("%s=%s: expected an issue containing %q", tt.key, tt.value, tt.want)
+			continue
+		}
+		if found.Warning != tt.warning {
+			t.Errorf("%s=%s: warning = %v, want %v", tt.key, tt.value, found.Warning, tt.warning)
+		}
+	}
+}
+
+func TestCheckEnv_MissingKey(t *testing.T) {
+	config := envTestConfig()
+	env := generatedEnv(t, config)
+	delete(env.Values, "TZ")
+	issues := CheckEnv(env, config)
+	if len(issues) != 1 || issues[0].Key != "TZ" || issues[0].Warning || !HasEnvErrors(issues) {
+		t.Errorf("Expected TZ to be reported missing, got %+v", issues)
+	}
+
+	// Keys for features that are off are not required
+	delete(env.Values, "AUTHENTIK_PORT")
+	if issues := CheckEnv(env, config); len(issues) != 1 {
+		t.Errorf("AUTHENTIK_PORT is optional without SSO, got %+v", issues)
+	}
+}
+
+func TestDiffEnv_RecreatedServices(t *testing.T) {
+	config := envTestConfig()
+	env := generatedEnv(t, config)
+	env.Values["IMMICH_PORT"] = "2300"
+	env.Values["TZ"] = "Europe/Berlin"
+	env.Values["NEXTCLOUD_DB_PASSWORD"] = "a-new-db-password"
+
+	changes, applied, err := DiffEnv(config, env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 3 {
+		t.Fatalf("Expected 3 changes, got %+v", changes)
+	}
+	byKey := make(map[string]EnvChange)
+	for _, c := range changes {
+		byKey[c.Key] = c
+	}
+
+	if got := byKey["IMMICH_PORT"].Services; !reflect.DeepEqual(got, []string{"immich-server"}) {
+		t.Errorf("A port change should recreate only immich-server, got %v", got)
+	}
+	db := byKey["NEXTCLOUD_DB_PASSWORD"]
+	if !reflect.DeepEqual(db.Services, []string{"nextcloud", "nextcloud-mariadb"}) {
+		t.Errorf("The Nextcloud DB password should recreate nextcloud and its database, got %v", db.Services)
+	}
+	if !db.Secret || db.Caution == "" {
+		t.Errorf("A DB password change should be secret and carry a caution: %+v", db)
+	}
+	if len(byKey["TZ"].Services) < 3 {
+		t.Errorf("TZ should reach most containers, got %v", byKey["TZ"].Services)
+	}
+
+	if applied.ImmichPort != 2300 || applied.Timezone != "Europe/Berlin" || applied.NextcloudDBPassword != "a-new-db-password" {
+		t.Errorf("Changes should be applied to the returned config: %+v", applied)
+	}
+	if config.ImmichPort != 2283 {
+		t.Error("DiffEnv must not modify the saved config")
+	}
+
+	all := RecreatedServices(changes)
+	for _, s := range []string{"immich-server", "nextcloud", "nextcloud-mariadb"} {
+		found := false
+		for _, got := range all {
+			found = found || got == s
+		}
+		if !found {
+			t.Errorf("RecreatedServices should include %s: %v", s, all)
+		}
+	}
+}
+
+func TestServiceBlocks(t *testing.T) {
+	content := "services:\n  a:\n    image: x\n\n  b:\n    image: y\n\nvolumes:\n  data:\n"
+	blocks := serviceBlocks(content)
+	if len(blocks) != 2 || !strings.Contains(blocks["a"], "image: x") || strings.Contains(blocks["b"], "data") {
+		t.Errorf("Unexpected blocks: %q", blocks)
+	}
+}
@@ -2,8 +2,11 @@ package compose
 
 import (
 	"fmt"
+	"net"
 	"os/exec"
 	"strings"
+
+	"github.com/madhav/servctl/internal/ops"
 )
 
 // FirewallRule represents a UFW firewall rule
@@ -16,7 +19,13 @@ type FirewallRule struct {
 }
 
 // GetDefaultFirewallRules returns the firewall rules for servctl services
+// on their default ports
 func GetDefaultFirewallRules() []FirewallRule {
+	return FirewallRules(DefaultConfig())
+}
+
+// FirewallRules returns the firewall rules for the ports config publishes
+func FirewallRules(config *ServiceConfig) []FirewallRule {
 	return []FirewallRule{
 		{
 			Port:        22,
@@ -26,21 +35,21 @@ func GetDefaultFirewallRules() []FirewallRule {
 			Required:    true,
 		},
 		{
-			Port:        2283,
+			Port:        config.ImmichPort,
 			Protocol:    "tcp",
 			Service:     "Immich",
 			Description: "Photo & video management web UI",
 			Required:    true,
 		},
 		{
-			Port:        8080,
+			Port:        config.NextcloudPort,
 			Protocol:    "tcp",
 			Service:     "Nextcloud",
 			Description: "File sync & share web UI",
 			Required:    true,
 		},
 		{
-			Port:        61208,
+			Port:        config.GlancesPort,
 			Protocol:    "tcp",
 			Service:     "Glances",
 			Description: "System monitoring (consider limiting to local network)",
@@ -68,54 +77,33 @@ func IsUFWEnabled() (bool, error) {
 // AllowPort adds a UFW allow rule for a port
 func AllowPort(port int, protocol string, dryRun bool) error {
 	rule := fmt.Sprintf("%d/%s", port, protocol)
-
-	if dryRun {
-		fmt.Printf("[DRY RUN] Would execute: ufw allow %s\n", rule)
-		return nil
-	}
-
-	cmd := exec.Command("ufw", "allow", rule)
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("failed to allow port %d: %s: %w", port, string(output), err)
+	if err := ops.Execute(dryRun, ops.Command{Args: []string{"ufw", "allow", rule}}); err != nil {
+		return fmt.Errorf("failed to allow port %d: %w", port, err)
 	}
-
 	return nil
 }
 
 // AllowSSH ensures SSH access is allowed (CRITICAL: must be done first!)
 func AllowSSH(dryRun bool) error {
-	if dryRun {
-		fmt.Println("[DRY RUN] Would execute: ufw allow ssh")
-		return nil
-	}
-
-	// Try both 'ssh' and explicit port 22
-	cmd := exec.Command("ufw", "allow", "ssh")
-	if _, err := cmd.CombinedOutput(); err != nil {
-		// Fallback to explicit port
-		cmd = exec.Command("ufw", "allow", "22/tcp")
-		if output, err := cmd.CombinedOutput(); err != nil {
-			return fmt.Errorf("failed to allow SSH: %s: %w", string(output), err)
+	return ops.Execute(dryRun, ops.Func{Description: "run: ufw allow ssh (else ufw allow 22/tcp)", Fn: func() error {
+		// Try both 'ssh' and explicit port 22
+		cmd := exec.Command("ufw", "allow", "ssh")
+		if _, err := cmd.CombinedOutput(); err != nil {
+			// Fallback to explicit port
+			cmd = exec.Command("ufw", "allow", "22/tcp")
+			if output, err := cmd.CombinedOutput(); err != nil {
+				return fmt.Errorf("failed to allow SSH: %s: %w", string(output), err)
+			}
 		}
-	}
-
-	return nil
+		return nil
+	}})
 }
 
 // EnableUFW enables the firewall (DANGER: ensure SSH is allowed first!)
 func EnableUFW(dryRun bool) error {
-	if dryRun {
-		fmt.Println("[DRY RUN] Would execute: ufw --force enable")
-		return nil
+	if err := ops.Execute(dryRun, ops.Command{Args: []string{"ufw", "--force", "enable"}}); err != nil {
+		return fmt.Errorf("failed to enable UFW: %w", err)
 	}
-
-	cmd := exec.Command("ufw", "--force", "enable")
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("failed to enable UFW: %s: %w", string(output), err)
-	}
-
 	return nil
 }
 
@@ -224,3 +212,81 @@ func (r *ConfigureFirewallResult) HasCriticalErrors() bool {
 	}
 	return false
 }
+
+// LANSubnet returns the CIDR of the local network the host IP belongs to,
+// falling back to a /24 when the interface cannot be found
+func LANSubnet(ip string) string {
+	return SubnetWithPrefix(ip, interfacePrefixLength(ip))
+}
+
+// SubnetWithPrefix returns the network address of ip with the given prefix length
+func SubnetWithPrefix(ip string, ones int) string {
+	parsed := net.ParseIP(ip).To4()
+	if parsed == nil {
+		return ""
+	}
+	mask := net.CIDRMask(ones, 32)
+	return fmt.Sprintf("%s/%d", parsed.Mask(mask), ones)
+}
+
+// interfacePrefixLength finds the prefix length configured for ip
+func interfacePrefixLength(ip string) int {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return 24
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.String() == ip {
+			ones, _ := ipNet.Mask.Size()
+			return ones
+		}
+	}
+	return 24
+}
+
+// rulesFromSubnet returns the `ufw show added` rules that are restricted
+// to subnet, without the leading "ufw"
+func rulesFromSubnet(showAdded, subnet string) []string {
+	var rules []string
+	for _, line := range strings.Split(showAdded, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "ufw ") && strings.Contains(line, " from "+subnet+" ") {
+			rules = append(rules, strings.TrimPrefix(line, "ufw "))
+		}
+	}
+	return rules
+}
+
+// MoveFirewallSubnet rewrites UFW rules restricted to oldSubnet so they
+// apply to newSubnet instead. Returns the number of rules rewritten.
+func MoveFirewallSubnet(oldSubnet, newSubnet string, dryRun bool) (int, error) {
+	output, err := exec.Command("ufw", "show", "added").Output()
+	if err != nil {
+		return 0, fmt.Errorf("failed to list UFW rules: %w", err)
+	}
+
+	rules := rulesFromSubnet(string(output), oldSubnet)
+	var steps []ops.Operation
+	for _, rule := range rules {
+		newRule := strings.Replace(rule, " from "+oldSubnet+" ", " from "+newSubnet+" ", 1)
+		// Add the new rule before deleting the old one so access is never lost
+		steps = append(steps,
+			ops.Command{Args: append([]string{"ufw"}, strings.Fields(newRule)...)},
+			ops.Command{Args: append([]string{"ufw", "delete"}, strings.Fields(rule)...)})
+	}
+	if err := ops.Execute(dryRun, steps...); err != nil {
+		return 0, fmt.Errorf("failed to move the UFW rules: %w", err)
+	}
+
+	return len(rules), nil
+}
+
+// PrefixLength returns the prefix length of a CIDR string, or 24 if it is invalid
+func PrefixLength(cidr string) int {
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return 24
+	}
+	ones, _ := ipNet.Mask.Size()
+	return ones
+}
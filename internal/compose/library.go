@@ -0,0 +1,119 @@
+package compose
+
+import (
+	"bufio"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// StorageTemplatePreset is a folder layout for Immich's storage template,
+// which decides where originals are filed under gallery/library/<user>/
+type StorageTemplatePreset struct {
+	Name     string
+	Template string // Immich template syntax; empty leaves the template off
+	Example  string
+}
+
+// StorageTemplatePresets lists the layouts offered by the wizard
+var StorageTemplatePresets = []StorageTemplatePreset{
+	{Name: "year/month", Template: "{{y}}/{{MM}}/{{filename}}", Example: "2024/05/IMG_0001.jpg"},
+	{Name: "year/date", Template: "{{y}}/{{y}}-{{MM}}-{{dd}}/{{filename}}", Example: "2024/2024-05-17/IMG_0001.jpg"},
+	{Name: "year/album", Template: "{{y}}/{{#if album}}{{album}}{{else}}Other{{/if}}/{{filename}}", Example: "2024/Holiday/IMG_0001.jpg"},
+	{Name: "off", Example: "Immich's default: random folders per upload, unreadable outside Immich"},
+}
+
+// DefaultStorageTemplate is the layout new setups start with, so files on
+// disk are browsable and backups are readable without Immich
+var DefaultStorageTemplate = StorageTemplatePresets[0].Template
+
+// storageTemplateTag matches one {{...}} tag of a storage template
+var storageTemplateTag = regexp.MustCompile(`{{\s*([^}]*?)\s*}}`)
+
+// storageTemplateVariables are the variables Immich's storage template knows
+var storageTemplateVariables = map[string]bool{
+	"y": true, "yy": true, "M": true, "MM": true, "MMM": true, "MMMM": true,
+	"d": true, "dd": true, "h": true, "hh": true, "H": true, "HH": true,
+	"m": true, "mm": true, "s": true, "ss": true, "SSS": true,
+	"filename": true, "ext": true, "filetype": true, "filetypefull": true,
+	"assetId": true, "assetIdShort": true, "album": true,
+	"else": true, "/if": true,
+}
+
+// ValidateStorageTemplate checks a storage template the way Immich will
+// before it accepts it: known variables only, relative, and ending in the
+// file name so two photos never map to the same path
+func ValidateStorageTemplate(template string) error {
+	if template == "" {
+		return nil
+	}
+	if strings.HasPrefix(template, "/") || strings.Contains(template, "..") {
+		return fmt.Errorf("storage template must be a relative path without '..'")
+	}
+	if !strings.HasSuffix(template, "{{filename}}") && !strings.HasSuffix(template, "{{assetId}}") {
+		return fmt.Errorf("storage template must end with {{filename}}")
+	}
+	for _, m := range storageTemplateTag.FindAllStringSubmatch(template, -1) {
+		tag := m[1]
+		if strings.HasPrefix(tag, "#if ") || strings.HasPrefix(tag, "album-startDate-") || strings.HasPrefix(tag, "album-endDate-") {
+			continue
+		}
+		if !storageTemplateVariables[tag] {
+			return fmt.Errorf("unknown storage template variable {{%s}}", tag)
+		}
+	}
+	return nil
+}
+
+// NeedsImmichAdmin reports whether bootstrap configures Immich through its
+// API, which creates the Immich admin account
+func (c *ServiceConfig) NeedsImmichAdmin() bool {
+	return len(c.Users) > 0 || c.SSOEnabled || c.MLEnabled() || c.ImmichExternalURL != "" || c.ImmichStorageTemplate != ""
+}
+
+// PromptStorageTemplate asks how Immich should lay out originals on disk.
+// Changing it later means moving every file, so it is asked up front.
+func PromptStorageTemplate(reader *bufio.Reader, config *ServiceConfig) *ServiceConfig {
+	fmt.Println("Immich Folder Layout (originals in gallery/library/<user>/):")
+	current := -1
+	for i, p := range StorageTemplatePresets {
+		marker := " "
+		if p.Template == config.ImmichStorageTemplate {
+			marker = "*"
+			current = i
+		}
+		fmt.Printf("  %s %d) %-11s %s\n", marker, i+1, p.Name, p.Example)
+	}
+	fmt.Printf("    %d) custom      your own template, e.g. {{y}}/{{MMMM}}/{{filename}}\n", len(StorageTemplatePresets)+1)
+	if current < 0 {
+		fmt.Printf("  Current: %s\n", config.ImmichStorageTemplate)
+		fmt.Print("  Choose [keep current]: ")
+	} else {
+		fmt.Printf("  Choose [%d]: ", current+1)
+	}
+
+	response, _ := reader.ReadString('\n')
+	n, err := strconv.Atoi(strings.TrimSpace(response))
+	switch {
+	case err != nil || n < 1 || n > len(StorageTemplatePresets)+1:
+		// Keep the current layout
+	case n <= len(StorageTemplatePresets):
+		config.ImmichStorageTemplate = StorageTemplatePresets[n-1].Template
+	default:
+		fmt.Print("  Template: ")
+		custom, _ := reader.ReadString('\n')
+		custom = strings.TrimSpace(custom)
+		if custom == "" {
+			break
+		}
+		if err := ValidateStorageTemplate(custom); err != nil {
+			fmt.Printf("  ✗ %v - keeping the current layout\n", err)
+			break
+		}
+		config.ImmichStorageTemplate = custom
+	}
+	fmt.Println()
+
+	return config
+}
@@ -0,0 +1,61 @@
+package compose
+
+import (
+	"bufio"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestValidateStorageTemplate(t *testing.T) {
+	tests := []struct {
+		template string
+		wantErr  bool
+	}{
+		{"", false},
+		{DefaultStorageTemplate, false},
+		{"{{y}}/{{#if album}}{{album}}{{else}}Other{{/if}}/{{filename}}", false},
+		{"{{y}}/{{album-startDate-yyyy-MM}}/{{filename}}", false},
+		{"{{y}}/{{MM}}", true},
+		{"/photos/{{filename}}", true},
+		{"{{y}}/../{{filename}}", true},
+		{"{{year}}/{{filename}}", true},
+	}
+	for _, tt := range tests {
+		if err := ValidateStorageTemplate(tt.template); (err != nil) != tt.wantErr {
+			t.Errorf("ValidateStorageTemplate(%q) error = %v, wantErr %v", tt.template, err, tt.wantErr)
+		}
+	}
+	for _, p := range StorageTemplatePresets {
+		if err := ValidateStorageTemplate(p.Template); err != nil {
+			t.Errorf("preset %s: %v", p.Name, err)
+		}
+	}
+}
+
+func TestPromptStorageTemplate(t *testing.T) {
+	prompt := func(input string, config *ServiceConfig) *ServiceConfig {
+		return PromptStorageTemplate(bufio.NewReader(strings.NewReader(input)), config)
+	}
+
+	config := prompt("\n", DefaultConfig())
+	if config.ImmichStorageTemplate != DefaultStorageTemplate {
+		t.Errorf("Enter should keep the default, got %q", config.ImmichStorageTemplate)
+	}
+
+	config = prompt("2\n", config)
+	if config.ImmichStorageTemplate != StorageTemplatePresets[1].Template {
+		t.Errorf("choice 2 = %q", config.ImmichStorageTemplate)
+	}
+
+	custom := len(StorageTemplatePresets) + 1
+	config = prompt(strconv.Itoa(custom)+"\n{{y}}/{{MMMM}}/{{filename}}\n", config)
+	if config.ImmichStorageTemplate != "{{y}}/{{MMMM}}/{{filename}}" {
+		t.Errorf("custom template = %q", config.ImmichStorageTemplate)
+	}
+
+	config = prompt(strconv.Itoa(custom)+"\n{{y}}/{{MM}}\n", config)
+	if config.ImmichStorageTemplate != "{{y}}/{{MMMM}}/{{filename}}" {
+		t.Errorf("an invalid custom template should keep the current one, got %q", config.ImmichStorageTemplate)
+	}
+}
@@ -0,0 +1,163 @@
+package compose
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// DefaultLocale is used when the host has no usable locale set
+const DefaultLocale = "en_US.UTF-8"
+
+// localeRegex matches POSIX locale names: language, optional region,
+// optional charset and modifier (e.g. de_DE.UTF-8, pt_BR, sr_RS@latin)
+var localeRegex = regexp.MustCompile(`^([a-z]{2,3})(?:_([A-Z]{2}))?(?:\.[A-Za-z0-9-]+)?(?:@[a-z]+)?$`)
+
+// nextcloudRegional are the languages Nextcloud ships per region; others
+// use the bare language code
+var nextcloudRegional = map[string]bool{
+	"en_GB": true, "es_AR": true, "es_MX": true, "pt_BR": true, "pt_PT": true,
+	"zh_CN": true, "zh_HK": true, "zh_TW": true,
+}
+
+// ValidateLocale checks a POSIX locale name like de_DE.UTF-8
+func ValidateLocale(locale string) error {
+	if !localeRegex.MatchString(locale) {
+		return fmt.Errorf("invalid locale %q (use language_REGION.UTF-8, e.g. de_DE.UTF-8)", locale)
+	}
+	return nil
+}
+
+// detectLocale reads the host's locale from the environment or the
+// system-wide setting. C and POSIX say nothing about the household, so
+// they give DefaultLocale.
+func detectLocale() string {
+	candidates := []string{os.Getenv("LC_ALL"), os.Getenv("LANG")}
+	for _, path := range []string{"/etc/default/locale", "/etc/locale.conf"} {
+		if data, err := os.ReadFile(path); err == nil {
+			for _, line := range strings.Split(string(data), "\n") {
+				if value, ok := strings.CutPrefix(strings.TrimSpace(line), "LANG="); ok {
+					candidates = append(candidates, strings.Trim(value, `"'`))
+				}
+			}
+		}
+	}
+	for _, c := range candidates {
+		if ValidateLocale(c) == nil {
+			return c
+		}
+	}
+	return DefaultLocale
+}
+
+// localeParts splits a locale into its language and region (empty when
+// the locale names none)
+func localeParts(locale string) (language, region string) {
+	m := localeRegex.FindStringSubmatch(locale)
+	if m == nil {
+		return "", ""
+	}
+	return m[1], m[2]
+}
+
+// GenerateNextcloudLocaleCommands returns the occ arguments that make
+// Nextcloud's default language, date and number format and phone number
+// region follow the household's locale. Each user can still pick their own.
+func GenerateNextcloudLocaleCommands(config *ServiceConfig) [][]string {
+	language, region := localeParts(config.Locale)
+	if language == "" {
+		return nil
+	}
+
+	ncLanguage, ncLocale := language, language
+	if region != "" {
+		ncLocale = language + "_" + region
+		if nextcloudRegional[ncLocale] {
+			ncLanguage = ncLocale
+		}
+	}
+	commands := [][]string{
+		{"config:system:set", "default_language", "--value=" + ncLanguage},
+		{"config:system:set", "default_locale", "--value=" + ncLocale},
+	}
+	if region != "" {
+		commands = append(commands, []string{"config:system:set", "default_phone_region", "--value=" + region})
+	}
+	return commands
+}
+
+// Regions by how they write dates; the US writes month first and the rest
+// (and locales without a region) get ISO dates
+var (
+	dayFirstDots  = []string{"AT", "CH", "CZ", "DE", "DK", "FI", "NO", "PL", "RU", "SK", "TR", "UA"}
+	dayFirstSlash = []string{"AU", "BE", "BR", "ES", "FR", "GB", "GR", "IE", "IN", "IT", "NZ", "PT", "ZA"}
+)
+
+// DateLayout returns the time.Format layout for dates and times in
+// reports, following the locale's region
+func (c *ServiceConfig) DateLayout() string {
+	_, region := localeParts(c.Locale)
+	switch {
+	case slices.Contains(dayFirstDots, region):
+		return "02.01.2006 15:04"
+	case slices.Contains(dayFirstSlash, region):
+		return "02/01/2006 15:04"
+	case region == "US":
+		return "01/02/2006 3:04 PM"
+	default:
+		return "2006-01-02 15:04"
+	}
+}
+
+// FormatTime formats t for reports in the locale's date format and the
+// configured timezone
+func (c *ServiceConfig) FormatTime(t time.Time) string {
+	if loc, err := time.LoadLocation(c.Timezone); err == nil {
+		t = t.In(loc)
+	}
+	return t.Format(c.DateLayout())
+}
+
+// PromptLocale asks for the timezone and the language and region the
+// household uses. Enter keeps the detected values.
+func PromptLocale(reader *bufio.Reader, config *ServiceConfig) *ServiceConfig {
+	fmt.Println("Time and Language (press Enter to keep):")
+	fmt.Println()
+
+	for {
+		fmt.Printf("  Timezone [%s]: ", config.Timezone)
+		response, _ := reader.ReadString('\n')
+		response = strings.TrimSpace(response)
+		if response == "" {
+			break
+		}
+		if _, err := time.LoadLocation(response); err != nil {
+			fmt.Printf("  Unknown timezone %q (e.g. Europe/Berlin, see 'timedatectl list-timezones')\n", response)
+			continue
+		}
+		config.Timezone = response
+		break
+	}
+
+	for {
+		fmt.Printf("  Language and region [%s]: ", config.Locale)
+		response, _ := reader.ReadString('\n')
+		response = strings.TrimSpace(response)
+		if response == "" {
+			break
+		}
+		if err := ValidateLocale(response); err != nil {
+			fmt.Printf("  %s\n", err)
+			continue
+		}
+		config.Locale = response
+		break
+	}
+	fmt.Println()
+
+	return config
+}
@@ -0,0 +1,86 @@
+package compose
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateLocale(t *testing.T) {
+	for _, locale := range []string{"de_DE.UTF-8", "en_IN.UTF-8", "pt_BR", "fr", "sr_RS@latin", "en_US.utf8"} {
+		if err := ValidateLocale(locale); err != nil {
+			t.Errorf("ValidateLocale(%q) = %v, want nil", locale, err)
+		}
+	}
+	for _, locale := range []string{"", "C", "german", "de-DE", "DE_de.UTF-8"} {
+		if err := ValidateLocale(locale); err == nil {
+			t.Errorf("ValidateLocale(%q) should fail", locale)
+		}
+	}
+}
+
+func TestGenerateNextcloudLocaleCommands(t *testing.T) {
+	tests := []struct {
+		locale string
+		want   []string
+	}{
+		{"de_DE.UTF-8", []string{"default_language --value=de", "default_locale --value=de_DE", "default_phone_region --value=DE"}},
+		{"pt_BR.UTF-8", []string{"default_language --value=pt_BR", "default_locale --value=pt_BR", "default_phone_region --value=BR"}},
+		{"fr", []string{"default_language --value=fr", "default_locale --value=fr"}},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		config := DefaultConfig()
+		config.Locale = tt.locale
+		var got []string
+		for _, c := range GenerateNextcloudLocaleCommands(config) {
+			if c[0] != "config:system:set" {
+				t.Errorf("unexpected occ command: %v", c)
+			}
+			got = append(got, strings.Join(c[1:], " "))
+		}
+		if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+			t.Errorf("%q: commands = %v, want %v", tt.locale, got, tt.want)
+		}
+	}
+}
+
+func TestFormatTime(t *testing.T) {
+	at := time.Date(2024, 5, 1, 13, 30, 0, 0, time.UTC)
+	tests := map[string]string{
+		"de_DE.UTF-8": "01.05.2024 13:30",
+		"en_GB.UTF-8": "01/05/2024 13:30",
+		"en_US.UTF-8": "05/01/2024 1:30 PM",
+		"sv_SE.UTF-8": "2024-05-01 13:30",
+		"fr":          "2024-05-01 13:30",
+	}
+	for locale, want := range tests {
+		config := &ServiceConfig{Timezone: "UTC", Locale: locale}
+		if got := config.FormatTime(at); got != want {
+			t.Errorf("%s: FormatTime() = %q, want %q", locale, got, want)
+		}
+	}
+
+	config := &ServiceConfig{Timezone: "Asia/Kolkata", Locale: "en_IN.UTF-8"}
+	if got := config.FormatTime(at); got != "01/05/2024 19:00" {
+		t.Errorf("FormatTime() = %q, want the time in the configured timezone", got)
+	}
+}
+
+func TestPromptLocale(t *testing.T) {
+	config := DefaultConfig()
+	config.Timezone = "UTC"
+	config.Locale = DefaultLocale
+
+	input := "Mars/Olympus\nEurope/Berlin\ngerman\nde_DE.UTF-8\n"
+	PromptLocale(bufio.NewReader(strings.NewReader(input)), config)
+	if config.Timezone != "Europe/Berlin" || config.Locale != "de_DE.UTF-8" {
+		t.Errorf("got %s, %s; want invalid answers asked again", config.Timezone, config.Locale)
+	}
+
+	PromptLocale(bufio.NewReader(strings.NewReader("\n\n")), config)
+	if config.Timezone != "Europe/Berlin" || config.Locale != "de_DE.UTF-8" {
+		t.Errorf("Enter should keep the values, got %s, %s", config.Timezone, config.Locale)
+	}
+}
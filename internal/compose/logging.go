@@ -0,0 +1,193 @@
+package compose
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/madhav/servctl/internal/ops"
+	"github.com/madhav/servctl/templates"
+)
+
+// Log shipping targets
+const (
+	LogShippingLoki   = "loki"   // Local Loki instance on the data disk
+	LogShippingSyslog = "syslog" // External syslog server (NAS, router, SIEM)
+)
+
+// LokiPort is where Loki's API (and Grafana's data source) listens
+const LokiPort = 3100
+
+// DefaultLogRetentionDays is how long Loki keeps logs unless set otherwise
+const DefaultLogRetentionDays = 14
+
+// Loki ingestion limits; with the retention period they cap how much of the
+// data disk logs can take, even when a container starts logging in a loop
+const (
+	lokiIngestionRateMB  = 4
+	lokiIngestionBurstMB = 8
+)
+
+// Config files written next to docker-compose.yml and mounted read-only
+const (
+	VectorConfigFile = "logging/vector.yaml"
+	LokiConfigFile   = "logging/loki.yaml"
+)
+
+// LogShippingEnabled reports whether container logs are shipped anywhere
+func (c *ServiceConfig) LogShippingEnabled() bool {
+	return c.LogShipping != ""
+}
+
+// ParseSyslogTarget splits a syslog target ("host", "host:port",
+// "udp://host:port" or "tcp://host:port") into the socket mode and address.
+// UDP and port 514 are the defaults.
+func ParseSyslogTarget(target string) (mode, address string, err error) {
+	mode = "udp"
+	rest := target
+	if scheme, addr, ok := strings.Cut(target, "://"); ok {
+		if scheme != "udp" && scheme != "tcp" {
+			return "", "", fmt.Errorf("syslog target %q: scheme must be udp or tcp", target)
+		}
+		mode, rest = scheme, addr
+	}
+
+	host, port, err := net.SplitHostPort(rest)
+	if err != nil {
+		host, port = rest, "514"
+	}
+	if host == "" || strings.ContainsAny(host, " /") {
+		return "", "", fmt.Errorf("syslog target %q: invalid host", target)
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return "", "", fmt.Errorf("syslog target %q: invalid port", target)
+	}
+	return mode, net.JoinHostPort(host, port), nil
+}
+
+// ValidateLogShipping checks the log shipping settings
+func ValidateLogShipping(c *ServiceConfig) error {
+	switch c.LogShipping {
+	case "":
+		return nil
+	case LogShippingLoki:
+		if c.LogRetentionDays < 1 {
+			return fmt.Errorf("log retention must be at least 1 day")
+		}
+		return nil
+	case LogShippingSyslog:
+		_, _, err := ParseSyslogTarget(c.SyslogTarget)
+		return err
+	}
+	return fmt.Errorf("unknown log shipping target %q (use %s or %s)", c.LogShipping, LogShippingLoki, LogShippingSyslog)
+}
+
+// GenerateVectorConfig renders the Vector pipeline that reads every
+// container's output from the Docker API and ships it to the chosen target
+func GenerateVectorConfig(config *ServiceConfig) string {
+	mode, address, _ := ParseSyslogTarget(config.SyslogTarget)
+	data := struct{ Target, SyslogMode, SyslogAddress string }{config.LogShipping, mode, address}
+	return templates.MustRender("services/vector.yaml.tmpl", data, composeFuncs)
+}
+
+// GenerateLokiConfig renders a single-binary Loki that stores chunks on the
+// data disk and deletes them after the retention period
+func GenerateLokiConfig(config *ServiceConfig) string {
+	days := config.LogRetentionDays
+	if days < 1 {
+		days = DefaultLogRetentionDays
+	}
+
+	data := struct{ RetentionHours int }{days * 24}
+	return templates.MustRender("services/loki.yaml.tmpl", data, composeFuncs)
+}
+
+// WriteLoggingConfig writes the Vector pipeline and, for a local Loki, the
+// Loki config next to docker-compose.yml
+func WriteLoggingConfig(config *ServiceConfig, outputDir string, dryRun bool) error {
+	files := []ops.Operation{ops.WriteFile{
+		Path: filepath.Join(outputDir, VectorConfigFile), Content: []byte(GenerateVectorConfig(config)), Mode: 0644,
+	}}
+	if config.LogShipping == LogShippingLoki {
+		files = append(files, ops.WriteFile{
+			Path: filepath.Join(outputDir, LokiConfigFile), Content: []byte(GenerateLokiConfig(config)), Mode: 0644,
+		})
+	}
+
+	for _, op := range files {
+		if err := ops.Execute(dryRun, op); err != nil {
+			return err
+		}
+		if !dryRun {
+			fmt.Printf("Generated: %s\n", op.(ops.WriteFile).Path)
+		}
+	}
+	return nil
+}
+
+// PromptLogShipping asks where container logs should go, so they survive
+// container recreation and can be searched in one place
+func PromptLogShipping(reader *bufio.Reader, config *ServiceConfig) *ServiceConfig {
+	fmt.Println("Container Logs:")
+	fmt.Println("  Docker keeps logs only as long as a container exists. Ship them to:")
+	fmt.Printf("    1) nowhere (default)\n")
+	fmt.Printf("    2) a local Loki on the data disk (port %d, add it to Grafana)\n", LokiPort)
+	fmt.Printf("    3) an external syslog server\n")
+	current := "1"
+	switch config.LogShipping {
+	case LogShippingLoki:
+		current = "2"
+	case LogShippingSyslog:
+		current = "3"
+	}
+	fmt.Printf("  Choose [%s]: ", current)
+
+	response, _ := reader.ReadString('\n')
+	response = strings.TrimSpace(response)
+	if response == "" {
+		response = current
+	}
+
+	switch response {
+	case "1":
+		config.LogShipping = ""
+	case "2":
+		days := config.LogRetentionDays
+		if days < 1 {
+			days = DefaultLogRetentionDays
+		}
+		fmt.Printf("  Keep logs for how many days? [%d]: ", days)
+		answer, _ := reader.ReadString('\n')
+		if n, err := strconv.Atoi(strings.TrimSpace(answer)); err == nil && n > 0 {
+			days = n
+		}
+		config.LogShipping = LogShippingLoki
+		config.LogRetentionDays = days
+		fmt.Printf("  Loki accepts at most %d MB/s, so a runaway container cannot fill the disk faster\n", lokiIngestionRateMB)
+	case "3":
+		if config.SyslogTarget != "" {
+			fmt.Printf("  Syslog server [%s]: ", config.SyslogTarget)
+		} else {
+			fmt.Print("  Syslog server (host[:port], tcp://host:port for TCP): ")
+		}
+		answer, _ := reader.ReadString('\n')
+		target := strings.TrimSpace(answer)
+		if target == "" {
+			target = config.SyslogTarget
+		}
+		if _, _, err := ParseSyslogTarget(target); err != nil {
+			fmt.Printf("  ✗ %v - log shipping unchanged\n\n", err)
+			return config
+		}
+		config.LogShipping = LogShippingSyslog
+		config.SyslogTarget = target
+	default:
+		fmt.Println("  Unknown choice - log shipping unchanged")
+	}
+	fmt.Println()
+
+	return config
+}
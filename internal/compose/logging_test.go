@@ -0,0 +1,161 @@
+package compose
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/madhav/servctl/internal/paths"
+)
+
+func TestParseSyslogTarget(t *testing.T) {
+	tests := []struct {
+		target      string
+		wantMode    string
+		wantAddress string
+		wantErr     bool
+	}{
+		{"nas.lan", "udp", "nas.lan:514", false},
+		{"192.168.1.5:1514", "udp", "192.168.1.5:1514", false},
+		{"tcp://nas.lan:6514", "tcp", "nas.lan:6514", false},
+		{"udp://nas.lan", "udp", "nas.lan:514", false},
+		{"http://nas.lan:514", "", "", true},
+		{"nas.lan:99999", "", "", true},
+		{"", "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			mode, address, err := ParseSyslogTarget(tt.target)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseSyslogTarget(%q) error = %v, wantErr %v", tt.target, err, tt.wantErr)
+			}
+			if mode != tt.wantMode || address != tt.wantAddress {
+				t.Errorf("ParseSyslogTarget(%q) = %s %s, want %s %s", tt.target, mode, address, tt.wantMode, tt.wantAddress)
+			}
+		})
+	}
+}
+
+func TestValidateLogShipping(t *testing.T) {
+	config := DefaultConfig()
+	if err := ValidateLogShipping(config); err != nil {
+		t.Errorf("log shipping off: %v", err)
+	}
+
+	config.LogShipping = LogShippingLoki
+	if err := ValidateLogShipping(config); err == nil {
+		t.Error("Loki without a retention period should fail")
+	}
+	config.AutoFillDefaults()
+	if config.LogRetentionDays != DefaultLogRetentionDays {
+		t.Errorf("LogRetentionDays = %d, want %d", config.LogRetentionDays, DefaultLogRetentionDays)
+	}
+	if err := ValidateLogShipping(config); err != nil {
+		t.Errorf("Loki: %v", err)
+	}
+
+	config.LogShipping = LogShippingSyslog
+	if err := ValidateLogShipping(config); err == nil {
+		t.Error("syslog without a target should fail")
+	}
+	config.LogShipping = "elastic"
+	if err := ValidateLogShipping(config); err == nil {
+		t.Error("unknown target should fail")
+	}
+}
+
+func TestGenerateLoggingConfig_Loki(t *testing.T) {
+	config := DefaultConfig()
+	config.LogShipping = LogShippingLoki
+	config.LogRetentionDays = 7
+
+	vector := GenerateVectorConfig(config)
+	for _, want := range []string{"type: docker_logs", "type: loki", "endpoint: http://loki:3100", "when_full: drop_newest"} {
+		if !strings.Contains(vector, want) {
+			t.Errorf("vector.yaml missing %q", want)
+		}
+	}
+
+	loki := GenerateLokiConfig(config)
+	for _, want := range []string{"retention_period: 168h", "retention_enabled: true", "ingestion_rate_mb: 4"} {
+		if !strings.Contains(loki, want) {
+			t.Errorf("loki.yaml missing %q", want)
+		}
+	}
+
+	found := false
+	for _, key := range config.MountedPaths() {
+		found = found || key == paths.Loki
+	}
+	if !found {
+		t.Error("MountedPaths() should include the Loki directory")
+	}
+}
+
+func TestGenerateLoggingConfig_Syslog(t *testing.T) {
+	config := DefaultConfig()
+	config.LogShipping = LogShippingSyslog
+	config.SyslogTarget = "tcp://nas.lan:6514"
+
+	vector := GenerateVectorConfig(config)
+	for _, want := range []string{"type: socket", "mode: tcp", "address: nas.lan:6514", "method: newline_delimited", "<14>1 "} {
+		if !strings.Contains(vector, want) {
+			t.Errorf("vector.yaml missing %q", want)
+		}
+	}
+
+	content, err := GenerateDockerCompose(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(content, "vector:") || strings.Contains(content, "loki:") {
+		t.Error("syslog shipping should deploy Vector without Loki")
+	}
+	for _, key := range config.MountedPaths() {
+		if key == paths.Loki {
+			t.Error("syslog shipping should not create the Loki directory")
+		}
+	}
+}
+
+func TestWriteLoggingConfig(t *testing.T) {
+	dir := t.TempDir()
+	config := DefaultConfig()
+	config.LogShipping = LogShippingSyslog
+	config.SyslogTarget = "nas.lan"
+
+	if err := WriteLoggingConfig(config, dir, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, VectorConfigFile)); err != nil {
+		t.Errorf("vector.yaml not written: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, LokiConfigFile)); err == nil {
+		t.Error("loki.yaml written for syslog shipping")
+	}
+}
+
+func TestPromptLogShipping(t *testing.T) {
+	config := PromptLogShipping(bufio.NewReader(strings.NewReader("2\n30\n")), DefaultConfig())
+	if config.LogShipping != LogShippingLoki || config.LogRetentionDays != 30 {
+		t.Errorf("Loki choice = %q, %d days", config.LogShipping, config.LogRetentionDays)
+	}
+
+	config = PromptLogShipping(bufio.NewReader(strings.NewReader("3\nnot a host\n")), config)
+	if config.LogShipping != LogShippingLoki {
+		t.Errorf("invalid syslog target should keep the current choice, got %q", config.LogShipping)
+	}
+
+	config = PromptLogShipping(bufio.NewReader(strings.NewReader("3\nnas.lan:1514\n")), config)
+	if config.LogShipping != LogShippingSyslog || config.SyslogTarget != "nas.lan:1514" {
+		t.Errorf("syslog choice = %q, %q", config.LogShipping, config.SyslogTarget)
+	}
+
+	config = PromptLogShipping(bufio.NewReader(strings.NewReader("1\n")), config)
+	if config.LogShippingEnabled() {
+		t.Error("choice 1 should turn log shipping off")
+	}
+}
@@ -0,0 +1,146 @@
+package compose
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/madhav/servctl/internal/ops"
+	"github.com/madhav/servctl/templates"
+)
+
+// MsmtpConfigPath is the system-wide msmtp configuration file
+const MsmtpConfigPath = "/etc/msmtprc"
+
+// MailAliasesPath maps local users (e.g., root for cron) to real addresses
+const MailAliasesPath = "/etc/aliases"
+
+// SMTPEnabled reports whether outgoing mail has been configured
+func (c *ServiceConfig) SMTPEnabled() bool {
+	return c.SMTPHost != ""
+}
+
+// smtpSecureMode returns the Nextcloud mail_smtpsecure value for the port
+func smtpSecureMode(port int) string {
+	if port == 465 {
+		return "ssl"
+	}
+	return "tls"
+}
+
+// splitAddress splits an email address into local part and domain
+func splitAddress(address string) (string, string) {
+	parts := strings.SplitN(address, "@", 2)
+	if len(parts) != 2 {
+		return address, ""
+	}
+	return parts[0], parts[1]
+}
+
+// SMTPPasswordEnv is the variable the SMTP password reaches occ in, so it
+// never shows in the process list
+const SMTPPasswordEnv = "SMTP_PASSWORD"
+
+// GenerateNextcloudMailCommands returns the occ arguments that configure
+// Nextcloud's outgoing mail. Each entry is passed to `php occ` as-is, but
+// for the password, which is a ${SMTPPasswordEnv} reference.
+func GenerateNextcloudMailCommands(config *ServiceConfig) [][]string {
+	if !config.SMTPEnabled() {
+		return nil
+	}
+
+	fromLocal, fromDomain := splitAddress(config.SMTPFrom)
+
+	commands := [][]string{
+		{"config:system:set", "mail_smtpmode", "--value=smtp"},
+		{"config:system:set", "mail_sendmailmode", "--value=smtp"},
+		{"config:system:set", "mail_smtphost", "--value=" + config.SMTPHost},
+		{"config:system:set", "mail_smtpport", "--type=integer", "--value=" + strconv.Itoa(config.SMTPPort)},
+		{"config:system:set", "mail_smtpsecure", "--value=" + smtpSecureMode(config.SMTPPort)},
+		{"config:system:set", "mail_from_address", "--value=" + fromLocal},
+		{"config:system:set", "mail_domain", "--value=" + fromDomain},
+	}
+
+	if config.SMTPUser != "" {
+		commands = append(commands,
+			[]string{"config:system:set", "mail_smtpauth", "--type=boolean", "--value=true"},
+			[]string{"config:system:set", "mail_smtpauthtype", "--value=LOGIN"},
+			[]string{"config:system:set", "mail_smtpname", "--value=" + config.SMTPUser},
+			[]string{"config:system:set", "mail_smtppassword", "--value=${" + SMTPPasswordEnv + "}"},
+		)
+	}
+
+	return commands
+}
+
+// GenerateMsmtpConfig generates /etc/msmtprc so cron and scripts can send mail
+func GenerateMsmtpConfig(config *ServiceConfig) string {
+	return mustResolveSecrets(templates.MustRender("system/msmtprc.tmpl", config, composeFuncs), config.secretValue)
+}
+
+// GenerateMailAliases generates /etc/aliases so mail to root reaches a human
+func GenerateMailAliases(config *ServiceConfig) string {
+	return templates.MustRender("system/aliases.tmpl", config, nil)
+}
+
+// systemFile writes a root-owned file, through sudo when needed. The
+// mode is set even on an existing file: the msmtp config holds a password.
+func systemFile(path, content string, mode os.FileMode) ops.WriteFile {
+	return ops.WriteFile{Path: path, Content: []byte(content), Mode: mode, Sudo: true}
+}
+
+// WriteMsmtpConfig writes the msmtp configuration and root mail alias
+func WriteMsmtpConfig(config *ServiceConfig, dryRun bool) error {
+	if !config.SMTPEnabled() {
+		return fmt.Errorf("SMTP is not configured")
+	}
+
+	// Contains the SMTP password, keep it root-only
+	msmtprc := systemFile(MsmtpConfigPath, GenerateMsmtpConfig(config), 0600)
+	msmtprc.Secret = true
+	if err := ops.Execute(dryRun, msmtprc, systemFile(MailAliasesPath, GenerateMailAliases(config), 0644)); err != nil {
+		return err
+	}
+
+	if !dryRun {
+		fmt.Printf("Generated: %s (mode 0600)\n", MsmtpConfigPath)
+	}
+	return nil
+}
+
+// GenerateTestMessage builds the RFC 5322 message used to verify SMTP
+func GenerateTestMessage(config *ServiceConfig) string {
+	return fmt.Sprintf(`From: servctl <%s>
+To: %s
+Subject: servctl test message
+
+Your home server can send mail.
+Cron job failures and service notifications will be delivered to this address.
+`, config.SMTPFrom, config.SMTPRecipient)
+}
+
+// SendTestMail sends a test message through msmtp to verify the SMTP settings
+func SendTestMail(config *ServiceConfig, dryRun bool) error {
+	if !config.SMTPEnabled() {
+		return fmt.Errorf("SMTP is not configured")
+	}
+	if config.SMTPRecipient == "" {
+		return fmt.Errorf("no recipient configured for test message")
+	}
+
+	// A real run has installed msmtp in an earlier phase
+	if _, err := exec.LookPath("msmtp"); err != nil && !dryRun {
+		return fmt.Errorf("msmtp is not installed (sudo apt install -y msmtp-mta)")
+	}
+
+	send := ops.Command{
+		Args:  []string{"sudo", "msmtp", "-a", "servctl", config.SMTPRecipient},
+		Stdin: GenerateTestMessage(config),
+	}
+	if err := ops.Execute(dryRun, send); err != nil {
+		return fmt.Errorf("test message failed: %w", err)
+	}
+	return nil
+}
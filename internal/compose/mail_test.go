@@ -0,0 +1,155 @@
+package compose
+
+import (
+	"strings"
+	"testing"
+)
+
+func newSMTPConfig() *ServiceConfig {
+	config := DefaultConfig()
+	config.SMTPHost = "smtp.example.com"
+	config.SMTPUser = "server@example.com"
+	config.SMTPPassword = "app-password"
+	config.SMTPFrom = "server@example.com"
+	config.SMTPRecipient = "admin@example.com"
+	return config
+}
+
+func TestSMTPEnabled(t *testing.T) {
+	config := DefaultConfig()
+	if config.SMTPEnabled() {
+		t.Error("SMTP should be disabled by default")
+	}
+	if config.SMTPPort != 587 {
+		t.Errorf("SMTPPort = %d, want 587", config.SMTPPort)
+	}
+
+	config.SMTPHost = "smtp.example.com"
+	if !config.SMTPEnabled() {
+		t.Error("SMTP should be enabled when host is set")
+	}
+}
+
+func TestGenerateNextcloudMailCommands(t *testing.T) {
+	if cmds := GenerateNextcloudMailCommands(DefaultConfig()); cmds != nil {
+		t.Errorf("Expected no commands without SMTP, got %d", len(cmds))
+	}
+
+	cmds := GenerateNextcloudMailCommands(newSMTPConfig())
+	joined := make([]string, len(cmds))
+	for i, c := range cmds {
+		if c[0] != "config:system:set" {
+			t.Errorf("Unexpected occ command: %v", c)
+		}
+		joined[i] = strings.Join(c, " ")
+	}
+	all := strings.Join(joined, "\n")
+
+	expected := []string{
+		"mail_smtphost --value=smtp.example.com",
+		"mail_smtpport --type=integer --value=587",
+		"mail_smtpsecure --value=tls",
+		"mail_from_address --value=server",
+		"mail_domain --value=example.com",
+		"mail_smtpname --value=server@example.com",
+		"mail_smtpauth --type=boolean --value=true",
+		"mail_smtppassword --value=${SMTP_PASSWORD}",
+	}
+	for _, e := range expected {
+		if !strings.Contains(all, e) {
+			t.Errorf("Mail commands missing %q", e)
+		}
+	}
+	if strings.Contains(all, "app-password") {
+		t.Error("The SMTP password would show in the process list")
+	}
+}
+
+func TestGenerateNextcloudMailCommands_ImplicitTLS(t *testing.T) {
+	config := newSMTPConfig()
+	config.SMTPPort = 465
+	config.SMTPUser = ""
+
+	all := ""
+	for _, c := range GenerateNextcloudMailCommands(config) {
+		all += strings.Join(c, " ") + "\n"
+	}
+
+	if !strings.Contains(all, "mail_smtpsecure --value=ssl") {
+		t.Error("Port 465 should use ssl")
+	}
+	if strings.Contains(all, "mail_smtpauth") {
+		t.Error("No auth commands expected without a username")
+	}
+}
+
+func TestGenerateMsmtpConfig(t *testing.T) {
+	content := GenerateMsmtpConfig(newSMTPConfig())
+
+	expected := []string{
+		"host           smtp.example.com",
+		"port           587",
+		"from           server@example.com",
+		"user           server@example.com",
+		"password       app-password",
+		"tls_starttls   on",
+		"account default : servctl",
+	}
+	for _, e := range expected {
+		if !strings.Contains(content, e) {
+			t.Errorf("msmtprc missing %q", e)
+		}
+	}
+}
+
+func TestGenerateMailAliases(t *testing.T) {
+	content := GenerateMailAliases(newSMTPConfig())
+	if !strings.Contains(content, "root: admin@example.com") {
+		t.Error("Aliases should route root mail to the recipient")
+	}
+}
+
+func TestGenerateEnvFile_SMTP(t *testing.T) {
+	config := DefaultConfig()
+	config.AutoFillDefaults()
+
+	content, err := GenerateEnvFile(config)
+	if err != nil {
+		t.Fatalf("GenerateEnvFile() error: %v", err)
+	}
+	if strings.Contains(content, "SMTP_HOST") {
+		t.Error(".env should not contain SMTP settings when mail is not configured")
+	}
+
+	content, err = GenerateEnvFile(newSMTPConfig())
+	if err != nil {
+		t.Fatalf("GenerateEnvFile() error: %v", err)
+	}
+	if !strings.Contains(content, `SMTP_HOST="smtp.example.com"`) {
+		t.Error(".env should contain SMTP_HOST")
+	}
+}
+
+func TestValidate_SMTP(t *testing.T) {
+	config := newSMTPConfig()
+	config.AutoFillDefaults()
+	config.NextcloudAdminPass = "adminpass123"
+
+	if errs := config.Validate(); len(errs) != 0 {
+		t.Errorf("Valid SMTP config returned errors: %v", errs)
+	}
+
+	config.SMTPFrom = "not-an-email"
+	if errs := config.Validate(); len(errs) == 0 {
+		t.Error("Invalid from address should fail validation")
+	}
+}
+
+func TestSendTestMail_DryRun(t *testing.T) {
+	if err := SendTestMail(newSMTPConfig(), true); err != nil {
+		t.Errorf("SendTestMail dry run error: %v", err)
+	}
+	if err := SendTestMail(DefaultConfig(), true); err == nil {
+		t.Error("SendTestMail should fail without SMTP configured")
+	}
+}
@@ -0,0 +1,236 @@
+package compose
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/madhav/servctl/internal/ops"
+	"github.com/madhav/servctl/templates"
+)
+
+// SchemaVersion is the version of the state and .env layout this release
+// writes. Files from before versioning count as version 0.
+const SchemaVersion = 1
+
+// EnvSchemaKey records SchemaVersion in the generated .env
+const EnvSchemaKey = "SERVCTL_SCHEMA_VERSION"
+
+// Migration upgrades saved configuration from one schema version to the
+// next. Each step only has to handle its own version; MigrateState and
+// MigrateEnv chain them.
+type Migration struct {
+	From        int
+	Description string
+	// State rewrites the decoded state file (renamed keys, new fields)
+	State func(state map[string]any)
+	// Env rewrites the .env lines
+	Env func(lines []string) []string
+}
+
+// Migrations lists every schema step in order; Migrations[i].From == i.
+// Add one (and bump SchemaVersion) whenever a release renames a key or
+// needs a field older files lack.
+var Migrations = []Migration{
+	{
+		From:        0,
+		Description: "Record the schema version and write out defaults for fields added since the first release",
+		State: func(state map[string]any) {
+			defaults := DefaultConfig()
+			setDefault(state, "DockerSocket", defaults.DockerSocket)
+			setDefault(state, "LocalDomain", defaults.LocalDomain)
+			setDefault(state, "MLModels", defaults.MLModels)
+			setDefault(state, "SMTPPort", defaults.SMTPPort)
+		},
+		Env: func(lines []string) []string {
+			// After the generated header, before the first section
+			at := 0
+			for at < len(lines) && strings.HasPrefix(lines[at], "# ") && !strings.HasPrefix(lines[at], "# ===") {
+				at++
+			}
+			added := []string{EnvSchemaKey + "=" + templates.EnvQuote(1)}
+			if at > 0 {
+				added = append([]string{""}, added...)
+			}
+			return append(lines[:at:at], append(added, lines[at:]...)...)
+		},
+	},
+}
+
+// setDefault fills key when it is missing or zero
+func setDefault(state map[string]any, key string, value any) {
+	switch v := state[key].(type) {
+	case nil:
+	case string:
+		if v != "" {
+			return
+		}
+	case float64:
+		if v != 0 {
+			return
+		}
+	default:
+		return
+	}
+	state[key] = value
+}
+
+// checkVersion rejects files written by a newer servctl
+func checkVersion(what string, version int) error {
+	if version > SchemaVersion {
+		return fmt.Errorf("%s has schema version %d but this servctl only understands up to %d; upgrade servctl", what, version, SchemaVersion)
+	}
+	return nil
+}
+
+// MigrateState upgrades a state file to SchemaVersion and returns the
+// configuration with the descriptions of the steps applied
+func MigrateState(data []byte) (*ServiceConfig, []string, error) {
+	var state map[string]any
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, nil, err
+	}
+
+	version := 0
+	if v, ok := state["SchemaVersion"].(float64); ok {
+		version = int(v)
+	}
+	if err := checkVersion("state file", version); err != nil {
+		return nil, nil, err
+	}
+
+	var applied []string
+	for _, m := range Migrations[version:] {
+		if m.State != nil {
+			m.State(state)
+		}
+		applied = append(applied, fmt.Sprintf("v%d → v%d: %s", m.From, m.From+1, m.Description))
+	}
+	state["SchemaVersion"] = SchemaVersion
+
+	migrated, err := json.Marshal(state)
+	if err != nil {
+		return nil, nil, err
+	}
+	config := DefaultConfig()
+	if err := json.Unmarshal(migrated, config); err != nil {
+		return nil, nil, err
+	}
+	return config, applied, nil
+}
+
+// EnvVersion returns the schema version recorded in .env content
+func EnvVersion(content string) int {
+	for _, line := range strings.Split(content, "\n") {
+		if v, ok := strings.CutPrefix(line, EnvSchemaKey+"="); ok {
+			n, _ := strconv.Atoi(unquoteEnv(v))
+			return n
+		}
+	}
+	return 0
+}
+
+// MigrateEnv upgrades .env content to SchemaVersion
+func MigrateEnv(content string) (string, []string, error) {
+	version := EnvVersion(content)
+	if err := checkVersion(".env", version); err != nil {
+		return "", nil, err
+	}
+
+	lines := strings.Split(content, "\n")
+	var applied []string
+	for _, m := range Migrations[version:] {
+		if m.Env != nil {
+			lines = m.Env(lines)
+		}
+		applied = append(applied, fmt.Sprintf("v%d → v%d: %s", m.From, m.From+1, m.Description))
+	}
+	return strings.Join(lines, "\n"), applied, nil
+}
+
+// MigrationPlan is the upgrade of one configuration file
+type MigrationPlan struct {
+	Path   string
+	Steps  []string
+	Before []byte
+	After  []byte
+}
+
+// PlanMigrations works out which configuration files under infraRoot
+// (state file and compose/.env) need upgrading, without writing anything
+func PlanMigrations(infraRoot string) ([]MigrationPlan, error) {
+	var plans []MigrationPlan
+
+	statePath := StatePath(infraRoot)
+	if data, err := os.ReadFile(statePath); err == nil {
+		config, steps, err := MigrateState(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", statePath, err)
+		}
+		if len(steps) > 0 {
+			after, err := json.MarshalIndent(config, "", "  ")
+			if err != nil {
+				return nil, err
+			}
+			plans = append(plans, MigrationPlan{Path: statePath, Steps: steps, Before: data, After: after})
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	envPath := filepath.Join(infraRoot, "compose", ".env")
+	if data, err := os.ReadFile(envPath); err == nil {
+		after, steps, err := MigrateEnv(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", envPath, err)
+		}
+		if len(steps) > 0 {
+			plans = append(plans, MigrationPlan{Path: envPath, Steps: steps, Before: data, After: []byte(after)})
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return plans, nil
+}
+
+// ApplyMigration writes the upgraded file. The old version is kept in the
+// trash so it can be restored with 'servctl -trash restore'.
+func ApplyMigration(plan MigrationPlan, dryRun bool) error {
+	info, err := os.Stat(plan.Path)
+	if err != nil {
+		return err
+	}
+	// The .env holds the passwords
+	op := ops.WriteFile{Path: plan.Path, Content: plan.After, Mode: info.Mode().Perm(), Secret: filepath.Base(plan.Path) == ".env"}
+	return ops.Execute(dryRun, op)
+}
+
+// ChangedLines returns the lines removed from and added to a file by the
+// plan, for previews
+func (p MigrationPlan) ChangedLines() (removed, added []string) {
+	before := make(map[string]int)
+	for _, line := range strings.Split(string(p.Before), "\n") {
+		before[strings.TrimSpace(line)]++
+	}
+	after := make(map[string]int)
+	for _, line := range strings.Split(string(p.After), "\n") {
+		after[strings.TrimSpace(line)]++
+	}
+	for _, line := range strings.Split(string(p.Before), "\n") {
+		if l := strings.TrimSpace(line); l != "" && after[l] < before[l] {
+			removed = append(removed, l)
+			before[l]--
+		}
+	}
+	for _, line := range strings.Split(string(p.After), "\n") {
+		if l := strings.TrimSpace(line); l != "" && before[l] < after[l] {
+			added = append(added, l)
+			after[l]--
+		}
+	}
+	return removed, added
+}
@@ -0,0 +1,124 @@
+package compose
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMigrations_Chain(t *testing.T) {
+	if len(Migrations) != SchemaVersion {
+		t.Fatalf("%d migrations for schema version %d", len(Migrations), SchemaVersion)
+	}
+	for i, m := range Migrations {
+		if m.From != i || m.Description == "" {
+			t.Errorf("Migrations[%d] = {From: %d, %q}, want From %d with a description", i, m.From, m.Description, i)
+		}
+	}
+}
+
+func TestMigrateState_Unversioned(t *testing.T) {
+	// A state file from before versioning, without later fields
+	old := []byte(`{"Timezone": "UTC", "HostIP": "192.168.1.50", "DataRoot": "/mnt/data", "SMTPPort": 0, "LocalDomain": ""}`)
+
+	config, steps, err := MigrateState(old)
+	if err != nil {
+		t.Fatalf("MigrateState() error: %v", err)
+	}
+	if len(steps) != SchemaVersion {
+		t.Errorf("MigrateState() applied %v, want %d steps", steps, SchemaVersion)
+	}
+	if config.SchemaVersion != SchemaVersion || config.HostIP != "192.168.1.50" {
+		t.Errorf("MigrateState() = %+v", config)
+	}
+	if config.SMTPPort != 587 || config.LocalDomain != DefaultLocalDomain || config.DockerSocket != DefaultDockerSocket {
+		t.Errorf("MigrateState() left defaults unset: port %d, domain %q, socket %q", config.SMTPPort, config.LocalDomain, config.DockerSocket)
+	}
+}
+
+func TestMigrateState_CurrentAndNewer(t *testing.T) {
+	current, _ := json.Marshal(map[string]any{"SchemaVersion": SchemaVersion, "SMTPPort": 465})
+	config, steps, err := MigrateState(current)
+	if err != nil || len(steps) != 0 || config.SMTPPort != 465 {
+		t.Errorf("MigrateState(current) = %v, %v, %v; want no steps and values kept", config.SMTPPort, steps, err)
+	}
+
+	newer, _ := json.Marshal(map[string]any{"SchemaVersion": SchemaVersion + 1})
+	if _, _, err := MigrateState(newer); err == nil || !strings.Contains(err.Error(), "upgrade servctl") {
+		t.Errorf("MigrateState(newer) error = %v, want an upgrade hint", err)
+	}
+}
+
+func TestMigrateEnv(t *testing.T) {
+	pinTime(t)
+	generated, err := GenerateEnvFile(goldenConfigs()["default"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if EnvVersion(generated) != SchemaVersion {
+		t.Fatalf("generated .env has version %d, want %d", EnvVersion(generated), SchemaVersion)
+	}
+
+	// Stripping the version line gives what older releases wrote; the
+	// migration must bring it back to exactly the current output
+	old := strings.Replace(generated, "\n"+EnvSchemaKey+`="1"`+"\n", "", 1)
+	if EnvVersion(old) != 0 {
+		t.Fatal("old .env should be unversioned")
+	}
+	migrated, steps, err := MigrateEnv(old)
+	if err != nil || len(steps) != SchemaVersion {
+		t.Fatalf("MigrateEnv() = %v, %v", steps, err)
+	}
+	if migrated != generated {
+		t.Errorf("MigrateEnv() =\n%s\nwant\n%s", migrated, generated)
+	}
+
+	if _, steps, _ := MigrateEnv(generated); len(steps) != 0 {
+		t.Errorf("MigrateEnv(current) applied %v", steps)
+	}
+}
+
+func TestPlanAndApplyMigrations(t *testing.T) {
+	infraRoot := t.TempDir()
+	statePath := StatePath(infraRoot)
+	envPath := filepath.Join(infraRoot, "compose", ".env")
+	os.MkdirAll(filepath.Dir(envPath), 0755)
+	os.WriteFile(statePath, []byte(`{"HostIP": "192.168.1.50"}`), 0600)
+	os.WriteFile(envPath, []byte("# Generated by servctl\n\nTZ=UTC\n"), 0600)
+
+	plans, err := PlanMigrations(infraRoot)
+	if err != nil || len(plans) != 2 {
+		t.Fatalf("PlanMigrations() = %d plans, %v; want state and .env", len(plans), err)
+	}
+	_, added := plans[1].ChangedLines()
+	if len(added) != 1 || added[0] != EnvSchemaKey+`="1"` {
+		t.Errorf(".env plan adds %v", added)
+	}
+
+	// A dry run writes nothing
+	for _, plan := range plans {
+		if err := ApplyMigration(plan, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if again, _ := PlanMigrations(infraRoot); len(again) != 2 {
+		t.Fatal("dry run should not change files")
+	}
+
+	for _, plan := range plans {
+		if err := ApplyMigration(plan, false); err != nil {
+			t.Fatalf("ApplyMigration(%s) error: %v", plan.Path, err)
+		}
+	}
+	if again, err := PlanMigrations(infraRoot); err != nil || len(again) != 0 {
+		t.Errorf("PlanMigrations() after applying = %d plans, %v; want none", len(again), err)
+	}
+	if info, _ := os.Stat(statePath); info.Mode().Perm() != 0600 {
+		t.Errorf("state mode = %o, want 0600 kept", info.Mode().Perm())
+	}
+	if config, err := LoadState(infraRoot); err != nil || config.HostIP != "192.168.1.50" || config.SchemaVersion != SchemaVersion {
+		t.Errorf("LoadState() after migration = %+v, %v", config, err)
+	}
+}
@@ -0,0 +1,100 @@
+package compose
+
+import (
+	"bufio"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Immich machine-learning model presets
+const (
+	MLOff     = "off"
+	MLSmall   = "small"
+	MLDefault = "default"
+	MLLarge   = "large"
+)
+
+// MLPreset is a CLIP (smart search) and face-recognition model pair
+type MLPreset struct {
+	Name        string
+	Description string
+	CLIPModel   string // Hugging Face repo name under immich-app/
+	FaceModel   string
+	ApproxBytes uint64 // Combined download size, roughly
+	MinRAMGB    int    // Below this the preset is not recommended
+}
+
+// MLPresets lists the choices offered by the wizard, smallest first
+var MLPresets = []MLPreset{
+	{Name: MLOff, Description: "No smart search or face recognition (weak hardware)"},
+	{Name: MLSmall, Description: "Lighter face model for low-memory machines",
+		CLIPModel: "ViT-B-32__openai", FaceModel: "buffalo_s", ApproxBytes: 700e6, MinRAMGB: 4},
+	{Name: MLDefault, Description: "Immich's defaults, good for most servers",
+		CLIPModel: "ViT-B-32__openai", FaceModel: "buffalo_l", ApproxBytes: 900e6, MinRAMGB: 8},
+	{Name: MLLarge, Description: "Best search and face accuracy, needs a strong CPU or GPU",
+		CLIPModel: "ViT-L-16-SigLIP-384__webli", FaceModel: "antelopev2", ApproxBytes: 3.4e9, MinRAMGB: 16},
+}
+
+// FindMLPreset returns the preset with the given name
+func FindMLPreset(name string) (MLPreset, bool) {
+	for _, p := range MLPresets {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return MLPreset{}, false
+}
+
+// RecommendMLPreset picks the largest preset the machine's memory supports
+func RecommendMLPreset(totalRAM uint64) string {
+	gb := int(totalRAM / (1 << 30))
+	recommended := MLOff
+	for _, p := range MLPresets {
+		if p.Name != MLOff && p.Name != MLLarge && gb >= p.MinRAMGB {
+			recommended = p.Name
+		}
+	}
+	return recommended
+}
+
+// MLEnabled reports whether the Immich machine-learning container is deployed
+func (c *ServiceConfig) MLEnabled() bool {
+	return c.MLModels != MLOff
+}
+
+// MLPreset returns the selected model preset
+func (c *ServiceConfig) MLPreset() MLPreset {
+	p, ok := FindMLPreset(c.MLModels)
+	if !ok {
+		p, _ = FindMLPreset(MLDefault)
+	}
+	return p
+}
+
+// PromptMLConfig asks which Immich ML models to use, or to disable ML
+func PromptMLConfig(reader *bufio.Reader, config *ServiceConfig) *ServiceConfig {
+	fmt.Println("Immich Machine Learning (smart search and face recognition):")
+	current := 0
+	for i, p := range MLPresets {
+		marker := " "
+		if p.Name == config.MLModels {
+			marker = "*"
+			current = i
+		}
+		size := ""
+		if p.ApproxBytes > 0 {
+			size = fmt.Sprintf(" (~%.1f GB)", float64(p.ApproxBytes)/1e9)
+		}
+		fmt.Printf("  %s %d) %-8s %s%s\n", marker, i+1, p.Name, p.Description, size)
+	}
+	fmt.Printf("  Choose [%d]: ", current+1)
+
+	response, _ := reader.ReadString('\n')
+	if n, err := strconv.Atoi(strings.TrimSpace(response)); err == nil && n >= 1 && n <= len(MLPresets) {
+		config.MLModels = MLPresets[n-1].Name
+	}
+	fmt.Println()
+
+	return config
+}
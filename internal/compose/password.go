@@ -0,0 +1,351 @@
+package compose
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"strings"
+	"unicode"
+)
+
+// PasswordPolicy is what a user-chosen password must reach. Generated
+// passwords always pass; the policy is about the ones people type in.
+type PasswordPolicy struct {
+	MinLength      int
+	MinEntropyBits float64 // Estimated guessing entropy (see EstimatePasswordStrength)
+}
+
+// DefaultPasswordPolicy suits accounts reachable from the whole LAN and,
+// with a tunnel, the internet: ~2^50 guesses survives an offline attack on
+// a leaked hash for a long time
+func DefaultPasswordPolicy() PasswordPolicy {
+	return PasswordPolicy{MinLength: 10, MinEntropyBits: 50}
+}
+
+// PasswordPolicy returns the policy for passwords entered during setup
+func (c *ServiceConfig) PasswordPolicy() PasswordPolicy {
+	policy := DefaultPasswordPolicy()
+	if c.MinPasswordEntropy > 0 {
+		policy.MinEntropyBits = float64(c.MinPasswordEntropy)
+	}
+	return policy
+}
+
+// PasswordStrength is the estimate for one password
+type PasswordStrength struct {
+	EntropyBits float64  // log2 of the estimated guesses needed
+	Score       int      // 0 (very weak) to 4 (very strong)
+	Feedback    []string // What makes it guessable, most important first
+}
+
+// Label names the score
+func (s PasswordStrength) Label() string {
+	return []string{"very weak", "weak", "fair", "strong", "very strong"}[s.Score]
+}
+
+// commonPasswords are passwords and words attackers try first, most likely
+// first; a match costs log2 of its rank. Service names are included because
+// they are the first thing anyone guesses for that service.
+var commonPasswords = []string{
+	"password", "123456", "12345678", "qwerty", "123456789", "12345", "111111",
+	"1234567", "abc123", "letmein", "admin", "welcome", "monkey", "dragon",
+	"iloveyou", "football", "123123", "000000", "sunshine", "princess",
+	"master", "shadow", "baseball", "superman", "trustno1", "654321", "hello",
+	"freedom", "whatever", "charlie", "michael", "jennifer", "jordan", "hunter",
+	"ashley", "secret", "changeme", "default", "login", "pass", "root", "user",
+	"guest", "test", "love", "summer", "winter", "spring", "autumn", "family",
+	"photos", "photo", "cloud", "home", "house", "server", "homeserver", "nas",
+	"nextcloud", "immich", "servctl", "docker", "linux", "ubuntu", "computer",
+	"internet", "mother", "father", "daughter", "baby", "angel", "lovely",
+	"flower", "tigger", "soccer", "cookie", "purple", "orange", "banana",
+	"pepper", "ginger", "buster", "maggie", "bailey", "daisy", "london",
+	"berlin", "paris", "qwertyuiop", "asdfgh", "zxcvbn", "passw0rd", "welcome1",
+}
+
+// keyboardRows are checked for walks such as "asdf" or "7890"
+var keyboardRows = []string{"qwertyuiop", "asdfghjkl", "zxcvbnm", "1234567890"}
+
+// leetSubstitutions undo common character swaps before dictionary matching
+var leetSubstitutions = strings.NewReplacer(
+	"0", "o", "1", "i", "3", "e", "4", "a", "5", "s", "7", "t", "@", "a", "$", "s", "!", "i",
+)
+
+// passwordMatch is a guessable part of a password, password[start:end]
+type passwordMatch struct {
+	start, end int
+	bits       float64
+	kind       string
+}
+
+// EstimatePasswordStrength estimates how many guesses a password needs, in
+// the spirit of zxcvbn: it finds the cheapest way to build the password out
+// of common passwords, words tied to this server (userInputs), sequences,
+// repeats, keyboard walks and years, charging brute force for the rest
+func EstimatePasswordStrength(password string, userInputs ...string) PasswordStrength {
+	runes := []rune(password)
+	n := len(runes)
+	if n == 0 {
+		return PasswordStrength{Feedback: []string{"Enter a password"}}
+	}
+
+	matches := findPasswordMatches(runes, userInputs)
+
+	// Cheapest cover of the password: best[i] is the fewest bits that
+	// produce the first i characters
+	bruteBits := math.Log2(float64(charsetSize(runes)))
+	best := make([]float64, n+1)
+	via := make([]*passwordMatch, n+1)
+	for i := 1; i <= n; i++ {
+		best[i] = best[i-1] + bruteBits
+		via[i] = nil
+		for k := range matches {
+			m := &matches[k]
+			if m.end == i && best[m.start]+m.bits < best[i] {
+				best[i] = best[m.start] + m.bits
+				via[i] = m
+			}
+		}
+	}
+
+	kinds := make(map[string]bool)
+	for i := n; i > 0; {
+		if m := via[i]; m != nil {
+			kinds[m.kind] = true
+			i = m.start
+		} else {
+			i--
+		}
+	}
+
+	s := PasswordStrength{EntropyBits: best[n]}
+	switch {
+	case s.EntropyBits < 25:
+		s.Score = 0
+	case s.EntropyBits < 40:
+		s.Score = 1
+	case s.EntropyBits < 60:
+		s.Score = 2
+	case s.EntropyBits < 80:
+		s.Score = 3
+	default:
+		s.Score = 4
+	}
+
+	for _, f := range []struct{ kind, text string }{
+		{"common", "It contains a common password or word"},
+		{"personal", "It contains a name tied to you or this server"},
+		{"keyboard", "It contains a keyboard pattern such as qwerty"},
+		{"sequence", "It contains a sequence such as abc or 1234"},
+		{"repeat", "It repeats the same character"},
+		{"year", "It contains a year, which is easy to guess"},
+	} {
+		if kinds[f.kind] {
+			s.Feedback = append(s.Feedback, f.text)
+		}
+	}
+	if n < 12 {
+		s.Feedback = append(s.Feedback, "Longer is stronger: a few unrelated words beat symbols")
+	}
+	return s
+}
+
+// findPasswordMatches lists every guessable part of the password
+func findPasswordMatches(runes []rune, userInputs []string) []passwordMatch {
+	n := len(runes)
+	lower := []rune(strings.ToLower(string(runes)))
+	unleet := []rune(leetSubstitutions.Replace(string(lower)))
+	if len(unleet) != n {
+		unleet = lower
+	}
+
+	var matches []passwordMatch
+	add := func(start, end int, bits float64, kind string) {
+		matches = append(matches, passwordMatch{start: start, end: end, bits: bits, kind: kind})
+	}
+
+	// Dictionary: common passwords and the user's own words
+	words := make(map[string]struct {
+		bits float64
+		kind string
+	})
+	for rank, w := range commonPasswords {
+		words[w] = struct {
+			bits float64
+			kind string
+		}{math.Log2(float64(rank + 2)), "common"}
+	}
+	for _, input := range userInputs {
+		for _, w := range strings.FieldsFunc(strings.ToLower(input), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		}) {
+			if len([]rune(w)) >= 3 {
+				words[w] = struct {
+					bits float64
+					kind string
+				}{1, "personal"}
+			}
+		}
+	}
+	for i := 0; i < n; i++ {
+		for j := i + 3; j <= n; j++ {
+			for _, candidate := range []string{string(lower[i:j]), string(unleet[i:j])} {
+				w, ok := words[candidate]
+				if !ok {
+					continue
+				}
+				bits := w.bits
+				if candidate != string(lower[i:j]) {
+					bits++ // Leet substitutions
+				}
+				if string(runes[i:j]) != string(lower[i:j]) {
+					bits++ // Capitalization
+				}
+				add(i, j, bits, w.kind)
+			}
+		}
+	}
+
+	// Repeats and sequences: runs of equal or consecutive characters
+	for i := 0; i < n; {
+		j := i + 1
+		for j < n && lower[j] == lower[i] {
+			j++
+		}
+		if j-i >= 3 {
+			add(i, j, math.Log2(float64(charsetSize(runes[i:i+1])))+math.Log2(float64(j-i)), "repeat")
+		}
+		i = j
+	}
+	for i := 0; i+2 < n; {
+		step := lower[i+1] - lower[i]
+		j := i + 1
+		if step == 1 || step == -1 {
+			for j+1 < n && lower[j+1]-lower[j] == step {
+				j++
+			}
+		}
+		if j-i+1 >= 3 {
+			add(i, j+1, 4+math.Log2(float64(j-i+1)), "sequence")
+			i = j + 1
+			continue
+		}
+		i++
+	}
+
+	// Keyboard walks along one row, either direction
+	for _, row := range keyboardRows {
+		reversed := []rune(row)
+		for a, b := 0, len(reversed)-1; a < b; a, b = a+1, b-1 {
+			reversed[a], reversed[b] = reversed[b], reversed[a]
+		}
+		for i := 0; i < n; i++ {
+			for j := i + 4; j <= n; j++ {
+				s := string(lower[i:j])
+				if strings.Contains(row, s) || strings.Contains(string(reversed), s) {
+					add(i, j, 5+math.Log2(float64(j-i)), "keyboard")
+				}
+			}
+		}
+	}
+
+	// Years 1900-2099
+	for i := 0; i+4 <= n; i++ {
+		y := string(runes[i : i+4])
+		if (strings.HasPrefix(y, "19") || strings.HasPrefix(y, "20")) && strings.Trim(y, "0123456789") == "" {
+			add(i, i+4, math.Log2(200), "year")
+		}
+	}
+	return matches
+}
+
+// charsetSize is the number of characters a brute-force attack on the
+// password would have to try per position
+func charsetSize(runes []rune) int {
+	var lower, upper, digit, symbol, other bool
+	for _, r := range runes {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r < 128:
+			symbol = true
+		default:
+			other = true
+		}
+	}
+	size := 0
+	for _, c := range []struct {
+		used bool
+		size int
+	}{{lower, 26}, {upper, 26}, {digit, 10}, {symbol, 33}, {other, 100}} {
+		if c.used {
+			size += c.size
+		}
+	}
+	return size
+}
+
+// Check reports whether a user-chosen password meets the policy; the error
+// explains what makes it weak
+func (p PasswordPolicy) Check(password string, userInputs ...string) error {
+	if len([]rune(password)) < p.MinLength {
+		return fmt.Errorf("password must be at least %d characters", p.MinLength)
+	}
+	s := EstimatePasswordStrength(password, userInputs...)
+	if s.EntropyBits < p.MinEntropyBits {
+		reason := "it is too short or too predictable"
+		if len(s.Feedback) > 0 {
+			reason = strings.ToLower(s.Feedback[0][:1]) + s.Feedback[0][1:]
+		}
+		return fmt.Errorf("password is %s (~%.0f bits, policy needs %.0f): %s", s.Label(), s.EntropyBits, p.MinEntropyBits, reason)
+	}
+	return nil
+}
+
+// promptPassword asks for a password to replace a generated one. A
+// password below the policy is only accepted after an explicit yes.
+func promptPassword(reader *bufio.Reader, label string, policy PasswordPolicy, userInputs ...string) (string, bool) {
+	for {
+		fmt.Printf("  %s password [generated, Enter to keep]: ", label)
+		response, _ := reader.ReadString('\n')
+		password := strings.TrimSpace(response)
+		if password == "" {
+			return "", false
+		}
+		err := policy.Check(password, userInputs...)
+		if err == nil {
+			fmt.Printf("  ✓ %s\n", EstimatePasswordStrength(password, userInputs...).Label())
+			return password, true
+		}
+		fmt.Printf("  ⚠ %v\n", err)
+		if len([]rune(password)) < 8 {
+			// Below what the services themselves accept
+			continue
+		}
+		fmt.Print("  Use it anyway? The generated password is much stronger [y/N]: ")
+		answer, _ := reader.ReadString('\n')
+		if a := strings.ToLower(strings.TrimSpace(answer)); a == "y" || a == "yes" {
+			return password, true
+		}
+	}
+}
+
+// PromptAdminPasswords lets the user replace the generated admin passwords
+// with their own, warning when the replacement is weak
+func PromptAdminPasswords(reader *bufio.Reader, config *ServiceConfig) *ServiceConfig {
+	fmt.Println("Admin Passwords (generated ones are shown in the setup report):")
+	policy := config.PasswordPolicy()
+	inputs := []string{config.NextcloudAdminUser, config.ImmichAdminEmail, config.LocalDomain, config.TunnelDomain}
+
+	if pw, ok := promptPassword(reader, "Nextcloud admin", policy, inputs...); ok {
+		config.NextcloudAdminPass = pw
+	}
+	if pw, ok := promptPassword(reader, "Immich admin", policy, inputs...); ok {
+		config.ImmichAdminPass = pw
+	}
+	fmt.Println()
+	return config
+}
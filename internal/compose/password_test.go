@@ -0,0 +1,85 @@
+package compose
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+func TestEstimatePasswordStrength(t *testing.T) {
+	tests := []struct {
+		password string
+		maxScore int
+		minScore int
+		feedback string
+	}{
+		{"password", 0, 0, "common password"},
+		{"P@ssw0rd", 0, 0, "common password"},
+		{"qwertyuiop", 0, 0, ""},
+		{"abcdefgh123", 1, 0, "sequence"},
+		{"aaaaaaaaaaaa", 0, 0, "repeats"},
+		{"Nextcloud2024", 1, 0, "year"},
+		{"correct horse battery staple", 4, 3, ""},
+		{GenerateDBPassword(), 4, 4, ""},
+		{GeneratePassword(16), 4, 3, ""},
+	}
+	for _, tt := range tests {
+		s := EstimatePasswordStrength(tt.password)
+		if s.Score > tt.maxScore || s.Score < tt.minScore {
+			t.Errorf("%q: score %d (%.1f bits), want %d-%d", tt.password, s.Score, s.EntropyBits, tt.minScore, tt.maxScore)
+		}
+		if tt.feedback != "" && !strings.Contains(strings.Join(s.Feedback, "; "), tt.feedback) {
+			t.Errorf("%q: feedback %q, want mention of %q", tt.password, s.Feedback, tt.feedback)
+		}
+	}
+}
+
+func TestEstimatePasswordStrength_UserInputs(t *testing.T) {
+	without := EstimatePasswordStrength("Smithfamily!")
+	with := EstimatePasswordStrength("Smithfamily!", "smith", "home.arpa")
+	if with.EntropyBits >= without.EntropyBits {
+		t.Errorf("a password built on user inputs should be weaker: %.1f vs %.1f bits", with.EntropyBits, without.EntropyBits)
+	}
+	if !strings.Contains(strings.Join(with.Feedback, "; "), "tied to you") {
+		t.Errorf("feedback = %q", with.Feedback)
+	}
+}
+
+func TestPasswordPolicy_Check(t *testing.T) {
+	policy := DefaultPasswordPolicy()
+	if err := policy.Check("short"); err == nil || !strings.Contains(err.Error(), "at least 10") {
+		t.Errorf("Check(short) = %v", err)
+	}
+	if err := policy.Check("password2024"); err == nil || !strings.Contains(err.Error(), "common password") {
+		t.Errorf("Check(password2024) = %v", err)
+	}
+	if err := policy.Check("tangerine-Bicycle-lantern"); err != nil {
+		t.Errorf("Check(passphrase) = %v", err)
+	}
+
+	config := &ServiceConfig{MinPasswordEntropy: 200}
+	if err := config.PasswordPolicy().Check("tangerine-Bicycle-lantern"); err == nil {
+		t.Error("a stricter configured policy should reject the passphrase")
+	}
+}
+
+func TestPromptAdminPasswords(t *testing.T) {
+	config := &ServiceConfig{NextcloudAdminUser: "admin", NextcloudAdminPass: "generated", ImmichAdminPass: "generated2"}
+
+	// Weak Nextcloud password refused, then a strong one; Immich kept
+	input := "password123\nn\ntangerine-Bicycle-lantern\n\n"
+	PromptAdminPasswords(bufio.NewReader(strings.NewReader(input)), config)
+	if config.NextcloudAdminPass != "tangerine-Bicycle-lantern" {
+		t.Errorf("NextcloudAdminPass = %q", config.NextcloudAdminPass)
+	}
+	if config.ImmichAdminPass != "generated2" {
+		t.Errorf("ImmichAdminPass = %q, want the generated one kept", config.ImmichAdminPass)
+	}
+
+	// A weak password is accepted after an explicit yes
+	input = "\npassword123\ny\n"
+	PromptAdminPasswords(bufio.NewReader(strings.NewReader(input)), config)
+	if config.ImmichAdminPass != "password123" {
+		t.Errorf("ImmichAdminPass = %q, want the confirmed override", config.ImmichAdminPass)
+	}
+}
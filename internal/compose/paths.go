@@ -0,0 +1,29 @@
+package compose
+
+import "github.com/madhav/servctl/internal/paths"
+
+// Path returns where a registered data location lives: under its
+// service's root in ServiceRoots, or under DataRoot
+func (c *ServiceConfig) Path(key string) string {
+	return c.ServiceRoots.Join(c.DataRoot, key)
+}
+
+// MountedPaths returns the registry keys the generated compose file
+// bind-mounts, so setup can create exactly those directories first
+func (c *ServiceConfig) MountedPaths() []string {
+	keys := []string{
+		paths.Gallery,
+		paths.Cache,
+		paths.ImmichDB,
+		paths.CloudData,
+		paths.CloudConfig,
+		paths.NextcloudDB,
+	}
+	if c.SSOEnabled {
+		keys = append(keys, paths.AuthentikDB, paths.AuthentikMedia)
+	}
+	if c.LogShipping == LogShippingLoki {
+		keys = append(keys, paths.Loki)
+	}
+	return keys
+}
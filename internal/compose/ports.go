@@ -0,0 +1,98 @@
+package compose
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// ServicePort is a port a service publishes on the host
+type ServicePort struct {
+	Service string
+	Port    int
+	// Field is the setting that changes it; nil for ports servctl fixes
+	Field *int
+}
+
+// ServicePorts lists the ports this configuration publishes on the host,
+// the web interfaces first. SSH is included: a service on port 22 would
+// lock the owner out.
+func (c *ServiceConfig) ServicePorts() []ServicePort {
+	ports := []ServicePort{
+		{Service: "Immich", Port: c.ImmichPort, Field: &c.ImmichPort},
+		{Service: "Nextcloud", Port: c.NextcloudPort, Field: &c.NextcloudPort},
+		{Service: "Glances", Port: c.GlancesPort, Field: &c.GlancesPort},
+	}
+	if c.SSOEnabled {
+		ports = append(ports, ServicePort{Service: "Authentik", Port: c.AuthentikPort, Field: &c.AuthentikPort})
+	}
+	if c.LogShipping == LogShippingLoki {
+		ports = append(ports, ServicePort{Service: "Loki", Port: LokiPort})
+	}
+	if c.LocalDNSEnabled {
+		ports = append(ports, ServicePort{Service: "dnsmasq", Port: 53})
+	}
+	return append(ports, ServicePort{Service: "SSH", Port: 22})
+}
+
+// ValidatePort checks that service can publish port: in range, not taken by
+// another of the configuration's services, and bindable by rootless Docker
+func (c *ServiceConfig) ValidatePort(service string, port int) error {
+	if port <= 0 || port > 65535 {
+		return fmt.Errorf("port must be between 1 and 65535")
+	}
+	for _, p := range c.ServicePorts() {
+		if p.Service != service && p.Port == port {
+			return fmt.Errorf("port %d is already used by %s", port, p.Service)
+		}
+	}
+	if c.Rootless && port < 1024 {
+		return fmt.Errorf("port %d is privileged; rootless Docker cannot publish it", port)
+	}
+	return nil
+}
+
+// ValidatePorts checks every configurable port as ValidatePort does,
+// reporting each clash once
+func (c *ServiceConfig) ValidatePorts() []error {
+	var errs []error
+	reported := make(map[int]bool)
+	for _, p := range c.ServicePorts() {
+		if p.Field == nil || reported[p.Port] {
+			continue
+		}
+		if err := c.ValidatePort(p.Service, p.Port); err != nil {
+			errs = append(errs, fmt.Errorf("%s port: %w", p.Service, err))
+			reported[p.Port] = true
+		}
+	}
+	return errs
+}
+
+// PortInUse reports whether another program already listens on port on
+// this machine. A port that cannot be bound for other reasons (privileged,
+// for a non-root user) is not in use.
+func PortInUse(port int) bool {
+	l, err := net.Listen("tcp", ":"+strconv.Itoa(port))
+	if err != nil {
+		return errors.Is(err, syscall.EADDRINUSE)
+	}
+	l.Close()
+	return false
+}
+
+// portProbeTimeout bounds each PortListening check
+const portProbeTimeout = 2 * time.Second
+
+// PortListening reports whether something answers on port at this machine
+func PortListening(port int) bool {
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)), portProbeTimeout)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
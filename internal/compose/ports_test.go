@@ -0,0 +1,87 @@
+package compose
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestValidatePort(t *testing.T) {
+	config := DefaultConfig()
+	config.SSOEnabled = true
+	config.AuthentikPort = 9000
+
+	tests := []struct {
+		service string
+		port    int
+		want    string
+	}{
+		{"Immich", 2283, ""},
+		{"Immich", 3000, ""},
+		{"Immich", 8080, "already used by Nextcloud"},
+		{"Glances", 9000, "already used by Authentik"},
+		{"Nextcloud", 22, "already used by SSH"},
+		{"Nextcloud", 70000, "between 1 and 65535"},
+		{"Nextcloud", 0, "between 1 and 65535"},
+	}
+	for _, tt := range tests {
+		err := config.ValidatePort(tt.service, tt.port)
+		if tt.want == "" && err != nil {
+			t.Errorf("%s on %d: unexpected error %v", tt.service, tt.port, err)
+		}
+		if tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)) {
+			t.Errorf("%s on %d: got %v, want %q", tt.service, tt.port, err, tt.want)
+		}
+	}
+
+	config.Rootless = true
+	if err := config.ValidatePort("Immich", 80); err == nil {
+		t.Error("Rootless Docker cannot publish a privileged port")
+	}
+}
+
+func TestValidate_PortConflict(t *testing.T) {
+	config := DefaultConfig()
+	config.AutoFillDefaults()
+	config.NextcloudAdminPass = "longenoughpassword"
+	config.GlancesPort = config.ImmichPort
+	errs := config.Validate()
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "2283 is already used by Glances") {
+		t.Errorf("Expected one port conflict, got %v", errs)
+	}
+}
+
+func TestPromptPorts(t *testing.T) {
+	config := DefaultConfig()
+	// Nextcloud: a conflict and a typo are asked again; Glances keeps its port
+	input := "3000\n3000\nabc\n0\n8081\n\n"
+	PromptPorts(bufio.NewReader(strings.NewReader(input)), config)
+	if config.ImmichPort != 3000 || config.NextcloudPort != 8081 || config.GlancesPort != 61208 {
+		t.Errorf("Got ports %d, %d, %d", config.ImmichPort, config.NextcloudPort, config.GlancesPort)
+	}
+
+	rules := FirewallRules(config)
+	ports := map[int]bool{}
+	for _, r := range rules {
+		ports[r.Port] = true
+	}
+	if !ports[3000] || !ports[8081] || ports[2283] {
+		t.Errorf("Firewall rules should follow the chosen ports, got %+v", rules)
+	}
+}
+
+func TestPortInUse(t *testing.T) {
+	l, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Skip("cannot listen: ", err)
+	}
+	defer l.Close()
+	port := l.Addr().(*net.TCPAddr).Port
+	if !PortInUse(port) {
+		t.Errorf("Port %d has a listener", port)
+	}
+	if !PortListening(port) {
+		t.Errorf("Port %d should answer", port)
+	}
+}
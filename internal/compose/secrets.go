@@ -0,0 +1,75 @@
+package compose
+
+import (
+	"fmt"
+
+	"github.com/madhav/servctl/templates"
+)
+
+// secretEnvKeys names the credentials templates can request with
+// ${SECRET:name}, and the .env key each one is kept under
+var secretEnvKeys = map[string]string{
+	"immich_db":       "IMMICH_DB_PASSWORD",
+	"nextcloud_admin": "NEXTCLOUD_ADMIN_PASSWORD",
+	"nextcloud_db":    "NEXTCLOUD_DB_PASSWORD",
+	"discord_webhook": "DISCORD_WEBHOOK_URL",
+	"telegram_token":  "TELEGRAM_BOT_TOKEN",
+	"authentik_key":   "AUTHENTIK_SECRET_KEY",
+	"authentik_db":    "AUTHENTIK_DB_PASSWORD",
+	"authentik_admin": "AUTHENTIK_ADMIN_PASSWORD",
+	"nextcloud_oidc":  "NEXTCLOUD_OIDC_SECRET",
+	"immich_oidc":     "IMMICH_OIDC_SECRET",
+	"tunnel_token":    "CLOUDFLARE_TUNNEL_TOKEN",
+	"smtp":            "SMTP_PASSWORD",
+}
+
+// SecretNames returns the names templates can request, sorted
+func SecretNames() []string {
+	return sortedKeys(secretEnvKeys)
+}
+
+// secretField looks up a named secret's .env field, failing when the name
+// is unknown or this configuration does not write it to .env
+func (c *ServiceConfig) secretField(name string) (string, envField, error) {
+	key, ok := secretEnvKeys[name]
+	if !ok {
+		return "", envField{}, fmt.Errorf("unknown secret %q in ${SECRET:%s}", name, name)
+	}
+	field := envFields[key]
+	if !field.when(c) {
+		return "", envField{}, fmt.Errorf("secret %q is requested but %s is not written to .env for this configuration", name, key)
+	}
+	return key, field, nil
+}
+
+// secretEnvRef resolves a named secret to a reference to its .env key.
+// Docker Compose substitutes the value when it starts the containers, so
+// docker-compose.yml holds no credentials.
+func (c *ServiceConfig) secretEnvRef(name string) (string, error) {
+	key, _, err := c.secretField(name)
+	if err != nil {
+		return "", err
+	}
+	return templates.SecretRef(key), nil
+}
+
+// secretValue resolves a named secret to the value itself, for files read
+// by programs that cannot look into .env
+func (c *ServiceConfig) secretValue(name string) (string, error) {
+	_, field, err := c.secretField(name)
+	if err != nil {
+		return "", err
+	}
+	return field.get(c), nil
+}
+
+// mustResolveSecrets is ResolveSecrets for generators that return a plain
+// string. A template requesting a secret its configuration does not have
+// is a template bug, which its tests catch first.
+func mustResolveSecrets(content string, resolve func(string) (string, error)) string {
+	resolved, err := templates.ResolveSecrets(content, resolve)
+	if err != nil {
+		panic(err)
+	}
+	return resolved
+}
@@ -0,0 +1,55 @@
+package compose
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSecretNames_InEnv(t *testing.T) {
+	for _, name := range SecretNames() {
+		key := secretEnvKeys[name]
+		if field, ok := envFields[key]; !ok || !field.secret {
+			t.Errorf("secret %q is kept under %s, which should be a secret .env field", name, key)
+		}
+	}
+}
+
+func TestGenerateDockerCompose_NoSecrets(t *testing.T) {
+	config := goldenConfigs()["full"]
+	content, err := GenerateDockerCompose(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range config.Secrets() {
+		if strings.Contains(content, secret) {
+			t.Errorf("docker-compose.yml contains the secret %q", secret)
+		}
+	}
+	if strings.Contains(content, "${SECRET:") {
+		t.Error("every ${SECRET:name} should be resolved")
+	}
+	for _, ref := range []string{"DB_PASSWORD=${IMMICH_DB_PASSWORD}", "MYSQL_ROOT_PASSWORD=${NEXTCLOUD_DB_PASSWORD}_root"} {
+		if !strings.Contains(content, ref) {
+			t.Errorf("docker-compose.yml should contain %q", ref)
+		}
+	}
+}
+
+func TestSecretResolvers(t *testing.T) {
+	config := DefaultConfig()
+	config.ImmichDBPassword = "immich-db-pass"
+
+	if ref, err := config.secretEnvRef("immich_db"); err != nil || ref != "${IMMICH_DB_PASSWORD}" {
+		t.Errorf("secretEnvRef() = %q, %v", ref, err)
+	}
+	if value, err := config.secretValue("immich_db"); err != nil || value != "immich-db-pass" {
+		t.Errorf("secretValue() = %q, %v", value, err)
+	}
+	if _, err := config.secretEnvRef("bogus"); err == nil {
+		t.Error("an unknown secret should fail")
+	}
+	// Without SSO, .env has no Authentik keys for compose to substitute
+	if _, err := config.secretEnvRef("authentik_db"); err == nil {
+		t.Error("a secret missing from .env should fail")
+	}
+}
@@ -33,31 +33,113 @@ func PromptServiceConfig(reader *bufio.Reader, config *ServiceConfig) *ServiceCo
 	return config
 }
 
-// PromptPorts prompts user to customize service ports
+// PromptPorts asks for the port of each web interface. A port another
+// service of the setup uses, or one another program already listens on,
+// is refused and asked again.
 func PromptPorts(reader *bufio.Reader, config *ServiceConfig) *ServiceConfig {
-	fmt.Println("Service Ports (press Enter to keep defaults):")
+	fmt.Println("Service Ports (press Enter to keep):")
 	fmt.Println()
 
-	ports := []struct {
-		name    string
-		current *int
-		def     int
-	}{
-		{"Nextcloud", &config.NextcloudPort, 8080},
-		{"Immich", &config.ImmichPort, 2283},
-		{"Glances", &config.GlancesPort, 61208},
+	for _, p := range config.ServicePorts() {
+		if p.Field == nil {
+			continue
+		}
+		if PortInUse(*p.Field) {
+			fmt.Printf("  Port %d is in use on this machine (fine if %s already runs here)\n", *p.Field, p.Service)
+		}
+		for {
+			fmt.Printf("  %s [%d]: ", p.Service, *p.Field)
+			response, _ := reader.ReadString('\n')
+			response = strings.TrimSpace(response)
+			if response == "" {
+				break
+			}
+			port, err := strconv.Atoi(response)
+			if err != nil {
+				fmt.Printf("  %q is not a port number\n", response)
+				continue
+			}
+			if port == *p.Field {
+				break
+			}
+			if err := config.ValidatePort(p.Service, port); err != nil {
+				fmt.Printf("  %s\n", err)
+				continue
+			}
+			if PortInUse(port) {
+				fmt.Printf("  Port %d is in use by another program\n", port)
+				continue
+			}
+			*p.Field = port
+			break
+		}
 	}
+	fmt.Println()
 
-	for _, p := range ports {
-		fmt.Printf("  %s [%d]: ", p.name, *p.current)
-		response, _ := reader.ReadString('\n')
-		response = strings.TrimSpace(response)
-		if response != "" {
-			if port, err := strconv.Atoi(response); err == nil && port > 0 && port < 65536 {
-				*p.current = port
-			}
+	return config
+}
+
+// PromptSMTPConfig prompts user for optional outgoing mail settings
+func PromptSMTPConfig(reader *bufio.Reader, config *ServiceConfig) *ServiceConfig {
+	fmt.Println("Outgoing Mail (used by Nextcloud and cron failure alerts):")
+	fmt.Println()
+
+	fmt.Print("  SMTP host (Enter to skip): ")
+	host, _ := reader.ReadString('\n')
+	host = strings.TrimSpace(host)
+	if host == "" {
+		fmt.Println()
+		return config
+	}
+
+	fmt.Printf("  SMTP port [%d]: ", config.SMTPPort)
+	portStr, _ := reader.ReadString('\n')
+	portStr = strings.TrimSpace(portStr)
+	port := config.SMTPPort
+	if portStr != "" {
+		if p, err := strconv.Atoi(portStr); err == nil && p > 0 && p < 65536 {
+			port = p
+		} else {
+			fmt.Printf("  Invalid port, keeping %d\n", port)
 		}
 	}
+
+	fmt.Print("  SMTP username (Enter for none): ")
+	smtpUser, _ := reader.ReadString('\n')
+	smtpUser = strings.TrimSpace(smtpUser)
+
+	var smtpPass string
+	if smtpUser != "" {
+		fmt.Print("  SMTP password: ")
+		smtpPass, _ = reader.ReadString('\n')
+		smtpPass = strings.TrimSpace(smtpPass)
+	}
+
+	fmt.Print("  From address: ")
+	from, _ := reader.ReadString('\n')
+	from = strings.TrimSpace(from)
+	if err := ValidateEmail(from); err != nil {
+		fmt.Println("  Invalid from address, skipping mail configuration.")
+		fmt.Println()
+		return config
+	}
+
+	fmt.Printf("  Send system mail to [%s]: ", from)
+	to, _ := reader.ReadString('\n')
+	to = strings.TrimSpace(to)
+	if to == "" {
+		to = from
+	} else if err := ValidateEmail(to); err != nil {
+		fmt.Printf("  Invalid address, using %s\n", from)
+		to = from
+	}
+
+	config.SMTPHost = host
+	config.SMTPPort = port
+	config.SMTPUser = smtpUser
+	config.SMTPPassword = smtpPass
+	config.SMTPFrom = from
+	config.SMTPRecipient = to
 	fmt.Println()
 
 	return config
@@ -73,6 +155,7 @@ func RenderConfigPreview(config *ServiceConfig) string {
 
 	b.WriteString(fmt.Sprintf("  Host IP:        %s\n", config.HostIP))
 	b.WriteString(fmt.Sprintf("  Timezone:       %s\n", config.Timezone))
+	b.WriteString(fmt.Sprintf("  Locale:         %s\n", config.Locale))
 	b.WriteString(fmt.Sprintf("  Data Root:      %s\n", config.DataRoot))
 	b.WriteString("\n")
 	b.WriteString("  Service Ports:\n")
@@ -80,6 +163,49 @@ func RenderConfigPreview(config *ServiceConfig) string {
 	b.WriteString(fmt.Sprintf("    • Immich:     %d\n", config.ImmichPort))
 	b.WriteString(fmt.Sprintf("    • Glances:    %d\n", config.GlancesPort))
 	b.WriteString("\n")
+	if config.SMTPEnabled() {
+		b.WriteString(fmt.Sprintf("  Mail:           %s:%d (from %s)\n", config.SMTPHost, config.SMTPPort, config.SMTPFrom))
+	} else {
+		b.WriteString("  Mail:           not configured\n")
+	}
+	if config.MLEnabled() {
+		ml := config.MLPreset()
+		b.WriteString(fmt.Sprintf("  Immich ML:      %s (%s, %s)\n", ml.Name, ml.CLIPModel, ml.FaceModel))
+	} else {
+		b.WriteString("  Immich ML:      disabled\n")
+	}
+	if config.ImmichStorageTemplate != "" {
+		b.WriteString(fmt.Sprintf("  Immich layout:  %s\n", config.ImmichStorageTemplate))
+	} else {
+		b.WriteString("  Immich layout:  Immich default\n")
+	}
+	if config.SSOEnabled {
+		b.WriteString(fmt.Sprintf("  SSO:            Authentik on port %d\n", config.AuthentikPort))
+	}
+	if config.LocalDNSEnabled {
+		b.WriteString(fmt.Sprintf("  Local DNS:      *.%s via dnsmasq\n", config.LocalDomain))
+	}
+	if config.TunnelEnabled() {
+		b.WriteString(fmt.Sprintf("  Remote access:  Cloudflare Tunnel (*.%s)\n", config.TunnelDomain))
+	}
+	for _, a := range config.Addresses() {
+		if a.External != "" {
+			b.WriteString(fmt.Sprintf("  %-15s %s\n", a.Service+" away:", a.External))
+		}
+	}
+	switch config.LogShipping {
+	case LogShippingLoki:
+		b.WriteString(fmt.Sprintf("  Logs:           Loki on port %d, kept %d days\n", LokiPort, config.LogRetentionDays))
+	case LogShippingSyslog:
+		b.WriteString(fmt.Sprintf("  Logs:           syslog to %s\n", config.SyslogTarget))
+	}
+	if len(config.Users) > 0 {
+		b.WriteString(fmt.Sprintf("  Family users:   %d\n", len(config.Users)))
+		for _, u := range config.Users {
+			b.WriteString(fmt.Sprintf("    • %s <%s> (%s)\n", u.Name, u.Email, u.Quota))
+		}
+	}
+	b.WriteString("\n")
 
 	return b.String()
 }
@@ -96,7 +222,18 @@ func PromptConfigConfirmation(reader *bufio.Reader, config *ServiceConfig) (*Ser
 	case "c":
 		// Customize
 		config = PromptServiceConfig(reader, config)
-		config = PromptPorts(reader, config)
+		config = PromptLocale(reader, config)
+		config = PromptAdminPasswords(reader, config)
+		config = PromptSMTPConfig(reader, config)
+		config = PromptMLConfig(reader, config)
+		config = PromptStorageTemplate(reader, config)
+		config = PromptSSOConfig(reader, config)
+		config = PromptLocalDNSConfig(reader, config)
+		config = PromptTunnelConfig(reader, config)
+		config = PromptExternalURLs(reader, config)
+		config = PromptLogShipping(reader, config)
+		config.AutoFillDefaults()
+		config = PromptFamilyMembers(reader, config)
 		return config, true
 	case "s":
 		return config, false
@@ -0,0 +1,106 @@
+package compose
+
+import (
+	"bufio"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/madhav/servctl/internal/ops"
+	"github.com/madhav/servctl/templates"
+)
+
+// OIDC client IDs registered with Authentik
+const (
+	NextcloudOIDCClientID = "nextcloud"
+	ImmichOIDCClientID    = "immich"
+)
+
+// AuthentikBlueprintFile is the blueprint written next to docker-compose.yml
+const AuthentikBlueprintFile = "authentik/blueprints/servctl-sso.yaml"
+
+// ServiceURL returns the LAN URL for a service listening on port
+func (c *ServiceConfig) ServiceURL(port int) string {
+	return fmt.Sprintf("http://%s:%d", c.HostIP, port)
+}
+
+// AuthentikURL returns the base URL of the identity provider
+func (c *ServiceConfig) AuthentikURL() string {
+	return c.ServiceURL(c.AuthentikPort)
+}
+
+// OIDCIssuerURL returns the issuer URL for an Authentik application slug
+func (c *ServiceConfig) OIDCIssuerURL(slug string) string {
+	return fmt.Sprintf("%s/application/o/%s/", c.AuthentikURL(), slug)
+}
+
+// OIDCDiscoveryURL returns the OpenID discovery document URL for a slug
+func (c *ServiceConfig) OIDCDiscoveryURL(slug string) string {
+	return c.OIDCIssuerURL(slug) + ".well-known/openid-configuration"
+}
+
+// NextcloudRedirectURIs returns the callback URLs used by the user_oidc app
+func NextcloudRedirectURIs(config *ServiceConfig) []string {
+	return []string{
+		config.ServiceURL(config.NextcloudPort) + "/apps/user_oidc/code",
+	}
+}
+
+// ImmichRedirectURIs returns the web and mobile callback URLs used by Immich
+func ImmichRedirectURIs(config *ServiceConfig) []string {
+	base := config.ServiceURL(config.ImmichPort)
+	return []string{
+		base + "/auth/login",
+		base + "/user-settings",
+		"app.immich:///oauth-callback",
+	}
+}
+
+// authentikClient is one OAuth2 provider + application pair in the blueprint.
+// Secret names the client secret (see SecretNames).
+type authentikClient struct {
+	Name, Slug, Secret, LaunchURL string
+	Redirects                     []string
+}
+
+// GenerateAuthentikBlueprint generates the Authentik blueprint that registers
+// Nextcloud and Immich as OIDC clients
+func GenerateAuthentikBlueprint(config *ServiceConfig) string {
+	data := struct{ Clients []authentikClient }{[]authentikClient{
+		{"Nextcloud", NextcloudOIDCClientID, "nextcloud_oidc",
+			config.ServiceURL(config.NextcloudPort), NextcloudRedirectURIs(config)},
+		{"Immich", ImmichOIDCClientID, "immich_oidc",
+			config.ServiceURL(config.ImmichPort), ImmichRedirectURIs(config)},
+	}}
+	// Authentik reads the blueprint itself, so it gets the secrets' values
+	return mustResolveSecrets(templates.MustRender("services/authentik-blueprint.yaml.tmpl", data, nil), config.secretValue)
+}
+
+// WriteAuthentikBlueprint writes the SSO blueprint into the compose directory
+func WriteAuthentikBlueprint(config *ServiceConfig, outputDir string, dryRun bool) error {
+	outputPath := filepath.Join(outputDir, AuthentikBlueprintFile)
+
+	// Contains client secrets
+	op := ops.WriteFile{Path: outputPath, Content: []byte(GenerateAuthentikBlueprint(config)), Mode: 0600, Secret: true}
+	if err := ops.Execute(dryRun, op); err != nil {
+		return fmt.Errorf("failed to write Authentik blueprint: %w", err)
+	}
+	if !dryRun {
+		fmt.Printf("Generated: %s (mode 0600)\n", outputPath)
+	}
+	return nil
+}
+
+// PromptSSOConfig asks whether to deploy Authentik for single sign-on
+func PromptSSOConfig(reader *bufio.Reader, config *ServiceConfig) *ServiceConfig {
+	fmt.Println("Single Sign-On:")
+	fmt.Println("  Deploys Authentik so Nextcloud and Immich share one login.")
+	fmt.Print("  Enable SSO? [y/N]: ")
+
+	response, _ := reader.ReadString('\n')
+	response = strings.TrimSpace(strings.ToLower(response))
+	config.SSOEnabled = response == "y" || response == "yes"
+	fmt.Println()
+
+	return config
+}
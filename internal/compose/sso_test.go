@@ -0,0 +1,84 @@
+package compose
+
+import (
+	"strings"
+	"testing"
+)
+
+func ssoConfig() *ServiceConfig {
+	config := DefaultConfig()
+	config.HostIP = "192.168.1.100"
+	config.NextcloudAdminPass = "testpass123"
+	config.SSOEnabled = true
+	config.AutoFillDefaults()
+	return config
+}
+
+func TestOIDCURLs(t *testing.T) {
+	config := ssoConfig()
+
+	if got := config.OIDCIssuerURL("immich"); got != "http://192.168.1.100:9000/application/o/immich/" {
+		t.Errorf("OIDCIssuerURL() = %q", got)
+	}
+	if got := NextcloudRedirectURIs(config)[0]; got != "http://192.168.1.100:8080/apps/user_oidc/code" {
+		t.Errorf("NextcloudRedirectURIs() = %q", got)
+	}
+	if uris := ImmichRedirectURIs(config); uris[len(uris)-1] != "app.immich:///oauth-callback" {
+		t.Errorf("ImmichRedirectURIs() should include the mobile callback, got %v", uris)
+	}
+}
+
+func TestGenerateAuthentikBlueprint(t *testing.T) {
+	config := ssoConfig()
+	blueprint := GenerateAuthentikBlueprint(config)
+
+	checks := []string{
+		"version: 1",
+		"client_id: nextcloud",
+		"client_id: immich",
+		"client_secret: " + config.NextcloudOIDCSecret,
+		"client_secret: " + config.ImmichOIDCSecret,
+		"url: http://192.168.1.100:2283/auth/login",
+		"provider: !KeyOf immich-provider",
+	}
+	for _, check := range checks {
+		if !strings.Contains(blueprint, check) {
+			t.Errorf("Blueprint missing %q", check)
+		}
+	}
+}
+
+func TestGenerateDockerCompose_SSO(t *testing.T) {
+	disabled := DefaultConfig()
+	disabled.NextcloudAdminPass = "testpass123"
+	disabled.AutoFillDefaults()
+	content, err := GenerateDockerCompose(disabled)
+	if err != nil {
+		t.Fatalf("GenerateDockerCompose() error = %v", err)
+	}
+	if strings.Contains(content, "authentik") {
+		t.Error("Compose should not include Authentik when SSO is disabled")
+	}
+
+	content, err = GenerateDockerCompose(ssoConfig())
+	if err != nil {
+		t.Fatalf("GenerateDockerCompose() error = %v", err)
+	}
+	for _, check := range []string{"authentik-server:", "authentik-worker:", "authentik-postgres:", "9000:9000"} {
+		if !strings.Contains(content, check) {
+			t.Errorf("Compose missing %q", check)
+		}
+	}
+}
+
+func TestValidate_SSO(t *testing.T) {
+	config := ssoConfig()
+	if errs := config.Validate(); len(errs) > 0 {
+		t.Errorf("Valid SSO config returned errors: %v", errs)
+	}
+
+	config.ImmichOIDCSecret = "short"
+	if errs := config.Validate(); len(errs) == 0 {
+		t.Error("Short OIDC secret should fail validation")
+	}
+}
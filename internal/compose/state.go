@@ -0,0 +1,70 @@
+package compose
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/madhav/servctl/internal/ops"
+)
+
+// StateFileName is the file in InfraRoot that records the configuration
+// used for the last generation, so later commands can regenerate files
+const StateFileName = "servctl-state.json"
+
+// StatePath returns the location of the state file under infraRoot
+func StatePath(infraRoot string) string {
+	return filepath.Join(infraRoot, StateFileName)
+}
+
+// SaveState writes the configuration to the state file
+func SaveState(config *ServiceConfig, dryRun bool) error {
+	if config.InfraRoot == "" {
+		return fmt.Errorf("cannot save state: InfraRoot is not set")
+	}
+
+	data, err := json.MarshalIndent(withSchemaVersion(config), "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode state: %w", err)
+	}
+
+	// Contains every generated credential
+	op := ops.WriteFile{Path: StatePath(config.InfraRoot), Content: data, Mode: 0600, Secret: true}
+	if err := ops.Execute(dryRun, op); err != nil {
+		return fmt.Errorf("failed to write state: %w", err)
+	}
+	if !dryRun {
+		config.SchemaVersion = SchemaVersion
+	}
+	return nil
+}
+
+// withSchemaVersion is config as the state file stores it, stamped with
+// the schema this release writes
+func withSchemaVersion(config *ServiceConfig) *ServiceConfig {
+	stamped := *config
+	stamped.SchemaVersion = SchemaVersion
+	return &stamped
+}
+
+// LoadState reads the configuration saved by the setup wizard. State from
+// older releases is upgraded in memory; 'servctl -migrate-config' writes
+// the upgrade back.
+func LoadState(infraRoot string) (*ServiceConfig, error) {
+	path := StatePath(infraRoot)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("no saved configuration at %s (run 'servctl -start-setup' first)", path)
+		}
+		return nil, fmt.Errorf("failed to read state: %w", err)
+	}
+
+	config, _, err := MigrateState(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return config, nil
+}
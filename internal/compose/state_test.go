@@ -0,0 +1,39 @@
+package compose
+
+import (
+	"os"
+	"testing"
+)
+
+func TestSaveLoadState(t *testing.T) {
+	config := DefaultConfig()
+	config.InfraRoot = t.TempDir()
+	config.HostIP = "192.168.1.100"
+	config.Users = []FamilyMember{{Name: "Jane", Username: "jane", Email: "jane@example.com"}}
+
+	if err := SaveState(config, false); err != nil {
+		t.Fatalf("SaveState() error = %v", err)
+	}
+
+	info, err := os.Stat(StatePath(config.InfraRoot))
+	if err != nil {
+		t.Fatalf("state file not written: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("state file mode = %o, want 0600", info.Mode().Perm())
+	}
+
+	loaded, err := LoadState(config.InfraRoot)
+	if err != nil {
+		t.Fatalf("LoadState() error = %v", err)
+	}
+	if loaded.HostIP != config.HostIP || len(loaded.Users) != 1 || loaded.Users[0].Email != "jane@example.com" {
+		t.Errorf("LoadState() = %+v, want round-trip of saved config", loaded)
+	}
+}
+
+func TestLoadState_Missing(t *testing.T) {
+	if _, err := LoadState(t.TempDir()); err == nil {
+		t.Error("LoadState() should fail when no state file exists")
+	}
+}
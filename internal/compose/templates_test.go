@@ -0,0 +1,532 @@
+package compose
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/madhav/servctl/internal/paths"
+)
+
+// Rewrite the golden files after an intended template change with:
+//
+//	go test ./internal/compose -run TestGolden -update
+var update = flag.Bool("update", false, "rewrite testdata/golden from the current templates")
+
+// goldenConfigs are the ServiceConfig permutations whose rendered
+// docker-compose.yml and .env are pinned in testdata/golden
+func goldenConfigs() map[string]*ServiceConfig {
+	base := func() *ServiceConfig {
+		c := DefaultConfig()
+		c.Timezone = "Asia/Kolkata"
+		c.Locale = "en_IN.UTF-8"
+		c.HostIP = "192.168.1.100"
+		c.InfraRoot = "/home/user/infra"
+		c.ImmichDBPassword = "immich-db-pass"
+		c.NextcloudAdminPass = "nextcloud-admin-pass"
+		c.NextcloudDBPassword = "nextcloud-db-pass"
+		return c
+	}
+
+	minimal := base()
+	minimal.MLModels = MLOff
+	minimal.DiscordWebhookURL = "https://discord.com/api/webhooks/1/token"
+
+	full := base()
+	full.MLModels = MLLarge
+	full.TelegramBotToken = "123:telegram-token"
+	full.TelegramChatID = "-100123"
+	full.SMTPHost = "smtp.example.com"
+	full.SMTPUser = "server@example.com"
+	full.SMTPPassword = "smtp-pass"
+	full.SMTPFrom = "server@example.com"
+	full.SMTPRecipient = "admin@example.com"
+	full.SSOEnabled = true
+	full.AuthentikSecretKey = "authentik-secret"
+	full.AuthentikDBPassword = "authentik-db-pass"
+	full.AuthentikAdminPass = "authentik-admin-pass"
+	full.TunnelToken = testTunnelToken
+	full.TunnelDomain = "example.com"
+	full.ImmichExternalURL = "https://photos.example.com"
+	full.NextcloudExternalURL = "https://cloud.example.com"
+	full.LogShipping = LogShippingLoki
+	full.LogRetentionDays = 30
+
+	rootless := base()
+	rootless.MLModels = MLSmall
+	rootless.Rootless = true
+	rootless.DockerSocket = "/run/user/1000/docker.sock"
+	rootless.DataRoot = "/home/user/data"
+	rootless.ImmichPort = 12283
+	rootless.NextcloudPort = 18080
+
+	return map[string]*ServiceConfig{
+		"default":  base(),
+		"minimal":  minimal,
+		"full":     full,
+		"rootless": rootless,
+	}
+}
+
+// pinTime fixes the "Generated at" stamp for the test
+func pinTime(t *testing.T) {
+	t.Helper()
+	orig := timeNow
+	timeNow = func() time.Time { return time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC) }
+	t.Cleanup(func() { timeNow = orig })
+}
+
+// checkGolden compares got against testdata/golden/name, or rewrites it
+func checkGolden(t *testing.T, name, got string) {
+	t.Helper()
+	path := filepath.Join("testdata", "golden", name)
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(got), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run with -update to create it)", err)
+	}
+	if got != string(want) {
+		gotLines, wantLines := strings.Split(got, "\n"), strings.Split(string(want), "\n")
+		for i := 0; i < len(gotLines) || i < len(wantLines); i++ {
+			var g, w string
+			if i < len(gotLines) {
+				g = gotLines[i]
+			}
+			if i < len(wantLines) {
+				w = wantLines[i]
+			}
+			if g != w {
+				t.Fatalf("%s differs from golden at line %d:\n got: %q\nwant: %q\n(run with -update if the change is intended)", name, i+1, g, w)
+			}
+		}
+	}
+}
+
+func TestGolden(t *testing.T) {
+	pinTime(t)
+	for name, config := range goldenConfigs() {
+		t.Run(name, func(t *testing.T) {
+			compose, err := GenerateDockerCompose(config)
+			if err != nil {
+				t.Fatalf("GenerateDockerCompose() error: %v", err)
+			}
+			checkGolden(t, name+".docker-compose.yml", compose)
+
+			env, err := GenerateEnvFile(config)
+			if err != nil {
+				t.Fatalf("GenerateEnvFile() error: %v", err)
+			}
+			checkGolden(t, name+".env", env)
+		})
+	}
+}
+
+func TestGeneratedCompose_Schema(t *testing.T) {
+	for name, config := range goldenConfigs() {
+		t.Run(name, func(t *testing.T) {
+			compose, err := GenerateDockerCompose(config)
+			if err != nil {
+				t.Fatalf("GenerateDockerCompose() error: %v", err)
+			}
+			for _, err := range validateComposeSpec(compose) {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// mountOwners are the only services each data directory is mounted into,
+// so a compromised container cannot reach another service's files
+var mountOwners = map[string][]string{
+	paths.Gallery:        {"immich-server"},
+	paths.Cache:          {"immich-redis"},
+	paths.ImmichDB:       {"immich-postgres"},
+	paths.CloudData:      {"nextcloud"},
+	paths.CloudConfig:    {"nextcloud"},
+	paths.NextcloudDB:    {"nextcloud-mariadb"},
+	paths.AuthentikDB:    {"authentik-postgres"},
+	paths.AuthentikMedia: {"authentik-server", "authentik-worker"},
+	paths.Loki:           {"loki"},
+}
+
+// readOnlyServices write only to their volumes and tmpfs
+var readOnlyServices = []string{"immich-redis", "authentik-redis", "glances", "diun", "cloudflared", "loki"}
+
+func TestGeneratedCompose_Mounts(t *testing.T) {
+	for name, config := range goldenConfigs() {
+		t.Run(name, func(t *testing.T) {
+			compose, err := GenerateDockerCompose(config)
+			if err != nil {
+				t.Fatalf("GenerateDockerCompose() error: %v", err)
+			}
+			root, _ := parseBlockYAML(compose)
+			services := root.child("services")
+
+			owner := map[string]string{}
+			for _, key := range config.MountedPaths() {
+				owner[config.Path(key)] = key
+			}
+			for _, svc := range services.Keys {
+				vols := services.child(svc).child("volumes")
+				if vols == nil {
+					continue
+				}
+				for _, v := range vols.Items {
+					parts := strings.Split(strings.Trim(v, `"'`), ":")
+					source, readOnly := parts[0], len(parts) > 2 && parts[2] == "ro"
+					switch {
+					case strings.HasPrefix(source, "./"), strings.HasPrefix(source, "/etc/"), source == config.DockerSocket:
+						if !readOnly {
+							t.Errorf("service %s: %s is mounted writable, want :ro", svc, v)
+						}
+					case owner[source] != "":
+						if !slices.Contains(mountOwners[owner[source]], svc) {
+							t.Errorf("service %s mounts %s, which belongs to %v", svc, owner[source], mountOwners[owner[source]])
+						}
+					}
+				}
+			}
+
+			for _, svc := range readOnlyServices {
+				node := services.child(svc)
+				if node == nil {
+					continue
+				}
+				if ro := node.child("read_only"); ro == nil || ro.Value != "true" {
+					t.Errorf("service %s: want read_only: true", svc)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateComposeSpec_CatchesRegressions(t *testing.T) {
+	tests := []struct {
+		name    string
+		compose string
+		want    string
+	}{
+		{"tab indent", "services:\n\tapp:\n", "tab"},
+		{"unknown top-level key", "service:\n  app:\n    image: x\n", `top-level key "service"`},
+		{"missing image", "services:\n  app:\n    restart: always\n", "no image"},
+		{"misspelled property", "services:\n  app:\n    image: x\n    enviroment:\n      - A=1\n", `"enviroment"`},
+		{"bad restart", "services:\n  app:\n    image: x\n    restart: sometimes\n", "restart"},
+		{"bad port", "services:\n  app:\n    image: x\n    ports:\n      - \"70000:80\"\n", "port"},
+		{"unknown dependency", "services:\n  app:\n    image: x\n    depends_on:\n      db:\n        condition: service_healthy\n", `unknown service "db"`},
+		{"bad condition", "services:\n  db:\n    image: x\n  app:\n    image: x\n    depends_on:\n      db:\n        condition: healthy\n", "condition"},
+		{"undeclared network", "services:\n  app:\n    image: x\n    networks:\n      - lan\n", `network "lan"`},
+		{"undeclared volume", "services:\n  app:\n    image: x\n    volumes:\n      - cache:/cache\n", `volume "cache"`},
+		{"network_mode with networks", "services:\n  app:\n    image: x\n    network_mode: host\n    networks:\n      - lan\nnetworks:\n  lan:\n", "network_mode"},
+		{"duplicate container_name", "services:\n  a:\n    image: x\n    container_name: c\n  b:\n    image: x\n    container_name: c\n", "container_name"},
+		{"unknown alias", "services:\n  app:\n    image: x\n    environment: *env\n", "alias"},
+		{"bad environment entry", "services:\n  app:\n    image: x\n    environment:\n      - =1\n", "environment"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := validateComposeSpec(tt.compose)
+			found := false
+			for _, err := range errs {
+				found = found || strings.Contains(err.Error(), tt.want)
+			}
+			if !found {
+				t.Errorf("validateComposeSpec() = %v, want an error about %q", errs, tt.want)
+			}
+		})
+	}
+}
+
+// TestGeneratedCompose_DockerComposeConfig has Docker Compose itself parse
+// the generated files when it is installed
+func TestGeneratedCompose_DockerComposeConfig(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping docker compose config in short mode")
+	}
+	if exec.Command("docker", "compose", "version").Run() != nil {
+		t.Skip("docker compose not available")
+	}
+	for name, config := range goldenConfigs() {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := WriteAllConfigFiles(config, dir, false); err != nil {
+				t.Fatalf("WriteAllConfigFiles() error: %v", err)
+			}
+			cmd := exec.Command("docker", "compose", "--project-directory", dir, "config", "--quiet")
+			if output, err := cmd.CombinedOutput(); err != nil {
+				t.Errorf("docker compose config rejected the %s files: %v\n%s", name, err, output)
+			}
+		})
+	}
+}
+
+// TestWriteAllConfigFiles_DryRun checks a dry run goes through the same
+// writers without touching the directory
+func TestWriteAllConfigFiles_DryRun(t *testing.T) {
+	dir := t.TempDir()
+	config := DefaultConfig()
+	if err := WriteAllConfigFiles(config, dir, true); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Fatalf("A dry run wrote %d files", len(entries))
+	}
+
+	if err := WriteAllConfigFiles(config, dir, false); err != nil {
+		t.Fatal(err)
+	}
+	before, _ := os.ReadFile(filepath.Join(dir, ".env"))
+	config.Timezone = "Europe/Berlin"
+	if err := WriteAllConfigFiles(config, dir, true); err != nil {
+		t.Fatal(err)
+	}
+	if after, _ := os.ReadFile(filepath.Join(dir, ".env")); string(after) != string(before) {
+		t.Error("A dry run changed .env")
+	}
+}
+
+// =============================================================================
+// Compose-spec checks
+// A small reader for the block-style YAML subset the templates emit, and the
+// compose-spec rules template edits most often break. No YAML library is
+// vendored, so this stands in for a full JSON-schema validation.
+// =============================================================================
+
+// yamlNode is a mapping entry: a scalar value, a nested mapping or a
+// sequence of scalars
+type yamlNode struct {
+	Value string
+	Keys  []string
+	Map   map[string]*yamlNode
+	Items []string
+	Line  int
+}
+
+func (n *yamlNode) child(key string) *yamlNode {
+	if n == nil || n.Map == nil {
+		return nil
+	}
+	return n.Map[key]
+}
+
+// parseBlockYAML reads block mappings and scalar sequences, resolving
+// anchors and aliases on mapping values
+func parseBlockYAML(content string) (*yamlNode, []error) {
+	type frame struct {
+		indent int
+		node   *yamlNode
+	}
+	root := &yamlNode{Map: map[string]*yamlNode{}}
+	stack := []frame{{-1, root}}
+	anchors := map[string]*yamlNode{}
+	var errs []error
+
+	for i, raw := range strings.Split(content, "\n") {
+		lineNo := i + 1
+		trimmed := strings.TrimSpace(raw)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if strings.Contains(raw[:len(raw)-len(strings.TrimLeft(raw, " \t"))], "\t") {
+			errs = append(errs, fmt.Errorf("line %d: tab in indentation", lineNo))
+			continue
+		}
+		indent := len(raw) - len(strings.TrimLeft(raw, " "))
+		for stack[len(stack)-1].indent >= indent {
+			stack = stack[:len(stack)-1]
+		}
+		parent := stack[len(stack)-1].node
+
+		if item, ok := strings.CutPrefix(trimmed, "- "); ok {
+			if parent == root || len(parent.Keys) > 0 {
+				errs = append(errs, fmt.Errorf("line %d: sequence item outside a sequence", lineNo))
+				continue
+			}
+			parent.Items = append(parent.Items, item)
+			continue
+		}
+
+		key, value, ok := strings.Cut(trimmed, ":")
+		if !ok || (value != "" && value[0] != ' ') {
+			errs = append(errs, fmt.Errorf("line %d: expected \"key: value\", got %q", lineNo, trimmed))
+			continue
+		}
+		if parent != root && (len(parent.Items) > 0 || parent.Value != "") {
+			errs = append(errs, fmt.Errorf("line %d: key %q mixed into a sequence or scalar", lineNo, key))
+			continue
+		}
+		if parent.Map == nil {
+			parent.Map = map[string]*yamlNode{}
+		}
+		if _, dup := parent.Map[key]; dup {
+			errs = append(errs, fmt.Errorf("line %d: duplicate key %q", lineNo, key))
+		}
+
+		node := &yamlNode{Value: strings.TrimSpace(value), Line: lineNo}
+		if name, ok := strings.CutPrefix(node.Value, "&"); ok {
+			anchors[name] = node
+			node.Value = ""
+		} else if name, ok := strings.CutPrefix(node.Value, "*"); ok {
+			target, found := anchors[name]
+			if !found {
+				errs = append(errs, fmt.Errorf("line %d: unknown alias *%s", lineNo, name))
+			} else {
+				node = target
+			}
+		}
+		parent.Map[key] = node
+		parent.Keys = append(parent.Keys, key)
+		stack = append(stack, frame{indent, node})
+	}
+	return root, errs
+}
+
+// serviceProperties are the service keys the compose spec defines
+var serviceProperties = map[string]bool{}
+
+func init() {
+	for _, key := range strings.Fields(`annotations attach build blkio_config cap_add cap_drop
+		cgroup cgroup_parent command configs container_name cpu_count cpu_percent cpu_shares
+		cpu_period cpu_quota cpu_rt_runtime cpu_rt_period cpus cpuset credential_spec depends_on
+		deploy develop device_cgroup_rules devices dns dns_opt dns_search domainname entrypoint
+		env_file environment expose extends external_links extra_hosts gpus group_add healthcheck
+		hostname image init ipc isolation labels links logging mac_address mem_limit
+		mem_reservation mem_swappiness memswap_limit network_mode networks oom_kill_disable
+		oom_score_adj pid pids_limit platform ports post_start pre_stop privileged profiles
+		pull_policy read_only restart runtime scale secrets security_opt shm_size stdin_open
+		stop_grace_period stop_signal storage_opt sysctls tmpfs tty ulimits user userns_mode
+		uts volumes volumes_from working_dir`) {
+		serviceProperties[key] = true
+	}
+}
+
+// validateComposeSpec checks a compose file against the compose-spec rules
+func validateComposeSpec(content string) []error {
+	root, errs := parseBlockYAML(content)
+	fail := func(format string, args ...any) { errs = append(errs, fmt.Errorf(format, args...)) }
+
+	for _, key := range root.Keys {
+		switch key {
+		case "name", "services", "networks", "volumes", "configs", "secrets", "include":
+		default:
+			if !strings.HasPrefix(key, "x-") {
+				fail("line %d: unknown top-level key %q", root.Map[key].Line, key)
+			}
+		}
+	}
+
+	services := root.child("services")
+	if services == nil || len(services.Keys) == 0 {
+		return append(errs, fmt.Errorf("no services defined"))
+	}
+	containerNames := map[string]string{}
+
+	for _, name := range services.Keys {
+		svc := services.Map[name]
+		for _, key := range svc.Keys {
+			if !serviceProperties[key] && !strings.HasPrefix(key, "x-") {
+				fail("service %s: unknown property %q (line %d)", name, key, svc.Map[key].Line)
+			}
+		}
+		if svc.child("image") == nil && svc.child("build") == nil {
+			fail("service %s: no image or build", name)
+		}
+		if restart := svc.child("restart"); restart != nil {
+			switch v := strings.Trim(restart.Value, `"'`); {
+			case v == "no", v == "always", v == "unless-stopped", v == "on-failure", strings.HasPrefix(v, "on-failure:"):
+			default:
+				fail("service %s: invalid restart policy %q", name, v)
+			}
+		}
+		if cn := svc.child("container_name"); cn != nil {
+			if other, dup := containerNames[cn.Value]; dup {
+				fail("services %s and %s share container_name %q", other, name, cn.Value)
+			}
+			containerNames[cn.Value] = name
+		}
+		if svc.child("network_mode") != nil && svc.child("networks") != nil {
+			fail("service %s: network_mode and networks are mutually exclusive", name)
+		}
+
+		if ports := svc.child("ports"); ports != nil {
+			for _, p := range ports.Items {
+				for _, part := range strings.Split(strings.Split(strings.Trim(p, `"'`), "/")[0], ":") {
+					if n, err := strconv.Atoi(part); err != nil || n < 1 || n > 65535 {
+						if strings.Count(part, ".") != 3 { // host IP
+							fail("service %s: invalid port mapping %s", name, p)
+							break
+						}
+					}
+				}
+			}
+		}
+
+		if env := svc.child("environment"); env != nil {
+			for _, e := range env.Items {
+				if k, _, _ := strings.Cut(e, "="); k == "" || strings.ContainsAny(k, " \t") {
+					fail("service %s: invalid environment entry %q", name, e)
+				}
+			}
+		}
+
+		if deps := svc.child("depends_on"); deps != nil {
+			for _, dep := range append(append([]string(nil), deps.Keys...), deps.Items...) {
+				if services.child(dep) == nil {
+					fail("service %s: depends on unknown service %q", name, dep)
+				}
+				if cond := deps.child(dep).child("condition"); cond != nil {
+					switch cond.Value {
+					case "service_started", "service_healthy", "service_completed_successfully":
+					default:
+						fail("service %s: invalid depends_on condition %q", name, cond.Value)
+					}
+				}
+			}
+		}
+
+		if nets := svc.child("networks"); nets != nil {
+			for _, net := range append(append([]string(nil), nets.Keys...), nets.Items...) {
+				if root.child("networks").child(net) == nil {
+					fail("service %s: network %q is not declared", name, net)
+				}
+			}
+		}
+
+		if vols := svc.child("volumes"); vols != nil {
+			for _, v := range vols.Items {
+				source, _, ok := strings.Cut(strings.Trim(v, `"'`), ":")
+				if !ok {
+					continue // anonymous volume
+				}
+				if !strings.HasPrefix(source, "/") && !strings.HasPrefix(source, ".") && !strings.HasPrefix(source, "~") &&
+					root.child("volumes").child(source) == nil {
+					fail("service %s: volume %q is not declared", name, source)
+				}
+			}
+		}
+
+		if hc := svc.child("healthcheck"); hc != nil {
+			for _, key := range hc.Keys {
+				switch key {
+				case "test", "interval", "timeout", "retries", "start_period", "start_interval", "disable":
+				default:
+					fail("service %s: unknown healthcheck key %q", name, key)
+				}
+			}
+		}
+	}
+	return errs
+}
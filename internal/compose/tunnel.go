@@ -0,0 +1,106 @@
+package compose
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+)
+
+// TunnelService is the compose service that runs cloudflared
+const TunnelService = "cloudflared"
+
+// TunnelMetricsPort is where cloudflared serves /ready inside its container
+const TunnelMetricsPort = 60123
+
+// TunnelUploadLimit is the largest request Cloudflare proxies on its free
+// plans; bigger single uploads (long phone videos) fail through the tunnel
+const TunnelUploadLimit = "100 MB"
+
+// TunnelEnabled reports whether a Cloudflare Tunnel is deployed
+func (c *ServiceConfig) TunnelEnabled() bool {
+	return c.TunnelToken != ""
+}
+
+// TunnelRoute is a public hostname the tunnel forwards to a service. The
+// routes live in the Cloudflare dashboard; servctl only suggests them.
+type TunnelRoute struct {
+	Hostname string // Public name under the tunnel domain (e.g., "photos.example.com")
+	Service  string // Service the name points at
+	Origin   string // Address cloudflared forwards to on the compose network
+}
+
+// URL returns the public URL of a route
+func (r TunnelRoute) URL() string {
+	return "https://" + r.Hostname
+}
+
+// TunnelRoutes returns the public hostnames to create for the tunnel
+func TunnelRoutes(config *ServiceConfig) []TunnelRoute {
+	if !config.TunnelEnabled() || config.TunnelDomain == "" {
+		return nil
+	}
+	return []TunnelRoute{
+		{Hostname: "photos." + config.TunnelDomain, Service: "Immich", Origin: "http://immich-server:2283"},
+		{Hostname: "cloud." + config.TunnelDomain, Service: "Nextcloud", Origin: "http://nextcloud:80"},
+	}
+}
+
+// ValidateTunnelToken checks the shape of a connector token: one base64
+// string as shown by the Cloudflare dashboard, without the command around it
+func ValidateTunnelToken(token string) error {
+	if strings.ContainsAny(token, " \t") {
+		return fmt.Errorf("paste only the token, not the whole 'cloudflared service install' command")
+	}
+	if len(token) < 50 {
+		return fmt.Errorf("tunnel token looks too short")
+	}
+	return nil
+}
+
+// PromptTunnelConfig asks for a Cloudflare Tunnel, the remote access option
+// that needs neither port forwarding nor a public IP (CGNAT)
+func PromptTunnelConfig(reader *bufio.Reader, config *ServiceConfig) *ServiceConfig {
+	fmt.Println("Remote Access (Cloudflare Tunnel):")
+	fmt.Println("  Reach Nextcloud and Immich from anywhere through a domain you own,")
+	fmt.Println("  without opening router ports. Create a tunnel in the Cloudflare")
+	fmt.Println("  Zero Trust dashboard (Networks → Tunnels) and copy its token.")
+	fmt.Printf("  Note: single uploads over %s (long videos) fail through the tunnel.\n", TunnelUploadLimit)
+	fmt.Print("  Tunnel token (Enter to skip): ")
+
+	token, _ := reader.ReadString('\n')
+	token = strings.TrimSpace(token)
+	if token == "" {
+		if config.TunnelEnabled() {
+			// Forget the public names of the tunnel being removed
+			for _, r := range TunnelRoutes(config) {
+				if r.Service == "Immich" && config.ImmichExternalURL == r.URL() {
+					config.ImmichExternalURL = ""
+				}
+				if r.Service == "Nextcloud" && config.NextcloudExternalURL == r.URL() {
+					config.NextcloudExternalURL = ""
+				}
+			}
+		}
+		config.TunnelToken = ""
+		config.TunnelDomain = ""
+		fmt.Println()
+		return config
+	}
+	if err := ValidateTunnelToken(token); err != nil {
+		fmt.Printf("  ✗ %v - tunnel skipped\n\n", err)
+		return config
+	}
+
+	fmt.Print("  Domain on Cloudflare (e.g., example.com): ")
+	domain, _ := reader.ReadString('\n')
+	domain = strings.TrimSpace(strings.ToLower(domain))
+	if !localDomainRegex.MatchString(domain) || !strings.Contains(domain, ".") {
+		fmt.Printf("  ✗ invalid domain %q - tunnel skipped\n\n", domain)
+		return config
+	}
+
+	config.TunnelToken = token
+	config.TunnelDomain = domain
+	fmt.Println()
+	return config
+}
@@ -0,0 +1,88 @@
+package compose
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+const testTunnelToken = "eyJhIjoiMTIzNDU2Nzg5MGFiY2RlZiIsInQiOiJhYmNkZWYtMTIzNCIsInMiOiJzZWNyZXQifQ=="
+
+func tunnelConfig() *ServiceConfig {
+	config := DefaultConfig()
+	config.HostIP = "192.168.1.100"
+	config.NextcloudAdminPass = "testpass123"
+	config.TunnelToken = testTunnelToken
+	config.TunnelDomain = "example.com"
+	config.AutoFillDefaults() // Points the external URLs at the tunnel
+	return config
+}
+
+func TestTunnelRoutes(t *testing.T) {
+	if routes := TunnelRoutes(DefaultConfig()); routes != nil {
+		t.Errorf("TunnelRoutes() without a token = %v, want none", routes)
+	}
+
+	routes := TunnelRoutes(tunnelConfig())
+	if len(routes) != 2 {
+		t.Fatalf("TunnelRoutes() returned %d routes, want 2", len(routes))
+	}
+	if routes[0].URL() != "https://photos.example.com" || routes[0].Origin != "http://immich-server:2283" {
+		t.Errorf("Immich route = %+v", routes[0])
+	}
+	if got := tunnelConfig().NextcloudExternalURL; got != "https://cloud.example.com" {
+		t.Errorf("NextcloudExternalURL = %q, want the tunnel's public name", got)
+	}
+}
+
+func TestGenerateDockerCompose_Tunnel(t *testing.T) {
+	config := tunnelConfig()
+	content, err := GenerateDockerCompose(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"cloudflared:", "TUNNEL_TOKEN=${CLOUDFLARE_TUNNEL_TOKEN}", "TRUSTED_PROXIES="} {
+		if !strings.Contains(content, want) {
+			t.Errorf("docker-compose.yml missing %q", want)
+		}
+	}
+	if strings.Contains(content, config.TunnelToken) {
+		t.Error("the tunnel token belongs in .env, not docker-compose.yml")
+	}
+	if strings.Contains(content, "OVERWRITEHOST") {
+		t.Error("OVERWRITEHOST would send tunnel visitors to the LAN address")
+	}
+
+	env, err := GenerateEnvFile(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(env, `CLOUDFLARE_TUNNEL_TOKEN="`+config.TunnelToken+`"`) {
+		t.Error(".env missing the tunnel token")
+	}
+}
+
+func TestValidate_Tunnel(t *testing.T) {
+	config := tunnelConfig()
+	if errs := config.Validate(); len(errs) != 0 {
+		t.Errorf("Validate() = %v", errs)
+	}
+
+	config.TunnelToken = "sudo cloudflared service install " + testTunnelToken
+	config.TunnelDomain = "not a domain"
+	if errs := config.Validate(); len(errs) != 2 {
+		t.Errorf("Validate() = %v, want token and domain errors", errs)
+	}
+}
+
+func TestPromptTunnelConfig(t *testing.T) {
+	config := PromptTunnelConfig(bufio.NewReader(strings.NewReader(testTunnelToken+"\nExample.com\n")), DefaultConfig())
+	if !config.TunnelEnabled() || config.TunnelDomain != "example.com" {
+		t.Errorf("tunnel = %q on %q", config.TunnelToken, config.TunnelDomain)
+	}
+
+	config = PromptTunnelConfig(bufio.NewReader(strings.NewReader("\n")), config)
+	if config.TunnelEnabled() {
+		t.Error("an empty token should turn the tunnel off")
+	}
+}
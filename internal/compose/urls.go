@@ -0,0 +1,123 @@
+package compose
+
+import (
+	"bufio"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// ServiceAddress is where a service is reached at home and away. With
+// remote access configured the two differ: LAN devices use the internal
+// URL, everything outside the LAN the external one.
+type ServiceAddress struct {
+	Service  string
+	Internal string // LAN URL
+	External string // URL from outside the LAN; empty when there is none
+}
+
+// Addresses returns the home and away URLs of the services family members
+// open
+func (c *ServiceConfig) Addresses() []ServiceAddress {
+	return []ServiceAddress{
+		{Service: "Immich", Internal: c.ServiceURL(c.ImmichPort), External: c.ImmichExternalURL},
+		{Service: "Nextcloud", Internal: c.ServiceURL(c.NextcloudPort), External: c.NextcloudExternalURL},
+	}
+}
+
+// HasExternalURLs reports whether any service is reachable from outside
+func (c *ServiceConfig) HasExternalURLs() bool {
+	return c.ImmichExternalURL != "" || c.NextcloudExternalURL != ""
+}
+
+// NextcloudCLIURL is Nextcloud's overwrite.cli.url, the base of links in
+// mails and notifications generated outside a request: the external URL
+// when there is one, since those links are opened from anywhere
+func (c *ServiceConfig) NextcloudCLIURL() string {
+	if c.NextcloudExternalURL != "" {
+		return c.NextcloudExternalURL
+	}
+	return c.ServiceURL(c.NextcloudPort)
+}
+
+// NextcloudTrustedDomains lists the names Nextcloud accepts requests for
+func NextcloudTrustedDomains(config *ServiceConfig) string {
+	domains := []string{config.HostIP, "localhost"}
+	if host := urlHost(config.NextcloudExternalURL); host != "" {
+		domains = append(domains, host)
+	}
+	return strings.Join(domains, " ")
+}
+
+// urlHost returns the host[:port] of a URL, or "" when it has none
+func urlHost(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
+
+// ValidateExternalURL checks a URL a service is reached at from outside
+func ValidateExternalURL(raw string) error {
+	if raw == "" {
+		return nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return fmt.Errorf("invalid URL %q (use e.g. https://photos.example.com)", raw)
+	}
+	if u.Path != "" && u.Path != "/" {
+		return fmt.Errorf("URL %q must not have a path; the services expect to be served at the root", raw)
+	}
+	return nil
+}
+
+// fillTunnelURLs points the external URLs at the tunnel's public names when
+// they are not set yet
+func (c *ServiceConfig) fillTunnelURLs() {
+	for _, r := range TunnelRoutes(c) {
+		switch {
+		case r.Service == "Immich" && c.ImmichExternalURL == "":
+			c.ImmichExternalURL = r.URL()
+		case r.Service == "Nextcloud" && c.NextcloudExternalURL == "":
+			c.NextcloudExternalURL = r.URL()
+		}
+	}
+}
+
+// PromptExternalURLs asks for the addresses used away from home when remote
+// access comes from something servctl does not deploy, such as Tailscale or
+// a reverse proxy
+func PromptExternalURLs(reader *bufio.Reader, config *ServiceConfig) *ServiceConfig {
+	if config.TunnelEnabled() {
+		config.fillTunnelURLs()
+		return config
+	}
+
+	fmt.Println("Remote URLs (Tailscale, reverse proxy - Enter to skip):")
+	ask := func(name, current string) string {
+		if current != "" {
+			fmt.Printf("  %s [%s, - for none]: ", name, current)
+		} else {
+			fmt.Printf("  %s: ", name)
+		}
+		answer, _ := reader.ReadString('\n')
+		answer = strings.TrimRight(strings.TrimSpace(answer), "/")
+		switch answer {
+		case "":
+			return current
+		case "-":
+			return ""
+		}
+		if err := ValidateExternalURL(answer); err != nil {
+			fmt.Printf("  ✗ %v - skipped\n", err)
+			return current
+		}
+		return answer
+	}
+	config.ImmichExternalURL = ask("Immich URL away from home", config.ImmichExternalURL)
+	config.NextcloudExternalURL = ask("Nextcloud URL away from home", config.NextcloudExternalURL)
+	fmt.Println()
+	return config
+}
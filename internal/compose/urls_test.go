@@ -0,0 +1,78 @@
+package compose
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+func TestValidateExternalURL(t *testing.T) {
+	tests := []struct {
+		url     string
+		wantErr bool
+	}{
+		{"", false},
+		{"https://photos.example.com", false},
+		{"http://server.tailnet.ts.net:2283", false},
+		{"photos.example.com", true},
+		{"ftp://photos.example.com", true},
+		{"https://example.com/photos", true},
+	}
+	for _, tt := range tests {
+		if err := ValidateExternalURL(tt.url); (err != nil) != tt.wantErr {
+			t.Errorf("ValidateExternalURL(%q) error = %v, wantErr %v", tt.url, err, tt.wantErr)
+		}
+	}
+}
+
+func TestSplitHorizonURLs(t *testing.T) {
+	config := DefaultConfig()
+	config.HostIP = "192.168.1.100"
+	config.LocalDNSEnabled = true
+
+	if got := config.NextcloudCLIURL(); got != "http://192.168.1.100:8080" {
+		t.Errorf("NextcloudCLIURL() without remote access = %q", got)
+	}
+	if got := config.ImmichPhoneURL(); got != "http://photos.home.arpa:2283" {
+		t.Errorf("ImmichPhoneURL() without remote access = %q", got)
+	}
+
+	config.NextcloudExternalURL = "https://cloud.example.com"
+	config.ImmichExternalURL = "https://photos.example.com"
+	if got := config.NextcloudCLIURL(); got != "https://cloud.example.com" {
+		t.Errorf("NextcloudCLIURL() = %q, want the external URL", got)
+	}
+	if got := NextcloudTrustedDomains(config); got != "192.168.1.100 localhost cloud.example.com" {
+		t.Errorf("NextcloudTrustedDomains() = %q", got)
+	}
+	if got := config.ImmichPhoneURL(); got != "https://photos.example.com" {
+		t.Errorf("ImmichPhoneURL() = %q, want the external URL", got)
+	}
+	if got := config.ImmichPhoneLANURL(); got != "http://photos.home.arpa:2283" {
+		t.Errorf("ImmichPhoneLANURL() = %q", got)
+	}
+}
+
+func TestPromptExternalURLs(t *testing.T) {
+	input := "https://server.tailnet.ts.net:2283/\nnot a url\n"
+	config := PromptExternalURLs(bufio.NewReader(strings.NewReader(input)), DefaultConfig())
+	if config.ImmichExternalURL != "https://server.tailnet.ts.net:2283" {
+		t.Errorf("ImmichExternalURL = %q", config.ImmichExternalURL)
+	}
+	if config.NextcloudExternalURL != "" {
+		t.Errorf("an invalid URL should be skipped, got %q", config.NextcloudExternalURL)
+	}
+
+	config = PromptExternalURLs(bufio.NewReader(strings.NewReader("-\n\n")), config)
+	if config.HasExternalURLs() {
+		t.Error("'-' should clear the URL")
+	}
+
+	// With a tunnel the URLs come from its public names, without asking
+	config = tunnelConfig()
+	config.ImmichExternalURL = ""
+	config = PromptExternalURLs(bufio.NewReader(strings.NewReader("")), config)
+	if config.ImmichExternalURL != "https://photos.example.com" {
+		t.Errorf("tunnel ImmichExternalURL = %q", config.ImmichExternalURL)
+	}
+}
@@ -0,0 +1,226 @@
+package compose
+
+import (
+	"bufio"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// FamilyMember describes a person who gets accounts on Nextcloud and Immich
+type FamilyMember struct {
+	Name     string // Display name (e.g., "Jane Doe")
+	Username string // Login name derived from the display name
+	Email    string // Email address (Immich login, Nextcloud notifications)
+	Quota    string // Storage quota (e.g., "50GB"), empty for unlimited
+	Password string // Generated initial password
+
+	// Immich API key created for uploading from a computer (ImmichAPIKeys)
+	ImmichAPIKey string `json:",omitempty"`
+}
+
+// DefaultQuota is suggested when adding family members
+const DefaultQuota = "100GB"
+
+// DefaultFamilyAlbum is the shared Immich album suggested for the family
+const DefaultFamilyAlbum = "Family"
+
+// NormalizeUsername converts a display name into a safe login name.
+// Accented Latin letters are spelled without their accents; names in other
+// scripts leave nothing, and the wizard asks for a login name instead.
+func NormalizeUsername(name string) string {
+	username := latinFolds.Replace(strings.ToLower(strings.TrimSpace(name)))
+	username = regexp.MustCompile(`[^a-z0-9]+`).ReplaceAllString(username, ".")
+	return strings.Trim(username, ".")
+}
+
+// latinFolds spells accented Latin letters in ASCII
+var latinFolds = func() *strings.Replacer {
+	folds := map[string]string{
+		"a": "àáâãäåāăą", "c": "çćĉċč", "d": "ďđð", "e": "èéêëēĕėęě", "g": "ĝğġģ",
+		"h": "ĥħ", "i": "ìíîïĩīĭįı", "j": "ĵ", "k": "ķ", "l": "ĺļľŀł", "n": "ñńņňŉ",
+		"o": "òóôõöøōŏő", "r": "ŕŗř", "s": "śŝşšș", "t": "ţťŧț", "u": "ùúûüũūŭůűų",
+		"w": "ŵ", "y": "ýÿŷ", "z": "źżž", "ss": "ß", "ae": "æ", "oe": "œ", "th": "þ",
+	}
+	var pairs []string
+	for ascii, letters := range folds {
+		for _, r := range letters {
+			pairs = append(pairs, string(r), ascii)
+		}
+	}
+	return strings.NewReplacer(pairs...)
+}()
+
+// ParseQuota converts a quota string like "50GB" or "1.5 TB" into bytes.
+// An empty string or "none" means unlimited and returns 0.
+func ParseQuota(quota string) (int64, error) {
+	q := strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(quota), " ", ""))
+	if q == "" || q == "NONE" || q == "UNLIMITED" {
+		return 0, nil
+	}
+
+	units := []struct {
+		suffix string
+		mult   float64
+	}{
+		{"TB", 1 << 40},
+		{"GB", 1 << 30},
+		{"MB", 1 << 20},
+		{"T", 1 << 40},
+		{"G", 1 << 30},
+		{"M", 1 << 20},
+	}
+
+	for _, u := range units {
+		if strings.HasSuffix(q, u.suffix) {
+			value, err := strconv.ParseFloat(strings.TrimSuffix(q, u.suffix), 64)
+			if err != nil || value <= 0 {
+				return 0, fmt.Errorf("invalid quota: %s", quota)
+			}
+			return int64(value * u.mult), nil
+		}
+	}
+
+	return 0, fmt.Errorf("invalid quota %q (use e.g. 50GB or 1TB)", quota)
+}
+
+// NextcloudQuota formats a quota string the way occ expects it ("51200 MB")
+func NextcloudQuota(quota string) string {
+	bytes, err := ParseQuota(quota)
+	if err != nil || bytes == 0 {
+		return "none"
+	}
+	return fmt.Sprintf("%d MB", bytes>>20)
+}
+
+// ValidateFamilyMember checks a family member entry
+func ValidateFamilyMember(m FamilyMember) error {
+	if m.Username == "" {
+		return fmt.Errorf("a login name of letters or digits is required")
+	}
+	if err := ValidateEmail(m.Email); err != nil {
+		return err
+	}
+	if _, err := ParseQuota(m.Quota); err != nil {
+		return err
+	}
+	return nil
+}
+
+// PromptFamilyMembers collects family members who should get accounts
+func PromptFamilyMembers(reader *bufio.Reader, config *ServiceConfig) *ServiceConfig {
+	fmt.Println("Family Accounts (created on Nextcloud and Immich after startup):")
+	fmt.Println()
+
+	for {
+		fmt.Print("  Name (Enter to finish): ")
+		name, _ := reader.ReadString('\n')
+		name = strings.TrimSpace(name)
+		if name == "" {
+			break
+		}
+
+		fmt.Print("  Email: ")
+		email, _ := reader.ReadString('\n')
+		email = strings.TrimSpace(email)
+
+		fmt.Printf("  Storage quota [%s]: ", DefaultQuota)
+		quota, _ := reader.ReadString('\n')
+		quota = strings.TrimSpace(quota)
+		if quota == "" {
+			quota = DefaultQuota
+		}
+
+		username := NormalizeUsername(name)
+		if username == "" {
+			// A name in another script: ask rather than skip the person
+			fmt.Printf("  Login name for %s (Latin letters and digits): ", name)
+			answer, _ := reader.ReadString('\n')
+			username = NormalizeUsername(answer)
+		}
+
+		member := FamilyMember{
+			Name:     name,
+			Username: username,
+			Email:    email,
+			Quota:    quota,
+			Password: GeneratePassword(16),
+		}
+
+		if err := ValidateFamilyMember(member); err != nil {
+			fmt.Printf("  ✗ Skipping %s: %v\n\n", name, err)
+			continue
+		}
+
+		config.Users = append(config.Users, member)
+		fmt.Printf("  ✓ Added %s (%s)\n\n", member.Name, member.Username)
+	}
+
+	if len(config.Users) > 0 {
+		config = promptImmichSharing(reader, config)
+	}
+
+	fmt.Println()
+	return config
+}
+
+// promptImmichSharing asks for the Immich sharing starter applied after the
+// family accounts are created
+func promptImmichSharing(reader *bufio.Reader, config *ServiceConfig) *ServiceConfig {
+	ask := func(prompt string) string {
+		fmt.Print(prompt)
+		answer, _ := reader.ReadString('\n')
+		return strings.TrimSpace(answer)
+	}
+	yes := func(answer string) bool {
+		answer = strings.ToLower(answer)
+		return answer == "y" || answer == "yes"
+	}
+
+	fmt.Println("  Photo sharing (Immich):")
+	album := ask(fmt.Sprintf("  Shared family album name [%s, - for none]: ", DefaultFamilyAlbum))
+	switch album {
+	case "":
+		config.ImmichFamilyAlbum = DefaultFamilyAlbum
+	case "-":
+		config.ImmichFamilyAlbum = ""
+	default:
+		config.ImmichFamilyAlbum = album
+	}
+	if len(config.Users) > 1 {
+		config.ImmichPartnerSharing = yes(ask("  Let members see each other's whole library (partner sharing)? [y/N]: "))
+	}
+	config.ImmichAPIKeys = yes(ask("  Create an API key per member for uploading from a computer? [y/N]: "))
+	return config
+}
+
+// ImmichSharingEnabled reports whether any part of the Immich sharing
+// starter is configured
+func (c *ServiceConfig) ImmichSharingEnabled() bool {
+	return c.ImmichFamilyAlbum != "" || c.ImmichPartnerSharing || c.ImmichAPIKeys
+}
+
+// ImmichPhoneURL is the Immich address to enter in the mobile app: the
+// external URL when there is one, since it works away from home too, else
+// the LAN address
+func (c *ServiceConfig) ImmichPhoneURL() string {
+	if c.ImmichExternalURL != "" {
+		return c.ImmichExternalURL
+	}
+	return c.ImmichPhoneLANURL()
+}
+
+// ImmichPhoneLANURL is the Immich address phones use at home: the friendly
+// name when the server answers DNS for the LAN (phones cannot use a hosts
+// file), the IP address otherwise
+func (c *ServiceConfig) ImmichPhoneLANURL() string {
+	if c.LocalDNSEnabled {
+		for _, r := range HostRecords(c) {
+			if r.Service == "Immich" {
+				return r.URL()
+			}
+		}
+	}
+	return c.ServiceURL(c.ImmichPort)
+}
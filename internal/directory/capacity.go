@@ -0,0 +1,85 @@
+package directory
+
+import "fmt"
+
+const gib = 1 << 30
+
+// Capacity is what the machine offers the services; zero fields are unknown
+// and never warned about
+type Capacity struct {
+	TotalRAM uint64 // Bytes
+	DataFree uint64 // Free bytes on the filesystem holding the data root
+}
+
+// serviceNeed is roughly what one selectable service needs to run well
+type serviceNeed struct {
+	Name    string
+	RAM     uint64 // Bytes of memory while idle-to-busy
+	Free    uint64 // Bytes of free space before any user data
+	Why     string // What the free space is for
+	Enabled func(ServiceSelection) bool
+}
+
+// serviceNeeds are estimates, erring high: a warning costs a second of
+// reading, a full disk a broken library
+var serviceNeeds = []serviceNeed{
+	{"Immich", 2 * gib, 20 * gib, "thumbnails and video transcodes", func(s ServiceSelection) bool { return s.Immich }},
+	{"Nextcloud", 1 * gib, 5 * gib, "previews and app data", func(s ServiceSelection) bool { return s.Nextcloud }},
+	{"Databases", 1 * gib, 5 * gib, "PostgreSQL and MariaDB", func(s ServiceSelection) bool { return s.Databases }},
+	{"Media", 2 * gib, 20 * gib, "Jellyfin's transcode cache", func(s ServiceSelection) bool { return s.Media }},
+	{"Downloads", 0, 50 * gib, "incomplete downloads", func(s ServiceSelection) bool { return s.Downloads }},
+}
+
+// ImmichMinRAM is below what Immich runs in at all; the default selection
+// leaves it out on such machines
+const ImmichMinRAM = 4 * gib
+
+// ImmichMLRAM is the memory under which Immich's machine learning is better
+// off or on its small models
+const ImmichMLRAM = 8 * gib
+
+// RecommendedSelection is the default selection adjusted to the machine
+func RecommendedSelection(c Capacity) ServiceSelection {
+	sel := DefaultServiceSelection()
+	if c.TotalRAM > 0 && c.TotalRAM < ImmichMinRAM {
+		sel.Immich = false
+	}
+	return sel
+}
+
+// Advice returns warnings about running the selection on this machine
+func (s ServiceSelection) Advice(c Capacity) []string {
+	var advice []string
+	var ram, free uint64
+	for _, need := range serviceNeeds {
+		if !need.Enabled(s) {
+			continue
+		}
+		ram += need.RAM
+		free += need.Free
+		if c.DataFree > 0 && need.Free > c.DataFree {
+			advice = append(advice, fmt.Sprintf("%s needs about %s free for %s; the data disk has %s",
+				need.Name, gigabytes(need.Free), need.Why, gigabytes(c.DataFree)))
+		}
+	}
+
+	if c.TotalRAM > 0 {
+		if s.Immich && c.TotalRAM < ImmichMinRAM {
+			advice = append(advice, fmt.Sprintf("Immich needs at least %s RAM; this machine has %s", gigabytes(ImmichMinRAM), gigabytes(c.TotalRAM)))
+		} else if s.Immich && c.TotalRAM < ImmichMLRAM {
+			advice = append(advice, fmt.Sprintf("With %s RAM, turn Immich's machine learning off or use the small models (asked in Phase 4)", gigabytes(c.TotalRAM)))
+		}
+		if ram > c.TotalRAM {
+			advice = append(advice, fmt.Sprintf("The selected services need about %s RAM; this machine has %s", gigabytes(ram), gigabytes(c.TotalRAM)))
+		}
+	}
+	if c.DataFree > 0 && free > c.DataFree && len(advice) == 0 {
+		advice = append(advice, fmt.Sprintf("The selected services need about %s free together; the data disk has %s", gigabytes(free), gigabytes(c.DataFree)))
+	}
+	return advice
+}
+
+// gigabytes formats bytes as whole GB, rounded
+func gigabytes(b uint64) string {
+	return fmt.Sprintf("%dGB", (b+gib/2)/gib)
+}
@@ -0,0 +1,40 @@
+package directory
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRecommendedSelection(t *testing.T) {
+	if sel := RecommendedSelection(Capacity{TotalRAM: 2 * gib}); sel.Immich || !sel.Nextcloud {
+		t.Errorf("2GB RAM should leave out Immich only, got %+v", sel)
+	}
+	if sel := RecommendedSelection(Capacity{}); sel != DefaultServiceSelection() {
+		t.Errorf("Unknown capacity should keep the defaults, got %+v", sel)
+	}
+}
+
+func TestServiceSelection_Advice(t *testing.T) {
+	sel := DefaultServiceSelection()
+	if advice := sel.Advice(Capacity{TotalRAM: 16 * gib, DataFree: 2000 * gib}); len(advice) != 0 {
+		t.Errorf("A roomy machine needs no warnings, got %v", advice)
+	}
+	if advice := sel.Advice(Capacity{}); len(advice) != 0 {
+		t.Errorf("Unknown capacity should not warn, got %v", advice)
+	}
+
+	advice := sel.Advice(Capacity{TotalRAM: 6 * gib})
+	if len(advice) != 1 || !strings.Contains(advice[0], "machine learning") {
+		t.Errorf("6GB RAM should suggest turning ML down, got %v", advice)
+	}
+
+	sel.Media = true
+	advice = sel.Advice(Capacity{TotalRAM: 16 * gib, DataFree: 10 * gib})
+	found := false
+	for _, a := range advice {
+		found = found || strings.Contains(a, "Jellyfin's transcode cache")
+	}
+	if !found {
+		t.Errorf("Media on a nearly full disk should warn about the transcode cache, got %v", advice)
+	}
+}
@@ -3,12 +3,20 @@
 package directory
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"os/exec"
 	"os/user"
 	"path/filepath"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/madhav/servctl/internal/ops"
+	"github.com/madhav/servctl/internal/paths"
 )
 
 // DirectoryType represents the category of directory
@@ -36,7 +44,8 @@ type DirectorySpec struct {
 	Type        DirectoryType // User or Data space
 	Service     string        // Which service owns this (e.g., "immich", "nextcloud")
 	Description string        // Human-readable description
-	Mode        os.FileMode   // Permissions (e.g., 0755)
+	Mode        os.FileMode   // Permissions, from PermissionMatrix
+	Owner       DirOwner      // Expected owner, from PermissionMatrix
 }
 
 // DirectoryResult represents the outcome of creating a directory
@@ -83,166 +92,87 @@ func GetCurrentUserInfo() (*PermissionInfo, error) {
 func GetUserSpaceDirectories(homeDir string) []DirectorySpec {
 	infraRoot := filepath.Join(homeDir, "infra")
 
-	return []DirectorySpec{
+	return applyMatrix([]DirectorySpec{
 		{
 			Path:        infraRoot,
 			Type:        DirTypeUserSpace,
 			Service:     "core",
 			Description: "Root directory for servctl infrastructure",
-			Mode:        0755,
 		},
 		{
 			Path:        filepath.Join(infraRoot, "scripts"),
 			Type:        DirTypeUserSpace,
 			Service:     "core",
 			Description: "Maintenance and backup scripts",
-			Mode:        0755,
 		},
 		{
 			Path:        filepath.Join(infraRoot, "logs"),
 			Type:        DirTypeUserSpace,
 			Service:     "core",
 			Description: "Centralized logging directory",
-			Mode:        0755,
 		},
 		{
 			Path:        filepath.Join(infraRoot, "compose"),
 			Type:        DirTypeUserSpace,
 			Service:     "docker",
 			Description: "Docker Compose files",
-			Mode:        0755,
 		},
 		{
 			Path:        filepath.Join(infraRoot, "config"),
 			Type:        DirTypeUserSpace,
 			Service:     "core",
 			Description: "Service configuration files",
-			Mode:        0755,
 		},
 		{
 			Path:        filepath.Join(infraRoot, "backups"),
 			Type:        DirTypeUserSpace,
 			Service:     "backup",
 			Description: "Local backup staging area",
-			Mode:        0755,
 		},
-	}
+	}, homeDir, "")
 }
 
+// DefaultDataServices are the registry services created by a default setup
+var DefaultDataServices = []string{"core", "immich", "nextcloud", "databases"}
+
 // GetDataSpaceDirectories returns the list of data-space directories to create
 func GetDataSpaceDirectories(dataRoot string) []DirectorySpec {
 	if dataRoot == "" {
 		dataRoot = "/mnt/data"
 	}
+	return GetServiceDataDirectories(dataRoot, DefaultDataServices...)
+}
 
-	return []DirectorySpec{
-		// Root data directory
-		{
-			Path:        dataRoot,
-			Type:        DirTypeDataSpace,
-			Service:     "core",
-			Description: "Root data directory for all services",
-			Mode:        0755,
-		},
-
-		// Immich (Photo Gallery) directories
-		{
-			Path:        filepath.Join(dataRoot, "gallery"),
-			Type:        DirTypeDataSpace,
-			Service:     "immich",
-			Description: "Immich photo gallery root",
-			Mode:        0755,
-		},
-		{
-			Path:        filepath.Join(dataRoot, "gallery", "library"),
-			Type:        DirTypeDataSpace,
-			Service:     "immich",
-			Description: "Immich photo library storage",
-			Mode:        0755,
-		},
-		{
-			Path:        filepath.Join(dataRoot, "gallery", "upload"),
-			Type:        DirTypeDataSpace,
-			Service:     "immich",
-			Description: "Immich upload staging area",
-			Mode:        0755,
-		},
-		{
-			Path:        filepath.Join(dataRoot, "gallery", "profile"),
-			Type:        DirTypeDataSpace,
-			Service:     "immich",
-			Description: "Immich user profiles",
-			Mode:        0755,
-		},
-		{
-			Path:        filepath.Join(dataRoot, "gallery", "video"),
-			Type:        DirTypeDataSpace,
-			Service:     "immich",
-			Description: "Immich video transcodes",
-			Mode:        0755,
-		},
-		{
-			Path:        filepath.Join(dataRoot, "gallery", "thumbs"),
-			Type:        DirTypeDataSpace,
-			Service:     "immich",
-			Description: "Immich thumbnail cache",
-			Mode:        0755,
-		},
-
-		// Nextcloud directories
-		{
-			Path:        filepath.Join(dataRoot, "cloud"),
-			Type:        DirTypeDataSpace,
-			Service:     "nextcloud",
-			Description: "Nextcloud root directory",
-			Mode:        0755,
-		},
-		{
-			Path:        filepath.Join(dataRoot, "cloud", "data"),
-			Type:        DirTypeDataSpace,
-			Service:     "nextcloud",
-			Description: "Nextcloud user data storage",
-			Mode:        0755,
-		},
-		{
-			Path:        filepath.Join(dataRoot, "cloud", "config"),
-			Type:        DirTypeDataSpace,
-			Service:     "nextcloud",
-			Description: "Nextcloud configuration",
-			Mode:        0755,
-		},
+// GetServiceDataDirectories returns the registered data directories of the
+// given services, in registry order
+func GetServiceDataDirectories(dataRoot string, services ...string) []DirectorySpec {
+	var specs []DirectorySpec
+	for _, service := range services {
+		for _, loc := range paths.ForService(service) {
+			specs = append(specs, dataSpec(dataRoot, loc))
+		}
+	}
+	return applyMatrix(specs, "", cleanPath(dataRoot))
+}
 
-		// Database directories (isolated per service)
-		{
-			Path:        filepath.Join(dataRoot, "databases"),
-			Type:        DirTypeDataSpace,
-			Service:     "database",
-			Description: "Database storage root",
-			Mode:        0755,
-		},
-		{
-			Path:        filepath.Join(dataRoot, "databases", "immich-postgres"),
-			Type:        DirTypeDataSpace,
-			Service:     "immich",
-			Description: "Immich PostgreSQL data",
-			Mode:        0755,
-		},
-		{
-			Path:        filepath.Join(dataRoot, "databases", "nextcloud-mariadb"),
-			Type:        DirTypeDataSpace,
-			Service:     "nextcloud",
-			Description: "Nextcloud MariaDB data",
-			Mode:        0755,
-		},
+// GetPathDirectories returns the data directories for registry keys and
+// their registered parents, e.g. everything a compose file mounts
+func GetPathDirectories(dataRoot string, keys []string) []DirectorySpec {
+	var specs []DirectorySpec
+	for _, key := range paths.WithParents(keys) {
+		loc, _ := paths.Lookup(key)
+		specs = append(specs, dataSpec(dataRoot, loc))
+	}
+	return applyMatrix(specs, "", cleanPath(dataRoot))
+}
 
-		// Redis/Cache
-		{
-			Path:        filepath.Join(dataRoot, "cache"),
-			Type:        DirTypeDataSpace,
-			Service:     "redis",
-			Description: "Redis/Valkey cache storage",
-			Mode:        0755,
-		},
+// dataSpec builds the spec for a registered data location
+func dataSpec(dataRoot string, loc paths.Location) DirectorySpec {
+	return DirectorySpec{
+		Path:        ServiceRoots.Join(cleanPath(dataRoot), loc.Key),
+		Type:        DirTypeDataSpace,
+		Service:     loc.Service,
+		Description: loc.Description,
 	}
 }
 
@@ -254,8 +184,95 @@ func GetAllDirectories(homeDir, dataRoot string) []DirectorySpec {
 	return all
 }
 
-// CreateDirectory creates a single directory with the specified permissions
-func CreateDirectory(spec DirectorySpec, dryRun bool) DirectoryResult {
+// GetOwnerInfo returns who should own servctl's directories: the user who
+// ran sudo when running under sudo, otherwise the current user
+func GetOwnerInfo() (*PermissionInfo, error) {
+	info, err := GetCurrentUserInfo()
+	if err != nil {
+		return nil, err
+	}
+	if info.UID != 0 || os.Getenv("SUDO_UID") == "" {
+		return info, nil
+	}
+
+	sudoUser, err := user.LookupId(os.Getenv("SUDO_UID"))
+	if err != nil {
+		return info, nil
+	}
+	uid, _ := strconv.Atoi(sudoUser.Uid)
+	gid, _ := strconv.Atoi(sudoUser.Gid)
+	return &PermissionInfo{UID: uid, GID: gid, Username: sudoUser.Username, HomeDir: sudoUser.HomeDir}, nil
+}
+
+// missingComponents returns path and any missing parents, outermost first
+func missingComponents(path string) []string {
+	var missing []string
+	for p := filepath.Clean(path); ; p = filepath.Dir(p) {
+		if _, err := os.Lstat(p); err == nil {
+			break
+		}
+		missing = append([]string{p}, missing...)
+		if p == filepath.Dir(p) {
+			break
+		}
+	}
+	return missing
+}
+
+// ownedDirOp is the operation that creates one directory with makeOwnedDir
+func ownedDirOp(path string, mode os.FileMode, perm *PermissionInfo) ops.Operation {
+	description := fmt.Sprintf("create directory %s (mode %04o", path, mode)
+	if perm != nil {
+		description += ", owner " + perm.Username
+	}
+	return ops.Func{
+		Description: description + ")",
+		Fn:          func() error { return makeOwnedDir(path, mode, perm) },
+	}
+}
+
+// makeOwnedDir creates one directory with the given mode and owner. sudo is
+// used only when the parent is not writable or the owner is someone else.
+func makeOwnedDir(path string, mode os.FileMode, perm *PermissionInfo) error {
+	err := os.Mkdir(path, mode)
+	if errors.Is(err, fs.ErrPermission) {
+		args := []string{"install", "-d", "-m", fmt.Sprintf("%o", mode)}
+		if perm != nil {
+			args = append(args, "-o", strconv.Itoa(perm.UID), "-g", strconv.Itoa(perm.GID))
+		}
+		if output, err := exec.Command("sudo", append(args, path)...).CombinedOutput(); err != nil {
+			return fmt.Errorf("sudo install -d %s: %s", path, strings.TrimSpace(string(output)))
+		}
+		return nil
+	}
+	if err != nil && !errors.Is(err, fs.ErrExist) {
+		return err
+	}
+
+	// Mkdir applies the umask; set the exact mode
+	if err := os.Chmod(path, mode); err != nil {
+		return err
+	}
+	if perm == nil || (perm.UID == os.Getuid() && perm.GID == os.Getgid()) {
+		return nil
+	}
+	if err := os.Lchown(path, perm.UID, perm.GID); errors.Is(err, fs.ErrPermission) {
+		owner := fmt.Sprintf("%d:%d", perm.UID, perm.GID)
+		if output, err := exec.Command("sudo", "chown", owner, path).CombinedOutput(); err != nil {
+			return fmt.Errorf("sudo chown %s: %s", path, strings.TrimSpace(string(output)))
+		}
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+// CreateDirectory creates a directory, and any missing parents, with the
+// spec's mode and owned by perm (nil keeps the creating user), or by the
+// database user when the matrix says so. Only directories it creates are
+// chowned; an existing directory and everything in it are left exactly as
+// they are.
+func CreateDirectory(spec DirectorySpec, perm *PermissionInfo, dryRun bool) DirectoryResult {
 	result := DirectoryResult{Spec: spec}
 
 	// Check if directory already exists
@@ -270,14 +287,17 @@ func CreateDirectory(spec DirectorySpec, dryRun bool) DirectoryResult {
 		return result
 	}
 
-	if dryRun {
-		fmt.Printf("[DRY RUN] Would create directory: %s (%s)\n", spec.Path, spec.Description)
-		result.Created = true
-		return result
+	// Missing parents belong to perm; only the spec's own directory takes
+	// the matrix owner
+	var steps []ops.Operation
+	for _, dir := range missingComponents(spec.Path) {
+		owner := perm
+		if dir == filepath.Clean(spec.Path) {
+			owner = OwnerFor(spec, perm)
+		}
+		steps = append(steps, ownedDirOp(dir, spec.Mode, owner))
 	}
-
-	// Create the directory with all parents
-	if err := os.MkdirAll(spec.Path, spec.Mode); err != nil {
+	if err := ops.Execute(dryRun, steps...); err != nil {
 		result.Error = fmt.Errorf("failed to create directory %s: %w", spec.Path, err)
 		return result
 	}
@@ -286,71 +306,82 @@ func CreateDirectory(spec DirectorySpec, dryRun bool) DirectoryResult {
 	return result
 }
 
-// CreateAllDirectories creates all directories for servctl
-func CreateAllDirectories(homeDir, dataRoot string, dryRun bool) []DirectoryResult {
-	specs := GetAllDirectories(homeDir, dataRoot)
-	results := make([]DirectoryResult, 0, len(specs))
-
-	for _, spec := range specs {
-		result := CreateDirectory(spec, dryRun)
-		results = append(results, result)
+// CreateDirectories creates specs concurrently and returns results in the
+// same order. Shallower paths are created first, so a parent is never
+// reported as pre-existing just because a child's MkdirAll made it. Dry
+// runs stay sequential so their output reads in order.
+func CreateDirectories(specs []DirectorySpec, perm *PermissionInfo, dryRun bool) []DirectoryResult {
+	results := make([]DirectoryResult, len(specs))
+	if dryRun {
+		for i, spec := range specs {
+			results[i] = CreateDirectory(spec, perm, dryRun)
+		}
+		return results
 	}
 
-	return results
-}
-
-// SetPermissions sets ownership and permissions on the data directory
-func SetPermissions(dataRoot string, perm *PermissionInfo, dryRun bool) error {
-	if dataRoot == "" {
-		dataRoot = "/mnt/data"
+	byDepth := make(map[int][]int)
+	var depths []int
+	for i, spec := range specs {
+		depth := strings.Count(filepath.Clean(spec.Path), string(filepath.Separator))
+		if _, ok := byDepth[depth]; !ok {
+			depths = append(depths, depth)
+		}
+		byDepth[depth] = append(byDepth[depth], i)
 	}
-
-	if dryRun {
-		fmt.Printf("[DRY RUN] Would set ownership of %s to %d:%d (%s)\n",
-			dataRoot, perm.UID, perm.GID, perm.Username)
-		return nil
+	sort.Ints(depths)
+
+	for _, depth := range depths {
+		indexes := make(chan int)
+		var wg sync.WaitGroup
+		for w := 0; w < PermissionWorkers; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range indexes {
+					results[i] = CreateDirectory(specs[i], perm, dryRun)
+				}
+			}()
+		}
+		for _, i := range byDepth[depth] {
+			indexes <- i
+		}
+		close(indexes)
+		wg.Wait()
 	}
 
-	// Use chown command for recursive ownership change
-	// We use the command because os.Chown doesn't do recursive
-	cmd := exec.Command("chown", "-R",
-		fmt.Sprintf("%d:%d", perm.UID, perm.GID),
-		dataRoot)
-
-	if output, err := cmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("failed to set ownership: %s: %w", string(output), err)
-	}
+	return results
+}
 
-	fmt.Printf("Set ownership of %s to %d:%d (%s)\n",
-		dataRoot, perm.UID, perm.GID, perm.Username)
-	return nil
+// CreateAllDirectories creates all directories for servctl
+func CreateAllDirectories(homeDir, dataRoot string, perm *PermissionInfo, dryRun bool) []DirectoryResult {
+	return CreateDirectories(GetAllDirectories(homeDir, dataRoot), perm, dryRun)
 }
 
-// SetDirectoryPermissions sets the correct file mode on directories
-func SetDirectoryPermissions(dataRoot string, dryRun bool) error {
+// SetDirectoryPermissions sets directories to 755 and files to 644,
+// changing only entries that differ
+func SetDirectoryPermissions(dataRoot string, dryRun bool) (PermissionStats, error) {
 	if dataRoot == "" {
 		dataRoot = "/mnt/data"
 	}
 
-	if dryRun {
-		fmt.Printf("[DRY RUN] Would set directory permissions (755) on %s\n", dataRoot)
-		return nil
+	var stats PermissionStats
+	apply := ops.Func{
+		Description: fmt.Sprintf("set permissions under %s (dirs: 755, files: 644)", dataRoot),
+		Fn: func() (err error) {
+			stats, err = ApplyPermissions(dataRoot, DefaultPermissionOptions(), false)
+			return err
+		},
 	}
-
-	// Set directories to 755
-	cmd := exec.Command("find", dataRoot, "-type", "d", "-exec", "chmod", "755", "{}", ";")
-	if output, err := cmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("failed to set directory permissions: %s: %w", string(output), err)
+	if err := ops.Execute(dryRun, apply); err != nil {
+		return stats, fmt.Errorf("failed to set permissions: %w", err)
 	}
-
-	// Set files to 644
-	cmd = exec.Command("find", dataRoot, "-type", "f", "-exec", "chmod", "644", "{}", ";")
-	if output, err := cmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("failed to set file permissions: %s: %w", string(output), err)
+	if dryRun {
+		return stats, nil
 	}
 
-	fmt.Printf("Set permissions on %s (dirs: 755, files: 644)\n", dataRoot)
-	return nil
+	fmt.Printf("Set permissions on %s (dirs: 755, files: 644): %d of %d entries changed\n",
+		dataRoot, stats.ModeChanged, stats.Scanned)
+	return stats, nil
 }
 
 // CountByService returns a map of service -> directory count
@@ -198,7 +198,7 @@ func TestCreateDirectoryDryRun(t *testing.T) {
 		Mode:        0755,
 	}
 
-	result := CreateDirectory(spec, true)
+	result := CreateDirectory(spec, nil, true)
 
 	if result.Error != nil {
 		t.Errorf("CreateDirectory() dry run error: %v", result.Error)
@@ -230,7 +230,7 @@ func TestCreateDirectoryActual(t *testing.T) {
 		Mode:        0755,
 	}
 
-	result := CreateDirectory(spec, false)
+	result := CreateDirectory(spec, nil, false)
 
 	if result.Error != nil {
 		t.Errorf("CreateDirectory() error: %v", result.Error)
@@ -263,7 +263,7 @@ func TestCreateDirectoryAlreadyExists(t *testing.T) {
 		Mode:        0755,
 	}
 
-	result := CreateDirectory(spec, false)
+	result := CreateDirectory(spec, nil, false)
 
 	if result.Error != nil {
 		t.Errorf("CreateDirectory() error for existing dir: %v", result.Error)
@@ -370,23 +370,8 @@ func TestGetCurrentUserInfo(t *testing.T) {
 		info.Username, info.UID, info.GID, info.HomeDir)
 }
 
-func TestSetPermissionsDryRun(t *testing.T) {
-	info := &PermissionInfo{
-		UID:      1000,
-		GID:      1000,
-		Username: "testuser",
-		HomeDir:  "/home/testuser",
-	}
-
-	err := SetPermissions("/mnt/data", info, true)
-
-	if err != nil {
-		t.Errorf("SetPermissions() dry run error: %v", err)
-	}
-}
-
 func TestSetDirectoryPermissionsDryRun(t *testing.T) {
-	err := SetDirectoryPermissions("/mnt/data", true)
+	_, err := SetDirectoryPermissions("/mnt/data", true)
 
 	if err != nil {
 		t.Errorf("SetDirectoryPermissions() dry run error: %v", err)
@@ -0,0 +1,73 @@
+package directory
+
+// Optional layout module names
+const (
+	LayoutMedia     = "media"
+	LayoutDownloads = "downloads"
+	LayoutBooks     = "books"
+)
+
+// LayoutModule is an optional group of data directories for one kind of
+// content, created when a service that consumes it is set up. Its
+// directories are the path registry entries of the same service name.
+type LayoutModule struct {
+	Name        string   // Registry service of its directories
+	Description string   // Shown in the service selection prompt
+	Consumers   []string // Services that read or write these directories
+}
+
+// LayoutModules are the optional layouts, shared the way arr-stack setups
+// expect: downloaders write to downloads/, the *arr apps move finished
+// files into media/ or books/, and the players read from there
+var LayoutModules = []LayoutModule{
+	{
+		Name:        LayoutMedia,
+		Description: "Movie, TV and music libraries",
+		Consumers:   []string{"jellyfin", "plex", "radarr", "sonarr", "lidarr"},
+	},
+	{
+		Name:        LayoutDownloads,
+		Description: "Download client staging",
+		Consumers:   []string{"qbittorrent", "sabnzbd", "radarr", "sonarr", "lidarr", "readarr"},
+	},
+	{
+		Name:        LayoutBooks,
+		Description: "E-book and audiobook library",
+		Consumers:   []string{"calibre-web", "audiobookshelf", "kavita", "readarr"},
+	},
+}
+
+// FindLayout returns the layout module with the given name
+func FindLayout(name string) (LayoutModule, bool) {
+	for _, m := range LayoutModules {
+		if m.Name == name {
+			return m, true
+		}
+	}
+	return LayoutModule{}, false
+}
+
+// LayoutsForServices returns the modules consumed by any of services, in
+// LayoutModules order
+func LayoutsForServices(services []string) []LayoutModule {
+	wanted := make(map[string]bool)
+	for _, s := range services {
+		wanted[s] = true
+	}
+
+	var modules []LayoutModule
+	for _, m := range LayoutModules {
+		for _, c := range m.Consumers {
+			if wanted[c] {
+				modules = append(modules, m)
+				break
+			}
+		}
+	}
+	return modules
+}
+
+// Specs returns the module's directories under dataRoot
+func (m LayoutModule) Specs(dataRoot string) []DirectorySpec {
+	return GetServiceDataDirectories(dataRoot, m.Name)
+}
@@ -0,0 +1,55 @@
+package directory
+
+import "testing"
+
+func TestLayoutsForServices(t *testing.T) {
+	tests := []struct {
+		services []string
+		want     []string
+	}{
+		{[]string{"jellyfin"}, []string{LayoutMedia}},
+		{[]string{"qbittorrent"}, []string{LayoutDownloads}},
+		{[]string{"sonarr"}, []string{LayoutMedia, LayoutDownloads}},
+		{[]string{"readarr"}, []string{LayoutDownloads, LayoutBooks}},
+		{[]string{"immich", "nextcloud"}, nil},
+	}
+
+	for _, tt := range tests {
+		var got []string
+		for _, m := range LayoutsForServices(tt.services) {
+			got = append(got, m.Name)
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("LayoutsForServices(%v) = %v, want %v", tt.services, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("LayoutsForServices(%v) = %v, want %v", tt.services, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestLayoutModule_Specs(t *testing.T) {
+	module, ok := FindLayout(LayoutDownloads)
+	if !ok {
+		t.Fatal("downloads layout not found")
+	}
+	specs := module.Specs("/srv/data/")
+	if len(specs) != 3 {
+		t.Fatalf("got %d specs, want 3", len(specs))
+	}
+	if specs[0].Path != "/srv/data/downloads" || specs[0].Mode != 0755 {
+		t.Errorf("root spec = %s %o, want /srv/data/downloads 755", specs[0].Path, specs[0].Mode)
+	}
+	if specs[2].Path != "/srv/data/downloads/incomplete" || specs[2].Mode != 0770 {
+		t.Errorf("incomplete spec = %s %o, want 770", specs[2].Path, specs[2].Mode)
+	}
+	for _, s := range specs {
+		if s.Service != LayoutDownloads || s.Type != DirTypeDataSpace {
+			t.Errorf("%s has service %q type %s", s.Path, s.Service, s.Type)
+		}
+	}
+}
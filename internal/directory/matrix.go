@@ -0,0 +1,217 @@
+package directory
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+
+	"github.com/madhav/servctl/internal/paths"
+)
+
+// DatabaseUID and DatabaseGID are the IDs the postgres, mariadb and valkey
+// images run as inside their containers
+const (
+	DatabaseUID = 999
+	DatabaseGID = 999
+)
+
+// Rootless is set by main for -no-sudo setups. Rootless Docker maps
+// container users into the invoking user's subordinate ID range, so there
+// every directory stays with the user instead of the database IDs.
+var Rootless bool
+
+// ServiceRoots is set by main when the wizard moved a service's data off
+// the data root; its directories are created under that root instead
+var ServiceRoots paths.Roots
+
+// DirOwner says who a directory should belong to
+type DirOwner int
+
+const (
+	OwnerUser     DirOwner = iota // The servctl user (PUID/PGID)
+	OwnerDatabase                 // The database container user
+)
+
+func (o DirOwner) String() string {
+	if o == OwnerDatabase {
+		return "database"
+	}
+	return "user"
+}
+
+// PermissionRule is the expected mode and owner for directories matching
+// Pattern, a path.Match pattern relative to the home directory (user space)
+// or the data root (data space)
+type PermissionRule struct {
+	Type    DirectoryType
+	Pattern string
+	Mode    os.FileMode
+	Owner   DirOwner
+}
+
+// PermissionMatrix is the single source of modes and owners for every
+// DirectorySpec. Databases are private to their container user, uploads are
+// group-writable for the services sharing them, and configs (which hold
+// secrets) are not world-readable. Anything unlisted gets DefaultRule.
+var PermissionMatrix = []PermissionRule{
+	{DirTypeUserSpace, "infra", 0755, OwnerUser},
+	{DirTypeUserSpace, "infra/compose", 0750, OwnerUser},
+	{DirTypeUserSpace, "infra/config", 0750, OwnerUser},
+	{DirTypeUserSpace, "infra/glances", 0750, OwnerUser},
+	{DirTypeUserSpace, "infra/backups", 0750, OwnerUser},
+
+	{DirTypeDataSpace, "databases", 0700, OwnerUser},
+	{DirTypeDataSpace, "databases/*", 0700, OwnerDatabase},
+	{DirTypeDataSpace, "cache", 0700, OwnerDatabase},
+
+	{DirTypeDataSpace, "gallery/*", 0770, OwnerUser},
+	{DirTypeDataSpace, "cloud/data", 0770, OwnerUser},
+	{DirTypeDataSpace, "cloud/config", 0750, OwnerUser},
+	{DirTypeDataSpace, "cloud/export", 0700, OwnerUser},
+
+	{DirTypeDataSpace, "media/*", 0770, OwnerUser},
+	{DirTypeDataSpace, "downloads/*", 0770, OwnerUser},
+	{DirTypeDataSpace, "books", 0770, OwnerUser},
+}
+
+// DefaultRule applies to directories the matrix does not list
+var DefaultRule = PermissionRule{Mode: 0755, Owner: OwnerUser}
+
+// LookupRule returns the matrix rule for a path of the given type, relative
+// to its root
+func LookupRule(dirType DirectoryType, rel string) PermissionRule {
+	rel = filepath.ToSlash(filepath.Clean(rel))
+	for _, rule := range PermissionMatrix {
+		if rule.Type != dirType {
+			continue
+		}
+		if ok, _ := path.Match(rule.Pattern, rel); ok {
+			return rule
+		}
+	}
+	return DefaultRule
+}
+
+// applyMatrix sets each spec's Mode and Owner from the matrix
+func applyMatrix(specs []DirectorySpec, homeDir, dataRoot string) []DirectorySpec {
+	for i, spec := range specs {
+		root := ServiceRoots.Root(spec.Service, dataRoot)
+		if spec.Type == DirTypeUserSpace {
+			root = homeDir
+		}
+		rel, err := filepath.Rel(root, spec.Path)
+		if err != nil {
+			rel = spec.Path
+		}
+		rule := LookupRule(spec.Type, rel)
+		specs[i].Mode = rule.Mode
+		specs[i].Owner = rule.Owner
+	}
+	return specs
+}
+
+// OwnerFor returns who should own a spec's directory. A nil owner means
+// "whoever creates it" and is passed through.
+func OwnerFor(spec DirectorySpec, owner *PermissionInfo) *PermissionInfo {
+	if owner == nil || spec.Owner != OwnerDatabase || Rootless {
+		return owner
+	}
+	return &PermissionInfo{UID: DatabaseUID, GID: DatabaseGID, Username: fmt.Sprintf("database (%d)", DatabaseUID)}
+}
+
+// Drift is a directory whose mode or owner differs from the matrix
+type Drift struct {
+	Spec     DirectorySpec
+	Mode     os.FileMode
+	UID, GID int
+	Want     *PermissionInfo
+}
+
+// ModeDrift reports whether the mode is wrong
+func (d Drift) ModeDrift() bool {
+	return d.Mode != d.Spec.Mode
+}
+
+// OwnerDrift reports whether the owner is wrong
+func (d Drift) OwnerDrift() bool {
+	return d.Want != nil && (d.UID != d.Want.UID || d.GID != d.Want.GID)
+}
+
+// DriftReport is the result of comparing directories against the matrix
+type DriftReport struct {
+	Checked int
+	Missing []string
+	Drifts  []Drift
+}
+
+// CheckDrift compares each spec's directory (not its contents) with its
+// expected mode and owner. Missing directories are listed, not created.
+func CheckDrift(specs []DirectorySpec, owner *PermissionInfo) DriftReport {
+	var report DriftReport
+	for _, spec := range specs {
+		// Hot data relocated to fast storage is checked where it lives
+		if real, err := filepath.EvalSymlinks(spec.Path); err == nil {
+			spec.Path = real
+		}
+		info, err := os.Lstat(spec.Path)
+		if err != nil || !info.IsDir() {
+			report.Missing = append(report.Missing, spec.Path)
+			continue
+		}
+		report.Checked++
+
+		drift := Drift{Spec: spec, Mode: info.Mode().Perm(), UID: -1, GID: -1, Want: OwnerFor(spec, owner)}
+		if uid, gid, ok := fileOwner(info); ok {
+			drift.UID, drift.GID = uid, gid
+		}
+		if drift.ModeDrift() || drift.OwnerDrift() {
+			report.Drifts = append(report.Drifts, drift)
+		}
+	}
+	sort.Strings(report.Missing)
+	return report
+}
+
+// FixDrift restores the expected mode and owner on each drifted directory.
+// Only the directory entry itself changes; nothing inside it is touched.
+func FixDrift(drifts []Drift, dryRun bool) PermissionStats {
+	var stats PermissionStats
+	for _, d := range drifts {
+		opts := PermissionOptions{DirMode: d.Spec.Mode, UID: -1, GID: -1}
+		if d.Want != nil {
+			opts.UID, opts.GID = d.Want.UID, d.Want.GID
+		}
+
+		stats.Scanned++
+		modeChanged, ownerChanged, err := fixEntry(d.Spec.Path, opts, dryRun)
+		if modeChanged {
+			stats.ModeChanged++
+		}
+		if ownerChanged {
+			stats.OwnerChanged++
+		}
+		if err != nil {
+			stats.Failed++
+			if stats.FirstError == nil {
+				stats.FirstError = fmt.Errorf("%s: %w", d.Spec.Path, err)
+			}
+		}
+	}
+	return stats
+}
+
+// DedupSpecs drops specs whose path appeared earlier
+func DedupSpecs(specs []DirectorySpec) []DirectorySpec {
+	seen := make(map[string]bool)
+	var out []DirectorySpec
+	for _, spec := range specs {
+		p := filepath.Clean(spec.Path)
+		if !seen[p] {
+			seen[p] = true
+			out = append(out, spec)
+		}
+	}
+	return out
+}
@@ -0,0 +1,129 @@
+package directory
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLookupRule(t *testing.T) {
+	tests := []struct {
+		dirType DirectoryType
+		rel     string
+		mode    os.FileMode
+		owner   DirOwner
+	}{
+		{DirTypeDataSpace, ".", 0755, OwnerUser},
+		{DirTypeDataSpace, "databases", 0700, OwnerUser},
+		{DirTypeDataSpace, "databases/immich-postgres", 0700, OwnerDatabase},
+		{DirTypeDataSpace, "cache", 0700, OwnerDatabase},
+		{DirTypeDataSpace, "gallery/upload", 0770, OwnerUser},
+		{DirTypeDataSpace, "cloud/data", 0770, OwnerUser},
+		{DirTypeDataSpace, "cloud/config", 0750, OwnerUser},
+		{DirTypeDataSpace, "gallery", 0755, OwnerUser},
+		{DirTypeUserSpace, "infra/compose", 0750, OwnerUser},
+		{DirTypeUserSpace, "infra/scripts", 0755, OwnerUser},
+		// A user-space path never picks up a data-space rule
+		{DirTypeUserSpace, "databases/postgres", 0755, OwnerUser},
+	}
+
+	for _, tt := range tests {
+		rule := LookupRule(tt.dirType, tt.rel)
+		if rule.Mode != tt.mode || rule.Owner != tt.owner {
+			t.Errorf("LookupRule(%s, %q) = %o/%s, want %o/%s",
+				tt.dirType, tt.rel, rule.Mode, rule.Owner, tt.mode, tt.owner)
+		}
+	}
+}
+
+func TestSpecsFollowMatrix(t *testing.T) {
+	dirs := GetDirectoriesForServices(DefaultServiceSelection(), "/home/testuser", "/mnt/data")
+	want := map[string]os.FileMode{
+		"/mnt/data/databases/immich-postgres": 0700,
+		"/mnt/data/cloud/config":              0750,
+		"/mnt/data/gallery/upload":            0770,
+		"/home/testuser/infra/compose":        0750,
+	}
+	for _, d := range dirs {
+		if mode, ok := want[d.Path]; ok && d.Mode != mode {
+			t.Errorf("%s mode = %o, want %o", d.Path, d.Mode, mode)
+		}
+		if d.Path == "/mnt/data/databases/immich-postgres" && d.Owner != OwnerDatabase {
+			t.Errorf("%s owner = %s, want database", d.Path, d.Owner)
+		}
+	}
+}
+
+func TestOwnerFor(t *testing.T) {
+	user := &PermissionInfo{UID: 1000, GID: 1000, Username: "user"}
+	db := DirectorySpec{Owner: OwnerDatabase}
+
+	if got := OwnerFor(db, user); got.UID != DatabaseUID || got.GID != DatabaseGID {
+		t.Errorf("OwnerFor(database) = %d:%d, want %d:%d", got.UID, got.GID, DatabaseUID, DatabaseGID)
+	}
+	if got := OwnerFor(DirectorySpec{}, user); got != user {
+		t.Error("OwnerFor(user spec) should return the user")
+	}
+	if got := OwnerFor(db, nil); got != nil {
+		t.Error("OwnerFor with no owner should keep the creator")
+	}
+
+	Rootless = true
+	defer func() { Rootless = false }()
+	if got := OwnerFor(db, user); got != user {
+		t.Error("rootless database directories should stay with the user")
+	}
+}
+
+func TestCheckAndFixDrift(t *testing.T) {
+	root := t.TempDir()
+	good := filepath.Join(root, "good")
+	bad := filepath.Join(root, "bad")
+	for _, dir := range []string{good, bad} {
+		if err := os.Mkdir(dir, 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	os.Chmod(good, 0750)
+	os.Chmod(bad, 0777)
+	file := filepath.Join(bad, "keep.txt")
+	if err := os.WriteFile(file, []byte("x"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	specs := []DirectorySpec{
+		{Path: good, Mode: 0750},
+		{Path: bad, Mode: 0750},
+		{Path: filepath.Join(root, "missing"), Mode: 0750},
+	}
+
+	report := CheckDrift(specs, nil)
+	if report.Checked != 2 || len(report.Missing) != 1 || len(report.Drifts) != 1 {
+		t.Fatalf("report = %d checked, %d missing, %d drifted; want 2, 1, 1",
+			report.Checked, len(report.Missing), len(report.Drifts))
+	}
+	if d := report.Drifts[0]; d.Spec.Path != bad || !d.ModeDrift() || d.OwnerDrift() {
+		t.Errorf("unexpected drift %+v", d)
+	}
+
+	stats := FixDrift(report.Drifts, true)
+	if stats.ModeChanged != 1 {
+		t.Errorf("dry run ModeChanged = %d, want 1", stats.ModeChanged)
+	}
+	if info, _ := os.Stat(bad); info.Mode().Perm() != 0777 {
+		t.Error("dry run changed the directory")
+	}
+
+	if stats := FixDrift(report.Drifts, false); stats.Failed != 0 {
+		t.Fatalf("FixDrift failed: %v", stats.FirstError)
+	}
+	if info, _ := os.Stat(bad); info.Mode().Perm() != 0750 {
+		t.Errorf("mode after fix = %o, want 750", info.Mode().Perm())
+	}
+	if info, _ := os.Stat(file); info.Mode().Perm() != 0600 {
+		t.Error("FixDrift changed a file inside the directory")
+	}
+	if report := CheckDrift(specs, nil); len(report.Drifts) != 0 {
+		t.Errorf("%d drifts remain after fix", len(report.Drifts))
+	}
+}
@@ -0,0 +1,8 @@
+package directory
+
+import "io/fs"
+
+// fileOwner is unavailable on Windows, which has no numeric owners
+func fileOwner(info fs.FileInfo) (uid, gid int, ok bool) {
+	return -1, -1, false
+}
@@ -0,0 +1,174 @@
+package directory
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/madhav/servctl/internal/ops"
+)
+
+// groupNameRegex matches a name groupadd accepts by default
+var groupNameRegex = regexp.MustCompile(`^[a-z_][a-z0-9_-]{0,31}$`)
+
+// SharedGroup is a group people and containers share for the data, such
+// as "media", in place of the owner's own group
+type SharedGroup struct {
+	Name   string
+	GID    int  // -1 until Ensure has created the group
+	Exists bool // The group is already on this machine
+}
+
+// PromptOwnership asks who the containers run as (PUID/PGID) and who owns
+// the directories servctl creates. Enter keeps owner. A group other than
+// the owner's own is returned as a SharedGroup, created later by Ensure
+// when it does not exist yet.
+func PromptOwnership(reader *bufio.Reader, owner *PermissionInfo) (*PermissionInfo, *SharedGroup) {
+	chosen := *owner
+	fmt.Println("File Ownership:")
+	fmt.Printf("  Containers run as, and new directories belong to, %s (%d:%d).\n", owner.Username, owner.UID, owner.GID)
+	fmt.Println("  A shared group (e.g. \"media\") lets other people on this machine use the data too.")
+	fmt.Println()
+
+	for {
+		fmt.Printf("  User [%s]: ", owner.Username)
+		response, _ := reader.ReadString('\n')
+		response = strings.TrimSpace(response)
+		if response == "" {
+			break
+		}
+		uid, name, err := lookupUser(response)
+		if err != nil {
+			fmt.Printf("  %s\n", err)
+			continue
+		}
+		chosen.UID, chosen.Username = uid, name
+		break
+	}
+
+	var group *SharedGroup
+	for {
+		fmt.Printf("  Group [%s]: ", groupName(chosen.GID))
+		response, _ := reader.ReadString('\n')
+		response = strings.TrimSpace(response)
+		if response == "" {
+			break
+		}
+		g, err := lookupGroup(response)
+		if err != nil {
+			fmt.Printf("  %s\n", err)
+			continue
+		}
+		if g.Exists && g.GID == chosen.GID {
+			break
+		}
+		if g.Exists {
+			chosen.GID = g.GID
+		} else {
+			fmt.Printf("  Group %q does not exist; it will be created and %s added to it.\n", g.Name, chosen.Username)
+		}
+		group = g
+		break
+	}
+	fmt.Println()
+	return &chosen, group
+}
+
+// Ensure creates the group when it does not exist and adds members to it.
+// A dry run only prints the commands; the GID stays -1 for a new group.
+func (g *SharedGroup) Ensure(members []string, dryRun bool) error {
+	var commands []ops.Operation
+	if !g.Exists {
+		commands = append(commands, privileged("groupadd", g.Name))
+	}
+	for _, m := range members {
+		commands = append(commands, privileged("usermod", "-aG", g.Name, m))
+	}
+	if err := ops.Execute(dryRun, commands...); err != nil {
+		return fmt.Errorf("failed to set up group %s: %w", g.Name, err)
+	}
+	if dryRun || g.Exists {
+		return nil
+	}
+	created, err := user.LookupGroup(g.Name)
+	if err != nil {
+		return fmt.Errorf("group %s was not created: %w", g.Name, err)
+	}
+	g.GID, _ = strconv.Atoi(created.Gid)
+	g.Exists = true
+	return nil
+}
+
+// privileged runs a command through sudo when servctl is not root
+func privileged(args ...string) ops.Command {
+	if os.Geteuid() != 0 {
+		args = append([]string{"sudo"}, args...)
+	}
+	return ops.Command{Args: args}
+}
+
+// lookupUser resolves a user name or numeric UID. A UID without an account
+// is allowed: containers can run as any ID.
+func lookupUser(s string) (int, string, error) {
+	if uid, err := strconv.Atoi(s); err == nil {
+		if uid <= 0 {
+			return 0, "", fmt.Errorf("containers should not run as root")
+		}
+		if u, err := user.LookupId(s); err == nil {
+			return uid, u.Username, nil
+		}
+		return uid, s, nil
+	}
+	u, err := user.Lookup(s)
+	if err != nil {
+		return 0, "", fmt.Errorf("no user %q on this machine", s)
+	}
+	uid, _ := strconv.Atoi(u.Uid)
+	if uid == 0 {
+		return 0, "", fmt.Errorf("containers should not run as root")
+	}
+	return uid, u.Username, nil
+}
+
+// lookupGroup resolves a group name or numeric GID. An unknown name is
+// returned as a group to create.
+func lookupGroup(s string) (*SharedGroup, error) {
+	if gid, err := strconv.Atoi(s); err == nil {
+		if gid <= 0 {
+			return nil, fmt.Errorf("the data should not belong to the root group")
+		}
+		g, err := user.LookupGroupId(s)
+		if err != nil {
+			return nil, fmt.Errorf("no group with GID %d; give a name to create one", gid)
+		}
+		return &SharedGroup{Name: g.Name, GID: gid, Exists: true}, nil
+	}
+	g, err := user.LookupGroup(s)
+	var unknown user.UnknownGroupError
+	switch {
+	case err == nil:
+		gid, _ := strconv.Atoi(g.Gid)
+		if gid == 0 {
+			return nil, fmt.Errorf("the data should not belong to the root group")
+		}
+		return &SharedGroup{Name: g.Name, GID: gid, Exists: true}, nil
+	case !errors.As(err, &unknown):
+		return nil, fmt.Errorf("cannot look up group %q: %w", s, err)
+	case !groupNameRegex.MatchString(s):
+		return nil, fmt.Errorf("%q is not a valid group name (lowercase letters, digits, '-' and '_')", s)
+	}
+	return &SharedGroup{Name: s, GID: -1}, nil
+}
+
+// groupName returns the name of a GID, or the number when it has none
+func groupName(gid int) string {
+	if g, err := user.LookupGroupId(strconv.Itoa(gid)); err == nil {
+		return g.Name
+	}
+	return strconv.Itoa(gid)
+}
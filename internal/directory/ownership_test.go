@@ -0,0 +1,43 @@
+package directory
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+func TestPromptOwnership_Defaults(t *testing.T) {
+	owner := &PermissionInfo{UID: 1000, GID: 1000, Username: "alice"}
+	chosen, group := PromptOwnership(bufio.NewReader(strings.NewReader("\n\n")), owner)
+	if group != nil || chosen.UID != 1000 || chosen.GID != 1000 {
+		t.Errorf("Enter should keep the owner, got %+v %+v", chosen, group)
+	}
+}
+
+func TestPromptOwnership_NewGroup(t *testing.T) {
+	owner := &PermissionInfo{UID: 1000, GID: 1000, Username: "alice"}
+	// Root and an invalid name are asked again
+	input := "\nroot\nNot A Group\nservctl-test-media\n"
+	chosen, group := PromptOwnership(bufio.NewReader(strings.NewReader(input)), owner)
+	if group == nil || group.Name != "servctl-test-media" || group.Exists || group.GID != -1 {
+		t.Fatalf("Expected a group to create, got %+v", group)
+	}
+	if chosen.GID != 1000 {
+		t.Errorf("The GID is only known once the group exists, got %d", chosen.GID)
+	}
+	if owner.GID != 1000 {
+		t.Error("PromptOwnership should not change the owner it is given")
+	}
+}
+
+func TestLookupUser(t *testing.T) {
+	if _, _, err := lookupUser("root"); err == nil {
+		t.Error("Containers should not run as root")
+	}
+	if uid, name, err := lookupUser("4711"); err != nil || uid != 4711 || name == "" {
+		t.Errorf("A bare UID should be accepted, got %d %q %v", uid, name, err)
+	}
+	if _, _, err := lookupUser("no-such-user-servctl"); err == nil {
+		t.Error("An unknown user name should be refused")
+	}
+}
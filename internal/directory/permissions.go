@@ -0,0 +1,155 @@
+package directory
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// PermissionWorkers is how many entries are checked and fixed at once
+const PermissionWorkers = 8
+
+// PermissionOptions describes the modes and ownership a tree should have.
+// A UID or GID of -1 leaves that part of ownership alone.
+type PermissionOptions struct {
+	DirMode  os.FileMode
+	FileMode os.FileMode
+	UID      int
+	GID      int
+}
+
+// DefaultPermissionOptions returns 755 for directories and 644 for files,
+// without touching ownership
+func DefaultPermissionOptions() PermissionOptions {
+	return PermissionOptions{DirMode: 0755, FileMode: 0644, UID: -1, GID: -1}
+}
+
+// PermissionStats counts what a permission pass looked at and changed
+type PermissionStats struct {
+	Scanned      int
+	ModeChanged  int
+	OwnerChanged int
+	Failed       int
+	FirstError   error
+}
+
+// Changed returns how many entries needed a mode or owner change
+func (s PermissionStats) Changed() int {
+	return s.ModeChanged + s.OwnerChanged
+}
+
+// fixEntry brings one entry in line with opts. Symlinks are skipped so a
+// link can never redirect a change outside the tree.
+func fixEntry(path string, opts PermissionOptions, dryRun bool) (modeChanged, ownerChanged bool, err error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return false, false, err
+	}
+
+	var want os.FileMode
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		return false, false, nil
+	case info.IsDir():
+		want = opts.DirMode
+	case info.Mode().IsRegular():
+		want = opts.FileMode
+	default:
+		return false, false, nil // Sockets, devices and pipes keep their modes
+	}
+
+	if want != 0 && info.Mode().Perm() != want {
+		modeChanged = true
+		if !dryRun {
+			if err := os.Chmod(path, want); err != nil {
+				return false, false, err
+			}
+		}
+	}
+
+	if curUID, curGID, ok := fileOwner(info); ok {
+		uid, gid := opts.UID, opts.GID
+		if (uid >= 0 && curUID != uid) || (gid >= 0 && curGID != gid) {
+			ownerChanged = true
+			if !dryRun {
+				if err := os.Lchown(path, uid, gid); err != nil {
+					return modeChanged, false, err
+				}
+			}
+		}
+	}
+
+	return modeChanged, ownerChanged, nil
+}
+
+// ApplyPermissions walks root and fixes modes and ownership concurrently,
+// skipping entries that are already correct. With dryRun nothing changes
+// but the returned counts show what would.
+func ApplyPermissions(root string, opts PermissionOptions, dryRun bool) (PermissionStats, error) {
+	var stats PermissionStats
+	if _, err := os.Stat(root); err != nil {
+		return stats, err
+	}
+
+	var mu sync.Mutex
+	record := func(modeChanged, ownerChanged bool, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		stats.Scanned++
+		if modeChanged {
+			stats.ModeChanged++
+		}
+		if ownerChanged {
+			stats.OwnerChanged++
+		}
+		if err != nil {
+			stats.Failed++
+			if stats.FirstError == nil {
+				stats.FirstError = err
+			}
+		}
+	}
+
+	paths := make(chan string, PermissionWorkers*4)
+	var wg sync.WaitGroup
+	for i := 0; i < PermissionWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range paths {
+				record(fixEntry(path, opts, dryRun))
+			}
+		}()
+	}
+
+	// A directory is fixed before its children are read, so a directory
+	// that was not traversable becomes traversable
+	walkErr := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			record(false, false, err)
+			if d != nil && d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			record(fixEntry(path, opts, dryRun))
+			return nil
+		}
+		paths <- path
+		return nil
+	})
+
+	close(paths)
+	wg.Wait()
+
+	if walkErr != nil {
+		return stats, walkErr
+	}
+	if stats.FirstError != nil {
+		return stats, fmt.Errorf("%d entries could not be fixed, first: %w", stats.Failed, stats.FirstError)
+	}
+	return stats, nil
+}
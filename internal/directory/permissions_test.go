@@ -0,0 +1,146 @@
+package directory
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// makeTree creates root/a/b with files at each level, all with wrong modes
+func makeTree(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	dir := filepath.Join(root, "a", "b")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []string{"root.txt", "a/one.txt", "a/b/two.txt"} {
+		if err := os.WriteFile(filepath.Join(root, f), []byte("x"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	os.Chmod(root, 0700)
+	os.Chmod(filepath.Join(root, "a"), 0700)
+	os.Symlink("/etc/passwd", filepath.Join(root, "link"))
+	return root
+}
+
+func TestApplyPermissions(t *testing.T) {
+	root := makeTree(t)
+	opts := DefaultPermissionOptions()
+
+	// Dry run counts but does not change anything
+	stats, err := ApplyPermissions(root, opts, true)
+	if err != nil {
+		t.Fatalf("dry run error: %v", err)
+	}
+	if stats.ModeChanged != 6 { // Three directories and three files; the symlink is skipped
+		t.Errorf("dry run ModeChanged = %d, want 6", stats.ModeChanged)
+	}
+	if info, _ := os.Stat(filepath.Join(root, "a", "b", "two.txt")); info.Mode().Perm() != 0600 {
+		t.Error("dry run changed a file mode")
+	}
+
+	stats, err = ApplyPermissions(root, opts, false)
+	if err != nil {
+		t.Fatalf("ApplyPermissions() error: %v", err)
+	}
+	if stats.Scanned != 7 {
+		t.Errorf("Scanned = %d, want 7", stats.Scanned)
+	}
+	for path, want := range map[string]os.FileMode{
+		"a":           0755,
+		"a/b":         0755,
+		"a/b/two.txt": 0644,
+		"root.txt":    0644,
+	} {
+		info, _ := os.Stat(filepath.Join(root, path))
+		if info.Mode().Perm() != want {
+			t.Errorf("%s mode = %o, want %o", path, info.Mode().Perm(), want)
+		}
+	}
+
+	// Already-correct entries are left alone
+	stats, err = ApplyPermissions(root, opts, false)
+	if err != nil {
+		t.Fatalf("second pass error: %v", err)
+	}
+	if stats.Changed() != 0 {
+		t.Errorf("second pass changed %d entries, want 0", stats.Changed())
+	}
+}
+
+func TestApplyPermissions_Ownership(t *testing.T) {
+	root := makeTree(t)
+	info, err := GetCurrentUserInfo()
+	if err != nil {
+		t.Skip(err)
+	}
+
+	// Already owned by us, so nothing to change
+	stats, err := ApplyPermissions(root, PermissionOptions{UID: info.UID, GID: info.GID}, false)
+	if err != nil {
+		t.Fatalf("ApplyPermissions() error: %v", err)
+	}
+	if stats.OwnerChanged != 0 || stats.ModeChanged != 0 {
+		t.Errorf("expected no changes, got %+v", stats)
+	}
+}
+
+func TestApplyPermissions_MissingRoot(t *testing.T) {
+	if _, err := ApplyPermissions("/nonexistent/servctl", DefaultPermissionOptions(), false); err == nil {
+		t.Error("expected an error for a missing root")
+	}
+}
+
+func TestCreateDirectories(t *testing.T) {
+	root := t.TempDir()
+	var specs []DirectorySpec
+	for _, p := range []string{"a", "a/b", "a/b/c", "d", "d/e"} {
+		specs = append(specs, DirectorySpec{Path: filepath.Join(root, p), Mode: 0755})
+	}
+
+	results := CreateDirectories(specs, nil, false)
+	for i, r := range results {
+		if r.Spec.Path != specs[i].Path {
+			t.Errorf("result %d is for %s, want %s", i, r.Spec.Path, specs[i].Path)
+		}
+		if r.Error != nil {
+			t.Errorf("%s: %v", r.Spec.Path, r.Error)
+		}
+	}
+	if CountCreated(results) != len(specs) {
+		t.Errorf("CountCreated = %d, want %d (parents must not look pre-existing)", CountCreated(results), len(specs))
+	}
+}
+
+func TestCreateDirectory_Ownership(t *testing.T) {
+	perm, err := GetCurrentUserInfo()
+	if err != nil {
+		t.Skip(err)
+	}
+	root := t.TempDir()
+
+	// Missing parents are created with the spec's exact mode, despite the umask
+	spec := DirectorySpec{Path: filepath.Join(root, "x", "y"), Mode: 0775}
+	if r := CreateDirectory(spec, perm, false); r.Error != nil || !r.Created {
+		t.Fatalf("CreateDirectory() = %+v", r)
+	}
+	for _, p := range []string{"x", "x/y"} {
+		info, _ := os.Stat(filepath.Join(root, p))
+		if info.Mode().Perm() != 0775 {
+			t.Errorf("%s mode = %o, want 775", p, info.Mode().Perm())
+		}
+	}
+
+	// Existing directories, and what is in them, are never touched
+	existing := filepath.Join(root, "library")
+	os.Mkdir(existing, 0700)
+	spec = DirectorySpec{Path: existing, Mode: 0755}
+	if r := CreateDirectory(spec, perm, false); r.Error != nil || r.Created {
+		t.Fatalf("CreateDirectory() on existing = %+v", r)
+	}
+	if info, _ := os.Stat(existing); info.Mode().Perm() != 0700 {
+		t.Errorf("existing directory mode changed to %o", info.Mode().Perm())
+	}
+}
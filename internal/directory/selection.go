@@ -7,6 +7,8 @@ import (
 	"fmt"
 	"path/filepath"
 	"strings"
+
+	"github.com/madhav/servctl/internal/paths"
 )
 
 // cleanPath removes trailing slashes and cleans the path
@@ -20,9 +22,14 @@ type ServiceSelection struct {
 	Immich    bool
 	Databases bool
 	Glances   bool
+
+	// Optional layout modules, off by default
+	Media     bool
+	Downloads bool
+	Books     bool
 }
 
-// DefaultServiceSelection returns all services enabled
+// DefaultServiceSelection returns all services enabled and no optional layouts
 func DefaultServiceSelection() ServiceSelection {
 	return ServiceSelection{
 		Nextcloud: true,
@@ -32,12 +39,16 @@ func DefaultServiceSelection() ServiceSelection {
 	}
 }
 
-// PromptServiceSelection prompts user to select which services to configure
-func PromptServiceSelection(reader *bufio.Reader) ServiceSelection {
-	selection := DefaultServiceSelection()
+// PromptServiceSelection prompts user to select which services to configure.
+// The defaults and warnings follow the machine's capacity.
+func PromptServiceSelection(reader *bufio.Reader, capacity Capacity) ServiceSelection {
+	selection := RecommendedSelection(capacity)
 
 	fmt.Println("Select services to configure (Enter to keep all, or type numbers to toggle):")
 	fmt.Println()
+	if !selection.Immich {
+		fmt.Printf("  Immich is left out: it needs at least %s RAM. Toggle 2 to add it anyway.\n\n", gigabytes(ImmichMinRAM))
+	}
 
 	renderSelection := func() {
 		checkbox := func(enabled bool) string {
@@ -50,7 +61,17 @@ func PromptServiceSelection(reader *bufio.Reader) ServiceSelection {
 		fmt.Printf("  2. %s Immich      - Photo & video library\n", checkbox(selection.Immich))
 		fmt.Printf("  3. %s Databases   - PostgreSQL & Redis\n", checkbox(selection.Databases))
 		fmt.Printf("  4. %s Glances     - System monitoring\n", checkbox(selection.Glances))
+		fmt.Println("  Optional layouts:")
+		fmt.Printf("  5. %s Media       - Movies, TV & music (Jellyfin, Plex, *arr)\n", checkbox(selection.Media))
+		fmt.Printf("  6. %s Downloads   - Complete & incomplete (qBittorrent, SABnzbd)\n", checkbox(selection.Downloads))
+		fmt.Printf("  7. %s Books       - E-books & audiobooks (Calibre-Web, Audiobookshelf)\n", checkbox(selection.Books))
 		fmt.Println()
+		if advice := selection.Advice(capacity); len(advice) > 0 {
+			for _, a := range advice {
+				fmt.Printf("  ⚠ %s\n", a)
+			}
+			fmt.Println()
+		}
 	}
 
 	renderSelection()
@@ -77,6 +98,12 @@ func PromptServiceSelection(reader *bufio.Reader) ServiceSelection {
 			selection.Databases = !selection.Databases
 		case "4":
 			selection.Glances = !selection.Glances
+		case "5":
+			selection.Media = !selection.Media
+		case "6":
+			selection.Downloads = !selection.Downloads
+		case "7":
+			selection.Books = !selection.Books
 		}
 	}
 
@@ -101,120 +128,40 @@ func GetDirectoriesForServices(sel ServiceSelection, homeDir, dataRoot string) [
 		Type:        DirTypeUserSpace,
 		Service:     "core",
 		Description: "Infrastructure root",
-		Mode:        0755,
 	})
 	dirs = append(dirs, DirectorySpec{
 		Path:        filepath.Join(homeDir, "infra", "compose"),
 		Type:        DirTypeUserSpace,
 		Service:     "core",
 		Description: "Docker Compose files",
-		Mode:        0755,
 	})
 	dirs = append(dirs, DirectorySpec{
 		Path:        filepath.Join(homeDir, "infra", "scripts"),
 		Type:        DirTypeUserSpace,
 		Service:     "core",
 		Description: "Maintenance scripts",
-		Mode:        0755,
 	})
 	dirs = append(dirs, DirectorySpec{
 		Path:        filepath.Join(homeDir, "infra", "logs"),
 		Type:        DirTypeUserSpace,
 		Service:     "core",
 		Description: "Log files",
-		Mode:        0755,
-	})
-
-	// Data root
-	dirs = append(dirs, DirectorySpec{
-		Path:        dataRoot,
-		Type:        DirTypeDataSpace,
-		Service:     "core",
-		Description: "Data storage root",
-		Mode:        0755,
 	})
 
-	// Nextcloud directories
+	// Data directories come from the path registry, so they always match
+	// what compose mounts
+	services := []string{"core"}
 	if sel.Nextcloud {
-		dirs = append(dirs, DirectorySpec{
-			Path:        filepath.Join(dataRoot, "nextcloud"),
-			Type:        DirTypeDataSpace,
-			Service:     "nextcloud",
-			Description: "Nextcloud root",
-			Mode:        0755,
-		})
-		dirs = append(dirs, DirectorySpec{
-			Path:        filepath.Join(dataRoot, "nextcloud", "data"),
-			Type:        DirTypeDataSpace,
-			Service:     "nextcloud",
-			Description: "Nextcloud user data",
-			Mode:        0770,
-		})
-		dirs = append(dirs, DirectorySpec{
-			Path:        filepath.Join(dataRoot, "nextcloud", "config"),
-			Type:        DirTypeDataSpace,
-			Service:     "nextcloud",
-			Description: "Nextcloud configuration",
-			Mode:        0770,
-		})
+		services = append(services, "nextcloud")
 	}
-
-	// Immich directories
 	if sel.Immich {
-		dirs = append(dirs, DirectorySpec{
-			Path:        filepath.Join(dataRoot, "immich"),
-			Type:        DirTypeDataSpace,
-			Service:     "immich",
-			Description: "Immich root",
-			Mode:        0755,
-		})
-		dirs = append(dirs, DirectorySpec{
-			Path:        filepath.Join(dataRoot, "immich", "upload"),
-			Type:        DirTypeDataSpace,
-			Service:     "immich",
-			Description: "Photo uploads",
-			Mode:        0770,
-		})
-		dirs = append(dirs, DirectorySpec{
-			Path:        filepath.Join(dataRoot, "immich", "library"),
-			Type:        DirTypeDataSpace,
-			Service:     "immich",
-			Description: "Photo library",
-			Mode:        0770,
-		})
-		dirs = append(dirs, DirectorySpec{
-			Path:        filepath.Join(dataRoot, "immich", "thumbs"),
-			Type:        DirTypeDataSpace,
-			Service:     "immich",
-			Description: "Thumbnails cache",
-			Mode:        0770,
-		})
+		services = append(services, "immich")
 	}
-
-	// Database directories
 	if sel.Databases {
-		dirs = append(dirs, DirectorySpec{
-			Path:        filepath.Join(dataRoot, "databases"),
-			Type:        DirTypeDataSpace,
-			Service:     "databases",
-			Description: "Database storage",
-			Mode:        0700,
-		})
-		dirs = append(dirs, DirectorySpec{
-			Path:        filepath.Join(dataRoot, "databases", "postgres"),
-			Type:        DirTypeDataSpace,
-			Service:     "databases",
-			Description: "PostgreSQL data",
-			Mode:        0700,
-		})
-		dirs = append(dirs, DirectorySpec{
-			Path:        filepath.Join(dataRoot, "databases", "redis"),
-			Type:        DirTypeDataSpace,
-			Service:     "databases",
-			Description: "Redis data",
-			Mode:        0700,
-		})
+		services = append(services, "databases")
 	}
+	services = append(services, sel.Layouts()...)
+	dirs = append(dirs, GetServiceDataDirectories(dataRoot, services...)...)
 
 	// Glances (monitoring) - no persistent data needed, just config
 	if sel.Glances {
@@ -223,11 +170,25 @@ func GetDirectoriesForServices(sel ServiceSelection, homeDir, dataRoot string) [
 			Type:        DirTypeUserSpace,
 			Service:     "glances",
 			Description: "Glances config",
-			Mode:        0755,
 		})
 	}
 
-	return dirs
+	return applyMatrix(dirs, homeDir, dataRoot)
+}
+
+// Layouts returns the names of the selected optional layout modules
+func (s ServiceSelection) Layouts() []string {
+	var names []string
+	if s.Media {
+		names = append(names, LayoutMedia)
+	}
+	if s.Downloads {
+		names = append(names, LayoutDownloads)
+	}
+	if s.Books {
+		names = append(names, LayoutBooks)
+	}
+	return names
 }
 
 // PromptCustomDataRoot prompts user to customize the data root path
@@ -247,6 +208,51 @@ func PromptCustomDataRoot(reader *bufio.Reader, defaultPath string) string {
 	return response
 }
 
+// PromptServiceRoots asks, for each selected service whose data can live
+// elsewhere (paths.Separable), which root to keep it under. Enter keeps the
+// root in current, or dataRoot; validate refuses roots that are not a
+// suitable mount.
+func PromptServiceRoots(reader *bufio.Reader, sel ServiceSelection, dataRoot string, current paths.Roots, validate func(string) error) paths.Roots {
+	selected := map[string]bool{"immich": sel.Immich, "nextcloud": sel.Nextcloud}
+	for _, layout := range sel.Layouts() {
+		selected[layout] = true
+	}
+
+	roots := make(paths.Roots)
+	fmt.Println()
+	fmt.Println("Per-service data roots (Enter keeps the data root):")
+	for _, service := range paths.Separable {
+		if !selected[service] {
+			continue
+		}
+		for {
+			fmt.Printf("  %s [%s]: ", service, current.Root(service, dataRoot))
+			response, err := reader.ReadString('\n')
+			response = strings.TrimSpace(response)
+			if err != nil || response == "" {
+				if root := current[service]; root != "" {
+					roots[service] = root
+				}
+				break
+			}
+			if cleanPath(response) == cleanPath(dataRoot) {
+				break
+			}
+			response = filepath.Clean(response)
+			if err := validate(response); err != nil {
+				fmt.Printf("  %s\n", err)
+				continue
+			}
+			roots[service] = response
+			break
+		}
+	}
+	if len(roots) == 0 {
+		return nil
+	}
+	return roots
+}
+
 // CountSelectedServices returns the number of selected services
 func (s ServiceSelection) CountSelectedServices() int {
 	count := 0
@@ -262,7 +268,7 @@ func (s ServiceSelection) CountSelectedServices() int {
 	if s.Glances {
 		count++
 	}
-	return count
+	return count + len(s.Layouts())
 }
 
 // SelectedNames returns names of selected services
@@ -280,5 +286,14 @@ func (s ServiceSelection) SelectedNames() []string {
 	if s.Glances {
 		names = append(names, "Glances")
 	}
+	if s.Media {
+		names = append(names, "Media")
+	}
+	if s.Downloads {
+		names = append(names, "Downloads")
+	}
+	if s.Books {
+		names = append(names, "Books")
+	}
 	return names
 }
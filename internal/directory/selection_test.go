@@ -1,7 +1,12 @@
 package directory
 
 import (
+	"bufio"
+	"fmt"
+	"strings"
 	"testing"
+
+	"github.com/madhav/servctl/internal/paths"
 )
 
 // =============================================================================
@@ -127,13 +132,13 @@ func TestGetDirectoriesForServices_AllServices(t *testing.T) {
 	hasImmichUpload := false
 	hasPostgres := false
 	for _, d := range dirs {
-		if d.Path == dataRoot+"/nextcloud/data" {
+		if d.Path == dataRoot+"/cloud/data" {
 			hasNextcloudData = true
 		}
-		if d.Path == dataRoot+"/immich/upload" {
+		if d.Path == dataRoot+"/gallery/upload" {
 			hasImmichUpload = true
 		}
-		if d.Path == dataRoot+"/databases/postgres" {
+		if d.Path == dataRoot+"/databases/immich-postgres" {
 			hasPostgres = true
 		}
 	}
@@ -144,7 +149,7 @@ func TestGetDirectoriesForServices_AllServices(t *testing.T) {
 		t.Error("Missing immich upload directory")
 	}
 	if !hasPostgres {
-		t.Error("Missing postgres directory")
+		t.Error("Missing Immich postgres directory")
 	}
 }
 
@@ -238,22 +243,22 @@ func TestGetDirectoriesForServices_ImmichOnly(t *testing.T) {
 	hasThumbs := false
 
 	for _, d := range dirs {
-		if d.Path == dataRoot+"/immich" {
+		if d.Path == dataRoot+"/gallery" {
 			hasImmich = true
 		}
-		if d.Path == dataRoot+"/immich/upload" {
+		if d.Path == dataRoot+"/gallery/upload" {
 			hasUpload = true
 		}
-		if d.Path == dataRoot+"/immich/library" {
+		if d.Path == dataRoot+"/gallery/library" {
 			hasLibrary = true
 		}
-		if d.Path == dataRoot+"/immich/thumbs" {
+		if d.Path == dataRoot+"/gallery/thumbs" {
 			hasThumbs = true
 		}
 	}
 
 	if !hasImmich {
-		t.Error("Missing immich root directory")
+		t.Error("Missing immich gallery directory")
 	}
 	if !hasUpload {
 		t.Error("Missing immich upload directory")
@@ -287,10 +292,10 @@ func TestGetDirectoriesForServices_DatabasesOnly(t *testing.T) {
 		if d.Path == dataRoot+"/databases" {
 			hasDatabases = true
 		}
-		if d.Path == dataRoot+"/databases/postgres" {
+		if d.Path == dataRoot+"/databases/immich-postgres" {
 			hasPostgres = true
 		}
-		if d.Path == dataRoot+"/databases/redis" {
+		if d.Path == dataRoot+"/cache" {
 			hasRedis = true
 		}
 	}
@@ -299,10 +304,10 @@ func TestGetDirectoriesForServices_DatabasesOnly(t *testing.T) {
 		t.Error("Missing databases root directory")
 	}
 	if !hasPostgres {
-		t.Error("Missing postgres directory")
+		t.Error("Missing Immich postgres directory")
 	}
 	if !hasRedis {
-		t.Error("Missing redis directory")
+		t.Error("Missing redis cache directory")
 	}
 }
 
@@ -353,7 +358,7 @@ func TestDirectorySpec_Permissions(t *testing.T) {
 
 	// Check that data directories have appropriate permissions
 	for _, d := range dirs {
-		if d.Path == dataRoot+"/nextcloud/data" || d.Path == dataRoot+"/immich/upload" {
+		if d.Path == dataRoot+"/cloud/data" || d.Path == dataRoot+"/gallery/upload" {
 			if d.Mode != 0770 {
 				t.Errorf("Data directory %s should have mode 0770, got %o", d.Path, d.Mode)
 			}
@@ -391,3 +396,84 @@ func TestDirectorySpec_Types(t *testing.T) {
 func containsPath(path, prefix string) bool {
 	return len(path) >= len(prefix) && path[:len(prefix)] == prefix
 }
+
+func TestGetDirectoriesForServices_Layouts(t *testing.T) {
+	sel := DefaultServiceSelection()
+	dirs := GetDirectoriesForServices(sel, "/home/testuser", "/mnt/data")
+	for _, d := range dirs {
+		if d.Service == LayoutMedia || d.Service == LayoutDownloads || d.Service == LayoutBooks {
+			t.Errorf("layout directory %s created without being selected", d.Path)
+		}
+	}
+
+	sel.Media, sel.Downloads, sel.Books = true, true, true
+	dirs = GetDirectoriesForServices(sel, "/home/testuser", "/mnt/data")
+	paths := make(map[string]DirectorySpec)
+	for _, d := range dirs {
+		paths[d.Path] = d
+	}
+	for _, p := range []string{"media/movies", "media/tv", "media/music",
+		"downloads/complete", "downloads/incomplete", "books"} {
+		d, ok := paths["/mnt/data/"+p]
+		if !ok {
+			t.Errorf("missing layout directory %s", p)
+			continue
+		}
+		if d.Mode != 0770 {
+			t.Errorf("%s mode = %o, want 770", p, d.Mode)
+		}
+	}
+	if sel.CountSelectedServices() != 7 {
+		t.Errorf("CountSelectedServices() = %d, want 7", sel.CountSelectedServices())
+	}
+}
+
+func TestServiceRoots(t *testing.T) {
+	ServiceRoots = paths.Roots{"nextcloud": "/mnt/ssd"}
+	defer func() { ServiceRoots = nil }()
+
+	dirs := GetDirectoriesForServices(DefaultServiceSelection(), "/home/test", "/mnt/data")
+	found := false
+	for _, d := range dirs {
+		if d.Service == "nextcloud" && !strings.HasPrefix(d.Path, "/mnt/ssd/cloud") {
+			t.Errorf("Nextcloud directory %s should be under /mnt/ssd", d.Path)
+		}
+		if d.Path == "/mnt/ssd/cloud/config" {
+			found = true
+			if d.Mode != 0750 {
+				t.Errorf("The permission matrix should apply under the service root, got %o", d.Mode)
+			}
+		}
+	}
+	if !found {
+		t.Error("Expected /mnt/ssd/cloud/config")
+	}
+}
+
+func TestPromptServiceRoots(t *testing.T) {
+	refuse := func(root string) error {
+		if root == "/" {
+			return fmt.Errorf("system disk")
+		}
+		return nil
+	}
+	// Immich keeps the data root; for Nextcloud the system disk is asked again
+	input := "\n/\n/mnt/ssd/\n"
+	sel := DefaultServiceSelection()
+	roots := PromptServiceRoots(bufio.NewReader(strings.NewReader(input)), sel, "/mnt/data", nil, refuse)
+	if len(roots) != 1 || roots["nextcloud"] != "/mnt/ssd" {
+		t.Errorf("Got %v", roots)
+	}
+
+	if roots := PromptServiceRoots(bufio.NewReader(strings.NewReader("\n\n")), sel, "/mnt/data", nil, refuse); roots != nil {
+		t.Errorf("Enter everywhere should keep the data root, got %v", roots)
+	}
+
+	// Enter keeps a root placed before, typing the data root moves it back
+	sel.Downloads = true
+	current := paths.Roots{"immich": "/mnt/hdd", "downloads": "/mnt/scratch"}
+	roots = PromptServiceRoots(bufio.NewReader(strings.NewReader("\n\n/mnt/data\n")), sel, "/mnt/data", current, refuse)
+	if len(roots) != 1 || roots["immich"] != "/mnt/hdd" {
+		t.Errorf("Got %v", roots)
+	}
+}
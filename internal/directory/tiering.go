@@ -0,0 +1,119 @@
+package directory
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/madhav/servctl/internal/ops"
+	"github.com/madhav/servctl/internal/paths"
+)
+
+// TierLink is a hot data location that lives on fast storage. Canonical is
+// its registered path under the data root, which becomes a symlink to
+// Target, so compose, backups and status still see one tree.
+type TierLink struct {
+	Key       string
+	Canonical string
+	Target    string
+}
+
+// TierLinks returns the links for the hot locations among keys
+func TierLinks(dataRoot, fastRoot string, keys []string) []TierLink {
+	var links []TierLink
+	for _, key := range keys {
+		if !paths.IsHot(key) {
+			continue
+		}
+		links = append(links, TierLink{
+			Key:       key,
+			Canonical: paths.Join(dataRoot, key),
+			Target:    paths.Join(fastRoot, key),
+		})
+	}
+	return links
+}
+
+// isEmptyDir reports whether path is a real directory with no entries
+func isEmptyDir(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	_, err = f.Readdirnames(1)
+	return err == io.EOF
+}
+
+// ApplyTierLink creates the fast target with the matrix mode and owner, then
+// points the canonical path at it. An empty canonical directory is replaced;
+// one holding data is left alone and reported, since moving a live
+// database is not something to do implicitly.
+func ApplyTierLink(link TierLink, owner *PermissionInfo, dryRun bool) DirectoryResult {
+	rule := LookupRule(DirTypeDataSpace, paths.Rel(link.Key))
+	target := DirectorySpec{Path: link.Target, Type: DirTypeDataSpace, Mode: rule.Mode, Owner: rule.Owner,
+		Description: "Fast storage for " + link.Key}
+	result := DirectoryResult{Spec: DirectorySpec{Path: link.Canonical, Type: DirTypeDataSpace,
+		Description: "→ " + link.Target}}
+
+	if dest, err := os.Readlink(link.Canonical); err == nil {
+		if dest != link.Target {
+			result.Error = fmt.Errorf("%s already links to %s, not %s", link.Canonical, dest, link.Target)
+		}
+		return result
+	}
+	if info, err := os.Lstat(link.Canonical); err == nil {
+		if !info.IsDir() || !isEmptyDir(link.Canonical) {
+			result.Error = fmt.Errorf("%s already holds data; move it to %s and remove it to relocate", link.Canonical, link.Target)
+			return result
+		}
+	}
+
+	if r := CreateDirectory(target, owner, dryRun); r.Error != nil {
+		result.Error = r.Error
+		return result
+	}
+	var steps []ops.Operation
+	if isEmptyDir(link.Canonical) {
+		steps = append(steps, ops.Func{
+			Description: "remove the empty directory " + link.Canonical,
+			Fn:          func() error { return os.Remove(link.Canonical) },
+		})
+	}
+	for _, dir := range missingComponents(filepath.Dir(link.Canonical)) {
+		steps = append(steps, ownedDirOp(dir, DefaultRule.Mode, owner))
+	}
+	steps = append(steps, ops.Func{
+		Description: fmt.Sprintf("link %s → %s", link.Canonical, link.Target),
+		Fn:          func() error { return os.Symlink(link.Target, link.Canonical) },
+	})
+	if err := ops.Execute(dryRun, steps...); err != nil {
+		result.Error = fmt.Errorf("failed to link %s: %w", link.Canonical, err)
+		return result
+	}
+
+	result.Created = true
+	return result
+}
+
+// VerifyTierLinks checks that every canonical path is a symlink to its
+// target and that the target is a directory (the fast disk is mounted)
+func VerifyTierLinks(links []TierLink) []error {
+	var problems []error
+	for _, link := range links {
+		dest, err := os.Readlink(link.Canonical)
+		switch {
+		case err != nil:
+			problems = append(problems, fmt.Errorf("%s is not a symlink to fast storage", link.Canonical))
+			continue
+		case dest != link.Target:
+			problems = append(problems, fmt.Errorf("%s links to %s, expected %s", link.Canonical, dest, link.Target))
+			continue
+		}
+		if info, err := os.Stat(link.Target); err != nil || !info.IsDir() {
+			problems = append(problems, fmt.Errorf("%s is missing (is the fast disk mounted?)", link.Target))
+		}
+	}
+	return problems
+}
@@ -0,0 +1,80 @@
+package directory
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/madhav/servctl/internal/paths"
+)
+
+func TestTierLinks_OnlyHot(t *testing.T) {
+	links := TierLinks("/mnt/data", "/mnt/fast", []string{paths.Gallery, paths.ImmichDB, paths.Cache})
+	if len(links) != 2 {
+		t.Fatalf("got %d links, want 2 (gallery is not hot)", len(links))
+	}
+	if links[0].Canonical != "/mnt/data/databases/immich-postgres" || links[0].Target != "/mnt/fast/databases/immich-postgres" {
+		t.Errorf("unexpected link %+v", links[0])
+	}
+}
+
+func TestApplyTierLink(t *testing.T) {
+	dataRoot, fastRoot := t.TempDir(), t.TempDir()
+	links := TierLinks(dataRoot, fastRoot, []string{paths.ImmichDB, paths.Cache})
+
+	// An empty directory left by Phase 3 is replaced by the link
+	if err := os.MkdirAll(links[0].Canonical, 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	if r := ApplyTierLink(links[0], nil, true); r.Error != nil || !r.Created {
+		t.Fatalf("dry run = %+v", r)
+	}
+	if _, err := os.Readlink(links[0].Canonical); err == nil {
+		t.Fatal("dry run created a link")
+	}
+
+	for _, link := range links {
+		if r := ApplyTierLink(link, nil, false); r.Error != nil {
+			t.Fatalf("ApplyTierLink(%s): %v", link.Key, r.Error)
+		}
+	}
+	if problems := VerifyTierLinks(links); len(problems) != 0 {
+		t.Errorf("VerifyTierLinks after apply: %v", problems)
+	}
+	if info, err := os.Stat(links[0].Target); err != nil || info.Mode().Perm() != 0700 {
+		t.Errorf("target should be created with the matrix mode 700, got %v %v", info, err)
+	}
+
+	// Applying again is a no-op
+	if r := ApplyTierLink(links[0], nil, false); r.Error != nil {
+		t.Errorf("second apply: %v", r.Error)
+	}
+
+	// A missing fast disk is reported
+	os.RemoveAll(links[1].Target)
+	if problems := VerifyTierLinks(links); len(problems) != 1 {
+		t.Errorf("VerifyTierLinks with a missing target = %v, want 1 problem", problems)
+	}
+}
+
+func TestApplyTierLink_KeepsExistingData(t *testing.T) {
+	dataRoot, fastRoot := t.TempDir(), t.TempDir()
+	link := TierLinks(dataRoot, fastRoot, []string{paths.NextcloudDB})[0]
+	if err := os.MkdirAll(link.Canonical, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(link.Canonical, "ibdata1"), []byte("x"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if r := ApplyTierLink(link, nil, false); r.Error == nil {
+		t.Error("ApplyTierLink should refuse to replace a directory holding data")
+	}
+	if _, err := os.Stat(filepath.Join(link.Canonical, "ibdata1")); err != nil {
+		t.Error("existing data was touched")
+	}
+	if problems := VerifyTierLinks([]TierLink{link}); len(problems) != 1 {
+		t.Errorf("VerifyTierLinks = %v, want the unlinked directory reported", problems)
+	}
+}
@@ -0,0 +1,96 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/madhav/servctl/internal/status"
+)
+
+// dockerEvent is the subset of a GET /events message that the timeline uses
+type dockerEvent struct {
+	Type   string
+	Action string
+	Actor  struct {
+		Attributes map[string]string
+	}
+	Time int64 `json:"time"`
+}
+
+// dockerActions are the container events worth a timeline entry; kill is
+// left out because the die that follows carries the exit code
+var dockerActions = []string{"start", "stop", "die", "oom", "restart", "health_status: unhealthy"}
+
+// DockerEvents asks the Docker daemon for container lifecycle events between
+// since and until (now when zero). Docker only keeps a limited history, so
+// old ranges may come back short.
+func DockerEvents(socket string, since, until time.Time) ([]Event, error) {
+	if socket == "" {
+		socket = status.DefaultDockerSocket
+	}
+	if until.IsZero() || until.After(time.Now()) {
+		until = time.Now()
+	}
+	filters, _ := json.Marshal(map[string][]string{"type": {"container"}, "event": dockerActions})
+	query := url.Values{
+		"since":   {strconv.FormatInt(since.Unix(), 10)},
+		"until":   {strconv.FormatInt(until.Unix(), 10)},
+		"filters": {string(filters)},
+	}
+
+	resp, err := status.DockerClient(socket).Get("http://docker/events?" + query.Encode())
+	if err != nil {
+		return nil, status.DockerError(socket, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Docker API returned %s", resp.Status)
+	}
+
+	// The response is a stream of JSON objects that ends at until
+	var evs []Event
+	dec := json.NewDecoder(resp.Body)
+	for dec.More() {
+		var de dockerEvent
+		if err := dec.Decode(&de); err != nil {
+			return evs, fmt.Errorf("cannot decode Docker events: %w", err)
+		}
+		if e, ok := eventFromDocker(de); ok {
+			evs = append(evs, e)
+		}
+	}
+	return evs, nil
+}
+
+// eventFromDocker describes one container event
+func eventFromDocker(de dockerEvent) (Event, bool) {
+	name := de.Actor.Attributes["name"]
+	e := Event{Time: time.Unix(de.Time, 0), Source: SourceDocker, Level: LevelInfo}
+	switch de.Action {
+	case "start":
+		e.Message = name + " started"
+	case "stop":
+		e.Message = name + " stopped"
+	case "restart":
+		e.Message = name + " restarted"
+	case "die":
+		code := de.Actor.Attributes["exitCode"]
+		e.Message = name + " exited with code " + code
+		if code != "0" && code != "143" { // 143: SIGTERM from an orderly stop
+			e.Level = LevelError
+		}
+	case "oom":
+		e.Message = name + " was killed for running out of memory"
+		e.Level = LevelError
+	case "health_status: unhealthy":
+		e.Message = name + " became unhealthy"
+		e.Level = LevelWarn
+	default:
+		return Event{}, false
+	}
+	return e, true
+}
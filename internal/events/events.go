@@ -0,0 +1,307 @@
+// Package events merges what happened on the server into one timeline:
+// servctl's own actions, container lifecycle events from Docker, backup runs
+// and SMART health changes recorded by the maintenance scripts.
+package events
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Source identifies where an event came from
+type Source string
+
+const (
+	SourceServctl Source = "servctl" // Audit log of servctl commands
+	SourceDocker  Source = "docker"  // Container starts, stops, crashes, OOM kills
+	SourceBackup  Source = "backup"  // Data and config backup runs
+	SourceSMART   Source = "smart"   // Drive health changes
+)
+
+// Sources lists every source in display order
+var Sources = []Source{SourceServctl, SourceDocker, SourceBackup, SourceSMART}
+
+// Levels of an event
+const (
+	LevelInfo  = "info"
+	LevelWarn  = "warn"
+	LevelError = "error"
+)
+
+// Log files read from LogDir
+const (
+	AuditLogFile        = "servctl.log"
+	BackupLogFile       = "daily_backup.log"
+	ConfigBackupLogFile = "infra_config_backup.log"
+	SmartLogFile        = "smart_monitor.log"
+)
+
+// Event is one entry of the timeline
+type Event struct {
+	Time    time.Time `json:"time"`
+	Source  Source    `json:"source"`
+	Level   string    `json:"level"`
+	Message string    `json:"message"`
+}
+
+// Options selects the events Collect returns
+type Options struct {
+	LogDir       string // ~/infra/logs
+	DockerSocket string // Engine API socket; the default socket when empty
+	Since, Until time.Time
+	Sources      []Source // All sources when empty
+}
+
+func (o Options) wants(s Source) bool {
+	if len(o.Sources) == 0 {
+		return true
+	}
+	for _, want := range o.Sources {
+		if want == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (o Options) inRange(t time.Time) bool {
+	return !t.Before(o.Since) && (o.Until.IsZero() || !t.After(o.Until))
+}
+
+// Collect gathers the selected events in chronological order. A source
+// that cannot be read is reported in errs and the others are still used.
+func Collect(opts Options) (timeline []Event, errs []error) {
+	add := func(evs []Event, err error) {
+		if err != nil {
+			errs = append(errs, err)
+		}
+		for _, e := range evs {
+			if opts.inRange(e.Time) {
+				timeline = append(timeline, e)
+			}
+		}
+	}
+
+	if opts.wants(SourceServctl) {
+		add(readLogs(opts.LogDir, AuditLogFile, ParseAuditLog))
+	}
+	if opts.wants(SourceDocker) {
+		add(DockerEvents(opts.DockerSocket, opts.Since, opts.Until))
+	}
+	if opts.wants(SourceBackup) {
+		add(readLogs(opts.LogDir, BackupLogFile, ParseBackupLog))
+		add(readLogs(opts.LogDir, ConfigBackupLogFile, ParseBackupLog))
+	}
+	if opts.wants(SourceSMART) {
+		add(readLogs(opts.LogDir, SmartLogFile, ParseSmartLog))
+	}
+
+	sort.SliceStable(timeline, func(i, j int) bool { return timeline[i].Time.Before(timeline[j].Time) })
+	return timeline, errs
+}
+
+// ParseSources parses a comma-separated source list; empty means all
+func ParseSources(s string) ([]Source, error) {
+	var sources []Source
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		found := false
+		for _, src := range Sources {
+			if string(src) == name {
+				sources = append(sources, src)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown event source %q (use servctl, docker, backup or smart)", name)
+		}
+	}
+	return sources, nil
+}
+
+// ParseTime reads a time range bound: a duration back from now ("90m",
+// "12h", "7d"), a date ("2024-05-01") or a date and time ("2024-05-01 03:00")
+func ParseTime(s string, now time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n >= 0 {
+			return now.AddDate(0, 0, -n), nil
+		}
+	}
+	if d, err := time.ParseDuration(s); err == nil && d >= 0 {
+		return now.Add(-d), nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04", "2006-01-02T15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, now.Location()); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("cannot read time %q (use e.g. 12h, 7d or 2024-05-01 03:00)", s)
+}
+
+// readLogs parses a log and its logrotate generations (name.1, name.2.gz,
+// ...), oldest first. A log that does not exist yet has no events.
+func readLogs(logDir, name string, parse func(io.Reader) []Event) ([]Event, error) {
+	if logDir == "" {
+		return nil, nil
+	}
+	base := filepath.Join(logDir, name)
+	rotated, _ := filepath.Glob(base + ".*")
+	sort.Slice(rotated, func(i, j int) bool { return rotation(rotated[i]) > rotation(rotated[j]) })
+
+	var evs []Event
+	for _, path := range append(rotated, base) {
+		f, err := os.Open(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return evs, err
+		}
+		var r io.Reader = f
+		if strings.HasSuffix(path, ".gz") {
+			gz, err := gzip.NewReader(f)
+			if err != nil {
+				f.Close()
+				return evs, fmt.Errorf("%s: %w", path, err)
+			}
+			r = gz
+		}
+		evs = append(evs, parse(r)...)
+		f.Close()
+	}
+	return evs, nil
+}
+
+// rotation returns the logrotate generation of a rotated log path
+func rotation(path string) int {
+	ext := filepath.Ext(strings.TrimSuffix(path, ".gz"))
+	n, _ := strconv.Atoi(strings.TrimPrefix(ext, "."))
+	return n
+}
+
+// auditLine matches utils.Logger entries: "[2006-01-02 15:04:05] [INFO] message"
+var auditLine = regexp.MustCompile(`^\[(\d{4}-\d\d-\d\d \d\d:\d\d:\d\d)\] \[(\w+)\] (.*)$`)
+
+// ParseAuditLog reads servctl's own log
+func ParseAuditLog(r io.Reader) []Event {
+	var evs []Event
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		m := auditLine.FindStringSubmatch(scanner.Text())
+		if m == nil || m[2] == "DEBUG" {
+			continue
+		}
+		t, err := time.ParseInLocation("2006-01-02 15:04:05", m[1], time.Local)
+		if err != nil {
+			continue
+		}
+		level := LevelInfo
+		switch m[2] {
+		case "WARN":
+			level = LevelWarn
+		case "ERROR":
+			level = LevelError
+		}
+		evs = append(evs, Event{Time: t, Source: SourceServctl, Level: level, Message: m[3]})
+	}
+	return evs
+}
+
+// scriptLine matches the maintenance scripts' "[$(date)] message" lines
+var scriptLine = regexp.MustCompile(`^\[(\w{3} \w{3} [ \d]\d \d\d:\d\d:\d\d \S+ \d{4})\] (.*)$`)
+
+// parseScriptLine returns the time and message of a timestamped script log
+// line; rsync and curl output in between is not timestamped and is skipped
+func parseScriptLine(line string) (time.Time, string, bool) {
+	m := scriptLine.FindStringSubmatch(line)
+	if m == nil {
+		return time.Time{}, "", false
+	}
+	// date(1) prints the local zone abbreviation, which only resolves to an
+	// offset in the machine's own zone
+	t, err := time.ParseInLocation(time.UnixDate, m[1], time.Local)
+	if err != nil {
+		return time.Time{}, "", false
+	}
+	return t, m[2], true
+}
+
+// exitCode matches the "(Exit Code: N)" the backup scripts log on finishing
+var exitCode = regexp.MustCompile(`\(Exit Code: (\d+)\)`)
+
+// ParseBackupLog reads the data and config backup logs
+func ParseBackupLog(r io.Reader) []Event {
+	var evs []Event
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		t, msg, ok := parseScriptLine(scanner.Text())
+		if !ok || strings.HasPrefix(msg, "Space check") {
+			continue
+		}
+		level := LevelInfo
+		if m := exitCode.FindStringSubmatch(msg); m != nil && m[1] != "0" {
+			level = LevelError
+		}
+		if strings.Contains(msg, "ERROR") {
+			level = LevelError
+		} else if strings.HasPrefix(msg, "Low space") {
+			level = LevelWarn
+		}
+		evs = append(evs, Event{Time: t, Source: SourceBackup, Level: level, Message: msg})
+	}
+	return evs
+}
+
+// smartLine matches the SMART monitor's "DEVICE: HEALTH" results
+var smartLine = regexp.MustCompile(`^(/dev/\S+): (\S+)$`)
+
+// ParseSmartLog reads the SMART monitor log and keeps only changes: the
+// first result of a healthy drive is not news, a drive that stops (or
+// starts) passing is
+func ParseSmartLog(r io.Reader) []Event {
+	var evs []Event
+	last := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		t, msg, ok := parseScriptLine(scanner.Text())
+		if !ok {
+			continue
+		}
+		m := smartLine.FindStringSubmatch(msg)
+		if m == nil {
+			continue
+		}
+		drive, health := m[1], m[2]
+		prev, seen := last[drive]
+		last[drive] = health
+		if prev == health || (!seen && health == "PASSED") {
+			continue
+		}
+
+		e := Event{Time: t, Source: SourceSMART, Level: LevelError, Message: drive + " SMART health " + health}
+		if health == "PASSED" {
+			e.Level = LevelInfo
+			e.Message = fmt.Sprintf("%s SMART health back to PASSED (was %s)", drive, prev)
+		} else if seen {
+			e.Message = fmt.Sprintf("%s SMART health %s (was %s)", drive, health, prev)
+		}
+		evs = append(evs, e)
+	}
+	return evs
+}
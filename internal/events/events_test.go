@@ -0,0 +1,265 @@
+package events
+
+import (
+	"compress/gzip"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func at(s string) time.Time {
+	t, err := time.ParseInLocation("2006-01-02 15:04:05", s, time.Local)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// dateLine formats a log line the way the scripts' "[$(date)] ..." does
+func dateLine(s, msg string) string {
+	return "[" + at(s).Format(time.UnixDate) + "] " + msg
+}
+
+func TestParseAuditLog(t *testing.T) {
+	log := `[2024-05-01 03:00:00] [INFO] Starting servctl setup wizard
+[2024-05-01 03:10:00] [DEBUG] noise
+garbage line
+[2024-05-01 03:20:00] [ERROR] Compose file not written
+[2024-05-01 03:30:00] [INFO] Network refresh: host IP is now 192.168.1.50
+`
+	got := ParseAuditLog(strings.NewReader(log))
+	want := []Event{
+		{Time: at("2024-05-01 03:00:00"), Source: SourceServctl, Level: LevelInfo, Message: "Starting servctl setup wizard"},
+		{Time: at("2024-05-01 03:20:00"), Source: SourceServctl, Level: LevelError, Message: "Compose file not written"},
+		{Time: at("2024-05-01 03:30:00"), Source: SourceServctl, Level: LevelInfo, Message: "Network refresh: host IP is now 192.168.1.50"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseAuditLog() =\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestParseBackupLog(t *testing.T) {
+	log := strings.Join([]string{
+		dateLine("2024-05-01 03:00:00", "Starting Backup..."),
+		dateLine("2024-05-01 03:00:01", "Space check: need 1.2G, free 800G"),
+		"sending incremental file list",
+		"gallery/IMG_0001.jpg",
+		dateLine("2024-05-01 03:05:00", "Backup Finished (Exit Code: 0)."),
+		dateLine("2024-05-02 03:00:00", "Starting Backup..."),
+		dateLine("2024-05-02 03:00:02", "ERROR: not enough space on backup disk, backup skipped"),
+		dateLine("2024-05-02 03:00:03", "Backup Finished (Exit Code: 28)."),
+	}, "\n")
+
+	got := ParseBackupLog(strings.NewReader(log))
+	var levels, messages []string
+	for _, e := range got {
+		levels = append(levels, e.Level)
+		messages = append(messages, e.Message)
+	}
+	wantLevels := []string{LevelInfo, LevelInfo, LevelInfo, LevelError, LevelError}
+	if !reflect.DeepEqual(levels, wantLevels) {
+		t.Errorf("levels = %v, want %v (messages %q)", levels, wantLevels, messages)
+	}
+	if !got[0].Time.Equal(at("2024-05-01 03:00:00")) {
+		t.Errorf("first event at %v", got[0].Time)
+	}
+}
+
+func TestParseSmartLog(t *testing.T) {
+	log := strings.Join([]string{
+		dateLine("2024-05-01 05:00:00", "/dev/sda: PASSED"),
+		dateLine("2024-05-01 05:00:01", "/dev/sdb: UNKNOWN"),
+		dateLine("2024-05-02 05:00:00", "/dev/sda: PASSED"),
+		dateLine("2024-05-02 05:00:01", "/dev/sdb: UNKNOWN"),
+		dateLine("2024-05-03 05:00:00", "/dev/sda: FAILED!"),
+		dateLine("2024-05-04 05:00:00", "/dev/sda: PASSED"),
+	}, "\n")
+
+	var got []string
+	for _, e := range ParseSmartLog(strings.NewReader(log)) {
+		got = append(got, e.Time.Format("01-02")+" "+e.Level+" "+e.Message)
+	}
+	want := []string{
+		"05-01 error /dev/sdb SMART health UNKNOWN",
+		"05-03 error /dev/sda SMART health FAILED! (was PASSED)",
+		"05-04 info /dev/sda SMART health back to PASSED (was FAILED!)",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseSmartLog() =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	now := at("2024-05-10 12:00:00")
+	tests := []struct {
+		in      string
+		want    time.Time
+		wantErr bool
+	}{
+		{"", time.Time{}, false},
+		{"12h", at("2024-05-10 00:00:00"), false},
+		{"90m", at("2024-05-10 10:30:00"), false},
+		{"7d", at("2024-05-03 12:00:00"), false},
+		{"2024-05-01", at("2024-05-01 00:00:00"), false},
+		{"2024-05-01 03:15", at("2024-05-01 03:15:00"), false},
+		{"yesterday", time.Time{}, true},
+		{"-5h", time.Time{}, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseTime(tt.in, now)
+		if (err != nil) != tt.wantErr || !got.Equal(tt.want) {
+			t.Errorf("ParseTime(%q) = %v, %v; want %v (error %v)", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestParseSources(t *testing.T) {
+	got, err := ParseSources("docker, backup")
+	if err != nil || !reflect.DeepEqual(got, []Source{SourceDocker, SourceBackup}) {
+		t.Errorf("ParseSources() = %v, %v", got, err)
+	}
+	if got, _ := ParseSources(""); got != nil {
+		t.Errorf("Empty list should select all sources, got %v", got)
+	}
+	if _, err := ParseSources("docker,cron"); err == nil {
+		t.Error("Unknown source should be rejected")
+	}
+}
+
+func TestReadLogs_Rotated(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, AuditLogFile)
+	write := func(path, content string) {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(base, "[2024-05-10 00:00:00] [INFO] current\n")
+	write(base+".1", "[2024-05-03 00:00:00] [INFO] last week\n")
+
+	f, err := os.Create(base + ".2.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz := gzip.NewWriter(f)
+	gz.Write([]byte("[2024-04-26 00:00:00] [INFO] two weeks ago\n"))
+	gz.Close()
+	f.Close()
+
+	evs, err := readLogs(dir, AuditLogFile, ParseAuditLog)
+	if err != nil {
+		t.Fatalf("readLogs() error: %v", err)
+	}
+	var got []string
+	for _, e := range evs {
+		got = append(got, e.Message)
+	}
+	if want := []string{"two weeks ago", "last week", "current"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("readLogs() = %q, want %q", got, want)
+	}
+
+	if evs, err := readLogs(dir, SmartLogFile, ParseSmartLog); err != nil || len(evs) != 0 {
+		t.Errorf("Missing log should give no events, got %v, %v", evs, err)
+	}
+}
+
+// fakeDocker serves body as GET /events on a unix socket and records the
+// query it was asked
+func fakeDocker(t *testing.T, body string, query *string) string {
+	t.Helper()
+	socket := filepath.Join(t.TempDir(), "docker.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skipf("unix sockets unavailable: %v", err)
+	}
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/events" {
+			http.NotFound(w, r)
+			return
+		}
+		*query = r.URL.RawQuery
+		w.Write([]byte(body))
+	})}
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+	return socket
+}
+
+const dockerEventsJSON = `{"Type":"container","Action":"start","Actor":{"Attributes":{"name":"immich_server"}},"time":1714532400}
+{"Type":"container","Action":"oom","Actor":{"Attributes":{"name":"immich_machine_learning"}},"time":1714532500}
+{"Type":"container","Action":"die","Actor":{"Attributes":{"name":"immich_machine_learning","exitCode":"137"}},"time":1714532501}
+{"Type":"container","Action":"die","Actor":{"Attributes":{"name":"nextcloud","exitCode":"143"}},"time":1714532600}
+{"Type":"container","Action":"exec_start: sh","Actor":{"Attributes":{"name":"nextcloud"}},"time":1714532700}
+`
+
+func TestDockerEvents(t *testing.T) {
+	var query string
+	socket := fakeDocker(t, dockerEventsJSON, &query)
+	since := time.Unix(1714500000, 0)
+
+	evs, err := DockerEvents(socket, since, time.Unix(1714600000, 0))
+	if err != nil {
+		t.Fatalf("DockerEvents() error: %v", err)
+	}
+	if !strings.Contains(query, "since=1714500000") || !strings.Contains(query, "until=1714600000") {
+		t.Errorf("query = %q, want the time range", query)
+	}
+
+	var got []string
+	for _, e := range evs {
+		got = append(got, e.Level+" "+e.Message)
+	}
+	want := []string{
+		"info immich_server started",
+		"error immich_machine_learning was killed for running out of memory",
+		"error immich_machine_learning exited with code 137",
+		"info nextcloud exited with code 143",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("DockerEvents() =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestCollect(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, AuditLogFile), []byte(
+		"[2024-05-01 02:00:00] [INFO] Setup wizard: regenerate compose files and maintenance scripts\n"+
+			"[2024-04-01 02:00:00] [INFO] too old\n"), 0644)
+	os.WriteFile(filepath.Join(dir, BackupLogFile), []byte(
+		dateLine("2024-05-01 03:00:00", "Starting Backup...")+"\n"+
+			dateLine("2024-05-01 03:05:00", "Backup Finished (Exit Code: 0).")+"\n"), 0644)
+
+	var query string
+	start := at("2024-05-01 00:00:00")
+	opts := Options{
+		LogDir: dir,
+		DockerSocket: fakeDocker(t, `{"Type":"container","Action":"start","Actor":{"Attributes":{"name":"redis"}},"time":`+
+			strconv.FormatInt(start.Add(150*time.Minute).Unix(), 10)+`}`, &query),
+		Since: start,
+		Until: at("2024-05-02 00:00:00"),
+	}
+
+	timeline, errs := Collect(opts)
+	if len(errs) != 0 {
+		t.Fatalf("Collect() errors: %v", errs)
+	}
+	var got []string
+	for _, e := range timeline {
+		got = append(got, e.Time.Format("15:04")+" "+string(e.Source))
+	}
+	want := []string{"02:00 servctl", "02:30 docker", "03:00 backup", "03:05 backup"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Collect() = %q, want %q", got, want)
+	}
+
+	opts.Sources = []Source{SourceBackup}
+	if timeline, _ := Collect(opts); len(timeline) != 2 {
+		t.Errorf("Source filter should keep the 2 backup events, got %d", len(timeline))
+	}
+}
@@ -0,0 +1,230 @@
+// Package export turns a finished servctl setup into infrastructure as code:
+// an Ansible playbook or cloud-init user-data that rebuilds it on a fresh
+// Ubuntu machine from the recorded state and the files servctl generated.
+package export
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/madhav/servctl/internal/compose"
+	"github.com/madhav/servctl/internal/directory"
+	"github.com/madhav/servctl/internal/ops"
+	"github.com/madhav/servctl/internal/preflight"
+	"github.com/madhav/servctl/templates"
+)
+
+// Formats are the supported export targets
+var Formats = []string{"ansible", "cloud-init"}
+
+// CronPath is where servctl installs its maintenance jobs
+const CronPath = "/etc/cron.d/servctl"
+
+// File is a generated file recreated on the new machine
+type File struct {
+	Path    string // Absolute path on the target
+	Content []byte
+	Mode    os.FileMode
+	Owned   bool // Owned by the servctl user rather than root
+}
+
+// Dir is a directory created on the new machine
+type Dir struct {
+	Path  string
+	Mode  os.FileMode
+	Owned bool
+}
+
+// Bundle is everything needed to reproduce the setup
+type Bundle struct {
+	Config   *compose.ServiceConfig
+	User     string   // Account that owns ~/infra
+	Packages []string // apt packages, pinned ("name=version") when recorded
+	Dirs     []Dir
+	Files    []File
+}
+
+// readFile adds path to the bundle when it exists
+func (b *Bundle) readFile(path string, owned bool) error {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("cannot read %s: %w", path, err)
+	}
+	b.Files = append(b.Files, File{Path: path, Content: content, Mode: info.Mode().Perm(), Owned: owned})
+	return nil
+}
+
+// Collect gathers the state, directories and generated files of the setup
+// recorded under infraRoot. The new machine must use the same user name and
+// home directory, and its data disks must be mounted at the same DataRoot.
+func Collect(infraRoot, user string) (*Bundle, error) {
+	config, err := compose.LoadState(infraRoot)
+	if err != nil {
+		return nil, err
+	}
+	if config.InfraRoot == "" {
+		config.InfraRoot = infraRoot
+	}
+	b := &Bundle{Config: config, User: user}
+
+	// System packages, pinned to what this machine ran
+	for _, dep := range preflight.GetRequiredDependencies() {
+		if dep.Package == "docker-ce" || dep.Package == "docker-compose" {
+			continue // from Docker's repository below
+		}
+		b.Packages = append(b.Packages, pinned(dep.Package, config.PackageVersions))
+	}
+	for _, pkg := range preflight.DockerPackages {
+		b.Packages = append(b.Packages, pinned(pkg, config.PackageVersions))
+	}
+
+	homeDir := filepath.Dir(infraRoot)
+	specs := append(directory.GetUserSpaceDirectories(homeDir),
+		directory.GetPathDirectories(config.DataRoot, config.MountedPaths())...)
+	for _, spec := range specs {
+		b.Dirs = append(b.Dirs, Dir{Path: spec.Path, Mode: spec.Mode, Owned: spec.Owner == directory.OwnerUser})
+	}
+
+	composeDir := filepath.Join(infraRoot, "compose")
+	for _, path := range []string{
+		filepath.Join(composeDir, "docker-compose.yml"),
+		filepath.Join(composeDir, ".env"),
+		filepath.Join(composeDir, compose.AuthentikBlueprintFile),
+	} {
+		if err := b.readFile(path, true); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := os.Stat(filepath.Join(composeDir, "docker-compose.yml")); err != nil {
+		return nil, fmt.Errorf("no docker-compose.yml in %s (run 'servctl -start-setup' first)", composeDir)
+	}
+
+	scripts, _ := filepath.Glob(filepath.Join(infraRoot, "scripts", "*.sh"))
+	sort.Strings(scripts)
+	for _, path := range scripts {
+		if err := b.readFile(path, true); err != nil {
+			return nil, err
+		}
+	}
+	for _, path := range []string{CronPath, compose.DnsmasqConfigPath} {
+		if err := b.readFile(path, false); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// pinned returns "pkg=version" when the version was recorded
+func pinned(pkg string, versions map[string]string) string {
+	if v := versions[pkg]; v != "" {
+		return pkg + "=" + v
+	}
+	return pkg
+}
+
+// storageNote explains what the export cannot reproduce
+func (b *Bundle) storageNote() string {
+	return fmt.Sprintf("Disks are not formatted or mounted by this file: prepare them and mount the\n"+
+		"data root at %s first (disk UUIDs differ between machines).", b.Config.DataRoot)
+}
+
+// composeFile is the generated compose file on the target
+func (b *Bundle) composeFile() string {
+	return filepath.Join(b.Config.InfraRoot, "compose", "docker-compose.yml")
+}
+
+// aptPackage is a package with its pinned version split off
+type aptPackage struct {
+	Name, Version string
+}
+
+// render executes an export template with the bundle and what every export
+// repeats: the storage note, the compose file and Docker's repository
+func (b *Bundle) render(name string) string {
+	var pinnedPackages []aptPackage
+	for _, pkg := range b.Packages {
+		name, version, _ := strings.Cut(pkg, "=")
+		pinnedPackages = append(pinnedPackages, aptPackage{name, version})
+	}
+	return templates.MustRender(name, struct {
+		*Bundle
+		StorageNote          []string
+		ComposeFile          string
+		DockerKeyURL         string
+		DockerKeyFingerprint string
+		Pinned               []aptPackage
+	}{b, strings.Split(b.storageNote(), "\n"), b.composeFile(), preflight.DockerKeyURL, preflight.DockerKeyFingerprint, pinnedPackages},
+		template.FuncMap{"base64": base64.StdEncoding.EncodeToString})
+}
+
+// Ansible renders a playbook that reproduces the setup. Generated files are
+// referenced from files/ next to the playbook (see Write).
+func Ansible(b *Bundle) string {
+	return b.render("system/ansible-playbook.yml.tmpl")
+}
+
+// Inventory renders an Ansible inventory pointing at the original host
+func Inventory(b *Bundle) string {
+	return b.render("system/ansible-inventory.ini.tmpl")
+}
+
+// CloudInit renders #cloud-config user-data that reproduces the setup on
+// first boot. Every generated file is embedded, credentials included.
+func CloudInit(b *Bundle) string {
+	return b.render("system/cloud-init.yaml.tmpl")
+}
+
+// Write saves the export for format under dir and returns the paths written.
+// Ansible gets playbook.yml, inventory.ini and files/; cloud-init gets
+// user-data.yaml. Everything is private to the user since it holds secrets.
+func Write(b *Bundle, format, dir string, dryRun bool) ([]string, error) {
+	outputs := map[string][]byte{}
+	switch format {
+	case "ansible":
+		outputs["playbook.yml"] = []byte(Ansible(b))
+		outputs["inventory.ini"] = []byte(Inventory(b))
+		for _, f := range b.Files {
+			outputs[filepath.Join("files", f.Path)] = f.Content
+		}
+	case "cloud-init":
+		outputs["user-data.yaml"] = []byte(CloudInit(b))
+	default:
+		return nil, fmt.Errorf("unknown export format %q (use %s)", format, strings.Join(Formats, " or "))
+	}
+
+	names := make([]string, 0, len(outputs))
+	for name := range outputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// The bundle holds the passwords: private directories, root-only files
+	var written []string
+	var steps []ops.Operation
+	made := make(map[string]bool)
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		if parent := filepath.Dir(path); !made[parent] {
+			made[parent] = true
+			steps = append(steps, ops.Mkdir{Path: parent, Mode: 0700})
+		}
+		steps = append(steps, ops.WriteFile{Path: path, Content: outputs[name], Mode: 0600, Secret: true})
+		written = append(written, path)
+	}
+	if err := ops.Execute(dryRun, steps...); err != nil {
+		return nil, err
+	}
+	return written, nil
+}
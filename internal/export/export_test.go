@@ -0,0 +1,151 @@
+package export
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/madhav/servctl/internal/compose"
+)
+
+// newSetup records a finished setup under a temporary home directory
+func newSetup(t *testing.T) string {
+	t.Helper()
+	infraRoot := filepath.Join(t.TempDir(), "infra")
+	config := compose.DefaultConfig()
+	config.InfraRoot = infraRoot
+	config.HostIP = "192.168.1.100"
+	config.ImmichDBPassword = "immich-db-pass"
+	config.PackageVersions = map[string]string{"docker-ce": "5:27.1.1-1~ubuntu.22.04~jammy"}
+	if err := compose.SaveState(config, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := compose.WriteAllConfigFiles(config, filepath.Join(infraRoot, "compose"), false); err != nil {
+		t.Fatal(err)
+	}
+	os.MkdirAll(filepath.Join(infraRoot, "scripts"), 0755)
+	os.WriteFile(filepath.Join(infraRoot, "scripts", "daily_backup.sh"), []byte("#!/bin/bash\necho backup\n"), 0755)
+	return infraRoot
+}
+
+func TestCollect(t *testing.T) {
+	infraRoot := newSetup(t)
+	b, err := Collect(infraRoot, "jane")
+	if err != nil {
+		t.Fatalf("Collect() error: %v", err)
+	}
+
+	files := map[string]File{}
+	for _, f := range b.Files {
+		files[f.Path] = f
+	}
+	env := files[filepath.Join(infraRoot, "compose", ".env")]
+	if !env.Owned || env.Mode != 0600 || !strings.Contains(string(env.Content), "immich-db-pass") {
+		t.Errorf(".env = %+v, want it owned by the user with mode 0600", env)
+	}
+	if script := files[filepath.Join(infraRoot, "scripts", "daily_backup.sh")]; script.Mode != 0755 {
+		t.Errorf("script mode = %o, want 0755", script.Mode)
+	}
+
+	if !strings.Contains(strings.Join(b.Packages, " "), "docker-ce=5:27.1.1-1~ubuntu.22.04~jammy") {
+		t.Errorf("Packages = %v, want docker-ce pinned to the recorded version", b.Packages)
+	}
+	foundGallery := false
+	for _, d := range b.Dirs {
+		foundGallery = foundGallery || d.Path == "/mnt/data/gallery"
+	}
+	if !foundGallery {
+		t.Error("Dirs should include the data directories compose mounts")
+	}
+
+	if _, err := Collect(t.TempDir(), "jane"); err == nil {
+		t.Error("Collect() should fail without saved state")
+	}
+}
+
+func TestAnsible(t *testing.T) {
+	b, err := Collect(newSetup(t), "jane")
+	if err != nil {
+		t.Fatal(err)
+	}
+	playbook := Ansible(b)
+	for _, check := range []string{
+		"hosts: servctl",
+		"servctl_user: jane",
+		"download.docker.com",
+		`path: "/mnt/data/gallery"`,
+		`src: "files{{ item.path }}"`,
+		"docker compose -f " + filepath.Join(b.Config.InfraRoot, "compose", "docker-compose.yml") + " up -d",
+		"mount the\n# data root at /mnt/data",
+	} {
+		if !strings.Contains(playbook, check) {
+			t.Errorf("playbook missing %q", check)
+		}
+	}
+	if strings.Contains(playbook, "immich-db-pass") {
+		t.Error("playbook should reference files/, not inline credentials")
+	}
+	if inv := Inventory(b); !strings.Contains(inv, "192.168.1.100 ansible_user=jane") {
+		t.Errorf("Inventory() = %q", inv)
+	}
+}
+
+func TestCloudInit(t *testing.T) {
+	b, err := Collect(newSetup(t), "jane")
+	if err != nil {
+		t.Fatal(err)
+	}
+	userData := CloudInit(b)
+	if !strings.HasPrefix(userData, "#cloud-config\n") {
+		t.Fatal("user-data must start with #cloud-config")
+	}
+	for _, check := range []string{
+		"  - name: jane",
+		"keyid: 9DC858229FC7DD38854AE2D88D81803C0EBFCD88",
+		`  - [docker-ce, "5:27.1.1-1~ubuntu.22.04~jammy"]`,
+		"    owner: jane:jane",
+		"  - [usermod, -aG, docker, jane]",
+		"up, -d]",
+	} {
+		if !strings.Contains(userData, check) {
+			t.Errorf("user-data missing %q", check)
+		}
+	}
+	// Files are embedded verbatim
+	env := base64.StdEncoding.EncodeToString(b.Files[1].Content)
+	if !strings.Contains(userData, "content: "+env) {
+		t.Error("user-data should embed each generated file as base64")
+	}
+}
+
+func TestWrite(t *testing.T) {
+	b, err := Collect(newSetup(t), "jane")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+
+	written, err := Write(b, "ansible", dir, false)
+	if err != nil {
+		t.Fatalf("Write() error: %v", err)
+	}
+	if len(written) != 2+len(b.Files) {
+		t.Errorf("Write() wrote %d files, want playbook, inventory and %d files", len(written), len(b.Files))
+	}
+	info, err := os.Stat(filepath.Join(dir, "files", b.Files[1].Path))
+	if err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("exported .env = %v, %v; want it private", info, err)
+	}
+
+	if written, _ := Write(b, "cloud-init", dir, true); len(written) != 1 {
+		t.Errorf("cloud-init dry run = %v", written)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "user-data.yaml")); !os.IsNotExist(err) {
+		t.Error("dry run wrote user-data.yaml")
+	}
+	if _, err := Write(b, "terraform", dir, false); err == nil {
+		t.Error("Write() should reject unknown formats")
+	}
+}
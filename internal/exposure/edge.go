@@ -0,0 +1,181 @@
+package exposure
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/madhav/servctl/internal/ops"
+	"github.com/madhav/servctl/templates"
+)
+
+// EdgeTable is the nftables table that guards the forwarded port
+const EdgeTable = "servctl_edge"
+
+// Files that load the rules at boot
+const (
+	EdgeRulesPath = "/etc/servctl/edge.nft"
+	EdgeUnitPath  = "/etc/systemd/system/servctl-edge.service"
+)
+
+// Limits for each source address. A browser opens a handful of
+// connections per page and the apps keep theirs open, so only scanners,
+// password guessers and scrapers go over.
+const (
+	edgeRate  = "30/minute"
+	edgeBurst = 60
+	edgeBan   = "15m"
+)
+
+// countryZoneURL lists a country's IPv4 ranges, by lower-case ISO code
+const countryZoneURL = "https://www.ipdeny.com/ipblocks/data/aggregated/%s-aggregated.zone"
+
+// countryTimeout bounds each list download
+const countryTimeout = 30 * time.Second
+
+// EdgeUnit returns the service that loads the rules at boot and removes
+// them when stopped
+func EdgeUnit() string {
+	return templates.MustRender("system/edge.service.tmpl", map[string]any{
+		"Port":  ForwardPort,
+		"Rules": EdgeRulesPath,
+		"Table": EdgeTable,
+	}, nil)
+}
+
+// EdgeCounterNames are the table's counters, in report order
+var EdgeCounterNames = []string{"rate_limited", "banned", "geo_blocked"}
+
+var countryCode = regexp.MustCompile(`^[A-Za-z]{2}$`)
+
+// ParseCountries reads a comma-separated list of ISO country codes
+func ParseCountries(list string) ([]string, error) {
+	var countries []string
+	for _, c := range strings.Split(list, ",") {
+		c = strings.TrimSpace(c)
+		if c == "" {
+			continue
+		}
+		if !countryCode.MatchString(c) {
+			return nil, fmt.Errorf("%q is not a two-letter country code (e.g. DE, US)", c)
+		}
+		countries = append(countries, strings.ToUpper(c))
+	}
+	return countries, nil
+}
+
+// CountryCIDRs downloads the IPv4 ranges of each country
+func CountryCIDRs(countries []string) ([]string, error) {
+	client := &http.Client{Timeout: countryTimeout}
+	var cidrs []string
+	for _, c := range countries {
+		resp, err := client.Get(fmt.Sprintf(countryZoneURL, strings.ToLower(c)))
+		if err != nil {
+			return nil, fmt.Errorf("cannot download the address ranges of %s: %w", c, err)
+		}
+		ranges, err := parseZone(bufio.NewScanner(resp.Body))
+		resp.Body.Close()
+		if err != nil || resp.StatusCode != http.StatusOK || len(ranges) == 0 {
+			return nil, fmt.Errorf("no address ranges for %s (HTTP %d)", c, resp.StatusCode)
+		}
+		cidrs = append(cidrs, ranges...)
+	}
+	return cidrs, nil
+}
+
+// parseZone reads one CIDR per line, skipping anything else
+func parseZone(scanner *bufio.Scanner) ([]string, error) {
+	var cidrs []string
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if _, ipNet, err := net.ParseCIDR(line); err == nil && ipNet.IP.To4() != nil {
+			cidrs = append(cidrs, ipNet.String())
+		}
+	}
+	return cidrs, scanner.Err()
+}
+
+// EdgeRules renders the nftables rules; cidrs are the allowed countries'
+// ranges, and every country is allowed when countries is empty
+func EdgeRules(countries, cidrs []string) (string, error) {
+	return templates.Render("system/edge.nft.tmpl", map[string]any{
+		"Table":     EdgeTable,
+		"Port":      ForwardPort,
+		"Rate":      edgeRate,
+		"Burst":     edgeBurst,
+		"Ban":       edgeBan,
+		"Countries": countries,
+		"CIDRs":     cidrs,
+	}, nil)
+}
+
+// InstallEdge writes the rules and the unit that loads them, and loads
+// them now
+func InstallEdge(countries []string, dryRun bool) error {
+	var cidrs []string
+	if len(countries) > 0 && !dryRun {
+		var err error
+		if cidrs, err = CountryCIDRs(countries); err != nil {
+			return err
+		}
+	}
+	rules, err := EdgeRules(countries, cidrs)
+	if err != nil {
+		return err
+	}
+	return ops.Execute(dryRun,
+		ops.Mkdir{Path: filepath.Dir(EdgeRulesPath), Mode: 0755, Sudo: true},
+		ops.WriteFile{Path: EdgeRulesPath, Content: []byte(rules), Mode: 0644, Sudo: true},
+		ops.WriteFile{Path: EdgeUnitPath, Content: []byte(EdgeUnit()), Mode: 0644, Sudo: true},
+		ops.Command{Args: []string{"sudo", "systemctl", "daemon-reload"}},
+		ops.Command{Args: []string{"sudo", "systemctl", "enable", "servctl-edge.service"}},
+		// restart, so changed rules replace loaded ones
+		ops.Command{Args: []string{"sudo", "systemctl", "restart", "servctl-edge.service"}})
+}
+
+// RemoveEdge unloads the rules and deletes them
+func RemoveEdge(dryRun bool) error {
+	var steps []ops.Operation
+	if _, err := exec.Command("systemctl", "cat", "servctl-edge.service").Output(); err == nil {
+		steps = append(steps, ops.Command{Args: []string{"sudo", "systemctl", "disable", "--now", "servctl-edge.service"}})
+	}
+	steps = append(steps,
+		ops.Remove{Path: EdgeUnitPath, Sudo: true},
+		ops.Remove{Path: EdgeRulesPath, Sudo: true},
+		ops.Command{Args: []string{"sudo", "systemctl", "daemon-reload"}})
+	return ops.Execute(dryRun, steps...)
+}
+
+// counterPackets matches "packets 12 bytes 720" in 'nft list counter'
+var counterPackets = regexp.MustCompile(`packets (\d+)`)
+
+// ParseCounter reads the packet count from 'nft list counter' output
+func ParseCounter(output string) int {
+	m := counterPackets.FindStringSubmatch(output)
+	if m == nil {
+		return 0
+	}
+	n, _ := strconv.Atoi(m[1])
+	return n
+}
+
+// EdgeCounters returns how many connection attempts each rule dropped
+// since the rules were loaded or the weekly report reset them
+func EdgeCounters() (map[string]int, error) {
+	counters := make(map[string]int)
+	for _, name := range EdgeCounterNames {
+		output, err := exec.Command("sudo", "-n", "nft", "list", "counter", "inet", EdgeTable, name).CombinedOutput()
+		if err != nil {
+			return nil, fmt.Errorf("cannot read the %s counters: %s", EdgeTable, lastLine(string(output)))
+		}
+		counters[name] = ParseCounter(string(output))
+	}
+	return counters, nil
+}
@@ -0,0 +1,268 @@
+// Package exposure finds out whether the services' web interfaces can be
+// reached from the internet. The router is asked over UPnP which ports it
+// forwards to this machine, and an SSH relay outside the LAN (a VPS, a
+// friend's server) can try the ports from where an attacker would. The
+// services speak plain HTTP on their ports; anything reachable there from
+// outside bypasses the tunnel and TLS that remote access is meant to use.
+package exposure
+
+import (
+	"fmt"
+	"net"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/madhav/servctl/internal/compose"
+)
+
+// Package provides upnpc, the UPnP client the router is asked with
+const Package = "miniupnpc"
+
+// criticalServices hand out logins or the machine's inner workings to
+// anyone who reaches them: Nextcloud's login page over plain HTTP, and
+// Glances, which has no login at all
+var criticalServices = map[string]bool{"Nextcloud": true, "Glances": true}
+
+// Service is a web interface served over plain HTTP on Port
+type Service struct {
+	Name string
+	Port int
+}
+
+// Critical reports whether exposing the service is an emergency rather
+// than a mistake to fix
+func (s Service) Critical() bool {
+	return criticalServices[s.Name]
+}
+
+// Services returns the configuration's plain-HTTP interfaces: every
+// published port but SSH and DNS
+func Services(config *compose.ServiceConfig) []Service {
+	var services []Service
+	for _, p := range config.ServicePorts() {
+		if p.Service == "SSH" || p.Service == "dnsmasq" {
+			continue
+		}
+		services = append(services, Service{Name: p.Service, Port: p.Port})
+	}
+	return services
+}
+
+// Mapping is one port the router forwards, as UPnP lists it
+type Mapping struct {
+	Protocol    string // "TCP" or "UDP"
+	External    int
+	InternalIP  string
+	Internal    int
+	Description string
+}
+
+// Finding is a service reachable from the internet
+type Finding struct {
+	Service  Service
+	External string // Where it is reached, e.g. "203.0.113.5:8080"
+	Via      string // How it was found, e.g. "UPnP forward 'nextcloud'"
+}
+
+// String describes the finding for reports and alerts
+func (f Finding) String() string {
+	return fmt.Sprintf("%s (port %d) is reachable from the internet at %s over plain HTTP (%s)",
+		f.Service.Name, f.Service.Port, f.External, f.Via)
+}
+
+// Report is the result of a check
+type Report struct {
+	UPnP       bool   // A router answered over UPnP
+	UPnPError  string `json:",omitempty"`
+	ExternalIP string `json:",omitempty"`
+	Mappings   []Mapping
+	Relay      string `json:",omitempty"`
+	RelayError string `json:",omitempty"`
+	Probed     []int  `json:",omitempty"` // Ports tried through the relay
+	Findings   []Finding
+}
+
+// Critical returns the findings for critical services
+func (r Report) Critical() []Finding {
+	var out []Finding
+	for _, f := range r.Findings {
+		if f.Service.Critical() {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+var (
+	// upnpMapping matches a line of 'upnpc -l', e.g.
+	// " 0 TCP  8080->192.168.1.10:8080  'nextcloud' '' 0"
+	upnpMapping = regexp.MustCompile(`^\s*\d+\s+(TCP|UDP)\s+(\d+)->([\d.]+):(\d+)\s+'([^']*)'`)
+	upnpExtIP   = regexp.MustCompile(`ExternalIPAddress\s*=\s*([\d.]+)`)
+)
+
+// ParseUPnPList reads 'upnpc -l': the router's external address and every
+// port it forwards
+func ParseUPnPList(output string) (string, []Mapping) {
+	externalIP := ""
+	if m := upnpExtIP.FindStringSubmatch(output); m != nil {
+		externalIP = m[1]
+	}
+	var mappings []Mapping
+	for _, line := range strings.Split(output, "\n") {
+		m := upnpMapping.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		external, _ := strconv.Atoi(m[2])
+		internal, _ := strconv.Atoi(m[4])
+		mappings = append(mappings, Mapping{Protocol: m[1], External: external, InternalIP: m[3], Internal: internal, Description: m[5]})
+	}
+	return externalIP, mappings
+}
+
+// UPnPMappings asks the router for its forwards with upnpc
+func UPnPMappings() (string, []Mapping, error) {
+	if _, err := exec.LookPath("upnpc"); err != nil {
+		return "", nil, fmt.Errorf("upnpc is not installed (apt install %s)", Package)
+	}
+	output, err := exec.Command("upnpc", "-l").CombinedOutput()
+	if strings.Contains(string(output), "No IGD UPnP Device") {
+		return "", nil, fmt.Errorf("no router answered over UPnP (it may be turned off, which is safer)")
+	}
+	externalIP, mappings := ParseUPnPList(string(output))
+	if err != nil && externalIP == "" && len(mappings) == 0 {
+		return "", nil, fmt.Errorf("upnpc -l failed: %w", err)
+	}
+	return externalIP, mappings, nil
+}
+
+// HostIPs returns this machine's IPv4 addresses, which forwards to it
+// point at
+func HostIPs() []string {
+	var ips []string
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.To4() != nil && !ipNet.IP.IsLoopback() {
+			ips = append(ips, ipNet.IP.String())
+		}
+	}
+	return ips
+}
+
+// Forwarded returns the services a TCP mapping forwards to on one of
+// hostIPs
+func Forwarded(services []Service, hostIPs []string, externalIP string, mappings []Mapping) []Finding {
+	ours := make(map[string]bool, len(hostIPs))
+	for _, ip := range hostIPs {
+		ours[ip] = true
+	}
+	if externalIP == "" {
+		externalIP = "the router"
+	}
+	var findings []Finding
+	for _, s := range services {
+		for _, m := range mappings {
+			if m.Protocol == "TCP" && m.Internal == s.Port && ours[m.InternalIP] {
+				findings = append(findings, Finding{
+					Service:  s,
+					External: net.JoinHostPort(externalIP, strconv.Itoa(m.External)),
+					Via:      fmt.Sprintf("UPnP forward %q", m.Description),
+				})
+			}
+		}
+	}
+	return findings
+}
+
+// relayCommand runs command on relay over SSH without prompting
+func relayCommand(relay string, command ...string) *exec.Cmd {
+	args := append([]string{"-o", "BatchMode=yes", "-o", "ConnectTimeout=10", relay}, command...)
+	return exec.Command("ssh", args...)
+}
+
+// RelayPublicIP asks relay which address this machine's connection came
+// from: the address the internet sees
+func RelayPublicIP(relay string) (string, error) {
+	output, err := relayCommand(relay, `echo "${SSH_CLIENT%% *}"`).Output()
+	if err != nil {
+		return "", fmt.Errorf("cannot log in to %s without a password (set up an SSH key): %w", relay, err)
+	}
+	ip := strings.TrimSpace(string(output))
+	if net.ParseIP(ip) == nil {
+		return "", fmt.Errorf("%s did not report this machine's address", relay)
+	}
+	return ip, nil
+}
+
+// RelayProbe reports whether relay can open a TCP connection to host:port
+func RelayProbe(relay, host string, port int) (bool, error) {
+	err := relayCommand(relay, "nc", "-z", "-w", "5", host, strconv.Itoa(port)).Run()
+	if err == nil {
+		return true, nil
+	}
+	// nc exits 1 for a closed port; ssh exits 255 for its own failures
+	if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 {
+		return false, nil
+	}
+	return false, fmt.Errorf("probe through %s failed (is nc installed there?): %w", relay, err)
+}
+
+// Check asks the router which services it forwards and, when relay is
+// set, tries the other services' ports from outside
+func Check(services []Service, relay string) Report {
+	report := Report{Relay: relay}
+	externalIP, mappings, err := UPnPMappings()
+	if err != nil {
+		report.UPnPError = err.Error()
+	} else {
+		report.UPnP = true
+		report.ExternalIP = externalIP
+	}
+	hostIPs := HostIPs()
+	for _, m := range mappings {
+		for _, ip := range hostIPs {
+			if m.InternalIP == ip {
+				report.Mappings = append(report.Mappings, m)
+			}
+		}
+	}
+	report.Findings = Forwarded(services, hostIPs, externalIP, report.Mappings)
+
+	if relay == "" {
+		return report
+	}
+	publicIP, err := RelayPublicIP(relay)
+	if err != nil {
+		report.RelayError = err.Error()
+		return report
+	}
+	report.ExternalIP = publicIP
+	found := make(map[int]bool)
+	for _, f := range report.Findings {
+		found[f.Service.Port] = true
+	}
+	for _, s := range services {
+		if found[s.Port] {
+			continue
+		}
+		open, err := RelayProbe(relay, publicIP, s.Port)
+		if err != nil {
+			report.RelayError = err.Error()
+			break
+		}
+		report.Probed = append(report.Probed, s.Port)
+		if open {
+			report.Findings = append(report.Findings, Finding{
+				Service:  s,
+				External: net.JoinHostPort(publicIP, strconv.Itoa(s.Port)),
+				Via:      "answered a connection from " + relay,
+			})
+		}
+	}
+	return report
+}
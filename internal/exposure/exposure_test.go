@@ -0,0 +1,203 @@
+package exposure
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+const upnpcList = `upnpc : miniupnpc library test client, version 2.2.4.
+ (c) 2005-2022 Thomas Bernard.
+List of UPNP devices found on the network :
+ desc: http://192.168.1.1:5000/rootDesc.xml
+ st: urn:schemas-upnp-org:device:InternetGatewayDevice:1
+
+Found valid IGD : http://192.168.1.1:5000/ctl/IPConn
+Local LAN ip address : 192.168.1.10
+Connection Type : IP_Routed
+Status : Connected, uptime=86400s, LastConnectionError : ERROR_NONE
+ExternalIPAddress = 203.0.113.5
+ i protocol exPort->inAddr:inPort description remoteHost leaseTime
+ 0 TCP  8080->192.168.1.10:8080  'nextcloud' '' 0
+ 1 UDP 51820->192.168.1.20:51820 'WireGuard' '' 0
+ 2 TCP 61208->192.168.1.10:61208 'glances' '' 3600
+ 3 TCP  2283->192.168.1.30:2283  'other-nas' '' 0
+GetGenericPortMappingEntry() returned 713 (SpecifiedArrayIndexInvalid)
+`
+
+func TestParseUPnPList(t *testing.T) {
+	ip, mappings := ParseUPnPList(upnpcList)
+	if ip != "203.0.113.5" {
+		t.Errorf("external IP = %q", ip)
+	}
+	if len(mappings) != 4 {
+		t.Fatalf("mappings = %+v, want 4", mappings)
+	}
+	want := Mapping{Protocol: "TCP", External: 61208, InternalIP: "192.168.1.10", Internal: 61208, Description: "glances"}
+	if mappings[2] != want {
+		t.Errorf("mapping = %+v, want %+v", mappings[2], want)
+	}
+}
+
+func TestForwarded(t *testing.T) {
+	ip, mappings := ParseUPnPList(upnpcList)
+	services := []Service{{"Immich", 2283}, {"Nextcloud", 8080}, {"Glances", 61208}}
+
+	findings := Forwarded(services, []string{"192.168.1.10"}, ip, mappings)
+	if len(findings) != 2 {
+		t.Fatalf("findings = %+v, want Nextcloud and Glances", findings)
+	}
+	// Immich's port is forwarded, but to another machine
+	for _, f := range findings {
+		if f.Service.Name == "Immich" {
+			t.Errorf("a forward to another host was attributed to this one: %v", f)
+		}
+		if !f.Service.Critical() {
+			t.Errorf("%s should be critical", f.Service.Name)
+		}
+	}
+	if got := findings[0].String(); !strings.Contains(got, "203.0.113.5:8080") || !strings.Contains(got, `"nextcloud"`) {
+		t.Errorf("finding = %q", got)
+	}
+
+	r := Report{Findings: append(findings, Finding{Service: Service{"Immich", 2283}})}
+	if len(r.Critical()) != 2 {
+		t.Errorf("Critical() = %v", r.Critical())
+	}
+}
+
+func TestParseNATPMP(t *testing.T) {
+	output := `initnatpmp() returned 0 (SUCCESS)
+using gateway : 192.168.1.1
+sendpublicaddressrequest returned 2 (SUCCESS)
+readnatpmpresponseorretry returned 0 (OK)
+Public IP address : 203.0.113.5
+epoch = 58123
+sendnewportmappingrequest returned 12 (SUCCESS)
+readnatpmpresponseorretry returned 0 (OK)
+Mapped public port 443 protocol TCP to local port 443 liftime 3600
+epoch = 58123
+closenatpmp() returned 0 (SUCCESS)
+`
+	if ip, mapped := ParseNATPMP(output); ip != "203.0.113.5" || !mapped {
+		t.Errorf("ParseNATPMP() = %q, %v; want 203.0.113.5, true", ip, mapped)
+	}
+	if _, mapped := ParseNATPMP("readnatpmpresponseorretry returned -7 (FAILED)\n"); mapped {
+		t.Error("a failed request was read as mapped")
+	}
+}
+
+func TestBehindCGNAT(t *testing.T) {
+	for ip, want := range map[string]bool{
+		"203.0.113.5":  false,
+		"100.72.14.3":  true,
+		"192.168.0.10": true,
+		"10.0.0.1":     true,
+		"":             false,
+	} {
+		if got := BehindCGNAT(ip); got != want {
+			t.Errorf("BehindCGNAT(%q) = %v, want %v", ip, got, want)
+		}
+	}
+}
+
+func TestForwardUnit(t *testing.T) {
+	unit := ForwardUnit(MethodUPnP, "192.168.1.10")
+	if !strings.Contains(unit, "ExecStart=/usr/bin/upnpc -e servctl-https -a 192.168.1.10 443 443 TCP 3600\n") {
+		t.Errorf("UPnP unit:\n%s", unit)
+	}
+	unit = ForwardUnit(MethodNATPMP, "192.168.1.10")
+	if !strings.Contains(unit, "ExecStart=/usr/bin/natpmpc -a 443 443 tcp 3600\n") ||
+		!strings.Contains(unit, "Description=Renew the router's port 443 forward to this machine (natpmp)\n") {
+		t.Errorf("NAT-PMP unit:\n%s", unit)
+	}
+}
+
+func TestForwardTimer(t *testing.T) {
+	want := `# Generated by servctl - renews the router's HTTPS forward
+[Unit]
+Description=Renew the router's port 443 forward to this machine
+
+[Timer]
+OnBootSec=1min
+OnUnitActiveSec=20min
+
+[Install]
+WantedBy=timers.target
+`
+	if got := ForwardTimer(); got != want {
+		t.Errorf("ForwardTimer() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestParseCountries(t *testing.T) {
+	countries, err := ParseCountries("de, at,,CH")
+	if err != nil || strings.Join(countries, ",") != "DE,AT,CH" {
+		t.Errorf("ParseCountries() = %v, %v", countries, err)
+	}
+	if _, err := ParseCountries("Germany"); err == nil {
+		t.Error("ParseCountries accepted a country name")
+	}
+}
+
+func TestParseZone(t *testing.T) {
+	zone := "2.16.0.0/13\n# comment\n5.1.48.0/21\n2001:db8::/32\n"
+	cidrs, err := parseZone(bufio.NewScanner(strings.NewReader(zone)))
+	if err != nil || strings.Join(cidrs, " ") != "2.16.0.0/13 5.1.48.0/21" {
+		t.Errorf("parseZone() = %v, %v", cidrs, err)
+	}
+}
+
+func TestEdgeRules(t *testing.T) {
+	rules, err := EdgeRules(nil, nil)
+	if err != nil {
+		t.Fatalf("EdgeRules() error: %v", err)
+	}
+	for _, want := range []string{
+		"#!/usr/sbin/nft -f\n",
+		"table inet servctl_edge {",
+		"tcp dport 443 ip saddr @banned_v4 counter name banned drop",
+		"limit rate over 30/minute burst 60 packets",
+	} {
+		if !strings.Contains(rules, want) {
+			t.Errorf("rules are missing %q:\n%s", want, rules)
+		}
+	}
+	if strings.Contains(rules, "allowed_v4") {
+		t.Error("rules filter by country without countries")
+	}
+
+	rules, err = EdgeRules([]string{"DE"}, []string{"2.16.0.0/13", "5.1.48.0/21"})
+	if err != nil {
+		t.Fatalf("EdgeRules() error: %v", err)
+	}
+	for _, want := range []string{
+		"127.0.0.0/8,\n\t\t\t2.16.0.0/13,\n\t\t\t5.1.48.0/21\n\t\t}",
+		"tcp dport 443 ip saddr != @allowed_v4 counter name geo_blocked drop",
+	} {
+		if !strings.Contains(rules, want) {
+			t.Errorf("rules are missing %q:\n%s", want, rules)
+		}
+	}
+}
+
+func TestEdgeUnit(t *testing.T) {
+	unit := EdgeUnit()
+	for _, want := range []string{
+		"Description=servctl rate limits and country filter for port 443\n",
+		"ExecStart=/usr/sbin/nft -f /etc/servctl/edge.nft\n",
+		"ExecStop=/usr/sbin/nft delete table inet servctl_edge\n",
+		"Before=network.target\n",
+	} {
+		if !strings.Contains(unit, want) {
+			t.Errorf("edge unit missing %q:\n%s", want, unit)
+		}
+	}
+}
+
+func TestParseCounter(t *testing.T) {
+	output := "table inet servctl_edge {\n\tcounter banned {\n\t\tpackets 12 bytes 720\n\t}\n}\n"
+	if got := ParseCounter(output); got != 12 {
+		t.Errorf("ParseCounter() = %d, want 12", got)
+	}
+}
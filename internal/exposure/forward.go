@@ -0,0 +1,247 @@
+package exposure
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/madhav/servctl/internal/ops"
+	"github.com/madhav/servctl/templates"
+)
+
+// ForwardPort is the only port servctl asks the router to forward: HTTPS,
+// for a TLS reverse proxy on this machine. The services' own plain-HTTP
+// ports are never forwarded.
+const ForwardPort = 443
+
+// NATPMPPackage provides natpmpc, for routers that speak NAT-PMP (Apple
+// routers, many OpenWrt and pfSense setups) rather than UPnP
+const NATPMPPackage = "natpmpc"
+
+// Ways of asking the router for the forward, as saved in the configuration
+const (
+	MethodUPnP   = "upnp"
+	MethodNATPMP = "natpmp"
+)
+
+// forwardLease is how many seconds the router keeps the forward unless it
+// is renewed; the timer renews it three times per lease, so a router that
+// restarts or forgets loses it for at most 20 minutes, and one that is
+// replaced drops it within the hour
+const forwardLease = 3600
+
+// forwardDescription names the forward in the router's list
+const forwardDescription = "servctl-https"
+
+// Units that renew the forward
+const (
+	ForwardUnitPath  = "/etc/systemd/system/servctl-port-forward.service"
+	ForwardTimerPath = "/etc/systemd/system/servctl-port-forward.timer"
+)
+
+// ForwardTimer returns the timer that renews the lease every 20 minutes,
+// and shortly after boot
+func ForwardTimer() string {
+	return templates.MustRender("system/port-forward.timer.tmpl", map[string]any{"Port": ForwardPort}, nil)
+}
+
+// forwardArgs returns the command that asks the router to forward
+// ForwardPort to hostIP for lease seconds; a lease of 0 removes the
+// NAT-PMP mapping
+func forwardArgs(method, hostIP string, lease int) []string {
+	port := strconv.Itoa(ForwardPort)
+	if method == MethodNATPMP {
+		// NAT-PMP always maps to the host that asks
+		return []string{"natpmpc", "-a", port, port, "tcp", strconv.Itoa(lease)}
+	}
+	return []string{"upnpc", "-e", forwardDescription, "-a", hostIP, port, port, "TCP", strconv.Itoa(lease)}
+}
+
+// removeArgs returns the command that deletes the forward
+func removeArgs(method string) []string {
+	if method == MethodNATPMP {
+		return forwardArgs(method, "", 0)
+	}
+	return []string{"upnpc", "-d", strconv.Itoa(ForwardPort), "TCP"}
+}
+
+// ForwardUnit returns the oneshot service the timer runs to renew the
+// forward
+func ForwardUnit(method, hostIP string) string {
+	return templates.MustRender("system/port-forward.service.tmpl", map[string]any{
+		"Port":    ForwardPort,
+		"Method":  method,
+		"Command": forwardArgs(method, hostIP, forwardLease),
+	}, nil)
+}
+
+// Listening reports whether something accepts connections on ForwardPort
+// at hostIP, the reverse proxy the forward is for
+func Listening(hostIP string) bool {
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(hostIP, strconv.Itoa(ForwardPort)), 3*time.Second)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// natpmpPublicIP matches natpmpc's "Public IP address : 203.0.113.5"
+var natpmpPublicIP = regexp.MustCompile(`Public IP address\s*:\s*([\d.]+)`)
+
+// ParseNATPMP reads natpmpc's output: the router's external address and
+// whether it confirmed the mapping
+func ParseNATPMP(output string) (string, bool) {
+	externalIP := ""
+	if m := natpmpPublicIP.FindStringSubmatch(output); m != nil {
+		externalIP = m[1]
+	}
+	mapped := strings.Contains(output, fmt.Sprintf("Mapped public port %d protocol TCP", ForwardPort))
+	return externalIP, mapped
+}
+
+// AddForward asks the router to forward ForwardPort to hostIP, over UPnP
+// when it answers and NAT-PMP otherwise. It returns the method that
+// worked and the router's external address, both empty in a dry run.
+func AddForward(hostIP string, dryRun bool) (string, string, error) {
+	var method, externalIP string
+	err := ops.Execute(dryRun, ops.Func{
+		Description: fmt.Sprintf("ask the router to forward port %d to %s over UPnP, or NAT-PMP", ForwardPort, hostIP),
+		Fn: func() error {
+			var err error
+			method, externalIP, err = addForward(hostIP)
+			return err
+		},
+	})
+	return method, externalIP, err
+}
+
+// addForward tries UPnP, then NAT-PMP
+func addForward(hostIP string) (string, string, error) {
+	var failures []string
+	if _, err := exec.LookPath("upnpc"); err == nil {
+		args := forwardArgs(MethodUPnP, hostIP, forwardLease)
+		output, err := exec.Command(args[0], args[1:]...).CombinedOutput()
+		externalIP, ferr := forwardedTo(hostIP)
+		if ferr == nil {
+			return MethodUPnP, externalIP, nil
+		}
+		if err != nil {
+			failures = append(failures, "UPnP: "+lastLine(string(output)))
+		} else {
+			failures = append(failures, "UPnP: "+ferr.Error())
+		}
+	}
+	if _, err := exec.LookPath("natpmpc"); err == nil {
+		args := forwardArgs(MethodNATPMP, hostIP, forwardLease)
+		output, _ := exec.Command(args[0], args[1:]...).CombinedOutput()
+		if externalIP, mapped := ParseNATPMP(string(output)); mapped {
+			return MethodNATPMP, externalIP, nil
+		}
+		failures = append(failures, "NAT-PMP: "+lastLine(string(output)))
+	}
+	if len(failures) == 0 {
+		return "", "", fmt.Errorf("neither upnpc nor natpmpc is installed (apt install %s %s)", Package, NATPMPPackage)
+	}
+	return "", "", fmt.Errorf("the router refused the forward (%s)", strings.Join(failures, "; "))
+}
+
+// forwardedTo checks the router's UPnP list for ForwardPort pointing at
+// hostIP and returns the router's external address
+func forwardedTo(hostIP string) (string, error) {
+	externalIP, mappings, err := UPnPMappings()
+	if err != nil {
+		return "", err
+	}
+	for _, m := range mappings {
+		if m.Protocol == "TCP" && m.External == ForwardPort {
+			if m.InternalIP != hostIP || m.Internal != ForwardPort {
+				return "", fmt.Errorf("port %d is forwarded to %s:%d, not this machine", ForwardPort, m.InternalIP, m.Internal)
+			}
+			return externalIP, nil
+		}
+	}
+	return "", fmt.Errorf("the router does not list the port %d forward", ForwardPort)
+}
+
+// ForwardStatus reports whether the router still holds the forward made
+// with method. NAT-PMP has no list, so the mapping is requested again,
+// which also renews it.
+func ForwardStatus(method, hostIP string) (string, error) {
+	if method == MethodUPnP {
+		return forwardedTo(hostIP)
+	}
+	args := forwardArgs(method, hostIP, forwardLease)
+	output, _ := exec.Command(args[0], args[1:]...).CombinedOutput()
+	externalIP, mapped := ParseNATPMP(string(output))
+	if !mapped {
+		return "", fmt.Errorf("the router did not confirm the forward: %s", lastLine(string(output)))
+	}
+	return externalIP, nil
+}
+
+// cgnat is the shared address space carriers put customers behind
+var cgnat = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// BehindCGNAT reports whether the router's external address is itself a
+// private one: the carrier's NAT sits in front, and no forward on this
+// router makes a port reachable from the internet
+func BehindCGNAT(externalIP string) bool {
+	ip := net.ParseIP(externalIP)
+	return ip != nil && (ip.IsPrivate() || cgnat.Contains(ip))
+}
+
+// Reachable tries ForwardPort from relay, a host outside the LAN, against
+// the address it sees this network connect from
+func Reachable(relay string) (string, bool, error) {
+	publicIP, err := RelayPublicIP(relay)
+	if err != nil {
+		return "", false, err
+	}
+	open, err := RelayProbe(relay, publicIP, ForwardPort)
+	return publicIP, open, err
+}
+
+// RemoveForward deletes the forward from the router
+func RemoveForward(method string, dryRun bool) error {
+	return ops.Execute(dryRun, ops.Command{Args: removeArgs(method)})
+}
+
+// InstallRenewal writes and starts the timer that keeps the lease alive,
+// renewing it once right away
+func InstallRenewal(method, hostIP string, dryRun bool) error {
+	return ops.Execute(dryRun,
+		ops.WriteFile{Path: ForwardUnitPath, Content: []byte(ForwardUnit(method, hostIP)), Mode: 0644, Sudo: true},
+		ops.WriteFile{Path: ForwardTimerPath, Content: []byte(ForwardTimer()), Mode: 0644, Sudo: true},
+		ops.Command{Args: []string{"sudo", "systemctl", "daemon-reload"}},
+		ops.Command{Args: []string{"sudo", "systemctl", "enable", "--now", "servctl-port-forward.timer"}},
+		ops.Command{Args: []string{"sudo", "systemctl", "start", "servctl-port-forward.service"}})
+}
+
+// RemoveRenewal stops the timer and deletes its units
+func RemoveRenewal(dryRun bool) error {
+	var steps []ops.Operation
+	if _, err := os.Stat(ForwardTimerPath); err == nil {
+		steps = append(steps, ops.Command{Args: []string{"sudo", "systemctl", "disable", "--now", "servctl-port-forward.timer"}})
+	}
+	steps = append(steps,
+		ops.Remove{Path: ForwardTimerPath, Sudo: true},
+		ops.Remove{Path: ForwardUnitPath, Sudo: true},
+		ops.Command{Args: []string{"sudo", "systemctl", "daemon-reload"}})
+	return ops.Execute(dryRun, steps...)
+}
+
+// lastLine returns the last non-empty line of a tool's output, where
+// upnpc and natpmpc put the error
+func lastLine(output string) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if last := strings.TrimSpace(lines[len(lines)-1]); last != "" {
+		return last
+	}
+	return "no answer"
+}
@@ -0,0 +1,228 @@
+// Package gitops keeps ~/infra under git, so every change servctl makes to
+// the server's configuration has history, can be diffed and can be pushed
+// to a private remote. Credentials never enter the history: files that are
+// all secrets are ignored, and generated files that embed them are redacted
+// by a git clean filter before they are stored.
+package gitops
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/madhav/servctl/internal/compose"
+	"github.com/madhav/servctl/internal/directory"
+	"github.com/madhav/servctl/internal/ops"
+	"github.com/madhav/servctl/internal/utils"
+)
+
+// Gitignore keeps secrets and bulky or machine-local data out of the repo
+const Gitignore = `# Managed by servctl: secrets and machine-local data stay out of git
+compose/.env
+compose/authentik/blueprints/
+servctl-state.json
+maintenance.json
+selfcheck.state
+maintenance_history.jsonl*
+.backup-key
+.inventory-key
+credentials.enc
+docs/setup-session.cast
+.trash/
+logs/
+backups/
+scrub/
+`
+
+// Gitattributes routes generated files that embed credentials through the
+// redaction filter
+const Gitattributes = `# Managed by servctl: credentials are redacted before they reach history
+compose/docker-compose.yml filter=servctl-redact
+scripts/** filter=servctl-redact
+`
+
+// redactFilter masks assignments to password/secret/token/webhook variables
+// and heartbeat URLs passed to curl. History shows the change, not the value.
+const redactFilter = `sed -E ` +
+	`-e 's/^([^#]*(PASSWORD|SECRET|TOKEN|WEBHOOK_?URL|HEARTBEAT_URL)[A-Z_]*=)("?)[^"]*("?)/\1\3<redacted>\4/' ` +
+	`-e 's#(curl [^"]*")https?://[^"]*(")#\1<redacted>\2#'`
+
+// autoPushKey is set in the repo config when commits should be pushed
+const autoPushKey = "servctl.autopush"
+
+// runGit runs git in infraRoot as the owner of ~/infra, so running servctl
+// under sudo never leaves root-owned objects in the repo
+var runGit = func(infraRoot string, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", append([]string{"-C", infraRoot}, args...)...)
+	if owner, err := directory.GetOwnerInfo(); err == nil && os.Geteuid() == 0 && owner.UID != 0 {
+		runAs(cmd, owner)
+		cmd.Env = append(os.Environ(), "HOME="+owner.HomeDir)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return output, fmt.Errorf("git %s: %w - %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return output, nil
+}
+
+// Enabled reports whether ~/infra is under git
+func Enabled(infraRoot string) bool {
+	_, err := os.Stat(filepath.Join(infraRoot, ".git"))
+	return err == nil
+}
+
+// Init makes infraRoot a git repository, configures the redaction filter and
+// records the current files. With a remote, commits are pushed there as well;
+// it should be private, since scripts and compose files still describe the
+// server's layout. Running it again updates the remote and managed files.
+func Init(infraRoot, remote string, dryRun bool) error {
+	description := "initialize a git repository in " + infraRoot
+	if remote != "" {
+		description += " that pushes to " + remote
+	}
+	return ops.Execute(dryRun, ops.Func{Description: description, Fn: func() error {
+		if !Enabled(infraRoot) {
+			if _, err := runGit(infraRoot, "init", "-q", "-b", "main"); err != nil {
+				return err
+			}
+		}
+		if err := writeManaged(filepath.Join(infraRoot, ".gitignore"), Gitignore); err != nil {
+			return err
+		}
+		if err := writeManaged(filepath.Join(infraRoot, ".gitattributes"), Gitattributes); err != nil {
+			return err
+		}
+		if _, err := runGit(infraRoot, "config", "filter.servctl-redact.clean", redactFilter); err != nil {
+			return err
+		}
+		// Commits need an identity; fall back to a local one if the user has none
+		if out, _ := runGit(infraRoot, "config", "user.email"); len(bytes.TrimSpace(out)) == 0 {
+			host, _ := os.Hostname()
+			runGit(infraRoot, "config", "user.name", "servctl")
+			runGit(infraRoot, "config", "user.email", "servctl@"+host)
+		}
+
+		if remote != "" {
+			args := []string{"remote", "add", "origin", remote}
+			if _, err := runGit(infraRoot, "remote", "get-url", "origin"); err == nil {
+				args[1] = "set-url"
+			}
+			if _, err := runGit(infraRoot, args...); err != nil {
+				return err
+			}
+			if _, err := runGit(infraRoot, "config", autoPushKey, "true"); err != nil {
+				return err
+			}
+		}
+
+		_, err := Commit(infraRoot, "Track ~/infra with servctl")
+		return err
+	}})
+}
+
+// writeManaged writes a servctl-managed dotfile, keeping any lines the user
+// added to an existing one
+func writeManaged(path, content string) error {
+	existing, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	have := make(map[string]bool)
+	for _, line := range strings.Split(content, "\n") {
+		have[line] = true
+	}
+	var extra []string
+	for _, line := range strings.Split(string(existing), "\n") {
+		if line != "" && !have[line] {
+			extra = append(extra, line)
+		}
+	}
+	if len(extra) > 0 {
+		content += "\n# Added locally\n" + strings.Join(extra, "\n") + "\n"
+	}
+	return utils.AtomicWrite(path, []byte(content), 0644)
+}
+
+// Commit records every change under infraRoot with message and pushes it
+// when a remote is configured. It does nothing when ~/infra is not under git
+// or nothing changed, and reports whether a commit was made. A commit that
+// would store one of the configuration's credentials is refused.
+func Commit(infraRoot, message string) (bool, error) {
+	if !Enabled(infraRoot) {
+		return false, nil
+	}
+	if _, err := runGit(infraRoot, "add", "-A"); err != nil {
+		return false, err
+	}
+	if _, err := runGit(infraRoot, "diff", "--cached", "--quiet"); err == nil {
+		return false, nil
+	}
+
+	if leaked := leakedFiles(infraRoot); len(leaked) > 0 {
+		runGit(infraRoot, "reset", "-q")
+		return false, fmt.Errorf("not committing: %s would store credentials in git history (add them to %s)",
+			strings.Join(leaked, ", "), filepath.Join(infraRoot, ".gitignore"))
+	}
+
+	if _, err := runGit(infraRoot, "commit", "-q", "-m", message); err != nil {
+		return false, err
+	}
+	if out, _ := runGit(infraRoot, "config", "--bool", autoPushKey); strings.TrimSpace(string(out)) == "true" {
+		if err := Push(infraRoot); err != nil {
+			return true, fmt.Errorf("committed, but %w", err)
+		}
+	}
+	return true, nil
+}
+
+// leakedFiles returns the staged files containing a credential from the
+// saved configuration, as git would store them (after redaction)
+func leakedFiles(infraRoot string) []string {
+	config, err := compose.LoadState(infraRoot)
+	if err != nil {
+		return nil
+	}
+	secrets := config.Secrets()
+	if len(secrets) == 0 {
+		return nil
+	}
+	args := []string{"grep", "--cached", "-l", "-F"}
+	for _, s := range secrets {
+		args = append(args, "-e", s)
+	}
+	out, err := runGit(infraRoot, args...)
+	if err != nil {
+		return nil // exit status 1: no matches
+	}
+	return strings.Fields(string(out))
+}
+
+// Push sends the history to the origin remote
+func Push(infraRoot string) error {
+	if !Enabled(infraRoot) {
+		return errors.New(infraRoot + " is not under git (run 'servctl -gitops init' first)")
+	}
+	if _, err := runGit(infraRoot, "remote", "get-url", "origin"); err != nil {
+		return errors.New("no remote configured (run 'servctl -gitops init URL')")
+	}
+	_, err := runGit(infraRoot, "push", "-q", "-u", "origin", "HEAD")
+	return err
+}
+
+// Log returns the most recent commits, one line each
+func Log(infraRoot string, n int) ([]string, error) {
+	if !Enabled(infraRoot) {
+		return nil, errors.New(infraRoot + " is not under git (run 'servctl -gitops init' first)")
+	}
+	out, err := runGit(infraRoot, "log", fmt.Sprintf("-%d", n), "--date=short", "--format=%h %ad %s")
+	if err != nil {
+		return nil, err
+	}
+	return strings.Split(strings.TrimSpace(string(out)), "\n"), nil
+}
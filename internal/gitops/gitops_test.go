@@ -0,0 +1,153 @@
+package gitops
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/madhav/servctl/internal/compose"
+)
+
+// newInfra builds a ~/infra with generated files and saved state
+func newInfra(t *testing.T) (string, *compose.ServiceConfig) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	infraRoot := t.TempDir()
+	config := compose.DefaultConfig()
+	config.InfraRoot = infraRoot
+	config.ImmichDBPassword = "immich-db-s3cret"
+	config.DiscordWebhookURL = "https://discord.com/api/webhooks/1/hook-s3cret"
+	if err := compose.SaveState(config, false); err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]string{
+		"compose/docker-compose.yml": "services:\n  immich-server:\n    environment:\n      - DB_PASSWORD=immich-db-s3cret\n      - DIUN_NOTIF_DISCORD_WEBHOOKURL=https://discord.com/api/webhooks/1/hook-s3cret\n",
+		"compose/.env":               "IMMICH_DB_PASSWORD=immich-db-s3cret\n",
+		"scripts/disk_alert.sh":      "#!/bin/bash\nWEBHOOK_URL=\"https://discord.com/api/webhooks/1/hook-s3cret\"\ncurl -fsS -o /dev/null \"https://hc-ping.com/hook-s3cret\"\n",
+		"logs/servctl.log":           "noise\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(infraRoot, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return infraRoot, config
+}
+
+func git(t *testing.T, infraRoot string, args ...string) string {
+	t.Helper()
+	out, err := runGit(infraRoot, args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
+
+func TestInit_RedactsAndIgnoresSecrets(t *testing.T) {
+	infraRoot, _ := newInfra(t)
+
+	if err := Init(infraRoot, "", false); err != nil {
+		t.Fatalf("Init() error: %v", err)
+	}
+	if !Enabled(infraRoot) {
+		t.Fatal("Enabled() = false after Init")
+	}
+
+	tracked := git(t, infraRoot, "ls-files")
+	for _, ignored := range []string{"compose/.env", "servctl-state.json", "logs/"} {
+		if strings.Contains(tracked, ignored) {
+			t.Errorf("%s should not be tracked:\n%s", ignored, tracked)
+		}
+	}
+	for _, name := range []string{"compose/docker-compose.yml", "scripts/disk_alert.sh"} {
+		stored := git(t, infraRoot, "show", "HEAD:"+name)
+		if strings.Contains(stored, "s3cret") || !strings.Contains(stored, "<redacted>") {
+			t.Errorf("%s stored unredacted:\n%s", name, stored)
+		}
+	}
+	// The working tree keeps the real values and looks unchanged to git
+	if data, _ := os.ReadFile(filepath.Join(infraRoot, "compose/docker-compose.yml")); !strings.Contains(string(data), "immich-db-s3cret") {
+		t.Error("working tree file was modified")
+	}
+	if status := git(t, infraRoot, "status", "--porcelain"); status != "" {
+		t.Errorf("tree not clean after Init:\n%s", status)
+	}
+
+	// Running it again is safe and keeps local .gitignore additions
+	os.WriteFile(filepath.Join(infraRoot, ".gitignore"), []byte(Gitignore+"notes/\n"), 0644)
+	if err := Init(infraRoot, "", false); err != nil {
+		t.Fatalf("second Init() error: %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(infraRoot, ".gitignore")); !strings.Contains(string(data), "notes/") {
+		t.Error("Init() dropped a local .gitignore line")
+	}
+}
+
+func TestCommit(t *testing.T) {
+	infraRoot, _ := newInfra(t)
+
+	if committed, err := Commit(infraRoot, "no repo"); committed || err != nil {
+		t.Errorf("Commit() without a repo = %v, %v; want a no-op", committed, err)
+	}
+	if err := Init(infraRoot, "", false); err != nil {
+		t.Fatal(err)
+	}
+	if committed, err := Commit(infraRoot, "nothing changed"); committed || err != nil {
+		t.Errorf("Commit() with no changes = %v, %v; want a no-op", committed, err)
+	}
+
+	os.WriteFile(filepath.Join(infraRoot, "compose/docker-compose.yml"), []byte("services: {}\n"), 0644)
+	if committed, err := Commit(infraRoot, "Regenerate compose files"); !committed || err != nil {
+		t.Fatalf("Commit() = %v, %v", committed, err)
+	}
+	if log, _ := Log(infraRoot, 1); len(log) != 1 || !strings.HasSuffix(log[0], "Regenerate compose files") {
+		t.Errorf("Log() = %v", log)
+	}
+
+	// A credential in a file the filter does not cover is refused
+	os.MkdirAll(filepath.Join(infraRoot, "config"), 0755)
+	os.WriteFile(filepath.Join(infraRoot, "config/notes.txt"), []byte("db: immich-db-s3cret\n"), 0644)
+	committed, err := Commit(infraRoot, "Add notes")
+	if committed || err == nil || !strings.Contains(err.Error(), "config/notes.txt") {
+		t.Errorf("Commit() with a leaked secret = %v, %v; want it refused", committed, err)
+	}
+	if staged := git(t, infraRoot, "diff", "--cached", "--name-only"); staged != "" {
+		t.Errorf("refused commit left files staged: %s", staged)
+	}
+}
+
+func TestPush(t *testing.T) {
+	infraRoot, _ := newInfra(t)
+	if err := Push(infraRoot); err == nil {
+		t.Error("Push() without a repo should fail")
+	}
+
+	remote := filepath.Join(t.TempDir(), "remote.git")
+	if out, err := exec.Command("git", "init", "-q", "--bare", remote).CombinedOutput(); err != nil {
+		t.Fatalf("git init --bare: %v %s", err, out)
+	}
+	if err := Init(infraRoot, remote, false); err != nil {
+		t.Fatalf("Init() with remote error: %v", err)
+	}
+	out, err := exec.Command("git", "-C", remote, "log", "--oneline", "main").Output()
+	if err != nil || !strings.Contains(string(out), "Track ~/infra") {
+		t.Errorf("remote log = %q, %v; want the initial commit pushed", out, err)
+	}
+}
+
+func TestInit_DryRun(t *testing.T) {
+	infraRoot := t.TempDir()
+	if err := Init(infraRoot, "git@example.com:me/infra.git", true); err != nil {
+		t.Fatal(err)
+	}
+	if Enabled(infraRoot) {
+		t.Error("dry run created a repository")
+	}
+}
@@ -0,0 +1,17 @@
+//go:build !windows
+
+package gitops
+
+import (
+	"os/exec"
+	"syscall"
+
+	"github.com/madhav/servctl/internal/directory"
+)
+
+// runAs makes cmd run with the owner's user and group IDs
+func runAs(cmd *exec.Cmd, owner *directory.PermissionInfo) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Credential: &syscall.Credential{Uid: uint32(owner.UID), Gid: uint32(owner.GID)},
+	}
+}
@@ -0,0 +1,10 @@
+package gitops
+
+import (
+	"os/exec"
+
+	"github.com/madhav/servctl/internal/directory"
+)
+
+// runAs is a no-op on Windows, where servctl never runs as root
+func runAs(cmd *exec.Cmd, owner *directory.PermissionInfo) {}
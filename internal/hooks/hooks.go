@@ -0,0 +1,84 @@
+// Package hooks posts servctl's own lifecycle events - setup started and
+// completed, a phase failing, configuration upgrades, rollbacks - as JSON to
+// a webhook, so automation such as n8n or Home Assistant can react to
+// changes in how the server is provisioned.
+package hooks
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/madhav/servctl/internal/ops"
+)
+
+// Event names
+const (
+	SetupStarted       = "setup.started"
+	SetupCompleted     = "setup.completed"      // Status "ok" or "partial"
+	PhaseFailed        = "setup.phase_failed"   // Critical failures stop the setup
+	UpgradeApplied     = "config.upgraded"      // -migrate-config
+	NetworkChanged     = "network.changed"      // -network-refresh moved the host IP
+	SnapshotRolledBack = "snapshot.rolled_back" // -snapshot rollback
+	ServiceExposed     = "network.exposed"      // -exposure found a service reachable from the internet
+	DiskEmergency      = "disk.emergency"       // disk_alert.sh found a mount over 95%
+)
+
+// sendTimeout bounds a delivery so a slow receiver cannot hold up a command
+const sendTimeout = 5 * time.Second
+
+// Event is the JSON body posted to the webhook
+type Event struct {
+	Event    string            `json:"event"`
+	Time     time.Time         `json:"time"`
+	Host     string            `json:"host"`
+	Version  string            `json:"servctl_version"`
+	Status   string            `json:"status,omitempty"`
+	Phase    string            `json:"phase,omitempty"`
+	Critical bool              `json:"critical,omitempty"`
+	Message  string            `json:"message,omitempty"`
+	Details  map[string]string `json:"details,omitempty"`
+}
+
+// Client delivers events to one webhook. A nil Client or one without a URL
+// drops every event, so callers need not check whether hooks are set up.
+type Client struct {
+	URL     string
+	Version string // servctl version, stamped on every event
+	DryRun  bool
+}
+
+// Send posts ev, filling in the time, host and version. Delivery is tried
+// once; the receiver must answer 2xx.
+func (c *Client) Send(ev Event) error {
+	if c == nil || c.URL == "" {
+		return nil
+	}
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	if ev.Host == "" {
+		ev.Host, _ = os.Hostname()
+	}
+	ev.Version = c.Version
+
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	return ops.Execute(c.DryRun, ops.Func{Description: "post " + ev.Event + " to " + c.URL, Fn: func() error {
+		client := &http.Client{Timeout: sendTimeout}
+		resp, err := client.Post(c.URL, "application/json", bytes.NewReader(body))
+		if err != nil {
+			return fmt.Errorf("event webhook: %w", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("event webhook answered %s", resp.Status)
+		}
+		return nil
+	}})
+}
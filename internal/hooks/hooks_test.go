@@ -0,0 +1,60 @@
+package hooks
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSend(t *testing.T) {
+	var got Event
+	var contentType string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("decode: %v", err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	c := &Client{URL: srv.URL, Version: "1.2.3"}
+	err := c.Send(Event{Event: PhaseFailed, Phase: "Storage Configuration", Critical: true, Message: "mount failed"})
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if contentType != "application/json" {
+		t.Errorf("Content-Type = %q", contentType)
+	}
+	if got.Event != PhaseFailed || got.Phase != "Storage Configuration" || !got.Critical {
+		t.Errorf("event = %+v", got)
+	}
+	if got.Version != "1.2.3" || got.Time.IsZero() || got.Host == "" {
+		t.Errorf("time, host and version should be filled in: %+v", got)
+	}
+}
+
+func TestSendReceiverError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	if err := (&Client{URL: srv.URL}).Send(Event{Event: SetupStarted}); err == nil {
+		t.Error("A 500 answer should be an error")
+	}
+}
+
+func TestSendWithoutWebhook(t *testing.T) {
+	var c *Client
+	if err := c.Send(Event{Event: SetupStarted}); err != nil {
+		t.Errorf("nil client: %v", err)
+	}
+	if err := (&Client{}).Send(Event{Event: SetupStarted}); err != nil {
+		t.Errorf("empty URL: %v", err)
+	}
+	if err := (&Client{URL: "http://127.0.0.1:1", DryRun: true}).Send(Event{Event: SetupStarted}); err != nil {
+		t.Errorf("dry run should not deliver: %v", err)
+	}
+}
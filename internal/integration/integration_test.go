@@ -42,9 +42,11 @@ func TestWizardFlow_SingleDisk(t *testing.T) {
 
 	// Phase 5: Maintenance Scripts
 	scriptSel := maintenance.DefaultScriptSelection()
+	// Daily backup, disk alert, weekly cleanup, self-check, restore drill,
+	// contacts export, config backup + restore
 	scripts, _ := maintenance.GetScriptsForSelection(scriptSel, maintenance.DefaultScriptConfig())
-	if len(scripts) != 3 {
-		t.Errorf("Default script selection should generate 3 scripts, got %d", len(scripts))
+	if len(scripts) != 8 {
+		t.Errorf("Default script selection should generate 8 scripts, got %d", len(scripts))
 	}
 }
 
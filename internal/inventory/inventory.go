@@ -0,0 +1,355 @@
+// Package inventory records what the deployed stack is made of after each
+// change: the exact image digests, a hash of the compose file, servctl's
+// version and the system packages it depends on. Records are kept in
+// ~/infra/inventory, one file per change, and signed with a key only
+// servctl reads, so 'servctl -inventory diff' can answer "what changed
+// since things last worked" from records nobody edited by hand.
+package inventory
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/madhav/servctl/internal/bootstrap"
+	"github.com/madhav/servctl/internal/utils"
+)
+
+// Dir holds the records, relative to InfraRoot
+const Dir = "inventory"
+
+// KeyFile holds the signing key, relative to InfraRoot. It stays out of
+// git and of the records it signs.
+const KeyFile = ".inventory-key"
+
+// fileLayout names each record after the time it was taken
+const fileLayout = "inventory-20060102-150405.json"
+
+// Image is one image the compose file names and what it resolved to
+type Image struct {
+	Ref    string // As the compose file names it, e.g. nextcloud:stable
+	Digest string `json:",omitempty"` // Registry digest it was pulled as
+	ID     string `json:",omitempty"` // Local image ID
+}
+
+// Inventory is the stack at one point in time
+type Inventory struct {
+	Time           time.Time
+	Reason         string // The change that was just made
+	Host           string
+	ServctlVersion string
+	Kernel         string
+	ComposeHash    string // SHA-256 of docker-compose.yml
+	Images         []Image
+	Packages       map[string]string `json:",omitempty"`
+}
+
+// record is a file in Dir
+type record struct {
+	Inventory Inventory
+	Signature string // HMAC-SHA256 of the Inventory's JSON
+}
+
+// Entry is a record on disk
+type Entry struct {
+	Path string
+	Time time.Time
+}
+
+// dockerImage is the part of 'docker image inspect' read here
+type dockerImage struct {
+	ID          string `json:"Id"`
+	RepoDigests []string
+}
+
+// resolveImages looks up each image's local ID and registry digest; images
+// not pulled yet are listed by name only
+func resolveImages(refs []string) []Image {
+	var images []Image
+	for _, ref := range refs {
+		image := Image{Ref: ref}
+		output, err := exec.Command("docker", "image", "inspect", ref).Output()
+		var inspected []dockerImage
+		if err == nil && json.Unmarshal(output, &inspected) == nil && len(inspected) == 1 {
+			image.ID = inspected[0].ID
+			if len(inspected[0].RepoDigests) > 0 {
+				image.Digest = inspected[0].RepoDigests[0]
+			}
+		}
+		images = append(images, image)
+	}
+	return images
+}
+
+// fileHash returns the hex SHA-256 of a file, empty when it cannot be read
+func fileHash(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Collect takes the inventory of the stack under infraRoot. packages are
+// the installed versions of servctl's dependencies.
+func Collect(infraRoot, version, reason string, packages map[string]string) Inventory {
+	host, _ := os.Hostname()
+	composeFile := filepath.Join(infraRoot, "compose", "docker-compose.yml")
+	inv := Inventory{
+		Time:           time.Now(),
+		Reason:         reason,
+		Host:           host,
+		ServctlVersion: version,
+		ComposeHash:    fileHash(composeFile),
+		Packages:       packages,
+	}
+	if output, err := exec.Command("uname", "-r").Output(); err == nil {
+		inv.Kernel = strings.TrimSpace(string(output))
+	}
+	if refs, err := bootstrap.ComposeImages(composeFile); err == nil {
+		inv.Images = resolveImages(refs)
+	}
+	return inv
+}
+
+// Same reports whether two inventories describe the same stack, whenever
+// and why they were taken. They are compared as they are stored, so a
+// record read back matches the inventory it was written from.
+func Same(a, b Inventory) bool {
+	a.Time, a.Reason, b.Time, b.Reason = time.Time{}, "", time.Time{}, ""
+	aJSON, errA := json.Marshal(a)
+	bJSON, errB := json.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(aJSON, bJSON)
+}
+
+// ensureKey returns the signing key, creating it on first use
+func ensureKey(infraRoot string) ([]byte, error) {
+	path := filepath.Join(infraRoot, KeyFile)
+	if data, err := os.ReadFile(path); err == nil {
+		return []byte(strings.TrimSpace(string(data))), nil
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("failed to generate the inventory key: %w", err)
+	}
+	key := hex.EncodeToString(secret)
+	if err := utils.AtomicWrite(path, []byte(key), 0600); err != nil {
+		return nil, fmt.Errorf("failed to write the inventory key: %w", err)
+	}
+	giveToOwner(path, infraRoot)
+	return []byte(key), nil
+}
+
+// sign returns the HMAC of the inventory's JSON under key
+func sign(inv Inventory, key []byte) (string, error) {
+	data, err := json.Marshal(inv)
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// giveToOwner hands a file servctl wrote under sudo to the owner of
+// ~/infra
+func giveToOwner(path, infraRoot string) {
+	if info, err := os.Stat(infraRoot); err == nil {
+		if uid, gid := utils.FileOwner(info); uid >= 0 {
+			os.Chown(path, uid, gid)
+		}
+	}
+}
+
+// Record signs inv and writes it to Dir, unless the newest record already
+// describes the same stack. It returns the new record's path, empty when
+// nothing changed.
+func Record(infraRoot string, inv Inventory) (string, error) {
+	entries, err := List(infraRoot)
+	if err != nil {
+		return "", err
+	}
+	key, err := ensureKey(infraRoot)
+	if err != nil {
+		return "", err
+	}
+	if len(entries) > 0 {
+		if last, _, err := load(entries[len(entries)-1].Path, key); err == nil && Same(last, inv) {
+			return "", nil
+		}
+	}
+
+	signature, err := sign(inv, key)
+	if err != nil {
+		return "", err
+	}
+	data, err := json.MarshalIndent(record{Inventory: inv, Signature: signature}, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(infraRoot, Dir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+	giveToOwner(dir, infraRoot)
+	path := filepath.Join(dir, inv.Time.Format(fileLayout))
+	if err := utils.AtomicWrite(path, append(data, '\n'), 0644); err != nil {
+		return "", fmt.Errorf("failed to write the inventory: %w", err)
+	}
+	giveToOwner(path, infraRoot)
+	return path, nil
+}
+
+// List returns the records, oldest first
+func List(infraRoot string) ([]Entry, error) {
+	files, err := filepath.Glob(filepath.Join(infraRoot, Dir, "inventory-*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var entries []Entry
+	for _, f := range files {
+		t, err := time.ParseInLocation(fileLayout, filepath.Base(f), time.Local)
+		if err != nil {
+			continue
+		}
+		entries = append(entries, Entry{Path: f, Time: t})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Time.Before(entries[j].Time) })
+	return entries, nil
+}
+
+// load reads a record and reports whether its signature matches
+func load(path string, key []byte) (Inventory, bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Inventory{}, false, err
+	}
+	var r record
+	if err := json.Unmarshal(data, &r); err != nil {
+		return Inventory{}, false, fmt.Errorf("%s is not an inventory record: %w", path, err)
+	}
+	want, err := sign(r.Inventory, key)
+	if err != nil {
+		return Inventory{}, false, err
+	}
+	return r.Inventory, hmac.Equal([]byte(want), []byte(r.Signature)), nil
+}
+
+// At returns the newest record taken at or before t, and whether its
+// signature matches. Without one, it is an error.
+func At(infraRoot string, t time.Time) (Inventory, bool, error) {
+	entries, err := List(infraRoot)
+	if err != nil {
+		return Inventory{}, false, err
+	}
+	var found *Entry
+	for i := range entries {
+		if !entries[i].Time.After(t) {
+			found = &entries[i]
+		}
+	}
+	if found == nil {
+		if len(entries) == 0 {
+			return Inventory{}, false, fmt.Errorf("no inventory recorded yet in %s", filepath.Join(infraRoot, Dir))
+		}
+		return Inventory{}, false, fmt.Errorf("no inventory before %s; the oldest is from %s",
+			t.Format("2006-01-02 15:04"), entries[0].Time.Format("2006-01-02 15:04"))
+	}
+	data, err := os.ReadFile(filepath.Join(infraRoot, KeyFile))
+	if err != nil {
+		return Inventory{}, false, fmt.Errorf("cannot read the inventory key: %w", err)
+	}
+	return load(found.Path, []byte(strings.TrimSpace(string(data))))
+}
+
+// Change is one difference between two inventories
+type Change struct {
+	What string // e.g. "image nextcloud:stable", "package docker-ce"
+	Old  string // Empty when added
+	New  string // Empty when removed
+}
+
+// Diff lists what changed from old to new: images, packages, the compose
+// file, servctl and the kernel
+func Diff(old, new Inventory) []Change {
+	var changes []Change
+	add := func(what, o, n string) {
+		if o != n {
+			changes = append(changes, Change{What: what, Old: o, New: n})
+		}
+	}
+	add("servctl", old.ServctlVersion, new.ServctlVersion)
+	add("kernel", old.Kernel, new.Kernel)
+	add("docker-compose.yml", shortHash(old.ComposeHash), shortHash(new.ComposeHash))
+
+	oldImages := make(map[string]Image)
+	for _, img := range old.Images {
+		oldImages[img.Ref] = img
+	}
+	newImages := make(map[string]Image)
+	for _, img := range new.Images {
+		newImages[img.Ref] = img
+		add("image "+img.Ref, imageVersion(oldImages[img.Ref]), imageVersion(img))
+	}
+	for _, img := range old.Images {
+		if _, ok := newImages[img.Ref]; !ok {
+			add("image "+img.Ref, imageVersion(img), "")
+		}
+	}
+
+	var names []string
+	for name := range old.Packages {
+		names = append(names, name)
+	}
+	for name := range new.Packages {
+		if _, ok := old.Packages[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		add("package "+name, old.Packages[name], new.Packages[name])
+	}
+	return changes
+}
+
+// imageVersion identifies what an image resolved to: the registry digest,
+// or the local ID of an image built or loaded without one
+func imageVersion(img Image) string {
+	if img.Ref == "" {
+		return ""
+	}
+	if _, digest, ok := strings.Cut(img.Digest, "@"); ok {
+		return shortHash(digest)
+	}
+	if img.ID != "" {
+		return shortHash(img.ID)
+	}
+	return "not pulled"
+}
+
+// shortHash shortens a hex digest for display, keeping any algorithm prefix
+func shortHash(h string) string {
+	algo, hex, ok := strings.Cut(h, ":")
+	if !ok {
+		algo, hex = "", h
+	}
+	if len(hex) > 12 {
+		hex = hex[:12]
+	}
+	if algo != "" {
+		return algo + ":" + hex
+	}
+	return hex
+}
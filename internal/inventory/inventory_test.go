@@ -0,0 +1,105 @@
+package inventory
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sample is a stack as Collect would see it, taken at t
+func sample(t time.Time) Inventory {
+	return Inventory{
+		Time:           t,
+		Reason:         "Setup complete",
+		Host:           "homeserver",
+		ServctlVersion: "1.4.0",
+		Kernel:         "6.8.0-45-generic",
+		ComposeHash:    "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+		Images: []Image{
+			{Ref: "nextcloud:stable", Digest: "nextcloud@sha256:aaaaaaaaaaaaaaaa", ID: "sha256:1111"},
+			{Ref: "ghcr.io/immich-app/immich-server:release", Digest: "ghcr.io/immich-app/immich-server@sha256:bbbbbbbbbbbbbbbb", ID: "sha256:2222"},
+		},
+		Packages: map[string]string{"docker-ce": "5:27.1.1", "smartmontools": "7.4-2"},
+	}
+}
+
+func TestDiff(t *testing.T) {
+	old := sample(time.Now())
+	new := sample(time.Now())
+	new.Images = []Image{
+		{Ref: "nextcloud:stable", Digest: "nextcloud@sha256:cccccccccccccccc", ID: "sha256:3333"},
+		{Ref: "redis:7", ID: "sha256:4444"},
+	}
+	new.Packages = map[string]string{"docker-ce": "5:27.2.0", "smartmontools": "7.4-2", "nftables": "1.0.9"}
+
+	got := make(map[string]Change)
+	for _, c := range Diff(old, new) {
+		got[c.What] = c
+	}
+	want := map[string]Change{
+		"image nextcloud:stable": {Old: "sha256:aaaaaaaaaaaa", New: "sha256:cccccccccccc"},
+		"image redis:7":          {Old: "", New: "sha256:4444"},
+		"image ghcr.io/immich-app/immich-server:release": {Old: "sha256:bbbbbbbbbbbb", New: ""},
+		"package docker-ce": {Old: "5:27.1.1", New: "5:27.2.0"},
+		"package nftables":  {Old: "", New: "1.0.9"},
+	}
+	if len(got) != len(want) {
+		t.Errorf("Diff() = %v, want %d changes", got, len(want))
+	}
+	for what, w := range want {
+		c, ok := got[what]
+		if !ok {
+			t.Errorf("Diff() missed %s", what)
+			continue
+		}
+		if c.Old != w.Old || c.New != w.New {
+			t.Errorf("%s: %q → %q, want %q → %q", what, c.Old, c.New, w.Old, w.New)
+		}
+	}
+
+	if changes := Diff(old, sample(time.Now())); len(changes) != 0 {
+		t.Errorf("Diff() of the same stack = %v, want none", changes)
+	}
+}
+
+func TestRecord_SkipsUnchangedAndVerifies(t *testing.T) {
+	infraRoot := t.TempDir()
+	first := time.Date(2024, 5, 1, 3, 0, 0, 0, time.Local)
+
+	path, err := Record(infraRoot, sample(first))
+	if err != nil || path == "" {
+		t.Fatalf("Record() = %q, %v", path, err)
+	}
+	// The same stack after another change is not recorded again
+	again := sample(first.Add(time.Hour))
+	again.Reason = "Network refresh"
+	if path, err := Record(infraRoot, again); err != nil || path != "" {
+		t.Errorf("Record() of an unchanged stack = %q, %v, want nothing written", path, err)
+	}
+	changed := sample(first.Add(24 * time.Hour))
+	changed.ServctlVersion = "1.5.0"
+	if _, err := Record(infraRoot, changed); err != nil {
+		t.Fatal(err)
+	}
+
+	inv, verified, err := At(infraRoot, first.Add(12*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !verified || inv.ServctlVersion != "1.4.0" {
+		t.Errorf("At() = %s, verified %v, want the 1.4.0 record, verified", inv.ServctlVersion, verified)
+	}
+	if _, _, err := At(infraRoot, first.Add(-time.Hour)); err == nil || !strings.Contains(err.Error(), "oldest") {
+		t.Errorf("At() before the first record = %v, want an error naming the oldest", err)
+	}
+
+	// A hand edit breaks the signature
+	data, _ := os.ReadFile(path)
+	os.WriteFile(path, []byte(strings.Replace(string(data), "5:27.1.1", "5:26.0.0", 1)), 0644)
+	if inv, verified, err := At(infraRoot, first); err != nil || verified {
+		t.Errorf("At() of an edited record: verified %v, %v; want unverified", verified, err)
+	} else if inv.Packages["docker-ce"] != "5:26.0.0" {
+		t.Errorf("At() = %v, want the edited record", inv.Packages)
+	}
+}
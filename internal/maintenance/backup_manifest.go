@@ -0,0 +1,95 @@
+package maintenance
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+
+	"github.com/madhav/servctl/internal/paths"
+)
+
+// ServiceBackupRules lists the paths of one service that the data backup
+// skips or keeps. Patterns are rsync patterns relative to DataRoot; a leading
+// "/" anchors them to DataRoot and a trailing "/" matches directories only.
+type ServiceBackupRules struct {
+	Service string
+	Include []string // Always backed up, even when an exclude matches
+	Exclude []string // Skipped (caches the service can regenerate)
+}
+
+// BackupManifest is the per-service include/exclude list for the data backup
+type BackupManifest struct {
+	Services []ServiceBackupRules
+}
+
+// DefaultBackupManifest skips caches that are large and rebuilt on demand:
+// Immich thumbnails and transcodes, Nextcloud previews, downloaded ML models
+// and shipped container logs, which Loki prunes on its own
+func DefaultBackupManifest() BackupManifest {
+	return BackupManifest{
+		Services: []ServiceBackupRules{
+			{
+				Service: "Immich",
+				Exclude: []string{paths.Anchored(paths.GalleryThumbs), paths.Anchored(paths.GalleryVideo)},
+			},
+			{
+				Service: "Immich ML",
+				Exclude: []string{paths.Anchored(paths.Cache)},
+			},
+			{
+				Service: "Nextcloud",
+				Exclude: []string{paths.Anchored(paths.CloudData) + "data/appdata_*/preview/"},
+			},
+			{
+				Service: "Logs",
+				Exclude: []string{paths.Anchored(paths.Loki)},
+			},
+		},
+	}
+}
+
+// RsyncFilters returns the manifest as rsync arguments. rsync applies the
+// first matching rule, so every include is emitted before any exclude.
+func (m BackupManifest) RsyncFilters() []string {
+	var includes, excludes []string
+	for _, svc := range m.Services {
+		for _, p := range svc.Include {
+			includes = append(includes, "--include="+p)
+		}
+		for _, p := range svc.Exclude {
+			excludes = append(excludes, "--exclude="+p)
+		}
+	}
+	return append(includes, excludes...)
+}
+
+// Summary describes the exclusions per service (e.g., "Immich: /gallery/thumbs/")
+func (m BackupManifest) Summary() []string {
+	var lines []string
+	for _, svc := range m.Services {
+		if len(svc.Exclude) == 0 {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s: %s", svc.Service, strings.Join(svc.Exclude, ", ")))
+	}
+	return lines
+}
+
+// PromptBackupExcludes asks whether regenerable caches should be left out of
+// the data backup and returns the manifest to use
+func PromptBackupExcludes(reader *bufio.Reader) BackupManifest {
+	manifest := DefaultBackupManifest()
+
+	fmt.Println("Regenerable caches (rebuilt automatically after a restore):")
+	for _, line := range manifest.Summary() {
+		fmt.Printf("  • %s\n", line)
+	}
+	fmt.Print("Leave them out of backups? [Y/n]: ")
+
+	response, _ := reader.ReadString('\n')
+	response = strings.TrimSpace(strings.ToLower(response))
+	if response == "n" || response == "no" {
+		return BackupManifest{}
+	}
+	return manifest
+}
@@ -0,0 +1,131 @@
+package maintenance
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+
+	"github.com/madhav/servctl/internal/paths"
+)
+
+func TestBackupManifest_RsyncFilters(t *testing.T) {
+	manifest := BackupManifest{
+		Services: []ServiceBackupRules{
+			{Service: "Immich", Exclude: []string{"/gallery/thumbs/"}},
+			{Service: "Nextcloud", Include: []string{"/cloud/data/data/admin/"}, Exclude: []string{"/cloud/data/data/*/cache/"}},
+		},
+	}
+
+	got := manifest.RsyncFilters()
+	want := []string{
+		"--include=/cloud/data/data/admin/",
+		"--exclude=/gallery/thumbs/",
+		"--exclude=/cloud/data/data/*/cache/",
+	}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("RsyncFilters() = %v, want %v", got, want)
+	}
+
+	if len(BackupManifest{}.RsyncFilters()) != 0 {
+		t.Error("empty manifest should produce no filters")
+	}
+}
+
+func TestGenerateDailyBackup_Manifest(t *testing.T) {
+	config := DefaultScriptConfig()
+	config.LogDir = "/home/test/infra/logs"
+
+	content, err := GenerateDailyBackup(config)
+	if err != nil {
+		t.Fatalf("GenerateDailyBackup() error: %v", err)
+	}
+	for _, part := range []string{
+		`"--exclude=/gallery/thumbs/"`,
+		`"--exclude=/gallery/encoded-video/"`,
+		`"--exclude=/cloud/data/data/appdata_*/preview/"`,
+		`rsync -av --delete "${FILTERS[@]}"`,
+	} {
+		if !strings.Contains(content, part) {
+			t.Errorf("Daily backup script missing: %s", part)
+		}
+	}
+
+	config.BackupManifest = BackupManifest{}
+	content, _ = GenerateDailyBackup(config)
+	if strings.Contains(content, "--exclude=") {
+		t.Error("empty manifest should not exclude anything")
+	}
+}
+
+func TestPromptBackupExcludes(t *testing.T) {
+	tests := []struct {
+		input    string
+		wantRule bool
+	}{
+		{"\n", true},
+		{"y\n", true},
+		{"n\n", false},
+	}
+
+	for _, tt := range tests {
+		manifest := PromptBackupExcludes(bufio.NewReader(strings.NewReader(tt.input)))
+		if got := len(manifest.RsyncFilters()) > 0; got != tt.wantRule {
+			t.Errorf("PromptBackupExcludes(%q) has rules = %v, want %v", tt.input, got, tt.wantRule)
+		}
+	}
+}
+
+func TestGenerateDailyBackup_TierLinks(t *testing.T) {
+	config := DefaultScriptConfig()
+	config.LogDir = "/home/test/infra/logs"
+
+	content, _ := GenerateDailyBackup(config)
+	if !strings.Contains(content, `TIER_OPTS=()`) {
+		t.Error("untiered setups should not follow directory symlinks")
+	}
+
+	config.FastRoot = "/mnt/fast"
+	content, _ = GenerateDailyBackup(config)
+	if !strings.Contains(content, `TIER_OPTS=(--copy-dirlinks)`) {
+		t.Error("tiered setups should back up what the hot-data symlinks point to")
+	}
+}
+
+func TestGenerateDailyBackup_ExcludesSnapshots(t *testing.T) {
+	config := DefaultScriptConfig()
+	config.LogDir = "/home/user/logs"
+
+	content, _ := GenerateDailyBackup(config)
+	if strings.Contains(content, ".snapshots") {
+		t.Error("snapshots should only be excluded on Btrfs")
+	}
+
+	config.SnapshotDir = ".snapshots"
+	content, _ = GenerateDailyBackup(config)
+	if !strings.Contains(content, `"--exclude=/.snapshots/"`) {
+		t.Error("Btrfs snapshots inside the data root must not be backed up")
+	}
+}
+
+func TestGenerateDailyBackup_ServiceRoots(t *testing.T) {
+	config := DefaultScriptConfig()
+	config.LogDir = "/home/user/logs"
+
+	content, _ := GenerateDailyBackup(config)
+	if strings.Contains(content, "EXTRA_SOURCES") {
+		t.Error("a single data root needs no extra sources")
+	}
+
+	config.ServiceRoots = paths.Roots{"nextcloud": "/mnt/ssd"}
+	content, _ = GenerateDailyBackup(config)
+	for _, want := range []string{`"--exclude=/cloud/"`, `"/mnt/ssd/./cloud"`, `rsync -avR`} {
+		if !strings.Contains(content, want) {
+			t.Errorf("Nextcloud on its own root should be backed up into the set, missing %s", want)
+		}
+	}
+
+	drill, _ := GenerateRestoreDrill(config)
+	if !strings.Contains(drill, `"cloud"/*) echo "/mnt/ssd/$1"`) {
+		t.Error("the restore drill should compare against the live files on the service's root")
+	}
+}
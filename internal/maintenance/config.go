@@ -0,0 +1,57 @@
+package maintenance
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/madhav/servctl/internal/ops"
+)
+
+// ConfigFileName is the file in InfraRoot that records the maintenance
+// settings the scripts were generated with
+const ConfigFileName = "maintenance.json"
+
+// ConfigPath returns the location of the maintenance config under infraRoot
+func ConfigPath(infraRoot string) string {
+	return filepath.Join(infraRoot, ConfigFileName)
+}
+
+// SaveConfig writes the maintenance settings next to the service state
+func SaveConfig(config *ScriptConfig, dryRun bool) error {
+	if config.InfraRoot == "" {
+		return fmt.Errorf("cannot save maintenance config: InfraRoot is not set")
+	}
+
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode maintenance config: %w", err)
+	}
+
+	// Webhook and heartbeat URLs act as credentials
+	op := ops.WriteFile{Path: ConfigPath(config.InfraRoot), Content: data, Mode: 0600, Secret: true}
+	if err := ops.Execute(dryRun, op); err != nil {
+		return fmt.Errorf("failed to write maintenance config: %w", err)
+	}
+	return nil
+}
+
+// LoadConfig reads the maintenance settings saved by the setup wizard
+func LoadConfig(infraRoot string) (*ScriptConfig, error) {
+	path := ConfigPath(infraRoot)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("no maintenance config at %s (run 'servctl -start-setup' first)", path)
+		}
+		return nil, fmt.Errorf("failed to read maintenance config: %w", err)
+	}
+
+	config := DefaultScriptConfig()
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return config, nil
+}
@@ -6,36 +6,68 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"time"
+
+	"github.com/madhav/servctl/internal/ops"
+	"github.com/madhav/servctl/templates"
 )
 
 // CronSchedule represents a cron job schedule
 type CronSchedule struct {
-	Minute     string // 0-59 or *
+	Minute     string // 0-59 or *, or a nickname such as @reboot (see AtBoot)
 	Hour       string // 0-23 or *
 	DayOfMonth string // 1-31 or *
 	Month      string // 1-12 or *
 	DayOfWeek  string // 0-7 (0 and 7 are Sunday) or *
 }
 
+// AtBoot is the schedule of jobs cron runs once when the machine starts
+var AtBoot = CronSchedule{Minute: "@reboot"}
+
 // String returns the cron schedule in standard format
 func (c CronSchedule) String() string {
+	// A nickname replaces all five fields
+	if strings.HasPrefix(c.Minute, "@") {
+		return c.Minute
+	}
 	return fmt.Sprintf("%s %s %s %s %s",
 		c.Minute, c.Hour, c.DayOfMonth, c.Month, c.DayOfWeek)
 }
 
 // HumanReadable returns a human-readable description
 func (c CronSchedule) HumanReadable() string {
+	if c == AtBoot {
+		return "At boot"
+	}
 	// Every X hours
 	if strings.HasPrefix(c.Hour, "*/") {
 		return fmt.Sprintf("Every %s hours", strings.TrimPrefix(c.Hour, "*/"))
 	}
+	if c.Hour == "*" && c.DayOfMonth == "*" && c.Month == "*" && c.DayOfWeek == "*" {
+		if strings.HasPrefix(c.Minute, "*/") {
+			return fmt.Sprintf("Every %s minutes", strings.TrimPrefix(c.Minute, "*/"))
+		}
+		if _, ok := cronNumber(c.Minute); ok {
+			return "Hourly"
+		}
+	}
+	hour, hourOK := cronNumber(c.Hour)
+	minute, minuteOK := cronNumber(c.Minute)
+	if !hourOK || !minuteOK {
+		return c.String()
+	}
+	at := fmt.Sprintf("%d:%02d", hour, minute)
+	switch {
 	// Daily at specific time
-	if c.Minute == "0" && c.Hour != "*" && c.DayOfMonth == "*" && c.Month == "*" && c.DayOfWeek == "*" {
-		return fmt.Sprintf("Daily at %s:00", c.Hour)
-	}
-	// Weekly on Sunday
-	if c.DayOfWeek == "0" {
-		return fmt.Sprintf("Sunday at %s:%s", c.Hour, c.Minute)
+	case c.DayOfMonth == "*" && c.Month == "*" && c.DayOfWeek == "*":
+		return "Daily at " + at
+	// Weekly on one day
+	case c.DayOfMonth == "*" && c.Month == "*":
+		if day, ok := cronNumber(c.DayOfWeek); ok {
+			return fmt.Sprintf("%s at %s", time.Weekday(day%7), at)
+		}
+	case c.DayOfWeek == "*":
+		return scheduleDays(c) + " at " + at
 	}
 	return c.String()
 }
@@ -80,78 +112,38 @@ func DefaultCronJobs(scriptsDir string) []CronJob {
 			Description: "Weekly cleanup on Sunday at 3:00 AM",
 			User:        "root",
 		},
+		{
+			Name:        "infra_config_backup",
+			Schedule:    CronSchedule{Minute: "30", Hour: "4", DayOfMonth: "*", Month: "*", DayOfWeek: "*"},
+			Command:     filepath.Join(scriptsDir, "infra_config_backup.sh"),
+			Description: "Encrypted ~/infra config backup at 4:30 AM",
+			User:        "root",
+		},
 	}
 }
 
-// CronFileContent generates the content for /etc/cron.d/servctl
-const CronFileTemplate = `# servctl - Automated Maintenance Jobs
-# Generated by servctl - DO NOT EDIT MANUALLY
-# 
-# This file is placed in /etc/cron.d/ and runs as root.
-# See crontab(5) for schedule format.
-
-SHELL=/bin/bash
-PATH=/usr/local/sbin:/usr/local/bin:/sbin:/bin:/usr/sbin:/usr/bin
-
-# Format: minute hour day month dayofweek user command
-
-{{ range . }}
-# {{ .Description }}
-{{ .Schedule.String }} {{ .User }} {{ .Command }}
-{{ end }}
-`
-
 // GenerateCronFile generates the cron file content
 func GenerateCronFile(jobs []CronJob) (string, error) {
-	tmpl := `# servctl - Automated Maintenance Jobs
-# Generated by servctl - DO NOT EDIT MANUALLY
-# 
-# This file is placed in /etc/cron.d/ and runs as root.
-# See crontab(5) for schedule format.
-
-SHELL=/bin/bash
-PATH=/usr/local/sbin:/usr/local/bin:/sbin:/bin:/usr/sbin:/usr/bin
-
-# Format: minute hour day month dayofweek user command
-`
-
-	var b strings.Builder
-	b.WriteString(tmpl)
-
-	for _, job := range jobs {
-		b.WriteString(fmt.Sprintf("\n# %s\n", job.Description))
-		b.WriteString(fmt.Sprintf("%s %s %s\n",
-			job.Schedule.String(),
-			job.User,
-			job.Command,
-		))
-	}
-
-	return b.String(), nil
+	return templates.Render("system/cron.tmpl", jobs, nil)
 }
 
-// WriteCronFile writes the cron configuration to /etc/cron.d/servctl
+// CronFilePath is where the maintenance jobs are scheduled
+const CronFilePath = "/etc/cron.d/servctl"
+
+// WriteCronFile writes the cron configuration to CronFilePath
 func WriteCronFile(jobs []CronJob, dryRun bool) error {
 	content, err := GenerateCronFile(jobs)
 	if err != nil {
 		return err
 	}
 
-	cronPath := "/etc/cron.d/servctl"
-
-	if dryRun {
-		fmt.Printf("[DRY RUN] Would write to %s:\n", cronPath)
-		fmt.Println("--- Content ---")
-		fmt.Println(content)
-		return nil
-	}
-
-	// Write file (requires root)
-	if err := os.WriteFile(cronPath, []byte(content), 0644); err != nil {
+	if err := ops.Execute(dryRun, ops.WriteFile{Path: CronFilePath, Content: []byte(content), Mode: 0644}); err != nil {
 		return fmt.Errorf("failed to write cron file (are you root?): %w", err)
 	}
 
-	fmt.Printf("Generated: %s (mode 0644)\n", cronPath)
+	if !dryRun {
+		fmt.Printf("Generated: %s (mode 0644)\n", CronFilePath)
+	}
 	return nil
 }
 
@@ -163,75 +155,38 @@ func IsCronInstalled() bool {
 
 // CronExists checks if servctl cron file already exists
 func CronExists() bool {
-	_, err := os.Stat("/etc/cron.d/servctl")
+	_, err := os.Stat(CronFilePath)
 	return err == nil
 }
 
 // RemoveCronFile removes the servctl cron configuration
 func RemoveCronFile(dryRun bool) error {
-	cronPath := "/etc/cron.d/servctl"
-
-	if dryRun {
-		fmt.Printf("[DRY RUN] Would remove %s\n", cronPath)
-		return nil
-	}
-
-	if err := os.Remove(cronPath); err != nil && !os.IsNotExist(err) {
+	if err := ops.Execute(dryRun, ops.Remove{Path: CronFilePath}); err != nil {
 		return fmt.Errorf("failed to remove cron file: %w", err)
 	}
-
 	return nil
 }
 
-// LogrotateConfig generates the logrotate configuration
-const LogrotateTemplate = `# servctl - Log Rotation Configuration
-# Place in /etc/logrotate.d/servctl
-
-{{ .LogDir }}/*.log {
-    weekly
-    rotate 4
-    compress
-    delaycompress
-    missingok
-    notifempty
-    create 0644 {{ .User }} {{ .User }}
-}
-`
-
 // GenerateLogrotateConfig generates logrotate configuration
-func GenerateLogrotateConfig(logDir, user string) string {
-	return fmt.Sprintf(`# servctl - Log Rotation Configuration
-# Place in /etc/logrotate.d/servctl
-
-%s/*.log {
-    weekly
-    rotate 4
-    compress
-    delaycompress
-    missingok
-    notifempty
-    create 0644 %s %s
-}
-`, logDir, user, user)
+func GenerateLogrotateConfig(logDir, user string) (string, error) {
+	return templates.Render("system/logrotate.tmpl", struct{ LogDir, User string }{logDir, user}, nil)
 }
 
 // WriteLogrotateConfig writes the logrotate configuration
 func WriteLogrotateConfig(logDir, user string, dryRun bool) error {
-	content := GenerateLogrotateConfig(logDir, user)
-	logrotPath := "/etc/logrotate.d/servctl"
-
-	if dryRun {
-		fmt.Printf("[DRY RUN] Would write to %s:\n", logrotPath)
-		fmt.Println("--- Content ---")
-		fmt.Println(content)
-		return nil
+	content, err := GenerateLogrotateConfig(logDir, user)
+	if err != nil {
+		return err
 	}
 
-	if err := os.WriteFile(logrotPath, []byte(content), 0644); err != nil {
+	logrotPath := "/etc/logrotate.d/servctl"
+	if err := ops.Execute(dryRun, ops.WriteFile{Path: logrotPath, Content: []byte(content), Mode: 0644}); err != nil {
 		return fmt.Errorf("failed to write logrotate config (are you root?): %w", err)
 	}
 
-	fmt.Printf("Generated: %s\n", logrotPath)
+	if !dryRun {
+		fmt.Printf("Generated: %s\n", logrotPath)
+	}
 	return nil
 }
 
@@ -250,27 +205,36 @@ func TestWebhook(webhookURL string, dryRun bool) error {
   }]
 }`
 
-	if dryRun {
-		fmt.Printf("[DRY RUN] Would send test notification to webhook\n")
+	return ops.Execute(dryRun, ops.Func{Description: "send a test notification to the webhook", Fn: func() error {
+		cmd := exec.Command("curl", "-s",
+			"-H", "Content-Type: application/json",
+			"-X", "POST",
+			"-d", payload,
+			webhookURL,
+		)
+
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("webhook test failed: %s: %w", string(output), err)
+		}
+
+		// Check for Discord error response
+		if strings.Contains(string(output), "error") {
+			return fmt.Errorf("webhook returned error: %s", string(output))
+		}
 		return nil
-	}
-
-	cmd := exec.Command("curl", "-s",
-		"-H", "Content-Type: application/json",
-		"-X", "POST",
-		"-d", payload,
-		webhookURL,
-	)
+	}})
+}
 
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("webhook test failed: %s: %w", string(output), err)
+// PingHeartbeat sends a single ping so the check starts its schedule
+func PingHeartbeat(url string, dryRun bool) error {
+	if url == "" {
+		return fmt.Errorf("heartbeat URL is empty")
 	}
 
-	// Check for Discord error response
-	if strings.Contains(string(output), "error") {
-		return fmt.Errorf("webhook returned error: %s", string(output))
+	ping := ops.Command{Args: []string{"curl", "-fsS", "-m", "10", "--retry", "3", "-o", "/dev/null", url}}
+	if err := ops.Execute(dryRun, ping); err != nil {
+		return fmt.Errorf("heartbeat ping failed: %w", err)
 	}
-
 	return nil
 }
@@ -0,0 +1,43 @@
+package maintenance
+
+import (
+	"maps"
+	"path/filepath"
+	"slices"
+
+	"github.com/madhav/servctl/internal/paths"
+)
+
+// DiskEmergencyPercent is the usage at which disk_alert.sh stops warning
+// and acts: Postgres corrupts its files when a write hits ENOSPC, and the
+// last few percent go fast while Immich transcodes or a sync catches up
+const DiskEmergencyPercent = 95
+
+// DiskEmergencyClearPercent is the usage every monitored mount must drop
+// under before the emergency ends, so a cleanup that frees a percent does
+// not flap the paused jobs on and off
+const DiskEmergencyClearPercent = 90
+
+// DiskEmergencyFile lists, relative to InfraRoot, the mounts over
+// DiskEmergencyPercent while the emergency lasts. Backup scripts refuse to
+// write to any mount it lists.
+const DiskEmergencyFile = "disk-emergency"
+
+// MonitoredMounts are where the stack's databases, files and containers
+// live: the system disk (Docker's images and volumes), the data root, the
+// fast tier and any per-service roots. disk_alert.sh checks each mount
+// once, however many of these share it.
+func (c *ScriptConfig) MonitoredMounts() []string {
+	mounts := []string{"/", c.DataRoot}
+	if c.FastRoot != "" {
+		mounts = append(mounts, c.FastRoot)
+	}
+	roots := slices.Sorted(maps.Values(c.ServiceRoots.TopDirs()))
+	return append(mounts, slices.Compact(roots)...)
+}
+
+// NextcloudDataDir holds each user's files and the appdata folder whose
+// preview cache the emergency cleanup clears
+func (c *ScriptConfig) NextcloudDataDir() string {
+	return filepath.Join(c.ServiceRoots.Join(c.DataRoot, paths.CloudData), "data")
+}
@@ -0,0 +1,17 @@
+package maintenance
+
+// DefaultDrillSampleSize is how many files each restore drill restores
+const DefaultDrillSampleSize = 50
+
+// DrillMaxFileMB keeps long videos out of the sample, so a drill restores a
+// few hundred megabytes at most into temporary space
+const DrillMaxFileMB = "200"
+
+// GenerateRestoreDrill generates the restore drill script
+func GenerateRestoreDrill(config *ScriptConfig) (string, error) {
+	return generateScript("restore_drill", config)
+}
+
+// RestoreDrillSchedule runs the drill on the 15th of every third month, after
+// the night's backups (StaggerJobs sets the time)
+var RestoreDrillSchedule = CronSchedule{Minute: "0", Hour: "6", DayOfMonth: "15", Month: "1,4,7,10", DayOfWeek: "*"}
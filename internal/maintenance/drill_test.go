@@ -0,0 +1,53 @@
+package maintenance
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGenerateRestoreDrill(t *testing.T) {
+	config := DefaultScriptConfig()
+	config.InfraRoot = "/home/user/infra"
+	config.LogDir = "/home/user/infra/logs"
+
+	content, err := GenerateRestoreDrill(config)
+	if err != nil {
+		t.Fatalf("GenerateRestoreDrill() error: %v", err)
+	}
+	for _, check := range []string{
+		`SOURCE="/mnt/data"`,
+		`SNAPSHOTS="/mnt/backup/snapshots"`,
+		`SCRUB_DB="/home/user/infra/scrub/checksums.tsv"`,
+		"SAMPLE=50",
+		"MAX_FILE_MB=200",
+		`rsync -a --files-from="$WORK/sample" "$SET/" "$WORK/restored/"`,
+		"Restore drill passed",
+	} {
+		if !strings.Contains(content, check) {
+			t.Errorf("Restore drill script missing %q", check)
+		}
+	}
+	if strings.Contains(content, "curl") {
+		t.Error("Restore drill should only log without a webhook")
+	}
+
+	config.DrillSampleSize = 0
+	config.WebhookURL = "https://discord.com/api/webhooks/1/x"
+	content, _ = GenerateRestoreDrill(config)
+	if !strings.Contains(content, "SAMPLE=50") || !strings.Contains(content, "curl -s") {
+		t.Error("Restore drill should default the sample size and report via the webhook")
+	}
+}
+
+func TestCronJobsForSelection_RestoreDrill(t *testing.T) {
+	jobs := CronJobsForSelection(ScriptSelection{RestoreDrill: true}, "/home/user/infra/scripts", "daily")
+	if len(jobs) != 1 || jobs[0].Command != "/home/user/infra/scripts/restore-drill.sh" {
+		t.Fatalf("jobs = %+v, want the restore drill only", jobs)
+	}
+	if got := jobs[0].Schedule.String(); got != "0 6 15 1,4,7,10 *" {
+		t.Errorf("Restore drill schedule = %q, want quarterly", got)
+	}
+	if got := jobs[0].Schedule.OnCalendar(); got != "*-1,4,7,10-15 6:0:00" {
+		t.Errorf("Restore drill OnCalendar = %q", got)
+	}
+}
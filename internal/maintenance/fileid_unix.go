@@ -0,0 +1,18 @@
+//go:build !windows
+
+package maintenance
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// fileID returns the device, inode and link count identifying a file
+// across the hardlinks of backup sets
+func fileID(info fs.FileInfo) (dev, ino, nlink uint64, ok bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, 0, false
+	}
+	return uint64(st.Dev), uint64(st.Ino), uint64(st.Nlink), true
+}
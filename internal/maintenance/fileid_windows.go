@@ -0,0 +1,8 @@
+package maintenance
+
+import "io/fs"
+
+// fileID is unavailable on Windows; backup sets only live on the server
+func fileID(info fs.FileInfo) (dev, ino, nlink uint64, ok bool) {
+	return 0, 0, 0, false
+}
@@ -0,0 +1,142 @@
+package maintenance
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// HistoryFile records every scheduled run, relative to InfraRoot: one JSON
+// object per line, oldest first, written by the run-job.sh wrapper
+const HistoryFile = "maintenance_history.jsonl"
+
+// HistoryLimit is how many runs the history keeps; at a run every 30
+// minutes that is about a month
+const HistoryLimit = 2000
+
+// FailureStreakAlert is how many failed runs of one job in a row send an
+// alert; a single failure is often a busy disk or a flaky network
+const FailureStreakAlert = 3
+
+// RunJobScript is the wrapper's file name in the scripts directory
+const RunJobScript = "run-job.sh"
+
+// RunRecord is one run of a maintenance job
+type RunRecord struct {
+	Script   string    `json:"script"`
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	ExitCode int       `json:"exit"`
+	Summary  string    `json:"summary"` // Last line the script logged
+}
+
+// Failed reports whether the run exited non-zero
+func (r RunRecord) Failed() bool {
+	return r.ExitCode != 0
+}
+
+// Duration is how long the run took
+func (r RunRecord) Duration() time.Duration {
+	return r.End.Sub(r.Start)
+}
+
+// GenerateRunJob generates the wrapper that runs each scheduled job and
+// appends it to the history
+func GenerateRunJob(config *ScriptConfig) (string, error) {
+	return generateScript("run_job", config)
+}
+
+// RunJobScriptInfo describes the wrapper for the list of generated scripts
+func RunJobScriptInfo(config *ScriptConfig) (ScriptInfo, error) {
+	script, err := GenerateRunJob(config)
+	if err != nil {
+		return ScriptInfo{}, err
+	}
+	return ScriptInfo{
+		Name:        "Job Runner",
+		Filename:    RunJobScript,
+		Description: "Records every run; alerts after repeated failures",
+		Schedule:    "With each job",
+		Content:     script,
+	}, nil
+}
+
+// WrapJobs returns jobs with each command started through the wrapper,
+// which records the run under the job's name. The schedule saved for
+// -status keeps the plain commands.
+func WrapJobs(jobs []CronJob, scriptsDir string) []CronJob {
+	wrapper := filepath.Join(scriptsDir, RunJobScript)
+	wrapped := make([]CronJob, len(jobs))
+	for i, job := range jobs {
+		job.Command = fmt.Sprintf("%s %s %s", wrapper, job.Name, job.Command)
+		wrapped[i] = job
+	}
+	return wrapped
+}
+
+// ReadHistory returns the recorded runs, oldest first. A missing file means
+// nothing has run yet; lines that do not parse (a run killed mid-write) are
+// skipped.
+func ReadHistory(infraRoot string) ([]RunRecord, error) {
+	f, err := os.Open(filepath.Join(infraRoot, HistoryFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read maintenance history: %w", err)
+	}
+	defer f.Close()
+
+	var records []RunRecord
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var r RunRecord
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil || r.Script == "" {
+			continue
+		}
+		records = append(records, r)
+	}
+	if err := scanner.Err(); err != nil {
+		return records, fmt.Errorf("cannot read maintenance history: %w", err)
+	}
+	return records, nil
+}
+
+// FilterHistory returns the runs of one job, or all runs when script is
+// empty
+func FilterHistory(records []RunRecord, script string) []RunRecord {
+	if script == "" {
+		return records
+	}
+	var out []RunRecord
+	for _, r := range records {
+		if r.Script == script {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// FailureStreaks returns, for each job whose latest run failed, how many of
+// its runs in a row have failed
+func FailureStreaks(records []RunRecord) map[string]int {
+	streaks := map[string]int{}
+	done := map[string]bool{}
+	for i := len(records) - 1; i >= 0; i-- {
+		r := records[i]
+		if done[r.Script] {
+			continue
+		}
+		if !r.Failed() {
+			done[r.Script] = true
+			continue
+		}
+		streaks[r.Script]++
+	}
+	return streaks
+}
@@ -0,0 +1,127 @@
+package maintenance
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadHistory(t *testing.T) {
+	dir := t.TempDir()
+	if records, err := ReadHistory(dir); err != nil || records != nil {
+		t.Fatalf("Missing history should be empty, got %v %v", records, err)
+	}
+	history := `{"script":"daily_backup","start":"2024-05-01T04:00:00+02:00","end":"2024-05-01T04:12:30+02:00","exit":0,"summary":"Backup done"}
+{"script":"disk_alert","start":"2024-05-01T05:00:00+02:00","end":"2024-05-01T05:00:01+02:00","exit":1,"summ
+{"script":"disk_alert","start":"2024-05-01T06:00:00+02:00","end":"2024-05-01T06:00:01+02:00","exit":1,"summary":"ERROR: line 15"}
+`
+	os.WriteFile(filepath.Join(dir, HistoryFile), []byte(history), 0644)
+
+	records, err := ReadHistory(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("Expected the truncated line to be skipped, got %d records", len(records))
+	}
+	if records[0].Duration().String() != "12m30s" || records[0].Failed() || records[0].Summary != "Backup done" {
+		t.Errorf("Unexpected first record %+v", records[0])
+	}
+	if !records[1].Failed() || records[1].ExitCode != 1 {
+		t.Errorf("Unexpected second record %+v", records[1])
+	}
+	if got := FilterHistory(records, "disk_alert"); len(got) != 1 {
+		t.Errorf("FilterHistory returned %d records", len(got))
+	}
+}
+
+func TestFailureStreaks(t *testing.T) {
+	records := []RunRecord{
+		{Script: "a", ExitCode: 1},
+		{Script: "a", ExitCode: 0},
+		{Script: "b", ExitCode: 2},
+		{Script: "a", ExitCode: 1},
+		{Script: "b", ExitCode: 2},
+		{Script: "a", ExitCode: 75},
+		{Script: "c", ExitCode: 0},
+	}
+	streaks := FailureStreaks(records)
+	if streaks["a"] != 2 || streaks["b"] != 2 || streaks["c"] != 0 || len(streaks) != 2 {
+		t.Errorf("Unexpected streaks %v", streaks)
+	}
+}
+
+func TestWrapJobs(t *testing.T) {
+	jobs := RebootWindowJobs(DefaultScriptConfig(), "/home/user/infra/scripts")
+	wrapped := WrapJobs(jobs, "/home/user/infra/scripts")
+	want := "/home/user/infra/scripts/run-job.sh reboot_verify /home/user/infra/scripts/reboot-window.sh --after-boot"
+	if wrapped[1].Command != want {
+		t.Errorf("Command = %q, want %q", wrapped[1].Command, want)
+	}
+	if jobs[1].Command == want {
+		t.Error("WrapJobs should not change the jobs it is given")
+	}
+}
+
+// TestRunJob_RecordsRuns runs the generated wrapper around a failing job
+// until the streak alert, then a passing one
+func TestRunJob_RecordsRuns(t *testing.T) {
+	for _, tool := range []string{"bash", "flock", "tac"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skip(tool + " not installed")
+		}
+	}
+	dir := t.TempDir()
+	config := &ScriptConfig{InfraRoot: dir, LogDir: filepath.Join(dir, "logs")}
+	wrapper, err := GenerateRunJob(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrapperPath := filepath.Join(dir, RunJobScript)
+	os.WriteFile(wrapperPath, []byte(wrapper), 0755)
+
+	// A job that logs like the generated scripts do and exits with $1
+	job := filepath.Join(dir, "job.sh")
+	os.WriteFile(job, []byte(`#!/bin/bash
+LOGFILE="`+dir+`/logs/job.log"
+mkdir -p "${LOGFILE%/*}"
+if [ -n "${SERVCTL_RUN_LOGFILE:-}" ]; then echo "$LOGFILE" > "$SERVCTL_RUN_LOGFILE"; fi
+echo "finished with \"$1\"" >> "$LOGFILE"
+exit "$1"
+`), 0755)
+
+	for i, code := range []string{"3", "3", "3", "0"} {
+		cmd := exec.Command("bash", wrapperPath, "test_job", job, code)
+		err := cmd.Run()
+		if got := cmd.ProcessState.ExitCode(); got != map[string]int{"3": 3, "0": 0}[code] {
+			t.Fatalf("run %d: wrapper exited with %d (%v), want %s", i, got, err, code)
+		}
+	}
+
+	records, err := ReadHistory(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 4 {
+		t.Fatalf("Expected 4 runs, got %d", len(records))
+	}
+	if records[0].Script != "test_job" || records[0].ExitCode != 3 || records[0].Summary != `finished with "3"` {
+		t.Errorf("Unexpected record %+v", records[0])
+	}
+	if records[0].Start.IsZero() || records[0].End.Before(records[0].Start) {
+		t.Errorf("Unexpected times %+v", records[0])
+	}
+	if streaks := FailureStreaks(records); len(streaks) != 0 {
+		t.Errorf("The last run passed, got streaks %v", streaks)
+	}
+
+	log, _ := os.ReadFile(filepath.Join(dir, "logs", "run_job.log"))
+	if !strings.Contains(string(log), "test_job has failed 3 times in a row") {
+		t.Errorf("Third failure should alert, got %q", log)
+	}
+	if !strings.Contains(string(log), "test_job succeeded again after 3 failed runs") {
+		t.Errorf("Recovery should be reported, got %q", log)
+	}
+}
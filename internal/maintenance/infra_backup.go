@@ -0,0 +1,50 @@
+package maintenance
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/madhav/servctl/internal/ops"
+)
+
+// BackupKeyFile holds the passphrase for encrypted config backups, relative
+// to InfraRoot. It is excluded from the archives it protects.
+const BackupKeyFile = ".backup-key"
+
+// GenerateInfraConfigBackup generates the encrypted config backup script
+func GenerateInfraConfigBackup(config *ScriptConfig) (string, error) {
+	return generateScript("infra_config_backup", config)
+}
+
+// GenerateInfraConfigRestore generates the matching restore script
+func GenerateInfraConfigRestore(config *ScriptConfig) (string, error) {
+	return generateScript("restore_infra_config", config)
+}
+
+// EnsureBackupKey creates the config backup passphrase if it does not exist
+// and returns it so it can be shown to the user once
+func EnsureBackupKey(infraRoot string, dryRun bool) (string, error) {
+	path := filepath.Join(infraRoot, BackupKeyFile)
+
+	if data, err := os.ReadFile(path); err == nil {
+		return strings.TrimSpace(string(data)), nil
+	}
+
+	bytes := make([]byte, 24)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", fmt.Errorf("failed to generate backup key: %w", err)
+	}
+	key := hex.EncodeToString(bytes)
+
+	err := ops.Execute(dryRun,
+		ops.Mkdir{Path: infraRoot, Mode: 0755},
+		ops.WriteFile{Path: path, Content: []byte(key), Mode: 0600, Secret: true})
+	if err != nil {
+		return "", fmt.Errorf("failed to write backup key: %w", err)
+	}
+	return key, nil
+}
@@ -0,0 +1,239 @@
+package maintenance
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// LintIssue is a problem LintScript found in a generated script
+type LintIssue struct {
+	Line    int
+	Rule    string
+	Message string
+}
+
+func (i LintIssue) String() string {
+	if i.Line == 0 {
+		return fmt.Sprintf("%s [%s]", i.Message, i.Rule)
+	}
+	return fmt.Sprintf("line %d: %s [%s]", i.Line, i.Message, i.Rule)
+}
+
+var (
+	// heredocStart matches <<EOF, <<-EOF and <<'EOF'
+	heredocStart = regexp.MustCompile(`<<-?\s*['"]?(\w+)['"]?`)
+	// unguardedRm matches rm -r on "$VAR"/..., which becomes rm -r /... when
+	// VAR is empty (shellcheck SC2115)
+	unguardedRm = regexp.MustCompile(`\brm\s+-\w*[rR]\w*\s+"?\$\{?\w+\}?"?/`)
+	// varRef matches a variable expansion; special parameters ($?, $$, $#,
+	// $!, $0-$9) are safe unquoted where servctl's scripts use them
+	varRef = regexp.MustCompile(`\$(\{[A-Za-z_]\w*[^}]*\}|[A-Za-z_]\w*)`)
+	// assignment matches NAME= at the start of a word
+	assignment = regexp.MustCompile(`(^|[\s;(])(local\s+|export\s+)?[A-Za-z_]\w*(\[[^\]]*\])?\+?=\S*$`)
+)
+
+// LintScript checks a generated script against the rules every servctl
+// script follows, a small subset of shellcheck's, so a template change
+// that breaks them fails in tests and shows in --dry-run:
+//
+//   - shebang: the script starts with #!/bin/bash
+//   - strict-mode: set -euo pipefail comes before the first command
+//   - unquoted-var: a variable used outside double quotes, where spaces
+//     or globs in its value split it into several words (SC2086)
+//   - rm-unguarded: rm -r "$DIR"/..., which removes from / when DIR is
+//     empty; use "${DIR:?}"/... (SC2115)
+//   - backticks: `cmd` instead of $(cmd) (SC2006)
+//   - syntax: bash -n, when bash is installed
+func LintScript(content string) []LintIssue {
+	var issues []LintIssue
+	add := func(line int, rule, format string, args ...interface{}) {
+		issues = append(issues, LintIssue{Line: line, Rule: rule, Message: fmt.Sprintf(format, args...)})
+	}
+
+	lines := strings.Split(content, "\n")
+	if !strings.HasPrefix(content, "#!/bin/bash\n") {
+		add(1, "shebang", "script should start with #!/bin/bash")
+	}
+
+	strict := false
+	heredoc := ""
+	var state scanState
+	for i, line := range lines {
+		n := i + 1
+		if heredoc != "" {
+			if strings.TrimSpace(line) == heredoc {
+				heredoc = ""
+			}
+			continue
+		}
+		trimmed := strings.TrimSpace(line)
+		inString := state.inString()
+		if !inString && (trimmed == "" || strings.HasPrefix(trimmed, "#")) {
+			continue
+		}
+		if !strict && !inString {
+			if !isStrictMode(trimmed) {
+				add(n, "strict-mode", "set -euo pipefail should come before the first command")
+			}
+			strict = true
+		}
+
+		code := state.unquoted(line)
+		if m := heredocStart.FindStringSubmatch(code); m != nil {
+			heredoc = m[1]
+		}
+		if unguardedRm.MatchString(line) {
+			add(n, "rm-unguarded", "rm -r on a path built from a variable; use \"${VAR:?}\"/... so an empty VAR cannot reach /")
+		}
+		if strings.Contains(code, "`") {
+			add(n, "backticks", "use $(...) instead of backticks")
+		}
+		for _, loc := range varRef.FindAllStringIndex(code, -1) {
+			if assignment.MatchString(code[:loc[0]]) {
+				continue
+			}
+			add(n, "unquoted-var", "%s is not quoted", code[loc[0]:loc[1]])
+		}
+	}
+
+	if issue, ok := syntaxCheck(content); !ok {
+		issues = append(issues, issue)
+	}
+	return issues
+}
+
+// syntaxCheck runs bash -n on a script. ok is true when the script parses
+// or bash is not installed.
+func syntaxCheck(content string) (issue LintIssue, ok bool) {
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		return LintIssue{}, true
+	}
+	cmd := exec.Command(bash, "-n")
+	cmd.Stdin = strings.NewReader(content)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		message := strings.TrimSpace(stderr.String())
+		return LintIssue{Line: syntaxErrorLine(message), Rule: "syntax", Message: message}, false
+	}
+	return LintIssue{}, true
+}
+
+// isStrictMode reports whether a command turns on -e, -u and pipefail
+func isStrictMode(command string) bool {
+	fields := strings.Fields(command)
+	if len(fields) < 3 || fields[0] != "set" || !strings.HasPrefix(fields[1], "-") {
+		return false
+	}
+	flags := fields[1]
+	return strings.Contains(flags, "e") && strings.Contains(flags, "u") &&
+		strings.HasSuffix(flags, "o") && fields[2] == "pipefail"
+}
+
+// Contexts a character is read in: code (the script or a command
+// substitution), or a single- or double-quoted string
+const (
+	scanCode   = 'c'
+	scanSquote = 's'
+	scanDquote = 'd'
+)
+
+// scanState is where the scanner is at the end of a line: quoted strings
+// (awk programs, multi-line messages) may go on over several lines
+type scanState struct {
+	stack []byte // contexts, innermost last; empty means code
+	depth []int  // open parentheses per context
+}
+
+func (s *scanState) inString() bool {
+	return len(s.stack) > 0 && s.stack[len(s.stack)-1] != scanCode
+}
+
+// unquoted returns line with everything quoted, escaped, commented out or
+// inside arithmetic blanked, so what remains is what the shell splits into
+// words. Command substitutions are scanned as code of their own, also
+// inside double quotes.
+func (s *scanState) unquoted(line string) string {
+	out := []byte(line)
+	blank := func(from, to int) {
+		for k := from; k < to && k < len(out); k++ {
+			out[k] = ' '
+		}
+	}
+
+	if len(s.stack) == 0 {
+		s.stack, s.depth = []byte{scanCode}, []int{0}
+	}
+	stack, depth := s.stack, s.depth
+	defer func() { s.stack, s.depth = stack, depth }()
+	for i := 0; i < len(line); i++ {
+		top := stack[len(stack)-1]
+		c := line[i]
+		switch {
+		case top == scanSquote:
+			if c == '\'' {
+				stack = stack[:len(stack)-1]
+				depth = depth[:len(depth)-1]
+			}
+			out[i] = ' '
+		case c == '\\':
+			blank(i, i+2)
+			i++
+		case top == scanCode && c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			blank(i, len(line))
+			return string(out)
+		case top == scanCode && c == '\'':
+			stack = append(stack, scanSquote)
+			depth = append(depth, 0)
+			out[i] = ' '
+		case strings.HasPrefix(line[i:], "$(("):
+			end := strings.Index(line[i:], "))")
+			if end < 0 {
+				end = len(line) - i
+			}
+			blank(i, i+end+2)
+			i += end + 1
+		case strings.HasPrefix(line[i:], "$("):
+			stack = append(stack, scanCode)
+			depth = append(depth, 0)
+			i++
+		case top == scanCode && c == '"':
+			stack = append(stack, scanDquote)
+			depth = append(depth, 0)
+			out[i] = ' '
+		case top == scanDquote && c == '"':
+			stack = stack[:len(stack)-1]
+			depth = depth[:len(depth)-1]
+			out[i] = ' '
+		case top == scanDquote:
+			out[i] = ' '
+		case c == '(':
+			depth[len(depth)-1]++
+		case c == ')' && len(stack) > 1:
+			if depth[len(depth)-1] > 0 {
+				depth[len(depth)-1]--
+			} else {
+				stack = stack[:len(stack)-1]
+				depth = depth[:len(depth)-1]
+			}
+		}
+	}
+	return string(out)
+}
+
+// syntaxErrorLine reads the line number from bash -n's message
+// ("bash: line 12: syntax error ..."), 0 when there is none
+func syntaxErrorLine(message string) int {
+	_, rest, ok := strings.Cut(message, "line ")
+	if !ok {
+		return 0
+	}
+	digits, _, _ := strings.Cut(rest, ":")
+	n, _ := strconv.Atoi(digits)
+	return n
+}
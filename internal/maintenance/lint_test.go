@@ -0,0 +1,108 @@
+package maintenance
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/madhav/servctl/internal/paths"
+)
+
+// scriptVariants are the configurations every script is linted in: the
+// defaults, and everything optional turned on with awkward paths
+func scriptVariants() []*ScriptConfig {
+	full := DefaultScriptConfig()
+	full.DataRoot = "/mnt/my data"
+	full.LogDir = "/home/user/infra/logs"
+	full.WebhookURL = "https://discord.com/api/webhooks/1/abc"
+	full.BackupHeartbeatURL = "https://hc-ping.com/uuid"
+	full.ConfigBackupHeartbeatURL = "https://hc-ping.com/uuid2"
+	full.FastRoot = "/mnt/fast"
+	full.SnapshotDir = ".snapshots"
+	full.ServiceRoots = paths.Roots{"nextcloud": "/mnt/my ssd"}
+	full.OffsiteRemote = "b2:my-bucket/servctl"
+	full.ScrubPaths = []string{"/mnt/my data/photos", "/mnt/my data/docs"}
+	full.WebPorts = map[string]int{"Nextcloud": 8080, "Glances": 61208}
+	return []*ScriptConfig{DefaultScriptConfig(), full}
+}
+
+func TestLintScript_GeneratedScripts(t *testing.T) {
+	generators := map[string]func(*ScriptConfig) (string, error){
+		"daily_backup":         GenerateDailyBackup,
+		"disk_alert":           GenerateDiskAlert,
+		"smart_alert":          GenerateSmartAlert,
+		"weekly_cleanup":       GenerateWeeklyCleanup,
+		"drive_temp":           GenerateDriveTemp,
+		"bitrot_scrub":         GenerateBitrotScrub,
+		"self_check":           GenerateSelfCheck,
+		"restore_drill":        GenerateRestoreDrill,
+		"reboot_window":        GenerateRebootWindow,
+		"infra_config_backup":  GenerateInfraConfigBackup,
+		"restore_infra_config": GenerateInfraConfigRestore,
+		"run_job":              GenerateRunJob,
+		"critical_offsite":     GenerateCriticalOffsite,
+		"pim_export":           GeneratePIMExport,
+		"vuln_scan":            GenerateVulnScan,
+	}
+	for name, generate := range generators {
+		for _, config := range scriptVariants() {
+			content, err := generate(config)
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			for _, issue := range LintScript(content) {
+				t.Errorf("%s: %s", name, issue)
+			}
+			// The restore script is run by hand; each job's wrapper runs
+			// beside the others
+			manual := name == "restore_infra_config" || name == "run_job"
+			if !strings.Contains(content, `exec 8>>`) && !manual {
+				t.Errorf("%s should keep a second copy from running", name)
+			}
+		}
+	}
+}
+
+func TestLintScript_Rules(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		rule   string
+	}{
+		{"no shebang", "set -euo pipefail\necho hi\n", "shebang"},
+		{"no strict mode", "#!/bin/bash\necho hi\n", "strict-mode"},
+		{"strict mode late", "#!/bin/bash\ncd /tmp\nset -euo pipefail\n", "strict-mode"},
+		{"unquoted redirect", "#!/bin/bash\nset -euo pipefail\necho hi >> $LOGFILE\n", "unquoted-var"},
+		{"unquoted argument", "#!/bin/bash\nset -euo pipefail\nrm -f $FILE\n", "unquoted-var"},
+		{"unquoted in substitution", "#!/bin/bash\nset -euo pipefail\nX=\"$(basename $FILE)\"\n", "unquoted-var"},
+		{"rm from empty variable", "#!/bin/bash\nset -euo pipefail\nrm -rf \"$DIR\"/*\n", "rm-unguarded"},
+		{"backticks", "#!/bin/bash\nset -euo pipefail\nX=`date`\n", "backticks"},
+		{"syntax", "#!/bin/bash\nset -euo pipefail\nif true; then\n", "syntax"},
+	}
+	for _, tt := range tests {
+		var rules []string
+		for _, issue := range LintScript(tt.script) {
+			rules = append(rules, issue.Rule)
+		}
+		if !strings.Contains(strings.Join(rules, " "), tt.rule) {
+			t.Errorf("%s: expected %s, got %v", tt.name, tt.rule, rules)
+		}
+	}
+}
+
+func TestLintScript_Clean(t *testing.T) {
+	script := "#!/bin/bash\n" +
+		"# comment with $UNQUOTED\n" +
+		"set -euo pipefail\n" +
+		"X=$HOME\n" +
+		"rm -rf \"${DIR:?}\"/*.partial\n" +
+		"echo \"$(basename \"$0\" .sh) $X\" >> \"$LOGFILE\" # trailing $COMMENT\n" +
+		"awk '{print $1}' \"$FILE\"\n" +
+		"N=$(( COUNT + 1 ))\n" +
+		"cat <<EOF\n" +
+		"{ \"value\": $VALUE }\n" +
+		"EOF\n" +
+		"for F in $(ls); do echo \"$F\"; done\n"
+	if issues := LintScript(script); len(issues) > 0 {
+		t.Errorf("expected no issues, got %v", issues)
+	}
+}
@@ -1,8 +1,15 @@
 package maintenance
 
 import (
+	"os"
+	"os/exec"
+	"path/filepath"
 	"strings"
 	"testing"
+	"text/template"
+
+	"github.com/madhav/servctl/internal/runlock"
+	"github.com/madhav/servctl/templates"
 )
 
 func TestDefaultScriptConfig(t *testing.T) {
@@ -49,6 +56,8 @@ func TestGenerateDailyBackup(t *testing.T) {
 		"/mnt/data",
 		"/mnt/backup",
 		"rsync -av --delete",
+		"maintenance:mode --on",
+		"trap maintenance_off EXIT",
 		"NAS Guardian",
 		"curl",
 	}
@@ -78,7 +87,9 @@ func TestGenerateDiskAlert(t *testing.T) {
 		"THRESHOLD=85",
 		"/mnt/data",
 		"DISK FULL",
-		"df -h",
+		"df --output=pcent",
+		"EMERGENCY=95",
+		"-disk-emergency on",
 	}
 
 	for _, part := range expectedParts {
@@ -163,8 +174,8 @@ func TestGenerateAllScripts(t *testing.T) {
 		t.Fatalf("GenerateAllScripts() error: %v", err)
 	}
 
-	if len(scripts) != 4 {
-		t.Errorf("GenerateAllScripts() returned %d scripts, want 4", len(scripts))
+	if len(scripts) != 14 {
+		t.Errorf("GenerateAllScripts() returned %d scripts, want 14", len(scripts))
 	}
 
 	expectedScripts := []string{
@@ -172,6 +183,14 @@ func TestGenerateAllScripts(t *testing.T) {
 		"disk_alert.sh",
 		"smart_alert.sh",
 		"weekly_cleanup.sh",
+		"bitrot_scrub.sh",
+		"drive_temp.sh",
+		"reboot_window.sh",
+		"restore_drill.sh",
+		"infra_config_backup.sh",
+		"restore_infra_config.sh",
+		"critical_offsite.sh",
+		"pim_export.sh",
 	}
 
 	for _, expected := range expectedScripts {
@@ -236,6 +255,18 @@ func TestCronScheduleHumanReadable(t *testing.T) {
 			CronSchedule{"0", "*/6", "*", "*", "*"},
 			"Every 6 hours",
 		},
+		{
+			CronSchedule{"15", "3", "*", "*", "*"},
+			"Daily at 3:15",
+		},
+		{
+			CronSchedule{"*/30", "*", "*", "*", "*"},
+			"Every 30 minutes",
+		},
+		{
+			CronSchedule{"0", "6", "15", "1,4,7,10", "*"},
+			"Day 15 of Jan, Apr, Jul, Oct at 6:00",
+		},
 	}
 
 	for _, tt := range tests {
@@ -251,8 +282,8 @@ func TestCronScheduleHumanReadable(t *testing.T) {
 func TestDefaultCronJobs(t *testing.T) {
 	jobs := DefaultCronJobs("/home/user/infra/scripts")
 
-	if len(jobs) != 4 {
-		t.Errorf("DefaultCronJobs() returned %d jobs, want 4", len(jobs))
+	if len(jobs) != 5 {
+		t.Errorf("DefaultCronJobs() returned %d jobs, want 5", len(jobs))
 	}
 
 	expectedJobs := []string{
@@ -260,6 +291,7 @@ func TestDefaultCronJobs(t *testing.T) {
 		"disk_alert",
 		"smart_alert",
 		"weekly_cleanup",
+		"infra_config_backup",
 	}
 
 	for _, expected := range expectedJobs {
@@ -309,7 +341,10 @@ func TestGenerateCronFile(t *testing.T) {
 }
 
 func TestGenerateLogrotateConfig(t *testing.T) {
-	content := GenerateLogrotateConfig("/home/user/infra/logs", "madhav")
+	content, err := GenerateLogrotateConfig("/home/user/infra/logs", "madhav")
+	if err != nil {
+		t.Fatalf("GenerateLogrotateConfig failed: %v", err)
+	}
 
 	expectedParts := []string{
 		"/home/user/infra/logs/*.log",
@@ -379,8 +414,8 @@ func TestGenerateScriptsWithoutWebhook(t *testing.T) {
 		t.Fatalf("GenerateAllScripts() without webhook error: %v", err)
 	}
 
-	if len(scripts) != 4 {
-		t.Errorf("Should still generate 4 scripts without webhook")
+	if len(scripts) != 14 {
+		t.Errorf("Should still generate 14 scripts without webhook")
 	}
 
 	// Check that curl is NOT in the output (no webhook)
@@ -402,3 +437,178 @@ func BenchmarkGenerateAllScripts(b *testing.B) {
 		GenerateAllScripts(config)
 	}
 }
+
+func TestGenerateInfraConfigBackup(t *testing.T) {
+	config := DefaultScriptConfig()
+	config.InfraRoot = "/home/user/infra"
+	config.LogDir = "/home/user/infra/logs"
+
+	content, err := GenerateInfraConfigBackup(config)
+	if err != nil {
+		t.Fatalf("GenerateInfraConfigBackup() error: %v", err)
+	}
+
+	checks := []string{
+		`DEST="/mnt/backup/infra-config"`,
+		`KEYFILE="/home/user/infra/.backup-key"`,
+		"openssl enc -aes-256-cbc -pbkdf2",
+		`--exclude="$(basename "$INFRA_ROOT")/.backup-key"`,
+		`-mtime +"$RETENTION_DAYS" -delete`,
+	}
+	for _, check := range checks {
+		if !strings.Contains(content, check) {
+			t.Errorf("Config backup script missing %q", check)
+		}
+	}
+
+	restore, err := GenerateInfraConfigRestore(config)
+	if err != nil {
+		t.Fatalf("GenerateInfraConfigRestore() error: %v", err)
+	}
+	if !strings.Contains(restore, "openssl enc -d -aes-256-cbc -pbkdf2") {
+		t.Error("Restore script should decrypt with matching openssl options")
+	}
+}
+
+func TestEnsureBackupKey(t *testing.T) {
+	dir := t.TempDir()
+
+	key, err := EnsureBackupKey(dir, false)
+	if err != nil {
+		t.Fatalf("EnsureBackupKey() error: %v", err)
+	}
+	if len(key) != 48 {
+		t.Errorf("Backup key length = %d, want 48", len(key))
+	}
+
+	again, _ := EnsureBackupKey(dir, false)
+	if again != key {
+		t.Error("EnsureBackupKey() should reuse an existing key")
+	}
+}
+
+func TestGenerateDailyBackup_Heartbeat(t *testing.T) {
+	config := DefaultScriptConfig()
+	config.LogDir = "/home/user/logs"
+
+	content, _ := GenerateDailyBackup(config)
+	if strings.Contains(content, "HEARTBEAT_URL") {
+		t.Error("Backup script should not ping without a heartbeat URL")
+	}
+
+	config.BackupHeartbeatURL = "https://hc-ping.com/abc-123"
+	content, _ = GenerateDailyBackup(config)
+	for _, check := range []string{`HEARTBEAT_URL="https://hc-ping.com/abc-123"`, `"$HEARTBEAT_URL/start"`, `"$HEARTBEAT_URL/fail"`} {
+		if !strings.Contains(content, check) {
+			t.Errorf("Backup script missing %q", check)
+		}
+	}
+
+	config.InfraRoot = "/home/user/infra"
+	config.ConfigBackupHeartbeatURL = "http://10.0.0.5:8000/ping/cfg"
+	content, _ = GenerateInfraConfigBackup(config)
+	if !strings.Contains(content, `"http://10.0.0.5:8000/ping/cfg/fail"`) {
+		t.Error("Config backup script should report failures to its heartbeat")
+	}
+}
+
+func TestScripts_TakeRunLock(t *testing.T) {
+	config := DefaultScriptConfig()
+	config.InfraRoot = "/home/user/infra"
+	config.LogDir = "/home/user/infra/logs"
+	generators := map[string]func(*ScriptConfig) (string, error){
+		"daily backup":   GenerateDailyBackup,
+		"config backup":  GenerateInfraConfigBackup,
+		"config restore": GenerateInfraConfigRestore,
+		"weekly cleanup": GenerateWeeklyCleanup,
+	}
+	for name, generate := range generators {
+		content, err := generate(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(content, `LOCKFILE="/home/user/infra/servctl.lock"`) || !strings.Contains(content, "flock -w") {
+			t.Errorf("%s script should take the run lock", name)
+		}
+	}
+}
+
+func TestRunLockSnippet_WaitsForServctl(t *testing.T) {
+	if _, err := exec.LookPath("flock"); err != nil {
+		t.Skip("flock not installed")
+	}
+	dir := t.TempDir()
+	config := &ScriptConfig{InfraRoot: dir, LogDir: dir}
+	tmpl := template.Must(template.New("job").Funcs(templates.Funcs).Funcs(scriptFuncs).
+		ParseFS(templates.FS(), "scripts/_run_lock.sh.tmpl"))
+	template.Must(tmpl.Parse("#!/bin/bash\nLOGFILE=\"{{ .LogDir }}/test.log\"\n{{ template \"run_lock\" . }}echo locked\n"))
+	var script strings.Builder
+	if err := tmpl.Execute(&script, config); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "job.sh")
+	os.WriteFile(path, []byte(script.String()), 0755)
+
+	lock, _, err := runlock.TryAcquire(dir, "servctl -network-refresh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command("bash", path)
+	cmd.Env = append(os.Environ(), "SERVCTL_RUN_LOCK=", "LOCK_WAIT_MINUTES=0")
+	if err := cmd.Run(); err == nil || cmd.ProcessState.ExitCode() != 75 {
+		t.Errorf("Script should give up with 75 while servctl holds the lock, got %v", err)
+	}
+	log, _ := os.ReadFile(filepath.Join(dir, "test.log"))
+	if !strings.Contains(string(log), "Waiting for servctl -network-refresh") {
+		t.Errorf("Script should log the holder, got %q", log)
+	}
+	lock.Release()
+
+	cmd = exec.Command("bash", path)
+	cmd.Env = append(os.Environ(), "SERVCTL_RUN_LOCK=")
+	if out, err := cmd.Output(); err != nil || !strings.Contains(string(out), "locked") {
+		t.Errorf("Script should run once the lock is free: %v %s", err, out)
+	}
+	if h := runlock.ReadHolder(dir); h == nil || h.Command != "job.sh" {
+		t.Errorf("Script should record itself as the holder, got %+v", h)
+	}
+}
+
+// TestScriptTemplates_Render renders every script template with and without
+// the optional settings, so a field a template names but the data lacks
+// shows up here rather than on a server
+func TestScriptTemplates_Render(t *testing.T) {
+	full := DefaultScriptConfig()
+	full.WebhookURL = "https://discord.com/api/webhooks/1/abc"
+	full.BackupHeartbeatURL = "https://hc-ping.com/uuid"
+	full.SnapshotDir = "/mnt/data/.snapshots"
+	generators := map[string]func(*ScriptConfig) (string, error){
+		"daily_backup":         GenerateDailyBackup,
+		"disk_alert":           GenerateDiskAlert,
+		"smart_alert":          GenerateSmartAlert,
+		"weekly_cleanup":       GenerateWeeklyCleanup,
+		"drive_temp":           GenerateDriveTemp,
+		"bitrot_scrub":         GenerateBitrotScrub,
+		"self_check":           GenerateSelfCheck,
+		"restore_drill":        GenerateRestoreDrill,
+		"reboot_window":        GenerateRebootWindow,
+		"infra_config_backup":  GenerateInfraConfigBackup,
+		"restore_infra_config": GenerateInfraConfigRestore,
+		"run_job":              GenerateRunJob,
+	}
+	for name, generate := range generators {
+		for _, config := range []*ScriptConfig{DefaultScriptConfig(), full} {
+			content, err := generate(config)
+			if err != nil {
+				t.Errorf("%s: %v", name, err)
+				continue
+			}
+			if !strings.HasPrefix(content, "#!/bin/bash") {
+				t.Errorf("%s should start with a shebang, got %.40q", name, content)
+			}
+			if strings.Contains(content, "<no value>") || strings.Contains(content, "{{") {
+				t.Errorf("%s has unrendered template text", name)
+			}
+		}
+	}
+}
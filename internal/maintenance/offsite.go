@@ -0,0 +1,76 @@
+package maintenance
+
+import (
+	"bufio"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/madhav/servctl/internal/paths"
+)
+
+// DefaultOffsiteRetentionDays is how long critical-data archives are kept on
+// the remote
+const DefaultOffsiteRetentionDays = 30
+
+// GenerateCriticalOffsite generates the nightly critical-data offsite script:
+// database dumps, the Nextcloud config, Immich profiles and XMP sidecars and
+// ~/infra, encrypted with the config backup key and copied with rclone. It
+// is small enough for any uplink; photos and files themselves stay local.
+func GenerateCriticalOffsite(config *ScriptConfig) (string, error) {
+	return generateScript("critical_offsite", config)
+}
+
+// CriticalDirs are the data directories copied whole into the archive
+func (c *ScriptConfig) CriticalDirs() []string {
+	return []string{
+		c.ServiceRoots.Join(c.DataRoot, paths.CloudConfig),
+		c.ServiceRoots.Join(c.DataRoot, paths.GalleryProfile),
+	}
+}
+
+// SidecarDir is searched for the XMP sidecars that hold edits to photos
+func (c *ScriptConfig) SidecarDir() string {
+	return c.ServiceRoots.Join(c.DataRoot, paths.GalleryLibrary)
+}
+
+// ValidateOffsiteRemote checks an rclone destination such as
+// "b2:my-bucket/servctl". A local path is refused: it is not offsite.
+func ValidateOffsiteRemote(remote string) error {
+	name, _, ok := strings.Cut(remote, ":")
+	if !ok || name == "" || strings.ContainsAny(name, "/ ") {
+		return fmt.Errorf("remote must be an rclone remote such as b2:bucket/servctl (see 'rclone config')")
+	}
+	return nil
+}
+
+// PromptOffsiteRemote asks where the critical-data archives go and how long
+// they are kept. An empty remote means the sync is not set up.
+func PromptOffsiteRemote(reader *bufio.Reader, config *ScriptConfig) {
+	fmt.Println("Critical data offsite (database dumps, configs, sidecars; encrypted):")
+	fmt.Println("  Needs an rclone remote: run 'rclone config' first.")
+	for {
+		fmt.Print("  rclone remote (e.g. b2:bucket/servctl, Enter to skip): ")
+		response, _ := reader.ReadString('\n')
+		remote := strings.TrimRight(strings.TrimSpace(response), "/")
+		if remote == "" {
+			config.OffsiteRemote = ""
+			return
+		}
+		if err := ValidateOffsiteRemote(remote); err != nil {
+			fmt.Printf("  ✗ %v\n", err)
+			continue
+		}
+		config.OffsiteRemote = remote
+		break
+	}
+
+	if config.OffsiteRetentionDays <= 0 {
+		config.OffsiteRetentionDays = DefaultOffsiteRetentionDays
+	}
+	fmt.Printf("  Keep archives for how many days? [%d]: ", config.OffsiteRetentionDays)
+	response, _ := reader.ReadString('\n')
+	if days, err := strconv.Atoi(strings.TrimSpace(response)); err == nil && days > 0 {
+		config.OffsiteRetentionDays = days
+	}
+}
@@ -0,0 +1,65 @@
+package maintenance
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+
+	"github.com/madhav/servctl/internal/paths"
+)
+
+func TestValidateOffsiteRemote(t *testing.T) {
+	for _, remote := range []string{"b2:bucket/servctl", "gdrive:", "s3:my bucket/x"} {
+		if err := ValidateOffsiteRemote(remote); err != nil {
+			t.Errorf("%q should be accepted: %v", remote, err)
+		}
+	}
+	for _, remote := range []string{"/mnt/backup", "bucket", ":b2:bucket", "./local:x"} {
+		if err := ValidateOffsiteRemote(remote); err == nil {
+			t.Errorf("%q should be refused", remote)
+		}
+	}
+}
+
+func TestPromptOffsiteRemote(t *testing.T) {
+	config := DefaultScriptConfig()
+	PromptOffsiteRemote(bufio.NewReader(strings.NewReader("/mnt/usb\nb2:bucket/servctl/\n90\n")), config)
+	if config.OffsiteRemote != "b2:bucket/servctl" || config.OffsiteRetentionDays != 90 {
+		t.Errorf("Got %q, %d days", config.OffsiteRemote, config.OffsiteRetentionDays)
+	}
+
+	PromptOffsiteRemote(bufio.NewReader(strings.NewReader("\n")), config)
+	if config.OffsiteRemote != "" {
+		t.Error("Enter should skip the offsite sync")
+	}
+}
+
+func TestGenerateCriticalOffsite(t *testing.T) {
+	config := DefaultScriptConfig()
+	config.InfraRoot = "/home/user/infra"
+	config.LogDir = "/home/user/infra/logs"
+	config.OffsiteRemote = "b2:bucket/servctl"
+	config.ServiceRoots = paths.Roots{"nextcloud": "/mnt/ssd"}
+
+	content, err := GenerateCriticalOffsite(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`REMOTE="b2:bucket/servctl"`,
+		"RETENTION_DAYS=30",
+		`"/mnt/ssd/cloud/config"`,
+		`SIDECARS="/mnt/data/gallery/library"`,
+		"pg_dump -U immich",
+		"mariadb-dump --single-transaction",
+		"openssl enc -aes-256-cbc",
+	} {
+		if !strings.Contains(content, want) {
+			t.Errorf("critical offsite script is missing %s", want)
+		}
+	}
+	// Photos and files themselves stay local
+	if strings.Contains(content, "cloud/data") {
+		t.Error("Nextcloud user files should not be sent offsite")
+	}
+}
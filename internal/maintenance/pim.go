@@ -0,0 +1,16 @@
+package maintenance
+
+import "github.com/madhav/servctl/internal/paths"
+
+// GeneratePIMExport generates the nightly calendar and contacts export:
+// every Nextcloud user's calendars as .ics and address books as .vcf,
+// written to PIMExportDir before the data backup so each backup set holds
+// files that import anywhere, no database restore needed
+func GeneratePIMExport(config *ScriptConfig) (string, error) {
+	return generateScript("pim_export", config)
+}
+
+// PIMExportDir is where the export is written, one folder per user
+func (c *ScriptConfig) PIMExportDir() string {
+	return c.ServiceRoots.Join(c.DataRoot, paths.CloudExport)
+}
@@ -0,0 +1,42 @@
+package maintenance
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/madhav/servctl/internal/paths"
+)
+
+func TestGeneratePIMExport(t *testing.T) {
+	config := DefaultScriptConfig()
+	config.LogDir = "/home/user/infra/logs"
+	config.ServiceRoots = paths.Roots{"nextcloud": "/mnt/ssd"}
+
+	content, err := GeneratePIMExport(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`EXPORT_DIR="/mnt/ssd/cloud/export"`,
+		"FROM ${PREFIX}calendarobjects",
+		"FROM ${PREFIX}cards",
+		"uri <> 'contact_birthdays'",
+		"mariadb --batch --raw",
+	} {
+		if !strings.Contains(content, want) {
+			t.Errorf("export script is missing %s", want)
+		}
+	}
+}
+
+func TestStaggerJobs_ExportBeforeBackup(t *testing.T) {
+	sel := ScriptSelection{DailyBackup: true, InfraConfig: true, PIMExport: true}
+	jobs := staggerJobs(CronJobsForSelection(sel, "/home/user/infra/scripts", "daily"), nil)
+	checkNoOverlap(t, jobs)
+
+	export := startMinutes(jobByName(jobs, "pim_export").Schedule)[0]
+	backup := startMinutes(jobByName(jobs, "daily_backup").Schedule)[0]
+	if export >= backup {
+		t.Errorf("The export should finish before the backup copies it: %s vs %s", clock(export), clock(backup))
+	}
+}
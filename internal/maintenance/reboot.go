@@ -0,0 +1,116 @@
+package maintenance
+
+import (
+	"bufio"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// RebootMarkerFile is written, relative to InfraRoot, just before a window
+// reboot; the boot-time run finds it and verifies the server came back
+const RebootMarkerFile = "reboot.pending"
+
+// RebootWindowScript is the reboot window script's file name in the
+// scripts directory written by GetScriptsForSelection
+const RebootWindowScript = "reboot-window.sh"
+
+// Default reboot window: first Sunday of the month at 5 AM, after the
+// nightly backups (StaggerJobs places the other jobs around it)
+const (
+	DefaultRebootWeekday = 0
+	DefaultRebootHour    = 5
+)
+
+// weekdayNames are cron day-of-week numbers' short names
+var weekdayNames = []string{"Sun", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat"}
+
+// rebootTemplateData adds the weekday's name to the script configuration
+type rebootTemplateData struct {
+	*ScriptConfig
+	RebootWeekdayName string
+}
+
+// GenerateRebootWindow generates the monthly reboot window script
+func GenerateRebootWindow(config *ScriptConfig) (string, error) {
+	data := rebootTemplateData{ScriptConfig: config, RebootWeekdayName: WeekdayName(config.RebootWeekday)}
+	return generateScript("reboot_window", data)
+}
+
+// WeekdayName returns the short name of a cron day-of-week number
+func WeekdayName(day int) string {
+	if day < 0 || day >= len(weekdayNames) {
+		return strconv.Itoa(day)
+	}
+	return weekdayNames[day]
+}
+
+// RebootWindowJobs returns the cron jobs of the reboot window: the monthly
+// run, scheduled on days 1-7 so the script can pick the first of its
+// weekday, and the boot-time verification
+func RebootWindowJobs(config *ScriptConfig, scriptsDir string) []CronJob {
+	script := filepath.Join(scriptsDir, RebootWindowScript)
+	return []CronJob{
+		{
+			Name:        "reboot_window",
+			Schedule:    CronSchedule{Minute: "0", Hour: strconv.Itoa(config.RebootHour), DayOfMonth: "1-7", Month: "*", DayOfWeek: "*"},
+			Command:     script,
+			Description: fmt.Sprintf("Reboot window: first %s of the month at %d:00, if updates need it", WeekdayName(config.RebootWeekday), config.RebootHour),
+			User:        "root",
+		},
+		{
+			Name:        "reboot_verify",
+			Schedule:    AtBoot,
+			Command:     script + " --after-boot",
+			Description: "Restart the stack and report after a window reboot",
+			User:        "root",
+		},
+	}
+}
+
+// ParseRebootWindow parses a window such as "Sun 5" or "sat 04:00" into a
+// cron weekday and hour
+func ParseRebootWindow(s string) (weekday, hour int, err error) {
+	fields := strings.Fields(s)
+	if len(fields) != 2 {
+		return 0, 0, fmt.Errorf("expected a day and an hour, e.g. Sun 5")
+	}
+
+	weekday = -1
+	for i, name := range weekdayNames {
+		if strings.EqualFold(fields[0], name) {
+			weekday = i
+		}
+	}
+	if weekday < 0 {
+		return 0, 0, fmt.Errorf("unknown day %q (use Sun, Mon, ... Sat)", fields[0])
+	}
+
+	h, _, _ := strings.Cut(fields[1], ":")
+	hour, err = strconv.Atoi(h)
+	if err != nil || hour < 0 || hour > 23 {
+		return 0, 0, fmt.Errorf("invalid hour %q", fields[1])
+	}
+	return weekday, hour, nil
+}
+
+// PromptRebootWindow asks when the monthly reboot may happen
+func PromptRebootWindow(reader *bufio.Reader, config *ScriptConfig) {
+	def := fmt.Sprintf("%s %d", WeekdayName(config.RebootWeekday), config.RebootHour)
+	for {
+		fmt.Printf("Reboot window, first day of that name each month [%s]: ", def)
+		response, _ := reader.ReadString('\n')
+		response = strings.TrimSpace(response)
+		if response == "" {
+			return
+		}
+		weekday, hour, err := ParseRebootWindow(response)
+		if err != nil {
+			fmt.Printf("  ✗ %v\n", err)
+			continue
+		}
+		config.RebootWeekday, config.RebootHour = weekday, hour
+		return
+	}
+}
@@ -0,0 +1,86 @@
+package maintenance
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGenerateRebootWindow(t *testing.T) {
+	config := DefaultScriptConfig()
+	config.InfraRoot = "/home/user/infra"
+	config.LogDir = "/home/user/infra/logs"
+	config.RebootWeekday = 6
+
+	content, err := GenerateRebootWindow(config)
+	if err != nil {
+		t.Fatalf("GenerateRebootWindow() error: %v", err)
+	}
+	for _, check := range []string{
+		"WEEKDAY=6",
+		"First Sat of the month at 5:00",
+		`MARKER="/home/user/infra/reboot.pending"`,
+		"/var/run/reboot-required",
+		"canonical-livepatch status",
+		`docker compose -f "$COMPOSE_FILE" stop --timeout 60`,
+		`docker compose -f "$COMPOSE_FILE" start`,
+	} {
+		if !strings.Contains(content, check) {
+			t.Errorf("Reboot window script missing %q", check)
+		}
+	}
+	// The stack is stopped before rebooting
+	if strings.Index(content, "stop --timeout 60") > strings.Index(content, "systemctl reboot") {
+		t.Error("Reboot window script should stop the stack before rebooting")
+	}
+	if strings.Contains(content, "curl") {
+		t.Error("Reboot window script should not notify without a webhook")
+	}
+}
+
+func TestRebootWindowJobs(t *testing.T) {
+	config := DefaultScriptConfig()
+	jobs := RebootWindowJobs(config, "/home/user/infra/scripts")
+	if len(jobs) != 2 {
+		t.Fatalf("RebootWindowJobs() = %+v, want the window and the boot check", jobs)
+	}
+	if got := jobs[0].Schedule.String(); got != "0 5 1-7 * *" {
+		t.Errorf("window schedule = %q, want the first week of the month at 5 AM", got)
+	}
+	if got := jobs[1].Schedule.String(); got != "@reboot" {
+		t.Errorf("verify schedule = %q, want @reboot", got)
+	}
+	if jobs[1].Command != "/home/user/infra/scripts/reboot-window.sh --after-boot" {
+		t.Errorf("verify command = %q", jobs[1].Command)
+	}
+
+	cron, _ := GenerateCronFile(jobs)
+	if !strings.Contains(cron, "@reboot root /home/user/infra/scripts/reboot-window.sh --after-boot") {
+		t.Errorf("cron file missing the boot entry:\n%s", cron)
+	}
+}
+
+func TestParseRebootWindow(t *testing.T) {
+	tests := []struct {
+		input   string
+		weekday int
+		hour    int
+		wantErr bool
+	}{
+		{"Sun 5", 0, 5, false},
+		{"sat 04:00", 6, 4, false},
+		{"Wed 23", 3, 23, false},
+		{"Sunday 5", 0, 0, true},
+		{"Sun 24", 0, 0, true},
+		{"5", 0, 0, true},
+	}
+	for _, tt := range tests {
+		weekday, hour, err := ParseRebootWindow(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseRebootWindow(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && (weekday != tt.weekday || hour != tt.hour) {
+			t.Errorf("ParseRebootWindow(%q) = %d, %d, want %d, %d", tt.input, weekday, hour, tt.weekday, tt.hour)
+		}
+	}
+}
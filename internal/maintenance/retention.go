@@ -0,0 +1,207 @@
+package maintenance
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/madhav/servctl/internal/ops"
+)
+
+// SnapshotDir is the directory under BackupDest that holds dated backup sets
+const SnapshotDir = "snapshots"
+
+// SnapshotTimeFormat names each backup set (matches date +%Y-%m-%d_%H%M%S)
+const SnapshotTimeFormat = "2006-01-02_150405"
+
+// RetentionPolicy decides which backup sets survive pruning. Each rule keeps
+// the newest set of its last N periods, so one set can satisfy several rules.
+type RetentionPolicy struct {
+	KeepDaily   int
+	KeepWeekly  int
+	KeepMonthly int
+}
+
+// DefaultRetentionPolicy keeps a week of dailies, a month of weeklies and
+// half a year of monthlies
+func DefaultRetentionPolicy() RetentionPolicy {
+	return RetentionPolicy{KeepDaily: 7, KeepWeekly: 4, KeepMonthly: 6}
+}
+
+// String formats the policy as "7 daily, 4 weekly, 6 monthly"
+func (p RetentionPolicy) String() string {
+	return fmt.Sprintf("%d daily, %d weekly, %d monthly", p.KeepDaily, p.KeepWeekly, p.KeepMonthly)
+}
+
+// Snapshot is one hardlinked backup set
+type Snapshot struct {
+	Name string
+	Path string
+	Time time.Time
+}
+
+// PrunePlan lists the sets a policy keeps and removes
+type PrunePlan struct {
+	Keep         []Snapshot
+	Prune        []Snapshot
+	ReclaimBytes uint64 // Space freed once the pruned sets are deleted
+}
+
+// SnapshotsPath returns the snapshot directory under a backup destination
+func SnapshotsPath(backupDest string) string {
+	return filepath.Join(backupDest, SnapshotDir)
+}
+
+// ListSnapshots returns the backup sets in dir, newest first. Entries that
+// are not dated sets (the "latest" link, unfinished ".partial" runs) are skipped.
+func ListSnapshots(dir string) ([]Snapshot, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read %s: %w", dir, err)
+	}
+
+	var snapshots []Snapshot
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		t, err := time.ParseInLocation(SnapshotTimeFormat, entry.Name(), time.Local)
+		if err != nil {
+			continue
+		}
+		snapshots = append(snapshots, Snapshot{
+			Name: entry.Name(),
+			Path: filepath.Join(dir, entry.Name()),
+			Time: t,
+		})
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].Time.After(snapshots[j].Time)
+	})
+	return snapshots, nil
+}
+
+// retentionBucket tracks one keep rule while walking sets newest first
+type retentionBucket struct {
+	remaining int
+	last      string
+	period    func(time.Time) string
+}
+
+// SelectRetained splits snapshots (newest first) into kept and pruned sets.
+// The newest set is always kept. The generated backup script applies the
+// same rules, so keep the two in step.
+func SelectRetained(snapshots []Snapshot, policy RetentionPolicy) (keep, prune []Snapshot) {
+	buckets := []*retentionBucket{
+		{remaining: policy.KeepDaily, period: func(t time.Time) string { return t.Format("2006-01-02") }},
+		{remaining: policy.KeepWeekly, period: func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%d-%02d", year, week)
+		}},
+		{remaining: policy.KeepMonthly, period: func(t time.Time) string { return t.Format("2006-01") }},
+	}
+
+	for i, snap := range snapshots {
+		kept := i == 0
+		for _, b := range buckets {
+			key := b.period(snap.Time)
+			if b.remaining > 0 && key != b.last {
+				b.last = key
+				b.remaining--
+				kept = true
+			}
+		}
+		if kept {
+			keep = append(keep, snap)
+		} else {
+			prune = append(prune, snap)
+		}
+	}
+	return keep, prune
+}
+
+// reclaimableBytes sums the files that would be freed by deleting sets.
+// Sets share unchanged files through hardlinks, so a file only counts once
+// every one of its links lives inside the sets being removed.
+func reclaimableBytes(sets []Snapshot) (uint64, error) {
+	type inode struct {
+		dev, ino uint64
+	}
+	seen := make(map[inode]uint64)
+	sizes := make(map[inode]uint64)
+	links := make(map[inode]uint64)
+
+	for _, set := range sets {
+		err := filepath.WalkDir(set.Path, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			dev, ino, nlink, ok := fileID(info)
+			if !ok {
+				return nil
+			}
+			key := inode{dev: dev, ino: ino}
+			seen[key]++
+			sizes[key] = uint64(info.Size())
+			links[key] = nlink
+			return nil
+		})
+		if err != nil {
+			return 0, fmt.Errorf("failed to scan %s: %w", set.Path, err)
+		}
+	}
+
+	var total uint64
+	for key, count := range seen {
+		if count >= links[key] {
+			total += sizes[key]
+		}
+	}
+	return total, nil
+}
+
+// PlanPrune works out which backup sets under backupDest the policy removes
+// and how much space that frees
+func PlanPrune(backupDest string, policy RetentionPolicy) (*PrunePlan, error) {
+	snapshots, err := ListSnapshots(SnapshotsPath(backupDest))
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &PrunePlan{}
+	plan.Keep, plan.Prune = SelectRetained(snapshots, policy)
+
+	plan.ReclaimBytes, err = reclaimableBytes(plan.Prune)
+	if err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// ApplyPrune deletes the sets a plan marks for removal
+func ApplyPrune(plan *PrunePlan, dryRun bool) error {
+	var steps []ops.Operation
+	for _, snap := range plan.Prune {
+		steps = append(steps, ops.Func{Description: "delete " + snap.Path, Fn: func() error {
+			if err := os.RemoveAll(snap.Path); err != nil {
+				return fmt.Errorf("failed to delete %s: %w", snap.Path, err)
+			}
+			return nil
+		}})
+	}
+	return ops.Execute(dryRun, steps...)
+}
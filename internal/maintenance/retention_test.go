@@ -0,0 +1,256 @@
+package maintenance
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// dailySnapshots returns one set per day for n days ending at end, newest first
+func dailySnapshots(end time.Time, n int) []Snapshot {
+	var snaps []Snapshot
+	for i := 0; i < n; i++ {
+		t := end.AddDate(0, 0, -i)
+		snaps = append(snaps, Snapshot{Name: t.Format(SnapshotTimeFormat), Time: t})
+	}
+	return snaps
+}
+
+func TestSelectRetained(t *testing.T) {
+	end := time.Date(2025, 6, 30, 3, 0, 0, 0, time.Local)
+	snaps := dailySnapshots(end, 120)
+
+	keep, prune := SelectRetained(snaps, RetentionPolicy{KeepDaily: 7, KeepWeekly: 4, KeepMonthly: 3})
+
+	if len(keep)+len(prune) != len(snaps) {
+		t.Fatalf("keep+prune = %d, want %d", len(keep)+len(prune), len(snaps))
+	}
+	if keep[0].Name != snaps[0].Name {
+		t.Errorf("newest set %s was not kept", snaps[0].Name)
+	}
+
+	kept := make(map[string]bool)
+	for _, s := range keep {
+		kept[s.Name] = true
+	}
+
+	// The last 7 days are all kept
+	for _, s := range snaps[:7] {
+		if !kept[s.Name] {
+			t.Errorf("daily set %s should be kept", s.Name)
+		}
+	}
+
+	// Newest set of April and May are monthly keepers
+	for _, name := range []string{"2025-05-31_030000", "2025-04-30_030000"} {
+		if !kept[name] {
+			t.Errorf("monthly set %s should be kept", name)
+		}
+	}
+
+	// Daily sets from mid-May are covered by no rule
+	if kept["2025-05-15_030000"] {
+		t.Error("2025-05-15 should be pruned")
+	}
+
+	// 7 daily + 4 weekly + 3 monthly can overlap, never exceed
+	if len(keep) > 14 {
+		t.Errorf("kept %d sets, want at most 14", len(keep))
+	}
+}
+
+func TestSelectRetained_KeepsNewest(t *testing.T) {
+	snaps := dailySnapshots(time.Now(), 3)
+
+	keep, prune := SelectRetained(snaps, RetentionPolicy{})
+
+	if len(keep) != 1 || keep[0].Name != snaps[0].Name {
+		t.Errorf("keep = %v, want only the newest set", keep)
+	}
+	if len(prune) != 2 {
+		t.Errorf("prune = %d sets, want 2", len(prune))
+	}
+}
+
+func TestListSnapshots(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"2025-06-01_030000", "2025-06-02_030000", "2025-06-03_030000.partial", "notes"} {
+		if err := os.Mkdir(filepath.Join(dir, name), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("2025-06-02_030000", filepath.Join(dir, "latest")); err != nil {
+		t.Fatal(err)
+	}
+
+	snaps, err := ListSnapshots(dir)
+	if err != nil {
+		t.Fatalf("ListSnapshots() error: %v", err)
+	}
+	if len(snaps) != 2 {
+		t.Fatalf("ListSnapshots() = %d sets, want 2", len(snaps))
+	}
+	if snaps[0].Name != "2025-06-02_030000" {
+		t.Errorf("first set = %s, want newest", snaps[0].Name)
+	}
+
+	missing, err := ListSnapshots(filepath.Join(dir, "missing"))
+	if err != nil || len(missing) != 0 {
+		t.Errorf("ListSnapshots(missing) = %v, %v; want empty, nil", missing, err)
+	}
+}
+
+func TestPlanPrune_ReclaimBytes(t *testing.T) {
+	dest := t.TempDir()
+	snapDir := SnapshotsPath(dest)
+	oldSet := filepath.Join(snapDir, "2025-01-01_030000")
+	newSet := filepath.Join(snapDir, "2025-06-01_030000")
+	for _, d := range []string{oldSet, newSet} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// shared.bin is hardlinked into both sets; only removed.bin is freed
+	shared := filepath.Join(oldSet, "shared.bin")
+	if err := os.WriteFile(shared, make([]byte, 4096), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Link(shared, filepath.Join(newSet, "shared.bin")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(oldSet, "removed.bin"), make([]byte, 1000), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	plan, err := PlanPrune(dest, RetentionPolicy{KeepDaily: 1})
+	if err != nil {
+		t.Fatalf("PlanPrune() error: %v", err)
+	}
+	if len(plan.Prune) != 1 || plan.Prune[0].Path != oldSet {
+		t.Fatalf("Prune = %v, want only %s", plan.Prune, oldSet)
+	}
+	if plan.ReclaimBytes != 1000 {
+		t.Errorf("ReclaimBytes = %d, want 1000", plan.ReclaimBytes)
+	}
+
+	if err := ApplyPrune(plan, true); err != nil {
+		t.Fatalf("ApplyPrune(dryRun) error: %v", err)
+	}
+	if _, err := os.Stat(oldSet); err != nil {
+		t.Error("dry run should not delete sets")
+	}
+
+	if err := ApplyPrune(plan, false); err != nil {
+		t.Fatalf("ApplyPrune() error: %v", err)
+	}
+	if _, err := os.Stat(oldSet); !os.IsNotExist(err) {
+		t.Error("pruned set still exists")
+	}
+	if _, err := os.Stat(filepath.Join(newSet, "shared.bin")); err != nil {
+		t.Error("kept set lost its hardlinked file")
+	}
+}
+
+func TestParseRetentionPolicy(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    RetentionPolicy
+		wantErr bool
+	}{
+		{"7/4/6", RetentionPolicy{7, 4, 6}, false},
+		{" 14 / 0 / 12 ", RetentionPolicy{14, 0, 12}, false},
+		{"7/4", RetentionPolicy{}, true},
+		{"7/x/6", RetentionPolicy{}, true},
+		{"-1/4/6", RetentionPolicy{}, true},
+		{"0/0/0", RetentionPolicy{}, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseRetentionPolicy(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseRetentionPolicy(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseRetentionPolicy(%q) = %+v, want %+v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestGenerateDailyBackup_Retention(t *testing.T) {
+	config := DefaultScriptConfig()
+	config.LogDir = "/home/test/infra/logs"
+	config.Retention = RetentionPolicy{KeepDaily: 10, KeepWeekly: 5, KeepMonthly: 12}
+
+	content, err := GenerateDailyBackup(config)
+	if err != nil {
+		t.Fatalf("GenerateDailyBackup() error: %v", err)
+	}
+
+	for _, part := range []string{
+		`SNAPSHOTS="/mnt/backup/snapshots"`,
+		"KEEP_DAILY=10",
+		"KEEP_WEEKLY=5",
+		"KEEP_MONTHLY=12",
+		"--link-dest=$SNAPSHOTS/latest/",
+		`ln -sfn "$STAMP" "$SNAPSHOTS/latest"`,
+	} {
+		if !strings.Contains(content, part) {
+			t.Errorf("Daily backup script missing: %s", part)
+		}
+	}
+}
+
+func TestSaveLoadConfig(t *testing.T) {
+	config := DefaultScriptConfig()
+	config.InfraRoot = t.TempDir()
+	config.Retention = RetentionPolicy{KeepDaily: 3, KeepWeekly: 2, KeepMonthly: 1}
+
+	if err := SaveConfig(config, false); err != nil {
+		t.Fatalf("SaveConfig() error: %v", err)
+	}
+
+	info, err := os.Stat(ConfigPath(config.InfraRoot))
+	if err != nil {
+		t.Fatalf("config not written: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("config mode = %o, want 600", info.Mode().Perm())
+	}
+
+	loaded, err := LoadConfig(config.InfraRoot)
+	if err != nil {
+		t.Fatalf("LoadConfig() error: %v", err)
+	}
+	if loaded.Retention != config.Retention {
+		t.Errorf("Retention = %+v, want %+v", loaded.Retention, config.Retention)
+	}
+
+	if _, err := LoadConfig(t.TempDir()); err == nil {
+		t.Error("LoadConfig() should fail without a saved config")
+	}
+}
+
+func TestGenerateDailyBackup_SpaceCheck(t *testing.T) {
+	config := DefaultScriptConfig()
+	config.LogDir = "/home/test/infra/logs"
+
+	content, err := GenerateDailyBackup(config)
+	if err != nil {
+		t.Fatalf("GenerateDailyBackup() error: %v", err)
+	}
+	for _, part := range []string{"SPACE_MARGIN=10", "AUTO_PRUNE=0", "--dry-run --stats", "EXIT_CODE=28", "Backup disk full"} {
+		if !strings.Contains(content, part) {
+			t.Errorf("Daily backup script missing: %s", part)
+		}
+	}
+
+	config.AutoPruneOnLowSpace = true
+	content, _ = GenerateDailyBackup(config)
+	if !strings.Contains(content, "AUTO_PRUNE=1") {
+		t.Error("AUTO_PRUNE should be 1 when auto-prune is enabled")
+	}
+}
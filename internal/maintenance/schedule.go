@@ -0,0 +1,350 @@
+package maintenance
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NightlyWindowStart is when the first nightly job starts, in minutes after
+// local midnight
+const NightlyWindowStart = 60
+
+// staggerStep rounds start times to five minutes, so the calendar reads well
+const staggerStep = 5
+
+// staggerOrder is the order nightly jobs are laid out in. The data backup
+// goes first, while nothing else reads the disks, preceded only by the
+// quick calendar and contacts export it should include; the vulnerability
+// scan goes before the weekly cleanup, whose report includes it, and the
+// self-check goes last, so it sees the night's results.
+var staggerOrder = []string{
+	"pim_export",
+	"daily_backup",
+	"infra_config_backup",
+	"critical_offsite",
+	"bitrot_scrub",
+	"vuln_scan",
+	"weekly_cleanup",
+	"smart_alert",
+	"restore_drill",
+	"self_check",
+}
+
+// jobDurations are generous estimates of how long each job runs on a
+// typical home server, in minutes. Jobs without one (the quick checks run
+// every few minutes) are not laid out.
+var jobDurations = map[string]int{
+	"pim_export":          5,
+	"daily_backup":        60,
+	"infra_config_backup": 15,
+	"critical_offsite":    20,
+	"bitrot_scrub":        60,
+	"vuln_scan":           30,
+	"weekly_cleanup":      20,
+	"smart_alert":         10,
+	"restore_drill":       30,
+	"self_check":          10,
+	"reboot_window":       15,
+}
+
+// jobLabels name the jobs StaggerJobs moves, for their new descriptions
+var jobLabels = map[string]string{
+	"pim_export":          "Calendar and contacts export",
+	"daily_backup":        "Data backup",
+	"infra_config_backup": "Encrypted ~/infra config backup",
+	"critical_offsite":    "Critical data offsite sync",
+	"bitrot_scrub":        "Bit-rot scrub",
+	"vuln_scan":           "Image vulnerability scan",
+	"weekly_cleanup":      "Weekly cleanup",
+	"smart_alert":         "SMART health check",
+	"restore_drill":       "Restore drill",
+	"self_check":          "Self-check",
+}
+
+// interval is a span of minutes after local midnight
+type interval struct{ start, end int }
+
+func (a interval) overlaps(b interval) bool {
+	return a.start < b.end && b.start < a.end
+}
+
+// slot is where a job runs: its minutes and the weekdays it can run on
+type slot struct {
+	interval
+	days uint8 // Bit d set: can run on cron weekday d (0 = Sunday)
+}
+
+// allDays is every weekday
+const allDays uint8 = 1<<7 - 1
+
+// cronNumber parses a single numeric cron field
+func cronNumber(field string) (int, bool) {
+	n, err := strconv.Atoi(field)
+	return n, err == nil
+}
+
+// cronWeekdays returns the weekdays a schedule can run on. Day-of-month and
+// month limits are ignored: a job that runs on some Sundays can clash with
+// anything that runs on Sundays.
+func cronWeekdays(field string) uint8 {
+	if field == "*" || field == "" {
+		return allDays
+	}
+	var days uint8
+	for _, part := range strings.Split(field, ",") {
+		lo, hi, isRange := strings.Cut(part, "-")
+		from, ok1 := cronNumber(lo)
+		to := from
+		ok2 := true
+		if isRange {
+			to, ok2 = cronNumber(hi)
+		}
+		if !ok1 || !ok2 {
+			return allDays
+		}
+		for d := from; d <= to; d++ {
+			days |= 1 << (d % 7)
+		}
+	}
+	return days
+}
+
+// startMinutes returns the minutes after midnight a schedule starts at,
+// for a fixed minute with a fixed or stepped hour; nil otherwise
+func startMinutes(s CronSchedule) []int {
+	minute, ok := cronNumber(s.Minute)
+	if !ok {
+		return nil
+	}
+	if hour, ok := cronNumber(s.Hour); ok {
+		return []int{hour*60 + minute}
+	}
+	if step, ok := cronNumber(strings.TrimPrefix(s.Hour, "*/")); ok && strings.HasPrefix(s.Hour, "*/") && step > 0 {
+		var starts []int
+		for hour := 0; hour < 24; hour += step {
+			starts = append(starts, hour*60+minute)
+		}
+		return starts
+	}
+	return nil
+}
+
+// jobSlots returns the slots a job occupies
+func jobSlots(job CronJob) []slot {
+	duration := jobDurations[job.Name]
+	if duration == 0 {
+		return nil
+	}
+	days := cronWeekdays(job.Schedule.DayOfWeek)
+	var slots []slot
+	for _, start := range startMinutes(job.Schedule) {
+		slots = append(slots, slot{interval{start, start + duration}, days})
+	}
+	return slots
+}
+
+// DSTGaps returns the local times at which loc's clocks change within a
+// year of from: times in them are skipped in spring or happen twice in
+// autumn, so cron runs a job there late or twice
+func DSTGaps(loc *time.Location, from time.Time) []interval {
+	var gaps []interval
+	seen := make(map[interval]bool)
+	end := from.AddDate(1, 0, 0)
+	t := from
+	_, offset := t.In(loc).Zone()
+	for t.Before(end) {
+		next := t.Add(24 * time.Hour)
+		if _, nextOffset := next.In(loc).Zone(); nextOffset != offset {
+			// Narrow the change down to the second
+			lo, hi := t, next
+			for hi.Sub(lo) > time.Second {
+				mid := lo.Add(hi.Sub(lo) / 2)
+				if _, o := mid.In(loc).Zone(); o == offset {
+					lo = mid
+				} else {
+					hi = mid
+				}
+			}
+			before := hi.In(time.FixedZone("", offset))
+			after := hi.In(loc)
+			a := before.Hour()*60 + before.Minute()
+			b := after.Hour()*60 + after.Minute()
+			gap := interval{min(a, b), max(a, b)}
+			if !seen[gap] {
+				seen[gap] = true
+				gaps = append(gaps, gap)
+			}
+			offset = nextOffset
+		}
+		t = next
+	}
+	sort.Slice(gaps, func(i, j int) bool { return gaps[i].start < gaps[j].start })
+	return gaps
+}
+
+// StaggerJobs lays the nightly jobs out one after another from
+// NightlyWindowStart, so no two that can run on the same day overlap, and
+// none starts while loc's clocks change for daylight saving time. Jobs on
+// a schedule the user chose (the reboot window, backups every few hours)
+// stay where they are and the others are placed around them.
+func StaggerJobs(jobs []CronJob, loc *time.Location) []CronJob {
+	return staggerJobs(jobs, DSTGaps(loc, time.Now()))
+}
+
+func staggerJobs(jobs []CronJob, gaps []interval) []CronJob {
+	order := make(map[string]int, len(staggerOrder))
+	for i, name := range staggerOrder {
+		order[name] = i
+	}
+	movable := func(j CronJob) bool {
+		_, ordered := order[j.Name]
+		_, fixedHour := cronNumber(j.Schedule.Hour)
+		return ordered && fixedHour && j.Schedule.Minute != "" && !strings.HasPrefix(j.Schedule.Minute, "@")
+	}
+
+	var busy []slot
+	var queue []int
+	for i, j := range jobs {
+		if movable(j) {
+			queue = append(queue, i)
+		} else {
+			busy = append(busy, jobSlots(j)...)
+		}
+	}
+	sort.SliceStable(queue, func(a, b int) bool { return order[jobs[queue[a]].Name] < order[jobs[queue[b]].Name] })
+
+	staggered := append([]CronJob(nil), jobs...)
+	for _, i := range queue {
+		job := staggered[i]
+		s := slot{days: cronWeekdays(job.Schedule.DayOfWeek)}
+		s.start = NightlyWindowStart
+		s.end = s.start + jobDurations[job.Name]
+		for moved := true; moved; {
+			moved = false
+			for _, gap := range gaps {
+				if s.start >= gap.start && s.start < gap.end {
+					s.start, moved = gap.end, true
+				}
+			}
+			for _, b := range busy {
+				if b.days&s.days != 0 && b.overlaps(s.interval) {
+					s.start, moved = b.end, true
+				}
+			}
+			if rounded := (s.start + staggerStep - 1) / staggerStep * staggerStep; rounded != s.start {
+				s.start, moved = rounded, true
+			}
+			s.end = s.start + jobDurations[job.Name]
+		}
+		busy = append(busy, s)
+
+		start := s.start % (24 * 60)
+		job.Schedule.Hour = strconv.Itoa(start / 60)
+		job.Schedule.Minute = strconv.Itoa(start % 60)
+		if label, ok := jobLabels[job.Name]; ok {
+			job.Description = label + " (" + job.Schedule.HumanReadable() + ")"
+		}
+		staggered[i] = job
+	}
+	return staggered
+}
+
+// ScheduleScripts sets each script's schedule to the time its job runs
+func ScheduleScripts(scripts []ScriptInfo, jobs []CronJob) {
+	for i := range scripts {
+		for _, job := range jobs {
+			if filepath.Base(job.Command) == scripts[i].Filename {
+				scripts[i].Schedule = job.Schedule.HumanReadable()
+				break
+			}
+		}
+	}
+}
+
+// CalendarEntry is one line of the maintenance calendar
+type CalendarEntry struct {
+	Start, End  string // "01:00"; empty for jobs without a fixed time
+	When        string // Which days, or how often
+	Description string
+}
+
+// clock formats minutes after midnight as HH:MM
+func clock(minutes int) string {
+	minutes %= 24 * 60
+	return fmt.Sprintf("%02d:%02d", minutes/60, minutes%60)
+}
+
+// scheduleDays describes which days a fixed-time schedule runs on
+func scheduleDays(s CronSchedule) string {
+	switch {
+	case s.DayOfMonth != "*" && s.Month != "*":
+		var months []string
+		for _, m := range strings.Split(s.Month, ",") {
+			n, ok := cronNumber(m)
+			if !ok || n < 1 || n > 12 {
+				return "Day " + s.DayOfMonth + " of months " + s.Month
+			}
+			months = append(months, time.Month(n).String()[:3])
+		}
+		return "Day " + s.DayOfMonth + " of " + strings.Join(months, ", ")
+	case s.DayOfMonth != "*":
+		return "Days " + s.DayOfMonth
+	case s.DayOfWeek == "*":
+		return "Daily"
+	}
+	if day, ok := cronNumber(s.DayOfWeek); ok {
+		return time.Weekday(day%7).String() + "s"
+	}
+	return "Weekdays " + s.DayOfWeek
+}
+
+// Calendar lists the scheduled jobs for 'servctl -status': those at a
+// fixed time in the order they run, then the recurring ones
+func Calendar(jobs []CronJob) []CalendarEntry {
+	type timed struct {
+		start int
+		entry CalendarEntry
+	}
+	var fixed []timed
+	var other []CalendarEntry
+	for _, j := range jobs {
+		description := j.Description
+		if label, ok := jobLabels[j.Name]; ok {
+			description = label
+		}
+		starts := startMinutes(j.Schedule)
+		if _, fixedHour := cronNumber(j.Schedule.Hour); !fixedHour || len(starts) != 1 {
+			other = append(other, CalendarEntry{When: j.Schedule.HumanReadable(), Description: description})
+			continue
+		}
+		entry := CalendarEntry{Start: clock(starts[0]), When: scheduleDays(j.Schedule), Description: description}
+		if d := jobDurations[j.Name]; d > 0 {
+			entry.End = clock(starts[0] + d)
+		}
+		fixed = append(fixed, timed{starts[0], entry})
+	}
+	sort.SliceStable(fixed, func(a, b int) bool { return fixed[a].start < fixed[b].start })
+
+	entries := make([]CalendarEntry, 0, len(jobs))
+	for _, f := range fixed {
+		entries = append(entries, f.entry)
+	}
+	return append(entries, other...)
+}
+
+// DSTNote describes the times StaggerJobs keeps free in loc, empty when its
+// clocks never change
+func DSTNote(loc *time.Location) string {
+	var spans []string
+	for _, gap := range DSTGaps(loc, time.Now()) {
+		spans = append(spans, clock(gap.start)+"-"+clock(gap.end))
+	}
+	if len(spans) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("Nothing starts %s (%s daylight saving changes)", strings.Join(spans, ", "), loc)
+}
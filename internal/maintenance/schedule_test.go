@@ -0,0 +1,147 @@
+package maintenance
+
+import (
+	"strings"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+// allJobs selects every scheduled script, with the reboot window at 5 AM
+func allJobs(backupSchedule string) []CronJob {
+	sel := ScriptSelection{DailyBackup: true, DiskAlert: true, SmartAlert: true, DriveTemp: true,
+		WeeklyCleanup: true, InfraConfig: true, BitrotScrub: true, SelfCheck: true, RestoreDrill: true}
+	jobs := CronJobsForSelection(sel, "/home/user/infra/scripts", backupSchedule)
+	return append(jobs, RebootWindowJobs(DefaultScriptConfig(), "/home/user/infra/scripts")...)
+}
+
+// checkNoOverlap fails when two jobs that can run on the same day overlap
+func checkNoOverlap(t *testing.T, jobs []CronJob) {
+	t.Helper()
+	var slots []slot
+	var names []string
+	for _, j := range jobs {
+		for _, s := range jobSlots(j) {
+			for i, other := range slots {
+				if other.days&s.days != 0 && other.overlaps(s.interval) {
+					t.Errorf("%s (%s) overlaps %s", j.Name, j.Schedule, names[i])
+				}
+			}
+			slots = append(slots, s)
+			names = append(names, j.Name)
+		}
+	}
+}
+
+func jobByName(jobs []CronJob, name string) CronJob {
+	for _, j := range jobs {
+		if j.Name == name {
+			return j
+		}
+	}
+	return CronJob{}
+}
+
+func TestStaggerJobs_NoOverlaps(t *testing.T) {
+	jobs := staggerJobs(allJobs("daily"), nil)
+	checkNoOverlap(t, jobs)
+
+	if got := jobByName(jobs, "daily_backup").Schedule; got.Hour != "1" || got.Minute != "0" {
+		t.Errorf("The data backup should open the window at 1:00, got %s", got)
+	}
+	if got := jobByName(jobs, "reboot_window").Schedule.Hour; got != "5" {
+		t.Errorf("The reboot window is the user's choice and must not move, got hour %s", got)
+	}
+	if got := jobByName(jobs, "drive_temp").Schedule; got.Minute != "*/30" {
+		t.Errorf("Frequent checks must not move, got %s", got)
+	}
+	backup := jobByName(jobs, "daily_backup")
+	selfCheck := jobByName(jobs, "self_check")
+	if startMinutes(selfCheck.Schedule)[0] <= startMinutes(backup.Schedule)[0] {
+		t.Errorf("The self-check should run after the backup: %s vs %s", selfCheck.Schedule, backup.Schedule)
+	}
+	if !strings.Contains(selfCheck.Description, selfCheck.Schedule.HumanReadable()) {
+		t.Errorf("Description should carry the new time: %q", selfCheck.Description)
+	}
+}
+
+func TestStaggerJobs_WeeklyJobsShareTime(t *testing.T) {
+	jobs := staggerJobs(allJobs("daily"), nil)
+	scrub := jobByName(jobs, "bitrot_scrub").Schedule
+	cleanup := jobByName(jobs, "weekly_cleanup").Schedule
+	// Saturday and Sunday jobs can never collide, so both go right after
+	// the daily backups
+	if scrub.Hour != cleanup.Hour || scrub.Minute != cleanup.Minute {
+		t.Errorf("Scrub (Sat) and cleanup (Sun) may share a start time: %s vs %s", scrub, cleanup)
+	}
+}
+
+func TestStaggerJobs_AroundFrequentBackup(t *testing.T) {
+	jobs := staggerJobs(allJobs("6h"), nil)
+	checkNoOverlap(t, jobs)
+	if got := jobByName(jobs, "daily_backup").Schedule.Hour; got != "*/6" {
+		t.Errorf("A backup every 6 hours keeps its schedule, got %s", got)
+	}
+}
+
+func TestStaggerJobs_AvoidsDST(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gaps := DSTGaps(berlin, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	if len(gaps) != 1 || gaps[0] != (interval{120, 180}) {
+		t.Fatalf("Berlin's clocks change between 02:00 and 03:00, got %v", gaps)
+	}
+
+	jobs := staggerJobs(allJobs("daily"), gaps)
+	checkNoOverlap(t, jobs)
+	for _, j := range jobs {
+		for _, start := range startMinutes(j.Schedule) {
+			if start >= 120 && start < 180 && j.Name != "daily_backup" {
+				t.Errorf("%s starts at %s, inside the DST change", j.Name, clock(start))
+			}
+		}
+	}
+
+	newYork, _ := time.LoadLocation("America/New_York")
+	gaps = DSTGaps(newYork, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	if len(gaps) != 2 || gaps[0] != (interval{60, 120}) || gaps[1] != (interval{120, 180}) {
+		t.Errorf("New York repeats 01:00-02:00 in autumn and skips 02:00-03:00 in spring, got %v", gaps)
+	}
+
+	kolkata, _ := time.LoadLocation("Asia/Kolkata")
+	if gaps := DSTGaps(kolkata, time.Now()); len(gaps) != 0 {
+		t.Errorf("Kolkata has no DST, got %v", gaps)
+	}
+	if DSTNote(kolkata) != "" {
+		t.Error("No note without DST")
+	}
+}
+
+func TestCalendar(t *testing.T) {
+	entries := Calendar(staggerJobs(allJobs("daily"), nil))
+	if entries[0].Start != "01:00" || entries[0].End != "02:00" || entries[0].When != "Daily" || entries[0].Description != "Data backup" {
+		t.Errorf("First entry should be the backup at 01:00-02:00, got %+v", entries[0])
+	}
+	last := entries[len(entries)-1]
+	if last.Start != "" || last.When == "" {
+		t.Errorf("Recurring jobs come last without a start time, got %+v", last)
+	}
+	for i := 1; i < len(entries) && entries[i].Start != ""; i++ {
+		if entries[i].Start < entries[i-1].Start {
+			t.Errorf("Calendar should be in time order: %s after %s", entries[i].Start, entries[i-1].Start)
+		}
+	}
+}
+
+func TestScheduleScripts(t *testing.T) {
+	scripts := []ScriptInfo{{Filename: "daily-backup.sh", Schedule: "3 AM daily"}, {Filename: "restore-infra-config.sh", Schedule: "Manual"}}
+	ScheduleScripts(scripts, staggerJobs(allJobs("daily"), nil))
+	if scripts[0].Schedule != "Daily at 1:00" {
+		t.Errorf("Backup schedule should follow its job, got %q", scripts[0].Schedule)
+	}
+	if scripts[1].Schedule != "Manual" {
+		t.Errorf("Unscheduled scripts keep their schedule, got %q", scripts[1].Schedule)
+	}
+}
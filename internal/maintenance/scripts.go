@@ -4,25 +4,44 @@ package maintenance
 
 import (
 	"fmt"
-	"os"
 	"path/filepath"
-	"strings"
+	"sort"
 	"text/template"
+
+	"github.com/madhav/servctl/internal/compose"
+	"github.com/madhav/servctl/internal/ops"
+	"github.com/madhav/servctl/internal/paths"
+	"github.com/madhav/servctl/internal/runlock"
+	"github.com/madhav/servctl/internal/storage"
+	"github.com/madhav/servctl/templates"
 )
 
 // ScriptConfig holds configuration for maintenance scripts
 type ScriptConfig struct {
 	// Paths
-	DataRoot   string // /mnt/data
-	BackupDest string // /mnt/backup
-	InfraRoot  string // ~/infra
-	LogDir     string // ~/infra/logs
+	DataRoot    string // /mnt/data
+	FastRoot    string // Hot data symlinked from DataRoot (speed-tiered setups), or empty
+	SnapshotDir string // Btrfs snapshots kept inside DataRoot, never backed up, or empty
+	BackupDest  string // /mnt/backup
+	InfraRoot   string // ~/infra
+	LogDir      string // ~/infra/logs
+
+	// Services kept under a root of their own instead of DataRoot; backups
+	// copy them into each set at their usual place
+	ServiceRoots paths.Roots `json:",omitempty"`
 
 	// Drives to monitor
 	Drives []string // e.g., ["/dev/sda", "/dev/sdb"]
 
 	// Thresholds
 	DiskAlertThreshold int // Percentage (default: 90)
+	DriveTempWarn      int // °C at which a hard drive or SATA SSD is reported warm
+	DriveTempCrit      int // °C at which it is reported hot
+
+	// Monthly reboot window: the first RebootWeekday (0 = Sunday) of the
+	// month at RebootHour, when updates require a reboot
+	RebootWeekday int
+	RebootHour    int
 
 	// Notification
 	WebhookURL       string // Discord webhook URL
@@ -30,7 +49,43 @@ type ScriptConfig struct {
 	TelegramChatID   string
 
 	// Backup settings
-	BackupRetentionDays int // How many days to keep backups
+	BackupRetentionDays int             // How many days to keep backups
+	Retention           RetentionPolicy // Which hardlinked data backup sets to keep
+	BackupManifest      BackupManifest  // Per-service paths skipped or kept by the data backup
+
+	// Space guardrails checked before each data backup
+	BackupSpaceMarginPercent int  // Headroom added to the estimated change size
+	AutoPruneOnLowSpace      bool // Delete oldest sets instead of aborting when space is short
+
+	// Dead-man-switch pings (healthchecks.io or self-hosted equivalent)
+	BackupHeartbeatURL       string // Pinged after each data backup
+	ConfigBackupHeartbeatURL string // Pinged after each ~/infra config backup
+
+	// Bit-rot scrub for filesystems without data checksums (ext4/XFS)
+	ScrubPaths      []string // Directories whose files are checksummed
+	ScrubSampleSize int      // Unchanged files re-verified per run
+
+	// Quarterly restore drill
+	DrillSampleSize int // Files restored from the newest backup set per drill
+
+	// Nightly encrypted copy of the databases and configs to an rclone remote
+	OffsiteRemote        string `json:",omitempty"` // e.g. "b2:bucket/servctl"
+	OffsiteRetentionDays int    `json:",omitempty"` // Days archives stay on the remote
+
+	// Docker daemon socket vuln_scan.sh gives Trivy; rootless installs
+	// have theirs under /run/user
+	DockerSocket string `json:",omitempty"`
+
+	// servctl itself, which disk_alert.sh runs to pause Immich's
+	// background jobs when a disk is nearly full
+	ServctlPath string `json:",omitempty"`
+
+	// Plain-HTTP web interfaces by service, which the self-check makes sure
+	// the router does not forward from the internet
+	WebPorts map[string]int `json:",omitempty"`
+
+	// The jobs as scheduled, after StaggerJobs, for 'servctl -status'
+	Schedule []CronJob `json:",omitempty"`
 }
 
 // DefaultScriptConfig returns sensible defaults
@@ -42,278 +97,88 @@ func DefaultScriptConfig() *ScriptConfig {
 		LogDir:              "",
 		Drives:              []string{"/dev/sda"},
 		DiskAlertThreshold:  90,
+		DriveTempWarn:       storage.HDDTempWarn,
+		DriveTempCrit:       storage.HDDTempCrit,
+		RebootWeekday:       DefaultRebootWeekday,
+		RebootHour:          DefaultRebootHour,
 		BackupRetentionDays: 7,
+		Retention:           DefaultRetentionPolicy(),
+		BackupManifest:      DefaultBackupManifest(),
+		DockerSocket:        compose.DefaultDockerSocket,
+
+		BackupSpaceMarginPercent: 10,
+		ScrubSampleSize:          DefaultScrubSampleSize,
+		DrillSampleSize:          DefaultDrillSampleSize,
 	}
 }
 
-// DailyBackupTemplate is the template for the daily backup script
-const DailyBackupTemplate = `#!/bin/bash
-# Generated by servctl - Daily Backup Script
-# Runs: Daily at configured time
-
-# --- CONFIGURATION ---
-SOURCE="{{ .DataRoot }}/"
-DEST="{{ .BackupDest }}/"
-LOGFILE="{{ .LogDir }}/daily_backup.log"
-WEBHOOK_URL="{{ .WebhookURL }}"
-
-echo "[$(date)] Starting Backup..." >> $LOGFILE
-
-# --- RUN RSYNC ---
-rsync -av --delete $SOURCE $DEST >> $LOGFILE 2>&1
-EXIT_CODE=$?
-
-# --- GET DISK STATS ---
-DATA_USAGE=$(df -h {{ .DataRoot }} | awk 'NR==2 {print $3 "/" $2 " (" $5 ")"}')
-BACKUP_USAGE=$(df -h {{ .BackupDest }} | awk 'NR==2 {print $3 "/" $2 " (" $5 ")"}')
-
-# --- NOTIFICATION LOGIC ---
-if [ $EXIT_CODE -eq 0 ]; then
-    COLOR=3066993  # GREEN
-    TITLE="✅ NAS Backup: Success"
-    DESC="The nightly sync completed successfully."
-else
-    COLOR=15158332 # RED
-    TITLE="🚨 NAS Backup: FAILED"
-    DESC="Check the logs immediately. Exit Code: $EXIT_CODE"
-fi
-
-# --- CONSTRUCT JSON PAYLOAD ---
-generate_post_data() {
-  cat <<EOF
-{
-  "username": "NAS Guardian",
-  "embeds": [{
-    "title": "$TITLE",
-    "description": "$DESC",
-    "color": $COLOR,
-    "fields": [
-      {
-        "name": "📦 Data Pool",
-        "value": "$DATA_USAGE",
-        "inline": true
-      },
-      {
-        "name": "🔒 Backup Pool",
-        "value": "$BACKUP_USAGE",
-        "inline": true
-      }
-    ],
-    "footer": {
-      "text": "Log: $LOGFILE • $(date)"
-    }
-  }]
-}
-EOF
+// MovedDir is a top-level data directory kept under Root instead of DataRoot
+type MovedDir struct {
+	Dir  string // e.g. "cloud"
+	Root string // e.g. "/mnt/ssd"
 }
 
-# --- SEND TO DISCORD ---
-{{- if .WebhookURL }}
-curl -s -H "Content-Type: application/json" \
-     -X POST \
-     -d "$(generate_post_data)" \
-     $WEBHOOK_URL >> $LOGFILE 2>&1
-{{- end }}
-
-echo "[$(date)] Backup Finished (Exit Code: $EXIT_CODE)." >> $LOGFILE
-`
-
-// DiskAlertTemplate is the template for disk usage monitoring
-const DiskAlertTemplate = `#!/bin/bash
-# Generated by servctl - Disk Usage Alert Script
-# Runs: Every 6 hours
-
-# --- CONFIGURATION ---
-THRESHOLD={{ .DiskAlertThreshold }}
-PARTITION="{{ .DataRoot }}"
-WEBHOOK_URL="{{ .WebhookURL }}"
-
-# Get usage percentage (numbers only)
-USAGE=$(df -h "$PARTITION" | awk 'NR==2 {print $5}' | sed 's/%//g')
-
-# --- CHECK LOGIC ---
-if [ "$USAGE" -gt "$THRESHOLD" ]; then
-    
-    # JSON Payload for Discord
-    json_payload=$(cat <<EOF
-{
-  "username": "Server Alerter",
-  "embeds": [{
-    "title": "🚨 CRITICAL: DISK FULL",
-    "description": "Storage is running out! Server functionality may break soon.",
-    "color": 15158332,
-    "fields": [
-      {
-        "name": "Partition",
-        "value": "$PARTITION",
-        "inline": true
-      },
-      {
-        "name": "Current Usage",
-        "value": "${USAGE}%",
-        "inline": true
-      },
-      {
-        "name": "Threshold",
-        "value": "${THRESHOLD}%",
-        "inline": true
-      }
-    ]
-  }]
+// MovedDirs lists the top-level directories ServiceRoots moves, sorted
+func (c *ScriptConfig) MovedDirs() []MovedDir {
+	var moved []MovedDir
+	for dir, root := range c.ServiceRoots.TopDirs() {
+		moved = append(moved, MovedDir{Dir: dir, Root: root})
+	}
+	sort.Slice(moved, func(i, j int) bool { return moved[i].Dir < moved[j].Dir })
+	return moved
 }
-EOF
-)
 
-    # Send Alert
-{{- if .WebhookURL }}
-    curl -s -H "Content-Type: application/json" \
-         -X POST \
-         -d "$json_payload" \
-         $WEBHOOK_URL
-{{- end }}
-fi
-`
-
-// SmartAlertTemplate is the template for SMART health monitoring
-const SmartAlertTemplate = `#!/bin/bash
-# Generated by servctl - SMART Health Alert Script
-# Runs: Daily
-
-# --- CONFIGURATION ---
-DRIVES=({{ range .Drives }}"{{ . }}" {{ end }})
-WEBHOOK_URL="{{ .WebhookURL }}"
-
-# --- LOOP THROUGH DRIVES ---
-for DRIVE in "${DRIVES[@]}"; do
-    
-    # 1. Get Health Status
-    HEALTH=$(sudo smartctl -H $DRIVE | grep "overall-health" | awk -F: '{print $2}' | tr -d ' ')
-
-    # 2. Check for Failure
-    if [ "$HEALTH" != "PASSED" ]; then
-        
-        # PREPARE ALERT
-        TITLE="🚨 DRIVE FAILURE: $DRIVE"
-        DESC="Physical drive $DRIVE is failing S.M.A.R.T. checks. Status: ${HEALTH:-UNKNOWN}"
-        COLOR=15158332 # RED
-        
-        # JSON PAYLOAD
-        json_payload=$(cat <<EOF
-{
-  "username": "Disk Doctor",
-  "embeds": [{
-    "title": "$TITLE",
-    "description": "$DESC",
-    "color": $COLOR,
-    "fields": [
-      { "name": "Drive", "value": "$DRIVE", "inline": true },
-      { "name": "Health Status", "value": "${HEALTH:-CRITICAL}", "inline": true }
-    ]
-  }]
-}
-EOF
-)
-        # SEND TO DISCORD
-{{- if .WebhookURL }}
-        curl -s -H "Content-Type: application/json" -X POST -d "$json_payload" $WEBHOOK_URL
-{{- end }}
-    fi
-done
-`
-
-// WeeklyCleanupTemplate is the template for weekly system cleanup
-const WeeklyCleanupTemplate = `#!/bin/bash
-# Generated by servctl - Weekly Cleanup Script
-# Runs: Weekly (Sunday by default)
-
-# --- CONFIGURATION ---
-LOGFILE="{{ .LogDir }}/weekly_cleanup.log"
-WEBHOOK_URL="{{ .WebhookURL }}"
-
-echo "[$(date)] Starting Weekly Cleanup..." > $LOGFILE
-
-# --- GET BEFORE STATS ---
-BEFORE_USAGE=$(df -h {{ .DataRoot }} | awk 'NR==2 {print $5}')
-
-# 1. CLEAN APT (System Packages)
-sudo apt-get clean >> $LOGFILE 2>&1
-sudo apt-get autoremove -y >> $LOGFILE 2>&1
-
-# 2. CLEAN DOCKER (The Safe Way)
-# Only remove "dangling" images (safe operation)
-docker image prune -f >> $LOGFILE 2>&1
-
-# 3. CLEAN OLD LOGS (prevent huge logs)
-# Truncate logs larger than 50MB
-find /var/log -type f -name "*.log" -size +50M -exec truncate -s 0 {} \; 2>/dev/null
-
-# 4. CLEAN OLD BACKUPS (optional)
-{{- if .BackupDest }}
-find {{ .BackupDest }} -type f -name "*.tar.gz" -mtime +{{ .BackupRetentionDays }} -delete 2>/dev/null
-{{- end }}
-
-# --- GET AFTER STATS ---
-AFTER_USAGE=$(df -h {{ .DataRoot }} | awk 'NR==2 {print $5}')
-DISK_INFO=$(df -h {{ .DataRoot }} | awk 'NR==2 {print $3 "/" $2}')
-
-# --- NOTIFICATION ---
-{{- if .WebhookURL }}
-json_payload=$(cat <<EOF
-{
-  "username": "Janitor",
-  "embeds": [{
-    "title": "🧹 Weekly Cleanup Complete",
-    "description": "System maintenance completed successfully.",
-    "color": 3066993,
-    "fields": [
-      { "name": "Before", "value": "$BEFORE_USAGE", "inline": true },
-      { "name": "After", "value": "$AFTER_USAGE", "inline": true },
-      { "name": "Storage Used", "value": "$DISK_INFO", "inline": true }
-    ]
-  }]
+// scriptLogCap is the size at which a script moves its log aside, for logs
+// that grow faster than the weekly logrotate
+const scriptLogCap = 10 << 20
+
+// scriptFuncs give the script templates the names they share with Go code
+var scriptFuncs = template.FuncMap{
+	"snapshotDir":        func() string { return SnapshotDir },
+	"selfCheckStateFile": func() string { return SelfCheckStateFile },
+	"scrubDBFile":        func() string { return ScrubDBFile },
+	"driveTempStateFile": func() string { return DriveTempStateFile },
+	"backupKeyFile":      func() string { return BackupKeyFile },
+	"rebootMarkerFile":   func() string { return RebootMarkerFile },
+	"drillMaxFileMB":     func() string { return DrillMaxFileMB },
+	"runLockFile":        func() string { return runlock.FileName },
+	"maxLogBytes":        func() int { return scriptLogCap },
+	"historyFile":        func() string { return HistoryFile },
+	"historyLimit":       func() int { return HistoryLimit },
+	"failureStreakAlert": func() int { return FailureStreakAlert },
+	"trivyImage":         func() string { return TrivyImage },
+	"vulnSummaryFile":    func() string { return VulnSummaryFile },
+
+	// disk_alert.sh and the backups it keeps off a nearly full disk
+	"diskEmergencyFile":         func() string { return DiskEmergencyFile },
+	"diskEmergencyPercent":      func() int { return DiskEmergencyPercent },
+	"diskEmergencyClearPercent": func() int { return DiskEmergencyClearPercent },
 }
-EOF
-)
-
-curl -s -H "Content-Type: application/json" -X POST -d "$json_payload" $WEBHOOK_URL >> $LOGFILE 2>&1
-{{- end }}
-
-echo "[$(date)] Cleanup Finished." >> $LOGFILE
-`
-
-// generateScript executes a template and returns the script content
-func generateScript(tmplName, tmplContent string, config *ScriptConfig) (string, error) {
-	tmpl, err := template.New(tmplName).Parse(tmplContent)
-	if err != nil {
-		return "", fmt.Errorf("failed to parse template: %w", err)
-	}
-
-	var buf strings.Builder
-	if err := tmpl.Execute(&buf, config); err != nil {
-		return "", fmt.Errorf("failed to execute template: %w", err)
-	}
 
-	return buf.String(), nil
+// generateScript renders templates/scripts/<name>.sh.tmpl. data is the
+// ScriptConfig, or a struct embedding it for scripts that need more.
+func generateScript(name string, data interface{}) (string, error) {
+	return templates.Render("scripts/"+name+".sh.tmpl", data, scriptFuncs)
 }
 
 // GenerateDailyBackup generates the daily backup script
 func GenerateDailyBackup(config *ScriptConfig) (string, error) {
-	return generateScript("daily_backup", DailyBackupTemplate, config)
+	return generateScript("daily_backup", config)
 }
 
 // GenerateDiskAlert generates the disk alert script
 func GenerateDiskAlert(config *ScriptConfig) (string, error) {
-	return generateScript("disk_alert", DiskAlertTemplate, config)
+	return generateScript("disk_alert", config)
 }
 
 // GenerateSmartAlert generates the SMART alert script
 func GenerateSmartAlert(config *ScriptConfig) (string, error) {
-	return generateScript("smart_alert", SmartAlertTemplate, config)
+	return generateScript("smart_alert", config)
 }
 
 // GenerateWeeklyCleanup generates the weekly cleanup script
 func GenerateWeeklyCleanup(config *ScriptConfig) (string, error) {
-	return generateScript("weekly_cleanup", WeeklyCleanupTemplate, config)
+	return generateScript("weekly_cleanup", config)
 }
 
 // ScriptInfo describes a generated script
@@ -368,6 +233,32 @@ func GenerateAllScripts(config *ScriptConfig) ([]ScriptInfo, error) {
 		Content:     content,
 	})
 
+	// Drive temperature
+	content, err = GenerateDriveTemp(config)
+	if err != nil {
+		return nil, fmt.Errorf("drive_temp: %w", err)
+	}
+	scripts = append(scripts, ScriptInfo{
+		Name:        "Drive Temperature",
+		Filename:    "drive_temp.sh",
+		Description: "Alerts when a drive runs hot",
+		Schedule:    "Every 30 minutes",
+		Content:     content,
+	})
+
+	// Reboot window
+	content, err = GenerateRebootWindow(config)
+	if err != nil {
+		return nil, fmt.Errorf("reboot_window: %w", err)
+	}
+	scripts = append(scripts, ScriptInfo{
+		Name:        "Reboot Window",
+		Filename:    "reboot_window.sh",
+		Description: "Reboots once a month when updates require it",
+		Schedule:    "First " + WeekdayName(config.RebootWeekday) + " of the month",
+		Content:     content,
+	})
+
 	// Weekly cleanup
 	content, err = GenerateWeeklyCleanup(config)
 	if err != nil {
@@ -381,29 +272,122 @@ func GenerateAllScripts(config *ScriptConfig) ([]ScriptInfo, error) {
 		Content:     content,
 	})
 
-	return scripts, nil
-}
+	// Bit-rot scrub
+	content, err = GenerateBitrotScrub(config)
+	if err != nil {
+		return nil, fmt.Errorf("bitrot_scrub: %w", err)
+	}
+	scripts = append(scripts, ScriptInfo{
+		Name:        "Bit-Rot Scrub",
+		Filename:    "bitrot_scrub.sh",
+		Description: "Checksums new files and re-verifies a random sample",
+		Schedule:    "Saturday at 2:00 AM",
+		Content:     content,
+	})
 
-// WriteScript writes a script to disk with executable permissions
-func WriteScript(script ScriptInfo, outputDir string, dryRun bool) error {
-	outputPath := filepath.Join(outputDir, script.Filename)
+	// Restore drill
+	content, err = GenerateRestoreDrill(config)
+	if err != nil {
+		return nil, fmt.Errorf("restore_drill: %w", err)
+	}
+	scripts = append(scripts, ScriptInfo{
+		Name:        "Restore Drill",
+		Filename:    "restore_drill.sh",
+		Description: "Restores a random sample of the backup and verifies it",
+		Schedule:    "Quarterly on the 15th at 6:00 AM",
+		Content:     content,
+	})
+
+	// Self-check
+	content, err = GenerateSelfCheck(config)
+	if err != nil {
+		return nil, fmt.Errorf("self_check: %w", err)
+	}
+	scripts = append(scripts, ScriptInfo{
+		Name:        "Self-Check",
+		Filename:    "self_check.sh",
+		Description: "Re-checks mounts, Docker, disk health and backup age",
+		Schedule:    "Daily at 7:00 AM",
+		Content:     content,
+	})
+
+	// Infra config backup + restore
+	content, err = GenerateInfraConfigBackup(config)
+	if err != nil {
+		return nil, fmt.Errorf("infra_config_backup: %w", err)
+	}
+	scripts = append(scripts, ScriptInfo{
+		Name:        "Infra Config Backup",
+		Filename:    "infra_config_backup.sh",
+		Description: "Encrypted archive of compose files, .env, scripts and state",
+		Schedule:    "Daily at 4:30 AM",
+		Content:     content,
+	})
+
+	content, err = GenerateInfraConfigRestore(config)
+	if err != nil {
+		return nil, fmt.Errorf("infra_config_restore: %w", err)
+	}
+	scripts = append(scripts, ScriptInfo{
+		Name:        "Infra Config Restore",
+		Filename:    "restore_infra_config.sh",
+		Description: "Decrypts and unpacks a config backup",
+		Schedule:    "Manual",
+		Content:     content,
+	})
 
-	if dryRun {
-		fmt.Printf("[DRY RUN] Would write %s to %s\n", script.Name, outputPath)
-		return nil
+	// Critical data offsite
+	content, err = GenerateCriticalOffsite(config)
+	if err != nil {
+		return nil, fmt.Errorf("critical_offsite: %w", err)
 	}
+	scripts = append(scripts, ScriptInfo{
+		Name:        "Critical Data Offsite",
+		Filename:    "critical_offsite.sh",
+		Description: "Encrypted database dumps and configs copied offsite with rclone",
+		Schedule:    "Daily at 5:30 AM",
+		Content:     content,
+	})
 
-	// Ensure directory exists
-	if err := os.MkdirAll(outputDir, 0755); err != nil {
-		return fmt.Errorf("failed to create directory: %w", err)
+	// Calendar and contacts export
+	content, err = GeneratePIMExport(config)
+	if err != nil {
+		return nil, fmt.Errorf("pim_export: %w", err)
 	}
+	scripts = append(scripts, ScriptInfo{
+		Name:        "Calendar & Contacts Export",
+		Filename:    "pim_export.sh",
+		Description: "Nextcloud calendars and contacts as .ics/.vcf files in the backup",
+		Schedule:    "Daily at 2:30 AM",
+		Content:     content,
+	})
 
-	// Write script
-	if err := os.WriteFile(outputPath, []byte(script.Content), 0755); err != nil {
+	// Image vulnerability scan
+	content, err = GenerateVulnScan(config)
+	if err != nil {
+		return nil, fmt.Errorf("vuln_scan: %w", err)
+	}
+	scripts = append(scripts, ScriptInfo{
+		Name:        "Image Vulnerability Scan",
+		Filename:    "vuln_scan.sh",
+		Description: "Critical CVEs in the running images, and whether updates fix them",
+		Schedule:    "Sunday at 2:00 AM",
+		Content:     content,
+	})
+
+	return scripts, nil
+}
+
+// WriteScript writes a script to disk with executable permissions
+func WriteScript(script ScriptInfo, outputDir string, dryRun bool) error {
+	outputPath := filepath.Join(outputDir, script.Filename)
+	if err := ops.Execute(dryRun, ops.WriteFile{Path: outputPath, Content: []byte(script.Content), Mode: 0755}); err != nil {
 		return fmt.Errorf("failed to write script: %w", err)
 	}
 
-	fmt.Printf("Generated: %s (mode 0755)\n", outputPath)
+	if !dryRun {
+		fmt.Printf("Generated: %s (mode 0755)\n", outputPath)
+	}
 	return nil
 }
 
@@ -0,0 +1,40 @@
+package maintenance
+
+import (
+	"path/filepath"
+
+	"github.com/madhav/servctl/internal/paths"
+)
+
+// ScrubDBFile is the checksum database kept by the scrub job, relative to
+// InfraRoot so it lives off the disk it is guarding
+const ScrubDBFile = "scrub/checksums.tsv"
+
+// DefaultScrubSampleSize is how many unchanged files each run re-verifies
+const DefaultScrubSampleSize = 1000
+
+// ScrubRecommended reports whether a filesystem lacks data checksums of its
+// own. Btrfs and ZFS detect bit rot themselves; ext4 and XFS do not.
+func ScrubRecommended(fsType string) bool {
+	switch fsType {
+	case "ext2", "ext3", "ext4", "xfs":
+		return true
+	}
+	return false
+}
+
+// DefaultScrubPaths are the irreplaceable directories worth checksumming:
+// the photo gallery and Nextcloud files
+func DefaultScrubPaths(dataRoot string, roots paths.Roots) []string {
+	return []string{roots.Join(dataRoot, paths.Gallery), roots.Join(dataRoot, paths.CloudData)}
+}
+
+// ScrubDBPath returns the checksum database location under infraRoot
+func ScrubDBPath(infraRoot string) string {
+	return filepath.Join(infraRoot, filepath.FromSlash(ScrubDBFile))
+}
+
+// GenerateBitrotScrub generates the bit-rot scrub script
+func GenerateBitrotScrub(config *ScriptConfig) (string, error) {
+	return generateScript("bitrot_scrub", config)
+}
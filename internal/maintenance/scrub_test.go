@@ -0,0 +1,57 @@
+package maintenance
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestScrubRecommended(t *testing.T) {
+	for fs, want := range map[string]bool{"ext4": true, "xfs": true, "btrfs": false, "zfs": false, "": false} {
+		if got := ScrubRecommended(fs); got != want {
+			t.Errorf("ScrubRecommended(%q) = %v, want %v", fs, got, want)
+		}
+	}
+}
+
+func TestGenerateBitrotScrub(t *testing.T) {
+	config := DefaultScriptConfig()
+	config.InfraRoot = "/home/user/infra"
+	config.LogDir = "/home/user/infra/logs"
+	config.ScrubPaths = DefaultScrubPaths("/mnt/data", nil)
+
+	content, err := GenerateBitrotScrub(config)
+	if err != nil {
+		t.Fatalf("GenerateBitrotScrub() error: %v", err)
+	}
+	for _, check := range []string{
+		`SCRUB_PATHS=("/mnt/data/gallery" "/mnt/data/cloud/data" )`,
+		`DB="/home/user/infra/scrub/checksums.tsv"`,
+		"SAMPLE=1000",
+		`shuf -n "$SAMPLE" "$WORK/kept"`,
+	} {
+		if !strings.Contains(content, check) {
+			t.Errorf("Scrub script missing %q", check)
+		}
+	}
+	if strings.Contains(content, "curl") {
+		t.Error("Scrub script should not alert without a webhook")
+	}
+
+	// Without explicit paths the whole data root is covered
+	config.ScrubPaths = nil
+	config.WebhookURL = "https://discord.com/api/webhooks/1/x"
+	content, _ = GenerateBitrotScrub(config)
+	if !strings.Contains(content, `SCRUB_PATHS=("/mnt/data")`) || !strings.Contains(content, "curl -s") {
+		t.Error("Scrub script should default to DataRoot and alert via the webhook")
+	}
+}
+
+func TestCronJobsForSelection_Scrub(t *testing.T) {
+	jobs := CronJobsForSelection(ScriptSelection{BitrotScrub: true}, "/home/user/infra/scripts", "daily")
+	if len(jobs) != 1 || jobs[0].Command != "/home/user/infra/scripts/bitrot-scrub.sh" {
+		t.Fatalf("jobs = %+v, want the scrub job only", jobs)
+	}
+	if jobs[0].Schedule.String() != "0 2 * * 6" {
+		t.Errorf("Scrub schedule = %q, want Saturday 2 AM", jobs[0].Schedule.String())
+	}
+}
@@ -5,6 +5,8 @@ package maintenance
 import (
 	"bufio"
 	"fmt"
+	"path/filepath"
+	"strconv"
 	"strings"
 )
 
@@ -14,6 +16,18 @@ type ScriptSelection struct {
 	DiskAlert     bool
 	SmartAlert    bool
 	WeeklyCleanup bool
+	InfraConfig   bool // Encrypted backup of ~/infra (compose, .env, scripts, state)
+	BitrotScrub   bool // Checksum manifest for ext4/XFS data disks
+	SelfCheck     bool // Daily re-check of mounts, Docker, disks and backups
+	DriveTemp     bool // Drive temperature alerts every 30 minutes
+	RebootWindow  bool // Monthly reboot when updates require one
+	RestoreDrill  bool // Quarterly test restore of a sample of the data backup
+	PIMExport     bool // Nightly .ics/.vcf export of Nextcloud calendars and contacts
+	VulnScan      bool // Weekly Trivy scan of the running images for critical CVEs
+
+	// Nightly encrypted database dumps and configs to an rclone remote;
+	// off by default, it needs a remote set up with 'rclone config'
+	CriticalOffsite bool
 }
 
 // DefaultScriptSelection returns all scripts enabled
@@ -22,14 +36,25 @@ func DefaultScriptSelection() ScriptSelection {
 		DailyBackup:   true,
 		DiskAlert:     true,
 		SmartAlert:    false, // Requires smartctl
+		DriveTemp:     false, // Requires smartctl
+		RebootWindow:  false, // Reboots unattended
 		WeeklyCleanup: true,
+		InfraConfig:   true,
+		SelfCheck:     true,
+		RestoreDrill:  true,
+		PIMExport:     true,
+		VulnScan:      false, // Pulls Trivy and a 1 GB database
 	}
 }
 
 // PromptScriptSelection prompts user to select which scripts to generate
 func PromptScriptSelection(reader *bufio.Reader) ScriptSelection {
-	selection := DefaultScriptSelection()
+	return PromptScriptSelectionFrom(reader, DefaultScriptSelection())
+}
 
+// PromptScriptSelectionFrom prompts for toggles starting from selection,
+// so callers can pre-select scripts suited to the machine
+func PromptScriptSelectionFrom(reader *bufio.Reader, selection ScriptSelection) ScriptSelection {
 	fmt.Println("Select maintenance scripts to generate:")
 	fmt.Println()
 
@@ -41,9 +66,18 @@ func PromptScriptSelection(reader *bufio.Reader) ScriptSelection {
 			return "[ ]"
 		}
 		fmt.Printf("  1. %s Daily Backup    - rsync data to backup drive\n", checkbox(selection.DailyBackup))
-		fmt.Printf("  2. %s Disk Alert      - Alert when disk >90%% full\n", checkbox(selection.DiskAlert))
+		fmt.Printf("  2. %s Disk Alert      - Alert when disk >90%% full, act at 95%%\n", checkbox(selection.DiskAlert))
 		fmt.Printf("  3. %s SMART Monitor   - Drive health monitoring\n", checkbox(selection.SmartAlert))
 		fmt.Printf("  4. %s Weekly Cleanup  - Docker/apt/log cleanup\n", checkbox(selection.WeeklyCleanup))
+		fmt.Printf("  5. %s Config Backup   - Encrypted copy of ~/infra\n", checkbox(selection.InfraConfig))
+		fmt.Printf("  6. %s Bit-Rot Scrub   - Checksum photos, re-verify a sample weekly\n", checkbox(selection.BitrotScrub))
+		fmt.Printf("  7. %s Self-Check      - Daily health check, alerts only on regressions\n", checkbox(selection.SelfCheck))
+		fmt.Printf("  8. %s Drive Temp      - Alert when drives run hot (closed cabinets, dead fans)\n", checkbox(selection.DriveTemp))
+		fmt.Printf("  9. %s Reboot Window   - Monthly reboot when updates need one, verified after boot\n", checkbox(selection.RebootWindow))
+		fmt.Printf(" 10. %s Restore Drill   - Quarterly test restore of a sample of the backup\n", checkbox(selection.RestoreDrill))
+		fmt.Printf(" 11. %s Critical Offsite - Encrypted database dumps & configs to the cloud (rclone)\n", checkbox(selection.CriticalOffsite))
+		fmt.Printf(" 12. %s Contacts Export - Calendars & contacts as .ics/.vcf files in every backup\n", checkbox(selection.PIMExport))
+		fmt.Printf(" 13. %s Vuln Scan       - Weekly scan of the images for critical CVEs (Trivy)\n", checkbox(selection.VulnScan))
 		fmt.Println()
 	}
 
@@ -71,6 +105,24 @@ func PromptScriptSelection(reader *bufio.Reader) ScriptSelection {
 			selection.SmartAlert = !selection.SmartAlert
 		case "4":
 			selection.WeeklyCleanup = !selection.WeeklyCleanup
+		case "5":
+			selection.InfraConfig = !selection.InfraConfig
+		case "6":
+			selection.BitrotScrub = !selection.BitrotScrub
+		case "7":
+			selection.SelfCheck = !selection.SelfCheck
+		case "8":
+			selection.DriveTemp = !selection.DriveTemp
+		case "9":
+			selection.RebootWindow = !selection.RebootWindow
+		case "10":
+			selection.RestoreDrill = !selection.RestoreDrill
+		case "11":
+			selection.CriticalOffsite = !selection.CriticalOffsite
+		case "12":
+			selection.PIMExport = !selection.PIMExport
+		case "13":
+			selection.VulnScan = !selection.VulnScan
 		}
 	}
 
@@ -104,6 +156,58 @@ func PromptBackupSchedule(reader *bufio.Reader) string {
 	}
 }
 
+// ParseRetentionPolicy parses "daily/weekly/monthly" counts such as "7/4/6"
+func ParseRetentionPolicy(s string) (RetentionPolicy, error) {
+	parts := strings.Split(s, "/")
+	if len(parts) != 3 {
+		return RetentionPolicy{}, fmt.Errorf("expected daily/weekly/monthly counts, e.g. 7/4/6")
+	}
+
+	var counts [3]int
+	for i, part := range parts {
+		n, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || n < 0 {
+			return RetentionPolicy{}, fmt.Errorf("invalid count %q", part)
+		}
+		counts[i] = n
+	}
+	if counts[0]+counts[1]+counts[2] == 0 {
+		return RetentionPolicy{}, fmt.Errorf("at least one backup set must be kept")
+	}
+
+	return RetentionPolicy{KeepDaily: counts[0], KeepWeekly: counts[1], KeepMonthly: counts[2]}, nil
+}
+
+// PromptRetentionPolicy asks how many daily, weekly and monthly backup sets to keep
+func PromptRetentionPolicy(reader *bufio.Reader) RetentionPolicy {
+	def := DefaultRetentionPolicy()
+	for {
+		fmt.Printf("Keep daily/weekly/monthly backup sets [%d/%d/%d]: ", def.KeepDaily, def.KeepWeekly, def.KeepMonthly)
+		response, _ := reader.ReadString('\n')
+		response = strings.TrimSpace(response)
+		if response == "" {
+			return def
+		}
+		policy, err := ParseRetentionPolicy(response)
+		if err != nil {
+			fmt.Printf("  ✗ %v\n", err)
+			continue
+		}
+		return policy
+	}
+}
+
+// PromptAutoPrune asks what the backup should do when the destination is short on space
+func PromptAutoPrune(reader *bufio.Reader) bool {
+	fmt.Println("When the backup disk is too full for the next run:")
+	fmt.Println("  1. Skip the backup and alert")
+	fmt.Println("  2. Delete the oldest backup sets until it fits")
+	fmt.Print("Select [1-2, default: 1]: ")
+
+	response, _ := reader.ReadString('\n')
+	return strings.TrimSpace(response) == "2"
+}
+
 // PromptWebhookURL prompts for optional Discord/Telegram webhook
 func PromptWebhookURL(reader *bufio.Reader) string {
 	fmt.Print("Discord/Telegram webhook URL (Enter to skip): ")
@@ -174,6 +278,144 @@ func GetScriptsForSelection(sel ScriptSelection, config *ScriptConfig) ([]Script
 		})
 	}
 
+	if sel.BitrotScrub {
+		script, err := GenerateBitrotScrub(config)
+		if err != nil {
+			return nil, err
+		}
+		scripts = append(scripts, ScriptInfo{
+			Name:        "Bit-Rot Scrub",
+			Filename:    "bitrot-scrub.sh",
+			Description: "Checksums new files and re-verifies a random sample",
+			Schedule:    "Saturday 2 AM",
+			Content:     script,
+		})
+	}
+
+	if sel.SelfCheck {
+		script, err := GenerateSelfCheck(config)
+		if err != nil {
+			return nil, err
+		}
+		scripts = append(scripts, ScriptInfo{
+			Name:        "Self-Check",
+			Filename:    "self-check.sh",
+			Description: "Re-checks mounts, Docker, disk health and backup age",
+			Schedule:    "7 AM daily",
+			Content:     script,
+		})
+	}
+
+	if sel.DriveTemp {
+		script, err := GenerateDriveTemp(config)
+		if err != nil {
+			return nil, err
+		}
+		scripts = append(scripts, ScriptInfo{
+			Name:        "Drive Temperature",
+			Filename:    "drive-temp.sh",
+			Description: "Alerts when a drive crosses its temperature limit",
+			Schedule:    "Every 30 minutes",
+			Content:     script,
+		})
+	}
+
+	if sel.RebootWindow {
+		script, err := GenerateRebootWindow(config)
+		if err != nil {
+			return nil, err
+		}
+		scripts = append(scripts, ScriptInfo{
+			Name:        "Reboot Window",
+			Filename:    RebootWindowScript,
+			Description: "Reboots when updates require it, then verifies the stack",
+			Schedule:    fmt.Sprintf("First %s of the month, %d:00", WeekdayName(config.RebootWeekday), config.RebootHour),
+			Content:     script,
+		})
+	}
+
+	if sel.RestoreDrill {
+		script, err := GenerateRestoreDrill(config)
+		if err != nil {
+			return nil, err
+		}
+		scripts = append(scripts, ScriptInfo{
+			Name:        "Restore Drill",
+			Filename:    "restore-drill.sh",
+			Description: "Restores a random sample of the backup and verifies it",
+			Schedule:    "Quarterly, 15th at 6 AM",
+			Content:     script,
+		})
+	}
+
+	if sel.InfraConfig {
+		script, err := GenerateInfraConfigBackup(config)
+		if err != nil {
+			return nil, err
+		}
+		scripts = append(scripts, ScriptInfo{
+			Name:        "Config Backup",
+			Filename:    "infra-config-backup.sh",
+			Description: "Encrypted backup of compose files, .env, scripts and state",
+			Schedule:    "4:30 AM daily",
+			Content:     script,
+		})
+
+		script, err = GenerateInfraConfigRestore(config)
+		if err != nil {
+			return nil, err
+		}
+		scripts = append(scripts, ScriptInfo{
+			Name:        "Config Restore",
+			Filename:    "restore-infra-config.sh",
+			Description: "Decrypts and unpacks a config backup",
+			Schedule:    "Manual",
+			Content:     script,
+		})
+	}
+
+	if sel.CriticalOffsite {
+		script, err := GenerateCriticalOffsite(config)
+		if err != nil {
+			return nil, err
+		}
+		scripts = append(scripts, ScriptInfo{
+			Name:        "Critical Offsite",
+			Filename:    "critical-offsite.sh",
+			Description: "Encrypted database dumps, configs and sidecars to " + config.OffsiteRemote,
+			Schedule:    "5:30 AM daily",
+			Content:     script,
+		})
+	}
+
+	if sel.PIMExport {
+		script, err := GeneratePIMExport(config)
+		if err != nil {
+			return nil, err
+		}
+		scripts = append(scripts, ScriptInfo{
+			Name:        "Contacts Export",
+			Filename:    "pim-export.sh",
+			Description: "Nextcloud calendars and contacts as .ics/.vcf files in the backup",
+			Schedule:    "Daily, before the backup",
+			Content:     script,
+		})
+	}
+
+	if sel.VulnScan {
+		script, err := GenerateVulnScan(config)
+		if err != nil {
+			return nil, err
+		}
+		scripts = append(scripts, ScriptInfo{
+			Name:        "Vuln Scan",
+			Filename:    "vuln-scan.sh",
+			Description: "Critical CVEs in the running images, for the weekly report",
+			Schedule:    "Sunday, before the weekly cleanup",
+			Content:     script,
+		})
+	}
+
 	return scripts, nil
 }
 
@@ -192,5 +434,207 @@ func (s ScriptSelection) SelectedNames() []string {
 	if s.WeeklyCleanup {
 		names = append(names, "Weekly Cleanup")
 	}
+	if s.InfraConfig {
+		names = append(names, "Config Backup")
+	}
+	if s.BitrotScrub {
+		names = append(names, "Bit-Rot Scrub")
+	}
+	if s.SelfCheck {
+		names = append(names, "Self-Check")
+	}
+	if s.DriveTemp {
+		names = append(names, "Drive Temp")
+	}
+	if s.RebootWindow {
+		names = append(names, "Reboot Window")
+	}
+	if s.RestoreDrill {
+		names = append(names, "Restore Drill")
+	}
+	if s.CriticalOffsite {
+		names = append(names, "Critical Offsite")
+	}
+	if s.PIMExport {
+		names = append(names, "Contacts Export")
+	}
+	if s.VulnScan {
+		names = append(names, "Vuln Scan")
+	}
 	return names
 }
+
+// BackupCronSchedule converts a PromptBackupSchedule choice into a cron schedule
+func BackupCronSchedule(choice string) CronSchedule {
+	switch choice {
+	case "6h":
+		return CronSchedule{Minute: "0", Hour: "*/6", DayOfMonth: "*", Month: "*", DayOfWeek: "*"}
+	case "12h":
+		return CronSchedule{Minute: "0", Hour: "*/12", DayOfMonth: "*", Month: "*", DayOfWeek: "*"}
+	case "weekly":
+		return CronSchedule{Minute: "0", Hour: "3", DayOfMonth: "*", Month: "*", DayOfWeek: "0"}
+	default:
+		return CronSchedule{Minute: "0", Hour: "3", DayOfMonth: "*", Month: "*", DayOfWeek: "*"}
+	}
+}
+
+// CronJobsForSelection returns cron jobs for the scripts written by
+// GetScriptsForSelection. Manual-only scripts (restore) are not scheduled.
+func CronJobsForSelection(sel ScriptSelection, scriptsDir, backupSchedule string) []CronJob {
+	var jobs []CronJob
+
+	if sel.DailyBackup {
+		schedule := BackupCronSchedule(backupSchedule)
+		jobs = append(jobs, CronJob{
+			Name:        "daily_backup",
+			Schedule:    schedule,
+			Command:     filepath.Join(scriptsDir, "daily-backup.sh"),
+			Description: "Data backup (" + schedule.HumanReadable() + ")",
+			User:        "root",
+		})
+	}
+	if sel.DiskAlert {
+		jobs = append(jobs, CronJob{
+			Name:        "disk_alert",
+			Schedule:    CronSchedule{Minute: "0", Hour: "*", DayOfMonth: "*", Month: "*", DayOfWeek: "*"},
+			Command:     filepath.Join(scriptsDir, "disk-alert.sh"),
+			Description: "Hourly disk usage check",
+			User:        "root",
+		})
+	}
+	if sel.SmartAlert {
+		jobs = append(jobs, CronJob{
+			Name:        "smart_alert",
+			Schedule:    CronSchedule{Minute: "0", Hour: "5", DayOfMonth: "*", Month: "*", DayOfWeek: "*"},
+			Command:     filepath.Join(scriptsDir, "smart-monitor.sh"),
+			Description: "SMART health check at 5:00 AM",
+			User:        "root",
+		})
+	}
+	if sel.WeeklyCleanup {
+		jobs = append(jobs, CronJob{
+			Name:        "weekly_cleanup",
+			Schedule:    CronSchedule{Minute: "0", Hour: "3", DayOfMonth: "*", Month: "*", DayOfWeek: "0"},
+			Command:     filepath.Join(scriptsDir, "weekly-cleanup.sh"),
+			Description: "Weekly cleanup on Sunday at 3:00 AM",
+			User:        "root",
+		})
+	}
+	if sel.InfraConfig {
+		jobs = append(jobs, CronJob{
+			Name:        "infra_config_backup",
+			Schedule:    CronSchedule{Minute: "30", Hour: "4", DayOfMonth: "*", Month: "*", DayOfWeek: "*"},
+			Command:     filepath.Join(scriptsDir, "infra-config-backup.sh"),
+			Description: "Encrypted ~/infra config backup at 4:30 AM",
+			User:        "root",
+		})
+	}
+	if sel.BitrotScrub {
+		jobs = append(jobs, CronJob{
+			Name:        "bitrot_scrub",
+			Schedule:    CronSchedule{Minute: "0", Hour: "2", DayOfMonth: "*", Month: "*", DayOfWeek: "6"},
+			Command:     filepath.Join(scriptsDir, "bitrot-scrub.sh"),
+			Description: "Bit-rot scrub on Saturday at 2:00 AM",
+			User:        "root",
+		})
+	}
+	if sel.SelfCheck {
+		jobs = append(jobs, CronJob{
+			Name:        "self_check",
+			Schedule:    CronSchedule{Minute: "0", Hour: "7", DayOfMonth: "*", Month: "*", DayOfWeek: "*"},
+			Command:     filepath.Join(scriptsDir, "self-check.sh"),
+			Description: "Self-check at 7:00 AM",
+			User:        "root",
+		})
+	}
+	if sel.DriveTemp {
+		jobs = append(jobs, CronJob{
+			Name:        "drive_temp",
+			Schedule:    CronSchedule{Minute: "*/30", Hour: "*", DayOfMonth: "*", Month: "*", DayOfWeek: "*"},
+			Command:     filepath.Join(scriptsDir, "drive-temp.sh"),
+			Description: "Drive temperature check every 30 minutes",
+			User:        "root",
+		})
+	}
+	if sel.RestoreDrill {
+		jobs = append(jobs, CronJob{
+			Name:        "restore_drill",
+			Schedule:    RestoreDrillSchedule,
+			Command:     filepath.Join(scriptsDir, "restore-drill.sh"),
+			Description: "Restore drill on the 15th of Jan, Apr, Jul and Oct at 6:00 AM",
+			User:        "root",
+		})
+	}
+	if sel.CriticalOffsite {
+		jobs = append(jobs, CronJob{
+			Name:        "critical_offsite",
+			Schedule:    CronSchedule{Minute: "30", Hour: "5", DayOfMonth: "*", Month: "*", DayOfWeek: "*"},
+			Command:     filepath.Join(scriptsDir, "critical-offsite.sh"),
+			Description: "Critical data offsite sync at 5:30 AM",
+			User:        "root",
+		})
+	}
+	if sel.PIMExport {
+		jobs = append(jobs, CronJob{
+			Name:        "pim_export",
+			Schedule:    CronSchedule{Minute: "30", Hour: "2", DayOfMonth: "*", Month: "*", DayOfWeek: "*"},
+			Command:     filepath.Join(scriptsDir, "pim-export.sh"),
+			Description: "Calendar and contacts export at 2:30 AM",
+			User:        "root",
+		})
+	}
+	if sel.VulnScan {
+		jobs = append(jobs, CronJob{
+			Name:        "vuln_scan",
+			Schedule:    CronSchedule{Minute: "0", Hour: "2", DayOfMonth: "*", Month: "*", DayOfWeek: "0"},
+			Command:     filepath.Join(scriptsDir, "vuln-scan.sh"),
+			Description: "Image vulnerability scan on Sunday at 2:00 AM",
+			User:        "root",
+		})
+	}
+
+	return jobs
+}
+
+// ValidateHeartbeatURL checks a dead-man-switch ping URL. Plain HTTP is
+// allowed because self-hosted instances often live on the LAN.
+func ValidateHeartbeatURL(url string) error {
+	if url == "" {
+		return nil
+	}
+	if !strings.HasPrefix(url, "https://") && !strings.HasPrefix(url, "http://") {
+		return fmt.Errorf("heartbeat URL must start with http:// or https://")
+	}
+	return nil
+}
+
+// promptHeartbeatURL asks for one ping URL, re-asking until it is valid or empty
+func promptHeartbeatURL(reader *bufio.Reader, label string) string {
+	for {
+		fmt.Printf("  %s ping URL (Enter to skip): ", label)
+		response, _ := reader.ReadString('\n')
+		url := strings.TrimRight(strings.TrimSpace(response), "/")
+		if err := ValidateHeartbeatURL(url); err != nil {
+			fmt.Printf("  ✗ %v\n", err)
+			continue
+		}
+		return url
+	}
+}
+
+// PromptHeartbeatURLs asks for healthchecks.io-style URLs that the backup
+// jobs ping on success. If pings stop, the service alerts externally.
+func PromptHeartbeatURLs(reader *bufio.Reader, sel ScriptSelection, config *ScriptConfig) {
+	if !sel.DailyBackup && !sel.InfraConfig {
+		return
+	}
+
+	fmt.Println("Backup heartbeat (healthchecks.io or self-hosted):")
+	fmt.Println("  Alerts you when backups silently stop running.")
+	if sel.DailyBackup {
+		config.BackupHeartbeatURL = promptHeartbeatURL(reader, "Data backup")
+	}
+	if sel.InfraConfig {
+		config.ConfigBackupHeartbeatURL = promptHeartbeatURL(reader, "Config backup")
+	}
+}
@@ -1,6 +1,7 @@
 package maintenance
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -39,7 +40,7 @@ func TestScriptSelection_SelectedNames(t *testing.T) {
 		{
 			name:     "default selection",
 			sel:      DefaultScriptSelection(),
-			expected: []string{"Daily Backup", "Disk Alert", "Weekly Cleanup"},
+			expected: []string{"Daily Backup", "Disk Alert", "Weekly Cleanup", "Config Backup", "Self-Check", "Restore Drill", "Contacts Export"},
 		},
 		{
 			name:     "backup only",
@@ -119,9 +120,9 @@ func TestGetScriptsForSelection_Default(t *testing.T) {
 	if err != nil {
 		t.Errorf("Unexpected error: %v", err)
 	}
-	// Default has DailyBackup, DiskAlert, WeeklyCleanup enabled
-	if len(scripts) != 3 {
-		t.Errorf("Expected 3 scripts for default selection, got %d", len(scripts))
+	// Default has DailyBackup, DiskAlert, WeeklyCleanup, SelfCheck, RestoreDrill, PIMExport and config backup + restore
+	if len(scripts) != 8 {
+		t.Errorf("Expected 8 scripts for default selection, got %d", len(scripts))
 	}
 
 	// Check that SmartAlert is NOT included
@@ -306,3 +307,36 @@ func containsStr(s, substr string) bool {
 	}
 	return false
 }
+
+func TestCronJobsForSelection(t *testing.T) {
+	jobs := CronJobsForSelection(DefaultScriptSelection(), "/home/user/infra/scripts", "6h")
+
+	if len(jobs) != 7 {
+		t.Fatalf("Expected 7 cron jobs for default selection, got %d", len(jobs))
+	}
+	if jobs[0].Schedule.String() != "0 */6 * * *" {
+		t.Errorf("Backup schedule = %q, want every 6 hours", jobs[0].Schedule.String())
+	}
+
+	backup := jobs[3]
+	if backup.Name != "infra_config_backup" || backup.Command != "/home/user/infra/scripts/infra-config-backup.sh" {
+		t.Errorf("Config backup job = %+v", backup)
+	}
+	for _, job := range jobs {
+		if strings.Contains(job.Command, "restore-infra-config") {
+			t.Error("Restore script must not be scheduled")
+		}
+	}
+}
+
+func TestValidateHeartbeatURL(t *testing.T) {
+	valid := []string{"", "https://hc-ping.com/abc", "http://192.168.1.5:8000/ping/abc"}
+	for _, url := range valid {
+		if err := ValidateHeartbeatURL(url); err != nil {
+			t.Errorf("ValidateHeartbeatURL(%q) error = %v", url, err)
+		}
+	}
+	if err := ValidateHeartbeatURL("hc-ping.com/abc"); err == nil {
+		t.Error("URL without scheme should be rejected")
+	}
+}
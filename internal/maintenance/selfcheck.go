@@ -0,0 +1,10 @@
+package maintenance
+
+// SelfCheckStateFile records the result of each self-check, relative to
+// InfraRoot, so the next run can tell a regression from a known problem
+const SelfCheckStateFile = "selfcheck.state"
+
+// GenerateSelfCheck generates the daily self-check script
+func GenerateSelfCheck(config *ScriptConfig) (string, error) {
+	return generateScript("self_check", config)
+}
@@ -0,0 +1,147 @@
+package maintenance
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGenerateSelfCheck(t *testing.T) {
+	config := DefaultScriptConfig()
+	config.InfraRoot = "/home/user/infra"
+	config.LogDir = "/home/user/infra/logs"
+
+	content, err := GenerateSelfCheck(config)
+	if err != nil {
+		t.Fatalf("GenerateSelfCheck() error: %v", err)
+	}
+	for _, check := range []string{
+		`DATA_ROOT="/mnt/data"`,
+		`COMPOSE_FILE="/home/user/infra/compose/docker-compose.yml"`,
+		`SNAPSHOTS="/mnt/backup/snapshots"`,
+		`STATE="/home/user/infra/selfcheck.state"`,
+		"mountpoint -q",
+		"docker info",
+		"smartctl -H",
+	} {
+		if !strings.Contains(content, check) {
+			t.Errorf("Self-check script missing %q", check)
+		}
+	}
+	if strings.Contains(content, "curl") {
+		t.Error("Self-check script should not alert without a webhook")
+	}
+
+	config.WebhookURL = "https://discord.com/api/webhooks/1/x"
+	content, _ = GenerateSelfCheck(config)
+	if !strings.Contains(content, "curl -s") {
+		t.Error("Self-check script should alert via the webhook")
+	}
+}
+
+func TestCronJobsForSelection_SelfCheck(t *testing.T) {
+	jobs := CronJobsForSelection(ScriptSelection{SelfCheck: true}, "/home/user/infra/scripts", "daily")
+	if len(jobs) != 1 || jobs[0].Command != "/home/user/infra/scripts/self-check.sh" {
+		t.Fatalf("jobs = %+v, want the self-check job only", jobs)
+	}
+	if jobs[0].Schedule.String() != "0 7 * * *" {
+		t.Errorf("Self-check schedule = %q, want 7 AM daily", jobs[0].Schedule.String())
+	}
+}
+
+// TestSelfCheck_AlertsOnlyOnChange runs the generated script twice against a
+// data root that is never mounted: the first run reports the regression, the
+// second stays quiet because nothing changed
+func TestSelfCheck_AlertsOnlyOnChange(t *testing.T) {
+	for _, tool := range []string{"bash", "mountpoint", "awk", "comm"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s not available", tool)
+		}
+	}
+
+	dir := t.TempDir()
+	config := DefaultScriptConfig()
+	config.DataRoot = filepath.Join(dir, "data")
+	config.BackupDest = filepath.Join(dir, "backup")
+	config.InfraRoot = dir
+	config.LogDir = dir
+	content, err := GenerateSelfCheck(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	script := filepath.Join(dir, "self-check.sh")
+	if err := os.WriteFile(script, []byte(content), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	logPath := filepath.Join(dir, "self_check.log")
+	run := func() string {
+		os.Remove(logPath)
+		if err := exec.Command("bash", script).Run(); err == nil {
+			t.Error("Self-check should exit non-zero while a check fails")
+		}
+		log, _ := os.ReadFile(logPath)
+		return string(log)
+	}
+
+	if log := run(); strings.Contains(log, " 0 new") || !strings.Contains(log, "is not mounted") {
+		t.Errorf("First run should report the missing mount as new:\n%s", log)
+	}
+	if log := run(); !strings.Contains(log, "0 new, 0 recovered") {
+		t.Errorf("Second run should not report the known failure again:\n%s", log)
+	}
+
+	state, _ := os.ReadFile(filepath.Join(dir, SelfCheckStateFile))
+	if !strings.Contains(string(state), "mount:data\tFAIL") {
+		t.Errorf("State file = %q", state)
+	}
+}
+
+// TestSelfCheck_RouterForward runs the generated script with a router that
+// forwards Nextcloud's plain-HTTP port to this machine
+func TestSelfCheck_RouterForward(t *testing.T) {
+	for _, tool := range []string{"bash", "mountpoint", "awk", "comm"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s not available", tool)
+		}
+	}
+
+	dir := t.TempDir()
+	bin := filepath.Join(dir, "bin")
+	os.Mkdir(bin, 0755)
+	upnpc := "#!/bin/sh\ncat <<'EOF'\nExternalIPAddress = 203.0.113.5\n" +
+		" 0 TCP  8443->10.9.8.7:8080  'nextcloud' '' 0\n" +
+		" 1 TCP 61208->10.9.8.99:61208 'other' '' 0\nEOF\n"
+	os.WriteFile(filepath.Join(bin, "upnpc"), []byte(upnpc), 0755)
+	os.WriteFile(filepath.Join(bin, "hostname"), []byte("#!/bin/sh\necho '10.9.8.7 '\n"), 0755)
+
+	config := DefaultScriptConfig()
+	config.DataRoot = filepath.Join(dir, "data")
+	config.BackupDest = filepath.Join(dir, "backup")
+	config.InfraRoot = dir
+	config.LogDir = dir
+	config.WebPorts = map[string]int{"Nextcloud": 8080, "Glances": 61208}
+	content, err := GenerateSelfCheck(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	script := filepath.Join(dir, "self-check.sh")
+	if err := os.WriteFile(script, []byte(content), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command("bash", script)
+	cmd.Env = append(os.Environ(), "PATH="+bin+":"+os.Getenv("PATH"))
+	cmd.Run()
+
+	state, _ := os.ReadFile(filepath.Join(dir, SelfCheckStateFile))
+	if !strings.Contains(string(state), "exposed:8080\tFAIL\tNextcloud is reachable from the internet on port 8443") {
+		t.Errorf("Nextcloud's forward was not reported:\n%s", state)
+	}
+	// Glances' port is forwarded, but to another machine
+	if !strings.Contains(string(state), "exposed:61208\tOK") {
+		t.Errorf("a forward to another machine was reported:\n%s", state)
+	}
+}
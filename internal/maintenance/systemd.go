@@ -0,0 +1,98 @@
+package maintenance
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/madhav/servctl/internal/ops"
+	"github.com/madhav/servctl/templates"
+)
+
+// UserUnitDir returns where user systemd units live
+func UserUnitDir(homeDir string) string {
+	return filepath.Join(homeDir, ".config", "systemd", "user")
+}
+
+// cronDayNames maps cron day-of-week numbers to systemd day names
+var cronDayNames = []string{"Sun", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat", "Sun"}
+
+// calendarField converts one cron field to systemd calendar syntax
+// ("*/6" becomes "0/6"; lists and single values carry over unchanged)
+func calendarField(field string) string {
+	if strings.HasPrefix(field, "*/") {
+		return "0/" + strings.TrimPrefix(field, "*/")
+	}
+	return field
+}
+
+// calendarWeekday converts a cron day-of-week field ("0", "1-5", "0,6")
+// to systemd day names
+func calendarWeekday(field string) string {
+	var days []string
+	for _, part := range strings.Split(field, ",") {
+		var names []string
+		for _, n := range strings.SplitN(part, "-", 2) {
+			var day int
+			if _, err := fmt.Sscanf(n, "%d", &day); err != nil || day < 0 || day > 7 {
+				return ""
+			}
+			names = append(names, cronDayNames[day])
+		}
+		days = append(days, strings.Join(names, ".."))
+	}
+	return strings.Join(days, ",")
+}
+
+// OnCalendar returns the schedule as a systemd OnCalendar expression
+func (c CronSchedule) OnCalendar() string {
+	expr := fmt.Sprintf("*-%s-%s %s:%s:00",
+		calendarField(c.Month), calendarField(c.DayOfMonth),
+		calendarField(c.Hour), calendarField(c.Minute))
+
+	if c.DayOfWeek != "*" {
+		if days := calendarWeekday(c.DayOfWeek); days != "" {
+			expr = days + " " + expr
+		}
+	}
+	return expr
+}
+
+// UnitName returns the systemd unit base name for a job
+func (j CronJob) UnitName() string {
+	return "servctl-" + strings.ReplaceAll(j.Name, "_", "-")
+}
+
+// GenerateUserService returns the oneshot service that runs a job
+func GenerateUserService(job CronJob) (string, error) {
+	return templates.Render("system/systemd-service.tmpl", job, nil)
+}
+
+// GenerateUserTimer returns the timer that schedules a job
+func GenerateUserTimer(job CronJob) (string, error) {
+	return templates.Render("system/systemd-timer.tmpl", job, nil)
+}
+
+// WriteUserTimers installs jobs as user systemd timers, the rootless
+// replacement for /etc/cron.d/servctl
+func WriteUserTimers(jobs []CronJob, unitDir string, dryRun bool) error {
+	var units, enable []ops.Operation
+	for _, job := range jobs {
+		base := filepath.Join(unitDir, job.UnitName())
+		service, err := GenerateUserService(job)
+		if err != nil {
+			return err
+		}
+		timer, err := GenerateUserTimer(job)
+		if err != nil {
+			return err
+		}
+		units = append(units,
+			ops.WriteFile{Path: base + ".service", Content: []byte(service), Mode: 0644},
+			ops.WriteFile{Path: base + ".timer", Content: []byte(timer), Mode: 0644})
+		enable = append(enable, ops.Command{Args: []string{"systemctl", "--user", "enable", "--now", job.UnitName() + ".timer"}})
+	}
+
+	steps := append(units, ops.Command{Args: []string{"systemctl", "--user", "daemon-reload"}})
+	return ops.Execute(dryRun, append(steps, enable...)...)
+}
@@ -0,0 +1,56 @@
+package maintenance
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCronScheduleOnCalendar(t *testing.T) {
+	tests := []struct {
+		schedule CronSchedule
+		want     string
+	}{
+		{CronSchedule{"0", "3", "*", "*", "*"}, "*-*-* 3:0:00"},
+		{CronSchedule{"0", "*/6", "*", "*", "*"}, "*-*-* 0/6:0:00"},
+		{CronSchedule{"0", "3", "*", "*", "0"}, "Sun *-*-* 3:0:00"},
+		{CronSchedule{"30", "4", "*", "*", "1-5"}, "Mon..Fri *-*-* 4:30:00"},
+		{CronSchedule{"0", "*", "*", "*", "0,6"}, "Sun,Sat *-*-* *:0:00"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.schedule.OnCalendar(); got != tt.want {
+			t.Errorf("OnCalendar(%q) = %q, want %q", tt.schedule, got, tt.want)
+		}
+	}
+}
+
+func TestGenerateUserTimer(t *testing.T) {
+	job := CronJob{
+		Name:        "daily_backup",
+		Schedule:    BackupCronSchedule("daily"),
+		Command:     "/home/user/infra/scripts/daily-backup.sh",
+		Description: "Data backup",
+	}
+
+	if job.UnitName() != "servctl-daily-backup" {
+		t.Errorf("UnitName() = %q", job.UnitName())
+	}
+
+	timer, err := GenerateUserTimer(job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"OnCalendar=*-*-* 3:0:00", "Persistent=true", "WantedBy=timers.target"} {
+		if !strings.Contains(timer, want) {
+			t.Errorf("timer missing %q", want)
+		}
+	}
+
+	service, err := GenerateUserService(job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(service, "ExecStart=/bin/bash /home/user/infra/scripts/daily-backup.sh") {
+		t.Error("service should run the job's script")
+	}
+}
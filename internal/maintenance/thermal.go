@@ -0,0 +1,26 @@
+package maintenance
+
+import "github.com/madhav/servctl/internal/storage"
+
+// DriveTempStateFile records each drive's last temperature level, relative
+// to InfraRoot, so an alert is sent when a drive heats up and once more when
+// it cools down rather than every run
+const DriveTempStateFile = "drivetemp.state"
+
+// driveTempTemplateData adds the NVMe limits, which are not configurable,
+// to the script configuration
+type driveTempTemplateData struct {
+	*ScriptConfig
+	NVMeTempWarn int
+	NVMeTempCrit int
+}
+
+// GenerateDriveTemp generates the drive temperature alert script
+func GenerateDriveTemp(config *ScriptConfig) (string, error) {
+	data := driveTempTemplateData{
+		ScriptConfig: config,
+		NVMeTempWarn: storage.NVMeTempWarn,
+		NVMeTempCrit: storage.NVMeTempCrit,
+	}
+	return generateScript("drive_temp", data)
+}
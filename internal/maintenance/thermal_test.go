@@ -0,0 +1,108 @@
+package maintenance
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGenerateDriveTemp(t *testing.T) {
+	config := DefaultScriptConfig()
+	config.InfraRoot = "/home/user/infra"
+	config.LogDir = "/home/user/infra/logs"
+
+	content, err := GenerateDriveTemp(config)
+	if err != nil {
+		t.Fatalf("GenerateDriveTemp() error: %v", err)
+	}
+	for _, check := range []string{
+		"HDD_WARN=50",
+		"HDD_CRIT=55",
+		"NVME_WARN=70",
+		`STATE="/home/user/infra/drivetemp.state"`,
+		"smartctl -n standby -A",
+	} {
+		if !strings.Contains(content, check) {
+			t.Errorf("Drive temperature script missing %q", check)
+		}
+	}
+	if strings.Contains(content, "curl") {
+		t.Error("Drive temperature script should not alert without a webhook")
+	}
+}
+
+func TestCronJobsForSelection_DriveTemp(t *testing.T) {
+	jobs := CronJobsForSelection(ScriptSelection{DriveTemp: true}, "/home/user/infra/scripts", "daily")
+	if len(jobs) != 1 || jobs[0].Command != "/home/user/infra/scripts/drive-temp.sh" {
+		t.Fatalf("jobs = %+v, want the drive temperature job only", jobs)
+	}
+	if jobs[0].Schedule.String() != "*/30 * * * *" {
+		t.Errorf("Drive temperature schedule = %q, want every 30 minutes", jobs[0].Schedule.String())
+	}
+}
+
+// TestDriveTemp_TracksLevels runs the generated script against fake lsblk
+// and smartctl: the recorded level follows the temperature, and a drive in
+// standby keeps its last level so waking it up is not reported as a change
+func TestDriveTemp_TracksLevels(t *testing.T) {
+	for _, tool := range []string{"bash", "awk"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s not available", tool)
+		}
+	}
+
+	dir := t.TempDir()
+	bin := filepath.Join(dir, "bin")
+	os.Mkdir(bin, 0755)
+	tempFile := filepath.Join(dir, "temp")
+	fakes := map[string]string{
+		"lsblk": "#!/bin/sh\necho 'sda disk'\n",
+		// An empty temp file stands for a drive in standby
+		"smartctl": "#!/bin/sh\nT=$(cat " + tempFile + ")\n[ -n \"$T\" ] || exit 2\n" +
+			"echo \"194 Temperature_Celsius 0x0022 036 052 000 Old_age Always - $T (Min/Max 20/52)\"\n",
+	}
+	for name, content := range fakes {
+		if err := os.WriteFile(filepath.Join(bin, name), []byte(content), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	config := DefaultScriptConfig()
+	config.InfraRoot = dir
+	config.LogDir = dir
+	content, err := GenerateDriveTemp(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	script := filepath.Join(dir, "drive-temp.sh")
+	if err := os.WriteFile(script, []byte(content), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	run := func(temp string) string {
+		os.WriteFile(tempFile, []byte(temp), 0644)
+		cmd := exec.Command("bash", script)
+		cmd.Env = append(os.Environ(), "PATH="+bin+":"+os.Getenv("PATH"))
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("script failed: %v\n%s", err, out)
+		}
+		state, _ := os.ReadFile(filepath.Join(dir, DriveTempStateFile))
+		return strings.TrimSpace(string(state))
+	}
+
+	if state := run("38"); state != "/dev/sda ok" {
+		t.Errorf("state at 38°C = %q", state)
+	}
+	if state := run("56"); state != "/dev/sda hot" {
+		t.Errorf("state at 56°C = %q", state)
+	}
+	if state := run(""); state != "/dev/sda hot" {
+		t.Errorf("standby should keep the last level, got %q", state)
+	}
+	log, _ := os.ReadFile(filepath.Join(dir, "drive_temp.log"))
+	if !strings.Contains(string(log), "/dev/sda: 56°C (hot)") {
+		t.Errorf("log = %s", log)
+	}
+}
@@ -0,0 +1,204 @@
+package maintenance
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/madhav/servctl/internal/storage"
+)
+
+// ValidationIssue is a problem ValidateScripts found in a script or in
+// the cron file
+type ValidationIssue struct {
+	File string // Script, cron file or mount point the issue is about
+	LintIssue
+	Warning bool // Worth a look, but the job still runs
+}
+
+func (i ValidationIssue) String() string {
+	return filepath.Base(i.File) + ": " + i.LintIssue.String()
+}
+
+// pathAssignment matches the configuration lines at the top of a script
+// that set a variable to a literal absolute path, e.g. DATA_ROOT="/mnt/data"
+var pathAssignment = regexp.MustCompile(`^([A-Za-z_]\w*)="(/[^"$` + "`" + `\\]*)"\s*$`)
+
+// BaselineScripts renders every script servctl can generate from the saved
+// maintenance settings, by file name: what the scripts directory holds
+// before anyone edits it
+func BaselineScripts(config *ScriptConfig) (map[string]string, error) {
+	all := ScriptSelection{
+		DailyBackup: true, DiskAlert: true, SmartAlert: true, WeeklyCleanup: true,
+		InfraConfig: true, BitrotScrub: true, SelfCheck: true, DriveTemp: true,
+		RebootWindow: true, RestoreDrill: true, CriticalOffsite: true,
+	}
+	scripts, err := GetScriptsForSelection(all, config)
+	if err != nil {
+		return nil, err
+	}
+	runner, err := RunJobScriptInfo(config)
+	if err != nil {
+		return nil, err
+	}
+
+	baseline := make(map[string]string)
+	for _, s := range append(scripts, runner) {
+		baseline[s.Filename] = s.Content
+	}
+	return baseline, nil
+}
+
+// ValidateScripts checks the scripts in scriptsDir after they may have been
+// edited by hand:
+//
+//   - syntax: bash -n
+//   - missing-path: a path set at the top of the script whose directory
+//     does not exist
+//   - not-mounted: the data root or backup drive a script uses is not a
+//     mount point, so the script would fill the system disk (warning)
+//   - modified: the script differs from what servctl generates from the
+//     saved settings; 'servctl -start-setup' would overwrite it (warning)
+//   - cron-target: a job in cronFile runs a file that is missing or not
+//     executable
+//
+// A missing cronFile is a warning: the scripts may run from user systemd
+// timers instead.
+func ValidateScripts(config *ScriptConfig, scriptsDir, cronFile string) ([]ValidationIssue, error) {
+	entries, err := os.ReadDir(scriptsDir)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read scripts directory: %w", err)
+	}
+	baseline, err := BaselineScripts(config)
+	if err != nil {
+		return nil, fmt.Errorf("cannot render the generated scripts: %w", err)
+	}
+
+	var issues []ValidationIssue
+	add := func(file string, warning bool, line int, rule, format string, args ...interface{}) {
+		issues = append(issues, ValidationIssue{
+			File:      file,
+			LintIssue: LintIssue{Line: line, Rule: rule, Message: fmt.Sprintf(format, args...)},
+			Warning:   warning,
+		})
+	}
+
+	usedRoots := make(map[string]bool)
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".sh") {
+			continue
+		}
+		path := filepath.Join(scriptsDir, entry.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			add(path, false, 0, "read", "%v", err)
+			continue
+		}
+		content := string(data)
+
+		if issue, ok := syntaxCheck(content); !ok {
+			issues = append(issues, ValidationIssue{File: path, LintIssue: issue})
+		}
+
+		for i, line := range strings.Split(content, "\n") {
+			m := pathAssignment.FindStringSubmatch(line)
+			if m == nil {
+				continue
+			}
+			value := filepath.Clean(m[2])
+			if !exists(value) && !exists(filepath.Dir(value)) {
+				add(path, false, i+1, "missing-path", "%s=%s: %s does not exist", m[1], m[2], filepath.Dir(value))
+			}
+			for _, root := range []string{config.DataRoot, config.BackupDest} {
+				if root != "" && root != "/" && (value == filepath.Clean(root) || strings.HasPrefix(value, filepath.Clean(root)+"/")) {
+					usedRoots[filepath.Clean(root)] = true
+				}
+			}
+		}
+
+		if generated, ok := baseline[entry.Name()]; ok && generated != content {
+			add(path, true, firstDifference(generated, content), "modified",
+				"differs from the script servctl generates; re-running setup replaces it")
+		}
+	}
+
+	roots := make([]string, 0, len(usedRoots))
+	for root := range usedRoots {
+		roots = append(roots, root)
+	}
+	sort.Strings(roots)
+	for _, root := range roots {
+		if exists(root) && !storage.IsMountPoint(root) {
+			add(root, true, 0, "not-mounted", "%s is not a mount point; scripts using it would write to the system disk", root)
+		}
+	}
+
+	jobs, err := os.Open(cronFile)
+	if os.IsNotExist(err) {
+		add(cronFile, true, 0, "cron-target", "no cron file; the scripts only run if scheduled some other way")
+		return issues, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read cron file: %w", err)
+	}
+	defer jobs.Close()
+
+	scanner := bufio.NewScanner(jobs)
+	for n := 1; scanner.Scan(); n++ {
+		for _, target := range cronTargets(scanner.Text()) {
+			info, err := os.Stat(target)
+			switch {
+			case err != nil:
+				add(cronFile, false, n, "cron-target", "%s does not exist", target)
+			case info.IsDir() || info.Mode()&0111 == 0:
+				add(cronFile, false, n, "cron-target", "%s is not executable", target)
+			}
+		}
+	}
+	return issues, scanner.Err()
+}
+
+// cronTargets returns the absolute paths a cron.d line runs, e.g. the
+// wrapper and the script; none for comments and variable lines
+func cronTargets(line string) []string {
+	fields := strings.Fields(line)
+	if len(fields) == 0 || strings.HasPrefix(fields[0], "#") || strings.Contains(fields[0], "=") {
+		return nil
+	}
+	// Five schedule fields, or one @nickname, then the user
+	skip := 6
+	if strings.HasPrefix(fields[0], "@") {
+		skip = 2
+	}
+	if len(fields) <= skip {
+		return nil
+	}
+
+	var targets []string
+	for _, f := range fields[skip:] {
+		if strings.HasPrefix(f, "/") {
+			targets = append(targets, f)
+		}
+	}
+	return targets
+}
+
+// firstDifference returns the first line number at which a and b differ
+func firstDifference(a, b string) int {
+	al, bl := strings.Split(a, "\n"), strings.Split(b, "\n")
+	for i := range al {
+		if i >= len(bl) || al[i] != bl[i] {
+			return i + 1
+		}
+	}
+	return len(al) + 1
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,103 @@
+package maintenance
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateScripts(t *testing.T) {
+	root := t.TempDir()
+	config := DefaultScriptConfig()
+	config.DataRoot = filepath.Join(root, "data")
+	config.BackupDest = filepath.Join(root, "backup")
+	config.InfraRoot = filepath.Join(root, "infra")
+	config.LogDir = filepath.Join(root, "infra", "logs")
+	scriptsDir := filepath.Join(config.InfraRoot, "scripts")
+	for _, dir := range []string{config.DataRoot, config.LogDir, scriptsDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	baseline, err := BaselineScripts(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(scriptsDir, name), []byte(content), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Untouched, edited with a broken if, and an unknown script of the
+	// user's own with a path that went away
+	write("disk-alert.sh", baseline["disk-alert.sh"])
+	write("daily-backup.sh", strings.Replace(baseline["daily-backup.sh"], "fi\n", "\n", 1))
+	write("own.sh", "#!/bin/bash\nOUT=\"/nonexistent/servctl/out.txt\"\n")
+
+	cron := filepath.Join(root, "servctl.cron")
+	os.WriteFile(cron, []byte("SHELL=/bin/bash\n# Daily backup\n"+
+		"0 3 * * * root "+filepath.Join(scriptsDir, "daily-backup.sh")+"\n"+
+		"@reboot root "+filepath.Join(scriptsDir, "gone.sh")+"\n"), 0644)
+
+	issues, err := ValidateScripts(config, scriptsDir, cron)
+	if err != nil {
+		t.Fatalf("ValidateScripts() error: %v", err)
+	}
+
+	found := make(map[string]ValidationIssue)
+	for _, i := range issues {
+		found[filepath.Base(i.File)+" "+i.Rule] = i
+	}
+	if _, err := exec.LookPath("bash"); err == nil {
+		if _, ok := found["daily-backup.sh syntax"]; !ok {
+			t.Errorf("want a syntax error in the edited daily-backup.sh, got %v", issues)
+		}
+	}
+	if i, ok := found["daily-backup.sh modified"]; !ok || !i.Warning {
+		t.Errorf("want a modified warning for daily-backup.sh, got %v", issues)
+	}
+	if _, ok := found["disk-alert.sh modified"]; ok {
+		t.Error("untouched disk-alert.sh reported as modified")
+	}
+	// The backup drive was never created
+	if i, ok := found["daily-backup.sh missing-path"]; !ok || !strings.Contains(i.Message, "SNAPSHOTS") {
+		t.Errorf("want the missing backup drive reported, got %v", issues)
+	}
+	if i, ok := found["own.sh missing-path"]; !ok || i.Line != 2 {
+		t.Errorf("want own.sh line 2 missing-path, got %v", issues)
+	}
+	if _, ok := found["own.sh modified"]; ok {
+		t.Error("a script servctl does not generate has no baseline")
+	}
+	if i, ok := found["data not-mounted"]; !ok || !i.Warning {
+		t.Errorf("want a not-mounted warning for the data root, got %v", issues)
+	}
+	if i, ok := found["servctl.cron cron-target"]; !ok || i.Line != 4 || !strings.Contains(i.Message, "gone.sh") {
+		t.Errorf("want the cron entry for gone.sh reported, got %v", issues)
+	}
+	if len(issues) != 6 {
+		t.Errorf("got %d issues, want 6: %v", len(issues), issues)
+	}
+}
+
+func TestCronTargets(t *testing.T) {
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{"# comment", nil},
+		{"PATH=/usr/bin:/bin", nil},
+		{"0 3 * * * root /s/run-job.sh daily_backup /s/daily-backup.sh", []string{"/s/run-job.sh", "/s/daily-backup.sh"}},
+		{"@reboot root /s/self-check.sh", []string{"/s/self-check.sh"}},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		got := cronTargets(tt.line)
+		if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+			t.Errorf("cronTargets(%q) = %v, want %v", tt.line, got, tt.want)
+		}
+	}
+}
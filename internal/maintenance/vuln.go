@@ -0,0 +1,16 @@
+package maintenance
+
+// TrivyImage is the scanner vuln_scan.sh runs; it is pulled each week, so
+// the scanner stays as current as its database
+const TrivyImage = "aquasec/trivy:latest"
+
+// VulnSummaryFile is where vuln_scan.sh leaves its per-service summary in
+// the log directory, for the weekly cleanup report
+const VulnSummaryFile = "vuln_scan.summary"
+
+// GenerateVulnScan generates the weekly image vulnerability scan: the
+// critical CVEs in each service's running image, and whether the
+// registry's current image for its tag fixes them
+func GenerateVulnScan(config *ScriptConfig) (string, error) {
+	return generateScript("vuln_scan", config)
+}
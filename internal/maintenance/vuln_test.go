@@ -0,0 +1,60 @@
+package maintenance
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGenerateVulnScan(t *testing.T) {
+	config := DefaultScriptConfig()
+	config.InfraRoot = "/home/user/infra"
+	config.LogDir = "/home/user/infra/logs"
+	config.DockerSocket = "/run/user/1000/docker.sock" // Rootless
+
+	content, err := GenerateVulnScan(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`SUMMARY="/home/user/infra/logs/vuln_scan.summary"`,
+		`TRIVY_IMAGE="aquasec/trivy:latest"`,
+		"--severity CRITICAL",
+		"--image-src remote",
+		`DOCKER_SOCKET="/run/user/1000/docker.sock"`,
+		`-v "$DOCKER_SOCKET":/var/run/docker.sock:ro`,
+		// Docker's Go templates reach the script unrendered
+		`docker inspect -f '{{.Image}}'`,
+		`ps --format '{{.Service}} {{.ID}}'`,
+		"servctl -start-setup -only bootstrap",
+	} {
+		if !strings.Contains(content, want) {
+			t.Errorf("scan script is missing %s", want)
+		}
+	}
+}
+
+func TestWeeklyCleanup_ReportsVulnerabilities(t *testing.T) {
+	config := DefaultScriptConfig()
+	config.LogDir = "/home/user/infra/logs"
+	config.WebhookURL = "https://discord.com/api/webhooks/1/x"
+
+	content, err := GenerateWeeklyCleanup(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(content, `VULN_SUMMARY="/home/user/infra/logs/vuln_scan.summary"`) || !strings.Contains(content, "Critical vulnerabilities") {
+		t.Error("weekly cleanup report does not include the scan summary")
+	}
+}
+
+func TestStaggerJobs_ScanBeforeWeeklyReport(t *testing.T) {
+	sel := ScriptSelection{DailyBackup: true, WeeklyCleanup: true, VulnScan: true}
+	jobs := staggerJobs(CronJobsForSelection(sel, "/home/user/infra/scripts", "daily"), nil)
+	checkNoOverlap(t, jobs)
+
+	scan := startMinutes(jobByName(jobs, "vuln_scan").Schedule)[0]
+	cleanup := startMinutes(jobByName(jobs, "weekly_cleanup").Schedule)[0]
+	if scan+jobDurations["vuln_scan"] > cleanup {
+		t.Errorf("The scan should finish before the weekly report: %s vs %s", clock(scan), clock(cleanup))
+	}
+}
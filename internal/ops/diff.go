@@ -0,0 +1,160 @@
+package ops
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContext is how many unchanged lines a hunk shows around a change
+const diffContext = 3
+
+// maxDiffLines caps a preview; a new 600-line compose file needs no more
+// than its start to recognise
+const maxDiffLines = 120
+
+// maxDiffCells bounds the comparison table. Files servctl writes are a few
+// hundred lines; past this the whole file is shown as replaced.
+const maxDiffCells = 4_000_000
+
+// Diff returns a unified diff of before and after without file headers,
+// empty when they are equal
+func Diff(before, after string) string {
+	if before == after {
+		return ""
+	}
+	a, b := splitLines(before), splitLines(after)
+	edits := diffLines(a, b)
+
+	var out []string
+	for start := 0; start < len(edits); {
+		// Find the next change and the run of edits it belongs to
+		first := start
+		for first < len(edits) && edits[first].op == ' ' {
+			first++
+		}
+		if first == len(edits) {
+			break
+		}
+		from := max(first-diffContext, start)
+		end := first
+		for i := first; i < len(edits); i++ {
+			if edits[i].op != ' ' {
+				end = i + 1
+			} else if i-end >= 2*diffContext {
+				break
+			}
+		}
+		to := min(end+diffContext, len(edits))
+
+		aLine, bLine, aCount, bCount := edits[from].aLine, edits[from].bLine, 0, 0
+		var hunk []string
+		for _, e := range edits[from:to] {
+			if e.op != '+' {
+				aCount++
+			}
+			if e.op != '-' {
+				bCount++
+			}
+			hunk = append(hunk, string(e.op)+e.text)
+		}
+		out = append(out, fmt.Sprintf("@@ -%s +%s @@", hunkRange(aLine, aCount), hunkRange(bLine, bCount)))
+		out = append(out, hunk...)
+		start = to
+	}
+
+	if len(out) > maxDiffLines {
+		more := len(out) - maxDiffLines
+		out = append(out[:maxDiffLines], fmt.Sprintf("... (%d more lines)", more))
+	}
+	return strings.Join(out, "\n") + "\n"
+}
+
+// hunkRange formats a hunk's start line and length the way diff -u does
+func hunkRange(line, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", line)
+	}
+	if count == 1 {
+		return fmt.Sprint(line + 1)
+	}
+	return fmt.Sprintf("%d,%d", line+1, count)
+}
+
+// edit is one line of a diff: ' ' kept, '-' removed, '+' added. aLine and
+// bLine are where it sits in each file, counted from 0.
+type edit struct {
+	op           byte
+	text         string
+	aLine, bLine int
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// diffLines lines a and b up along their longest common subsequence
+func diffLines(a, b []string) []edit {
+	// Common lines at either end need no table
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	midA, midB := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+
+	var edits []edit
+	for i := 0; i < prefix; i++ {
+		edits = append(edits, edit{' ', a[i], i, i})
+	}
+
+	n, m := len(midA), len(midB)
+	if n*m > maxDiffCells {
+		for i, line := range midA {
+			edits = append(edits, edit{'-', line, prefix + i, prefix})
+		}
+		for j, line := range midB {
+			edits = append(edits, edit{'+', line, prefix + n, prefix + j})
+		}
+	} else {
+		// lcs[i][j] is the common length of midA[i:] and midB[j:]
+		lcs := make([][]int, n+1)
+		for i := range lcs {
+			lcs[i] = make([]int, m+1)
+		}
+		for i := n - 1; i >= 0; i-- {
+			for j := m - 1; j >= 0; j-- {
+				if midA[i] == midB[j] {
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				} else {
+					lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+				}
+			}
+		}
+		i, j := 0, 0
+		for i < n || j < m {
+			switch {
+			case i < n && j < m && midA[i] == midB[j]:
+				edits = append(edits, edit{' ', midA[i], prefix + i, prefix + j})
+				i++
+				j++
+			case i < n && (j == m || lcs[i+1][j] >= lcs[i][j+1]):
+				edits = append(edits, edit{'-', midA[i], prefix + i, prefix + j})
+				i++
+			default:
+				edits = append(edits, edit{'+', midB[j], prefix + i, prefix + j})
+				j++
+			}
+		}
+	}
+
+	for k := 0; k < suffix; k++ {
+		edits = append(edits, edit{' ', a[len(a)-suffix+k], len(a) - suffix + k, len(b) - suffix + k})
+	}
+	return edits
+}
@@ -0,0 +1,263 @@
+// Package ops describes the changes servctl makes to a machine as
+// operations that one engine either applies or previews. A -dry-run goes
+// through the same functions as a real run and stops only here, so it
+// shows exactly the files, with a diff against what is on disk, and the
+// commands that a real run would write and run.
+package ops
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/madhav/servctl/internal/trash"
+	"github.com/madhav/servctl/internal/utils"
+	"github.com/madhav/servctl/templates"
+)
+
+// Operation is one change to the machine
+type Operation interface {
+	// Describe says what the operation does, as in "write /etc/cron.d/servctl (mode 0644)"
+	Describe() string
+	// Preview is shown under the description in a dry run: a diff, or
+	// nothing
+	Preview() string
+	// Apply makes the change
+	Apply() error
+}
+
+// Engine applies operations, or in a dry run prints them
+type Engine struct {
+	DryRun bool
+	Out    io.Writer // Where a dry run prints; os.Stdout when nil
+}
+
+// Execute applies ops in order and stops at the first that fails
+func (e Engine) Execute(ops ...Operation) error {
+	out := e.Out
+	if out == nil {
+		out = os.Stdout
+	}
+	for _, op := range ops {
+		if !e.DryRun {
+			if err := op.Apply(); err != nil {
+				return err
+			}
+			continue
+		}
+		fmt.Fprintf(out, "[DRY RUN] Would %s\n", op.Describe())
+		if preview := op.Preview(); preview != "" {
+			fmt.Fprintln(out, templates.Indent(4, strings.TrimSuffix(preview, "\n")))
+		}
+	}
+	return nil
+}
+
+// Execute runs ops through an engine that prints to stdout
+func Execute(dryRun bool, ops ...Operation) error {
+	return Engine{DryRun: dryRun}.Execute(ops...)
+}
+
+// WriteFile writes a whole file atomically. The previous contents go to
+// servctl's trash when the file is under one of its roots.
+type WriteFile struct {
+	Path    string
+	Content []byte
+	Mode    os.FileMode
+	// Secret files (.env, state with passwords) preview which lines
+	// change, never their values
+	Secret bool
+	// Sudo writes a root-owned file through sudo when servctl is not root,
+	// and sets Mode even on an existing file
+	Sudo bool
+}
+
+func (w WriteFile) Describe() string {
+	if _, err := os.Stat(w.Path); err != nil {
+		return fmt.Sprintf("create %s (mode %04o)", w.Path, w.Mode)
+	}
+	current, err := os.ReadFile(w.Path)
+	switch {
+	case err != nil:
+		return fmt.Sprintf("replace %s (mode %04o; cannot read the current file to compare)", w.Path, w.Mode)
+	case string(current) == string(w.Content):
+		return fmt.Sprintf("keep %s (unchanged)", w.Path)
+	}
+	return fmt.Sprintf("write %s (mode %04o)", w.Path, w.Mode)
+}
+
+func (w WriteFile) Preview() string {
+	current, err := os.ReadFile(w.Path)
+	if err != nil && !os.IsNotExist(err) {
+		return ""
+	}
+	diff := Diff(string(current), string(w.Content))
+	if w.Secret {
+		diff = maskValues(diff)
+	}
+	return diff
+}
+
+func (w WriteFile) Apply() error {
+	if w.Sudo {
+		if err := utils.AtomicWriteSudo(w.Path, w.Content, w.Mode); err != nil {
+			return err
+		}
+		if err := os.Chmod(w.Path, w.Mode); err == nil {
+			return nil
+		}
+		chmod := exec.Command("sudo", "chmod", fmt.Sprintf("%o", w.Mode), w.Path)
+		if output, err := chmod.CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to set mode on %s: %s: %w", w.Path, strings.TrimSpace(string(output)), err)
+		}
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(w.Path), 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(w.Path), err)
+	}
+	if err := trash.WriteFile(w.Path, w.Content, w.Mode); err != nil {
+		return fmt.Errorf("failed to write %s: %w", w.Path, err)
+	}
+	return nil
+}
+
+// maskValues hides everything after the first = or : of each diff line,
+// and lines with neither, so a diff of a secret file shows only which
+// keys change
+func maskValues(diff string) string {
+	lines := strings.Split(diff, "\n")
+	for i, line := range lines {
+		if line == "" || strings.HasPrefix(line, "@@") || strings.HasPrefix(line, "...") {
+			continue
+		}
+		prefix, body := line[:1], line[1:]
+		if strings.HasPrefix(strings.TrimSpace(body), "#") || strings.TrimSpace(body) == "" {
+			continue
+		}
+		if cut := strings.IndexAny(body, "=:"); cut >= 0 {
+			lines[i] = prefix + body[:cut+1] + "***"
+		} else {
+			lines[i] = prefix + "***"
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Command runs a program and fails with its output when it exits non-zero
+type Command struct {
+	Args  []string
+	Dir   string // Working directory; servctl's when empty
+	Stdin string
+	// Env adds NAME=value pairs to servctl's environment. Secrets go here
+	// rather than in Args, which any user can read in the process list;
+	// only the names are described.
+	Env []string
+	// MayFail runs the command for its effect and ignores its exit code,
+	// as when stopping something that may not be running
+	MayFail bool
+}
+
+func (c Command) Describe() string {
+	quoted := make([]string, len(c.Args))
+	for i, arg := range c.Args {
+		quoted[i] = templates.ShellQuote(arg)
+	}
+	s := "run: " + strings.Join(quoted, " ")
+	if len(c.Env) > 0 {
+		names := make([]string, len(c.Env))
+		for i, env := range c.Env {
+			names[i], _, _ = strings.Cut(env, "=")
+		}
+		s += " (with " + strings.Join(names, ", ") + " set)"
+	}
+	if c.Dir != "" {
+		s += " (in " + c.Dir + ")"
+	}
+	return s
+}
+
+func (c Command) Preview() string { return "" }
+
+func (c Command) Apply() error {
+	cmd := exec.Command(c.Args[0], c.Args[1:]...)
+	cmd.Dir = c.Dir
+	if c.Stdin != "" {
+		cmd.Stdin = strings.NewReader(c.Stdin)
+	}
+	if len(c.Env) > 0 {
+		cmd.Env = append(os.Environ(), c.Env...)
+	}
+	if output, err := cmd.CombinedOutput(); err != nil && !c.MayFail {
+		return fmt.Errorf("%s failed: %s", strings.Join(c.Args, " "), strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// Mkdir creates a directory and its parents
+type Mkdir struct {
+	Path string
+	Mode os.FileMode
+	Sudo bool // Create with sudo when servctl is not root
+}
+
+func (m Mkdir) Describe() string {
+	if info, err := os.Stat(m.Path); err == nil && info.IsDir() {
+		return fmt.Sprintf("keep %s (exists)", m.Path)
+	}
+	return fmt.Sprintf("create directory %s (mode %04o)", m.Path, m.Mode)
+}
+
+func (m Mkdir) Preview() string { return "" }
+
+func (m Mkdir) Apply() error {
+	if m.Sudo && os.Geteuid() != 0 {
+		return Command{Args: []string{"sudo", "mkdir", "-p", "-m", fmt.Sprintf("%o", m.Mode), m.Path}}.Apply()
+	}
+	if err := os.MkdirAll(m.Path, m.Mode); err != nil {
+		return fmt.Errorf("failed to create %s: %w", m.Path, err)
+	}
+	return nil
+}
+
+// Func is a change made through an API rather than a file or a program:
+// a package install, an HTTP call to a service. Description says what it
+// does, as "install nut".
+type Func struct {
+	Description string
+	Fn          func() error
+}
+
+func (f Func) Describe() string { return f.Description }
+
+func (f Func) Preview() string { return "" }
+
+func (f Func) Apply() error { return f.Fn() }
+
+// Remove deletes a file, keeping it in the trash when it is under one of
+// its roots. A file that is already gone is not an error.
+type Remove struct {
+	Path string
+	Sudo bool // Remove with sudo when servctl is not root
+}
+
+func (r Remove) Describe() string {
+	if _, err := os.Lstat(r.Path); err != nil {
+		return fmt.Sprintf("skip removing %s (not there)", r.Path)
+	}
+	return "remove " + r.Path
+}
+
+func (r Remove) Preview() string { return "" }
+
+func (r Remove) Apply() error {
+	if _, err := os.Lstat(r.Path); os.IsNotExist(err) {
+		return nil
+	}
+	if r.Sudo && os.Geteuid() != 0 {
+		return Command{Args: []string{"sudo", "rm", "-f", r.Path}}.Apply()
+	}
+	return trash.Remove(r.Path)
+}
@@ -0,0 +1,173 @@
+package ops
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	before := "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\n"
+	after := "a\nb\nc\nd\nE\nf\ng\nh\ni\nj\nk\n"
+	want := `@@ -2,9 +2,10 @@
+ b
+ c
+ d
+-e
++E
+ f
+ g
+ h
+ i
+ j
++k
+`
+	if got := Diff(before, after); got != want {
+		t.Errorf("Diff =\n%s\nwant\n%s", got, want)
+	}
+	if got := Diff("", "x\n"); got != "@@ -0,0 +1 @@\n+x\n" {
+		t.Errorf("Diff of a new file = %q", got)
+	}
+	if Diff("same\n", "same\n") != "" {
+		t.Error("Equal files should have no diff")
+	}
+}
+
+func TestDiff_SeparateHunks(t *testing.T) {
+	var before, after []string
+	for i := 0; i < 30; i++ {
+		before = append(before, "line")
+		after = append(after, "line")
+	}
+	after[2], after[25] = "first", "second"
+	got := Diff(strings.Join(before, "\n")+"\n", strings.Join(after, "\n")+"\n")
+	if strings.Count(got, "@@ -") != 2 {
+		t.Errorf("Changes far apart should get a hunk each:\n%s", got)
+	}
+}
+
+func TestWriteFile_SecretPreview(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".env")
+	os.WriteFile(path, []byte("# comment\nDB_PASSWORD=old\nTZ=UTC\n"), 0600)
+	preview := WriteFile{Path: path, Content: []byte("# comment\nDB_PASSWORD=new\nTZ=UTC\n"), Secret: true}.Preview()
+	if strings.Contains(preview, "old") || strings.Contains(preview, "new") {
+		t.Errorf("Secret values leaked into the preview:\n%s", preview)
+	}
+	if !strings.Contains(preview, "-DB_PASSWORD=***") || !strings.Contains(preview, "+DB_PASSWORD=***") {
+		t.Errorf("A changed secret should still show as a changed line:\n%s", preview)
+	}
+	if strings.Contains(preview, "-TZ") {
+		t.Errorf("An unchanged line should not show as changed:\n%s", preview)
+	}
+}
+
+func TestEngine_DryRunMatchesApply(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "sub", "docker-compose.yml")
+	operations := []Operation{
+		WriteFile{Path: path, Content: []byte("services: {}\n"), Mode: 0644},
+		Command{Args: []string{"true"}, Dir: dir},
+	}
+
+	var out strings.Builder
+	if err := (Engine{DryRun: true, Out: &out}).Execute(operations...); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatal("A dry run must not write")
+	}
+	for _, want := range []string{"[DRY RUN] Would create " + path + " (mode 0644)", "+services: {}", "[DRY RUN] Would run: true (in " + dir + ")"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Dry run output lacks %q:\n%s", want, out.String())
+		}
+	}
+
+	if err := Execute(false, operations...); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "services: {}\n" {
+		t.Errorf("Apply wrote %q", data)
+	}
+	if got := operations[0].Describe(); got != "keep "+path+" (unchanged)" {
+		t.Errorf("Describe after apply = %q", got)
+	}
+}
+
+func TestEngine_StopsAtFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "never")
+	err := Execute(false,
+		Command{Args: []string{"false"}},
+		WriteFile{Path: path, Content: []byte("x"), Mode: 0644},
+	)
+	if err == nil || !strings.Contains(err.Error(), "false failed") {
+		t.Errorf("Expected the command's error, got %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("Operations after a failure should not run")
+	}
+}
+
+func TestRemove(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "servctl")
+	os.WriteFile(path, []byte("x"), 0644)
+	if got := (Remove{Path: path}).Describe(); got != "remove "+path {
+		t.Errorf("Describe = %q", got)
+	}
+	if err := Execute(false, Remove{Path: path}, Remove{Path: path}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("File should be gone")
+	}
+}
+
+func TestCommand_EnvAndMayFail(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out")
+	cmd := Command{Args: []string{"sh", "-c", `printf %s "$SECRET" > "$OUT"`}, Env: []string{"SECRET=hunter2", "OUT=" + out}}
+	if got := cmd.Describe(); strings.Contains(got, "hunter2") || !strings.HasSuffix(got, "(with SECRET, OUT set)") {
+		t.Errorf("Describe = %q, want the names without the values", got)
+	}
+	if err := Execute(false, cmd); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(out); string(data) != "hunter2" {
+		t.Errorf("The command saw %q in its environment", data)
+	}
+
+	if err := Execute(false, Command{Args: []string{"false"}, MayFail: true}); err != nil {
+		t.Errorf("MayFail should ignore the exit code, got %v", err)
+	}
+}
+
+func TestMkdirAndFunc(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "a", "b")
+	called := false
+	operations := []Operation{
+		Mkdir{Path: dir, Mode: 0750},
+		Func{Description: "call the API", Fn: func() error { called = true; return nil }},
+	}
+
+	var out strings.Builder
+	if err := (Engine{DryRun: true, Out: &out}).Execute(operations...); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"[DRY RUN] Would create directory " + dir + " (mode 0750)", "[DRY RUN] Would call the API"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Dry run output lacks %q:\n%s", want, out.String())
+		}
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) || called {
+		t.Fatal("A dry run must not create the directory or call the function")
+	}
+
+	if err := Execute(false, operations...); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() || !called {
+		t.Errorf("Apply should create %s and call the function", dir)
+	}
+	if got := operations[0].Describe(); got != "keep "+dir+" (exists)" {
+		t.Errorf("Describe after apply = %q", got)
+	}
+}
@@ -0,0 +1,222 @@
+// Package paths is the single registry of servctl's data directories.
+// directory creates them, compose mounts them, maintenance backs them up and
+// report lists them, all by key, so a generated volume can never point at a
+// directory that was not created.
+package paths
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Keys of the registered data locations
+const (
+	Root = "root"
+
+	Gallery        = "gallery"
+	GalleryLibrary = "gallery-library"
+	GalleryUpload  = "gallery-upload"
+	GalleryProfile = "gallery-profile"
+	GalleryThumbs  = "gallery-thumbs"
+	GalleryVideo   = "gallery-video"
+
+	Cloud       = "cloud"
+	CloudData   = "cloud-data"
+	CloudConfig = "cloud-config"
+	CloudExport = "cloud-export"
+
+	Databases   = "databases"
+	ImmichDB    = "immich-db"
+	NextcloudDB = "nextcloud-db"
+	AuthentikDB = "authentik-db"
+	Cache       = "cache"
+
+	Authentik      = "authentik"
+	AuthentikMedia = "authentik-media"
+
+	Logs = "logs"
+	Loki = "logs-loki"
+
+	Media         = "media"
+	MediaMovies   = "media-movies"
+	MediaTV       = "media-tv"
+	MediaMusic    = "media-music"
+	Downloads     = "downloads"
+	DownloadsDone = "downloads-complete"
+	DownloadsWIP  = "downloads-incomplete"
+	Books         = "books"
+)
+
+// Location is one directory under the data root
+type Location struct {
+	Key         string
+	Rel         string // Relative to the data root, slash-separated
+	Service     string // Which service owns it (e.g., "immich", "databases")
+	Description string
+}
+
+// Registry lists every data location, parents before children
+var Registry = []Location{
+	{Root, ".", "core", "Root data directory for all services"},
+
+	// Immich mounts gallery/ as its upload location and creates the
+	// subdirectories inside it
+	{Gallery, "gallery", "immich", "Immich photo gallery root"},
+	{GalleryLibrary, "gallery/library", "immich", "Immich photo library storage"},
+	{GalleryUpload, "gallery/upload", "immich", "Immich upload staging area"},
+	{GalleryProfile, "gallery/profile", "immich", "Immich user profiles"},
+	{GalleryThumbs, "gallery/thumbs", "immich", "Immich thumbnail cache"},
+	{GalleryVideo, "gallery/encoded-video", "immich", "Immich video transcodes"},
+
+	{Cloud, "cloud", "nextcloud", "Nextcloud root directory"},
+	{CloudData, "cloud/data", "nextcloud", "Nextcloud user data storage"},
+	{CloudConfig, "cloud/config", "nextcloud", "Nextcloud configuration"},
+	// Written by the calendar and contacts export, never mounted
+	{CloudExport, "cloud/export", "nextcloud", "Calendars (.ics) and contacts (.vcf) exported nightly"},
+
+	// Databases are isolated per service
+	{Databases, "databases", "databases", "Database storage root"},
+	{ImmichDB, "databases/immich-postgres", "databases", "Immich PostgreSQL data"},
+	{NextcloudDB, "databases/nextcloud-mariadb", "databases", "Nextcloud MariaDB data"},
+	{AuthentikDB, "databases/authentik-postgres", "authentik", "Authentik PostgreSQL data"},
+	{Cache, "cache", "databases", "Redis/Valkey cache storage"},
+
+	{Authentik, "authentik", "authentik", "Authentik root directory"},
+	{AuthentikMedia, "authentik/media", "authentik", "Authentik uploaded icons and media"},
+
+	{Logs, "logs", "logging", "Shipped container logs root"},
+	{Loki, "logs/loki", "logging", "Loki log storage, pruned after the retention period"},
+
+	// Optional layouts
+	{Media, "media", "media", "Media library root"},
+	{MediaMovies, "media/movies", "media", "Movie library"},
+	{MediaTV, "media/tv", "media", "TV show library"},
+	{MediaMusic, "media/music", "media", "Music library"},
+	{Downloads, "downloads", "downloads", "Downloads root"},
+	{DownloadsDone, "downloads/complete", "downloads", "Finished downloads, ready to import"},
+	{DownloadsWIP, "downloads/incomplete", "downloads", "Downloads in progress"},
+	{Books, "books", "books", "Book library"},
+}
+
+// Hot are the databases and caches that speed-tiered setups place on fast
+// storage, symlinked from their registered location
+var Hot = []string{ImmichDB, NextcloudDB, AuthentikDB, Cache}
+
+// IsHot reports whether key is one of the Hot locations
+func IsHot(key string) bool {
+	for _, k := range Hot {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// Lookup returns the location registered under key
+func Lookup(key string) (Location, bool) {
+	for _, loc := range Registry {
+		if loc.Key == key {
+			return loc, true
+		}
+	}
+	return Location{}, false
+}
+
+// Rel returns the registered relative path for key. An unknown key is a
+// programming error and panics, so a typo can never produce a stray mount.
+func Rel(key string) string {
+	loc, ok := Lookup(key)
+	if !ok {
+		panic("paths: unknown key " + key)
+	}
+	return loc.Rel
+}
+
+// Join returns the absolute path of key under dataRoot
+func Join(dataRoot, key string) string {
+	return filepath.Join(dataRoot, filepath.FromSlash(Rel(key)))
+}
+
+// ForService returns the locations owned by service, in registry order
+func ForService(service string) []Location {
+	var locs []Location
+	for _, loc := range Registry {
+		if loc.Service == service {
+			locs = append(locs, loc)
+		}
+	}
+	return locs
+}
+
+// WithParents returns keys plus every registered ancestor of them, in
+// registry order and without duplicates
+func WithParents(keys []string) []string {
+	wanted := make(map[string]bool)
+	for _, key := range keys {
+		for rel := Rel(key); ; rel = path.Dir(rel) {
+			for _, loc := range Registry {
+				if loc.Rel == rel {
+					wanted[loc.Key] = true
+				}
+			}
+			if rel == "." {
+				break
+			}
+		}
+	}
+
+	var out []string
+	for _, loc := range Registry {
+		if wanted[loc.Key] {
+			out = append(out, loc.Key)
+		}
+	}
+	return out
+}
+
+// Anchored returns key as an rsync pattern anchored to the data root,
+// matching the directory only (e.g., "/gallery/thumbs/")
+func Anchored(key string) string {
+	return "/" + strings.TrimSuffix(Rel(key), "/") + "/"
+}
+
+// Separable are the services whose data can live under a root of its own
+// instead of the data root, e.g. photos on the big HDD and Nextcloud files
+// on the SSD. Databases and caches have speed tiering for that instead.
+var Separable = []string{"immich", "nextcloud", "media", "downloads", "books"}
+
+// Roots maps a Separable service to the root its locations live under;
+// services without an entry use the data root. Under its own root a
+// location keeps its relative path, so gallery/library stays
+// gallery/library and backups restore it to the same place.
+type Roots map[string]string
+
+// Root returns the root of service's locations
+func (r Roots) Root(service, dataRoot string) string {
+	if root := r[service]; root != "" {
+		return root
+	}
+	return dataRoot
+}
+
+// Join returns the absolute path of key under its service's root
+func (r Roots) Join(dataRoot, key string) string {
+	loc, ok := Lookup(key)
+	if !ok {
+		panic("paths: unknown key " + key)
+	}
+	return Join(r.Root(loc.Service, dataRoot), key)
+}
+
+// TopDirs returns, for each service with a root of its own, its top-level
+// directories ("gallery" for immich) mapped to that root
+func (r Roots) TopDirs() map[string]string {
+	tops := make(map[string]string)
+	for _, loc := range Registry {
+		if root := r[loc.Service]; root != "" && loc.Rel != "." && !strings.Contains(loc.Rel, "/") {
+			tops[loc.Rel] = root
+		}
+	}
+	return tops
+}
@@ -0,0 +1,78 @@
+package paths
+
+import (
+	"path"
+	"testing"
+)
+
+func TestRegistry_Consistent(t *testing.T) {
+	keys := make(map[string]bool)
+	rels := make(map[string]bool)
+	for _, loc := range Registry {
+		if keys[loc.Key] {
+			t.Errorf("duplicate key %s", loc.Key)
+		}
+		if rels[loc.Rel] {
+			t.Errorf("duplicate path %s", loc.Rel)
+		}
+		if parent := path.Dir(loc.Rel); loc.Rel != "." && !rels[parent] {
+			t.Errorf("%s is registered before its parent %s", loc.Rel, parent)
+		}
+		keys[loc.Key] = true
+		rels[loc.Rel] = true
+	}
+}
+
+func TestJoin(t *testing.T) {
+	if got := Join("/mnt/data", ImmichDB); got != "/mnt/data/databases/immich-postgres" {
+		t.Errorf("Join(ImmichDB) = %s", got)
+	}
+	if got := Join("/mnt/data", Root); got != "/mnt/data" {
+		t.Errorf("Join(Root) = %s", got)
+	}
+}
+
+func TestRel_UnknownKeyPanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Rel with an unknown key should panic")
+		}
+	}()
+	Rel("no-such-key")
+}
+
+func TestWithParents(t *testing.T) {
+	got := WithParents([]string{AuthentikMedia, ImmichDB})
+	want := []string{Root, Databases, ImmichDB, Authentik, AuthentikMedia}
+	if len(got) != len(want) {
+		t.Fatalf("WithParents = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("WithParents = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestAnchored(t *testing.T) {
+	if got := Anchored(GalleryThumbs); got != "/gallery/thumbs/" {
+		t.Errorf("Anchored(GalleryThumbs) = %s, want /gallery/thumbs/", got)
+	}
+}
+
+func TestRoots(t *testing.T) {
+	roots := Roots{"nextcloud": "/mnt/ssd"}
+	if got := roots.Join("/mnt/data", CloudData); got != "/mnt/ssd/cloud/data" {
+		t.Errorf("Join(CloudData) = %s", got)
+	}
+	if got := roots.Join("/mnt/data", GalleryLibrary); got != "/mnt/data/gallery/library" {
+		t.Errorf("Join(GalleryLibrary) = %s", got)
+	}
+	if got := Roots(nil).Join("/mnt/data", CloudData); got != "/mnt/data/cloud/data" {
+		t.Errorf("nil Roots should use the data root, got %s", got)
+	}
+	tops := roots.TopDirs()
+	if len(tops) != 1 || tops["cloud"] != "/mnt/ssd" {
+		t.Errorf("TopDirs = %v", tops)
+	}
+}
@@ -0,0 +1,256 @@
+package pkgmgr
+
+import (
+	"bufio"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Apt drives apt-get with APT::Status-Fd so progress arrives as
+// machine-readable "dlstatus:" and "pmstatus:" lines on stdout
+type Apt struct {
+	Retries    int           // Extra attempts after a transient failure
+	RetryDelay time.Duration // Base delay, multiplied by the attempt number
+	Sudo       bool          // Prefix commands with sudo
+
+	// command builds the process to run; replaced in tests
+	command func(name string, args ...string) *exec.Cmd
+}
+
+// NewApt returns an apt-get manager that retries transient failures
+func NewApt() *Apt {
+	return &Apt{
+		Retries:    3,
+		RetryDelay: 10 * time.Second,
+		Sudo:       os.Geteuid() != 0,
+		command:    exec.Command,
+	}
+}
+
+// transientPatterns mark failures worth retrying: mirror and network
+// hiccups, and the dpkg lock held by unattended-upgrades
+var transientPatterns = []string{
+	"Temporary failure resolving",
+	"Could not resolve",
+	"Could not connect",
+	"Connection timed out",
+	"Connection failed",
+	"Failed to fetch",
+	"Hash Sum mismatch",
+	"Mirror sync in progress",
+	"Could not get lock",
+	"Unable to acquire the dpkg frontend lock",
+}
+
+var (
+	retrievingRegex = regexp.MustCompile(`Retrieving file (\d+) of (\d+)`)
+	needToGetRegex  = regexp.MustCompile(`^Need to get ([\d.,]+) ([kMG]?B)`)
+	summaryRegex    = regexp.MustCompile(`^(\d+) upgraded, (\d+) newly installed`)
+	fetchLineRegex  = regexp.MustCompile(`^(Get|Hit|Ign):\d+ (\S+) (\S+)`)
+)
+
+// isTransient reports whether output shows a failure worth retrying
+func isTransient(lines []string) bool {
+	for _, line := range lines {
+		for _, pattern := range transientPatterns {
+			if strings.Contains(line, pattern) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// parseSize converts apt's "12.3 MB" (SI units) to bytes
+func parseSize(value, unit string) uint64 {
+	n, err := strconv.ParseFloat(strings.ReplaceAll(value, ",", ""), 64)
+	if err != nil {
+		return 0
+	}
+	switch unit {
+	case "kB":
+		n *= 1e3
+	case "MB":
+		n *= 1e6
+	case "GB":
+		n *= 1e9
+	}
+	return uint64(n)
+}
+
+// parseLine updates p from one line of apt-get output and reports whether
+// the line carried progress worth showing
+func parseLine(line string, p *Progress) bool {
+	switch {
+	case strings.HasPrefix(line, "dlstatus:"):
+		fields := strings.SplitN(line, ":", 4)
+		if len(fields) < 4 {
+			return false
+		}
+		p.Phase = PhaseDownload
+		p.Percent, _ = strconv.ParseFloat(fields[2], 64)
+		p.Message = fields[3]
+		if m := retrievingRegex.FindStringSubmatch(fields[3]); m != nil {
+			p.Current, _ = strconv.Atoi(m[1])
+			p.Total, _ = strconv.Atoi(m[2])
+		}
+		return true
+
+	case strings.HasPrefix(line, "pmstatus:"):
+		fields := strings.SplitN(line, ":", 4)
+		if len(fields) < 4 {
+			return false
+		}
+		p.Phase = PhaseInstall
+		p.Item = fields[1]
+		p.Percent, _ = strconv.ParseFloat(fields[2], 64)
+		p.Message = fields[3]
+		return true
+
+	case needToGetRegex.MatchString(line):
+		m := needToGetRegex.FindStringSubmatch(line)
+		p.Bytes = parseSize(m[1], m[2])
+		return true
+
+	case summaryRegex.MatchString(line):
+		m := summaryRegex.FindStringSubmatch(line)
+		p.Upgraded, _ = strconv.Atoi(m[1])
+		p.Installed, _ = strconv.Atoi(m[2])
+		return true
+
+	case fetchLineRegex.MatchString(line):
+		m := fetchLineRegex.FindStringSubmatch(line)
+		if p.Phase == "" {
+			p.Phase = PhaseUpdate
+		}
+		p.Item = m[2] + " " + m[3]
+		p.Message = line
+		return true
+	}
+	return false
+}
+
+// runOnce runs apt-get a single time, streaming progress, and returns its output lines
+func (a *Apt) runOnce(args []string, p *Progress, progress ProgressFunc) ([]string, error) {
+	name := "apt-get"
+	if a.Sudo {
+		args = append([]string{"DEBIAN_FRONTEND=noninteractive", "LC_ALL=C", "apt-get"}, args...)
+		name = "sudo"
+	}
+	cmd := a.command(name, args...)
+	cmd.Env = append(os.Environ(), "DEBIAN_FRONTEND=noninteractive", "LC_ALL=C")
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stderr = cmd.Stdout
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	var lines []string
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		line := scanner.Text()
+		lines = append(lines, line)
+		if parseLine(line, p) && progress != nil {
+			progress(*p)
+		}
+	}
+
+	return lines, cmd.Wait()
+}
+
+// run executes apt-get with retries on transient failures
+func (a *Apt) run(op string, phase Phase, args []string, progress ProgressFunc) (*Result, error) {
+	start := time.Now()
+	args = append([]string{"-o", "APT::Status-Fd=1", "-o", "Dpkg::Use-Pty=0"}, args...)
+
+	var p Progress
+	var lines []string
+	var err error
+	for attempt := 1; ; attempt++ {
+		p = Progress{Phase: phase, Attempt: attempt}
+		lines, err = a.runOnce(args, &p, progress)
+		if err == nil {
+			observe(op, start, nil)
+			if progress != nil {
+				progress(Progress{Phase: PhaseDone, Percent: 100, Attempt: attempt,
+					Bytes: p.Bytes, Upgraded: p.Upgraded, Installed: p.Installed})
+			}
+			return &Result{
+				Upgraded:  p.Upgraded,
+				Installed: p.Installed,
+				Bytes:     p.Bytes,
+				Attempts:  attempt,
+				Duration:  time.Since(start),
+			}, nil
+		}
+
+		if attempt > a.Retries || !isTransient(lines) {
+			err = &Error{Op: op, Attempts: attempt, Output: tail(lines, 5), Err: err}
+			observe(op, start, err)
+			return nil, err
+		}
+
+		delay := a.RetryDelay * time.Duration(attempt)
+		if progress != nil {
+			progress(Progress{Phase: PhaseRetry, Attempt: attempt,
+				Message: "transient failure, retrying in " + delay.String()})
+		}
+		time.Sleep(delay)
+	}
+}
+
+// Update runs apt-get update
+func (a *Apt) Update(progress ProgressFunc) (*Result, error) {
+	return a.run("apt-get update", PhaseUpdate, []string{"update"}, progress)
+}
+
+// Upgrade runs apt-get upgrade, or only simulates it
+func (a *Apt) Upgrade(simulate bool, progress ProgressFunc) (*Result, error) {
+	if simulate {
+		return a.run("apt-get upgrade", PhaseDownload, []string{"-s", "upgrade"}, progress)
+	}
+	return a.run("apt-get upgrade", PhaseDownload, []string{"-y", "upgrade"}, progress)
+}
+
+// Install runs apt-get install for packages or local .deb paths
+func (a *Apt) Install(packages []string, progress ProgressFunc) (*Result, error) {
+	args := append([]string{"-y", "install"}, packages...)
+	return a.run("apt-get install "+strings.Join(packages, " "), PhaseDownload, args, progress)
+}
+
+// parseVersions reads dpkg-query "name\tversion\tstatus" lines, keeping
+// only packages that are fully installed
+func parseVersions(output string) map[string]string {
+	versions := make(map[string]string)
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) != 3 || fields[2] != "installed" || fields[1] == "" {
+			continue
+		}
+		versions[fields[0]] = fields[1]
+	}
+	return versions
+}
+
+// Versions returns installed versions using dpkg-query. Packages that are
+// not installed are left out rather than reported as errors.
+func (a *Apt) Versions(packages []string) (map[string]string, error) {
+	args := append([]string{"-W", "-f=${Package}\t${Version}\t${db:Status-Status}\n"}, packages...)
+	// dpkg-query exits 1 when any package is unknown but still prints the rest
+	output, err := a.command("dpkg-query", args...).Output()
+	if err != nil && len(output) == 0 {
+		if _, ok := err.(*exec.ExitError); !ok {
+			return nil, err
+		}
+	}
+	return parseVersions(string(output)), nil
+}
@@ -0,0 +1,153 @@
+package pkgmgr
+
+import (
+	"errors"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// fakeApt returns an Apt whose commands run script with sh instead of apt-get
+func fakeApt(script string) *Apt {
+	return &Apt{
+		Retries: 2,
+		command: func(name string, args ...string) *exec.Cmd {
+			return exec.Command("sh", "-c", script)
+		},
+	}
+}
+
+func TestParseLine(t *testing.T) {
+	var p Progress
+
+	if !parseLine("dlstatus:3:42.5:Retrieving file 3 of 7", &p) {
+		t.Fatal("dlstatus line not parsed")
+	}
+	if p.Phase != PhaseDownload || p.Current != 3 || p.Total != 7 || p.Percent != 42.5 {
+		t.Errorf("dlstatus progress = %+v", p)
+	}
+
+	if !parseLine("pmstatus:smartmontools:60.0:Configuring smartmontools (amd64)", &p) {
+		t.Fatal("pmstatus line not parsed")
+	}
+	if p.Phase != PhaseInstall || p.Item != "smartmontools" || p.Percent != 60 {
+		t.Errorf("pmstatus progress = %+v", p)
+	}
+
+	parseLine("Need to get 12.5 MB of archives.", &p)
+	if p.Bytes != 12500000 {
+		t.Errorf("Bytes = %d, want 12500000", p.Bytes)
+	}
+
+	parseLine("Need to get 1,024 kB/2,048 kB of archives.", &p)
+	if p.Bytes != 1024000 {
+		t.Errorf("Bytes = %d, want 1024000", p.Bytes)
+	}
+
+	parseLine("3 upgraded, 2 newly installed, 0 to remove and 1 not upgraded.", &p)
+	if p.Upgraded != 3 || p.Installed != 2 {
+		t.Errorf("summary = %d upgraded, %d installed", p.Upgraded, p.Installed)
+	}
+
+	if parseLine("Reading package lists...", &p) {
+		t.Error("plain output should not produce progress")
+	}
+}
+
+func TestParseVersions(t *testing.T) {
+	output := "curl\t8.5.0-2ubuntu10\tinstalled\nufw\t0.36.2-6\tconfig-files\ndocker-ce\t5:27.1.1-1~ubuntu.24.04~noble\tinstalled\n"
+
+	versions := parseVersions(output)
+	if len(versions) != 2 {
+		t.Fatalf("parseVersions() = %v, want 2 entries", versions)
+	}
+	if versions["docker-ce"] != "5:27.1.1-1~ubuntu.24.04~noble" {
+		t.Errorf("docker-ce = %q", versions["docker-ce"])
+	}
+	if _, ok := versions["ufw"]; ok {
+		t.Error("removed packages should be skipped")
+	}
+}
+
+func TestIsTransient(t *testing.T) {
+	if !isTransient([]string{"E: Failed to fetch http://archive.ubuntu.com/... Temporary failure resolving 'archive.ubuntu.com'"}) {
+		t.Error("DNS failure should be transient")
+	}
+	if isTransient([]string{"E: Unable to locate package nosuchpkg"}) {
+		t.Error("missing package should not be transient")
+	}
+}
+
+func TestApt_InstallProgress(t *testing.T) {
+	apt := fakeApt(`echo "Need to get 2 MB of archives."
+echo "0 upgraded, 1 newly installed, 0 to remove and 0 not upgraded."
+echo "dlstatus:1:50.0:Retrieving file 1 of 1"
+echo "pmstatus:hdparm:100.0:Installed hdparm"`)
+
+	var updates []Progress
+	result, err := apt.Install([]string{"hdparm"}, func(p Progress) { updates = append(updates, p) })
+	if err != nil {
+		t.Fatalf("Install() error: %v", err)
+	}
+	if result.Installed != 1 || result.Bytes != 2000000 || result.Attempts != 1 {
+		t.Errorf("Result = %+v", result)
+	}
+	if len(updates) != 5 || updates[len(updates)-1].Phase != PhaseDone {
+		t.Errorf("got %d updates ending in %v, want 5 ending in done", len(updates), updates[len(updates)-1].Phase)
+	}
+}
+
+func TestApt_RetriesTransientFailures(t *testing.T) {
+	marker := filepath.Join(t.TempDir(), "attempted")
+	apt := fakeApt(`if [ ! -f ` + marker + ` ]; then
+  touch ` + marker + `
+  echo "E: Failed to fetch http://mirror/x  Temporary failure resolving 'mirror'"
+  exit 100
+fi
+echo "Reading package lists..."`)
+
+	result, err := apt.Update(nil)
+	if err != nil {
+		t.Fatalf("Update() error: %v", err)
+	}
+	if result.Attempts != 2 {
+		t.Errorf("Attempts = %d, want 2", result.Attempts)
+	}
+}
+
+func TestApt_PermanentFailure(t *testing.T) {
+	apt := fakeApt(`echo "E: Unable to locate package nosuchpkg"; exit 100`)
+
+	_, err := apt.Install([]string{"nosuchpkg"}, nil)
+	var pkgErr *Error
+	if !errors.As(err, &pkgErr) {
+		t.Fatalf("Install() error = %v, want *Error", err)
+	}
+	if pkgErr.Attempts != 1 {
+		t.Errorf("Attempts = %d, want 1 (no retry for permanent errors)", pkgErr.Attempts)
+	}
+	if pkgErr.Output != "E: Unable to locate package nosuchpkg" {
+		t.Errorf("Output = %q", pkgErr.Output)
+	}
+}
+
+func TestApt_Observe(t *testing.T) {
+	type call struct {
+		op     string
+		failed bool
+	}
+	var calls []call
+	Observe = func(op string, started time.Time, err error) {
+		calls = append(calls, call{op, err != nil})
+	}
+	defer func() { Observe = nil }()
+
+	fakeApt(`echo "Reading package lists..."`).Update(nil)
+	fakeApt(`echo "E: Unable to locate package nosuchpkg"; exit 100`).Install([]string{"nosuchpkg"}, nil)
+
+	want := []call{{"apt-get update", false}, {"apt-get install nosuchpkg", true}}
+	if len(calls) != len(want) || calls[0] != want[0] || calls[1] != want[1] {
+		t.Errorf("observed %v, want %v", calls, want)
+	}
+}
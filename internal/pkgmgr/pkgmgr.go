@@ -0,0 +1,106 @@
+// Package pkgmgr wraps the system package manager. Operations stream
+// structured progress instead of raw output, retry transient mirror
+// failures, and report the versions they installed.
+package pkgmgr
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Phase identifies what the package manager is doing
+type Phase string
+
+const (
+	PhaseUpdate   Phase = "update"   // Refreshing package lists
+	PhaseDownload Phase = "download" // Fetching archives
+	PhaseInstall  Phase = "install"  // Unpacking and configuring
+	PhaseRetry    Phase = "retry"    // Waiting before another attempt
+	PhaseDone     Phase = "done"
+)
+
+// Progress is one progress update from a package operation
+type Progress struct {
+	Phase     Phase
+	Percent   float64 // 0-100 for the current phase
+	Item      string  // Current package or file
+	Current   int     // Current item number (when known)
+	Total     int     // Total items (when known)
+	Bytes     uint64  // Total download size (when known)
+	Attempt   int     // Attempt number, starting at 1
+	Message   string  // Human-readable status from the package manager
+	Upgraded  int     // Packages to upgrade (from the summary line)
+	Installed int     // Packages to newly install (from the summary line)
+}
+
+// ProgressFunc receives progress updates; it may be nil
+type ProgressFunc func(Progress)
+
+// Result summarizes a completed operation
+type Result struct {
+	Upgraded  int
+	Installed int
+	Bytes     uint64
+	Attempts  int
+	Duration  time.Duration
+}
+
+// Manager is a system package manager
+type Manager interface {
+	// Update refreshes package lists
+	Update(progress ProgressFunc) (*Result, error)
+	// Upgrade upgrades installed packages; simulate only reports what would change
+	Upgrade(simulate bool, progress ProgressFunc) (*Result, error)
+	// Install installs packages by name or from local .deb paths
+	Install(packages []string, progress ProgressFunc) (*Result, error)
+	// Versions returns the installed version of each package that is installed
+	Versions(packages []string) (map[string]string, error)
+}
+
+// Observe, when set, is told about every operation once it has finished
+// (after any retries), for timing them
+var Observe func(op string, started time.Time, err error)
+
+// observe reports a finished operation to Observe
+func observe(op string, started time.Time, err error) {
+	if Observe != nil {
+		Observe(op, started, err)
+	}
+}
+
+// Default returns the package manager for this system
+func Default() Manager {
+	return NewApt()
+}
+
+// Error is returned when a package operation fails after all retries
+type Error struct {
+	Op       string
+	Attempts int
+	Output   string // Last lines of output, for diagnosis
+	Err      error
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("%s failed after %d attempt(s): %v", e.Op, e.Attempts, e.Err)
+	if e.Output != "" {
+		msg += "\n" + e.Output
+	}
+	return msg
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// tail returns the last n non-empty lines of output
+func tail(lines []string, n int) string {
+	var kept []string
+	for i := len(lines) - 1; i >= 0 && len(kept) < n; i-- {
+		if strings.TrimSpace(lines[i]) != "" {
+			kept = append([]string{lines[i]}, kept...)
+		}
+	}
+	return strings.Join(kept, "\n")
+}
@@ -0,0 +1,173 @@
+package preflight
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/madhav/servctl/internal/ops"
+	"github.com/madhav/servctl/templates"
+)
+
+// LimitsDropIn is the PAM limits file servctl owns
+const LimitsDropIn = "/etc/security/limits.d/90-servctl.conf"
+
+// Open file limits servctl asks for. The soft limit is what processes get;
+// Syncthing and the databases want tens of thousands of descriptors, while
+// the usual default is 1024.
+const (
+	MinOpenFiles  = 65536
+	HardOpenFiles = 524288
+)
+
+// GenerateLimitsConf renders the limits drop-in, which raises the open
+// file limit for every login session
+func GenerateLimitsConf() string {
+	return templates.MustRender("system/limits.conf.tmpl", struct{ Soft, Hard int }{MinOpenFiles, HardOpenFiles}, nil)
+}
+
+// openFileLimit returns the soft and hard RLIMIT_NOFILE; tests replace it
+var openFileLimit = getOpenFileLimit
+
+// inotifySettings are the file watch limits from TunedSysctls
+func inotifySettings() []SysctlSetting {
+	var settings []SysctlSetting
+	for _, s := range TunedSysctls() {
+		if strings.HasPrefix(s.Key, "fs.inotify.") {
+			settings = append(settings, s)
+		}
+	}
+	return settings
+}
+
+// CheckInotifyLimits warns when the kernel limits the number of watched
+// folders below what Nextcloud desktop sync and Syncthing need. At the
+// default limits they stop noticing changes without reporting an error.
+func CheckInotifyLimits() CheckResult {
+	result := CheckResult{Name: "File Watch Limits"}
+
+	low := PlanSysctl(inotifySettings())
+	for _, s := range inotifySettings() {
+		if current, err := ReadSysctl(s.Key); err == nil {
+			result.Details = append(result.Details, fmt.Sprintf("%s = %s", s.Key, current))
+		}
+	}
+	if len(result.Details) == 0 {
+		result.Status = StatusSkip
+		result.Message = "inotify limits not readable"
+		return result
+	}
+	if len(low) > 0 {
+		result.Status = StatusWarn
+		result.Message = fmt.Sprintf("%s is %s, below %s: sync clients will silently miss changes", low[0].Key, low[0].Current, low[0].Value)
+		result.Details = append(result.Details, "Fix: setup writes "+SysctlDropIn)
+		return result
+	}
+	result.Status = StatusPass
+	result.Message = "inotify limits are high enough for sync clients"
+	return result
+}
+
+// CheckOpenFileLimit warns when the open file limit (ulimit -n) is below
+// MinOpenFiles
+func CheckOpenFileLimit() CheckResult {
+	result := CheckResult{Name: "Open File Limit"}
+
+	soft, hard, err := openFileLimit()
+	if err != nil {
+		result.Status = StatusSkip
+		result.Message = "Could not read the open file limit"
+		result.Details = append(result.Details, err.Error())
+		return result
+	}
+	result.Details = append(result.Details, fmt.Sprintf("soft %s, hard %s", quoteLimit(soft), quoteLimit(hard)))
+	if soft < MinOpenFiles {
+		result.Status = StatusWarn
+		result.Message = fmt.Sprintf("ulimit -n is %d, below %d: Syncthing and databases can run out of file descriptors", soft, MinOpenFiles)
+		result.Details = append(result.Details, "Fix: setup writes "+LimitsDropIn)
+		return result
+	}
+	result.Status = StatusPass
+	result.Message = "ulimit -n is " + quoteLimit(soft)
+	return result
+}
+
+// FixInotifyLimits raises the inotify limits through the sysctl drop-in
+func FixInotifyLimits(dryRun bool) error {
+	_, err := ApplySysctl(PlanSysctl(inotifySettings()), dryRun)
+	return err
+}
+
+// FixOpenFileLimit writes the limits drop-in. Running processes keep their
+// limit; new login sessions get the raised one.
+func FixOpenFileLimit(dryRun bool) error {
+	content := GenerateLimitsConf()
+	if existing, err := os.ReadFile(LimitsDropIn); err == nil && string(existing) == content {
+		return nil
+	}
+	return ops.Execute(dryRun, ops.WriteFile{Path: LimitsDropIn, Content: []byte(content), Mode: 0644, Sudo: true})
+}
+
+// SysctlDropInPrevious returns the values the drop-in replaced, from its
+// "(was ...)" comments, so settings written by the preflight auto-fix are
+// recorded in the state file too
+func SysctlDropInPrevious() map[string]string {
+	data, err := os.ReadFile(SysctlDropIn)
+	if err != nil {
+		return nil
+	}
+	return parseSysctlPrevious(string(data))
+}
+
+// parseSysctlPrevious pairs each "# ... (was X)" comment with the setting
+// on the line after it
+func parseSysctlPrevious(content string) map[string]string {
+	previous := make(map[string]string)
+	was, pending := "", false
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "#") {
+			if i := strings.LastIndex(line, "(was "); i >= 0 && strings.HasSuffix(line, ")") {
+				was, pending = line[i+len("(was "):len(line)-1], true
+			}
+			continue
+		}
+		if key, _, ok := strings.Cut(line, "="); ok && pending {
+			previous[strings.TrimSpace(key)] = was
+		}
+		pending = false
+	}
+	return previous
+}
+
+// limitsFix returns the auto-fix for a limits check, nil for other checks
+func limitsFix(name string) func(bool) error {
+	switch name {
+	case "File Watch Limits":
+		return FixInotifyLimits
+	case "Open File Limit":
+		return FixOpenFileLimit
+	}
+	return nil
+}
+
+// limitsFixed is a limits check's result after its auto-fix. The kernel
+// limits apply at once; the open file limit only for new logins, so this
+// process still sees the old one.
+func limitsFixed(r CheckResult) CheckResult {
+	if r.Name == "File Watch Limits" {
+		return CheckInotifyLimits()
+	}
+	r.Status = StatusPass
+	r.Message = fmt.Sprintf("ulimit -n raised to %d from the next login (%s)", MinOpenFiles, LimitsDropIn)
+	return r
+}
+
+// quoteLimit formats a limit for messages, "unlimited" for RLIM_INFINITY
+func quoteLimit(n uint64) string {
+	if n == ^uint64(0) {
+		return "unlimited"
+	}
+	return strconv.FormatUint(n, 10)
+}
@@ -0,0 +1,87 @@
+package preflight
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckInotifyLimits(t *testing.T) {
+	fakeProcSys(t, map[string]string{
+		"fs.inotify.max_user_watches":   "8192",
+		"fs.inotify.max_user_instances": "1024",
+	})
+	result := CheckInotifyLimits()
+	if result.Status != StatusWarn {
+		t.Fatalf("Status = %v, want WARN: %s", result.Status, result.Message)
+	}
+	if !strings.Contains(result.Message, "max_user_watches is 8192") {
+		t.Errorf("Message = %q, want the low limit named", result.Message)
+	}
+
+	fakeProcSys(t, map[string]string{
+		"fs.inotify.max_user_watches":   "1048576",
+		"fs.inotify.max_user_instances": "512",
+	})
+	if result := CheckInotifyLimits(); result.Status != StatusPass {
+		t.Errorf("Status = %v, want PASS: %s", result.Status, result.Message)
+	}
+
+	fakeProcSys(t, nil)
+	if result := CheckInotifyLimits(); result.Status != StatusSkip {
+		t.Errorf("Status without inotify = %v, want SKIP", result.Status)
+	}
+}
+
+func TestCheckOpenFileLimit(t *testing.T) {
+	old := openFileLimit
+	defer func() { openFileLimit = old }()
+
+	tests := []struct {
+		soft, hard uint64
+		want       Status
+	}{
+		{1024, 524288, StatusWarn},
+		{65536, 524288, StatusPass},
+		{^uint64(0), ^uint64(0), StatusPass},
+	}
+	for _, tt := range tests {
+		openFileLimit = func() (uint64, uint64, error) { return tt.soft, tt.hard, nil }
+		if got := CheckOpenFileLimit(); got.Status != tt.want {
+			t.Errorf("soft %d: Status = %v, want %v (%s)", tt.soft, got.Status, tt.want, got.Message)
+		}
+	}
+}
+
+func TestGenerateLimitsConf(t *testing.T) {
+	conf := GenerateLimitsConf()
+	for _, want := range []string{"*    soft nofile 65536\n", "*    hard nofile 524288\n", "root soft nofile 65536\n", "root hard nofile 524288\n"} {
+		if !strings.Contains(conf, want) {
+			t.Errorf("limits drop-in missing %q:\n%s", want, conf)
+		}
+	}
+	if !strings.HasPrefix(conf, "# Generated by servctl") {
+		t.Errorf("limits drop-in should start with the servctl header:\n%s", conf)
+	}
+}
+
+func TestParseSysctlPrevious(t *testing.T) {
+	content := GenerateSysctlDropIn([]SysctlChange{
+		{SysctlSetting: SysctlSetting{Key: "fs.inotify.max_user_watches", Value: "524288", Reason: "Sync clients"}, Current: "8192"},
+	})
+	// A later run updates the value but keeps the first run's comment
+	content = mergeSysctlDropIn(content, []SysctlChange{
+		{SysctlSetting: SysctlSetting{Key: "fs.inotify.max_user_watches", Value: "1048576"}, Current: "524288"},
+		{SysctlSetting: SysctlSetting{Key: "vm.swappiness", Value: "10", Reason: "Caches"}, Current: "60"},
+	})
+
+	previous := parseSysctlPrevious(content)
+	if previous["fs.inotify.max_user_watches"] != "8192" {
+		t.Errorf("watches was %q, want 8192", previous["fs.inotify.max_user_watches"])
+	}
+	if previous["vm.swappiness"] != "60" {
+		t.Errorf("swappiness was %q, want 60", previous["vm.swappiness"])
+	}
+	if len(previous) != 2 {
+		t.Errorf("parseSysctlPrevious() = %v, want 2 entries", previous)
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !windows
+
+package preflight
+
+import "syscall"
+
+func getOpenFileLimit() (uint64, uint64, error) {
+	var rlim syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rlim); err != nil {
+		return 0, 0, err
+	}
+	return uint64(rlim.Cur), uint64(rlim.Max), nil
+}
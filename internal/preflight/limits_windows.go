@@ -0,0 +1,9 @@
+package preflight
+
+import "errors"
+
+// getOpenFileLimit has nothing to read on Windows, which has no RLIMIT_NOFILE;
+// the check is skipped there
+func getOpenFileLimit() (uint64, uint64, error) {
+	return 0, 0, errors.New("open file limits are a Linux setting")
+}
@@ -0,0 +1,452 @@
+package preflight
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/madhav/servctl/internal/ops"
+	"github.com/madhav/servctl/internal/utils"
+)
+
+// MirrorList is apt's mirror method: apt fetches the list of mirrors near
+// the server (by GeoIP) and moves on to the next one when a mirror fails
+const MirrorList = "mirror://mirrors.ubuntu.com/mirrors.txt"
+
+// Where apt's sources are read; tests point these at testdata
+var (
+	aptSourcesList = "/etc/apt/sources.list"
+	aptSourcesDir  = "/etc/apt/sources.list.d"
+)
+
+// Mirror thresholds: above the latency or below the throughput a full
+// upgrade takes many minutes longer than it should
+const (
+	mirrorSlowLatency    = 2 * time.Second
+	mirrorSlowThroughput = 250e3 // Bytes per second
+	mirrorProbeTimeout   = 10 * time.Second
+	mirrorCacheTTL       = 6 * time.Hour
+)
+
+// aptSource is one deb entry from sources.list or a deb822 .sources file
+type aptSource struct {
+	File       string
+	URI        string
+	Suites     []string
+	Components []string
+}
+
+// parseSourcesList reads one-line-style entries: "deb [options] URI suite components..."
+func parseSourcesList(file, content string) []aptSource {
+	var sources []aptSource
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = strings.TrimSpace(line[:i])
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 3 || fields[0] != "deb" {
+			continue
+		}
+		fields = fields[1:]
+		if strings.HasPrefix(fields[0], "[") {
+			for len(fields) > 0 && !strings.HasSuffix(fields[0], "]") {
+				fields = fields[1:]
+			}
+			if len(fields) > 0 {
+				fields = fields[1:]
+			}
+		}
+		if len(fields) < 2 {
+			continue
+		}
+		sources = append(sources, aptSource{File: file, URI: fields[0], Suites: fields[1:2], Components: fields[2:]})
+	}
+	return sources
+}
+
+// parseDeb822Sources reads deb822-style stanzas (Ubuntu 24.04's ubuntu.sources)
+func parseDeb822Sources(file, content string) []aptSource {
+	var sources []aptSource
+	for _, stanza := range strings.Split(content, "\n\n") {
+		fields := make(map[string]string)
+		for _, line := range strings.Split(stanza, "\n") {
+			if strings.HasPrefix(strings.TrimSpace(line), "#") {
+				continue
+			}
+			if key, value, ok := strings.Cut(line, ":"); ok && !strings.HasPrefix(line, " ") {
+				fields[strings.ToLower(strings.TrimSpace(key))] = strings.TrimSpace(value)
+			}
+		}
+		if !strings.Contains(" "+fields["types"]+" ", " deb ") || strings.EqualFold(fields["enabled"], "no") {
+			continue
+		}
+		for _, uri := range strings.Fields(fields["uris"]) {
+			sources = append(sources, aptSource{
+				File:       file,
+				URI:        uri,
+				Suites:     strings.Fields(fields["suites"]),
+				Components: strings.Fields(fields["components"]),
+			})
+		}
+	}
+	return sources
+}
+
+// readAptSources reads every configured source
+func readAptSources() []aptSource {
+	var sources []aptSource
+	if data, err := os.ReadFile(aptSourcesList); err == nil {
+		sources = append(sources, parseSourcesList(aptSourcesList, string(data))...)
+	}
+	files, _ := filepath.Glob(filepath.Join(aptSourcesDir, "*"))
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		switch filepath.Ext(file) {
+		case ".list":
+			sources = append(sources, parseSourcesList(file, string(data))...)
+		case ".sources":
+			sources = append(sources, parseDeb822Sources(file, string(data))...)
+		}
+	}
+	return sources
+}
+
+// archiveMirrors returns the URIs serving the release's own suite with the
+// main component: the Ubuntu archive mirror, not the security archive (its
+// own suite) nor third-party repositories such as Docker's ("stable")
+func archiveMirrors(sources []aptSource, codename string) []string {
+	var mirrors []string
+	seen := make(map[string]bool)
+	for _, s := range sources {
+		if !contains(s.Suites, codename) || !contains(s.Components, "main") || seen[s.URI] {
+			continue
+		}
+		seen[s.URI] = true
+		mirrors = append(mirrors, s.URI)
+	}
+	return mirrors
+}
+
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// MirrorHealth is how fast a mirror answered
+type MirrorHealth struct {
+	URI        string
+	Latency    time.Duration // Until the response headers arrived
+	Throughput float64       // Bytes per second for the Release file
+	Err        string        `json:",omitempty"`
+	Checked    time.Time
+}
+
+// Dead reports whether the mirror did not answer
+func (h MirrorHealth) Dead() bool {
+	return h.Err != ""
+}
+
+// Slow reports whether updates from the mirror will take much longer than
+// they should
+func (h MirrorHealth) Slow() bool {
+	return h.Dead() || h.Latency > mirrorSlowLatency || h.Throughput < mirrorSlowThroughput
+}
+
+// Summary describes the measurement
+func (h MirrorHealth) Summary() string {
+	if h.Dead() {
+		return h.URI + ": " + h.Err
+	}
+	return fmt.Sprintf("%s: %d ms, %.1f MB/s", h.URI, h.Latency.Milliseconds(), h.Throughput/1e6)
+}
+
+// ProbeMirror downloads the release's Release file from a mirror
+func ProbeMirror(uri, codename string) MirrorHealth {
+	h := MirrorHealth{URI: uri, Checked: time.Now()}
+	if strings.HasPrefix(uri, "mirror://") || strings.HasPrefix(uri, "mirror+") {
+		// apt picks and fails over between mirrors itself
+		h.Throughput = mirrorSlowThroughput
+		return h
+	}
+
+	client := &http.Client{Timeout: mirrorProbeTimeout}
+	start := time.Now()
+	resp, err := client.Get(strings.TrimRight(uri, "/") + "/dists/" + codename + "/Release")
+	if err != nil {
+		h.Err = err.Error()
+		return h
+	}
+	defer resp.Body.Close()
+	h.Latency = time.Since(start)
+	if resp.StatusCode != http.StatusOK {
+		h.Err = "HTTP " + resp.Status
+		return h
+	}
+	n, err := io.Copy(io.Discard, resp.Body)
+	if err != nil {
+		h.Err = err.Error()
+		return h
+	}
+	if elapsed := time.Since(start) - h.Latency; elapsed > 0 {
+		h.Throughput = float64(n) / elapsed.Seconds()
+	} else {
+		h.Throughput = float64(n) / time.Millisecond.Seconds()
+	}
+	return h
+}
+
+// CountryMirror returns the Ubuntu country mirror for the locale's
+// territory (en_GB.UTF-8: gb.archive.ubuntu.com), empty when the locale
+// names none. Ports mirrors (arm64) have no country mirrors.
+func CountryMirror(current string) string {
+	if strings.Contains(current, "ports.ubuntu.com") {
+		return ""
+	}
+	locale := os.Getenv("LC_ALL")
+	if locale == "" {
+		locale = os.Getenv("LANG")
+	}
+	country := localeCountry(locale)
+	if country == "" {
+		return ""
+	}
+	return "http://" + country + ".archive.ubuntu.com/ubuntu/"
+}
+
+// localeCountry returns the lower-case territory of a locale name
+func localeCountry(locale string) string {
+	locale, _, _ = strings.Cut(locale, ".")
+	locale, _, _ = strings.Cut(locale, "@")
+	_, territory, ok := strings.Cut(locale, "_")
+	if !ok || len(territory) != 2 {
+		return ""
+	}
+	return strings.ToLower(territory)
+}
+
+// mirrorCache is what CheckMirrors saves between runs
+type mirrorCache struct {
+	Codename string
+	Mirrors  []MirrorHealth
+}
+
+// mirrorCachePath is where the last measurement is kept
+var mirrorCachePath = func() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "servctl", "apt-mirrors.json")
+}
+
+// CheckMirrors measures the configured archive mirrors. A measurement of
+// the same mirrors from the last few hours is reused, so a dead mirror is
+// not waited on again by every step that runs apt.
+func CheckMirrors() []MirrorHealth {
+	info, err := parseOSRelease()
+	if err != nil || info.VersionCodename == "" {
+		return nil
+	}
+	mirrors := archiveMirrors(readAptSources(), info.VersionCodename)
+	if len(mirrors) == 0 {
+		return nil
+	}
+
+	if data, err := os.ReadFile(mirrorCachePath()); err == nil {
+		var cache mirrorCache
+		if json.Unmarshal(data, &cache) == nil && cache.Codename == info.VersionCodename && sameMirrors(cache.Mirrors, mirrors) {
+			return cache.Mirrors
+		}
+	}
+
+	var health []MirrorHealth
+	for _, uri := range mirrors {
+		health = append(health, ProbeMirror(uri, info.VersionCodename))
+	}
+	if data, err := json.Marshal(mirrorCache{Codename: info.VersionCodename, Mirrors: health}); err == nil {
+		os.MkdirAll(filepath.Dir(mirrorCachePath()), 0755)
+		utils.AtomicWrite(mirrorCachePath(), data, 0644)
+	}
+	return health
+}
+
+// sameMirrors reports whether a cached measurement is fresh and covers
+// exactly the configured mirrors
+func sameMirrors(cached []MirrorHealth, mirrors []string) bool {
+	if len(cached) != len(mirrors) {
+		return false
+	}
+	for i, h := range cached {
+		if h.URI != mirrors[i] || time.Since(h.Checked) > mirrorCacheTTL {
+			return false
+		}
+	}
+	return true
+}
+
+// forgetMirrors drops the cached measurement after the sources changed
+func forgetMirrors() {
+	os.Remove(mirrorCachePath())
+}
+
+// deadMirror returns the first configured mirror known not to answer
+func deadMirror() string {
+	for _, h := range CheckMirrors() {
+		if h.Dead() {
+			return h.URI
+		}
+	}
+	return ""
+}
+
+// CheckAptMirror warns when the apt mirror is slow or does not answer
+func CheckAptMirror() CheckResult {
+	result := CheckResult{Name: "APT Mirror"}
+	health := CheckMirrors()
+	if len(health) == 0 {
+		result.Status = StatusSkip
+		result.Message = "No Ubuntu archive mirror found in the apt sources"
+		return result
+	}
+	for _, h := range health {
+		result.Details = append(result.Details, h.Summary())
+	}
+	for _, h := range health {
+		switch {
+		case h.Dead():
+			result.Status = StatusWarn
+			result.Message = h.URI + " does not answer: package installs will fail or stall"
+			return result
+		case h.Slow():
+			result.Status = StatusWarn
+			result.Message = h.URI + " is slow: updates will take much longer"
+			return result
+		}
+	}
+	result.Status = StatusPass
+	result.Message = "apt mirror answers quickly"
+	return result
+}
+
+// PromptMirrorSwitch offers a faster mirror when the configured one is slow
+// or dead: the country mirror when it measures faster, or apt's mirror
+// list, which fails over between mirrors by itself. It returns whether the
+// sources were changed.
+func PromptMirrorSwitch(reader *bufio.Reader, dryRun bool) bool {
+	info, err := parseOSRelease()
+	if err != nil {
+		return false
+	}
+	var slow *MirrorHealth
+	for _, h := range CheckMirrors() {
+		if h.Slow() {
+			slow = &h
+			break
+		}
+	}
+	if slow == nil {
+		return false
+	}
+
+	fmt.Println("APT Mirror:")
+	fmt.Printf("  %s\n", slow.Summary())
+	var options []string
+	if country := CountryMirror(slow.URI); country != "" && strings.TrimRight(country, "/") != strings.TrimRight(slow.URI, "/") {
+		if h := ProbeMirror(country, info.VersionCodename); !h.Slow() {
+			fmt.Printf("  %s\n", h.Summary())
+			options = append(options, country)
+		}
+	}
+	if !strings.Contains(slow.URI, "ports.ubuntu.com") {
+		options = append(options, MirrorList)
+	}
+	if len(options) == 0 {
+		fmt.Println("  No faster mirror found; installs may be slow.")
+		fmt.Println()
+		return false
+	}
+
+	for i, option := range options {
+		fmt.Printf("  %d) %s\n", i+1, option)
+	}
+	fmt.Printf("  Switch the apt mirror? [1-%d, Enter to keep %s]: ", len(options), slow.URI)
+	response, _ := reader.ReadString('\n')
+	response = strings.TrimSpace(response)
+	choice := 0
+	fmt.Sscanf(response, "%d", &choice)
+	if choice < 1 || choice > len(options) {
+		fmt.Println()
+		return false
+	}
+
+	if err := SwitchMirror(slow.URI, options[choice-1], dryRun); err != nil {
+		fmt.Printf("  ✗ %v\n\n", err)
+		return false
+	}
+	fmt.Printf("  ✓ apt now uses %s\n\n", options[choice-1])
+	return true
+}
+
+// replaceMirror swaps the mirror URI in a sources file, as a whole field
+// so the security archive and other repositories are left alone
+func replaceMirror(content, from, to string) string {
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		for _, field := range strings.Fields(line) {
+			if strings.TrimRight(field, "/") == strings.TrimRight(from, "/") {
+				lines[i] = strings.Replace(line, field, to, 1)
+				break
+			}
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// SwitchMirror points apt at another mirror, keeping a .servctl-bak copy of
+// each sources file it changes
+func SwitchMirror(from, to string, dryRun bool) error {
+	var files []string
+	seen := make(map[string]bool)
+	for _, s := range readAptSources() {
+		if s.URI == from && !seen[s.File] {
+			seen[s.File] = true
+			files = append(files, s.File)
+		}
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("%s is not in the apt sources", from)
+	}
+
+	var steps []ops.Operation
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		steps = append(steps,
+			ops.Command{Args: []string{"sudo", "cp", "-p", file, file + ".servctl-bak"}},
+			ops.WriteFile{Path: file, Content: []byte(replaceMirror(string(data), from, to)), Mode: 0644, Sudo: true})
+	}
+	if err := ops.Execute(dryRun, steps...); err != nil {
+		return err
+	}
+	if !dryRun {
+		forgetMirrors()
+	}
+	return nil
+}
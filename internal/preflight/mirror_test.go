@@ -0,0 +1,165 @@
+package preflight
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useTestSources points the apt sources at testdata/apt
+func useTestSources(t *testing.T) {
+	t.Helper()
+	oldList, oldDir := aptSourcesList, aptSourcesDir
+	aptSourcesList = filepath.Join("testdata", "apt", "sources.list")
+	aptSourcesDir = filepath.Join("testdata", "apt", "sources.list.d")
+	t.Cleanup(func() { aptSourcesList, aptSourcesDir = oldList, oldDir })
+}
+
+func TestArchiveMirrors(t *testing.T) {
+	useTestSources(t)
+	sources := readAptSources()
+
+	tests := []struct {
+		codename string
+		want     []string
+	}{
+		// Not the security archive, not Docker's repository
+		{"jammy", []string{"http://gb.archive.ubuntu.com/ubuntu/"}},
+		{"noble", []string{"http://archive.ubuntu.com/ubuntu/"}},
+		{"focal", nil},
+	}
+	for _, tt := range tests {
+		got := archiveMirrors(sources, tt.codename)
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("archiveMirrors(%s) = %v, want %v", tt.codename, got, tt.want)
+		}
+	}
+}
+
+func TestParseSourcesList_Options(t *testing.T) {
+	sources := parseSourcesList("docker.list", "deb [arch=amd64 signed-by=/k.gpg] https://download.docker.com/linux/ubuntu jammy stable\n")
+	if len(sources) != 1 || sources[0].URI != "https://download.docker.com/linux/ubuntu" || sources[0].Suites[0] != "jammy" {
+		t.Errorf("parseSourcesList() = %+v", sources)
+	}
+}
+
+func TestParseDeb822Sources_Disabled(t *testing.T) {
+	content := "Types: deb\nURIs: http://archive.ubuntu.com/ubuntu/\nSuites: noble\nComponents: main\nEnabled: no\n"
+	if sources := parseDeb822Sources("ubuntu.sources", content); len(sources) != 0 {
+		t.Errorf("disabled stanza parsed: %+v", sources)
+	}
+}
+
+func TestLocaleCountry(t *testing.T) {
+	tests := map[string]string{
+		"en_GB.UTF-8":     "gb",
+		"de_DE@euro":      "de",
+		"pt_BR.utf8":      "br",
+		"C.UTF-8":         "",
+		"":                "",
+		"sr_RS@latin.UTF": "rs",
+	}
+	for locale, want := range tests {
+		if got := localeCountry(locale); got != want {
+			t.Errorf("localeCountry(%q) = %q, want %q", locale, got, want)
+		}
+	}
+}
+
+func TestReplaceMirror(t *testing.T) {
+	content := "deb http://archive.ubuntu.com/ubuntu jammy main\n" +
+		"deb http://security.ubuntu.com/ubuntu jammy-security main\n" +
+		"URIs: http://archive.ubuntu.com/ubuntu/\n"
+	got := replaceMirror(content, "http://archive.ubuntu.com/ubuntu/", MirrorList)
+	want := "deb " + MirrorList + " jammy main\n" +
+		"deb http://security.ubuntu.com/ubuntu jammy-security main\n" +
+		"URIs: " + MirrorList + "\n"
+	if got != want {
+		t.Errorf("replaceMirror() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestProbeMirror(t *testing.T) {
+	release := strings.Repeat("x", 64*1024)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ubuntu/dists/jammy/Release" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(release))
+	}))
+	defer server.Close()
+
+	h := ProbeMirror(server.URL+"/ubuntu/", "jammy")
+	if h.Dead() || h.Latency <= 0 || h.Throughput <= 0 {
+		t.Errorf("ProbeMirror() = %+v, want a live mirror", h)
+	}
+
+	if h := ProbeMirror(server.URL+"/ubuntu/", "noble"); !h.Dead() || !strings.Contains(h.Err, "404") {
+		t.Errorf("ProbeMirror() for a missing release = %+v, want HTTP 404", h)
+	}
+
+	server.Close()
+	if h := ProbeMirror(server.URL+"/ubuntu/", "jammy"); !h.Dead() || !h.Slow() {
+		t.Errorf("ProbeMirror() on a closed server = %+v, want dead", h)
+	}
+
+	if h := ProbeMirror(MirrorList, "jammy"); h.Dead() || h.Slow() {
+		t.Errorf("ProbeMirror(mirror://) = %+v, want it left to apt", h)
+	}
+}
+
+func TestMirrorHealth_Slow(t *testing.T) {
+	tests := []struct {
+		h    MirrorHealth
+		slow bool
+	}{
+		{MirrorHealth{Latency: 80 * time.Millisecond, Throughput: 8e6}, false},
+		{MirrorHealth{Latency: 3 * time.Second, Throughput: 8e6}, true},
+		{MirrorHealth{Latency: 80 * time.Millisecond, Throughput: 50e3}, true},
+		{MirrorHealth{Err: "timeout"}, true},
+	}
+	for _, tt := range tests {
+		if got := tt.h.Slow(); got != tt.slow {
+			t.Errorf("%+v: Slow() = %v, want %v", tt.h, got, tt.slow)
+		}
+	}
+}
+
+func TestCheckMirrors_UsesCache(t *testing.T) {
+	useTestSources(t)
+	oldRelease, oldCache := osReleasePath, mirrorCachePath
+	osReleasePath = filepath.Join("testdata", "os-release", "ubuntu-22.04")
+	cacheFile := filepath.Join(t.TempDir(), "apt-mirrors.json")
+	mirrorCachePath = func() string { return cacheFile }
+	defer func() { osReleasePath, mirrorCachePath = oldRelease, oldCache }()
+
+	cached := mirrorCache{Codename: "jammy", Mirrors: []MirrorHealth{
+		{URI: "http://gb.archive.ubuntu.com/ubuntu/", Err: "timeout", Checked: time.Now()},
+	}}
+	data, _ := json.Marshal(cached)
+	if err := os.WriteFile(cacheFile, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	health := CheckMirrors()
+	if len(health) != 1 || !health[0].Dead() {
+		t.Fatalf("CheckMirrors() = %+v, want the cached dead mirror", health)
+	}
+	if got := deadMirror(); got != "http://gb.archive.ubuntu.com/ubuntu/" {
+		t.Errorf("deadMirror() = %q", got)
+	}
+	if result := CheckAptMirror(); result.Status != StatusWarn {
+		t.Errorf("CheckAptMirror() = %v, want WARN", result.Status)
+	}
+
+	// An old measurement is not trusted
+	if sameMirrors([]MirrorHealth{{URI: "a", Checked: time.Now().Add(-7 * time.Hour)}}, []string{"a"}) {
+		t.Error("sameMirrors() accepted a 7 hour old measurement")
+	}
+}
@@ -0,0 +1,26 @@
+package preflight
+
+import "github.com/madhav/servctl/internal/pkgmgr"
+
+// packageManager performs every package install and upgrade in preflight
+var packageManager pkgmgr.Manager = pkgmgr.Default()
+
+// PackageProgress receives progress from package operations; main points it
+// at the TUI. Nil discards progress.
+var PackageProgress pkgmgr.ProgressFunc
+
+// InstalledPackageVersions returns the versions of the packages servctl
+// depends on, for recording in the state file
+func InstalledPackageVersions() map[string]string {
+	var names []string
+	for _, dep := range GetRequiredDependencies() {
+		names = append(names, dep.Package)
+	}
+	names = append(names, DockerPackages...)
+
+	versions, err := packageManager.Versions(names)
+	if err != nil {
+		return nil
+	}
+	return versions
+}
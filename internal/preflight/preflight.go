@@ -5,8 +5,8 @@ package preflight
 
 import (
 	"bufio"
-	"errors"
 	"fmt"
+	"io"
 	"net"
 	"os"
 	"os/exec"
@@ -14,6 +14,10 @@ import (
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/madhav/servctl/internal/ops"
+	"github.com/madhav/servctl/internal/utils"
+	"github.com/madhav/servctl/templates"
 )
 
 // CheckResult represents the result of a preflight check
@@ -108,26 +112,45 @@ func CheckOS() CheckResult {
 	return result
 }
 
+// osReleasePath is read by CheckOS; tests point it at testdata/os-release
+var osReleasePath = "/etc/os-release"
+
 // parseOSRelease reads and parses /etc/os-release
 func parseOSRelease() (*OSInfo, error) {
-	file, err := os.Open("/etc/os-release")
+	file, err := os.Open(osReleasePath)
 	if err != nil {
-		return nil, fmt.Errorf("cannot open /etc/os-release: %w", err)
+		return nil, fmt.Errorf("cannot open %s: %w", osReleasePath, err)
 	}
 	defer file.Close()
 
+	info, err := ParseOSRelease(file)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", osReleasePath, err)
+	}
+	return info, nil
+}
+
+// ParseOSRelease parses os-release(5) content. Values may be double-quoted,
+// single-quoted or bare; comments and blank lines are skipped.
+func ParseOSRelease(r io.Reader) (*OSInfo, error) {
 	info := &OSInfo{}
-	scanner := bufio.NewScanner(file)
+	scanner := bufio.NewScanner(r)
 
 	for scanner.Scan() {
-		line := scanner.Text()
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
 		parts := strings.SplitN(line, "=", 2)
 		if len(parts) != 2 {
 			continue
 		}
 
-		key := parts[0]
-		value := strings.Trim(parts[1], "\"")
+		key := strings.TrimSpace(parts[0])
+		value := strings.TrimSpace(parts[1])
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
 
 		switch key {
 		case "ID":
@@ -144,7 +167,7 @@ func parseOSRelease() (*OSInfo, error) {
 	}
 
 	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("error reading /etc/os-release: %w", err)
+		return nil, err
 	}
 
 	return info, nil
@@ -599,18 +622,15 @@ func PromptStaticIPSetup(reader *bufio.Reader, dryRun bool) bool {
 		return false
 	}
 
-	if dryRun {
-		fmt.Println("  [DRY RUN] Would create: " + staticConfig.ConfigPath)
-		fmt.Println("  [DRY RUN] Would run: sudo netplan apply")
-		return true
-	}
-
 	// Apply configuration
-	err = applyStaticIPConfig(staticConfig)
+	err = applyStaticIPConfig(staticConfig, dryRun)
 	if err != nil {
 		fmt.Printf("  ✗ Failed to apply configuration: %v\n", err)
 		return false
 	}
+	if dryRun {
+		return true
+	}
 
 	fmt.Println()
 	fmt.Println("  ✓ Static IP configured successfully!")
@@ -638,51 +658,40 @@ func detectDefaultGateway() string {
 	return ""
 }
 
+// GenerateNetplanConfig renders the netplan file for a static address
+func GenerateNetplanConfig(config StaticIPConfig) (string, error) {
+	return templates.Render("system/netplan.yaml.tmpl", config, nil)
+}
+
 // applyStaticIPConfig creates the netplan config and applies it
-func applyStaticIPConfig(config StaticIPConfig) error {
-	// Generate netplan YAML
-	netplanConfig := fmt.Sprintf(`# Generated by servctl - Static IP Configuration
-# Do not edit manually unless you know what you're doing
-network:
-  version: 2
-  renderer: networkd
-  ethernets:
-    %s:
-      dhcp4: false
-      addresses:
-        - %s/%s
-      routes:
-        - to: default
-          via: %s
-      nameservers:
-        addresses:
-          - %s
-          - %s
-`, config.Interface, config.IPAddress, config.Subnet, config.Gateway, config.DNS1, config.DNS2)
-
-	// Write to file (requires root)
-	err := os.WriteFile(config.ConfigPath, []byte(netplanConfig), 0644)
+func applyStaticIPConfig(config StaticIPConfig, dryRun bool) error {
+	netplanConfig, err := GenerateNetplanConfig(config)
 	if err != nil {
-		// Try with sudo
-		cmd := exec.Command("sudo", "tee", config.ConfigPath)
-		cmd.Stdin = strings.NewReader(netplanConfig)
-		if err := cmd.Run(); err != nil {
-			return fmt.Errorf("failed to write netplan config: %w", err)
-		}
+		return err
 	}
-
-	fmt.Println("  → Created: " + config.ConfigPath)
-
-	// Apply netplan
-	fmt.Println("  → Applying netplan configuration...")
-	cmd := exec.Command("sudo", "netplan", "apply")
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to apply netplan: %w", err)
+	steps := []ops.Operation{
+		ops.WriteFile{Path: config.ConfigPath, Content: []byte(netplanConfig), Mode: 0644, Sudo: true},
+		ops.Command{Args: []string{"sudo", "netplan", "apply"}},
+	}
+	if dryRun {
+		return ops.Execute(true, steps...)
 	}
 
-	return nil
+	// Writing and applying finish even on Ctrl+C; when either fails (an
+	// interrupted netplan apply included) the previous file is put back
+	previous, readErr := os.ReadFile(config.ConfigPath)
+	var restore ops.Operation = ops.Remove{Path: config.ConfigPath, Sudo: true}
+	if readErr == nil {
+		restore = ops.WriteFile{Path: config.ConfigPath, Content: previous, Mode: 0644, Sudo: true}
+	}
+	undo := func() {
+		restore.Apply()
+		fmt.Println("  → Restored the previous network configuration file")
+	}
+	return utils.Atomic(func() error {
+		fmt.Println("  → Applying netplan configuration...")
+		return ops.Execute(false, steps...)
+	}, undo)
 }
 
 // detectNetworkConfig detects the current network configuration
@@ -910,7 +919,7 @@ func GetRequiredDependencies() []Dependency {
 	return []Dependency{
 		{Name: "curl", Binary: "curl", Package: "curl", Criticality: "blocker", InstallCmd: "apt install -y curl"},
 		{Name: "net-tools", Binary: "ifconfig", Package: "net-tools", Criticality: "recommended", InstallCmd: "apt install -y net-tools"},
-		{Name: "Docker", Binary: "docker", Package: "docker-ce", Criticality: "blocker", InstallCmd: "curl -fsSL https://get.docker.com | sh"},
+		{Name: "Docker", Binary: "docker", Package: "docker-ce", Criticality: "blocker", InstallCmd: "apt install -y docker-ce (download.docker.com, key " + DockerKeyFingerprint + ")"},
 		{Name: "Docker Compose", Binary: "docker compose", Package: "docker-compose", Criticality: "blocker", InstallCmd: "apt install -y docker-compose"},
 		{Name: "hdparm", Binary: "hdparm", Package: "hdparm", Criticality: "recommended", InstallCmd: "apt install -y hdparm"},
 		{Name: "smartmontools", Binary: "smartctl", Package: "smartmontools", Criticality: "recommended", InstallCmd: "apt install -y smartmontools"},
@@ -918,6 +927,7 @@ func GetRequiredDependencies() []Dependency {
 		{Name: "UFW Firewall", Binary: "ufw", Package: "ufw", Criticality: "high", InstallCmd: "apt install -y ufw"},
 		{Name: "lsblk", Binary: "lsblk", Package: "util-linux", Criticality: "blocker", InstallCmd: "apt install -y util-linux"},
 		{Name: "mkfs.ext4", Binary: "mkfs.ext4", Package: "e2fsprogs", Criticality: "blocker", InstallCmd: "apt install -y e2fsprogs"},
+		{Name: "msmtp", Binary: "msmtp", Package: "msmtp-mta", Criticality: "recommended", InstallCmd: "apt install -y msmtp-mta"},
 	}
 }
 
@@ -978,6 +988,8 @@ func CheckDependency(dep Dependency) CheckResult {
 		}
 	}
 
+	checkVersionRequirement(dep, &result)
+
 	return result
 }
 
@@ -1068,62 +1080,30 @@ type SystemUpdateResult struct {
 	Duration        time.Duration
 }
 
-// RunSystemUpdate executes apt update and upgrade
+// RunSystemUpdate refreshes package lists and upgrades installed packages
+// (simulated in dry-run mode), streaming progress to PackageProgress
 func RunSystemUpdate(dryRun bool) (*SystemUpdateResult, error) {
 	result := &SystemUpdateResult{}
 	startTime := time.Now()
 
-	// Run apt update
-	updateCmd := exec.Command("sudo", "apt", "update")
-	updateOutput, err := updateCmd.CombinedOutput()
-	if err != nil {
-		result.Errors = append(result.Errors, fmt.Sprintf("apt update failed: %s", string(updateOutput)))
-		return result, errors.New("apt update failed")
+	// A dead mirror would hold apt through every retry and timeout
+	if mirror := deadMirror(); mirror != "" {
+		err := fmt.Errorf("apt mirror %s does not answer; switch to another in /etc/apt/sources.list", mirror)
+		result.Errors = append(result.Errors, err.Error())
+		return result, err
 	}
 
-	if dryRun {
-		// Just simulate upgrade
-		upgradeCmd := exec.Command("sudo", "apt", "upgrade", "-s")
-		output, err := upgradeCmd.CombinedOutput()
-		if err != nil {
-			result.Errors = append(result.Errors, "Failed to simulate upgrade")
-			return result, err
-		}
-
-		// Parse number of packages
-		lines := strings.Split(string(output), "\n")
-		for _, line := range lines {
-			if strings.Contains(line, "upgraded") && strings.Contains(line, "newly installed") {
-				parts := strings.Fields(line)
-				if len(parts) > 0 {
-					count, _ := strconv.Atoi(parts[0])
-					result.PackagesUpdated = count
-				}
-				break
-			}
-		}
-	} else {
-		// Actually run upgrade
-		upgradeCmd := exec.Command("sudo", "apt", "upgrade", "-y")
-		output, err := upgradeCmd.CombinedOutput()
-		if err != nil {
-			result.Errors = append(result.Errors, fmt.Sprintf("apt upgrade failed: %s", string(output)))
-			return result, errors.New("apt upgrade failed")
-		}
+	if _, err := packageManager.Update(PackageProgress); err != nil {
+		result.Errors = append(result.Errors, err.Error())
+		return result, err
+	}
 
-		// Parse output for package count
-		lines := strings.Split(string(output), "\n")
-		for _, line := range lines {
-			if strings.Contains(line, "upgraded") && strings.Contains(line, "newly installed") {
-				parts := strings.Fields(line)
-				if len(parts) > 0 {
-					count, _ := strconv.Atoi(parts[0])
-					result.PackagesUpdated = count
-				}
-				break
-			}
-		}
+	upgrade, err := packageManager.Upgrade(dryRun, PackageProgress)
+	if err != nil {
+		result.Errors = append(result.Errors, err.Error())
+		return result, err
 	}
+	result.PackagesUpdated = upgrade.Upgraded
 
 	result.Duration = time.Since(startTime)
 	result.Success = true
@@ -1132,12 +1112,9 @@ func RunSystemUpdate(dryRun bool) (*SystemUpdateResult, error) {
 
 // InstallDependency installs a missing dependency
 func InstallDependency(dep Dependency) error {
-	// Handle special case for Docker (uses script)
+	// Docker comes from its own repository, signed by a pinned key
 	if dep.Binary == "docker" {
-		cmd := exec.Command("sh", "-c", "curl -fsSL https://get.docker.com | sh")
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		return cmd.Run()
+		return installDockerVerified(Verification)
 	}
 
 	// Handle Docker Compose v2 (plugin)
@@ -1148,17 +1125,13 @@ func InstallDependency(dep Dependency) error {
 			return nil // Already installed as plugin
 		}
 		// Install docker-compose
-		installCmd := exec.Command("sudo", "apt", "install", "-y", "docker-compose")
-		installCmd.Stdout = os.Stdout
-		installCmd.Stderr = os.Stderr
-		return installCmd.Run()
+		_, err := packageManager.Install([]string{"docker-compose"}, PackageProgress)
+		return err
 	}
 
-	// Standard apt install
-	cmd := exec.Command("sudo", "apt", "install", "-y", dep.Package)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	return cmd.Run()
+	// Standard package install
+	_, err := packageManager.Install([]string{dep.Package}, PackageProgress)
+	return err
 }
 
 // AddUserToDockerGroup adds the current user to the docker group
@@ -1181,7 +1154,10 @@ func RunAllPreflightChecks() []CheckResult {
 	results = append(results, CheckPrivileges())
 	results = append(results, CheckHardware())
 	results = append(results, CheckConnectivity())
+	results = append(results, CheckAptMirror())
 	results = append(results, CheckStaticIP())
+	results = append(results, CheckInotifyLimits())
+	results = append(results, CheckOpenFileLimit())
 
 	// Dependency checks
 	results = append(results, CheckAllDependencies()...)
@@ -1250,12 +1226,10 @@ func InstallAllMissingDependencies(dryRun bool) []InstallResult {
 	var results []InstallResult
 	missing := GetMissingDependencies()
 
-	// First run apt update
-	if !dryRun && len(missing) > 0 {
-		updateCmd := exec.Command("sudo", "apt", "update")
-		updateCmd.Stdout = os.Stdout
-		updateCmd.Stderr = os.Stderr
-		updateCmd.Run() // Ignore error, continue anyway
+	// First refresh package lists, unless the mirror is known to be dead:
+	// the installs then use the lists already there
+	if !dryRun && len(missing) > 0 && deadMirror() == "" {
+		packageManager.Update(PackageProgress) // Ignore error, continue anyway
 	}
 
 	// Install each missing dependency
@@ -1341,6 +1315,19 @@ func RunPreflightWithAutoFix(dryRun bool) ([]CheckResult, []InstallResult, error
 		}
 	}
 
+	// Raise file watch and open file limits that are too low
+	for i, r := range results {
+		if fix := limitsFix(r.Name); fix != nil && r.Status == StatusWarn {
+			if err := fix(dryRun); err != nil {
+				results[i].Details = append(results[i].Details, "Auto-fix failed: "+err.Error())
+				continue
+			}
+			if !dryRun {
+				results[i] = limitsFixed(r)
+			}
+		}
+	}
+
 	// Add user to docker group if needed
 	dockerCheck := CheckDockerRunning()
 	if dockerCheck.Status == StatusFail {
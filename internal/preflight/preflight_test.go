@@ -1,6 +1,8 @@
 package preflight
 
 import (
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -211,6 +213,59 @@ func TestCheckOS(t *testing.T) {
 	t.Logf("CheckOS result: %s - %s", result.Status.String(), result.Message)
 }
 
+// testdata/os-release holds files recorded on real machines; add one with
+// its expectations here whenever CheckOS misreads a system
+func TestCheckOS_Fixtures(t *testing.T) {
+	want := map[string]struct {
+		id, version string
+		status      Status
+	}{
+		"ubuntu-22.04":             {"ubuntu", "22.04", StatusPass},
+		"ubuntu-24.04-raspi":       {"ubuntu", "24.04", StatusPass},
+		"ubuntu-24.04-hand-edited": {"ubuntu", "24.04", StatusPass},
+		"ubuntu-20.04":             {"ubuntu", "20.04", StatusFail},
+		"raspios-bookworm":         {"debian", "12", StatusFail},
+	}
+
+	files, err := filepath.Glob(filepath.Join("testdata", "os-release", "*"))
+	if err != nil || len(files) == 0 {
+		t.Fatal("no fixtures in testdata/os-release")
+	}
+	orig := osReleasePath
+	defer func() { osReleasePath = orig }()
+
+	for _, file := range files {
+		name := filepath.Base(file)
+		t.Run(name, func(t *testing.T) {
+			w, ok := want[name]
+			if !ok {
+				t.Fatalf("testdata/os-release/%s has no expectations", name)
+			}
+			osReleasePath = file
+			info, err := parseOSRelease()
+			if err != nil {
+				t.Fatalf("parseOSRelease() error: %v", err)
+			}
+			if info.ID != w.id || info.VersionID != w.version || info.PrettyName == "" {
+				t.Errorf("parseOSRelease() = %+v, want ID %q VERSION_ID %q", info, w.id, w.version)
+			}
+			if result := CheckOS(); result.Status != w.status {
+				t.Errorf("CheckOS() = %s (%s), want %s", result.Status, result.Message, w.status)
+			}
+		})
+	}
+}
+
+func TestCheckOS_MissingFile(t *testing.T) {
+	orig := osReleasePath
+	defer func() { osReleasePath = orig }()
+	osReleasePath = filepath.Join(t.TempDir(), "os-release")
+
+	if result := CheckOS(); result.Status != StatusFail {
+		t.Errorf("CheckOS() without os-release = %s, want Fail", result.Status)
+	}
+}
+
 func TestCheckPrivileges(t *testing.T) {
 	if testing.Short() {
 		t.Skip("Skipping privilege check in short mode (requires sudo)")
@@ -414,3 +469,27 @@ func TestSystemSetupDryRun(t *testing.T) {
 		t.Logf("SystemSetup dry run returned: %v (expected on non-Ubuntu)", err)
 	}
 }
+
+func TestGenerateNetplanConfig(t *testing.T) {
+	content, err := GenerateNetplanConfig(StaticIPConfig{
+		Interface: "enp3s0",
+		IPAddress: "192.168.1.50",
+		Subnet:    "24",
+		Gateway:   "192.168.1.1",
+		DNS1:      "1.1.1.1",
+		DNS2:      "8.8.8.8",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"    enp3s0:\n      dhcp4: false\n",
+		"        - 192.168.1.50/24\n",
+		"          via: 192.168.1.1\n",
+		"          - 1.1.1.1\n          - 8.8.8.8\n",
+	} {
+		if !strings.Contains(content, want) {
+			t.Errorf("netplan config missing %q:\n%s", want, content)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package preflight
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strings"
+)
+
+// SkippedCapability is something the wizard does not do in rootless mode
+type SkippedCapability struct {
+	Name        string
+	Reason      string
+	Alternative string // What to do instead, or how an admin can enable it
+}
+
+// RootlessSkipped lists the capabilities that need root and are skipped
+// with --no-sudo
+func RootlessSkipped() []SkippedCapability {
+	return []SkippedCapability{
+		{"System updates and package installs", "apt needs root", "Ask an admin to install docker-ce-rootless-extras and uidmap"},
+		{"Static IP (netplan)", "writes /etc/netplan", "Reserve the address in your router's DHCP settings"},
+		{"Disk formatting and mounting", "needs raw block devices and /etc/fstab", "Data is stored under ~/data on the existing filesystem"},
+		{"SMART health and disk spin-down", "smartctl and hdparm need raw devices", "The SMART alert script is not scheduled"},
+		{"UFW firewall", "changes kernel packet filters", "Ask an admin to allow the service ports"},
+		{"System mail (msmtp)", "writes /etc/msmtprc", "Alerts still go to the webhook; Nextcloud mail still works"},
+		{"Local DNS (dnsmasq)", "binds port 53", "Use IP:port URLs or add names to each client's hosts file"},
+		{"System cron jobs", "writes /etc/cron.d", "Maintenance runs from user systemd timers instead"},
+	}
+}
+
+// RootlessDockerSocket returns the socket rootless Docker listens on for
+// the current user
+func RootlessDockerSocket() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "docker.sock")
+	}
+	return fmt.Sprintf("/run/user/%d/docker.sock", os.Getuid())
+}
+
+// UseRootlessDocker points docker commands at the rootless daemon unless
+// DOCKER_HOST was already set
+func UseRootlessDocker() {
+	if os.Getenv("DOCKER_HOST") == "" {
+		os.Setenv("DOCKER_HOST", "unix://"+RootlessDockerSocket())
+	}
+}
+
+// CheckRootlessDocker verifies a rootless Docker daemon is running for this user
+func CheckRootlessDocker() CheckResult {
+	result := CheckResult{
+		Name: "Rootless Docker",
+	}
+
+	socket := RootlessDockerSocket()
+	if _, err := os.Stat(socket); err != nil {
+		result.Status = StatusFail
+		result.Message = "Rootless Docker is not running for this user"
+		result.Details = append(result.Details,
+			"Set it up with: dockerd-rootless-setuptool.sh install",
+			"Then start it: systemctl --user enable --now docker",
+			"(needs docker-ce-rootless-extras and uidmap, installed once by an admin)")
+		return result
+	}
+
+	output, err := exec.Command("docker", "info", "--format", "{{.SecurityOptions}}").Output()
+	if err != nil {
+		result.Status = StatusFail
+		result.Message = "Rootless Docker socket exists but the daemon is not responding"
+		result.Details = append(result.Details, "Restart it: systemctl --user restart docker")
+		return result
+	}
+	if !strings.Contains(string(output), "rootless") {
+		result.Status = StatusWarn
+		result.Message = "Docker at " + socket + " is not running in rootless mode"
+		return result
+	}
+
+	result.Status = StatusPass
+	result.Message = "Rootless Docker is running"
+	result.Details = append(result.Details, "Socket: "+socket)
+	return result
+}
+
+// CheckLinger warns when user services stop at logout. Rootless Docker and
+// the maintenance timers run as user units, so without lingering they
+// only run while someone is logged in.
+func CheckLinger() CheckResult {
+	result := CheckResult{
+		Name: "User Service Lingering",
+	}
+
+	currentUser, err := user.Current()
+	if err != nil {
+		result.Status = StatusWarn
+		result.Message = "Failed to get current user"
+		return result
+	}
+
+	output, err := exec.Command("loginctl", "show-user", currentUser.Username, "--property=Linger", "--value").Output()
+	if err == nil && strings.TrimSpace(string(output)) == "yes" {
+		result.Status = StatusPass
+		result.Message = "User services keep running after logout"
+		return result
+	}
+
+	result.Status = StatusWarn
+	result.Message = "Services and timers will stop when you log out"
+	result.Details = append(result.Details,
+		"Ask an admin to run: sudo loginctl enable-linger "+currentUser.Username)
+	return result
+}
+
+// RunRootlessPreflightChecks runs the checks that make sense without sudo
+func RunRootlessPreflightChecks() []CheckResult {
+	var results []CheckResult
+
+	results = append(results, CheckOS())
+	results = append(results, CheckHardware())
+	results = append(results, CheckConnectivity())
+	results = append(results, CheckInotifyLimits())
+	results = append(results, CheckOpenFileLimit())
+
+	// Nothing can be installed, so only the tools the run depends on matter
+	for _, dep := range GetRequiredDependencies() {
+		switch dep.Binary {
+		case "curl", "docker", "docker compose":
+			results = append(results, CheckDependency(dep))
+		}
+	}
+
+	results = append(results, CheckRootlessDocker())
+	results = append(results, CheckLinger())
+
+	return results
+}
@@ -0,0 +1,89 @@
+package preflight
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// SudoRefreshInterval keeps the sudo timestamp fresh; sudo's default
+// timeout is 15 minutes, so refreshing every minute never lets it lapse
+const SudoRefreshInterval = 60 * time.Second
+
+// PrivilegedOp is an operation the wizard runs with sudo
+type PrivilegedOp struct {
+	Phase       string
+	Description string
+}
+
+// PlannedPrivilegedOps lists, in order, everything the setup wizard may do
+// as root, so the user sees it before granting sudo
+func PlannedPrivilegedOps() []PrivilegedOp {
+	return []PrivilegedOp{
+		{"System Preparation", "apt-get update/upgrade and install missing packages"},
+		{"System Preparation", "Add Docker's apt key and repository (when Docker is missing)"},
+		{"System Preparation", "Enable the Docker service and add you to the docker group"},
+		{"System Preparation", "Write a netplan static IP configuration (only if you choose it)"},
+		{"System Preparation", "Switch the apt mirror in /etc/apt/sources.list(.d), keeping a backup (only if you choose it)"},
+		{"System Preparation", "Raise low inotify and open file limits (/etc/sysctl.d, /etc/security/limits.d)"},
+		{"System Preparation", "Write kernel tuning to /etc/sysctl.d/90-servctl.conf and load it (only if you choose it)"},
+		{"Storage", "Partition and format the disks you select (after a typed confirmation)"},
+		{"Storage", "Mount disks and add them to /etc/fstab"},
+		{"Storage", "Read SMART health and apply disk spin-down settings (hdparm)"},
+		{"Services", "Add UFW firewall rules and write mail/DNS configuration in /etc"},
+		{"Maintenance", "Install /etc/cron.d/servctl"},
+		{"Maintenance", "Load drivetemp and configure fancontrol (only if you choose it)"},
+		{"Maintenance", "Install nut and write /etc/nut for a USB UPS (only if you choose it)"},
+		{"Maintenance", "Install powertop and a boot-time tuning unit, set backup drive spin-down in /etc/hdparm.conf (only if you choose them)"},
+		{"Bootstrap", "Install and restart dnsmasq (only with local DNS)"},
+	}
+}
+
+// IsRoot reports whether servctl is already running as root
+func IsRoot() bool {
+	return os.Geteuid() == 0
+}
+
+// AcquireSudo asks for the sudo password once, up front, so no prompt
+// appears later in the middle of an operation such as formatting
+func AcquireSudo() error {
+	if IsRoot() {
+		return nil
+	}
+
+	cmd := exec.Command("sudo", "-v")
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("sudo authentication failed: %w", err)
+	}
+	return nil
+}
+
+// KeepSudoAlive refreshes the sudo timestamp in the background without ever
+// prompting, until the returned stop function is called
+func KeepSudoAlive(interval time.Duration) (stop func()) {
+	if IsRoot() {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	ticker := time.NewTicker(interval)
+
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				// -n: fail instead of prompting if the timestamp was lost
+				exec.Command("sudo", "-n", "-v").Run()
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
@@ -0,0 +1,26 @@
+package preflight
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPlannedPrivilegedOps(t *testing.T) {
+	ops := PlannedPrivilegedOps()
+	if len(ops) == 0 {
+		t.Fatal("PlannedPrivilegedOps() returned nothing")
+	}
+
+	foundFormat := false
+	for _, op := range ops {
+		if op.Phase == "" || op.Description == "" {
+			t.Errorf("incomplete privileged op: %+v", op)
+		}
+		if op.Phase == "Storage" && strings.Contains(op.Description, "format") {
+			foundFormat = true
+		}
+	}
+	if !foundFormat {
+		t.Error("disk formatting should be announced before sudo is requested")
+	}
+}
@@ -0,0 +1,140 @@
+package preflight
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/madhav/servctl/internal/ops"
+	"github.com/madhav/servctl/templates"
+)
+
+// SysctlDropIn is the kernel parameter file servctl owns
+const SysctlDropIn = "/etc/sysctl.d/90-servctl.conf"
+
+// procSys is where the running kernel's parameters are read; tests point
+// it at a fake tree
+var procSys = "/proc/sys"
+
+// SysctlSetting is one kernel parameter and why servctl sets it
+type SysctlSetting struct {
+	Key     string
+	Value   string
+	Reason  string
+	Minimum bool // Only raise: a higher value already set is kept
+}
+
+// TunedSysctls are the kernel parameters for a home server running sync
+// clients, databases and large sequential writes (photo and backup copies)
+func TunedSysctls() []SysctlSetting {
+	return []SysctlSetting{
+		{"fs.inotify.max_user_watches", "524288", "Nextcloud and Syncthing watch every folder; the default 8192-65536 runs out silently", true},
+		{"fs.inotify.max_user_instances", "512", "Each container with a file watcher uses instances", true},
+		{"fs.file-max", "2097152", "Databases and many containers keep thousands of files open", true},
+		{"vm.dirty_background_ratio", "5", "Start writing back early so large copies stream instead of stalling", false},
+		{"vm.dirty_ratio", "10", "Cap dirty memory so a big upload cannot freeze the databases for seconds", false},
+		{"vm.swappiness", "10", "Keep database caches in RAM rather than swapping them out", false},
+		{"net.core.rmem_max", "7500000", "Larger UDP buffers for QUIC (Cloudflare Tunnel) transfers", true},
+		{"net.core.wmem_max", "7500000", "Larger UDP buffers for QUIC (Cloudflare Tunnel) transfers", true},
+		{"net.core.somaxconn", "4096", "Room for bursts of connections to the web services", true},
+	}
+}
+
+// ReadSysctl returns a kernel parameter's current value
+func ReadSysctl(key string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(procSys, strings.ReplaceAll(key, ".", "/")))
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(strings.Fields(string(data)), " "), nil
+}
+
+// SysctlChange is a setting whose value differs from the running kernel's
+type SysctlChange struct {
+	SysctlSetting
+	Current string // Empty when the parameter does not exist on this kernel
+}
+
+// PlanSysctl returns the settings that would change the running kernel.
+// Minimum settings already at or above their value are left alone, as are
+// parameters this kernel does not have.
+func PlanSysctl(settings []SysctlSetting) []SysctlChange {
+	var changes []SysctlChange
+	for _, s := range settings {
+		current, err := ReadSysctl(s.Key)
+		if err != nil {
+			continue
+		}
+		if current == s.Value {
+			continue
+		}
+		if s.Minimum {
+			have, err1 := strconv.ParseUint(current, 10, 64)
+			want, err2 := strconv.ParseUint(s.Value, 10, 64)
+			if err1 == nil && err2 == nil && have >= want {
+				continue
+			}
+		}
+		changes = append(changes, SysctlChange{SysctlSetting: s, Current: current})
+	}
+	return changes
+}
+
+// GenerateSysctlDropIn renders the drop-in for the given changes
+func GenerateSysctlDropIn(changes []SysctlChange) string {
+	return templates.MustRender("system/sysctl.conf.tmpl", changes, nil)
+}
+
+// ApplySysctl writes the drop-in and loads it. Settings already in effect
+// are not part of the plan, so running it again changes nothing. It returns
+// the values replaced, for the state file.
+func ApplySysctl(changes []SysctlChange, dryRun bool) (map[string]string, error) {
+	if len(changes) == 0 {
+		return nil, nil
+	}
+	previous := make(map[string]string, len(changes))
+	for _, c := range changes {
+		previous[c.Key] = c.Current
+	}
+
+	// Keep what an earlier run set: the plan only holds what still differs
+	content := GenerateSysctlDropIn(changes)
+	if existing, err := os.ReadFile(SysctlDropIn); err == nil {
+		content = mergeSysctlDropIn(string(existing), changes)
+	}
+
+	err := ops.Execute(dryRun,
+		ops.WriteFile{Path: SysctlDropIn, Content: []byte(content), Mode: 0644, Sudo: true},
+		ops.Command{Args: []string{"sudo", "sysctl", "-p", SysctlDropIn}})
+	if err != nil {
+		return nil, err
+	}
+	return previous, nil
+}
+
+// mergeSysctlDropIn updates an existing drop-in with new changes: a key
+// already in the file gets the new value, other keys are appended
+func mergeSysctlDropIn(existing string, changes []SysctlChange) string {
+	lines := strings.Split(strings.TrimRight(existing, "\n"), "\n")
+	var added []SysctlChange
+	for _, c := range changes {
+		found := false
+		for i, line := range lines {
+			key, _, ok := strings.Cut(line, "=")
+			if ok && strings.TrimSpace(key) == c.Key {
+				lines[i] = c.Key + " = " + c.Value
+				found = true
+			}
+		}
+		if !found {
+			added = append(added, c)
+		}
+	}
+	merged := strings.Join(lines, "\n") + "\n"
+	for _, c := range added {
+		merged += fmt.Sprintf("\n# %s (was %s)\n%s = %s\n", c.Reason, c.Current, c.Key, c.Value)
+	}
+	return merged
+}
@@ -0,0 +1,99 @@
+package preflight
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeProcSys points procSys at a temporary tree holding the given values
+func fakeProcSys(t *testing.T, values map[string]string) {
+	t.Helper()
+	dir := t.TempDir()
+	for key, value := range values {
+		path := filepath.Join(dir, strings.ReplaceAll(key, ".", "/"))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(value+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := procSys
+	procSys = dir
+	t.Cleanup(func() { procSys = old })
+}
+
+func TestPlanSysctl(t *testing.T) {
+	fakeProcSys(t, map[string]string{
+		"fs.inotify.max_user_watches": "8192",
+		"fs.file-max":                 "9223372036854775807",
+		"vm.swappiness":               "60",
+		"vm.dirty_ratio":              "10",
+	})
+
+	settings := []SysctlSetting{
+		{Key: "fs.inotify.max_user_watches", Value: "524288", Minimum: true},
+		{Key: "fs.file-max", Value: "2097152", Minimum: true},
+		{Key: "vm.swappiness", Value: "10"},
+		{Key: "vm.dirty_ratio", Value: "10"},
+		{Key: "net.core.somaxconn", Value: "4096", Minimum: true},
+	}
+	changes := PlanSysctl(settings)
+
+	if len(changes) != 2 {
+		t.Fatalf("PlanSysctl() = %+v, want 2 changes", changes)
+	}
+	if changes[0].Key != "fs.inotify.max_user_watches" || changes[0].Current != "8192" {
+		t.Errorf("changes[0] = %+v, want inotify watches from 8192", changes[0])
+	}
+	// Lowering swappiness is wanted even though it is not a Minimum
+	if changes[1].Key != "vm.swappiness" || changes[1].Current != "60" {
+		t.Errorf("changes[1] = %+v, want swappiness from 60", changes[1])
+	}
+}
+
+func TestPlanSysctl_AlreadyTuned(t *testing.T) {
+	values := make(map[string]string)
+	for _, s := range TunedSysctls() {
+		values[s.Key] = s.Value
+	}
+	fakeProcSys(t, values)
+
+	if changes := PlanSysctl(TunedSysctls()); len(changes) != 0 {
+		t.Errorf("PlanSysctl() on a tuned kernel = %+v, want none", changes)
+	}
+}
+
+func TestGenerateSysctlDropIn(t *testing.T) {
+	content := GenerateSysctlDropIn([]SysctlChange{
+		{SysctlSetting: SysctlSetting{Key: "vm.swappiness", Value: "10", Reason: "Keep caches"}, Current: "60"},
+	})
+	for _, want := range []string{"Generated by servctl", "sysctl --system", "# Keep caches (was 60)", "vm.swappiness = 10"} {
+		if !strings.Contains(content, want) {
+			t.Errorf("drop-in missing %q:\n%s", want, content)
+		}
+	}
+}
+
+func TestMergeSysctlDropIn(t *testing.T) {
+	existing := GenerateSysctlDropIn([]SysctlChange{
+		{SysctlSetting: SysctlSetting{Key: "vm.swappiness", Value: "10", Reason: "Keep caches"}, Current: "60"},
+		{SysctlSetting: SysctlSetting{Key: "fs.file-max", Value: "2097152", Reason: "Open files"}, Current: "100000"},
+	})
+	merged := mergeSysctlDropIn(existing, []SysctlChange{
+		{SysctlSetting: SysctlSetting{Key: "vm.swappiness", Value: "5", Reason: "Keep caches"}, Current: "60"},
+		{SysctlSetting: SysctlSetting{Key: "net.core.somaxconn", Value: "4096", Reason: "Bursts"}, Current: "128"},
+	})
+
+	if strings.Count(merged, "vm.swappiness") != 1 || !strings.Contains(merged, "vm.swappiness = 5") {
+		t.Errorf("existing key not updated in place:\n%s", merged)
+	}
+	if !strings.Contains(merged, "fs.file-max = 2097152") {
+		t.Errorf("earlier setting lost:\n%s", merged)
+	}
+	if !strings.Contains(merged, "# Bursts (was 128)\nnet.core.somaxconn = 4096") {
+		t.Errorf("new key not appended:\n%s", merged)
+	}
+}
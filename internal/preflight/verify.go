@@ -0,0 +1,252 @@
+package preflight
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// DockerKeyURL is Docker's apt repository signing key
+const DockerKeyURL = "https://download.docker.com/linux/ubuntu/gpg"
+
+// DockerKeyFingerprint is the pinned fingerprint of Docker's release key
+// (Docker Release (CE deb) <docker@docker.com>)
+const DockerKeyFingerprint = "9DC858229FC7DD38854AE2D88D81803C0EBFCD88"
+
+// DockerKeyringPath is where the verified key is installed for apt
+const DockerKeyringPath = "/etc/apt/keyrings/docker.gpg"
+
+// DockerSourcesPath is the apt source pinned to the verified key
+const DockerSourcesPath = "/etc/apt/sources.list.d/docker.list"
+
+// BundleChecksumFile lists the SHA-256 of every file in an offline bundle
+const BundleChecksumFile = "SHA256SUMS"
+
+// DockerPackages are installed from Docker's repository (or an offline bundle)
+var DockerPackages = []string{"docker-ce", "docker-ce-cli", "containerd.io", "docker-buildx-plugin", "docker-compose-plugin"}
+
+// VerificationOptions controls how downloaded installers are checked
+type VerificationOptions struct {
+	// DockerKeyFingerprint overrides the pinned key (e.g., after Docker rotates it)
+	DockerKeyFingerprint string
+	// OfflineBundle is a directory of .deb packages plus SHA256SUMS to install
+	// from instead of the network
+	OfflineBundle string
+}
+
+// Verification is used by InstallDependency; main sets it from flags
+var Verification = VerificationOptions{DockerKeyFingerprint: DockerKeyFingerprint}
+
+// normalizeFingerprint strips spaces and upper-cases a key fingerprint
+func normalizeFingerprint(fpr string) string {
+	return strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(fpr), " ", ""))
+}
+
+// SHA256File returns the hex SHA-256 digest of a file
+func SHA256File(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("failed to hash %s: %w", path, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// VerifyChecksum fails unless the file's SHA-256 matches want
+func VerifyChecksum(path, want string) error {
+	got, err := SHA256File(path)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(got, strings.TrimSpace(want)) {
+		return fmt.Errorf("checksum mismatch for %s: got %s, want %s", filepath.Base(path), got, want)
+	}
+	return nil
+}
+
+// parseGPGFingerprints extracts primary key fingerprints from
+// `gpg --with-colons` output (the fpr line that follows each pub line)
+func parseGPGFingerprints(output string) []string {
+	var fprs []string
+	afterPub := false
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Split(line, ":")
+		switch fields[0] {
+		case "pub":
+			afterPub = true
+		case "fpr":
+			if afterPub && len(fields) > 9 {
+				fprs = append(fprs, normalizeFingerprint(fields[9]))
+			}
+			afterPub = false
+		}
+	}
+	return fprs
+}
+
+// VerifyGPGKey checks that a downloaded key file contains exactly the expected key
+func VerifyGPGKey(path, fingerprint string) error {
+	output, err := exec.Command("gpg", "--show-keys", "--with-colons", path).Output()
+	if err != nil {
+		return fmt.Errorf("failed to read key %s: %w", path, err)
+	}
+
+	fprs := parseGPGFingerprints(string(output))
+	want := normalizeFingerprint(fingerprint)
+	if len(fprs) != 1 || fprs[0] != want {
+		return fmt.Errorf("key fingerprint mismatch: got %s, want %s", strings.Join(fprs, ", "), want)
+	}
+	return nil
+}
+
+// downloadFile fetches url into dest over HTTPS
+func downloadFile(url, dest string) error {
+	cmd := exec.Command("curl", "-fsSL", "--proto", "=https", "--tlsv1.2", "-o", dest, url)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to download %s: %s", url, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// parseChecksumFile reads sha256sum-style "HASH  FILE" lines
+func parseChecksumFile(r io.Reader) (map[string]string, error) {
+	sums := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 || len(fields[0]) != sha256.Size*2 {
+			return nil, fmt.Errorf("malformed checksum line: %q", line)
+		}
+		sums[strings.TrimPrefix(fields[1], "*")] = fields[0]
+	}
+	return sums, scanner.Err()
+}
+
+// VerifyBundle checks every package in an offline bundle against its
+// SHA256SUMS (and the detached SHA256SUMS.asc signature when present) and
+// returns the verified package paths
+func VerifyBundle(dir string) ([]string, error) {
+	sumsPath := filepath.Join(dir, BundleChecksumFile)
+	f, err := os.Open(sumsPath)
+	if err != nil {
+		return nil, fmt.Errorf("offline bundle has no %s: %w", BundleChecksumFile, err)
+	}
+	defer f.Close()
+
+	sums, err := parseChecksumFile(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", sumsPath, err)
+	}
+
+	if _, err := os.Stat(sumsPath + ".asc"); err == nil {
+		cmd := exec.Command("gpg", "--verify", sumsPath+".asc", sumsPath)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return nil, fmt.Errorf("signature check failed for %s: %s", sumsPath, strings.TrimSpace(string(output)))
+		}
+	}
+
+	debs, _ := filepath.Glob(filepath.Join(dir, "*.deb"))
+	if len(debs) == 0 {
+		return nil, fmt.Errorf("offline bundle %s contains no .deb packages", dir)
+	}
+	for _, deb := range debs {
+		want, ok := sums[filepath.Base(deb)]
+		if !ok {
+			return nil, fmt.Errorf("%s is not listed in %s", filepath.Base(deb), BundleChecksumFile)
+		}
+		if err := VerifyChecksum(deb, want); err != nil {
+			return nil, err
+		}
+	}
+	return debs, nil
+}
+
+// dockerSourcesLine returns the apt source entry bound to the verified key
+func dockerSourcesLine(arch, codename string) string {
+	return fmt.Sprintf("deb [arch=%s signed-by=%s] https://download.docker.com/linux/ubuntu %s stable\n",
+		arch, DockerKeyringPath, codename)
+}
+
+// installDockerVerified installs Docker from its apt repository after checking
+// the signing key against the pinned fingerprint, or from a verified offline
+// bundle. Replaces piping get.docker.com into sh.
+func installDockerVerified(opts VerificationOptions) error {
+	if opts.OfflineBundle != "" {
+		debs, err := VerifyBundle(opts.OfflineBundle)
+		if err != nil {
+			return err
+		}
+		_, err = packageManager.Install(debs, PackageProgress)
+		return err
+	}
+
+	osInfo, err := parseOSRelease()
+	if err != nil {
+		return err
+	}
+	archOut, err := exec.Command("dpkg", "--print-architecture").Output()
+	if err != nil {
+		return fmt.Errorf("failed to detect architecture: %w", err)
+	}
+
+	tmp, err := os.MkdirTemp("", "servctl-docker-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	keyPath := filepath.Join(tmp, "docker.asc")
+	if err := downloadFile(DockerKeyURL, keyPath); err != nil {
+		return err
+	}
+	if err := VerifyGPGKey(keyPath, opts.DockerKeyFingerprint); err != nil {
+		return err
+	}
+
+	sourcesPath := filepath.Join(tmp, "docker.list")
+	sources := dockerSourcesLine(strings.TrimSpace(string(archOut)), osInfo.VersionCodename)
+	if err := os.WriteFile(sourcesPath, []byte(sources), 0644); err != nil {
+		return err
+	}
+
+	steps := [][]string{
+		{"sudo", "install", "-m", "0755", "-d", filepath.Dir(DockerKeyringPath)},
+		{"sudo", "gpg", "--batch", "--yes", "--dearmor", "-o", DockerKeyringPath, keyPath},
+		{"sudo", "chmod", "a+r", DockerKeyringPath},
+		{"sudo", "install", "-m", "0644", sourcesPath, DockerSourcesPath},
+	}
+	for _, step := range steps {
+		if err := runInteractive(step[0], step[1:]...); err != nil {
+			return fmt.Errorf("%s failed: %w", strings.Join(step, " "), err)
+		}
+	}
+
+	if _, err := packageManager.Update(PackageProgress); err != nil {
+		return err
+	}
+	_, err = packageManager.Install(DockerPackages, PackageProgress)
+	return err
+}
+
+// runInteractive runs a command with output attached to the terminal
+func runInteractive(name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
@@ -0,0 +1,98 @@
+package preflight
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseGPGFingerprints(t *testing.T) {
+	output := `pub:-:4096:1:8D81803C0EBFCD88:1487788586:::-:::scESA::::::23::0:
+fpr:::::::::9DC858229FC7DD38854AE2D88D81803C0EBFCD88:
+uid:-::::1487792064::B5A08F01796E7F521861B449372D1FF271F2DD50::Docker Release (CE deb) <docker@docker.com>::::::::::0:
+sub:-:4096:1:7EA0A9C3F273FCD8:1487788586::::::s::::::23:
+fpr:::::::::D3306A018370199E527AE7997EA0A9C3F273FCD8:
+`
+	fprs := parseGPGFingerprints(output)
+	if len(fprs) != 1 || fprs[0] != DockerKeyFingerprint {
+		t.Errorf("parseGPGFingerprints() = %v, want only the primary key %s", fprs, DockerKeyFingerprint)
+	}
+}
+
+func TestNormalizeFingerprint(t *testing.T) {
+	got := normalizeFingerprint(" 9dc8 5822 9fc7 dd38 854a e2d8 8d81 803c 0ebf cd88 ")
+	if got != DockerKeyFingerprint {
+		t.Errorf("normalizeFingerprint() = %s, want %s", got, DockerKeyFingerprint)
+	}
+}
+
+func TestVerifyChecksum(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(path, []byte("hello\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// sha256sum of "hello\n"
+	good := "5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03"
+	if err := VerifyChecksum(path, good); err != nil {
+		t.Errorf("VerifyChecksum(good) error: %v", err)
+	}
+	if err := VerifyChecksum(path, strings.ToUpper(good)); err != nil {
+		t.Errorf("VerifyChecksum should ignore case: %v", err)
+	}
+	if err := VerifyChecksum(path, strings.Repeat("0", 64)); err == nil {
+		t.Error("VerifyChecksum(bad) should fail")
+	}
+}
+
+func TestVerifyBundle(t *testing.T) {
+	dir := t.TempDir()
+	deb := filepath.Join(dir, "docker-ce.deb")
+	if err := os.WriteFile(deb, []byte("hello\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sums := "5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03  docker-ce.deb\n"
+	if err := os.WriteFile(filepath.Join(dir, BundleChecksumFile), []byte(sums), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	debs, err := VerifyBundle(dir)
+	if err != nil {
+		t.Fatalf("VerifyBundle() error: %v", err)
+	}
+	if len(debs) != 1 || debs[0] != deb {
+		t.Errorf("VerifyBundle() = %v, want [%s]", debs, deb)
+	}
+
+	// Tampered package
+	if err := os.WriteFile(deb, []byte("tampered\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyBundle(dir); err == nil {
+		t.Error("VerifyBundle() should reject a modified package")
+	}
+
+	// Unlisted package
+	if err := os.WriteFile(deb, []byte("hello\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "extra.deb"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyBundle(dir); err == nil {
+		t.Error("VerifyBundle() should reject packages missing from SHA256SUMS")
+	}
+
+	if _, err := VerifyBundle(t.TempDir()); err == nil {
+		t.Error("VerifyBundle() should fail without SHA256SUMS")
+	}
+}
+
+func TestDockerSourcesLine(t *testing.T) {
+	line := dockerSourcesLine("amd64", "noble")
+	want := "deb [arch=amd64 signed-by=/etc/apt/keyrings/docker.gpg] https://download.docker.com/linux/ubuntu noble stable\n"
+	if line != want {
+		t.Errorf("dockerSourcesLine() = %q, want %q", line, want)
+	}
+}
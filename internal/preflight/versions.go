@@ -0,0 +1,118 @@
+package preflight
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Version is a parsed major.minor.patch version
+type Version struct {
+	Major, Minor, Patch int
+}
+
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// Compare returns -1, 0 or 1 as v is older than, equal to or newer than o
+func (v Version) Compare(o Version) int {
+	for _, d := range []int{v.Major - o.Major, v.Minor - o.Minor, v.Patch - o.Patch} {
+		if d < 0 {
+			return -1
+		}
+		if d > 0 {
+			return 1
+		}
+	}
+	return 0
+}
+
+// versionRegex finds the first dotted version in tool output ("v2.29.1", "7.4")
+var versionRegex = regexp.MustCompile(`v?(\d+)\.(\d+)(?:\.(\d+))?`)
+
+// ParseVersion extracts the first version number from --version output
+func ParseVersion(output string) (Version, bool) {
+	m := versionRegex.FindStringSubmatch(output)
+	if m == nil {
+		return Version{}, false
+	}
+	var v Version
+	v.Major, _ = strconv.Atoi(m[1])
+	v.Minor, _ = strconv.Atoi(m[2])
+	if m[3] != "" {
+		v.Patch, _ = strconv.Atoi(m[3])
+	}
+	return v, true
+}
+
+// VersionRequirement is one row of the compatibility matrix
+type VersionRequirement struct {
+	Min     Version
+	Command []string // Prints the version; the first version in its output is used
+	Reason  string   // What breaks on older versions
+	Upgrade string   // How to get a newer version
+}
+
+// CompatibilityMatrix lists minimum versions by Dependency.Binary. Missing
+// the minimum fails blockers and warns for everything else.
+var CompatibilityMatrix = map[string]VersionRequirement{
+	"docker": {
+		Min:     Version{24, 0, 0},
+		Command: []string{"docker", "--version"},
+		Reason:  "healthcheck start_interval and current compose features",
+		Upgrade: "apt install -y docker-ce (from download.docker.com)",
+	},
+	"docker compose": {
+		Min:     Version{2, 20, 0},
+		Command: []string{"docker", "compose", "version", "--short"},
+		Reason:  "depends_on with condition and restart",
+		Upgrade: "apt install -y docker-compose-plugin (from download.docker.com)",
+	},
+	"smartctl": {
+		Min:     Version{7, 0, 0},
+		Command: []string{"smartctl", "--version"},
+		Reason:  "NVMe health reporting",
+		Upgrade: "apt install -y smartmontools (use backports on older releases)",
+	},
+}
+
+// applyVersionRequirement compares a tool's version output with its matrix
+// entry and downgrades a passing result when the minimum is not met
+func applyVersionRequirement(dep Dependency, req VersionRequirement, output string, result *CheckResult) {
+	v, ok := ParseVersion(output)
+	if !ok {
+		result.Status = StatusWarn
+		result.Message = fmt.Sprintf("%s is installed but its version could not be determined", dep.Name)
+		result.Details = append(result.Details, fmt.Sprintf("Requires: %s or newer", req.Min))
+		return
+	}
+
+	if v.Compare(req.Min) >= 0 {
+		result.Details = append(result.Details, fmt.Sprintf("Version %s meets minimum %s", v, req.Min))
+		return
+	}
+
+	if dep.Criticality == "blocker" {
+		result.Status = StatusFail
+	} else {
+		result.Status = StatusWarn
+	}
+	result.Message = fmt.Sprintf("%s %s is older than the required %s", dep.Name, v, req.Min)
+	result.Details = append(result.Details,
+		fmt.Sprintf("Needed for: %s", req.Reason),
+		fmt.Sprintf("Upgrade with: sudo %s", req.Upgrade))
+}
+
+// checkVersionRequirement runs the version command for dep, if the matrix
+// has an entry for it, and applies the result
+func checkVersionRequirement(dep Dependency, result *CheckResult) {
+	req, ok := CompatibilityMatrix[dep.Binary]
+	if !ok {
+		return
+	}
+	output, _ := exec.Command(req.Command[0], req.Command[1:]...).Output()
+	applyVersionRequirement(dep, req, strings.TrimSpace(string(output)), result)
+}
@@ -0,0 +1,69 @@
+package preflight
+
+import "testing"
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		output string
+		want   Version
+		ok     bool
+	}{
+		{"Docker version 27.1.1, build 6312585", Version{27, 1, 1}, true},
+		{"v2.29.1", Version{2, 29, 1}, true},
+		{"2.20.2-desktop.1", Version{2, 20, 2}, true},
+		{"smartctl 7.4 2023-08-01 r5530 [x86_64-linux-6.8.0] (local build)", Version{7, 4, 0}, true},
+		{"no version here", Version{}, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := ParseVersion(tt.output)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("ParseVersion(%q) = %v, %v; want %v, %v", tt.output, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestVersionCompare(t *testing.T) {
+	tests := []struct {
+		a, b Version
+		want int
+	}{
+		{Version{24, 0, 0}, Version{24, 0, 0}, 0},
+		{Version{23, 9, 9}, Version{24, 0, 0}, -1},
+		{Version{2, 20, 1}, Version{2, 20, 0}, 1},
+		{Version{2, 9, 0}, Version{2, 20, 0}, -1},
+	}
+
+	for _, tt := range tests {
+		if got := tt.a.Compare(tt.b); got != tt.want {
+			t.Errorf("%v.Compare(%v) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestApplyVersionRequirement(t *testing.T) {
+	docker := Dependency{Name: "Docker", Binary: "docker", Criticality: "blocker"}
+	smart := Dependency{Name: "smartmontools", Binary: "smartctl", Criticality: "recommended"}
+
+	tests := []struct {
+		name   string
+		dep    Dependency
+		output string
+		want   Status
+	}{
+		{"new docker", docker, "Docker version 27.1.1, build 6312585", StatusPass},
+		{"old docker", docker, "Docker version 20.10.24, build 297e128", StatusFail},
+		{"old smartctl", smart, "smartctl 6.6 2016-05-31 r4324", StatusWarn},
+		{"unparseable", docker, "", StatusWarn},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := CheckResult{Status: StatusPass}
+			applyVersionRequirement(tt.dep, CompatibilityMatrix[tt.dep.Binary], tt.output, &result)
+			if result.Status != tt.want {
+				t.Errorf("Status = %v, want %v (%s)", result.Status, tt.want, result.Message)
+			}
+		})
+	}
+}
@@ -0,0 +1,245 @@
+// Package recording records a terminal session in the asciicast v2 format
+// (https://docs.asciinema.org/manual/asciicast/v2/), so the setup wizard can
+// be replayed later with 'asciinema play' or attached to a bug report.
+// Secrets are masked when the recording is written.
+package recording
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/madhav/servctl/internal/utils"
+)
+
+// SessionFile is where the setup wizard keeps its recording, relative to
+// ~/infra
+const SessionFile = "docs/setup-session.cast"
+
+// event is one chunk of terminal output
+type event struct {
+	at   time.Duration
+	data []byte
+}
+
+// Cast is a recording held in memory until it is written; secrets only
+// become known as the session goes on (generated or typed passwords), so
+// nothing is written before all of them can be masked
+type Cast struct {
+	Width, Height int
+	Title         string
+	Start         time.Time
+
+	mu      sync.Mutex
+	events  []event
+	partial []byte // Incomplete UTF-8 sequence held for the next write
+	secrets []string
+}
+
+// NewCast starts an empty recording
+func NewCast(width, height int, title string) *Cast {
+	return &Cast{Width: width, Height: height, Title: title, Start: time.Now()}
+}
+
+// Write records output as it appeared on the terminal. Events are cut at
+// character boundaries so each is valid UTF-8.
+func (c *Cast) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data := append(c.partial, p...)
+	cut := len(data)
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				cut = i
+			}
+			break
+		}
+	}
+	c.partial = append([]byte(nil), data[cut:]...)
+	if cut > 0 {
+		// Like the terminal (onlcr), start each new line at the left margin
+		out := bytes.ReplaceAll(data[:cut], []byte("\n"), []byte("\r\n"))
+		c.events = append(c.events, event{at: time.Since(c.Start), data: out})
+	}
+	return len(p), nil
+}
+
+// Mask adds values that must not appear in the written recording
+func (c *Cast) Mask(secrets ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, s := range secrets {
+		// Very short values would mask ordinary text
+		if len(s) >= 6 {
+			c.secrets = append(c.secrets, s)
+		}
+	}
+}
+
+// masked returns the events with every secret replaced by asterisks. The
+// events are joined before masking, so a secret split across two writes is
+// still caught; a mask as long as the secret keeps the event boundaries.
+func (c *Cast) masked() []event {
+	var all []byte
+	for _, e := range c.events {
+		all = append(all, e.data...)
+	}
+	all = append(all, c.partial...)
+	for _, s := range c.secrets {
+		all = bytes.ReplaceAll(all, []byte(s), bytes.Repeat([]byte("*"), len(s)))
+	}
+
+	events := make([]event, 0, len(c.events)+1)
+	offset := 0
+	for _, e := range c.events {
+		events = append(events, event{at: e.at, data: all[offset : offset+len(e.data)]})
+		offset += len(e.data)
+	}
+	if offset < len(all) {
+		events = append(events, event{at: time.Since(c.Start), data: all[offset:]})
+	}
+	return events
+}
+
+// Encode writes the recording in asciicast v2: a header line, then one
+// [seconds, "o", data] line per event
+func (c *Cast) Encode(w io.Writer) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	header := map[string]interface{}{
+		"version":   2,
+		"width":     c.Width,
+		"height":    c.Height,
+		"timestamp": c.Start.Unix(),
+		"env":       map[string]string{"TERM": os.Getenv("TERM"), "SHELL": os.Getenv("SHELL")},
+	}
+	if c.Title != "" {
+		header["title"] = c.Title
+	}
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(header); err != nil {
+		return err
+	}
+	for _, e := range c.masked() {
+		if err := enc.Encode([]interface{}{roundSeconds(e.at), "o", string(e.data)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// roundSeconds converts a duration to seconds with microsecond precision
+func roundSeconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1e6
+}
+
+// Session records everything the process prints, and the answers typed in,
+// until Stop. It swaps os.Stdout and os.Stdin for pipes and copies them to
+// the real terminal and the recording.
+type Session struct {
+	Cast *Cast
+	path string
+
+	stdout, stdin       *os.File // The real terminal
+	outReader, outWrite *os.File
+	inWrite             *os.File
+	copied              sync.WaitGroup
+}
+
+// Start begins recording; path is written when the session stops
+func Start(path, title string) (*Session, error) {
+	outReader, outWrite, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	inReader, inWrite, err := os.Pipe()
+	if err != nil {
+		outReader.Close()
+		outWrite.Close()
+		return nil, err
+	}
+
+	width, height := terminalSize(os.Stdout, os.Stdin, os.Stderr)
+	s := &Session{
+		Cast:      NewCast(width, height, title),
+		path:      path,
+		stdout:    os.Stdout,
+		stdin:     os.Stdin,
+		outReader: outReader,
+		outWrite:  outWrite,
+		inWrite:   inWrite,
+	}
+
+	s.copied.Add(1)
+	go func() {
+		defer s.copied.Done()
+		io.Copy(io.MultiWriter(s.stdout, s.Cast), outReader)
+	}()
+	// The terminal echoes what is typed, so input is recorded as output.
+	// This goroutine stays blocked on the terminal after Stop; the process
+	// exits soon after.
+	go func() {
+		io.Copy(io.MultiWriter(inWrite, s.Cast), s.stdin)
+		inWrite.Close()
+	}()
+
+	os.Stdout = outWrite
+	os.Stdin = inReader
+	return s, nil
+}
+
+// Mask adds values that must not appear in the recording. It does nothing
+// when no session is being recorded.
+func (s *Session) Mask(secrets ...string) {
+	if s == nil {
+		return
+	}
+	s.Cast.Mask(secrets...)
+}
+
+// Stop restores the terminal and writes the recording (mode 0600: even
+// masked, it describes the server in detail)
+func (s *Session) Stop() error {
+	s.restoreTerminal()
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := s.Cast.Encode(&buf); err != nil {
+		return err
+	}
+	if err := utils.AtomicWrite(s.path, buf.Bytes(), 0600); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Discard restores the terminal without writing the recording, for a
+// session interrupted before all its secrets were known
+func (s *Session) Discard() {
+	s.restoreTerminal()
+}
+
+// restoreTerminal puts the real terminal back once all output is copied
+func (s *Session) restoreTerminal() {
+	os.Stdout = s.stdout
+	os.Stdin = s.stdin
+	s.outWrite.Close()
+	s.copied.Wait()
+	s.outReader.Close()
+}
+
+// Path is where the recording is written
+func (s *Session) Path() string {
+	return s.path
+}
@@ -0,0 +1,96 @@
+package recording
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// decode returns the header and the concatenated output of a recording
+func decode(t *testing.T, data []byte) (map[string]interface{}, string) {
+	t.Helper()
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	var header map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &header); err != nil {
+		t.Fatalf("header: %v", err)
+	}
+	var out strings.Builder
+	for _, line := range lines[1:] {
+		var e []interface{}
+		if err := json.Unmarshal([]byte(line), &e); err != nil || len(e) != 3 || e[1] != "o" {
+			t.Fatalf("bad event %s: %v", line, err)
+		}
+		out.WriteString(e[2].(string))
+	}
+	return header, out.String()
+}
+
+func TestCast_MasksSecrets(t *testing.T) {
+	c := NewCast(100, 30, "test")
+	c.Write([]byte("Password: hunter2-very"))
+	c.Write([]byte("-secret\nDone ✓\n"))
+	c.Mask("hunter2-very-secret", "abc")
+
+	var buf bytes.Buffer
+	if err := c.Encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	header, out := decode(t, buf.Bytes())
+	if header["version"] != float64(2) || header["width"] != float64(100) || header["title"] != "test" {
+		t.Errorf("header = %v", header)
+	}
+	if strings.Contains(out, "hunter2") || strings.Contains(out, "secret") {
+		t.Errorf("secret split across writes leaked: %q", out)
+	}
+	if want := "Password: *******************\r\nDone ✓\r\n"; out != want {
+		t.Errorf("output = %q, want %q", out, want)
+	}
+}
+
+func TestCast_SplitRune(t *testing.T) {
+	c := NewCast(80, 24, "")
+	check := []byte("✓")
+	c.Write(check[:1])
+	c.Write(check[1:])
+
+	var buf bytes.Buffer
+	c.Encode(&buf)
+	if _, out := decode(t, buf.Bytes()); out != "✓" {
+		t.Errorf("output = %q, want ✓", out)
+	}
+}
+
+func TestSession(t *testing.T) {
+	path := filepath.Join(t.TempDir(), SessionFile)
+	s, err := Start(path, "servctl -start-setup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Println("Admin password: correct-horse-battery")
+	s.Mask("correct-horse-battery")
+	if err := s.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if os.Stdout != s.stdout {
+		t.Error("Stop() should restore os.Stdout")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+		t.Errorf("mode = %v, want 0600", info.Mode().Perm())
+	}
+	_, out := decode(t, data)
+	if !strings.Contains(out, "Admin password: ****") || strings.Contains(out, "correct-horse") {
+		t.Errorf("recording = %q", out)
+	}
+
+	var none *Session
+	none.Mask("ignored") // No session: nothing to do
+}
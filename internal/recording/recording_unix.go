@@ -0,0 +1,22 @@
+//go:build !windows
+
+package recording
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// terminalSize returns the terminal's columns and rows, 80x24 when unknown.
+// Standard output may already be a pipe (plain output over SSH), so the
+// other files are tried too.
+func terminalSize(files ...*os.File) (int, int) {
+	for _, f := range files {
+		ws, err := unix.IoctlGetWinsize(int(f.Fd()), unix.TIOCGWINSZ)
+		if err == nil && ws.Col > 0 && ws.Row > 0 {
+			return int(ws.Col), int(ws.Row)
+		}
+	}
+	return 80, 24
+}
@@ -0,0 +1,9 @@
+package recording
+
+import "os"
+
+// terminalSize is not measured on Windows; sessions are recorded on the
+// server
+func terminalSize(...*os.File) (int, int) {
+	return 80, 24
+}
@@ -0,0 +1,292 @@
+package report
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"html"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Credential delivery modes (servctl -credentials)
+const (
+	DeliverPrint = "print" // Show them in the report (the default)
+	DeliverFile  = "file"  // Write an encrypted file, print only its key
+	DeliverLink  = "link"  // Serve them once on the LAN
+)
+
+// DeliveryModes lists the valid -credentials values
+var DeliveryModes = []string{DeliverPrint, DeliverFile, DeliverLink}
+
+// CredentialsFile is the encrypted credentials file's name in ~/infra
+const CredentialsFile = "credentials.enc"
+
+// LinkTimeout is how long a one-time link waits to be opened
+const LinkTimeout = 15 * time.Minute
+
+// CredentialsText renders the credentials and family logins as plain text,
+// for delivery anywhere other than this terminal
+func CredentialsText(report *MissionReport) string {
+	var b strings.Builder
+
+	layout := report.DateLayout
+	if layout == "" {
+		layout = "2006-01-02 15:04"
+	}
+	fmt.Fprintf(&b, "servctl credentials for %s (%s)\n", report.HostIP, time.Now().Format(layout))
+	b.WriteString("Store them in a password manager, then delete this file.\n\n")
+
+	fmt.Fprintf(&b, "Nextcloud admin (%s)\n", report.NextcloudURL)
+	fmt.Fprintf(&b, "  Username: %s\n", report.NextcloudAdminUser)
+	fmt.Fprintf(&b, "  Password: %s\n\n", report.NextcloudAdminPass)
+
+	if report.ImmichAdminCreated && report.ImmichAdminPass != "" {
+		fmt.Fprintf(&b, "Immich admin (%s)\n", report.ImmichURL)
+		fmt.Fprintf(&b, "  Email:    %s\n", report.ImmichAdminEmail)
+		fmt.Fprintf(&b, "  Password: %s\n\n", report.ImmichAdminPass)
+	}
+
+	if report.SSOEnabled {
+		fmt.Fprintf(&b, "Authentik (SSO) admin (%s)\n", report.AuthentikURL)
+		b.WriteString("  Username: akadmin\n")
+		fmt.Fprintf(&b, "  Password: %s\n\n", report.AuthentikAdminPass)
+	}
+
+	if report.ConfigBackupKey != "" {
+		b.WriteString("Config backup passphrase\n")
+		fmt.Fprintf(&b, "  %s\n", report.ConfigBackupKey)
+		fmt.Fprintf(&b, "  Store offline - restore with %s/restore-infra-config.sh\n\n", report.ScriptsDir)
+	}
+
+	b.WriteString("Database passwords\n")
+	fmt.Fprintf(&b, "  Immich (PostgreSQL):    %s\n", report.ImmichDBPassword)
+	fmt.Fprintf(&b, "  Nextcloud (MariaDB):    %s\n\n", report.NextcloudDBPassword)
+
+	for _, u := range report.Users {
+		fmt.Fprintf(&b, "%s\n", u.Name)
+		fmt.Fprintf(&b, "  Nextcloud username: %s\n", u.Username)
+		fmt.Fprintf(&b, "  Immich email:       %s\n", u.Email)
+		fmt.Fprintf(&b, "  Password:           %s (Immich asks for a new one at the first login; change the Nextcloud one under Personal settings → Security)\n", u.Password)
+		if u.ImmichAPIKey != "" {
+			fmt.Fprintf(&b, "  Immich API key:     %s\n", u.ImmichAPIKey)
+		}
+		b.WriteString("\n")
+	}
+
+	fmt.Fprintf(&b, "All of these are also in %s/.env (mode 0600).\n", report.ComposeDir)
+	return b.String()
+}
+
+// randomToken returns n random bytes, URL-safe encoded
+func randomToken(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// EncryptedCredentials describes a written credentials file and how to
+// open it
+type EncryptedCredentials struct {
+	Path    string
+	Key     string // age secret key or openssl passphrase
+	Decrypt string // Command that prints the credentials
+}
+
+// WriteEncryptedCredentials encrypts text to path. With age installed the
+// file is encrypted to a fresh age key; otherwise openssl encrypts it with
+// a generated passphrase, as the config backups are. Either way the key is
+// only ever shown, never stored next to the file.
+func WriteEncryptedCredentials(path, text string) (*EncryptedCredentials, error) {
+	if _, err := exec.LookPath("age"); err == nil {
+		if _, err := exec.LookPath("age-keygen"); err == nil {
+			return encryptWithAge(path, text)
+		}
+	}
+	if _, err := exec.LookPath("openssl"); err != nil {
+		return nil, fmt.Errorf("neither age nor openssl is installed")
+	}
+
+	passphrase, err := randomToken(24)
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command("openssl", "enc", "-aes-256-cbc", "-pbkdf2", "-salt", "-pass", "env:SERVCTL_CREDENTIALS_KEY", "-out", path)
+	cmd.Env = append(os.Environ(), "SERVCTL_CREDENTIALS_KEY="+passphrase)
+	cmd.Stdin = strings.NewReader(text)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("openssl failed: %s: %w", strings.TrimSpace(string(output)), err)
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		return nil, err
+	}
+	return &EncryptedCredentials{
+		Path:    path,
+		Key:     passphrase,
+		Decrypt: fmt.Sprintf("openssl enc -d -aes-256-cbc -pbkdf2 -in %s", path),
+	}, nil
+}
+
+// encryptWithAge encrypts text to a new age identity
+func encryptWithAge(path, text string) (*EncryptedCredentials, error) {
+	output, err := exec.Command("age-keygen").Output()
+	if err != nil {
+		return nil, fmt.Errorf("age-keygen failed: %w", err)
+	}
+	var identity, recipient string
+	for _, line := range strings.Split(string(output), "\n") {
+		switch {
+		case strings.HasPrefix(line, "AGE-SECRET-KEY-"):
+			identity = strings.TrimSpace(line)
+		case strings.HasPrefix(line, "# public key: "):
+			recipient = strings.TrimSpace(strings.TrimPrefix(line, "# public key: "))
+		}
+	}
+	if identity == "" || recipient == "" {
+		return nil, fmt.Errorf("unexpected age-keygen output")
+	}
+
+	cmd := exec.Command("age", "-r", recipient, "-o", path)
+	cmd.Stdin = strings.NewReader(text)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("age failed: %s: %w", strings.TrimSpace(string(output)), err)
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		return nil, err
+	}
+	return &EncryptedCredentials{
+		Path:    path,
+		Key:     identity,
+		Decrypt: fmt.Sprintf("age -d -i key.txt %s (key.txt holds the key)", path),
+	}, nil
+}
+
+// RenderEncryptedCredentials shows where the credentials went and the key
+// that opens them, as a QR code when qrencode is installed
+func RenderEncryptedCredentials(enc *EncryptedCredentials) string {
+	var b strings.Builder
+
+	b.WriteString(WarningStyle.Render("🔐 CREDENTIALS WRITTEN ENCRYPTED") + "\n")
+	b.WriteString(fmt.Sprintf("  File: %s\n\n", enc.Path))
+	b.WriteString(SectionStyle.Render("Key (shown once):") + "\n")
+	b.WriteString(fmt.Sprintf("  %s\n", CredentialStyle.Render(enc.Key)))
+	if qr := renderQRCode(enc.Key); qr != "" {
+		b.WriteString("\n  Scan it into your password manager:\n")
+		b.WriteString(qr)
+	}
+	b.WriteString("\n" + MutedStyle.Render("Open with: "+enc.Decrypt) + "\n")
+	b.WriteString(MutedStyle.Render("Copy the file off the server, then delete it."))
+
+	return CredentialBoxStyle.Render(b.String())
+}
+
+// OneTimeLink serves text once over HTTP. Opening the link shows a button;
+// the credentials are only sent when it is pressed, so link previews in
+// chat apps cannot use up the link. After that, or after the timeout, the
+// server stops.
+type OneTimeLink struct {
+	URL string
+
+	listener net.Listener
+	server   *http.Server
+	done     chan struct{}
+	once     sync.Once
+}
+
+// ServeOnce starts serving text at a random path on host (an IP address
+// reachable from the LAN) and an ephemeral port
+func ServeOnce(host, text string) (*OneTimeLink, error) {
+	token, err := randomToken(18)
+	if err != nil {
+		return nil, err
+	}
+	listener, err := net.Listen("tcp", net.JoinHostPort(host, "0"))
+	if err != nil {
+		return nil, err
+	}
+
+	link := &OneTimeLink{
+		URL:      fmt.Sprintf("http://%s/%s", listener.Addr().String(), token),
+		listener: listener,
+		done:     make(chan struct{}),
+	}
+
+	var mu sync.Mutex
+	served := false
+	mux := http.NewServeMux()
+	mux.HandleFunc("/"+token, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Referrer-Policy", "no-referrer")
+
+		mu.Lock()
+		defer mu.Unlock()
+		if served {
+			http.Error(w, "This link has already been used.", http.StatusGone)
+			return
+		}
+		if r.Method != http.MethodPost {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			fmt.Fprint(w, `<!doctype html><title>servctl credentials</title>
+<p>These credentials can be shown only once. Have your password manager ready.</p>
+<form method="post"><button>Show credentials</button></form>`)
+			return
+		}
+		served = true
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprintf(w, "<!doctype html><title>servctl credentials</title><pre>%s</pre>", html.EscapeString(text))
+		go link.Close()
+	})
+
+	link.server = &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go link.server.Serve(listener)
+	return link, nil
+}
+
+// Wait blocks until the link was used (true) or timeout passed (false)
+func (l *OneTimeLink) Wait(timeout time.Duration) bool {
+	select {
+	case <-l.done:
+		return true
+	case <-time.After(timeout):
+		l.Close()
+		return false
+	}
+}
+
+// Close stops the server; the link no longer works
+func (l *OneTimeLink) Close() {
+	l.once.Do(func() {
+		l.server.Close()
+		close(l.done)
+	})
+}
+
+// RenderOneTimeLink shows the link to open, as a QR code when qrencode is
+// installed
+func RenderOneTimeLink(link *OneTimeLink) string {
+	var b strings.Builder
+
+	b.WriteString(WarningStyle.Render("🔐 CREDENTIALS: ONE-TIME LINK") + "\n")
+	b.WriteString(fmt.Sprintf("  %s\n", URLStyle.Render(link.URL)))
+	if qr := renderQRCode(link.URL); qr != "" {
+		b.WriteString("\n  Scan with a phone on the same network:\n")
+		b.WriteString(qr)
+	}
+	b.WriteString("\n" + MutedStyle.Render(fmt.Sprintf("Works once, from the LAN, for %d minutes. Plain HTTP: open it on a network you trust.", int(LinkTimeout.Minutes()))))
+
+	return CredentialBoxStyle.Render(b.String())
+}
+
+// RenderCredentialsDelivered stands in for the credentials in the report
+// when they were delivered some other way
+func RenderCredentialsDelivered(report *MissionReport) string {
+	return WarningStyle.Render("🔐 Credentials: "+report.CredentialsDelivered) + "\n" +
+		MutedStyle.Render(fmt.Sprintf("They are also in %s/.env (mode 0600).", report.ComposeDir))
+}
@@ -0,0 +1,126 @@
+package report
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/madhav/servctl/internal/compose"
+)
+
+func handoffReport() *MissionReport {
+	config := compose.DefaultConfig()
+	config.HostIP = "192.168.1.100"
+	config.NextcloudAdminPass = "nc-admin-secret"
+	config.ImmichDBPassword = "immich-db-secret"
+	config.NextcloudDBPassword = "nc-db-secret"
+	config.Users = []compose.FamilyMember{{Name: "Jane Doe", Username: "jane", Email: "jane@example.com", Password: "jane-secret"}}
+	return NewMissionReport(config, "/home/user/infra")
+}
+
+func TestCredentialsText(t *testing.T) {
+	text := CredentialsText(handoffReport())
+	for _, want := range []string{"nc-admin-secret", "immich-db-secret", "nc-db-secret", "jane-secret", "Jane Doe"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("CredentialsText() missing %q:\n%s", want, text)
+		}
+	}
+	if strings.Contains(text, "\x1b[") {
+		t.Error("CredentialsText() should be plain text")
+	}
+}
+
+func TestRenderMissionReport_CredentialsDelivered(t *testing.T) {
+	report := handoffReport()
+	report.CredentialsDelivered = "encrypted in /home/user/infra/credentials.enc"
+
+	output := RenderMissionReport(report)
+	for _, secret := range []string{"nc-admin-secret", "immich-db-secret", "jane-secret"} {
+		if strings.Contains(output, secret) {
+			t.Errorf("report shows %q although the credentials were delivered", secret)
+		}
+	}
+	if !strings.Contains(output, "credentials.enc") {
+		t.Error("report should say where the credentials went")
+	}
+}
+
+func TestWriteEncryptedCredentials(t *testing.T) {
+	if _, err := exec.LookPath("openssl"); err != nil {
+		t.Skip("openssl not installed")
+	}
+	path := filepath.Join(t.TempDir(), CredentialsFile)
+	enc, err := WriteEncryptedCredentials(path, "nc-admin-secret\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := os.ReadFile(path)
+	if len(data) == 0 || strings.Contains(string(data), "nc-admin-secret") {
+		t.Fatal("credentials file should hold ciphertext")
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+		t.Errorf("mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	if !strings.HasPrefix(enc.Decrypt, "openssl") {
+		return // Encrypted with age
+	}
+	cmd := exec.Command("openssl", "enc", "-d", "-aes-256-cbc", "-pbkdf2", "-pass", "pass:"+enc.Key, "-in", path)
+	output, err := cmd.Output()
+	if err != nil || string(output) != "nc-admin-secret\n" {
+		t.Errorf("decrypt = %q, %v", output, err)
+	}
+}
+
+func TestServeOnce(t *testing.T) {
+	link, err := ServeOnce("127.0.0.1", "nc-admin-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer link.Close()
+
+	// Opening the link (or a chat app previewing it) does not reveal anything
+	resp, err := http.Get(link.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if strings.Contains(string(body), "nc-admin-secret") || !strings.Contains(string(body), "<form") {
+		t.Errorf("GET should show the reveal button only:\n%s", body)
+	}
+
+	// Guessing the path does not work
+	u, _ := url.Parse(link.URL)
+	if resp, err := http.Get("http://" + u.Host + "/"); err == nil {
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("GET / = %d, want 404", resp.StatusCode)
+		}
+		resp.Body.Close()
+	}
+
+	resp, err = http.PostForm(link.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(body), "nc-admin-secret") {
+		t.Errorf("POST should reveal the credentials:\n%s", body)
+	}
+
+	if !link.Wait(5 * time.Second) {
+		t.Fatal("Wait() should return once the credentials were shown")
+	}
+	if resp, err := http.PostForm(link.URL, nil); err == nil {
+		resp.Body.Close()
+		t.Error("the server should stop after one delivery")
+	}
+}
@@ -3,11 +3,14 @@ package report
 
 import (
 	"fmt"
+	"os/exec"
 	"strings"
 	"time"
 
 	"github.com/charmbracelet/lipgloss"
 	"github.com/madhav/servctl/internal/compose"
+	"github.com/madhav/servctl/internal/paths"
+	"github.com/madhav/servctl/internal/preflight"
 )
 
 // Colors
@@ -70,27 +73,71 @@ var (
 // MissionReport contains all information for the final report
 type MissionReport struct {
 	// System info
-	HostIP   string
-	Timezone string
-	PUID     int
-	PGID     int
+	HostIP     string
+	Timezone   string
+	Locale     string
+	DateLayout string // time.Format layout for dates, following Locale
+	PUID       int
+	PGID       int
+	ShareGroup string // Group shared by people and containers, when one was chosen
 
 	// Service URLs
 	ImmichURL    string
 	NextcloudURL string
 	GlancesURL   string
 
+	// URLs away from home, when remote access is configured
+	ImmichExternalURL    string
+	NextcloudExternalURL string
+
 	// Credentials
 	NextcloudAdminUser  string
 	NextcloudAdminPass  string
 	ImmichDBPassword    string
 	NextcloudDBPassword string
+	ImmichAdminEmail    string
+	ImmichAdminPass     string
+	ImmichAdminCreated  bool // Bootstrap configures Immich through its API
+
+	// Single sign-on
+	SSOEnabled         bool
+	AuthentikURL       string
+	AuthentikAdminPass string
+
+	// Local names
+	LocalNames      []compose.HostRecord
+	LocalDNSEnabled bool
+
+	// Public hostnames served through the Cloudflare Tunnel
+	TunnelRoutes []compose.TunnelRoute
+
+	// Passphrase for the encrypted ~/infra config backups
+	ConfigBackupKey string
+
+	// Estimated idle draw and monthly energy (and cost), empty when unknown
+	Power string
+
+	// Where the credentials went instead of the report (-credentials file
+	// or link); empty when they are printed
+	CredentialsDelivered string
+
+	// Family accounts
+	Users          []compose.FamilyMember
+	ShowQRCodes    bool   // Render QR invites (requires qrencode)
+	ImmichPhoneURL string // Server URL to enter in the Immich mobile app
+	ImmichLANURL   string // URL the app switches to on home Wi-Fi
+	FamilyAlbum    string // Shared Immich album, empty when none
+	PartnerSharing bool   // Members see each other's Immich libraries
+
+	// Capabilities left out by a rootless (--no-sudo) setup
+	Skipped []preflight.SkippedCapability
 
 	// Paths
 	InfraRoot  string
 	ComposeDir string
 	ScriptsDir string
 	DataRoot   string
+	DataPaths  []DataPath // Where each service keeps its data
 
 	// Stats
 	Duration    time.Duration
@@ -98,27 +145,63 @@ type MissionReport struct {
 	ScriptsGen  int
 }
 
+// DataPath is one data location shown in the report
+type DataPath struct {
+	Description string
+	Path        string
+}
+
 // NewMissionReport creates a mission report from config
 func NewMissionReport(config *compose.ServiceConfig, infraRoot string) *MissionReport {
 	return &MissionReport{
-		HostIP:              config.HostIP,
-		Timezone:            config.Timezone,
-		PUID:                config.PUID,
-		PGID:                config.PGID,
-		ImmichURL:           fmt.Sprintf("http://%s:%d", config.HostIP, config.ImmichPort),
-		NextcloudURL:        fmt.Sprintf("http://%s:%d", config.HostIP, config.NextcloudPort),
-		GlancesURL:          fmt.Sprintf("http://%s:%d", config.HostIP, config.GlancesPort),
-		NextcloudAdminUser:  config.NextcloudAdminUser,
-		NextcloudAdminPass:  config.NextcloudAdminPass,
-		ImmichDBPassword:    config.ImmichDBPassword,
-		NextcloudDBPassword: config.NextcloudDBPassword,
-		InfraRoot:           infraRoot,
-		ComposeDir:          infraRoot + "/compose",
-		ScriptsDir:          infraRoot + "/scripts",
-		DataRoot:            config.DataRoot,
+		HostIP:               config.HostIP,
+		Timezone:             config.Timezone,
+		Locale:               config.Locale,
+		DateLayout:           config.DateLayout(),
+		PUID:                 config.PUID,
+		PGID:                 config.PGID,
+		ShareGroup:           config.ShareGroup,
+		ImmichURL:            fmt.Sprintf("http://%s:%d", config.HostIP, config.ImmichPort),
+		NextcloudURL:         fmt.Sprintf("http://%s:%d", config.HostIP, config.NextcloudPort),
+		GlancesURL:           fmt.Sprintf("http://%s:%d", config.HostIP, config.GlancesPort),
+		NextcloudAdminUser:   config.NextcloudAdminUser,
+		NextcloudAdminPass:   config.NextcloudAdminPass,
+		ImmichDBPassword:     config.ImmichDBPassword,
+		NextcloudDBPassword:  config.NextcloudDBPassword,
+		ImmichAdminEmail:     config.ImmichAdminEmail,
+		ImmichAdminPass:      config.ImmichAdminPass,
+		ImmichAdminCreated:   config.NeedsImmichAdmin(),
+		SSOEnabled:           config.SSOEnabled,
+		AuthentikURL:         config.AuthentikURL(),
+		AuthentikAdminPass:   config.AuthentikAdminPass,
+		LocalNames:           compose.HostRecords(config),
+		LocalDNSEnabled:      config.LocalDNSEnabled,
+		TunnelRoutes:         compose.TunnelRoutes(config),
+		Users:                config.Users,
+		ImmichPhoneURL:       config.ImmichPhoneURL(),
+		ImmichLANURL:         config.ImmichPhoneLANURL(),
+		ImmichExternalURL:    config.ImmichExternalURL,
+		NextcloudExternalURL: config.NextcloudExternalURL,
+		FamilyAlbum:          config.ImmichFamilyAlbum,
+		PartnerSharing:       config.ImmichPartnerSharing && len(config.Users) > 1,
+		InfraRoot:            infraRoot,
+		ComposeDir:           infraRoot + "/compose",
+		ScriptsDir:           infraRoot + "/scripts",
+		DataRoot:             config.DataRoot,
+		DataPaths:            dataPaths(config),
 	}
 }
 
+// dataPaths lists the registered locations the compose file mounts
+func dataPaths(config *compose.ServiceConfig) []DataPath {
+	var out []DataPath
+	for _, key := range config.MountedPaths() {
+		loc, _ := paths.Lookup(key)
+		out = append(out, DataPath{Description: loc.Description, Path: config.Path(key)})
+	}
+	return out
+}
+
 // RenderMissionReport generates the complete mission report
 func RenderMissionReport(report *MissionReport) string {
 	var b strings.Builder
@@ -145,10 +228,62 @@ func RenderMissionReport(report *MissionReport) string {
 	b.WriteString(RenderDashboardURLs(report))
 	b.WriteString("\n\n")
 
+	// Friendly names
+	if len(report.LocalNames) > 0 {
+		b.WriteString(RenderLocalNames(report))
+		b.WriteString("\n\n")
+	}
+
+	// Remote access
+	if len(report.TunnelRoutes) > 0 {
+		b.WriteString(RenderRemoteAccess(report))
+		b.WriteString("\n\n")
+	}
+
 	// Credentials (one-time display)
-	b.WriteString(RenderCredentials(report))
+	if report.CredentialsDelivered != "" {
+		b.WriteString(RenderCredentialsDelivered(report))
+	} else {
+		b.WriteString(RenderCredentials(report))
+	}
 	b.WriteString("\n\n")
 
+	// Per-user onboarding
+	if len(report.Users) > 0 {
+		b.WriteString(RenderUserOnboarding(report))
+		b.WriteString("\n\n")
+	}
+
+	// Data locations
+	if len(report.DataPaths) > 0 {
+		b.WriteString(RenderDataPaths(report))
+		b.WriteString("\n\n")
+	}
+
+	// What a shared group means for people using the data
+	if report.ShareGroup != "" {
+		b.WriteString(RenderShareGroup(report))
+		b.WriteString("\n\n")
+	}
+
+	// Time and language the services default to
+	if report.Locale != "" {
+		b.WriteString(SectionStyle.Render("🌍 Locale: ") + report.Locale + ", " + report.Timezone + "\n")
+		b.WriteString(MutedStyle.Render("  Nextcloud's default language, date format and phone region follow it; each user can change theirs.") + "\n\n")
+	}
+
+	// Power estimate
+	if report.Power != "" {
+		b.WriteString(SectionStyle.Render("⚡ Power: ") + report.Power + "\n")
+		b.WriteString(MutedStyle.Render("  An estimate from the CPU and drives; a plug-in meter gives the real figure.") + "\n\n")
+	}
+
+	// Rootless setup limitations
+	if len(report.Skipped) > 0 {
+		b.WriteString(RenderSkipped(report))
+		b.WriteString("\n\n")
+	}
+
 	// Quick Start
 	b.WriteString(RenderQuickStart(report))
 	b.WriteString("\n\n")
@@ -167,25 +302,28 @@ func RenderDashboardURLs(report *MissionReport) string {
 	b.WriteString(SectionStyle.Render("🌐 Dashboard URLs") + "\n\n")
 
 	services := []struct {
-		name    string
-		url     string
-		desc    string
-		hasApp  bool
-		appInfo string
+		name     string
+		url      string
+		external string
+		desc     string
+		hasApp   bool
+		appInfo  string
 	}{
 		{
-			name:    "📷 Immich",
-			url:     report.ImmichURL,
-			desc:    "Photo & Video Management",
-			hasApp:  true,
-			appInfo: "Mobile app: iOS/Android - Enter this URL in the app",
+			name:     "📷 Immich",
+			url:      report.ImmichURL,
+			external: report.ImmichExternalURL,
+			desc:     "Photo & Video Management",
+			hasApp:   true,
+			appInfo:  "Mobile app: iOS/Android - Enter this URL in the app",
 		},
 		{
-			name:    "☁️ Nextcloud",
-			url:     report.NextcloudURL,
-			desc:    "File Sync & Share",
-			hasApp:  true,
-			appInfo: "Mobile/Desktop apps available - Use this URL",
+			name:     "☁️ Nextcloud",
+			url:      report.NextcloudURL,
+			external: report.NextcloudExternalURL,
+			desc:     "File Sync & Share",
+			hasApp:   true,
+			appInfo:  "Mobile/Desktop apps available - Use this URL",
 		},
 		{
 			name:    "📊 Glances",
@@ -198,7 +336,12 @@ func RenderDashboardURLs(report *MissionReport) string {
 
 	for _, svc := range services {
 		b.WriteString(fmt.Sprintf("  %s\n", TitleStyle.Render(svc.name)))
-		b.WriteString(fmt.Sprintf("    URL: %s\n", URLStyle.Render(svc.url)))
+		if svc.external != "" {
+			b.WriteString(fmt.Sprintf("    Home: %s\n", URLStyle.Render(svc.url)))
+			b.WriteString(fmt.Sprintf("    Away: %s\n", URLStyle.Render(svc.external)))
+		} else {
+			b.WriteString(fmt.Sprintf("    URL: %s\n", URLStyle.Render(svc.url)))
+		}
 		b.WriteString(fmt.Sprintf("    %s\n", MutedStyle.Render(svc.desc)))
 		if svc.hasApp {
 			b.WriteString(fmt.Sprintf("    📱 %s\n", MutedStyle.Render(svc.appInfo)))
@@ -211,6 +354,50 @@ func RenderDashboardURLs(report *MissionReport) string {
 	return BoxStyle.Render(b.String())
 }
 
+// RenderLocalNames renders the friendly LAN names and how clients resolve them
+func RenderLocalNames(report *MissionReport) string {
+	var b strings.Builder
+
+	b.WriteString(SectionStyle.Render("🏷️  Local Names") + "\n\n")
+
+	for _, r := range report.LocalNames {
+		if url := r.URL(); url != "" {
+			b.WriteString(fmt.Sprintf("  %-10s %s\n", r.Service, URLStyle.Render(url)))
+		}
+	}
+	b.WriteString("\n")
+
+	if report.LocalDNSEnabled {
+		b.WriteString(fmt.Sprintf("  Set your router's DHCP DNS server to %s so every device\n", report.HostIP))
+		b.WriteString("  resolves these names. Until then, use the IP URLs above.\n")
+	} else {
+		b.WriteString("  Add these names to each computer's hosts file:\n")
+		b.WriteString(fmt.Sprintf("  $ %s\n", SuccessStyle.Render("cat "+report.ComposeDir+"/"+compose.ClientHostsFile)))
+	}
+
+	return BoxStyle.Render(b.String())
+}
+
+// RenderRemoteAccess renders the tunnel's public URLs and the routes to
+// create for them in the Cloudflare dashboard
+func RenderRemoteAccess(report *MissionReport) string {
+	var b strings.Builder
+
+	b.WriteString(SectionStyle.Render("🌍 Remote Access (Cloudflare Tunnel)") + "\n\n")
+	for _, r := range report.TunnelRoutes {
+		b.WriteString(fmt.Sprintf("  %-10s %s\n", r.Service, URLStyle.Render(r.URL())))
+	}
+	b.WriteString("\n")
+	b.WriteString("  In the tunnel's Public Hostname tab, add:\n")
+	for _, r := range report.TunnelRoutes {
+		b.WriteString(fmt.Sprintf("    %s → %s\n", r.Hostname, r.Origin))
+	}
+	b.WriteString(MutedStyle.Render(fmt.Sprintf("  Uploads over %s fail through the tunnel; let phones back up large videos at home.",
+		compose.TunnelUploadLimit)) + "\n")
+
+	return BoxStyle.Render(b.String())
+}
+
 // RenderCredentials renders the generated credentials (ONE-TIME DISPLAY)
 func RenderCredentials(report *MissionReport) string {
 	var b strings.Builder
@@ -223,6 +410,29 @@ func RenderCredentials(report *MissionReport) string {
 	b.WriteString(fmt.Sprintf("  Username: %s\n", CredentialStyle.Render(report.NextcloudAdminUser)))
 	b.WriteString(fmt.Sprintf("  Password: %s\n\n", CredentialStyle.Render(report.NextcloudAdminPass)))
 
+	// Immich Admin (only created when bootstrap needs the Immich API)
+	if report.ImmichAdminCreated && report.ImmichAdminPass != "" {
+		b.WriteString(SectionStyle.Render("Immich Admin:") + "\n")
+		b.WriteString(fmt.Sprintf("  Email:    %s\n", CredentialStyle.Render(report.ImmichAdminEmail)))
+		b.WriteString(fmt.Sprintf("  Password: %s\n\n", CredentialStyle.Render(report.ImmichAdminPass)))
+	}
+
+	// Authentik bootstrap admin
+	if report.SSOEnabled {
+		b.WriteString(SectionStyle.Render("Authentik (SSO) Admin:") + "\n")
+		b.WriteString(fmt.Sprintf("  URL:      %s\n", report.AuthentikURL))
+		b.WriteString(fmt.Sprintf("  Username: %s\n", CredentialStyle.Render("akadmin")))
+		b.WriteString(fmt.Sprintf("  Password: %s\n\n", CredentialStyle.Render(report.AuthentikAdminPass)))
+	}
+
+	// Config backup passphrase (needed to restore on a new machine)
+	if report.ConfigBackupKey != "" {
+		b.WriteString(SectionStyle.Render("Config Backup Passphrase:") + "\n")
+		b.WriteString(fmt.Sprintf("  %s\n", CredentialStyle.Render(report.ConfigBackupKey)))
+		b.WriteString(fmt.Sprintf("  %s\n", MutedStyle.Render("Store offline - restore with "+report.ScriptsDir+"/restore-infra-config.sh")))
+		b.WriteString(fmt.Sprintf("  %s\n\n", MutedStyle.Render("It also decrypts the critical data offsite archives")))
+	}
+
 	// Database passwords
 	b.WriteString(SectionStyle.Render("Database Passwords:") + "\n")
 	b.WriteString(fmt.Sprintf("  Immich (PostgreSQL):    %s\n", CredentialStyle.Render(report.ImmichDBPassword)))
@@ -234,6 +444,139 @@ func RenderCredentials(report *MissionReport) string {
 	return CredentialBoxStyle.Render(b.String())
 }
 
+// RenderUserOnboarding renders per-user onboarding instructions
+func RenderUserOnboarding(report *MissionReport) string {
+	var b strings.Builder
+
+	b.WriteString(SectionStyle.Render("👪 Family Onboarding") + "\n")
+	b.WriteString(MutedStyle.Render("Share each block with its owner. Immich asks for a new password at the first login; in Nextcloud, change it under Personal settings → Security.") + "\n\n")
+
+	for _, u := range report.Users {
+		b.WriteString(TitleStyle.Render(u.Name) + "\n")
+		b.WriteString(fmt.Sprintf("  Nextcloud: %s\n", URLStyle.Render(report.NextcloudURL)))
+		b.WriteString(fmt.Sprintf("    Username: %s\n", CredentialStyle.Render(u.Username)))
+		b.WriteString(fmt.Sprintf("  Immich:    %s\n", URLStyle.Render(report.ImmichURL)))
+		b.WriteString(fmt.Sprintf("    Email:    %s\n", CredentialStyle.Render(u.Email)))
+		if report.CredentialsDelivered != "" {
+			b.WriteString(fmt.Sprintf("  Password:  %s\n", MutedStyle.Render("with the delivered credentials")))
+		} else {
+			b.WriteString(fmt.Sprintf("  Password:  %s\n", CredentialStyle.Render(u.Password)))
+		}
+		if u.Quota != "" {
+			b.WriteString(fmt.Sprintf("  Quota:     %s\n", u.Quota))
+		}
+		if u.ImmichAPIKey != "" {
+			b.WriteString(fmt.Sprintf("  API key:   %s %s\n", CredentialStyle.Render(u.ImmichAPIKey),
+				MutedStyle.Render("(Immich uploads from a computer)")))
+		}
+
+		b.WriteString(renderImmichPhoneSteps(report, u))
+		if report.ShowQRCodes {
+			if qr := renderQRCode(report.ImmichPhoneURL); qr != "" {
+				b.WriteString("\n  Scan for the server URL:\n")
+				b.WriteString(qr)
+			}
+		}
+		b.WriteString("\n")
+	}
+
+	return BoxStyle.Render(b.String())
+}
+
+// renderImmichPhoneSteps renders how a member connects the Immich mobile
+// app and what is already shared with them
+func renderImmichPhoneSteps(report *MissionReport, u compose.FamilyMember) string {
+	var b strings.Builder
+
+	b.WriteString("  Phone:\n")
+	b.WriteString("    1. Install Immich from the App Store or Google Play\n")
+	b.WriteString(fmt.Sprintf("    2. Server URL: %s\n", URLStyle.Render(report.ImmichPhoneURL)))
+	b.WriteString(fmt.Sprintf("    3. Log in as %s, then tap the cloud icon and choose albums to back up\n", u.Email))
+	if report.ImmichExternalURL != "" {
+		b.WriteString(fmt.Sprintf("    4. Settings → Networking: turn on automatic URL switching with your home\n"+
+			"       Wi-Fi and local URL %s, so uploads at home stay on the LAN\n", report.ImmichLANURL))
+	}
+
+	var shared []string
+	if report.FamilyAlbum != "" {
+		shared = append(shared, fmt.Sprintf("album %q", report.FamilyAlbum))
+	}
+	if report.PartnerSharing {
+		var partners []string
+		for _, other := range report.Users {
+			if other.Email != u.Email {
+				partners = append(partners, other.Name)
+			}
+		}
+		shared = append(shared, "libraries of "+strings.Join(partners, ", "))
+	}
+	if len(shared) > 0 {
+		b.WriteString(fmt.Sprintf("    Shared with you: %s\n", strings.Join(shared, "; ")))
+	}
+	return b.String()
+}
+
+// renderQRCode renders text as a terminal QR code using qrencode, if available
+func renderQRCode(text string) string {
+	if _, err := exec.LookPath("qrencode"); err != nil {
+		return ""
+	}
+	output, err := exec.Command("qrencode", "-t", "ANSIUTF8", "-m", "1", text).Output()
+	if err != nil {
+		return ""
+	}
+	return string(output)
+}
+
+// RenderSkipped lists what a rootless setup did not configure and what to
+// do instead
+func RenderSkipped(report *MissionReport) string {
+	var b strings.Builder
+
+	b.WriteString(SectionStyle.Render("⚠️  Skipped (rootless mode)") + "\n\n")
+
+	for _, s := range report.Skipped {
+		b.WriteString(fmt.Sprintf("  %s %s\n", WarningStyle.Render("•"), s.Name))
+		b.WriteString(MutedStyle.Render(fmt.Sprintf("    %s. %s", s.Reason, s.Alternative)) + "\n")
+	}
+
+	return BoxStyle.Render(b.String())
+}
+
+// RenderDataPaths renders where each service keeps its data on disk
+func RenderDataPaths(report *MissionReport) string {
+	var b strings.Builder
+
+	b.WriteString(SectionStyle.Render("📁 Data Locations") + "\n\n")
+
+	for _, p := range report.DataPaths {
+		b.WriteString(fmt.Sprintf("  %-28s %s\n", p.Description, p.Path))
+	}
+
+	return BoxStyle.Render(b.String())
+}
+
+// RenderShareGroup explains what running the containers with a shared
+// group means for the people who use the data
+func RenderShareGroup(report *MissionReport) string {
+	var b strings.Builder
+
+	b.WriteString(SectionStyle.Render("👥 Shared Group: "+report.ShareGroup) + "\n\n")
+
+	lines := []string{
+		fmt.Sprintf("Containers run as %d:%d and new directories belong to group %s.", report.PUID, report.PGID, report.ShareGroup),
+		"Photos, files, media and downloads are group-writable (0770): everyone in the group can read and change them.",
+		"Databases and caches stay private to their containers.",
+		fmt.Sprintf("Add people with: sudo usermod -aG %s NAME (they log in again for it to apply).", report.ShareGroup),
+		fmt.Sprintf("Files people copy in belong to their own primary group; use 'newgrp %s' first, or 'servctl -permissions fix' for the directories.", report.ShareGroup),
+	}
+	for _, l := range lines {
+		b.WriteString(fmt.Sprintf("  %s %s\n", MutedStyle.Render("•"), l))
+	}
+
+	return BoxStyle.Render(b.String())
+}
+
 // RenderQuickStart renders quick start commands
 func RenderQuickStart(report *MissionReport) string {
 	var b strings.Builder
@@ -298,6 +641,10 @@ func RenderCompactReport(report *MissionReport) string {
 	b.WriteString(fmt.Sprintf("Nextcloud: %s (admin/%s)\n", URLStyle.Render(report.NextcloudURL), report.NextcloudAdminPass[:4]+"..."))
 	b.WriteString(fmt.Sprintf("Glances:   %s\n\n", URLStyle.Render(report.GlancesURL)))
 
+	if len(report.Skipped) > 0 {
+		b.WriteString(WarningStyle.Render(fmt.Sprintf("Rootless mode: %d capabilities skipped", len(report.Skipped))) + "\n\n")
+	}
+
 	b.WriteString(fmt.Sprintf("Config: %s\n", report.ComposeDir))
 	b.WriteString(fmt.Sprintf("Start:  cd %s && docker compose up -d\n", report.ComposeDir))
 
@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/madhav/servctl/internal/compose"
+	"github.com/madhav/servctl/internal/preflight"
 )
 
 func TestNewMissionReport(t *testing.T) {
@@ -39,6 +40,9 @@ func TestNewMissionReport(t *testing.T) {
 	if report.ComposeDir != "/home/user/infra/compose" {
 		t.Errorf("ComposeDir = %s, want /home/user/infra/compose", report.ComposeDir)
 	}
+	if len(report.DataPaths) == 0 || report.DataPaths[0].Path != "/mnt/data/gallery" {
+		t.Errorf("DataPaths should start with the Immich gallery, got %+v", report.DataPaths)
+	}
 }
 
 func TestRenderMissionReport(t *testing.T) {
@@ -194,3 +198,189 @@ func BenchmarkRenderMissionReport(b *testing.B) {
 		RenderMissionReport(report)
 	}
 }
+
+func TestRenderUserOnboarding(t *testing.T) {
+	config := compose.DefaultConfig()
+	config.HostIP = "192.168.1.100"
+	config.NextcloudAdminPass = "testpass123"
+	config.ImmichAdminPass = "immichadmin123"
+	config.Users = []compose.FamilyMember{
+		{Name: "Jane Doe", Username: "jane.doe", Email: "jane@example.com", Quota: "50GB", Password: "janepass"},
+	}
+
+	report := NewMissionReport(config, "/home/user/infra")
+	output := RenderMissionReport(report)
+
+	checks := []string{"Family Onboarding", "jane.doe", "jane@example.com", "janepass", "Immich Admin", "immichadmin123"}
+	for _, check := range checks {
+		if !strings.Contains(output, check) {
+			t.Errorf("Mission report missing %q", check)
+		}
+	}
+}
+
+func TestRenderUserOnboarding_ImmichSharing(t *testing.T) {
+	config := compose.DefaultConfig()
+	config.HostIP = "192.168.1.100"
+	config.LocalDNSEnabled = true
+	config.ImmichFamilyAlbum = "Family"
+	config.ImmichPartnerSharing = true
+	config.Users = []compose.FamilyMember{
+		{Name: "Jane Doe", Username: "jane.doe", Email: "jane@example.com", Password: "janepass", ImmichAPIKey: "janekey"},
+		{Name: "John Doe", Username: "john.doe", Email: "john@example.com", Password: "johnpass"},
+	}
+
+	output := RenderUserOnboarding(NewMissionReport(config, "/home/user/infra"))
+
+	checks := []string{
+		"Server URL: http://photos.home.arpa:2283", // phones use the friendly name with local DNS
+		"janekey",
+		`album "Family"`,
+		"libraries of John Doe",
+		"libraries of Jane Doe",
+	}
+	for _, check := range checks {
+		if !strings.Contains(output, check) {
+			t.Errorf("Onboarding missing %q", check)
+		}
+	}
+	if strings.Count(output, "API key:") != 1 {
+		t.Error("Only members with an API key should show one")
+	}
+}
+
+func TestRenderMissionReport_SSO(t *testing.T) {
+	config := compose.DefaultConfig()
+	config.HostIP = "192.168.1.100"
+	config.NextcloudAdminPass = "testpass123"
+	config.SSOEnabled = true
+	config.AutoFillDefaults()
+
+	output := RenderMissionReport(NewMissionReport(config, "/home/user/infra"))
+
+	checks := []string{"Authentik (SSO) Admin", "http://192.168.1.100:9000", "akadmin", config.AuthentikAdminPass, "Immich Admin"}
+	for _, check := range checks {
+		if !strings.Contains(output, check) {
+			t.Errorf("Mission report missing %q", check)
+		}
+	}
+}
+
+func TestRenderLocalNames(t *testing.T) {
+	config := compose.DefaultConfig()
+	config.HostIP = "192.168.1.100"
+
+	output := RenderLocalNames(NewMissionReport(config, "/home/user/infra"))
+	for _, check := range []string{"http://photos.home.arpa:2283", "client-hosts.txt"} {
+		if !strings.Contains(output, check) {
+			t.Errorf("Local names missing %q", check)
+		}
+	}
+
+	config.LocalDNSEnabled = true
+	output = RenderLocalNames(NewMissionReport(config, "/home/user/infra"))
+	if !strings.Contains(output, "DHCP DNS server to 192.168.1.100") {
+		t.Error("Local DNS instructions should point the router at the host IP")
+	}
+}
+
+func TestRenderRemoteAccess(t *testing.T) {
+	config := compose.DefaultConfig()
+	config.HostIP = "192.168.1.100"
+	config.NextcloudAdminPass = "testpass123"
+	config.TunnelToken = strings.Repeat("t", 64)
+	config.TunnelDomain = "example.com"
+
+	output := RenderMissionReport(NewMissionReport(config, "/home/user/infra"))
+	checks := []string{"Remote Access", "https://photos.example.com", "cloud.example.com → http://nextcloud:80"}
+	for _, check := range checks {
+		if !strings.Contains(output, check) {
+			t.Errorf("Mission report missing %q", check)
+		}
+	}
+	if strings.Contains(output, config.TunnelToken) {
+		t.Error("The tunnel token should not be shown")
+	}
+}
+
+func TestRenderDashboardURLs_SplitHorizon(t *testing.T) {
+	config := compose.DefaultConfig()
+	config.HostIP = "192.168.1.100"
+	config.ImmichExternalURL = "https://photos.example.com"
+	config.Users = []compose.FamilyMember{{Name: "Jane Doe", Email: "jane@example.com", Password: "janepass"}}
+	report := NewMissionReport(config, "/home/user/infra")
+
+	output := RenderDashboardURLs(report)
+	for _, check := range []string{"Home: http://192.168.1.100:2283", "Away: https://photos.example.com", "URL: http://192.168.1.100:8080"} {
+		if !strings.Contains(output, check) {
+			t.Errorf("Dashboard URLs missing %q", check)
+		}
+	}
+
+	output = RenderUserOnboarding(report)
+	for _, check := range []string{"Server URL: https://photos.example.com", "local URL http://192.168.1.100:2283"} {
+		if !strings.Contains(output, check) {
+			t.Errorf("Onboarding missing %q", check)
+		}
+	}
+}
+
+func TestRenderCredentials_ConfigBackupKey(t *testing.T) {
+	config := compose.DefaultConfig()
+	config.NextcloudAdminPass = "testpass123"
+
+	report := NewMissionReport(config, "/home/user/infra")
+	report.ConfigBackupKey = "0123456789abcdef"
+
+	output := RenderCredentials(report)
+	for _, check := range []string{"Config Backup Passphrase", "0123456789abcdef", "restore-infra-config.sh"} {
+		if !strings.Contains(output, check) {
+			t.Errorf("Credentials missing %q", check)
+		}
+	}
+}
+
+func TestRenderSkipped(t *testing.T) {
+	config := compose.DefaultConfig()
+	config.NextcloudAdminPass = "testpass123"
+
+	report := NewMissionReport(config, "/home/user/infra")
+	if strings.Contains(RenderMissionReport(report), "rootless mode") {
+		t.Error("Skipped section should only appear for rootless setups")
+	}
+
+	report.Skipped = preflight.RootlessSkipped()
+	output := RenderMissionReport(report)
+	for _, check := range []string{"Skipped (rootless mode)", "UFW firewall", "user systemd timers"} {
+		if !strings.Contains(output, check) {
+			t.Errorf("Report missing %q", check)
+		}
+	}
+}
+
+func TestRenderMissionReport_Power(t *testing.T) {
+	config := compose.DefaultConfig()
+	config.NextcloudAdminPass = "testpass123"
+	report := NewMissionReport(config, "/home/user/infra")
+
+	if strings.Contains(RenderMissionReport(report), "Power:") {
+		t.Error("no power line without an estimate")
+	}
+	report.Power = "~18 W at idle, ~13 kWh a month, ~3.94 a month at 0.30 per kWh"
+	if !strings.Contains(RenderMissionReport(report), report.Power) {
+		t.Error("report should show the power estimate")
+	}
+}
+
+func TestRenderShareGroup(t *testing.T) {
+	report := &MissionReport{PUID: 1000, PGID: 1500, ShareGroup: "media"}
+	output := RenderShareGroup(report)
+	for _, want := range []string{"1000:1500", "usermod -aG media", "newgrp media"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Shared group section lacks %q", want)
+		}
+	}
+	if strings.Contains(RenderMissionReport(&MissionReport{}), "Shared Group") {
+		t.Error("Without a shared group the report should not explain one")
+	}
+}
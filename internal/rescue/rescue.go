@@ -0,0 +1,301 @@
+// Package rescue writes the "break glass" document for a servctl machine:
+// which disk is which, how they are mounted and unlocked, where the backups
+// are and the commands that bring them back, and what versions were
+// running. It is kept on the backup drive, so recovering does not depend
+// on the server that died.
+package rescue
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/madhav/servctl/internal/bootstrap"
+	"github.com/madhav/servctl/internal/compose"
+	"github.com/madhav/servctl/internal/maintenance"
+	"github.com/madhav/servctl/internal/ops"
+	"github.com/madhav/servctl/internal/storage"
+	"github.com/madhav/servctl/templates"
+)
+
+// Dir is the folder on the backup drive that holds the document
+const Dir = "servctl-rescue"
+
+// FileName is the document's name in Dir
+const FileName = "RESCUE.md"
+
+// etcRoot and procRoot are where the system files are read from; tests
+// point them at fake trees
+var (
+	etcRoot  = "/etc"
+	procRoot = "/proc"
+)
+
+// DiskRole is what one disk does in the setup
+type DiskRole struct {
+	Device string
+	Serial string
+	Model  string
+	Size   string
+	Role   string
+}
+
+// KeyLocation is where the key to an encrypted volume is kept
+type KeyLocation struct {
+	Kind     string // "LUKS" or "ZFS"
+	Volume   string // crypttab name or ZFS dataset
+	Device   string `json:",omitempty"` // LUKS: the encrypted device
+	Location string // Key file, or "passphrase" when typed at boot
+}
+
+// Package is a system package and the version setup installed
+type Package struct {
+	Name    string
+	Version string
+}
+
+// Doc is everything the rescue document records
+type Doc struct {
+	Host           string
+	Generated      time.Time
+	ServctlVersion string
+	User           string
+
+	InfraRoot      string
+	DataRoot       string
+	FastRoot       string
+	BackupDest     string
+	Snapshots      string // Where the daily backup's snapshots are
+	InfraConfigDir string // Where the encrypted config archives are
+	BackupKeyFile  string
+
+	Disks    []DiskRole
+	Lsblk    string // The disk table, as lsblk printed it
+	Fstab    string
+	Keys     []KeyLocation
+	ZFSPools string // zpool status, when ZFS is in use
+	RAID     string // mdadm --detail --scan, when MD RAID is in use
+
+	ComposeFile string
+	Images      []string
+	Packages    []Package
+}
+
+// mount is one line of /proc/mounts
+type mount struct {
+	Device, Point, FS string
+}
+
+// readMounts parses /proc/mounts
+func readMounts() []mount {
+	f, err := os.Open(filepath.Join(procRoot, "mounts"))
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var mounts []mount
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 3 && strings.HasPrefix(fields[0], "/dev/") {
+			mounts = append(mounts, mount{Device: fields[0], Point: fields[1], FS: fields[2]})
+		}
+	}
+	return mounts
+}
+
+// onDisk reports whether device is disk or one of its partitions
+// (/dev/sdb1, /dev/nvme0n1p1)
+func onDisk(device, disk string) bool {
+	rest, ok := strings.CutPrefix(device, disk)
+	if !ok {
+		return false
+	}
+	rest = strings.TrimPrefix(rest, "p")
+	return rest == "" || strings.Trim(rest, "0123456789") == ""
+}
+
+// memberRoles name the partitions that belong to a pool or array rather
+// than being mounted themselves
+var memberRoles = map[string]string{
+	"zfs_member":        "ZFS pool member",
+	"linux_raid_member": "MD RAID member",
+	"crypto_LUKS":       "LUKS encrypted",
+	"swap":              "Swap",
+}
+
+// diskRoles names each disk's role from where its filesystems are mounted.
+// roles gives the name of the mount points the setup uses; others are
+// listed by path.
+func diskRoles(disks []storage.Disk, mounts []mount, roles map[string]string) []DiskRole {
+	var out []DiskRole
+	for _, d := range disks {
+		var found []string
+		add := func(role string) {
+			for _, f := range found {
+				if f == role {
+					return
+				}
+			}
+			found = append(found, role)
+		}
+		named := func(point string) string {
+			if role, ok := roles[point]; ok {
+				return role + " (" + point + ")"
+			}
+			return point
+		}
+
+		for _, m := range mounts {
+			if onDisk(m.Device, d.Path) {
+				add(named(m.Point))
+			}
+		}
+		for _, p := range d.Partitions {
+			switch {
+			case p.MountPoint != "":
+				add(named(p.MountPoint))
+			case memberRoles[p.Filesystem] != "":
+				add(memberRoles[p.Filesystem])
+			}
+		}
+		role := strings.Join(found, ", ")
+		if role == "" {
+			role = "Not mounted"
+		}
+		out = append(out, DiskRole{Device: d.Path, Serial: d.Serial, Model: d.Model, Size: d.SizeHuman, Role: role})
+	}
+	return out
+}
+
+// parseCrypttab returns the key locations in /etc/crypttab: name, device,
+// key file ("none" or "-" means a passphrase typed at boot)
+func parseCrypttab(content string) []KeyLocation {
+	var keys []KeyLocation
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		location := "passphrase"
+		if len(fields) >= 3 && fields[2] != "none" && fields[2] != "-" {
+			location = fields[2]
+		}
+		// cryptsetup open takes a path, not crypttab's UUID= form
+		device := fields[1]
+		if uuid, ok := strings.CutPrefix(device, "UUID="); ok {
+			device = "/dev/disk/by-uuid/" + uuid
+		}
+		keys = append(keys, KeyLocation{Kind: "LUKS", Volume: fields[0], Device: device, Location: location})
+	}
+	return keys
+}
+
+// parseZFSKeys reads 'zfs get -H -o name,value keylocation' output; only
+// encryption roots have a key location other than "none"
+func parseZFSKeys(output string) []KeyLocation {
+	var keys []KeyLocation
+	for _, line := range strings.Split(output, "\n") {
+		name, value, ok := strings.Cut(strings.TrimSpace(line), "\t")
+		if !ok || value == "none" || value == "-" {
+			continue
+		}
+		if value == "prompt" {
+			value = "passphrase"
+		}
+		keys = append(keys, KeyLocation{Kind: "ZFS", Volume: name, Location: strings.TrimPrefix(value, "file://")})
+	}
+	return keys
+}
+
+// commandOutput runs a tool when it is installed, returning "" otherwise
+func commandOutput(name string, args ...string) string {
+	if _, err := exec.LookPath(name); err != nil {
+		return ""
+	}
+	output, err := exec.Command(name, args...).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// Collect gathers the document for the setup recorded in config and
+// mConfig from this machine's disks, mounts and system files
+func Collect(config *compose.ServiceConfig, mConfig *maintenance.ScriptConfig, user, version string) Doc {
+	host, _ := os.Hostname()
+	doc := Doc{
+		Host:           host,
+		Generated:      time.Now(),
+		ServctlVersion: version,
+		User:           user,
+		InfraRoot:      config.InfraRoot,
+		DataRoot:       config.DataRoot,
+		FastRoot:       config.FastRoot,
+		BackupDest:     mConfig.BackupDest,
+		Snapshots:      maintenance.SnapshotsPath(mConfig.BackupDest),
+		InfraConfigDir: filepath.Join(mConfig.BackupDest, "infra-config"),
+		BackupKeyFile:  filepath.Join(config.InfraRoot, maintenance.BackupKeyFile),
+		ComposeFile:    filepath.Join(config.InfraRoot, "compose", "docker-compose.yml"),
+	}
+
+	roles := map[string]string{"/": "OS", doc.DataRoot: "Data", doc.BackupDest: "Backup", "/mnt/scratch": "Scratch"}
+	if doc.FastRoot != "" {
+		roles[doc.FastRoot] = "Fast tier"
+	}
+	if disks, err := storage.DiscoverDisks(); err == nil {
+		doc.Disks = diskRoles(disks, readMounts(), roles)
+	}
+	doc.Lsblk = commandOutput("lsblk", "-o", "NAME,SERIAL,MODEL,SIZE,FSTYPE,LABEL,UUID,MOUNTPOINT")
+
+	if data, err := os.ReadFile(filepath.Join(etcRoot, "fstab")); err == nil {
+		doc.Fstab = strings.TrimSpace(string(data))
+	}
+	if data, err := os.ReadFile(filepath.Join(etcRoot, "crypttab")); err == nil {
+		doc.Keys = parseCrypttab(string(data))
+	}
+	if pools := commandOutput("zpool", "list", "-H", "-o", "name"); pools != "" {
+		doc.ZFSPools = commandOutput("zpool", "status")
+		doc.Keys = append(doc.Keys, parseZFSKeys(commandOutput("zfs", "get", "-H", "-o", "name,value", "keylocation"))...)
+	}
+	if data, err := os.ReadFile(filepath.Join(procRoot, "mdstat")); err == nil && strings.Contains(string(data), " : active") {
+		doc.RAID = commandOutput("mdadm", "--detail", "--scan")
+	}
+
+	if images, err := bootstrap.ComposeImages(doc.ComposeFile); err == nil {
+		doc.Images = images
+	}
+	for name, v := range config.PackageVersions {
+		doc.Packages = append(doc.Packages, Package{Name: name, Version: v})
+	}
+	sort.Slice(doc.Packages, func(i, j int) bool { return doc.Packages[i].Name < doc.Packages[j].Name })
+	return doc
+}
+
+// Render produces the Markdown document
+func Render(doc Doc) (string, error) {
+	return templates.Render("system/rescue.md.tmpl", doc, template.FuncMap{"dirOf": filepath.Dir})
+}
+
+// Write renders the document into dir/FileName
+func Write(dir string, doc Doc, dryRun bool) (string, error) {
+	content, err := Render(doc)
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, FileName)
+	err = ops.Execute(dryRun,
+		ops.Mkdir{Path: dir, Mode: 0700},
+		ops.WriteFile{Path: path, Content: []byte(content), Mode: 0600})
+	if err != nil {
+		return "", fmt.Errorf("failed to write the rescue document: %w", err)
+	}
+	return path, nil
+}
@@ -0,0 +1,137 @@
+package rescue
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/madhav/servctl/internal/storage"
+)
+
+func TestOnDisk(t *testing.T) {
+	tests := []struct {
+		device, disk string
+		want         bool
+	}{
+		{"/dev/sdb", "/dev/sdb", true},
+		{"/dev/sdb1", "/dev/sdb", true},
+		{"/dev/nvme0n1p2", "/dev/nvme0n1", true},
+		{"/dev/sdba", "/dev/sdb", false},
+		{"/dev/sdc1", "/dev/sdb", false},
+	}
+	for _, tt := range tests {
+		if got := onDisk(tt.device, tt.disk); got != tt.want {
+			t.Errorf("onDisk(%q, %q) = %v, want %v", tt.device, tt.disk, got, tt.want)
+		}
+	}
+}
+
+func TestDiskRoles(t *testing.T) {
+	disks := []storage.Disk{
+		{Path: "/dev/nvme0n1", Serial: "OS1", Partitions: []storage.Partition{{Name: "nvme0n1p1", MountPoint: "/boot/efi"}, {Name: "nvme0n1p2", MountPoint: "/"}}},
+		{Path: "/dev/sdb", Serial: "DATA1"},
+		{Path: "/dev/sdc", Serial: "BACKUP1"},
+		{Path: "/dev/sdd", Serial: "POOL1", Partitions: []storage.Partition{{Name: "sdd1", Filesystem: "zfs_member"}}},
+		{Path: "/dev/sde", Serial: "SPARE"},
+	}
+	// servctl formats whole disks, which lsblk shows without partitions
+	mounts := []mount{{"/dev/sdb", "/mnt/data", "ext4"}, {"/dev/sdc", "/mnt/backup", "ext4"}}
+	roles := map[string]string{"/": "OS", "/mnt/data": "Data", "/mnt/backup": "Backup"}
+
+	got := make(map[string]string)
+	for _, r := range diskRoles(disks, mounts, roles) {
+		got[r.Serial] = r.Role
+	}
+	want := map[string]string{
+		"OS1":     "/boot/efi, OS (/)",
+		"DATA1":   "Data (/mnt/data)",
+		"BACKUP1": "Backup (/mnt/backup)",
+		"POOL1":   "ZFS pool member",
+		"SPARE":   "Not mounted",
+	}
+	for serial, role := range want {
+		if got[serial] != role {
+			t.Errorf("role of %s = %q, want %q", serial, got[serial], role)
+		}
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	crypttab := "# <target name> <source device> <key file> <options>\n" +
+		"data_crypt UUID=1234 /root/keys/data.key luks\n" +
+		"backup_crypt /dev/sdc none luks,discard\n"
+	keys := parseCrypttab(crypttab)
+	if len(keys) != 2 || keys[0].Location != "/root/keys/data.key" || keys[0].Device != "/dev/disk/by-uuid/1234" || keys[1].Location != "passphrase" || keys[1].Device != "/dev/sdc" {
+		t.Errorf("parseCrypttab() = %+v", keys)
+	}
+
+	zfs := "tank\tnone\ntank/secure\tfile:///etc/zfs/keys/secure.key\nvault\tprompt\n"
+	keys = parseZFSKeys(zfs)
+	if len(keys) != 2 || keys[0].Volume != "tank/secure" || keys[0].Location != "/etc/zfs/keys/secure.key" || keys[1].Location != "passphrase" {
+		t.Errorf("parseZFSKeys() = %+v", keys)
+	}
+}
+
+func TestRender(t *testing.T) {
+	doc := Doc{
+		Host:           "nas",
+		Generated:      time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC),
+		ServctlVersion: "1.4.0",
+		User:           "alex",
+		InfraRoot:      "/home/alex/infra",
+		DataRoot:       "/mnt/data",
+		BackupDest:     "/mnt/backup",
+		Snapshots:      "/mnt/backup/snapshots",
+		InfraConfigDir: "/mnt/backup/infra-config",
+		BackupKeyFile:  "/home/alex/infra/.backup-key",
+		ComposeFile:    "/home/alex/infra/compose/docker-compose.yml",
+		Disks:          []DiskRole{{Device: "/dev/sdb", Serial: "WD-123", Size: "4.00 TB", Role: "Data (/mnt/data)"}},
+		Fstab:          "UUID=abcd /mnt/data ext4 defaults,nofail 0 2",
+		Keys:           []KeyLocation{{Kind: "LUKS", Volume: "data_crypt", Device: "/dev/disk/by-uuid/1234", Location: "/root/keys/data.key"}},
+		Images:         []string{"ghcr.io/immich-app/immich-server:v1.120.0"},
+		Packages:       []Package{{Name: "docker-ce", Version: "5:27.3.1"}},
+	}
+	out, err := Render(doc)
+	if err != nil {
+		t.Fatalf("Render() error: %v", err)
+	}
+	for _, want := range []string{
+		"# Rescue: nas",
+		"| /dev/sdb | WD-123 | - | 4.00 TB | Data (/mnt/data) |",
+		"UUID=abcd /mnt/data ext4",
+		"sudo cryptsetup open /dev/disk/by-uuid/1234 data_crypt --key-file /root/keys/data.key`",
+		"tar -xzf - -C /home/alex",
+		"rsync -aHAX --info=progress2 /mnt/backup/snapshots/latest/ /mnt/data/",
+		"`ghcr.io/immich-app/immich-server:v1.120.0`",
+		"- docker-ce 5:27.3.1",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("document is missing %q:\n%s", want, out)
+		}
+	}
+	for _, unwanted := range []string{"zpool import", "mdadm --assemble", "## ZFS pools"} {
+		if strings.Contains(out, unwanted) {
+			t.Errorf("document mentions %q without ZFS or RAID", unwanted)
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), Dir)
+	doc := Doc{Host: "nas", InfraRoot: "/home/alex/infra"}
+	if _, err := Write(dir, doc, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Fatal("a dry run created the rescue folder")
+	}
+	path, err := Write(dir, doc, false)
+	if err != nil {
+		t.Fatalf("Write() error: %v", err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("rescue document = %v, %v; want mode 0600", info, err)
+	}
+}
@@ -0,0 +1,28 @@
+//go:build !windows
+
+package runlock
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// tryLock takes an exclusive flock without waiting; false when another
+// open file holds it
+func tryLock(f *os.File) (bool, error) {
+	err := unix.Flock(int(f.Fd()), unix.LOCK_EX|unix.LOCK_NB)
+	if errors.Is(err, unix.EWOULDBLOCK) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// giveToOwner chowns the lock file to the owner of ~/infra
+func giveToOwner(path, infraRoot string) {
+	var st unix.Stat_t
+	if unix.Stat(infraRoot, &st) == nil {
+		os.Chown(path, int(st.Uid), int(st.Gid))
+	}
+}
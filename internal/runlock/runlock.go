@@ -0,0 +1,150 @@
+// Package runlock keeps servctl commands and the generated maintenance
+// scripts from running destructive work at the same time. Both take an
+// exclusive flock on one file in ~/infra; whoever holds it writes a line
+// naming itself, so anyone waiting can say what they are waiting for.
+package runlock
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FileName is the lock file, relative to ~/infra. The maintenance scripts
+// lock the same file with flock(1).
+const FileName = "servctl.lock"
+
+// HeldEnv is set for the commands servctl runs while holding the lock, so
+// a maintenance script started by servctl does not wait for its parent
+const HeldEnv = "SERVCTL_RUN_LOCK"
+
+// pollInterval is how often a waiting Acquire retries
+var pollInterval = time.Second
+
+// Path returns the lock file under infraRoot
+func Path(infraRoot string) string {
+	return filepath.Join(infraRoot, FileName)
+}
+
+// Holder is who holds the lock, as written in the lock file:
+// "PID<TAB>RFC 3339 time<TAB>command"
+type Holder struct {
+	PID     int
+	Since   time.Time
+	Command string
+}
+
+func (h Holder) String() string {
+	since := h.Since.Format("15:04:05")
+	if time.Since(h.Since) > 24*time.Hour {
+		since = h.Since.Format("2006-01-02 15:04")
+	}
+	return fmt.Sprintf("%s (pid %d, since %s, %s ago)", h.Command, h.PID, since, time.Since(h.Since).Round(time.Second))
+}
+
+// parseHolder reads the lock file's content; nil when it names nobody
+func parseHolder(content string) *Holder {
+	fields := strings.SplitN(strings.TrimSpace(content), "\t", 3)
+	if len(fields) != 3 {
+		return nil
+	}
+	pid, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return nil
+	}
+	since, err := time.Parse(time.RFC3339, fields[1])
+	if err != nil {
+		return nil
+	}
+	return &Holder{PID: pid, Since: since, Command: fields[2]}
+}
+
+// ReadHolder returns who last took the lock; nil when nobody has
+func ReadHolder(infraRoot string) *Holder {
+	data, err := os.ReadFile(Path(infraRoot))
+	if err != nil {
+		return nil
+	}
+	return parseHolder(string(data))
+}
+
+// Lock is a held run lock
+type Lock struct {
+	file *os.File
+}
+
+// open opens (creating) the lock file. Created by root under sudo or by a
+// script run from cron, it is given to ~/infra's owner, so servctl run
+// without sudo can still take it.
+func open(infraRoot string) (*os.File, error) {
+	path := Path(infraRoot)
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	if os.Geteuid() == 0 {
+		giveToOwner(path, infraRoot)
+	}
+	return f, nil
+}
+
+// TryAcquire takes the lock if it is free. When another process holds it,
+// the lock is nil and the holder is returned instead.
+func TryAcquire(infraRoot, command string) (*Lock, *Holder, error) {
+	f, err := open(infraRoot)
+	if err != nil {
+		return nil, nil, err
+	}
+	locked, err := tryLock(f)
+	if err != nil {
+		f.Close()
+		return nil, nil, fmt.Errorf("failed to lock %s: %w", f.Name(), err)
+	}
+	if !locked {
+		f.Close()
+		holder := ReadHolder(infraRoot)
+		if holder == nil {
+			holder = &Holder{Command: "another servctl run", Since: time.Now()}
+		}
+		return nil, holder, nil
+	}
+
+	line := fmt.Sprintf("%d\t%s\t%s\n", os.Getpid(), time.Now().Format(time.RFC3339), command)
+	if err := f.Truncate(0); err == nil {
+		f.WriteAt([]byte(line), 0)
+	}
+	os.Setenv(HeldEnv, "1")
+	return &Lock{file: f}, nil, nil
+}
+
+// Acquire takes the lock, waiting for it as long as it takes. waiting is
+// called whenever a different holder is found in the way.
+func Acquire(infraRoot, command string, waiting func(Holder)) (*Lock, error) {
+	var last Holder
+	for {
+		lock, holder, err := TryAcquire(infraRoot, command)
+		if err != nil || lock != nil {
+			return lock, err
+		}
+		if waiting != nil && (holder.PID != last.PID || !holder.Since.Equal(last.Since)) {
+			waiting(*holder)
+			last = *holder
+		}
+		time.Sleep(pollInterval)
+	}
+}
+
+// Release gives the lock up. The lock file stays: removing it would let a
+// process that opened it before the removal lock a file nobody else sees.
+func (l *Lock) Release() error {
+	if l == nil || l.file == nil {
+		return nil
+	}
+	os.Unsetenv(HeldEnv)
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
@@ -0,0 +1,80 @@
+package runlock
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestTryAcquire_ReportsHolder(t *testing.T) {
+	dir := t.TempDir()
+	lock, holder, err := TryAcquire(dir, "servctl -manual-backup")
+	if err != nil || lock == nil || holder != nil {
+		t.Fatalf("First acquire should succeed: lock=%v holder=%v err=%v", lock, holder, err)
+	}
+	if os.Getenv(HeldEnv) == "" {
+		t.Errorf("%s should be set while the lock is held", HeldEnv)
+	}
+
+	// flock locks belong to the open file, so a second open conflicts even
+	// within one process
+	second, holder, err := TryAcquire(dir, "servctl -network-refresh")
+	if err != nil || second != nil {
+		t.Fatalf("Second acquire should find the lock taken: lock=%v err=%v", second, err)
+	}
+	if holder.PID != os.Getpid() || holder.Command != "servctl -manual-backup" || time.Since(holder.Since) > time.Minute {
+		t.Errorf("Holder should name the first command: %+v", holder)
+	}
+
+	if err := lock.Release(); err != nil {
+		t.Fatal(err)
+	}
+	if os.Getenv(HeldEnv) != "" {
+		t.Errorf("%s should be cleared on release", HeldEnv)
+	}
+	again, _, err := TryAcquire(dir, "servctl -network-refresh")
+	if err != nil || again == nil {
+		t.Fatalf("Acquire after release should succeed: %v", err)
+	}
+	again.Release()
+}
+
+func TestAcquire_Waits(t *testing.T) {
+	pollInterval = 10 * time.Millisecond
+	defer func() { pollInterval = time.Second }()
+
+	dir := t.TempDir()
+	first, _, err := TryAcquire(dir, "daily-backup.sh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		first.Release()
+	}()
+
+	var waitedFor []string
+	lock, err := Acquire(dir, "servctl -snapshot rollback", func(h Holder) {
+		waitedFor = append(waitedFor, h.Command)
+	})
+	if err != nil || lock == nil {
+		t.Fatalf("Acquire should get the lock once it is released: %v", err)
+	}
+	defer lock.Release()
+	if len(waitedFor) != 1 || waitedFor[0] != "daily-backup.sh" {
+		t.Errorf("Should report the holder once while waiting, got %v", waitedFor)
+	}
+	if h := ReadHolder(dir); h == nil || h.Command != "servctl -snapshot rollback" {
+		t.Errorf("Lock file should name the new holder: %+v", h)
+	}
+}
+
+func TestParseHolder(t *testing.T) {
+	h := parseHolder("4242\t2024-05-01T03:00:00+02:00\tdaily-backup.sh\n")
+	if h == nil || h.PID != 4242 || h.Command != "daily-backup.sh" || h.Since.Hour() != 3 {
+		t.Errorf("Unexpected holder: %+v", h)
+	}
+	if parseHolder("") != nil || parseHolder("garbage") != nil {
+		t.Error("Content without a holder should parse to nil")
+	}
+}
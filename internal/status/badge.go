@@ -0,0 +1,135 @@
+package status
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/madhav/servctl/internal/ops"
+	"github.com/madhav/servctl/internal/utils"
+	"github.com/madhav/servctl/templates"
+)
+
+// Badge colors: all is well, something is worth a look, something is down
+const (
+	BadgeGreen  = "green"
+	BadgeYellow = "yellow"
+	BadgeRed    = "red"
+)
+
+// Files WriteBadge puts in its directory
+const (
+	BadgeSVGFile  = "status.svg"
+	BadgeJSONFile = "status.json"
+)
+
+// badgeFills are the shields.io shades of the badge colors
+var badgeFills = map[string]string{BadgeGreen: "#4c1", BadgeYellow: "#dfb317", BadgeRed: "#e05d44"}
+
+// Badge is the health of the server at a glance, for a phone widget. The
+// JSON has the fields of a shields.io endpoint badge plus the reasons and
+// when it was made, so a widget can tell a stale badge from a green one.
+type Badge struct {
+	SchemaVersion int       `json:"schemaVersion"`
+	Label         string    `json:"label"`
+	Message       string    `json:"message"`
+	Color         string    `json:"color"`
+	Reasons       []string  `json:"reasons"`
+	Updated       time.Time `json:"updated"`
+}
+
+// Badge summarizes the report: red when an issue is critical, yellow when
+// any other needs attention, green otherwise
+func (r Report) Badge(label string) Badge {
+	b := Badge{SchemaVersion: 1, Label: label, Message: "ok", Color: BadgeGreen, Reasons: []string{}, Updated: r.Time}
+
+	critical := 0
+	for _, issue := range r.Issues() {
+		b.Reasons = append(b.Reasons, issue.Message)
+		if issue.Critical {
+			critical++
+		}
+	}
+	switch {
+	case critical > 0:
+		b.Color = BadgeRed
+		b.Message = plural(critical, "problem")
+	case len(b.Reasons) > 0:
+		b.Color = BadgeYellow
+		b.Message = plural(len(b.Reasons), "warning")
+	}
+	return b
+}
+
+func plural(n int, word string) string {
+	if n == 1 {
+		return "1 " + word
+	}
+	return fmt.Sprintf("%d %ss", n, word)
+}
+
+// textWidth estimates the width of 11px Verdana text, which averages
+// about 7px a character
+func textWidth(s string) int {
+	return len([]rune(s))*7 + 10
+}
+
+// SVG renders the badge as a flat shields.io-style image
+func (b Badge) SVG() (string, error) {
+	labelWidth, messageWidth := textWidth(b.Label), textWidth(b.Message)
+	data := struct {
+		Badge
+		Fill                            string
+		Width, LabelWidth, MessageWidth int
+		LabelX, MessageX                float64
+	}{
+		Badge:        b,
+		Fill:         badgeFills[b.Color],
+		Width:        labelWidth + messageWidth,
+		LabelWidth:   labelWidth,
+		MessageWidth: messageWidth,
+		LabelX:       float64(labelWidth) / 2,
+		MessageX:     float64(labelWidth) + float64(messageWidth)/2,
+	}
+	return templates.Render("system/status-badge.svg.tmpl", data, nil)
+}
+
+// WriteBadge writes the badge as BadgeSVGFile and BadgeJSONFile in dir,
+// replacing the previous ones. Files it creates get the owner of dir, so a
+// folder Nextcloud serves (owned by www-data) stays editable from the app.
+func WriteBadge(dir string, b Badge, dryRun bool) error {
+	svg, err := b.SVG()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode the badge: %w", err)
+	}
+
+	files := []ops.WriteFile{
+		{Path: filepath.Join(dir, BadgeSVGFile), Content: []byte(svg), Mode: 0644},
+		{Path: filepath.Join(dir, BadgeJSONFile), Content: append(data, '\n'), Mode: 0644},
+	}
+	var created []string
+	for _, f := range files {
+		if _, err := os.Stat(f.Path); os.IsNotExist(err) {
+			created = append(created, f.Path)
+		}
+		if err := ops.Execute(dryRun, f); err != nil {
+			return fmt.Errorf("failed to write the badge: %w", err)
+		}
+	}
+
+	if info, err := os.Stat(dir); err == nil && !dryRun && os.Geteuid() == 0 {
+		uid, gid := utils.FileOwner(info)
+		for _, path := range created {
+			if uid >= 0 {
+				os.Lchown(path, uid, gid)
+			}
+		}
+	}
+	return nil
+}
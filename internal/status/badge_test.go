@@ -0,0 +1,76 @@
+package status
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReport_Badge(t *testing.T) {
+	tests := []struct {
+		name    string
+		report  Report
+		color   string
+		message string
+	}{
+		{"healthy", Report{Services: []ServiceStatus{{Name: "immich-server", State: "running"}}}, BadgeGreen, "ok"},
+		{"warm drive", Report{Drives: []DriveStatus{{Device: "/dev/sda", Health: "PASSED", TempC: 51}}}, BadgeYellow, "1 warning"},
+		{"disk nearly full", Report{Disks: []DiskStatus{{Path: "/mnt/data", Used: 92, Free: 8}}}, BadgeYellow, "1 warning"},
+		{"service down", Report{
+			Services: []ServiceStatus{{Name: "nextcloud", State: "exited"}, {Name: "immich-server", State: "running", Health: "unhealthy"}},
+			Disks:    []DiskStatus{{Path: "/mnt/data", Used: 92, Free: 8}},
+		}, BadgeRed, "2 problems"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := tt.report.Badge("home")
+			if b.Color != tt.color || b.Message != tt.message {
+				t.Errorf("Badge() = %s %q, want %s %q", b.Color, b.Message, tt.color, tt.message)
+			}
+			if len(b.Reasons) != len(tt.report.Problems()) {
+				t.Errorf("Reasons = %q, want every problem", b.Reasons)
+			}
+		})
+	}
+}
+
+func TestWriteBadge(t *testing.T) {
+	dir := t.TempDir()
+	r := Report{Time: time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC), DockerError: "cannot reach <docker>"}
+	b := r.Badge("home server")
+
+	if err := WriteBadge(dir, b, true); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Fatalf("a dry run wrote %d files", len(entries))
+	}
+
+	if err := WriteBadge(dir, b, false); err != nil {
+		t.Fatalf("WriteBadge() error: %v", err)
+	}
+	svg, err := os.ReadFile(filepath.Join(dir, BadgeSVGFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`fill="#e05d44"`, ">home server</text>", ">1 problem</text>", "&lt;docker&gt;"} {
+		if !strings.Contains(string(svg), want) {
+			t.Errorf("SVG is missing %q:\n%s", want, svg)
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, BadgeJSONFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Badge
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("status.json does not parse: %v", err)
+	}
+	if got.SchemaVersion != 1 || got.Color != BadgeRed || !got.Updated.Equal(r.Time) || len(got.Reasons) != 1 {
+		t.Errorf("status.json = %+v", got)
+	}
+}
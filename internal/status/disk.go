@@ -0,0 +1,42 @@
+//go:build !windows
+
+package status
+
+import (
+	"path/filepath"
+
+	"github.com/madhav/servctl/internal/storage"
+	"golang.org/x/sys/unix"
+)
+
+// DiskUsage reads the usage of the filesystem holding path with statfs
+func DiskUsage(path string) (DiskStatus, error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return DiskStatus{}, err
+	}
+	bsize := uint64(st.Bsize)
+	d := DiskStatus{
+		Path:    path,
+		Mounted: isMountPoint(path),
+		FSType:  storage.FilesystemAt(path),
+		Total:   st.Blocks * bsize,
+		Free:    st.Bavail * bsize,
+		Used:    (st.Blocks - st.Bfree) * bsize,
+	}
+	return d, nil
+}
+
+// isMountPoint reports whether path is the root of a filesystem: it is on a
+// different device from its parent (or is / itself)
+func isMountPoint(path string) bool {
+	path = filepath.Clean(path)
+	if path == "/" {
+		return true
+	}
+	var self, parent unix.Stat_t
+	if unix.Stat(path, &self) != nil || unix.Stat(filepath.Dir(path), &parent) != nil {
+		return false
+	}
+	return self.Dev != parent.Dev || self.Ino == parent.Ino
+}
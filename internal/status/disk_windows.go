@@ -0,0 +1,9 @@
+package status
+
+import "errors"
+
+// DiskUsage is not implemented on Windows; servctl reports storage on the
+// Linux server
+func DiskUsage(path string) (DiskStatus, error) {
+	return DiskStatus{}, errors.New("disk usage is not available on Windows")
+}
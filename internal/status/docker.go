@@ -0,0 +1,137 @@
+package status
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultDockerSocket is the rootful Docker daemon socket
+const DefaultDockerSocket = "/var/run/docker.sock"
+
+// dockerTimeout bounds each Engine API request so a hung daemon cannot
+// freeze the status view
+const dockerTimeout = 5 * time.Second
+
+// apiContainer is the subset of GET /containers/json that status uses
+type apiContainer struct {
+	Names  []string
+	Image  string
+	State  string
+	Status string
+	Labels map[string]string
+	Ports  []struct {
+		IP          string
+		PrivatePort int
+		PublicPort  int
+		Type        string
+	}
+}
+
+// DockerClient returns an HTTP client that talks to the Engine API over a
+// unix socket (DefaultDockerSocket when empty). Request URLs use any host,
+// e.g. "http://docker/containers/json".
+func DockerClient(socket string) *http.Client {
+	if socket == "" {
+		socket = DefaultDockerSocket
+	}
+	return &http.Client{
+		Timeout: dockerTimeout,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socket)
+			},
+		},
+	}
+}
+
+// DockerError explains a failed Engine API request without the request URL
+func DockerError(socket string, err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		err = urlErr.Err
+	}
+	return fmt.Errorf("cannot reach Docker at %s: %w", socket, err)
+}
+
+// ListServices queries the Docker daemon at socket for every container,
+// stopped ones included, sorted by service name
+func ListServices(socket string) ([]ServiceStatus, error) {
+	if socket == "" {
+		socket = DefaultDockerSocket
+	}
+	resp, err := DockerClient(socket).Get("http://docker/containers/json?all=1")
+	if err != nil {
+		return nil, DockerError(socket, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Docker API returned %s", resp.Status)
+	}
+
+	var containers []apiContainer
+	if err := json.NewDecoder(resp.Body).Decode(&containers); err != nil {
+		return nil, fmt.Errorf("cannot decode Docker API response: %w", err)
+	}
+
+	services := make([]ServiceStatus, 0, len(containers))
+	for _, c := range containers {
+		services = append(services, serviceFromAPI(c))
+	}
+	sort.Slice(services, func(i, j int) bool { return services[i].Name < services[j].Name })
+	return services, nil
+}
+
+// serviceFromAPI converts one Engine API container
+func serviceFromAPI(c apiContainer) ServiceStatus {
+	s := ServiceStatus{
+		Image:  c.Image,
+		State:  c.State,
+		Uptime: c.Status,
+		Health: parseHealth(c.Status),
+	}
+	if len(c.Names) > 0 {
+		s.Container = strings.TrimPrefix(c.Names[0], "/")
+	}
+	s.Name = c.Labels["com.docker.compose.service"]
+	if s.Name == "" {
+		s.Name = s.Container
+	}
+
+	// IPv4 and IPv6 bindings of one port are listed separately
+	seen := make(map[string]bool)
+	for _, p := range c.Ports {
+		if p.PublicPort == 0 {
+			continue
+		}
+		port := fmt.Sprintf("%d->%d/%s", p.PublicPort, p.PrivatePort, p.Type)
+		if !seen[port] {
+			seen[port] = true
+			s.Ports = append(s.Ports, port)
+		}
+	}
+	sort.Strings(s.Ports)
+	return s
+}
+
+// parseHealth extracts the healthcheck result Docker appends to the status,
+// e.g. "Up 2 hours (healthy)" or "Up 5 seconds (health: starting)"
+func parseHealth(status string) string {
+	switch {
+	case strings.Contains(status, "(unhealthy)"):
+		return "unhealthy"
+	case strings.Contains(status, "(healthy)"):
+		return "healthy"
+	case strings.Contains(status, "(health: starting)"):
+		return "starting"
+	}
+	return ""
+}
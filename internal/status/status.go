@@ -0,0 +1,224 @@
+// Package status collects the live state of a servctl server - containers,
+// mounted storage and drive health - into structured types shared by the
+// status command and anything else that reports on the server.
+package status
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/madhav/servctl/internal/storage"
+	"github.com/madhav/servctl/internal/ups"
+)
+
+// ServiceStatus is one container as reported by the Docker Engine API
+type ServiceStatus struct {
+	Name      string   `json:"name"`      // Compose service name, or the container name
+	Container string   `json:"container"` // Container name
+	Image     string   `json:"image"`
+	State     string   `json:"state"`  // running, exited, restarting, ...
+	Health    string   `json:"health"` // healthy, unhealthy, starting, or empty without a healthcheck
+	Uptime    string   `json:"uptime"` // Docker's human-readable status, e.g. "Up 3 hours"
+	Ports     []string `json:"ports"`  // Published ports, e.g. "8080->80/tcp"
+}
+
+// OK reports whether the service is running and not failing its healthcheck
+func (s ServiceStatus) OK() bool {
+	return s.State == "running" && s.Health != "unhealthy"
+}
+
+// DiskStatus is the usage of one storage path
+type DiskStatus struct {
+	Path    string `json:"path"`
+	Mounted bool   `json:"mounted"` // A filesystem is mounted at Path itself
+	FSType  string `json:"fs_type"`
+	Total   uint64 `json:"total"` // Bytes
+	Free    uint64 `json:"free"`  // Bytes available to unprivileged users
+	Used    uint64 `json:"used"`  // Bytes
+}
+
+// UsedPercent returns the share of the filesystem in use, as df reports it
+func (d DiskStatus) UsedPercent() float64 {
+	if d.Used+d.Free == 0 {
+		return 0
+	}
+	return float64(d.Used) / float64(d.Used+d.Free) * 100
+}
+
+// DriveStatus is the SMART health of one physical drive
+type DriveStatus struct {
+	Device string `json:"device"`
+	Model  string `json:"model"`
+	Health string `json:"health"`           // PASSED, FAILED or Unknown
+	TempC  int    `json:"temp_c,omitempty"` // 0 when unknown or the drive is in standby
+}
+
+// TempLevel classifies the drive's temperature as "ok", "warm" (over the
+// warning limit) or "hot" (over the critical limit); "" when unknown
+func (d DriveStatus) TempLevel() string {
+	if d.TempC == 0 {
+		return ""
+	}
+	warn, crit := storage.DriveTempLimits(d.Device)
+	switch {
+	case d.TempC >= crit:
+		return "hot"
+	case d.TempC >= warn:
+		return "warm"
+	}
+	return "ok"
+}
+
+// Report is a snapshot of the whole server
+type Report struct {
+	Time        time.Time       `json:"time"`
+	Services    []ServiceStatus `json:"services"`
+	DockerError string          `json:"docker_error,omitempty"` // Why Services is empty, when Docker was unreachable
+	Disks       []DiskStatus    `json:"disks"`
+	Drives      []DriveStatus   `json:"drives"`
+	UPS         *ups.Status     `json:"ups,omitempty"` // Only when a UPS is configured
+}
+
+// Options selects what Collect looks at
+type Options struct {
+	DockerSocket string   // Engine API socket; DefaultDockerSocket when empty
+	Paths        []string // Storage paths to report; missing ones are skipped
+	SkipDrives   bool     // Skip SMART queries (slow, and need sudo)
+	UPS          string   // NUT address of the UPS (e.g. ups.Address); none when empty
+}
+
+// Collect gathers a Report. Failures of one source are recorded rather than
+// returned so the others are still shown.
+func Collect(opts Options) Report {
+	r := Report{Time: time.Now()}
+
+	services, err := ListServices(opts.DockerSocket)
+	if err != nil {
+		r.DockerError = err.Error()
+	}
+	r.Services = services
+
+	seen := make(map[string]bool)
+	for _, path := range opts.Paths {
+		if path == "" || seen[path] {
+			continue
+		}
+		seen[path] = true
+		if d, err := DiskUsage(path); err == nil {
+			r.Disks = append(r.Disks, d)
+		}
+	}
+
+	if !opts.SkipDrives {
+		r.Drives = ListDrives()
+	}
+	if opts.UPS != "" {
+		u := ups.Query(opts.UPS)
+		r.UPS = &u
+	}
+	return r
+}
+
+// Service returns the service with the given compose name
+func (r Report) Service(name string) (ServiceStatus, bool) {
+	for _, s := range r.Services {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	return ServiceStatus{}, false
+}
+
+// ListDrives returns the SMART health of every physical disk
+func ListDrives() []DriveStatus {
+	disks, err := storage.DiscoverDisks()
+	if err != nil {
+		return nil
+	}
+	var drives []DriveStatus
+	for _, disk := range disks {
+		if strings.HasPrefix(disk.Name, "loop") {
+			continue
+		}
+		health, _ := storage.GetDiskSMARTHealth(disk.Path)
+		temp, _ := storage.GetDiskTemperature(disk.Path)
+		drives = append(drives, DriveStatus{Device: disk.Path, Model: disk.Model, Health: health, TempC: temp})
+	}
+	sort.Slice(drives, func(i, j int) bool { return drives[i].Device < drives[j].Device })
+	return drives
+}
+
+// RefreshTemperatures re-reads the temperature of each drive, which changes
+// far more often than its SMART health
+func RefreshTemperatures(drives []DriveStatus) []DriveStatus {
+	refreshed := make([]DriveStatus, len(drives))
+	for i, d := range drives {
+		d.TempC, _ = storage.GetDiskTemperature(d.Device)
+		refreshed[i] = d
+	}
+	return refreshed
+}
+
+// Issue is one thing in the report that needs attention
+type Issue struct {
+	Message  string `json:"message"`
+	Critical bool   `json:"critical"` // Something is down or about to fail, not just worth a look
+}
+
+// Issues lists what needs attention in the report, most important source first
+func (r Report) Issues() []Issue {
+	var issues []Issue
+	add := func(critical bool, format string, args ...interface{}) {
+		issues = append(issues, Issue{Message: fmt.Sprintf(format, args...), Critical: critical})
+	}
+	if r.DockerError != "" {
+		add(true, "Docker: %s", r.DockerError)
+	}
+	for _, s := range r.Services {
+		if !s.OK() {
+			state := s.State
+			if s.Health == "unhealthy" {
+				state = "unhealthy"
+			}
+			add(true, "%s is %s", s.Name, state)
+		}
+	}
+	for _, d := range r.Disks {
+		if d.UsedPercent() >= 90 {
+			add(d.UsedPercent() >= 98, "%s is almost full", d.Path)
+		}
+	}
+	for _, d := range r.Drives {
+		if d.Health == "FAILED" {
+			add(true, "%s is failing SMART", d.Device)
+		}
+		if level := d.TempLevel(); level == "warm" || level == "hot" {
+			add(level == "hot", "%s is %s (%d°C)", d.Device, level, d.TempC)
+		}
+	}
+	if u := r.UPS; u != nil {
+		switch {
+		case u.Error != "":
+			add(false, "UPS: %s", u.Error)
+		case u.LowBattery():
+			add(true, "UPS battery is low (%d%%), shutting down", u.ChargePct)
+		case u.OnBattery():
+			add(false, "UPS is on battery (%d%%, %d min left)", u.ChargePct, u.RuntimeSec/60)
+		}
+		if u.ReplaceBattery() {
+			add(false, "UPS battery needs replacing")
+		}
+	}
+	return issues
+}
+
+// Problems lists what needs attention in the report, for one-line summaries
+func (r Report) Problems() []string {
+	var problems []string
+	for _, issue := range r.Issues() {
+		problems = append(problems, issue.Message)
+	}
+	return problems
+}
@@ -0,0 +1,209 @@
+package status
+
+import (
+	"net"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/madhav/servctl/internal/ups"
+)
+
+// fakeDocker serves body as GET /containers/json on a unix socket
+func fakeDocker(t *testing.T, body string) string {
+	t.Helper()
+	socket := filepath.Join(t.TempDir(), "docker.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skipf("unix sockets unavailable: %v", err)
+	}
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/containers/json" || r.URL.Query().Get("all") != "1" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(body))
+	})}
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+	return socket
+}
+
+const containersJSON = `[
+  {"Names": ["/immich_server"], "Image": "ghcr.io/immich-app/immich-server:release", "State": "running",
+   "Status": "Up 3 hours (healthy)", "Labels": {"com.docker.compose.service": "immich-server"},
+   "Ports": [{"IP": "0.0.0.0", "PrivatePort": 2283, "PublicPort": 2283, "Type": "tcp"},
+             {"IP": "::", "PrivatePort": 2283, "PublicPort": 2283, "Type": "tcp"}]},
+  {"Names": ["/nextcloud"], "Image": "nextcloud:29", "State": "running",
+   "Status": "Up 2 minutes (unhealthy)", "Labels": {"com.docker.compose.service": "nextcloud"},
+   "Ports": [{"IP": "0.0.0.0", "PrivatePort": 80, "PublicPort": 8080, "Type": "tcp"}]},
+  {"Names": ["/glances"], "Image": "nicolargo/glances", "State": "exited",
+   "Status": "Exited (1) 5 minutes ago", "Labels": {},
+   "Ports": [{"PrivatePort": 61208, "Type": "tcp"}]}
+]`
+
+func TestListServices(t *testing.T) {
+	services, err := ListServices(fakeDocker(t, containersJSON))
+	if err != nil {
+		t.Fatalf("ListServices() error: %v", err)
+	}
+
+	want := []ServiceStatus{
+		{Name: "glances", Container: "glances", Image: "nicolargo/glances", State: "exited",
+			Uptime: "Exited (1) 5 minutes ago"},
+		{Name: "immich-server", Container: "immich_server", Image: "ghcr.io/immich-app/immich-server:release",
+			State: "running", Health: "healthy", Uptime: "Up 3 hours (healthy)", Ports: []string{"2283->2283/tcp"}},
+		{Name: "nextcloud", Container: "nextcloud", Image: "nextcloud:29", State: "running",
+			Health: "unhealthy", Uptime: "Up 2 minutes (unhealthy)", Ports: []string{"8080->80/tcp"}},
+	}
+	if !reflect.DeepEqual(services, want) {
+		t.Errorf("ListServices() =\n%+v\nwant\n%+v", services, want)
+	}
+
+	for _, s := range services {
+		if got, want := s.OK(), s.Name == "immich-server"; got != want {
+			t.Errorf("%s.OK() = %v, want %v", s.Name, got, want)
+		}
+	}
+}
+
+func TestListServices_Unreachable(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "missing.sock")
+	_, err := ListServices(socket)
+	if err == nil || !strings.Contains(err.Error(), "cannot reach Docker at "+socket) {
+		t.Errorf("ListServices() error = %v, want unreachable socket", err)
+	}
+}
+
+func TestParseHealth(t *testing.T) {
+	for status, want := range map[string]string{
+		"Up 2 hours (healthy)":            "healthy",
+		"Up 2 hours (unhealthy)":          "unhealthy",
+		"Up 5 seconds (health: starting)": "starting",
+		"Up 2 hours":                      "",
+		"Exited (0) 3 days ago":           "",
+	} {
+		if got := parseHealth(status); got != want {
+			t.Errorf("parseHealth(%q) = %q, want %q", status, got, want)
+		}
+	}
+}
+
+func TestDiskUsage(t *testing.T) {
+	dir := t.TempDir()
+	d, err := DiskUsage(dir)
+	if err != nil {
+		t.Fatalf("DiskUsage() error: %v", err)
+	}
+	if d.Total == 0 || d.Used > d.Total || d.Free > d.Total {
+		t.Errorf("DiskUsage() = %+v, want consistent sizes", d)
+	}
+	if p := d.UsedPercent(); p < 0 || p > 100 {
+		t.Errorf("UsedPercent() = %v", p)
+	}
+	if d.Mounted {
+		t.Errorf("%s is a plain directory, not a mount point", dir)
+	}
+
+	root, _ := DiskUsage("/")
+	if !root.Mounted {
+		t.Error("/ should always count as mounted")
+	}
+
+	if _, err := DiskUsage(filepath.Join(dir, "missing")); err == nil {
+		t.Error("DiskUsage() of a missing path should fail")
+	}
+}
+
+func TestCollect(t *testing.T) {
+	dir := t.TempDir()
+	r := Collect(Options{
+		DockerSocket: fakeDocker(t, containersJSON),
+		Paths:        []string{dir, "", dir, filepath.Join(dir, "missing")},
+		SkipDrives:   true,
+	})
+	if r.DockerError != "" || len(r.Services) != 3 {
+		t.Errorf("Collect() services = %d, error %q", len(r.Services), r.DockerError)
+	}
+	if len(r.Disks) != 1 || r.Disks[0].Path != dir {
+		t.Errorf("Collect() disks = %+v, want %s once", r.Disks, dir)
+	}
+	if r.Drives != nil {
+		t.Error("SkipDrives should leave Drives empty")
+	}
+
+	problems := strings.Join(r.Problems(), "\n")
+	for _, want := range []string{"glances is exited", "nextcloud is unhealthy"} {
+		if !strings.Contains(problems, want) {
+			t.Errorf("Problems() = %q, missing %q", problems, want)
+		}
+	}
+	if strings.Contains(problems, "immich") {
+		t.Errorf("Problems() should not list healthy services: %q", problems)
+	}
+}
+
+func TestReport_Problems(t *testing.T) {
+	r := Report{
+		DockerError: "cannot reach Docker",
+		Disks:       []DiskStatus{{Path: "/mnt/data", Used: 95, Free: 5}, {Path: "/", Used: 10, Free: 90}},
+		Drives: []DriveStatus{
+			{Device: "/dev/sda", Health: "FAILED"},
+			{Device: "/dev/sdb", Health: "PASSED", TempC: 56},
+			{Device: "/dev/nvme0n1", Health: "PASSED", TempC: 56},
+		},
+	}
+	want := []string{"Docker: cannot reach Docker", "/mnt/data is almost full", "/dev/sda is failing SMART", "/dev/sdb is hot (56°C)"}
+	if got := r.Problems(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Problems() = %q, want %q", got, want)
+	}
+}
+
+func TestReport_ProblemsUPS(t *testing.T) {
+	tests := []struct {
+		ups  ups.Status
+		want []string
+	}{
+		{ups.Status{Flags: []string{"OL"}, ChargePct: 100}, nil},
+		{ups.Status{Flags: []string{"OB", "DISCHRG"}, ChargePct: 80, RuntimeSec: 900}, []string{"UPS is on battery (80%, 15 min left)"}},
+		{ups.Status{Flags: []string{"OB", "LB"}, ChargePct: 9}, []string{"UPS battery is low (9%), shutting down"}},
+		{ups.Status{Flags: []string{"OL", "RB"}, ChargePct: 100}, []string{"UPS battery needs replacing"}},
+	}
+	for _, tt := range tests {
+		u := tt.ups
+		if got := (Report{UPS: &u}).Problems(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Problems() with UPS %v = %q, want %q", u.Flags, got, tt.want)
+		}
+	}
+}
+
+func TestDriveStatus_TempLevel(t *testing.T) {
+	tests := []struct {
+		drive DriveStatus
+		want  string
+	}{
+		{DriveStatus{Device: "/dev/sda"}, ""},
+		{DriveStatus{Device: "/dev/sda", TempC: 38}, "ok"},
+		{DriveStatus{Device: "/dev/sda", TempC: 51}, "warm"},
+		{DriveStatus{Device: "/dev/sda", TempC: 55}, "hot"},
+		{DriveStatus{Device: "/dev/nvme0n1", TempC: 55}, "ok"},
+		{DriveStatus{Device: "/dev/nvme0n1", TempC: 81}, "hot"},
+	}
+	for _, tt := range tests {
+		if got := tt.drive.TempLevel(); got != tt.want {
+			t.Errorf("%s at %d°C: TempLevel() = %q, want %q", tt.drive.Device, tt.drive.TempC, got, tt.want)
+		}
+	}
+}
+
+func TestReport_Service(t *testing.T) {
+	r := Report{Services: []ServiceStatus{{Name: "cloudflared", State: "running", Health: "healthy"}}}
+	if s, ok := r.Service("cloudflared"); !ok || s.Health != "healthy" {
+		t.Errorf("Service(cloudflared) = %+v, %v", s, ok)
+	}
+	if _, ok := r.Service("nextcloud"); ok {
+		t.Error("Service() found a service that is not in the report")
+	}
+}
@@ -86,6 +86,9 @@ type Disk struct {
 	IsOSDisk     bool        `json:"is_os_disk"`   // Contains root filesystem
 	IsAvailable  bool        `json:"is_available"` // Available for use
 	SMARTHealth  string      `json:"smart_health"` // SMART health status
+
+	// Bad blocks the recorded surface scan found (see ApplySurfaceScans)
+	SurfaceErrors int `json:"surface_errors,omitempty"`
 }
 
 // lsblkOutput represents the JSON output from lsblk
@@ -155,16 +158,26 @@ func getUint64Value(v interface{}) uint64 {
 	return 0
 }
 
+// runCommand runs a system tool and returns its stdout. On a non-zero exit
+// the output is still returned alongside the error. Tests replace it with a
+// fake that replays recorded output from testdata/.
+var runCommand = func(name string, args ...string) ([]byte, error) {
+	return exec.Command(name, args...).Output()
+}
+
 // DiscoverDisks discovers all block devices on the system
 func DiscoverDisks() ([]Disk, error) {
 	// Run lsblk with JSON output
-	cmd := exec.Command("lsblk", "-J", "-b", "-o",
+	output, err := runCommand("lsblk", "-J", "-b", "-o",
 		"NAME,SIZE,TYPE,MODEL,SERIAL,ROTA,RM,TRAN,MOUNTPOINT,FSTYPE,LABEL,UUID")
-	output, err := cmd.Output()
 	if err != nil {
 		return nil, fmt.Errorf("failed to run lsblk: %w", err)
 	}
+	return ParseLsblk(output)
+}
 
+// ParseLsblk converts the JSON output of 'lsblk -J -b' into disks
+func ParseLsblk(output []byte) ([]Disk, error) {
 	var lsblk lsblkOutput
 	if err := json.Unmarshal(output, &lsblk); err != nil {
 		return nil, fmt.Errorf("failed to parse lsblk output: %w", err)
@@ -177,6 +190,11 @@ func DiscoverDisks() ([]Disk, error) {
 			continue
 		}
 
+		// zram swap devices report type "disk" but live in RAM
+		if strings.HasPrefix(device.Name, "zram") {
+			continue
+		}
+
 		// Skip small loop devices (less than 100MB) - likely system loops
 		if device.Type == "loop" {
 			size := getUint64Value(device.Size)
@@ -214,7 +232,7 @@ func parseLsblkDevice(device lsblkDevice) Disk {
 	size := getUint64Value(device.Size)
 	if size > 0 {
 		disk.Size = size
-		disk.SizeHuman = formatBytes(size)
+		disk.SizeHuman = FormatBytes(size)
 		disk.SizeCategory = categorizeDiskSize(size)
 	}
 
@@ -240,23 +258,32 @@ func parseLsblkDevice(device lsblkDevice) Disk {
 			childSize := getUint64Value(child.Size)
 			if childSize > 0 {
 				partition.Size = childSize
-				partition.SizeHuman = formatBytes(childSize)
+				partition.SizeHuman = FormatBytes(childSize)
 			}
 			disk.Partitions = append(disk.Partitions, partition)
-
-			// Check if this is the OS disk
-			if getStringValue(child.Mountpoint) == "/" {
-				disk.IsOSDisk = true
-			}
 		}
 	}
 
+	// Check if this is the OS disk. The root filesystem may sit on a
+	// partition or further down on LVM/LUKS devices inside one.
+	disk.IsOSDisk = mountsRoot(device.Children)
+
 	// Determine if disk is available for use
 	disk.IsAvailable = !disk.IsOSDisk && !disk.Removable && len(disk.Partitions) == 0
 
 	return disk
 }
 
+// mountsRoot reports whether any device in the tree is mounted at /
+func mountsRoot(devices []lsblkDevice) bool {
+	for _, device := range devices {
+		if getStringValue(device.Mountpoint) == "/" || mountsRoot(device.Children) {
+			return true
+		}
+	}
+	return false
+}
+
 // classifyDiskType determines the type of disk
 func classifyDiskType(device lsblkDevice, rotational, removable bool) DiskType {
 	tran := getStringValue(device.Tran)
@@ -296,8 +323,8 @@ func categorizeDiskSize(bytes uint64) DiskSize {
 	}
 }
 
-// formatBytes converts bytes to human readable format
-func formatBytes(bytes uint64) string {
+// FormatBytes converts bytes to human readable format
+func FormatBytes(bytes uint64) string {
 	const (
 		KB = 1024
 		MB = 1024 * KB
@@ -321,21 +348,41 @@ func formatBytes(bytes uint64) string {
 
 // GetDiskSMARTHealth gets SMART health status for a disk
 func GetDiskSMARTHealth(diskPath string) (string, error) {
-	cmd := exec.Command("sudo", "smartctl", "-H", diskPath)
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		// smartctl might not be available or disk doesn't support SMART
-		return "Unknown", nil
-	}
+	// smartctl exits non-zero for failing disks too (bit 3), so the output
+	// is parsed whatever the exit status
+	output, _ := runCommand("sudo", "smartctl", "-H", diskPath)
+	return ParseSMARTHealth(string(output)), nil
+}
 
-	outputStr := string(output)
-	if strings.Contains(outputStr, "PASSED") {
-		return "PASSED", nil
-	} else if strings.Contains(outputStr, "FAILED") {
-		return "FAILED", nil
+// ParseSMARTHealth extracts the overall health from 'smartctl -H' output:
+// "PASSED", "FAILED" or "Unknown" when smartctl is missing, the disk has no
+// SMART support, or it sits behind a RAID controller (e.g. Dell PERC, which
+// needs '-d megaraid,N').
+func ParseSMARTHealth(output string) string {
+	for _, line := range strings.Split(output, "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch {
+		case strings.Contains(key, "overall-health self-assessment test result"):
+			// ATA and NVMe: "PASSED" or "FAILED!"
+			if strings.HasPrefix(value, "PASSED") {
+				return "PASSED"
+			}
+			if strings.HasPrefix(value, "FAILED") {
+				return "FAILED"
+			}
+		case strings.TrimSpace(key) == "SMART Health Status":
+			// SAS/SCSI: "OK" or the failure reason
+			if value == "OK" {
+				return "PASSED"
+			}
+			return "FAILED"
+		}
 	}
-
-	return "Unknown", nil
+	return "Unknown"
 }
 
 // FilterAvailableDisks returns only disks available for use
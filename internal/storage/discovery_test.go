@@ -1,6 +1,10 @@
 package storage
 
 import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
 	"testing"
 )
 
@@ -61,8 +65,8 @@ func TestFormatBytes(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.expected, func(t *testing.T) {
-			if got := formatBytes(tt.bytes); got != tt.expected {
-				t.Errorf("formatBytes(%d) = %v, want %v", tt.bytes, got, tt.expected)
+			if got := FormatBytes(tt.bytes); got != tt.expected {
+				t.Errorf("FormatBytes(%d) = %v, want %v", tt.bytes, got, tt.expected)
 			}
 		})
 	}
@@ -300,10 +304,165 @@ func TestDiscoverDisks(t *testing.T) {
 	}
 }
 
+// =============================================================================
+// Fixture corpus
+// testdata/lsblk and testdata/smartctl hold output recorded on real machines.
+// When a parsing bug turns up, add the machine's output there and its
+// expectations below; every fixture must have an entry.
+// =============================================================================
+
+// fakeCommand makes runCommand replay output (and err) for the test
+func fakeCommand(t *testing.T, output []byte, err error) *[][]string {
+	t.Helper()
+	var calls [][]string
+	orig := runCommand
+	runCommand = func(name string, args ...string) ([]byte, error) {
+		calls = append(calls, append([]string{name}, args...))
+		return output, err
+	}
+	t.Cleanup(func() { runCommand = orig })
+	return &calls
+}
+
+// readFixtures returns fixture name -> content for a testdata directory and
+// fails if any fixture has no expectations
+func readFixtures[T any](t *testing.T, dir string, want map[string]T) map[string][]byte {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join("testdata", dir, "*"))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no fixtures in testdata/%s", dir)
+	}
+	fixtures := make(map[string][]byte)
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		name := filepath.Base(file)
+		if _, ok := want[name]; !ok {
+			t.Errorf("testdata/%s/%s has no expectations", dir, name)
+		}
+		fixtures[name] = data
+	}
+	return fixtures
+}
+
+func TestDiscoverDisks_Fixtures(t *testing.T) {
+	type wantDisk struct {
+		name       string
+		diskType   DiskType
+		osDisk     bool
+		available  bool
+		partitions int
+	}
+	want := map[string][]wantDisk{
+		// LVM root three levels down; the snap loop device is too small
+		"nuc-ubuntu22.json": {
+			{"sda", DiskTypeSSD, false, true, 0},
+			{"nvme0n1", DiskTypeNVMe, true, false, 3},
+		},
+		// USB HDD, SD card OS disk, zram swap that reports type "disk"
+		"pi4-ubuntu24.json": {
+			{"sda", DiskTypeUSB, false, true, 0},
+			{"mmcblk0", DiskTypeSSD, true, false, 2},
+		},
+		// util-linux 2.34 strings for every value; RAID virtual disks have
+		// no transport; the optical drive is skipped
+		"dell-perc-ubuntu20.json": {
+			{"sda", DiskTypeHDD, true, false, 2},
+			{"sdb", DiskTypeHDD, false, true, 0},
+		},
+	}
+
+	for name, data := range readFixtures(t, "lsblk", want) {
+		t.Run(name, func(t *testing.T) {
+			calls := fakeCommand(t, data, nil)
+			disks, err := DiscoverDisks()
+			if err != nil {
+				t.Fatalf("DiscoverDisks() error: %v", err)
+			}
+			if len(*calls) != 1 || (*calls)[0][0] != "lsblk" {
+				t.Errorf("DiscoverDisks() ran %v, want lsblk", *calls)
+			}
+			if len(disks) != len(want[name]) {
+				t.Fatalf("DiscoverDisks() found %d disks, want %d: %+v", len(disks), len(want[name]), disks)
+			}
+			for i, w := range want[name] {
+				d := disks[i]
+				if d.Name != w.name || d.Type != w.diskType || d.IsOSDisk != w.osDisk ||
+					d.IsAvailable != w.available || len(d.Partitions) != w.partitions {
+					t.Errorf("disk %d = {%s %s os=%v avail=%v parts=%d}, want %+v",
+						i, d.Name, d.Type, d.IsOSDisk, d.IsAvailable, len(d.Partitions), w)
+				}
+				if d.Size == 0 || d.Path != "/dev/"+w.name {
+					t.Errorf("disk %s: size %d, path %s", d.Name, d.Size, d.Path)
+				}
+			}
+			if GetOSDisk(disks) == nil {
+				t.Error("GetOSDisk() found no OS disk")
+			}
+		})
+	}
+}
+
+func TestDiscoverDisks_Errors(t *testing.T) {
+	fakeCommand(t, nil, exec.ErrNotFound)
+	if _, err := DiscoverDisks(); err == nil {
+		t.Error("DiscoverDisks() should fail without lsblk")
+	}
+
+	fakeCommand(t, []byte("lsblk: unknown column: TRAN"), nil)
+	if _, err := DiscoverDisks(); err == nil {
+		t.Error("DiscoverDisks() should fail on non-JSON output")
+	}
+}
+
+func TestGetDiskSMARTHealth_Fixtures(t *testing.T) {
+	// Exit status smartctl returned alongside each recording
+	type wantHealth struct {
+		health string
+		exit   int
+	}
+	want := map[string]wantHealth{
+		"ata-passed.txt":    {"PASSED", 0},
+		"nvme-passed.txt":   {"PASSED", 0},
+		"ata-failed.txt":    {"FAILED", 8},
+		"sas-ok.txt":        {"PASSED", 0},
+		"sas-failing.txt":   {"FAILED", 8},
+		"perc-megaraid.txt": {"Unknown", 2},
+		"usb-bridge.txt":    {"Unknown", 1},
+	}
+
+	for name, data := range readFixtures(t, "smartctl", want) {
+		t.Run(name, func(t *testing.T) {
+			var err error
+			if want[name].exit != 0 {
+				err = errors.New("exit status")
+			}
+			calls := fakeCommand(t, data, err)
+			health, herr := GetDiskSMARTHealth("/dev/sda")
+			if herr != nil {
+				t.Fatalf("GetDiskSMARTHealth() error: %v", herr)
+			}
+			if health != want[name].health {
+				t.Errorf("GetDiskSMARTHealth() = %q, want %q", health, want[name].health)
+			}
+			if got := (*calls)[0]; got[len(got)-1] != "/dev/sda" {
+				t.Errorf("smartctl called with %v", got)
+			}
+		})
+	}
+
+	fakeCommand(t, nil, exec.ErrNotFound)
+	if health, _ := GetDiskSMARTHealth("/dev/sda"); health != "Unknown" {
+		t.Errorf("GetDiskSMARTHealth() without smartctl = %q, want Unknown", health)
+	}
+}
+
 // Benchmark tests
 func BenchmarkFormatBytes(b *testing.B) {
 	for i := 0; i < b.N; i++ {
-		formatBytes(1099511627776)
+		FormatBytes(1099511627776)
 	}
 }
 
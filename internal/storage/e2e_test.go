@@ -0,0 +1,253 @@
+//go:build e2e
+
+package storage
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// =============================================================================
+// End-to-end storage tests
+// Every strategy is applied for real to loop devices: mkfs, mount, /etc/fstab,
+// mdadm/zpool, mergerfs and cron. They rewrite system files, so they only run
+// as root with SERVCTL_E2E=1, meant for a disposable privileged container.
+// Run with: make docker-e2e
+// =============================================================================
+
+// requireE2E skips unless this is a disposable root environment
+func requireE2E(t *testing.T, tools ...string) {
+	t.Helper()
+	if os.Getenv("SERVCTL_E2E") != "1" {
+		t.Skip("set SERVCTL_E2E=1 in a disposable privileged container to run")
+	}
+	if os.Geteuid() != 0 {
+		t.Skip("e2e storage tests need root")
+	}
+	for _, tool := range append([]string{"losetup", "mkfs.ext4", "mount", "umount"}, tools...) {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s not available", tool)
+		}
+	}
+}
+
+// newLoopDisk attaches a sparse image of sizeMB as a loop device
+func newLoopDisk(t *testing.T, sizeMB uint64, diskType DiskType) Disk {
+	t.Helper()
+	img := filepath.Join(t.TempDir(), "disk.img")
+	f, err := os.Create(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Truncate(int64(sizeMB << 20)); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	out, err := exec.Command("losetup", "--find", "--show", img).CombinedOutput()
+	if err != nil {
+		t.Fatalf("losetup failed: %v - %s", err, out)
+	}
+	dev := strings.TrimSpace(string(out))
+	t.Cleanup(func() { exec.Command("losetup", "-d", dev).Run() })
+
+	return Disk{
+		Name:        filepath.Base(dev),
+		Path:        dev,
+		Size:        sizeMB << 20,
+		Type:        diskType,
+		Rotational:  diskType == DiskTypeHDD,
+		IsAvailable: true,
+	}
+}
+
+// mounts returns mount point -> devices from /proc/self/mounts
+func mounts(t *testing.T) map[string][]string {
+	t.Helper()
+	data, err := os.ReadFile("/proc/self/mounts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := make(map[string][]string)
+	for _, line := range strings.Split(string(data), "\n") {
+		if fields := strings.Fields(line); len(fields) >= 2 {
+			m[fields[1]] = append(m[fields[1]], fields[0])
+		}
+	}
+	return m
+}
+
+// restoreSystem undoes a strategy after the test: unmounts what it mounted,
+// tears down arrays and pools, and puts /etc/fstab and cron back. It must be
+// registered after the loop disks so it runs before they are detached.
+func restoreSystem(t *testing.T) {
+	t.Helper()
+	fstab, err := os.ReadFile("/etc/fstab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := mounts(t)
+
+	t.Cleanup(func() {
+		// Unmount in reverse mount order (the mergerfs pool before its branches)
+		data, _ := os.ReadFile("/proc/self/mounts")
+		lines := strings.Split(string(data), "\n")
+		for i := len(lines) - 1; i >= 0; i-- {
+			fields := strings.Fields(lines[i])
+			if len(fields) < 2 || !strings.HasPrefix(fields[1], "/mnt/") {
+				continue
+			}
+			if _, existed := before[fields[1]]; !existed {
+				exec.Command("umount", "-l", fields[1]).Run()
+			}
+		}
+		exec.Command("zpool", "destroy", "-f", "servctl_pool").Run()
+		exec.Command("mdadm", "--stop", "/dev/md0").Run()
+		os.WriteFile("/etc/fstab", fstab, 0644)
+		os.Remove("/etc/fstab.bak")
+		os.Remove("/etc/cron.d/servctl-backup")
+		os.Remove("/usr/local/bin/servctl-backup.sh")
+	})
+}
+
+// fstabCount returns how many fstab entries mount at mountPoint
+func fstabCount(fstab []byte, mountPoint string) int {
+	n := 0
+	for _, line := range strings.Split(string(fstab), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && !strings.HasPrefix(fields[0], "#") && fields[1] == mountPoint {
+			n++
+		}
+	}
+	return n
+}
+
+func TestE2E_ApplyStrategy(t *testing.T) {
+	tests := []struct {
+		id    StrategyID
+		disks []DiskType
+		sizes []uint64
+		tools []string
+		// Expected mount point -> index of the disk mounted there (-1: any source)
+		mounts map[string]int
+		// Mount points expected in /etc/fstab exactly once
+		fstab []string
+		files []string
+	}{
+		{
+			id: StrategyPartition, disks: []DiskType{DiskTypeHDD}, sizes: []uint64{64},
+			mounts: map[string]int{"/mnt/data": 0},
+			fstab:  []string{"/mnt/data"},
+		},
+		{
+			id: StrategyMergerFS, disks: []DiskType{DiskTypeHDD, DiskTypeHDD}, sizes: []uint64{64, 64},
+			tools:  []string{"mergerfs"},
+			mounts: map[string]int{"/mnt/disk1": 0, "/mnt/disk2": 1, "/mnt/data": -1},
+			fstab:  []string{"/mnt/disk1", "/mnt/disk2", "/mnt/data"},
+		},
+		{
+			id: StrategyMirror, disks: []DiskType{DiskTypeHDD, DiskTypeHDD}, sizes: []uint64{64, 64},
+			tools:  []string{"mdadm"},
+			mounts: map[string]int{"/mnt/data": -1},
+		},
+		{
+			id: StrategyBackup, disks: []DiskType{DiskTypeHDD, DiskTypeHDD}, sizes: []uint64{64, 64},
+			mounts: map[string]int{"/mnt/data": 0, "/mnt/backup": 1},
+			fstab:  []string{"/mnt/data", "/mnt/backup"},
+			files:  []string{"/etc/cron.d/servctl-backup", "/usr/local/bin/servctl-backup.sh"},
+		},
+		{
+			id: StrategyScratchVault, disks: []DiskType{DiskTypeHDD, DiskTypeHDD}, sizes: []uint64{64, 96},
+			// The larger disk becomes the vault whatever the order
+			mounts: map[string]int{"/mnt/data": 1, "/mnt/scratch": 0},
+			fstab:  []string{"/mnt/data", "/mnt/scratch"},
+		},
+		{
+			id: StrategySpeedTiered, disks: []DiskType{DiskTypeSSD, DiskTypeHDD}, sizes: []uint64{64, 64},
+			mounts: map[string]int{"/mnt/fast1": 0, "/mnt/slow1": 1},
+			fstab:  []string{"/mnt/fast1", "/mnt/slow1"},
+			files:  []string{"/mnt/fast", "/mnt/data"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.id.String(), func(t *testing.T) {
+			requireE2E(t, tt.tools...)
+			if tt.id == StrategyMirror {
+				// SetupMirror prefers ZFS whenever zpool is installed, which
+				// needs the kernel module on the host
+				if _, err := exec.LookPath("zpool"); err == nil && exec.Command("zpool", "list").Run() != nil {
+					t.Skip("zpool installed but ZFS is not usable here")
+				}
+			}
+
+			var disks []Disk
+			for i, dt := range tt.disks {
+				disks = append(disks, newLoopDisk(t, tt.sizes[i], dt))
+			}
+			restoreSystem(t)
+
+			strategy := Strategy{ID: tt.id, Name: tt.id.String(), Disks: disks}
+			config := map[string]string{"filesystem": "ext4", "backup_schedule": "daily"}
+
+			apply := func(run string) {
+				for _, r := range ApplyStrategy(strategy, config, false) {
+					if !r.Success {
+						t.Fatalf("%s run: %s", run, r.Message)
+					}
+				}
+			}
+			check := func(run string) []byte {
+				current := mounts(t)
+				for mp, idx := range tt.mounts {
+					sources := current[mp]
+					if len(sources) != 1 {
+						t.Fatalf("%s run: %s mounted %d times, want once (%v)", run, mp, len(sources), sources)
+					}
+					if idx >= 0 && sources[0] != disks[idx].Path {
+						t.Errorf("%s run: %s is %s, want %s", run, mp, sources[0], disks[idx].Path)
+					}
+				}
+				fstab, _ := os.ReadFile("/etc/fstab")
+				for _, mp := range tt.fstab {
+					if n := fstabCount(fstab, mp); n != 1 {
+						t.Errorf("%s run: /etc/fstab has %d entries for %s, want 1", run, n, mp)
+					}
+				}
+				for _, path := range tt.files {
+					if _, err := os.Stat(path); err != nil {
+						t.Errorf("%s run: %v", run, err)
+					}
+				}
+				return fstab
+			}
+
+			apply("first")
+			first := check("first")
+
+			// A second run must be a no-op: no reformat, no duplicate mounts
+			// or fstab lines
+			marker := ""
+			if _, ok := tt.mounts["/mnt/data"]; ok {
+				marker = "/mnt/data/.e2e-marker"
+				if err := os.WriteFile(marker, []byte("keep"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			apply("second")
+			second := check("second")
+			if !bytes.Equal(first, second) {
+				t.Errorf("/etc/fstab changed on re-run:\n%s\n---\n%s", first, second)
+			}
+			if marker != "" {
+				if _, err := os.Stat(marker); err != nil {
+					t.Error("re-run lost data on /mnt/data (disk reformatted?)")
+				}
+			}
+		})
+	}
+}
@@ -5,7 +5,10 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"strconv"
 	"strings"
+
+	"github.com/madhav/servctl/internal/ops"
 )
 
 // FilesystemType represents supported filesystem types
@@ -151,55 +154,32 @@ func FormatDisk(diskPath string, fsType FilesystemType, label string, dryRun boo
 	}
 
 	// Build the command based on filesystem type
-	var cmd *exec.Cmd
+	var args []string
 	switch fsType {
 	case FSTypeExt4:
-		if dryRun {
-			fmt.Printf("[DRY RUN] Would execute: mkfs.ext4 -L %s %s\n", label, diskPath)
-			result.Success = true
-			return result, nil
-		}
-		cmd = exec.Command("sudo", "mkfs.ext4", "-L", label, diskPath)
+		args = []string{"sudo", "mkfs.ext4", "-L", label, diskPath}
 
 	case FSTypeXFS:
-		if dryRun {
-			fmt.Printf("[DRY RUN] Would execute: mkfs.xfs -L %s %s\n", label, diskPath)
-			result.Success = true
-			return result, nil
-		}
-		cmd = exec.Command("sudo", "mkfs.xfs", "-f", "-L", label, diskPath)
+		args = []string{"sudo", "mkfs.xfs", "-f", "-L", label, diskPath}
 
 	case FSTypeBtrfs:
-		if dryRun {
-			fmt.Printf("[DRY RUN] Would execute: mkfs.btrfs -L %s %s\n", label, diskPath)
-			result.Success = true
-			return result, nil
-		}
-		cmd = exec.Command("sudo", "mkfs.btrfs", "-L", label, diskPath)
+		args = []string{"sudo", "mkfs.btrfs", "-L", label, diskPath}
 
 	case FSTypeZFS:
 		// ZFS is special - we create a pool instead
-		if dryRun {
-			fmt.Printf("[DRY RUN] Would execute: zpool create %s %s\n", label, diskPath)
-			result.Success = true
-			return result, nil
-		}
-		// First check if zfs is available
-		if _, err := exec.LookPath("zpool"); err != nil {
+		if _, err := exec.LookPath("zpool"); err != nil && !dryRun {
 			result.Error = "ZFS is not installed. Install with: sudo apt install zfsutils-linux"
 			return result, fmt.Errorf("zfs not available")
 		}
-		cmd = exec.Command("sudo", "zpool", "create", "-f", label, diskPath)
+		args = []string{"sudo", "zpool", "create", "-f", label, diskPath}
 
 	default:
 		result.Error = fmt.Sprintf("Unsupported filesystem type: %s", fsType)
 		return result, fmt.Errorf("unsupported filesystem")
 	}
 
-	// Execute the command
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		result.Error = string(output)
+	if err := ops.Execute(dryRun, ops.Command{Args: args}); err != nil {
+		result.Error = err.Error()
 		return result, fmt.Errorf("format failed: %w", err)
 	}
 
@@ -209,17 +189,7 @@ func FormatDisk(diskPath string, fsType FilesystemType, label string, dryRun boo
 
 // WipeFilesystem removes all filesystem signatures from a disk
 func WipeFilesystem(diskPath string, dryRun bool) error {
-	if dryRun {
-		fmt.Printf("[DRY RUN] Would execute: wipefs -a %s\n", diskPath)
-		return nil
-	}
-
-	cmd := exec.Command("sudo", "wipefs", "-a", diskPath)
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("wipefs failed: %s - %w", string(output), err)
-	}
-	return nil
+	return ops.Execute(dryRun, ops.Command{Args: []string{"sudo", "wipefs", "-a", diskPath}})
 }
 
 // MountResult represents the result of a mount operation
@@ -237,30 +207,13 @@ func MountDisk(diskPath string, mountPoint string, dryRun bool) (*MountResult, e
 		MountPoint: mountPoint,
 	}
 
-	// Create mount point directory
-	if dryRun {
-		fmt.Printf("[DRY RUN] Would create directory: %s\n", mountPoint)
-	} else {
-		if err := os.MkdirAll(mountPoint, 0755); err != nil {
-			// Try with sudo
-			cmd := exec.Command("sudo", "mkdir", "-p", mountPoint)
-			if err := cmd.Run(); err != nil {
-				result.Error = fmt.Sprintf("Failed to create mount point: %v", err)
-				return result, err
-			}
-		}
-	}
-
-	// Mount the disk
-	if dryRun {
-		fmt.Printf("[DRY RUN] Would execute: mount %s %s\n", diskPath, mountPoint)
-	} else {
-		cmd := exec.Command("sudo", "mount", diskPath, mountPoint)
-		output, err := cmd.CombinedOutput()
-		if err != nil {
-			result.Error = string(output)
-			return result, fmt.Errorf("mount failed: %w", err)
-		}
+	// Create the mount point, then mount the disk
+	err := ops.Execute(dryRun,
+		ops.Mkdir{Path: mountPoint, Mode: 0755, Sudo: true},
+		ops.Command{Args: []string{"sudo", "mount", diskPath, mountPoint}})
+	if err != nil {
+		result.Error = err.Error()
+		return result, fmt.Errorf("mount failed: %w", err)
 	}
 
 	result.Success = true
@@ -301,24 +254,65 @@ func AddToFstab(entry FstabEntry, dryRun bool) error {
 		entry.Pass,
 	)
 
-	if dryRun {
-		fmt.Printf("[DRY RUN] Would add to /etc/fstab:\n  %s", fstabLine)
-		return nil
+	// Back up fstab first
+	backup := ops.Command{Args: []string{"sudo", "cp", fstabPath, fstabPath + ".bak"}}
+	if err := appendFstab(fstabPath, fstabLine, dryRun, backup); err != nil {
+		return fmt.Errorf("failed to add fstab entry: %w", err)
 	}
+	return nil
+}
 
-	// Create backup of fstab
-	backupCmd := exec.Command("sudo", "cp", fstabPath, fstabPath+".bak")
-	if err := backupCmd.Run(); err != nil {
-		return fmt.Errorf("failed to backup fstab: %w", err)
+// appendFstab adds line to fstab after the before operations. The whole
+// new file is checked and then swapped in, so a crash or a bad entry never
+// leaves an unbootable fstab.
+func appendFstab(fstabPath, line string, dryRun bool, before ...ops.Operation) error {
+	current, err := os.ReadFile(fstabPath)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", fstabPath, err)
 	}
-
-	// Append to fstab using tee (for sudo)
-	cmd := exec.Command("sudo", "tee", "-a", fstabPath)
-	cmd.Stdin = strings.NewReader(fstabLine)
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to add fstab entry: %w", err)
+	content := string(current)
+	if content != "" && !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	content += line
+	if err := validateFstab(content); err != nil {
+		return fmt.Errorf("%s would be invalid: %w", fstabPath, err)
 	}
+	write := ops.WriteFile{Path: fstabPath, Content: []byte(content), Mode: 0644, Sudo: true}
+	return ops.Execute(dryRun, append(before, write)...)
+}
 
+// validateFstab checks that every entry has a device, mount point, type
+// and options, numeric dump and pass fields if any, and that no two
+// entries mount at the same place
+func validateFstab(content string) error {
+	mounts := make(map[string]int)
+	for i, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 4 || len(fields) > 6 {
+			return fmt.Errorf("line %d: expected 4 to 6 fields, got %d", i+1, len(fields))
+		}
+		for _, field := range fields[4:] {
+			if _, err := strconv.Atoi(field); err != nil {
+				return fmt.Errorf("line %d: dump and pass must be numbers, got %q", i+1, field)
+			}
+		}
+		mountPoint := fields[1]
+		if mountPoint == "none" || mountPoint == "swap" {
+			continue
+		}
+		if !strings.HasPrefix(mountPoint, "/") {
+			return fmt.Errorf("line %d: mount point %q is not an absolute path", i+1, mountPoint)
+		}
+		if first, dup := mounts[mountPoint]; dup {
+			return fmt.Errorf("line %d: %s is already mounted by line %d", i+1, mountPoint, first)
+		}
+		mounts[mountPoint] = i + 1
+	}
 	return nil
 }
 
@@ -349,17 +343,7 @@ func fstabEntryExists(fstabPath string, mountPoint string) (bool, error) {
 
 // MountAll runs mount -a to mount all fstab entries
 func MountAll(dryRun bool) error {
-	if dryRun {
-		fmt.Println("[DRY RUN] Would execute: mount -a")
-		return nil
-	}
-
-	cmd := exec.Command("sudo", "mount", "-a")
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("mount -a failed: %s - %w", string(output), err)
-	}
-	return nil
+	return ops.Execute(dryRun, ops.Command{Args: []string{"sudo", "mount", "-a"}})
 }
 
 // GetDiskByUUID gets the UUID of a disk/partition
@@ -1,7 +1,10 @@
 package storage
 
 import (
+	"os"
+	"path/filepath"
 	"runtime"
+	"strings"
 	"testing"
 )
 
@@ -244,3 +247,45 @@ func BenchmarkGetDefaultFilesystem(b *testing.B) {
 		GetDefaultFilesystem()
 	}
 }
+
+func TestValidateFstab(t *testing.T) {
+	valid := "# /etc/fstab\nUUID=abc  /  ext4  errors=remount-ro  0  1\n/swap.img  none  swap  sw  0  0\n" +
+		"UUID=def  /mnt/data  ext4  defaults,nofail  0  2\n"
+	if err := validateFstab(valid); err != nil {
+		t.Errorf("Valid fstab rejected: %v", err)
+	}
+	tests := []struct {
+		name, line, want string
+	}{
+		{"truncated line", "UUID=ghi  /mnt/backup", "4 to 6 fields"},
+		{"bad pass", "UUID=ghi  /mnt/backup  ext4  defaults  0  x", "must be numbers"},
+		{"relative mount point", "UUID=ghi  mnt/backup  ext4  defaults  0  2", "not an absolute path"},
+		{"duplicate mount point", "UUID=ghi  /mnt/data  ext4  defaults  0  2", "already mounted by line 4"},
+	}
+	for _, tt := range tests {
+		err := validateFstab(valid + tt.line + "\n")
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: expected an error containing %q, got %v", tt.name, tt.want, err)
+		}
+	}
+}
+
+func TestAppendFstab(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fstab")
+	os.WriteFile(path, []byte("UUID=abc  /  ext4  defaults  0  1"), 0644)
+
+	if err := appendFstab(path, "UUID=def  /mnt/data  ext4  defaults  0  2\n", false); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	if string(data) != "UUID=abc  /  ext4  defaults  0  1\nUUID=def  /mnt/data  ext4  defaults  0  2\n" {
+		t.Errorf("Unexpected fstab:\n%s", data)
+	}
+
+	if err := appendFstab(path, "UUID=xyz  /mnt/data  ext4  defaults  0  2\n", false); err == nil {
+		t.Error("An entry that makes fstab invalid should be refused")
+	}
+	if after, _ := os.ReadFile(path); string(after) != string(data) {
+		t.Error("A refused entry must leave fstab unchanged")
+	}
+}
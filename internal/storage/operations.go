@@ -9,6 +9,9 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
+
+	"github.com/madhav/servctl/internal/ops"
 )
 
 // OperationResult represents the result of a storage operation
@@ -283,6 +286,14 @@ func (c StrategyConfig) ToConfigMap() map[string]string {
 
 // ApplyStrategy applies the selected storage strategy
 func ApplyStrategy(strategy Strategy, config map[string]string, dryRun bool) []OperationResult {
+	return ApplyStrategyProgress(strategy, config, dryRun, nil)
+}
+
+// ApplyStrategyProgress applies the selected storage strategy. The disks it
+// formats are formatted first, up to FormatConcurrency at a time, calling
+// progress with every disk's status as each starts and finishes. Mount
+// points, mounts and fstab entries follow one disk at a time, in order.
+func ApplyStrategyProgress(strategy Strategy, config map[string]string, dryRun bool, progress func([]FormatStatus)) []OperationResult {
 	var results []OperationResult
 
 	fsType := FSTypeExt4
@@ -300,26 +311,34 @@ func ApplyStrategy(strategy Strategy, config map[string]string, dryRun bool) []O
 		mountPoint = mp
 	}
 
+	jobs := strategyFormats(strategy, config, label, mountPoint)
+	concurrency := FormatConcurrency
+	if dryRun {
+		// Nothing to wait for; keeps the printed commands in order
+		concurrency = 1
+	}
+	formatted := formatDisks(jobs, fsType, concurrency, dryRun, progress)
+
+	// setUp adds the steps for the i-th formatted disk
+	setUp := func(i int) {
+		job := jobs[i]
+		results = append(results, formatted[i])
+		results = append(results, createMountPointWrapper(job.mountPoint, dryRun))
+		results = append(results, mountDiskWrapper(job.disk, job.mountPoint, dryRun))
+		results = append(results, addToFstabWrapper(job.disk, job.mountPoint, fsType.String(), dryRun))
+	}
+
 	switch strategy.ID {
 	case StrategyPartition:
 		// Single disk - simple format and mount
-		if len(strategy.Disks) > 0 {
-			disk := strategy.Disks[0]
-			results = append(results, formatDiskWrapper(disk.Path, fsType, label, dryRun))
-			results = append(results, createMountPointWrapper(mountPoint, dryRun))
-			results = append(results, mountDiskWrapper(disk.Path, mountPoint, dryRun))
-			results = append(results, addToFstabWrapper(disk.Path, mountPoint, fsType.String(), dryRun))
+		if len(jobs) > 0 {
+			setUp(0)
 		}
 
 	case StrategyMergerFS:
 		// Format each disk individually, then setup MergerFS
-		for i, disk := range strategy.Disks {
-			diskLabel := fmt.Sprintf("%s_%d", label, i+1)
-			diskMount := filepath.Join("/mnt", fmt.Sprintf("disk%d", i+1))
-			results = append(results, formatDiskWrapper(disk.Path, fsType, diskLabel, dryRun))
-			results = append(results, createMountPointWrapper(diskMount, dryRun))
-			results = append(results, mountDiskWrapper(disk.Path, diskMount, dryRun))
-			results = append(results, addToFstabWrapper(disk.Path, diskMount, fsType.String(), dryRun))
+		for i := range jobs {
+			setUp(i)
 		}
 		results = append(results, createMountPointWrapper(mountPoint, dryRun))
 		results = append(results, SetupMergerFS(strategy.Disks, mountPoint, "epmfs", dryRun))
@@ -328,29 +347,71 @@ func ApplyStrategy(strategy Strategy, config map[string]string, dryRun bool) []O
 		results = append(results, SetupMirror(strategy.Disks, mountPoint, dryRun))
 
 	case StrategyBackup:
-		if len(strategy.Disks) >= 2 {
-			primary := strategy.Disks[0]
-			backup := strategy.Disks[1]
-
-			// Primary disk
-			results = append(results, formatDiskWrapper(primary.Path, fsType, label, dryRun))
-			results = append(results, createMountPointWrapper(mountPoint, dryRun))
-			results = append(results, mountDiskWrapper(primary.Path, mountPoint, dryRun))
-			results = append(results, addToFstabWrapper(primary.Path, mountPoint, fsType.String(), dryRun))
-
-			// Backup disk
-			backupMount := "/mnt/backup"
-			results = append(results, formatDiskWrapper(backup.Path, fsType, label+"_backup", dryRun))
-			results = append(results, createMountPointWrapper(backupMount, dryRun))
-			results = append(results, mountDiskWrapper(backup.Path, backupMount, dryRun))
-			results = append(results, addToFstabWrapper(backup.Path, backupMount, fsType.String(), dryRun))
+		if len(jobs) == 2 {
+			// Primary disk, then the backup disk
+			setUp(0)
+			setUp(1)
 
 			// Setup backup cron
 			schedule := "daily"
 			if s, ok := config["backup_schedule"]; ok {
 				schedule = s
 			}
-			results = append(results, SetupBackupCron(mountPoint, backupMount, schedule, dryRun))
+			results = append(results, SetupBackupCron(mountPoint, jobs[1].mountPoint, schedule, dryRun))
+		}
+
+	case StrategyScratchVault:
+		// Vault (large disk), then scratch (small disk)
+		for i := range jobs {
+			setUp(i)
+		}
+
+	case StrategySpeedTiered:
+		fastDisks, _ := splitTiers(strategy.Disks)
+
+		// Fast tier
+		for i := range fastDisks {
+			setUp(i)
+		}
+		results = append(results, createMountPointWrapper("/mnt/fast", dryRun))
+
+		// Slow tier
+		for i := len(fastDisks); i < len(jobs); i++ {
+			setUp(i)
+		}
+		results = append(results, createMountPointWrapper(mountPoint, dryRun))
+	}
+
+	return results
+}
+
+// formatJob is a disk a strategy formats, with its filesystem label and
+// where it is mounted
+type formatJob struct {
+	disk, label, mountPoint string
+}
+
+// strategyFormats lists the disks a strategy formats, in the order
+// ApplyStrategyProgress sets them up. Mirror builds its array itself.
+func strategyFormats(strategy Strategy, config map[string]string, label, mountPoint string) []formatJob {
+	var jobs []formatJob
+	switch strategy.ID {
+	case StrategyPartition:
+		if len(strategy.Disks) > 0 {
+			jobs = append(jobs, formatJob{strategy.Disks[0].Path, label, mountPoint})
+		}
+
+	case StrategyMergerFS:
+		for i, disk := range strategy.Disks {
+			diskMount := filepath.Join("/mnt", fmt.Sprintf("disk%d", i+1))
+			jobs = append(jobs, formatJob{disk.Path, fmt.Sprintf("%s_%d", label, i+1), diskMount})
+		}
+
+	case StrategyBackup:
+		if len(strategy.Disks) >= 2 {
+			jobs = append(jobs,
+				formatJob{strategy.Disks[0].Path, label, mountPoint},
+				formatJob{strategy.Disks[1].Path, label + "_backup", "/mnt/backup"})
 		}
 
 	case StrategyScratchVault:
@@ -360,60 +421,118 @@ func ApplyStrategy(strategy Strategy, config map[string]string, dryRun bool) []O
 			if small.Size > large.Size {
 				large, small = small, large
 			}
-
-			// Vault (large disk)
-			results = append(results, formatDiskWrapper(large.Path, fsType, "vault", dryRun))
-			results = append(results, createMountPointWrapper(mountPoint, dryRun))
-			results = append(results, mountDiskWrapper(large.Path, mountPoint, dryRun))
-			results = append(results, addToFstabWrapper(large.Path, mountPoint, fsType.String(), dryRun))
-
-			// Scratch (small disk)
-			scratchMount := "/mnt/scratch"
-			results = append(results, formatDiskWrapper(small.Path, fsType, "scratch", dryRun))
-			results = append(results, createMountPointWrapper(scratchMount, dryRun))
-			results = append(results, mountDiskWrapper(small.Path, scratchMount, dryRun))
-			results = append(results, addToFstabWrapper(small.Path, scratchMount, fsType.String(), dryRun))
-		}
-
-	case StrategySpeedTiered:
-		var fastDisks, slowDisks []Disk
-		for _, d := range strategy.Disks {
-			if GetDiskSpeedClass(d) == SpeedClassFast {
-				fastDisks = append(fastDisks, d)
-			} else {
-				slowDisks = append(slowDisks, d)
+			scratchMount := DefaultStrategyConfig().ScratchMount
+			if sm, ok := config["scratch_mount"]; ok && sm != "" {
+				scratchMount = sm
 			}
+			jobs = append(jobs,
+				formatJob{large.Path, "vault", mountPoint},
+				formatJob{small.Path, "scratch", scratchMount})
 		}
 
-		// Fast tier
+	case StrategySpeedTiered:
+		fastDisks, slowDisks := splitTiers(strategy.Disks)
 		for i, disk := range fastDisks {
-			diskLabel := fmt.Sprintf("fast_%d", i+1)
-			diskMount := fmt.Sprintf("/mnt/fast%d", i+1)
-			results = append(results, formatDiskWrapper(disk.Path, fsType, diskLabel, dryRun))
-			results = append(results, createMountPointWrapper(diskMount, dryRun))
-			results = append(results, mountDiskWrapper(disk.Path, diskMount, dryRun))
-			results = append(results, addToFstabWrapper(disk.Path, diskMount, fsType.String(), dryRun))
+			jobs = append(jobs, formatJob{disk.Path, fmt.Sprintf("fast_%d", i+1), tierMount("fast", i)})
 		}
-		results = append(results, createMountPointWrapper("/mnt/fast", dryRun))
-
-		// Slow tier
 		for i, disk := range slowDisks {
-			diskLabel := fmt.Sprintf("data_%d", i+1)
-			diskMount := fmt.Sprintf("/mnt/slow%d", i+1)
-			results = append(results, formatDiskWrapper(disk.Path, fsType, diskLabel, dryRun))
-			results = append(results, createMountPointWrapper(diskMount, dryRun))
-			results = append(results, mountDiskWrapper(disk.Path, diskMount, dryRun))
-			results = append(results, addToFstabWrapper(disk.Path, diskMount, fsType.String(), dryRun))
+			jobs = append(jobs, formatJob{disk.Path, fmt.Sprintf("data_%d", i+1), tierMount("slow", i)})
+		}
+	}
+	return jobs
+}
+
+// FormatConcurrency is how many disks are formatted at once. mkfs mostly
+// waits on its drive, so separate drives format side by side.
+const FormatConcurrency = 4
+
+// FormatStatus is where one disk's format stands, for progress displays
+type FormatStatus struct {
+	Disk    string
+	Started bool
+	Done    bool
+	Err     error
+}
+
+// formatDisks formats each job's disk, up to concurrency at a time, and
+// returns one result per job in job order. progress, when set, gets a
+// snapshot of every disk's status as each starts and finishes.
+func formatDisks(jobs []formatJob, fsType FilesystemType, concurrency int, dryRun bool, progress func([]FormatStatus)) []OperationResult {
+	results := make([]OperationResult, len(jobs))
+	statuses := make([]FormatStatus, len(jobs))
+	for i, job := range jobs {
+		statuses[i].Disk = job.disk
+	}
+
+	var mu sync.Mutex
+	update := func(i int, change func(*FormatStatus)) {
+		mu.Lock()
+		defer mu.Unlock()
+		change(&statuses[i])
+		if progress != nil {
+			progress(append([]FormatStatus(nil), statuses...))
 		}
-		results = append(results, createMountPointWrapper(mountPoint, dryRun))
 	}
 
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < max(concurrency, 1); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				update(i, func(s *FormatStatus) { s.Started = true })
+				job := jobs[i]
+				results[i] = formatDiskWrapper(job.disk, fsType, job.label, job.mountPoint, dryRun)
+				update(i, func(s *FormatStatus) {
+					s.Done = true
+					s.Err = results[i].Error
+				})
+			}
+		}()
+	}
+	for i := range jobs {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+
 	return results
 }
 
+// RenderFormatProgress formats the single-line combined format display
+func RenderFormatProgress(statuses []FormatStatus) string {
+	done, failed := 0, 0
+	var formatting []string
+	for _, s := range statuses {
+		switch {
+		case s.Done && s.Err != nil:
+			failed++
+			done++
+		case s.Done:
+			done++
+		case s.Started:
+			formatting = append(formatting, filepath.Base(s.Disk))
+		}
+	}
+
+	line := fmt.Sprintf("  💽 %d/%d disks formatted", done, len(statuses))
+	if failed > 0 {
+		line += fmt.Sprintf(" (%d failed)", failed)
+	}
+	if len(formatting) > 0 {
+		line += " - formatting " + strings.Join(formatting, ", ")
+	}
+	return line
+}
+
 // Wrapper functions to adapt format.go functions to OperationResult
 
-func formatDiskWrapper(diskPath string, fsType FilesystemType, label string, dryRun bool) OperationResult {
+func formatDiskWrapper(diskPath string, fsType FilesystemType, label, mountPoint string, dryRun bool) OperationResult {
+	// Re-running a strategy must not reformat a disk it already set up
+	if isMountedAt(diskPath, mountPoint) {
+		return OperationResult{Success: true, Message: fmt.Sprintf("%s already mounted at %s, not reformatting", diskPath, mountPoint)}
+	}
 	result, err := FormatDisk(diskPath, fsType, label, dryRun)
 	if err != nil {
 		return OperationResult{Success: false, Message: err.Error(), Error: err}
@@ -422,16 +541,16 @@ func formatDiskWrapper(diskPath string, fsType FilesystemType, label string, dry
 }
 
 func createMountPointWrapper(mountPoint string, dryRun bool) OperationResult {
-	if dryRun {
-		return OperationResult{Success: true, Message: fmt.Sprintf("[Dry Run] Would create: %s", mountPoint)}
-	}
-	if err := os.MkdirAll(mountPoint, 0755); err != nil {
+	if err := ops.Execute(dryRun, ops.Mkdir{Path: mountPoint, Mode: 0755}); err != nil {
 		return OperationResult{Success: false, Message: err.Error(), Error: err}
 	}
 	return OperationResult{Success: true, Message: fmt.Sprintf("Created: %s", mountPoint)}
 }
 
 func mountDiskWrapper(diskPath, mountPoint string, dryRun bool) OperationResult {
+	if isMountedAt(diskPath, mountPoint) {
+		return OperationResult{Success: true, Message: fmt.Sprintf("%s already mounted at %s", diskPath, mountPoint)}
+	}
 	result, err := MountDisk(diskPath, mountPoint, dryRun)
 	if err != nil {
 		return OperationResult{Success: false, Message: err.Error(), Error: err}
@@ -467,35 +586,35 @@ func SetupMergerFS(disks []Disk, mountPoint, policy string, dryRun bool) Operati
 	fstabLine := fmt.Sprintf("%s %s fuse.mergerfs defaults,allow_other,use_ino,cache.files=partial,dropcacheonclose=true,category.create=%s 0 0\n",
 		sourcePath, mountPoint, policy)
 
-	if dryRun {
+	if IsMountPoint(mountPoint) {
 		result.Success = true
-		result.Message = fmt.Sprintf("[Dry Run] Would add MergerFS entry:\n  %s", fstabLine)
+		result.Message = fmt.Sprintf("MergerFS already mounted at %s", mountPoint)
 		return result
 	}
 
-	if _, err := exec.LookPath("mergerfs"); err != nil {
+	// A real run installs mergerfs before it gets here; a dry run did not
+	if _, err := exec.LookPath("mergerfs"); err != nil && !dryRun {
 		result.Error = fmt.Errorf("mergerfs not installed. Run: sudo apt install mergerfs")
 		result.Message = result.Error.Error()
 		return result
 	}
 
-	f, err := os.OpenFile("/etc/fstab", os.O_APPEND|os.O_WRONLY, 0644)
+	exists, err := fstabEntryExists("/etc/fstab", mountPoint)
 	if err != nil {
 		result.Error = err
 		result.Message = err.Error()
 		return result
 	}
-	defer f.Close()
-
-	if _, err := f.WriteString(fstabLine); err != nil {
-		result.Error = err
-		result.Message = err.Error()
-		return result
+	if !exists {
+		if err := appendFstab("/etc/fstab", fstabLine, dryRun); err != nil {
+			result.Error = err
+			result.Message = err.Error()
+			return result
+		}
 	}
 
-	cmd := exec.Command("mount", mountPoint)
-	if output, err := cmd.CombinedOutput(); err != nil {
-		result.Error = fmt.Errorf("mount failed: %w - %s", err, string(output))
+	if err := ops.Execute(dryRun, ops.Command{Args: []string{"mount", mountPoint}}); err != nil {
+		result.Error = fmt.Errorf("mount failed: %w", err)
 		result.Message = result.Error.Error()
 		return result
 	}
@@ -515,6 +634,12 @@ func SetupMirror(disks []Disk, mountPoint string, dryRun bool) OperationResult {
 		return result
 	}
 
+	if !dryRun && IsMountPoint(mountPoint) {
+		result.Success = true
+		result.Message = fmt.Sprintf("Mirror already mounted at %s", mountPoint)
+		return result
+	}
+
 	// Check for ZFS
 	if _, err := exec.LookPath("zpool"); err == nil {
 		return setupZFSMirror(disks, mountPoint, dryRun)
@@ -538,19 +663,10 @@ func setupZFSMirror(disks []Disk, mountPoint string, dryRun bool) OperationResul
 		diskPaths = append(diskPaths, d.Path)
 	}
 
-	args := append([]string{"create", "-f", "-m", mountPoint, "servctl_pool", "mirror"}, diskPaths...)
-
-	if dryRun {
-		result.Success = true
-		result.Message = fmt.Sprintf("[Dry Run] Would run: zpool %s", strings.Join(args, " "))
-		return result
-	}
-
-	cmd := exec.Command("zpool", args...)
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		result.Error = fmt.Errorf("zpool failed: %w - %s", err, string(output))
-		result.Message = result.Error.Error()
+	args := append([]string{"zpool", "create", "-f", "-m", mountPoint, "servctl_pool", "mirror"}, diskPaths...)
+	if err := ops.Execute(dryRun, ops.Command{Args: args}); err != nil {
+		result.Error = err
+		result.Message = err.Error()
 		return result
 	}
 
@@ -568,38 +684,25 @@ func setupMDADMMirror(disks []Disk, mountPoint string, dryRun bool) OperationRes
 	}
 
 	mdDevice := "/dev/md0"
-	args := append([]string{"--create", mdDevice, "--level=1", fmt.Sprintf("--raid-devices=%d", len(disks))}, diskPaths...)
-
-	if dryRun {
-		result.Success = true
-		result.Message = fmt.Sprintf("[Dry Run] Would run: mdadm %s", strings.Join(args, " "))
-		return result
-	}
-
-	cmd := exec.Command("mdadm", args...)
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		result.Error = fmt.Errorf("mdadm failed: %w - %s", err, string(output))
-		result.Message = result.Error.Error()
-		return result
-	}
-
-	// Format and mount the array
-	if _, err := FormatDisk(mdDevice, FSTypeExt4, "servctl_data", false); err != nil {
+	args := append([]string{"mdadm", "--create", mdDevice, "--level=1", fmt.Sprintf("--raid-devices=%d", len(disks))}, diskPaths...)
+	if err := ops.Execute(dryRun, ops.Command{Args: args}); err != nil {
 		result.Error = err
 		result.Message = err.Error()
 		return result
 	}
 
-	if err := os.MkdirAll(mountPoint, 0755); err != nil {
+	// Format and mount the array
+	if _, err := FormatDisk(mdDevice, FSTypeExt4, "servctl_data", dryRun); err != nil {
 		result.Error = err
 		result.Message = err.Error()
 		return result
 	}
 
-	mountCmd := exec.Command("mount", mdDevice, mountPoint)
-	if output, err := mountCmd.CombinedOutput(); err != nil {
-		result.Error = fmt.Errorf("mount failed: %w - %s", err, string(output))
+	err := ops.Execute(dryRun,
+		ops.Mkdir{Path: mountPoint, Mode: 0755},
+		ops.Command{Args: []string{"mount", mdDevice, mountPoint}})
+	if err != nil {
+		result.Error = fmt.Errorf("mount failed: %w", err)
 		result.Message = result.Error.Error()
 		return result
 	}
@@ -634,20 +737,11 @@ rsync -av --delete %s/ %s/
 echo "$(date): Backup completed" >> /var/log/servctl-backup.log
 `, source, dest)
 
-	if dryRun {
-		result.Success = true
-		result.Message = fmt.Sprintf("[Dry Run] Would create backup cron (%s)", schedule)
-		return result
-	}
-
-	if err := os.WriteFile(scriptPath, []byte(scriptContent), 0755); err != nil {
-		result.Error = err
-		result.Message = err.Error()
-		return result
-	}
-
 	cronLine := fmt.Sprintf("%s root %s\n", cronSchedule, scriptPath)
-	if err := os.WriteFile("/etc/cron.d/servctl-backup", []byte(cronLine), 0644); err != nil {
+	err := ops.Execute(dryRun,
+		ops.WriteFile{Path: scriptPath, Content: []byte(scriptContent), Mode: 0755},
+		ops.WriteFile{Path: "/etc/cron.d/servctl-backup", Content: []byte(cronLine), Mode: 0644})
+	if err != nil {
 		result.Error = err
 		result.Message = err.Error()
 		return result
@@ -657,3 +751,18 @@ echo "$(date): Backup completed" >> /var/log/servctl-backup.log
 	result.Message = fmt.Sprintf("Backup cron: %s → %s (%s)", source, dest, schedule)
 	return result
 }
+
+// isMountedAt reports whether device is mounted at mountPoint
+func isMountedAt(device, mountPoint string) bool {
+	data, err := os.ReadFile("/proc/self/mounts")
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[0] == device && fields[1] == filepath.Clean(mountPoint) {
+			return true
+		}
+	}
+	return false
+}
@@ -1,6 +1,8 @@
 package storage
 
 import (
+	"fmt"
+	"strings"
 	"testing"
 )
 
@@ -243,6 +245,58 @@ func TestApplyStrategy_SingleDisk_DryRun(t *testing.T) {
 	}
 }
 
+func TestApplyStrategyProgress_MergerFS(t *testing.T) {
+	strategy := Strategy{
+		ID:    StrategyMergerFS,
+		Disks: []Disk{{Path: "/dev/sdb"}, {Path: "/dev/sdc"}, {Path: "/dev/sdd"}, {Path: "/dev/sde"}},
+	}
+
+	var snapshots [][]FormatStatus
+	results := ApplyStrategyProgress(strategy, DefaultStrategyConfig().ToConfigMap(), true, func(s []FormatStatus) {
+		snapshots = append(snapshots, s)
+	})
+
+	// Each disk starts and finishes once
+	if len(snapshots) != 2*len(strategy.Disks) {
+		t.Fatalf("progress called %d times, want %d", len(snapshots), 2*len(strategy.Disks))
+	}
+	last := snapshots[len(snapshots)-1]
+	for _, s := range last {
+		if !s.Done || s.Err != nil {
+			t.Errorf("final status of %s = %+v, want done", s.Disk, s)
+		}
+	}
+	if got := RenderFormatProgress(last); got != "  💽 4/4 disks formatted" {
+		t.Errorf("RenderFormatProgress() = %q", got)
+	}
+
+	// Each disk's format, mount point, mount and fstab steps stay together
+	// and in disk order, whatever order the formats finish in
+	if len(results) != 4*4+2 {
+		t.Fatalf("got %d results, want 18", len(results))
+	}
+	for i, disk := range strategy.Disks {
+		for _, r := range results[4*i : 4*i+4] {
+			if !strings.Contains(r.Message, disk.Path) && !strings.Contains(r.Message, fmt.Sprintf("disk%d", i+1)) {
+				t.Errorf("step %q is not about %s", r.Message, disk.Path)
+			}
+		}
+	}
+}
+
+func TestRenderFormatProgress(t *testing.T) {
+	statuses := []FormatStatus{
+		{Disk: "/dev/sdb", Started: true, Done: true},
+		{Disk: "/dev/sdc", Started: true, Done: true, Err: fmt.Errorf("mkfs failed")},
+		{Disk: "/dev/sdd", Started: true},
+		{Disk: "/dev/sde"},
+	}
+	want := "  💽 2/4 disks formatted (1 failed) - formatting sdd"
+	if got := RenderFormatProgress(statuses); got != want {
+		t.Errorf("RenderFormatProgress() = %q, want %q", got, want)
+	}
+}
+
 func TestApplyStrategy_Backup_DryRun(t *testing.T) {
 	strategy := Strategy{
 		ID:   StrategyBackup,
@@ -370,8 +424,9 @@ func TestSetupBackupCron_DryRun(t *testing.T) {
 		if !result.Success {
 			t.Errorf("SetupBackupCron dry run failed for schedule %s", schedule)
 		}
-		if !containsStr(result.Message, "Dry Run") {
-			t.Error("Dry run message should indicate dry run")
+		// The engine prints what a real run would write; the result is the same
+		if !containsStr(result.Message, "("+schedule+")") {
+			t.Errorf("Message should name the schedule, got %q", result.Message)
 		}
 	}
 }
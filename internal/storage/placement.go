@@ -0,0 +1,68 @@
+package storage
+
+import "fmt"
+
+// Placement is where a storage layout puts the services' data: everything
+// under DataRoot, databases and caches on FastRoot and throwaway downloads
+// on ScratchRoot, the latter two empty when the layout has no such disk
+type Placement struct {
+	DataRoot    string
+	FastRoot    string
+	ScratchRoot string
+}
+
+// PlanPlacement returns where a strategy applied with config puts the data.
+// A speed-tiered layout mounts each disk on its own; the first fast disk
+// takes the databases and the first slow disk the data.
+func PlanPlacement(strategy Strategy, config StrategyConfig) Placement {
+	p := Placement{DataRoot: config.MountPoint}
+	switch strategy.ID {
+	case StrategySpeedTiered:
+		fast, slow := splitTiers(strategy.Disks)
+		if len(fast) > 0 {
+			p.FastRoot = tierMount("fast", 0)
+		}
+		if len(slow) > 0 {
+			p.DataRoot = tierMount("slow", 0)
+		}
+	case StrategyScratchVault:
+		if len(strategy.Disks) >= 2 {
+			p.ScratchRoot = config.ScratchMount
+		}
+	}
+	return p
+}
+
+// DetectPlacement finds the placement of disks set up earlier, for runs that
+// skip the storage phase: a fast or scratch disk counts when it is mounted
+func DetectPlacement(dataRoot string) Placement {
+	defaults := DefaultStrategyConfig()
+	p := Placement{DataRoot: dataRoot}
+	for _, fast := range []string{defaults.FastMount, tierMount("fast", 0), "/mnt/apps"} {
+		if IsMountPoint(fast) {
+			p.FastRoot = fast
+			break
+		}
+	}
+	if IsMountPoint(defaults.ScratchMount) {
+		p.ScratchRoot = defaults.ScratchMount
+	}
+	return p
+}
+
+// splitTiers separates fast (SSD, NVMe) from slow disks
+func splitTiers(disks []Disk) (fast, slow []Disk) {
+	for _, d := range disks {
+		if GetDiskSpeedClass(d) == SpeedClassFast {
+			fast = append(fast, d)
+		} else {
+			slow = append(slow, d)
+		}
+	}
+	return fast, slow
+}
+
+// tierMount is where a speed-tiered layout mounts the i-th disk of a tier
+func tierMount(tier string, i int) string {
+	return fmt.Sprintf("/mnt/%s%d", tier, i+1)
+}
@@ -0,0 +1,30 @@
+package storage
+
+import "testing"
+
+func TestPlanPlacement(t *testing.T) {
+	config := DefaultStrategyConfig()
+	tiered := Strategy{
+		ID: StrategySpeedTiered,
+		Disks: []Disk{
+			{Path: "/dev/nvme0n1", Type: DiskTypeNVMe, Transport: "nvme"},
+			{Path: "/dev/sdb", Type: DiskTypeHDD, Rotational: true},
+		},
+	}
+	got := PlanPlacement(tiered, config)
+	if got.FastRoot != "/mnt/fast1" || got.DataRoot != "/mnt/slow1" || got.ScratchRoot != "" {
+		t.Errorf("Speed-tiered placement = %+v", got)
+	}
+
+	config.ScratchMount = "/mnt/tmp"
+	vault := Strategy{ID: StrategyScratchVault, Disks: []Disk{{Path: "/dev/sda"}, {Path: "/dev/sdb"}}}
+	got = PlanPlacement(vault, config)
+	if got.DataRoot != "/mnt/data" || got.ScratchRoot != "/mnt/tmp" || got.FastRoot != "" {
+		t.Errorf("Scratch + Vault placement = %+v", got)
+	}
+
+	got = PlanPlacement(Strategy{ID: StrategyMirror}, config)
+	if got != (Placement{DataRoot: "/mnt/data"}) {
+		t.Errorf("A single pool should keep everything on it, got %+v", got)
+	}
+}
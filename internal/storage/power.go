@@ -2,9 +2,12 @@ package storage
 
 import (
 	"fmt"
+	"os"
 	"os/exec"
 	"strconv"
 	"strings"
+
+	"github.com/madhav/servctl/internal/ops"
 )
 
 // HDDPowerConfig represents power management configuration for an HDD
@@ -27,32 +30,16 @@ func DefaultHDDPowerConfig(diskPath string) HDDPowerConfig {
 
 // ConfigureHDDSpindown configures HDD spindown using hdparm
 func ConfigureHDDSpindown(config HDDPowerConfig, dryRun bool) error {
-	if dryRun {
-		fmt.Printf("[DRY RUN] Would configure HDD power management for %s:\n", config.DiskPath)
-		fmt.Printf("  Spindown time: %d (hdparm -S)\n", config.SpindownTime)
-		fmt.Printf("  APM level: %d (hdparm -B)\n", config.APMLevel)
-		return nil
-	}
-
-	// Check if hdparm is available
-	if _, err := exec.LookPath("hdparm"); err != nil {
+	// Check if hdparm is available; a real run has installed it by now
+	if _, err := exec.LookPath("hdparm"); err != nil && !dryRun {
 		return fmt.Errorf("hdparm not installed: %w", err)
 	}
 
-	// Set spindown time
-	spindownCmd := exec.Command("sudo", "hdparm", "-S", strconv.Itoa(config.SpindownTime), config.DiskPath)
-	if output, err := spindownCmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("failed to set spindown: %s - %w", string(output), err)
-	}
-
-	// Set APM level
-	apmCmd := exec.Command("sudo", "hdparm", "-B", strconv.Itoa(config.APMLevel), config.DiskPath)
-	if output, err := apmCmd.CombinedOutput(); err != nil {
-		// APM might not be supported, just warn
-		fmt.Printf("Warning: APM not supported on %s: %s\n", config.DiskPath, string(output))
-	}
-
-	return nil
+	return ops.Execute(dryRun,
+		// Set spindown time
+		ops.Command{Args: []string{"sudo", "hdparm", "-S", strconv.Itoa(config.SpindownTime), config.DiskPath}},
+		// Set APM level; not every drive supports it
+		ops.Command{Args: []string{"sudo", "hdparm", "-B", strconv.Itoa(config.APMLevel), config.DiskPath}, MayFail: true})
 }
 
 // HDParmConfEntry represents an entry in /etc/hdparm.conf
@@ -81,18 +68,15 @@ func AddToHdparmConf(entry HDParmConfEntry, dryRun bool) error {
 }
 `, entry.DiskPath, entry.SpindownTime, entry.APMLevel)
 
-	if dryRun {
-		fmt.Printf("[DRY RUN] Would add to /etc/hdparm.conf:\n%s", configEntry)
-		return nil
+	// Append to hdparm.conf by replacing it whole
+	current, err := os.ReadFile(hdparmConf)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read %s: %w", hdparmConf, err)
 	}
-
-	// Append to hdparm.conf using tee
-	cmd := exec.Command("sudo", "tee", "-a", hdparmConf)
-	cmd.Stdin = strings.NewReader(configEntry)
-	if err := cmd.Run(); err != nil {
+	op := ops.WriteFile{Path: hdparmConf, Content: append(current, configEntry...), Mode: 0644, Sudo: true}
+	if err := ops.Execute(dryRun, op); err != nil {
 		return fmt.Errorf("failed to add hdparm.conf entry: %w", err)
 	}
-
 	return nil
 }
 
@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/madhav/servctl/internal/ops"
+	"github.com/madhav/servctl/templates"
+)
+
+// PowerTuneUnitPath is the systemd unit that applies the idle power tuning
+// at every boot
+const PowerTuneUnitPath = "/etc/systemd/system/servctl-powertune.service"
+
+// aspmPolicyPath holds the kernel's PCIe ASPM policy, the selected one in
+// brackets: "default performance [powersave] powersupersave"
+var aspmPolicyPath = "/sys/module/pcie_aspm/parameters/policy"
+
+// GeneratePowerTuneUnit renders the unit, which runs 'powertop --auto-tune'
+// and asks for the deepest PCIe ASPM policy
+func GeneratePowerTuneUnit() string {
+	return templates.MustRender("system/powertune.service.tmpl", struct{ ASPMPolicyPath string }{aspmPolicyPath}, nil)
+}
+
+// ASPMPolicy returns the active PCIe ASPM policy, empty when the kernel has
+// no ASPM support
+func ASPMPolicy() string {
+	data, err := os.ReadFile(aspmPolicyPath)
+	if err != nil {
+		return ""
+	}
+	for _, field := range strings.Fields(string(data)) {
+		if strings.HasPrefix(field, "[") && strings.HasSuffix(field, "]") {
+			return strings.Trim(field, "[]")
+		}
+	}
+	return ""
+}
+
+// ConfigurePowerTuning installs powertop and the unit that tunes the
+// server for idle power at boot, and applies it now
+func ConfigurePowerTuning(install func(packages []string) error, dryRun bool) error {
+	var steps []ops.Operation
+	if _, err := exec.LookPath("powertop"); err != nil {
+		steps = append(steps, ops.Func{Description: "install powertop", Fn: func() error { return install([]string{"powertop"}) }})
+	}
+	return ops.Execute(dryRun, append(steps,
+		ops.WriteFile{Path: PowerTuneUnitPath, Content: []byte(GeneratePowerTuneUnit()), Mode: 0644, Sudo: true},
+		ops.Command{Args: []string{"sudo", "systemctl", "daemon-reload"}},
+		ops.Command{Args: []string{"sudo", "systemctl", "enable", "--now", "servctl-powertune.service"}},
+	)...)
+}
+
+// SpindownCandidates returns the hard drives a strategy leaves idle outside
+// backups. Only those are worth spinning down: drives Immich and Nextcloud
+// use are woken many times a day, and every spin-up wears the motor more
+// than hours of spinning.
+func SpindownCandidates(strategy Strategy) []Disk {
+	if strategy.ID != StrategyBackup || len(strategy.Disks) < 2 {
+		return nil
+	}
+	backup := strategy.Disks[1]
+	if backup.Type != DiskTypeHDD {
+		return nil
+	}
+	return []Disk{backup}
+}
+
+// ConfigureSpindown spins the given drives down after 30 idle minutes, now
+// and (through /etc/hdparm.conf) at every boot
+func ConfigureSpindown(disks []Disk, install func(packages []string) error, dryRun bool) error {
+	if _, err := exec.LookPath("hdparm"); err != nil && !dryRun {
+		if err := install([]string{"hdparm"}); err != nil {
+			return err
+		}
+	}
+	for _, disk := range disks {
+		config := DefaultHDDPowerConfig(disk.Path)
+		if err := ConfigureHDDSpindown(config, dryRun); err != nil {
+			return err
+		}
+		entry := HDParmConfEntry{DiskPath: disk.Path, SpindownTime: config.SpindownTime, APMLevel: config.APMLevel}
+		if err := AddToHdparmConf(entry, dryRun); err != nil {
+			return err
+		}
+	}
+	return nil
+}
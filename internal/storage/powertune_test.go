@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestASPMPolicy(t *testing.T) {
+	old := aspmPolicyPath
+	defer func() { aspmPolicyPath = old }()
+
+	aspmPolicyPath = filepath.Join(t.TempDir(), "policy")
+	if got := ASPMPolicy(); got != "" {
+		t.Errorf("ASPMPolicy() without ASPM = %q", got)
+	}
+	os.WriteFile(aspmPolicyPath, []byte("default performance [powersave] powersupersave\n"), 0644)
+	if got := ASPMPolicy(); got != "powersave" {
+		t.Errorf("ASPMPolicy() = %q, want powersave", got)
+	}
+}
+
+func TestGeneratePowerTuneUnit(t *testing.T) {
+	unit := GeneratePowerTuneUnit()
+	tune := strings.Index(unit, "powertop --auto-tune")
+	usb := strings.Index(unit, "power/control; do echo on")
+	if tune < 0 || usb < tune {
+		t.Errorf("USB must be switched back on after auto-tune:\n%s", unit)
+	}
+	for _, want := range []string{"echo powersupersave > /sys/module/pcie_aspm/parameters/policy'", "WantedBy=multi-user.target"} {
+		if !strings.Contains(unit, want) {
+			t.Errorf("unit missing %q:\n%s", want, unit)
+		}
+	}
+}
+
+func TestSpindownCandidates(t *testing.T) {
+	data := Disk{Name: "sda", Type: DiskTypeHDD}
+	backup := Disk{Name: "sdb", Type: DiskTypeHDD}
+
+	got := SpindownCandidates(Strategy{ID: StrategyBackup, Disks: []Disk{data, backup}})
+	if len(got) != 1 || got[0].Name != "sdb" {
+		t.Errorf("backup strategy: %+v, want the backup drive only", got)
+	}
+	if got := SpindownCandidates(Strategy{ID: StrategyMergerFS, Disks: []Disk{data, backup}}); len(got) != 0 {
+		t.Errorf("pooled data drives should keep spinning: %+v", got)
+	}
+	ssd := Disk{Name: "sdb", Type: DiskTypeSSD}
+	if got := SpindownCandidates(Strategy{ID: StrategyBackup, Disks: []Disk{data, ssd}}); len(got) != 0 {
+		t.Errorf("SSDs do not spin: %+v", got)
+	}
+}
@@ -3,6 +3,7 @@
 package storage
 
 import (
+	"fmt"
 	"os/exec"
 	"strings"
 )
@@ -264,8 +265,11 @@ func GenerateStrategies(disks []Disk, info SystemInfo) []Strategy {
 		sizeMismatch := len(available) == 2 &&
 			IsSizeMismatchLarge(available[0].Size, available[1].Size, 0.50)
 
+		// A disk a surface scan found bad blocks on is no one's safety net
+		trusted := !hasSurfaceErrors(available)
+
 		// Strategy 2: Mirror (if sizes similar and not hardware RAID)
-		if sizesSimilar && !hasHardwareRAID {
+		if sizesSimilar && !hasHardwareRAID && trusted {
 			smallerSize := available[0].Size
 			if available[1].Size < smallerSize {
 				smallerSize = available[1].Size
@@ -280,7 +284,7 @@ func GenerateStrategies(disks []Disk, info SystemInfo) []Strategy {
 				ID:          StrategyMirror,
 				Name:        "Mirror (" + fsType + ")",
 				Description: "Duplicate data across both drives for fault tolerance",
-				Capacity:    formatBytes(smallerSize),
+				Capacity:    FormatBytes(smallerSize),
 				Protection:  "1-disk fault tolerance",
 				BestFor:     "Critical data, Nextcloud, databases",
 				Score:       80,
@@ -290,7 +294,7 @@ func GenerateStrategies(disks []Disk, info SystemInfo) []Strategy {
 		}
 
 		// Strategy 3: Primary + Backup (if 2 disks, backupDisk >= primaryDisk)
-		if len(available) == 2 {
+		if len(available) == 2 && trusted {
 			primary, backup := available[0], available[1]
 			if backup.Size < primary.Size {
 				primary, backup = backup, primary
@@ -345,12 +349,31 @@ func GenerateStrategies(disks []Disk, info SystemInfo) []Strategy {
 		}
 	}
 
+	for i := range strategies {
+		for _, d := range strategies[i].Disks {
+			if d.SurfaceErrors > 0 {
+				strategies[i].Warning = fmt.Sprintf("⚠️ %s has %d bad blocks; keep only replaceable data on it", d.Path, d.SurfaceErrors)
+				break
+			}
+		}
+	}
+
 	// Score and rank strategies
 	strategies = ScoreStrategies(strategies)
 
 	return strategies
 }
 
+// hasSurfaceErrors reports whether any disk's surface scan found bad blocks
+func hasSurfaceErrors(disks []Disk) bool {
+	for _, d := range disks {
+		if d.SurfaceErrors > 0 {
+			return true
+		}
+	}
+	return false
+}
+
 // ScoreStrategies ranks strategies and marks the recommended one
 func ScoreStrategies(strategies []Strategy) []Strategy {
 	if len(strategies) == 0 {
@@ -391,5 +414,5 @@ func calculateTotalCapacity(disks []Disk) string {
 	for _, d := range disks {
 		total += d.Size
 	}
-	return formatBytes(total)
+	return FormatBytes(total)
 }
@@ -0,0 +1,270 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/madhav/servctl/internal/ops"
+)
+
+// SnapshotDir holds Btrfs snapshots of the data root, relative to it.
+// ZFS keeps its snapshots in the dataset's hidden .zfs directory instead.
+const SnapshotDir = ".snapshots"
+
+// SnapshotKeep is how many servctl snapshots are kept; older ones are
+// deleted after each new one
+const SnapshotKeep = 5
+
+// Snapshot is a read-only copy of the data root taken before a risky change
+type Snapshot struct {
+	Name      string    // e.g., "servctl-20261017-101500"
+	FS        string    // "btrfs" or "zfs"
+	Source    string    // Btrfs subvolume or ZFS dataset that was snapshotted
+	Path      string    // Btrfs snapshot directory or ZFS "dataset@name"
+	Reason    string    // What was about to happen (e.g., "container upgrade")
+	CreatedAt time.Time `json:"created_at"`
+
+	// Partial snapshots (Docker volumes): the filesystem holding a directory
+	// is snapshotted, but a rollback only restores that directory
+	Mount   string `json:",omitempty"` // Where Source is mounted
+	Restore string `json:",omitempty"` // Directory under Mount that a rollback restores
+}
+
+// SnapshotFS returns "btrfs" or "zfs" when dataRoot is on a filesystem that
+// can snapshot it, or "" otherwise
+func SnapshotFS(dataRoot string) string {
+	switch fs := FilesystemAt(dataRoot); fs {
+	case "btrfs", "zfs":
+		return fs
+	}
+	return ""
+}
+
+// newSnapshot describes the snapshot of source that would be taken at now
+func newSnapshot(fs, source, dataRoot, reason string, now time.Time) Snapshot {
+	s := Snapshot{
+		Name:      "servctl-" + now.Format("20060102-150405"),
+		FS:        fs,
+		Source:    source,
+		Reason:    reason,
+		CreatedAt: now,
+	}
+	if fs == "zfs" {
+		s.Path = source + "@" + s.Name
+	} else {
+		s.Path = filepath.Join(dataRoot, SnapshotDir, s.Name)
+	}
+	return s
+}
+
+// Target is what a rollback to the snapshot overwrites: the snapshotted
+// subvolume or dataset, or the restored directory of a partial snapshot
+func (s Snapshot) Target() string {
+	if s.Restore != "" {
+		return filepath.Join(s.Mount, s.Restore)
+	}
+	return s.Source
+}
+
+// createArgs is the command that takes the snapshot
+func (s Snapshot) createArgs() []string {
+	if s.FS == "zfs" {
+		return []string{"zfs", "snapshot", s.Path}
+	}
+	return []string{"btrfs", "subvolume", "snapshot", "-r", s.Source, s.Path}
+}
+
+// rollbackArgs is the command that reverts the data to the snapshot. Btrfs
+// cannot swap a mounted subvolume in place, so the snapshot's contents are
+// synced back instead.
+func (s Snapshot) rollbackArgs() []string {
+	if s.Restore != "" {
+		// Only the directory is copied back; the rest of the filesystem
+		// (the OS, Docker's image layers) is left as it is
+		contents := s.Path
+		if s.FS == "zfs" {
+			contents = filepath.Join(s.Mount, ".zfs", "snapshot", s.Name)
+		}
+		return []string{"rsync", "-aHAX", "--delete",
+			filepath.Join(contents, s.Restore) + "/", filepath.Join(s.Mount, s.Restore) + "/"}
+	}
+	if s.FS == "zfs" {
+		return []string{"zfs", "rollback", s.Path}
+	}
+	return []string{"rsync", "-aHAX", "--delete", "--exclude=/" + SnapshotDir + "/",
+		strings.TrimSuffix(s.Path, "/") + "/", strings.TrimSuffix(s.Source, "/") + "/"}
+}
+
+// deleteArgs is the command that removes the snapshot
+func (s Snapshot) deleteArgs() []string {
+	if s.FS == "zfs" {
+		return []string{"zfs", "destroy", s.Path}
+	}
+	return []string{"btrfs", "subvolume", "delete", s.Path}
+}
+
+// runSnapshotCommand runs args, or describes them in a dry run
+func runSnapshotCommand(args []string, dryRun bool) OperationResult {
+	if err := ops.Execute(dryRun, ops.Command{Args: args}); err != nil {
+		return OperationResult{Error: err, Message: err.Error()}
+	}
+	return OperationResult{Success: true}
+}
+
+// TakeSnapshot snapshots dataRoot before a risky change. On Btrfs the data
+// root must be a subvolume (a whole-disk Btrfs mount is one).
+func TakeSnapshot(dataRoot, reason string, dryRun bool) (Snapshot, OperationResult) {
+	fs := SnapshotFS(dataRoot)
+	if fs == "" {
+		err := fmt.Errorf("%s is not on Btrfs or ZFS", dataRoot)
+		return Snapshot{}, OperationResult{Error: err, Message: err.Error()}
+	}
+
+	source := dataRoot
+	if fs == "zfs" {
+		output, err := exec.Command("zfs", "list", "-H", "-o", "name", dataRoot).Output()
+		if err != nil {
+			err = fmt.Errorf("no ZFS dataset mounted at %s: %w", dataRoot, err)
+			return Snapshot{}, OperationResult{Error: err, Message: err.Error()}
+		}
+		source = strings.TrimSpace(string(output))
+	} else if err := exec.Command("btrfs", "subvolume", "show", dataRoot).Run(); err != nil {
+		err = fmt.Errorf("%s is not a Btrfs subvolume", dataRoot)
+		return Snapshot{}, OperationResult{Error: err, Message: err.Error()}
+	}
+
+	snap := newSnapshot(fs, source, dataRoot, reason, time.Now())
+	if fs == "btrfs" && !dryRun {
+		if err := os.MkdirAll(filepath.Dir(snap.Path), 0700); err != nil {
+			return Snapshot{}, OperationResult{Error: err, Message: err.Error()}
+		}
+	}
+
+	result := runSnapshotCommand(snap.createArgs(), dryRun)
+	if result.Success && !dryRun {
+		result.Message = fmt.Sprintf("Snapshot %s taken before %s", snap.Path, reason)
+	}
+	return snap, result
+}
+
+// TakeVolumeSnapshot snapshots the filesystem holding dir - Docker's named
+// volumes - so a rollback can restore dir. It is named after at, so a data
+// root snapshot taken at the same time is rolled back with it.
+func TakeVolumeSnapshot(dir, reason string, at time.Time, dryRun bool) (Snapshot, OperationResult) {
+	fs := SnapshotFS(dir)
+	if fs == "" {
+		err := fmt.Errorf("%s is not on Btrfs or ZFS", dir)
+		return Snapshot{}, OperationResult{Error: err, Message: err.Error()}
+	}
+
+	var source, mount string
+	if fs == "zfs" {
+		output, err := exec.Command("zfs", "list", "-H", "-o", "name,mountpoint", dir).Output()
+		fields := strings.Fields(string(output))
+		if err != nil || len(fields) != 2 {
+			err = fmt.Errorf("no ZFS dataset holds %s", dir)
+			return Snapshot{}, OperationResult{Error: err, Message: err.Error()}
+		}
+		source, mount = fields[0], fields[1]
+	} else {
+		// The subvolume mounted at or above dir (e.g. "/" with a Btrfs root)
+		output, err := exec.Command("findmnt", "-n", "-o", "TARGET", "--target", dir).Output()
+		if err != nil {
+			err = fmt.Errorf("cannot find the Btrfs mount holding %s: %w", dir, err)
+			return Snapshot{}, OperationResult{Error: err, Message: err.Error()}
+		}
+		mount = strings.TrimSpace(string(output))
+		source = mount
+	}
+	restore, err := filepath.Rel(mount, dir)
+	if err != nil || strings.HasPrefix(restore, "..") {
+		err = fmt.Errorf("%s is not under its mount %s", dir, mount)
+		return Snapshot{}, OperationResult{Error: err, Message: err.Error()}
+	}
+
+	snap := newSnapshot(fs, source, mount, reason, at)
+	snap.Mount, snap.Restore = mount, restore
+	if fs == "btrfs" && !dryRun {
+		if err := os.MkdirAll(filepath.Dir(snap.Path), 0700); err != nil {
+			return Snapshot{}, OperationResult{Error: err, Message: err.Error()}
+		}
+	}
+
+	result := runSnapshotCommand(snap.createArgs(), dryRun)
+	if result.Success && !dryRun {
+		result.Message = fmt.Sprintf("Snapshot %s of %s taken before %s", snap.Path, dir, reason)
+	}
+	return snap, result
+}
+
+// RollbackSnapshot reverts the data root (or, for a partial snapshot, its
+// directory) to snap. Services using the data must be stopped first.
+func RollbackSnapshot(snap Snapshot, dryRun bool) OperationResult {
+	result := runSnapshotCommand(snap.rollbackArgs(), dryRun)
+	if result.Success && !dryRun {
+		result.Message = fmt.Sprintf("Rolled back %s to %s", snap.Target(), snap.Name)
+	}
+	if !result.Success && snap.FS == "zfs" && snap.Restore == "" {
+		result.Message += " (ZFS only rolls back to the newest snapshot; delete later ones with 'zfs destroy' first)"
+	}
+	return result
+}
+
+// NewestSnapshots returns the newest snapshot and any taken with it (same
+// name), which are rolled back together
+func NewestSnapshots(snaps []Snapshot) []Snapshot {
+	var newest []Snapshot
+	for _, snap := range snaps {
+		if len(newest) == 0 || snap.CreatedAt.After(newest[0].CreatedAt) {
+			newest = []Snapshot{snap}
+		} else if snap.Name == newest[0].Name {
+			newest = append(newest, snap)
+		}
+	}
+	return newest
+}
+
+// DeleteSnapshot removes snap
+func DeleteSnapshot(snap Snapshot, dryRun bool) OperationResult {
+	return runSnapshotCommand(snap.deleteArgs(), dryRun)
+}
+
+// PruneSnapshots deletes all but the keep newest snapshots and returns the
+// ones still registered. Snapshots sharing a name (data root and Docker
+// volumes taken together) count once. A snapshot that fails to delete stays
+// registered.
+func PruneSnapshots(snaps []Snapshot, keep int, dryRun bool) ([]Snapshot, []OperationResult) {
+	sorted := append([]Snapshot(nil), snaps...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].CreatedAt.After(sorted[j].CreatedAt) })
+
+	names := make(map[string]bool)
+	var kept, old []Snapshot
+	for _, snap := range sorted {
+		if !names[snap.Name] && len(names) < keep {
+			names[snap.Name] = true
+		}
+		if names[snap.Name] {
+			kept = append(kept, snap)
+		} else {
+			old = append(old, snap)
+		}
+	}
+	if len(old) == 0 {
+		return kept, nil
+	}
+
+	var results []OperationResult
+	for _, snap := range old {
+		result := DeleteSnapshot(snap, dryRun)
+		results = append(results, result)
+		if !result.Success || dryRun {
+			kept = append(kept, snap)
+		}
+	}
+	return kept, results
+}
@@ -0,0 +1,114 @@
+package storage
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNewSnapshot(t *testing.T) {
+	now := time.Date(2026, 10, 17, 10, 15, 0, 0, time.UTC)
+
+	btrfs := newSnapshot("btrfs", "/mnt/data", "/mnt/data", "container upgrade", now)
+	if btrfs.Name != "servctl-20261017-101500" || btrfs.Path != "/mnt/data/.snapshots/servctl-20261017-101500" {
+		t.Errorf("btrfs snapshot = %+v", btrfs)
+	}
+	want := []string{"btrfs", "subvolume", "snapshot", "-r", "/mnt/data", "/mnt/data/.snapshots/servctl-20261017-101500"}
+	if got := btrfs.createArgs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("btrfs create = %v, want %v", got, want)
+	}
+	// Rollback syncs the snapshot back without touching the snapshots themselves
+	want = []string{"rsync", "-aHAX", "--delete", "--exclude=/.snapshots/",
+		"/mnt/data/.snapshots/servctl-20261017-101500/", "/mnt/data/"}
+	if got := btrfs.rollbackArgs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("btrfs rollback = %v, want %v", got, want)
+	}
+
+	zfs := newSnapshot("zfs", "tank/data", "/mnt/data", "restore", now)
+	if zfs.Path != "tank/data@servctl-20261017-101500" {
+		t.Errorf("zfs path = %q", zfs.Path)
+	}
+	if got := zfs.rollbackArgs(); !reflect.DeepEqual(got, []string{"zfs", "rollback", zfs.Path}) {
+		t.Errorf("zfs rollback = %v", got)
+	}
+	if got := zfs.deleteArgs(); !reflect.DeepEqual(got, []string{"zfs", "destroy", zfs.Path}) {
+		t.Errorf("zfs delete = %v", got)
+	}
+}
+
+func TestPruneSnapshots_DryRun(t *testing.T) {
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	var snaps []Snapshot
+	for i := 0; i < 4; i++ {
+		snaps = append(snaps, newSnapshot("zfs", "tank/data", "/mnt/data", "upgrade", base.Add(time.Duration(i)*time.Hour)))
+	}
+
+	kept, results := PruneSnapshots(snaps, 2, true)
+	if len(results) != 2 {
+		t.Fatalf("expected 2 deletions, got %d", len(results))
+	}
+	for _, r := range results {
+		if !r.Success {
+			t.Errorf("dry run deletion failed: %s", r.Message)
+		}
+	}
+	// A dry run deletes nothing, so everything stays registered, newest first
+	if len(kept) != 4 || !kept[0].CreatedAt.Equal(base.Add(3*time.Hour)) {
+		t.Errorf("kept = %+v", kept)
+	}
+
+	if kept, results := PruneSnapshots(snaps, SnapshotKeep, false); len(kept) != 4 || results != nil {
+		t.Error("nothing should be pruned below the limit")
+	}
+}
+
+func TestVolumeSnapshot_Rollback(t *testing.T) {
+	now := time.Date(2026, 10, 17, 10, 15, 0, 0, time.UTC)
+
+	// Btrfs root filesystem: / is snapshotted, only Docker's volumes restored
+	btrfs := newSnapshot("btrfs", "/", "/", "container upgrade", now)
+	btrfs.Mount, btrfs.Restore = "/", "var/lib/docker/volumes"
+	want := []string{"rsync", "-aHAX", "--delete",
+		"/.snapshots/servctl-20261017-101500/var/lib/docker/volumes/", "/var/lib/docker/volumes/"}
+	if got := btrfs.rollbackArgs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("btrfs volume rollback = %v, want %v", got, want)
+	}
+	if btrfs.Target() != "/var/lib/docker/volumes" {
+		t.Errorf("Target() = %q", btrfs.Target())
+	}
+
+	// ZFS: copied back out of the hidden .zfs directory, not 'zfs rollback'
+	zfs := newSnapshot("zfs", "rpool/docker", "/var/lib/docker", "container upgrade", now)
+	zfs.Mount, zfs.Restore = "/var/lib/docker", "volumes"
+	want = []string{"rsync", "-aHAX", "--delete",
+		"/var/lib/docker/.zfs/snapshot/servctl-20261017-101500/volumes/", "/var/lib/docker/volumes/"}
+	if got := zfs.rollbackArgs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("zfs volume rollback = %v, want %v", got, want)
+	}
+}
+
+func TestSnapshots_TakenTogether(t *testing.T) {
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	var snaps []Snapshot
+	for i := 0; i < 3; i++ {
+		at := base.Add(time.Duration(i) * time.Hour)
+		data := newSnapshot("zfs", "tank/data", "/mnt/data", "upgrade", at)
+		volumes := newSnapshot("zfs", "rpool/docker", "/var/lib/docker", "upgrade", at)
+		volumes.Mount, volumes.Restore = "/var/lib/docker", "volumes"
+		snaps = append(snaps, data, volumes)
+	}
+
+	newest := NewestSnapshots(snaps)
+	if len(newest) != 2 || newest[0].Name != newest[1].Name || !newest[0].CreatedAt.Equal(base.Add(2*time.Hour)) {
+		t.Errorf("NewestSnapshots() = %+v, want both snapshots of the last run", newest)
+	}
+
+	// Keeping 2 keeps both snapshots of the two newest runs
+	kept, results := PruneSnapshots(snaps, 2, true)
+	if len(results) != 2 {
+		t.Errorf("expected the oldest run's 2 snapshots deleted, got %d deletions", len(results))
+	}
+	if len(kept) != 6 {
+		t.Errorf("a dry run keeps everything registered, got %d", len(kept))
+	}
+}
@@ -0,0 +1,53 @@
+//go:build !windows
+
+package storage
+
+import (
+	"path/filepath"
+	"syscall"
+)
+
+// IsMountPoint reports whether path is the root of a mounted filesystem,
+// i.e. it is on a different device than its parent
+func IsMountPoint(path string) bool {
+	var self, parent syscall.Stat_t
+	if syscall.Stat(path, &self) != nil || syscall.Stat(filepath.Dir(filepath.Clean(path)), &parent) != nil {
+		return false
+	}
+	return self.Dev != parent.Dev
+}
+
+// MountPointOf returns the mount point of the filesystem holding path,
+// walking up from the closest existing directory; "/" when none is found
+func MountPointOf(path string) string {
+	path = filepath.Clean(path)
+	for {
+		var st syscall.Stat_t
+		if syscall.Stat(path, &st) == nil && (path == "/" || IsMountPoint(path)) {
+			return path
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return path
+		}
+		path = parent
+	}
+}
+
+// Filesystem magic numbers reported by statfs(2)
+var fsMagic = map[int64]string{
+	0xEF53:     "ext4", // Shared by ext2/3/4
+	0x58465342: "xfs",
+	0x9123683E: "btrfs",
+	0x2FC12FC1: "zfs",
+}
+
+// FilesystemAt returns the type of the filesystem holding path ("ext4",
+// "xfs", "btrfs", "zfs"), or "" when it is something else or unreadable
+func FilesystemAt(path string) string {
+	var st syscall.Statfs_t
+	if syscall.Statfs(path, &st) != nil {
+		return ""
+	}
+	return fsMagic[int64(st.Type)]
+}
@@ -0,0 +1,17 @@
+package storage
+
+// IsMountPoint always reports false on Windows: servctl only manages disks
+// on the Linux server, and the client commands never ask
+func IsMountPoint(path string) bool {
+	return false
+}
+
+// MountPointOf returns path itself on Windows
+func MountPointOf(path string) string {
+	return path
+}
+
+// FilesystemAt reports no known filesystem on Windows
+func FilesystemAt(path string) string {
+	return ""
+}
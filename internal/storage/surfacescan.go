@@ -0,0 +1,317 @@
+// Package storage provides intelligent storage orchestration for servctl.
+// This file implements the optional badblocks surface scan of used disks.
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Surface scan modes
+const (
+	ScanReadOnly    = "read-only"   // Reads every block once; keeps the data
+	ScanDestructive = "destructive" // Writes and reads back four patterns; erases the disk
+)
+
+// scanBlockSize is the block size badblocks is run with. Its default of
+// 1024 bytes overflows the 32-bit block count on disks over 4 TB.
+const scanBlockSize = 4096
+
+// Sequential throughput assumed for time estimates, in bytes per second
+const (
+	scanSpeedSlow = 150 * 1000 * 1000 // HDD
+	scanSpeedFast = 400 * 1000 * 1000 // SSD, NVMe
+)
+
+// SurfaceScan is the outcome of a badblocks run on one disk, kept in the
+// setup state so later runs know which disks to trust
+type SurfaceScan struct {
+	Serial    string        // Identifies the disk across device renames
+	Path      string        // Device path at the time of the scan
+	Model     string        `json:",omitempty"`
+	Mode      string        // ScanReadOnly or ScanDestructive
+	BadBlocks int           // Blocks badblocks reported as bad
+	Error     string        `json:",omitempty"` // Why the scan did not finish
+	Duration  time.Duration // How long the scan ran
+	ScannedAt time.Time     `json:"scanned_at"`
+}
+
+// Passed reports whether the scan finished without finding bad blocks
+func (s SurfaceScan) Passed() bool {
+	return s.Error == "" && s.BadBlocks == 0
+}
+
+// scanKey identifies a disk in the scan records: its serial, or its path
+// for disks that report none
+func scanKey(serial, path string) string {
+	if serial != "" {
+		return serial
+	}
+	return path
+}
+
+// findScan returns the recorded scan of disk, if any
+func findScan(disk Disk, scans []SurfaceScan) (SurfaceScan, bool) {
+	key := scanKey(disk.Serial, disk.Path)
+	for _, s := range scans {
+		if scanKey(s.Serial, s.Path) == key {
+			return s, true
+		}
+	}
+	return SurfaceScan{}, false
+}
+
+// ApplySurfaceScans marks the disks whose recorded scan found bad blocks,
+// so GenerateStrategies keeps them out of redundancy roles
+func ApplySurfaceScans(disks []Disk, scans []SurfaceScan) []Disk {
+	marked := make([]Disk, len(disks))
+	for i, d := range disks {
+		if s, ok := findScan(d, scans); ok {
+			d.SurfaceErrors = s.BadBlocks
+		}
+		marked[i] = d
+	}
+	return marked
+}
+
+// RecordSurfaceScans returns the records with the new scans added, each
+// replacing an earlier scan of the same disk
+func RecordSurfaceScans(records, scans []SurfaceScan) []SurfaceScan {
+	var kept []SurfaceScan
+	for _, r := range records {
+		replaced := false
+		for _, s := range scans {
+			if scanKey(s.Serial, s.Path) == scanKey(r.Serial, r.Path) {
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			kept = append(kept, r)
+		}
+	}
+	return append(kept, scans...)
+}
+
+// SurfaceScanCandidates returns the available disks that have been used
+// before (they have partitions) and have no finished scan recorded
+func SurfaceScanCandidates(disks []Disk, scans []SurfaceScan) []Disk {
+	var candidates []Disk
+	for _, d := range FilterAvailableDisks(disks) {
+		if len(d.Partitions) == 0 {
+			continue
+		}
+		if s, ok := findScan(d, scans); ok && s.Error == "" {
+			continue
+		}
+		candidates = append(candidates, d)
+	}
+	return candidates
+}
+
+// scanPasses is how many times a mode goes over the whole disk: once for a
+// read, a write and a read for each of the four destructive patterns
+func scanPasses(mode string) int {
+	if mode == ScanDestructive {
+		return 8
+	}
+	return 1
+}
+
+// EstimateSurfaceScan returns roughly how long scanning disk takes
+func EstimateSurfaceScan(disk Disk, mode string) time.Duration {
+	speed := uint64(scanSpeedSlow)
+	if GetDiskSpeedClass(disk) == SpeedClassFast {
+		speed = scanSpeedFast
+	}
+	seconds := float64(disk.Size) / float64(speed) * float64(scanPasses(mode))
+	return time.Duration(seconds * float64(time.Second)).Round(time.Minute)
+}
+
+// SurfaceScanArgs returns the badblocks command line for scanning disk
+func SurfaceScanArgs(disk Disk, mode string) []string {
+	args := []string{"badblocks", "-b", strconv.Itoa(scanBlockSize), "-s", "-v"}
+	if mode == ScanDestructive {
+		args = append(args, "-w")
+	}
+	return append(args, disk.Path)
+}
+
+// scanPercent matches badblocks' progress, e.g. " 12.34% done, 0:42 elapsed"
+var scanPercent = regexp.MustCompile(`(\d+(?:\.\d+)?)% done`)
+
+// scanProgress turns badblocks' per-pass percentages into progress over
+// the whole scan. Every pattern's write and read starts again from 0%.
+type scanProgress struct {
+	passes int
+	pass   int
+	last   float64
+}
+
+// update reads one chunk of badblocks' status output and returns the
+// overall fraction done, and false when the chunk has no percentage
+func (p *scanProgress) update(chunk string) (float64, bool) {
+	m := scanPercent.FindStringSubmatch(chunk)
+	if m == nil {
+		return 0, false
+	}
+	pct, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return 0, false
+	}
+	if pct+1 < p.last && p.pass < p.passes-1 {
+		p.pass++
+	}
+	p.last = pct
+	return min((float64(p.pass)+pct/100)/float64(p.passes), 1), true
+}
+
+// scanStatusSplit splits badblocks' status output at the backspaces and
+// carriage returns it redraws the progress with, as well as at newlines
+func scanStatusSplit(data []byte, atEOF bool) (int, []byte, error) {
+	if i := bytes.IndexAny(data, "\b\r\n"); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// countBadBlocks counts the block numbers badblocks listed on its output
+func countBadBlocks(output string) int {
+	n := 0
+	for _, line := range strings.Split(output, "\n") {
+		if _, err := strconv.ParseUint(strings.TrimSpace(line), 10, 64); err == nil {
+			n++
+		}
+	}
+	return n
+}
+
+// RunSurfaceScan scans disk with badblocks, calling progress with the
+// fraction done as badblocks reports it
+func RunSurfaceScan(disk Disk, mode string, progress func(float64)) SurfaceScan {
+	scan := SurfaceScan{Serial: disk.Serial, Path: disk.Path, Model: disk.Model, Mode: mode, ScannedAt: time.Now()}
+
+	args := SurfaceScanArgs(disk, mode)
+	cmd := exec.Command(args[0], args[1:]...)
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		scan.Error = err.Error()
+		return scan
+	}
+	if err := cmd.Start(); err != nil {
+		scan.Error = fmt.Sprintf("cannot run badblocks (part of e2fsprogs): %v", err)
+		return scan
+	}
+
+	tracker := scanProgress{passes: scanPasses(mode)}
+	var lastLine string
+	status := bufio.NewScanner(stderr)
+	status.Split(scanStatusSplit)
+	for status.Scan() {
+		chunk := status.Text()
+		if done, ok := tracker.update(chunk); ok {
+			if progress != nil {
+				progress(done)
+			}
+		} else if line := strings.TrimSpace(chunk); line != "" {
+			lastLine = line
+		}
+	}
+
+	if err := cmd.Wait(); err != nil {
+		scan.Error = err.Error()
+		if lastLine != "" {
+			scan.Error = lastLine
+		}
+	}
+	scan.BadBlocks = countBadBlocks(stdout.String())
+	scan.Duration = time.Since(scan.ScannedAt).Round(time.Second)
+	return scan
+}
+
+// RunSurfaceScans scans the disks side by side; each waits on its own
+// drive. progress, when set, gets every disk's fraction done in disk order.
+func RunSurfaceScans(disks []Disk, mode string, progress func([]float64)) []SurfaceScan {
+	scans := make([]SurfaceScan, len(disks))
+	done := make([]float64, len(disks))
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i, disk := range disks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			scans[i] = RunSurfaceScan(disk, mode, func(f float64) {
+				mu.Lock()
+				defer mu.Unlock()
+				done[i] = f
+				if progress != nil {
+					progress(append([]float64(nil), done...))
+				}
+			})
+		}()
+	}
+	wg.Wait()
+
+	return scans
+}
+
+// RenderScanProgress formats the single-line combined scan display
+func RenderScanProgress(disks []Disk, done []float64) string {
+	parts := make([]string, len(disks))
+	for i, d := range disks {
+		parts[i] = fmt.Sprintf("%s %.1f%%", filepath.Base(d.Path), done[i]*100)
+	}
+	return "  🔍 Surface scan: " + strings.Join(parts, " · ")
+}
+
+// PromptSurfaceScan lists the disks and offers to scan them, with how long
+// each mode would take. It returns ScanReadOnly, ScanDestructive or "" to
+// skip.
+func PromptSurfaceScan(reader *bufio.Reader, disks []Disk) string {
+	var readOnly, destructive time.Duration
+	for _, d := range disks {
+		model := ""
+		if d.Model != "" {
+			model = ", " + d.Model
+		}
+		fmt.Printf("    %s (%s%s)\n", d.Path, d.SizeHuman, model)
+		readOnly = max(readOnly, EstimateSurfaceScan(d, ScanReadOnly))
+		destructive = max(destructive, EstimateSurfaceScan(d, ScanDestructive))
+	}
+	fmt.Println()
+	fmt.Println("  A surface scan reads (or writes) every block to find bad sectors.")
+	fmt.Println("  The disks are scanned side by side.")
+	fmt.Println()
+	fmt.Printf("    [r] Read-only scan    about %s, keeps the data\n", readOnly)
+	fmt.Printf("    [d] Destructive scan  about %s, ERASES the disks, most thorough\n", destructive)
+	fmt.Println("    [s] Skip")
+	fmt.Println()
+	fmt.Print("  Scan the disks? [r/d/S]: ")
+
+	response, err := reader.ReadString('\n')
+	if err != nil {
+		return ""
+	}
+	switch strings.ToLower(strings.TrimSpace(response)) {
+	case "r":
+		return ScanReadOnly
+	case "d":
+		return ScanDestructive
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,133 @@
+package storage
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScanProgress(t *testing.T) {
+	// A destructive scan: each pattern is written, then read back
+	p := scanProgress{passes: scanPasses(ScanDestructive)}
+	steps := []struct {
+		chunk string
+		want  float64
+	}{
+		{"Testing with pattern 0xaa:   0.00% done, 0:00 elapsed. (0/0/0 errors)", 0},
+		{" 50.00% done, 1:00 elapsed. (0/0/0 errors)", 0.5 / 8},
+		{"100.00% done, 2:00 elapsed. (0/0/0 errors)", 1.0 / 8},
+		{"Reading and comparing:  50.00% done, 3:00 elapsed. (0/0/0 errors)", 1.5 / 8},
+		{"Testing with pattern 0x55:  25.00% done, 5:00 elapsed. (0/0/0 errors)", 2.25 / 8},
+	}
+	for _, s := range steps {
+		got, ok := p.update(s.chunk)
+		if !ok || got != s.want {
+			t.Errorf("update(%q) = %v, %v; want %v", s.chunk, got, ok, s.want)
+		}
+	}
+	if _, ok := p.update("Checking for bad blocks in read-write mode"); ok {
+		t.Error("a line without a percentage counted as progress")
+	}
+}
+
+func TestScanStatusSplit(t *testing.T) {
+	s := bufio.NewScanner(strings.NewReader("Checking blocks\n 10.00% done\b\b\b\b 20.00% done\rPass completed"))
+	s.Split(scanStatusSplit)
+	var chunks []string
+	for s.Scan() {
+		if s.Text() != "" {
+			chunks = append(chunks, s.Text())
+		}
+	}
+	want := []string{"Checking blocks", " 10.00% done", " 20.00% done", "Pass completed"}
+	if strings.Join(chunks, "|") != strings.Join(want, "|") {
+		t.Errorf("chunks = %q, want %q", chunks, want)
+	}
+}
+
+func TestCountBadBlocks(t *testing.T) {
+	if n := countBadBlocks("1024\n1025\n\n98304\n"); n != 3 {
+		t.Errorf("countBadBlocks() = %d, want 3", n)
+	}
+	if n := countBadBlocks(""); n != 0 {
+		t.Errorf("countBadBlocks(\"\") = %d, want 0", n)
+	}
+}
+
+func TestEstimateSurfaceScan(t *testing.T) {
+	hdd := Disk{Size: 4 * 1000 * 1000 * 1000 * 1000, Rotational: true, Type: DiskTypeHDD}
+	readOnly := EstimateSurfaceScan(hdd, ScanReadOnly)
+	if readOnly < 7*time.Hour || readOnly > 8*time.Hour {
+		t.Errorf("4 TB HDD read-only estimate = %s, want about 7.4h", readOnly)
+	}
+	if d := EstimateSurfaceScan(hdd, ScanDestructive); d < 59*time.Hour || d > 60*time.Hour {
+		t.Errorf("destructive estimate = %s, want 8 passes, about 59h", d)
+	}
+}
+
+func TestSurfaceScanCandidates(t *testing.T) {
+	used := []Partition{{Name: "sdb1", Filesystem: "ntfs"}}
+	disks := []Disk{
+		{Path: "/dev/sda", Serial: "OS", IsOSDisk: true, Partitions: used},
+		{Path: "/dev/sdb", Serial: "USED", Partitions: used},
+		{Path: "/dev/sdc", Serial: "NEW"},
+		{Path: "/dev/sdd", Serial: "SCANNED", Partitions: used},
+		{Path: "/dev/sde", Serial: "INTERRUPTED", Partitions: used},
+	}
+	scans := []SurfaceScan{
+		{Serial: "SCANNED", Path: "/dev/sdx"},
+		{Serial: "INTERRUPTED", Path: "/dev/sde", Error: "signal: interrupt"},
+	}
+	var got []string
+	for _, d := range SurfaceScanCandidates(disks, scans) {
+		got = append(got, d.Serial)
+	}
+	if strings.Join(got, ",") != "USED,INTERRUPTED" {
+		t.Errorf("SurfaceScanCandidates() = %v, want USED and INTERRUPTED", got)
+	}
+}
+
+func TestRecordSurfaceScans(t *testing.T) {
+	records := []SurfaceScan{{Serial: "A", BadBlocks: 4}, {Serial: "B"}}
+	got := RecordSurfaceScans(records, []SurfaceScan{{Serial: "A"}, {Path: "/dev/sdc"}})
+	if len(got) != 3 || got[0].Serial != "B" || got[1].Serial != "A" || got[1].BadBlocks != 0 {
+		t.Errorf("RecordSurfaceScans() = %+v", got)
+	}
+}
+
+func TestGenerateStrategies_SurfaceErrors(t *testing.T) {
+	const size = 4 * 1024 * 1024 * 1024 * 1024
+	disks := []Disk{
+		{Path: "/dev/sdb", Serial: "GOOD", Size: size, SizeHuman: "4TB", Rotational: true, IsAvailable: true},
+		{Path: "/dev/sdc", Serial: "BAD", Size: size, SizeHuman: "4TB", Rotational: true, IsAvailable: true},
+	}
+	info := SystemInfo{TotalRAM: 16 * 1024 * 1024 * 1024}
+
+	has := func(strategies []Strategy, id StrategyID) bool {
+		for _, s := range strategies {
+			if s.ID == id {
+				return true
+			}
+		}
+		return false
+	}
+	clean := GenerateStrategies(disks, info)
+	if !has(clean, StrategyMirror) || !has(clean, StrategyBackup) {
+		t.Fatal("two matching disks should offer a mirror and a backup")
+	}
+
+	scanned := ApplySurfaceScans(disks, []SurfaceScan{{Serial: "GOOD"}, {Serial: "BAD", BadBlocks: 12}})
+	strategies := GenerateStrategies(scanned, info)
+	if has(strategies, StrategyMirror) || has(strategies, StrategyBackup) {
+		t.Error("a disk with bad blocks was offered a redundancy role")
+	}
+	if len(strategies) == 0 {
+		t.Fatal("no strategies left")
+	}
+	for _, s := range strategies {
+		if !strings.Contains(s.Warning, "/dev/sdc has 12 bad blocks") {
+			t.Errorf("%s: Warning = %q, want the bad blocks named", s.Name, s.Warning)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/madhav/servctl/internal/ops"
+	"github.com/madhav/servctl/templates"
+)
+
+// Drive temperature limits in °C. Hard drives wear fastest above ~50°C
+// (shucked drives in closed cabinets reach that quickly); NVMe controllers
+// run hotter by design and throttle on their own around 80°C.
+const (
+	HDDTempWarn  = 50
+	HDDTempCrit  = 55
+	NVMeTempWarn = 70
+	NVMeTempCrit = 80
+)
+
+// DriveTempLimits returns the warning and critical temperatures for a drive
+func DriveTempLimits(diskPath string) (warn, crit int) {
+	if strings.HasPrefix(filepath.Base(diskPath), "nvme") {
+		return NVMeTempWarn, NVMeTempCrit
+	}
+	return HDDTempWarn, HDDTempCrit
+}
+
+// GetDiskTemperature reads a drive's current temperature in °C with
+// smartctl. A drive in standby is not woken up and reports 0, as does a
+// drive without a temperature sensor.
+func GetDiskTemperature(diskPath string) (int, error) {
+	// smartctl exits non-zero for standby and for failing disks, so the
+	// output is parsed whatever the exit status
+	output, _ := runCommand("sudo", "smartctl", "-n", "standby", "-A", diskPath)
+	return ParseSMARTTemperature(string(output)), nil
+}
+
+// ParseSMARTTemperature extracts the current temperature from 'smartctl -A'
+// output for ATA (attribute 194, else 190), NVMe and SAS drives. It returns
+// 0 when none is reported.
+func ParseSMARTTemperature(output string) int {
+	airflow := 0
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) >= 10 && (fields[0] == "194" || fields[0] == "190"):
+			// ID NAME FLAG VALUE WORST THRESH TYPE UPDATED WHEN_FAILED RAW_VALUE
+			t, err := strconv.Atoi(fields[9])
+			if err != nil {
+				continue
+			}
+			if fields[0] == "194" {
+				return t
+			}
+			airflow = t
+		case strings.HasPrefix(line, "Temperature:") || strings.HasPrefix(line, "Current Drive Temperature:"):
+			// NVMe: "Temperature: 38 Celsius"; SAS: "Current Drive Temperature: 34 C"
+			_, value, _ := strings.Cut(line, ":")
+			if f := strings.Fields(value); len(f) > 0 {
+				if t, err := strconv.Atoi(f[0]); err == nil {
+					return t
+				}
+			}
+		}
+	}
+	return airflow
+}
+
+// FanController is a PWM fan output exposed by a hwmon driver (it87,
+// nct6775, ...), which fancontrol can drive
+type FanController struct {
+	Hwmon   string // hwmon directory name, e.g. "hwmon2"
+	Chip    string // Driver name from the hwmon "name" file
+	PWM     string // Output name, e.g. "pwm1"
+	DevPath string // Device path relative to /sys, as fancontrol records it
+}
+
+// ID returns the output as fancontrol names it (e.g. "hwmon2/pwm1")
+func (f FanController) ID() string {
+	return f.Hwmon + "/" + f.PWM
+}
+
+// TempSensor is a hwmon temperature input, such as a drive's temperature
+// exposed by the drivetemp module
+type TempSensor struct {
+	Hwmon   string
+	Chip    string
+	Input   string // e.g. "temp1_input"
+	DevPath string
+	Celsius int // Reading at detection time
+}
+
+// ID returns the input as fancontrol names it (e.g. "hwmon3/temp1_input")
+func (s TempSensor) ID() string {
+	return s.Hwmon + "/" + s.Input
+}
+
+// hwmonRoot is where the kernel lists hardware monitoring devices; tests
+// point it at a fake tree
+var hwmonRoot = "/sys/class/hwmon"
+
+// hwmonDevPath returns the device path of a hwmon directory relative to
+// /sys, as fancontrol's DEVPATH expects
+func hwmonDevPath(dir string) string {
+	target, err := filepath.EvalSymlinks(filepath.Join(dir, "device"))
+	if err != nil {
+		return ""
+	}
+	if _, rel, ok := strings.Cut(filepath.ToSlash(target), "/sys/"); ok {
+		return rel
+	}
+	return ""
+}
+
+// readSysValue returns a sysfs attribute without its trailing newline
+func readSysValue(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// DetectFanControl lists the PWM fan outputs and the drive temperature
+// sensors (drivetemp) the kernel exposes. Boards whose Super I/O chip has
+// no loaded driver show no fan outputs.
+func DetectFanControl() ([]FanController, []TempSensor) {
+	dirs, _ := filepath.Glob(filepath.Join(hwmonRoot, "hwmon*"))
+	sort.Strings(dirs)
+
+	var fans []FanController
+	var sensors []TempSensor
+	for _, dir := range dirs {
+		hwmon := filepath.Base(dir)
+		chip := readSysValue(filepath.Join(dir, "name"))
+		devPath := hwmonDevPath(dir)
+
+		pwms, _ := filepath.Glob(filepath.Join(dir, "pwm[0-9]"))
+		for _, pwm := range pwms {
+			fans = append(fans, FanController{Hwmon: hwmon, Chip: chip, PWM: filepath.Base(pwm), DevPath: devPath})
+		}
+
+		if chip != "drivetemp" {
+			continue
+		}
+		inputs, _ := filepath.Glob(filepath.Join(dir, "temp[0-9]_input"))
+		for _, input := range inputs {
+			milli, _ := strconv.Atoi(readSysValue(input))
+			sensors = append(sensors, TempSensor{
+				Hwmon: hwmon, Chip: chip, Input: filepath.Base(input), DevPath: devPath, Celsius: milli / 1000,
+			})
+		}
+	}
+	return fans, sensors
+}
+
+// HottestSensor returns the sensor reading the highest temperature, which
+// the fan curve follows so the warmest drive sets the fan speed
+func HottestSensor(sensors []TempSensor) (TempSensor, bool) {
+	if len(sensors) == 0 {
+		return TempSensor{}, false
+	}
+	hottest := sensors[0]
+	for _, s := range sensors[1:] {
+		if s.Celsius > hottest.Celsius {
+			hottest = s
+		}
+	}
+	return hottest, true
+}
+
+// Conservative fan curve: never below ~40% so fans that fail to restart
+// from a stop are not a risk, full speed before drives reach HDDTempWarn
+const (
+	fanMinTemp  = 35
+	fanMaxTemp  = HDDTempWarn - 5
+	fanMinPWM   = 100
+	fanMinStart = 150
+	fanMaxPWM   = 255
+)
+
+// FancontrolConfigPath is fancontrol's configuration file
+const FancontrolConfigPath = "/etc/fancontrol"
+
+// GenerateFancontrolConfig renders /etc/fancontrol driving every fan output
+// from one drive temperature sensor
+func GenerateFancontrolConfig(fans []FanController, sensor TempSensor) string {
+	hwmons := map[string]FanController{sensor.Hwmon: {Hwmon: sensor.Hwmon, Chip: sensor.Chip, DevPath: sensor.DevPath}}
+	ids := make([]string, 0, len(fans))
+	for _, f := range fans {
+		hwmons[f.Hwmon] = f
+		ids = append(ids, f.ID())
+	}
+	devices := make([]FanController, 0, len(hwmons))
+	for _, h := range hwmons {
+		devices = append(devices, h)
+	}
+	sort.Slice(devices, func(i, j int) bool { return devices[i].Hwmon < devices[j].Hwmon })
+
+	return templates.MustRender("system/fancontrol.tmpl", map[string]any{
+		"Hwmons":   devices,
+		"Fans":     ids,
+		"Sensor":   sensor.ID(),
+		"MinTemp":  fanMinTemp,
+		"MaxTemp":  fanMaxTemp,
+		"MinStart": fanMinStart,
+		"MinPWM":   fanMinPWM,
+		"MaxPWM":   fanMaxPWM,
+	}, nil)
+}
+
+// FanControlAdvice explains what to do when no fan outputs were found
+func FanControlAdvice() []string {
+	return []string{
+		"No PWM fan outputs found. Run 'sudo sensors-detect' (lm-sensors) to find the board's sensor chip.",
+		"ITE chips (many Gigabyte and ASRock boards) need the it87 driver: 'sudo modprobe it87 ignore_resource_conflict=1'.",
+		"Otherwise set a fan curve in the BIOS, and keep drives out of closed cabinets without airflow.",
+	}
+}
+
+// EnableDriveTempSensors loads the drivetemp module now and at every boot,
+// so drive temperatures appear as hwmon sensors fancontrol can read
+func EnableDriveTempSensors(dryRun bool) error {
+	const conf = "/etc/modules-load.d/drivetemp.conf"
+	return ops.Execute(dryRun,
+		ops.Command{Args: []string{"sudo", "modprobe", "drivetemp"}},
+		ops.WriteFile{Path: conf, Content: []byte("drivetemp\n"), Mode: 0644, Sudo: true})
+}
+
+// ConfigureFancontrol writes /etc/fancontrol and (re)starts the fancontrol
+// service. The fancontrol package must be installed.
+func ConfigureFancontrol(fans []FanController, sensor TempSensor, dryRun bool) error {
+	content := GenerateFancontrolConfig(fans, sensor)
+	return ops.Execute(dryRun,
+		ops.WriteFile{Path: FancontrolConfigPath, Content: []byte(content), Mode: 0644, Sudo: true},
+		ops.Command{Args: []string{"sudo", "systemctl", "enable", "fancontrol"}},
+		// Restart rather than start: a running instance keeps its old curve
+		ops.Command{Args: []string{"sudo", "systemctl", "restart", "fancontrol"}})
+}
@@ -0,0 +1,173 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseSMARTTemperature(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   int
+	}{
+		{
+			name: "ATA",
+			output: `ID# ATTRIBUTE_NAME          FLAG     VALUE WORST THRESH TYPE      UPDATED  WHEN_FAILED RAW_VALUE
+  9 Power_On_Hours          0x0032   090   090   000    Old_age   Always       -       8760
+190 Airflow_Temperature_Cel 0x0022   060   045   040    Old_age   Always       -       40
+194 Temperature_Celsius     0x0022   041   055   000    Old_age   Always       -       41 (Min/Max 20/55)`,
+			want: 41,
+		},
+		{
+			name:   "ATA airflow only",
+			output: `190 Airflow_Temperature_Cel 0x0022   060   045   040    Old_age   Always       -       39`,
+			want:   39,
+		},
+		{
+			name: "NVMe",
+			output: `SMART/Health Information (NVMe Log 0x02)
+Critical Warning:                   0x00
+Temperature:                        47 Celsius
+Available Spare:                    100%`,
+			want: 47,
+		},
+		{
+			name:   "SAS",
+			output: "Current Drive Temperature:     34 C\nDrive Trip Temperature:        65 C",
+			want:   34,
+		},
+		{
+			name:   "standby",
+			output: "Device is in STANDBY mode, exit(2)",
+			want:   0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseSMARTTemperature(tt.output); got != tt.want {
+				t.Errorf("ParseSMARTTemperature() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDriveTempLimits(t *testing.T) {
+	if warn, crit := DriveTempLimits("/dev/sda"); warn != HDDTempWarn || crit != HDDTempCrit {
+		t.Errorf("/dev/sda limits = %d/%d", warn, crit)
+	}
+	if warn, crit := DriveTempLimits("/dev/nvme0n1"); warn != NVMeTempWarn || crit != NVMeTempCrit {
+		t.Errorf("/dev/nvme0n1 limits = %d/%d", warn, crit)
+	}
+}
+
+// fakeHwmon builds a /sys-like tree with a Super I/O chip with two fan
+// outputs and two drivetemp sensors
+func fakeHwmon(t *testing.T) string {
+	t.Helper()
+	sys := filepath.Join(t.TempDir(), "sys")
+	write := func(rel, content string) {
+		path := filepath.Join(sys, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	link := func(hwmon, device string) {
+		os.MkdirAll(filepath.Join(sys, device), 0755)
+		if err := os.Symlink(filepath.Join(sys, device), filepath.Join(sys, "class/hwmon", hwmon, "device")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("class/hwmon/hwmon0/name", "acpitz\n")
+	write("class/hwmon/hwmon0/temp1_input", "27800\n")
+	write("class/hwmon/hwmon1/name", "it8628\n")
+	write("class/hwmon/hwmon1/pwm1", "120\n")
+	write("class/hwmon/hwmon1/pwm2", "120\n")
+	link("hwmon1", "devices/platform/it87.2624")
+	write("class/hwmon/hwmon2/name", "drivetemp\n")
+	write("class/hwmon/hwmon2/temp1_input", "38000\n")
+	link("hwmon2", "devices/pci0000:00/ata1/host0/target0:0:0/0:0:0:0")
+	write("class/hwmon/hwmon3/name", "drivetemp\n")
+	write("class/hwmon/hwmon3/temp1_input", "44000\n")
+	link("hwmon3", "devices/pci0000:00/ata2/host1/target1:0:0/1:0:0:0")
+	return sys
+}
+
+func TestDetectFanControl(t *testing.T) {
+	sys := fakeHwmon(t)
+	old := hwmonRoot
+	hwmonRoot = filepath.Join(sys, "class/hwmon")
+	defer func() { hwmonRoot = old }()
+
+	fans, sensors := DetectFanControl()
+	if len(fans) != 2 || fans[0].ID() != "hwmon1/pwm1" || fans[0].Chip != "it8628" {
+		t.Fatalf("fans = %+v", fans)
+	}
+	if fans[0].DevPath != "devices/platform/it87.2624" {
+		t.Errorf("DevPath = %q", fans[0].DevPath)
+	}
+	if len(sensors) != 2 {
+		t.Fatalf("sensors = %+v, want the two drivetemp inputs", sensors)
+	}
+
+	hottest, ok := HottestSensor(sensors)
+	if !ok || hottest.ID() != "hwmon3/temp1_input" || hottest.Celsius != 44 {
+		t.Errorf("HottestSensor() = %+v", hottest)
+	}
+
+	config := GenerateFancontrolConfig(fans, hottest)
+	for _, want := range []string{
+		"DEVPATH=hwmon1=devices/platform/it87.2624 hwmon3=devices/pci0000:00/ata2/host1/target1:0:0/1:0:0:0",
+		"DEVNAME=hwmon1=it8628 hwmon3=drivetemp",
+		"FCTEMPS=hwmon1/pwm1=hwmon3/temp1_input hwmon1/pwm2=hwmon3/temp1_input",
+		"MAXTEMP=hwmon1/pwm1=45 hwmon1/pwm2=45",
+		"MINPWM=hwmon1/pwm1=100",
+	} {
+		if !strings.Contains(config, want) {
+			t.Errorf("fancontrol config missing %q:\n%s", want, config)
+		}
+	}
+}
+
+func TestGenerateFancontrolConfig(t *testing.T) {
+	fans := []FanController{{Hwmon: "hwmon2", Chip: "nct6775", PWM: "pwm1", DevPath: "devices/platform/nct6775.656"}}
+	sensor := TempSensor{Hwmon: "hwmon4", Chip: "drivetemp", Input: "temp1_input", DevPath: "devices/pci0000:00/ata1"}
+
+	want := `# Generated by servctl - fans follow the hottest data drive
+# 35°C and below: minimum speed; 45°C and above: full speed
+INTERVAL=10
+DEVPATH=hwmon2=devices/platform/nct6775.656 hwmon4=devices/pci0000:00/ata1
+DEVNAME=hwmon2=nct6775 hwmon4=drivetemp
+FCTEMPS=hwmon2/pwm1=hwmon4/temp1_input
+MINTEMP=hwmon2/pwm1=35
+MAXTEMP=hwmon2/pwm1=45
+MINSTART=hwmon2/pwm1=150
+MINSTOP=hwmon2/pwm1=100
+MINPWM=hwmon2/pwm1=100
+MAXPWM=hwmon2/pwm1=255
+`
+	if got := GenerateFancontrolConfig(fans, sensor); got != want {
+		t.Errorf("GenerateFancontrolConfig() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestDetectFanControl_None(t *testing.T) {
+	old := hwmonRoot
+	hwmonRoot = filepath.Join(t.TempDir(), "missing")
+	defer func() { hwmonRoot = old }()
+
+	fans, sensors := DetectFanControl()
+	if len(fans) != 0 || len(sensors) != 0 {
+		t.Errorf("DetectFanControl() = %v, %v, want nothing", fans, sensors)
+	}
+	if _, ok := HottestSensor(sensors); ok {
+		t.Error("HottestSensor() of no sensors should report false")
+	}
+}
@@ -0,0 +1,29 @@
+package terminal
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// resetSequence resets colours and shows the cursor, in case an interrupted
+// progress display or child process left them changed
+const resetSequence = "\x1b[0m\x1b[?25h"
+
+// SaveModes records the terminal's modes (echo, line editing) so they can be
+// put back when servctl is interrupted while a command it runs, or a
+// prompt, has changed them. The returned function restores them and resets
+// colours and the cursor; it does nothing when stdin is not a terminal.
+func SaveModes() func() {
+	fd := int(os.Stdin.Fd())
+	saved, err := unix.IoctlGetTermios(fd, unix.TCGETS)
+	if err != nil {
+		return func() {}
+	}
+	return func() {
+		unix.IoctlSetTermios(fd, unix.TCSETS, saved)
+		if _, err := unix.IoctlGetTermios(int(os.Stdout.Fd()), unix.TCGETS); err == nil {
+			os.Stdout.WriteString(resetSequence)
+		}
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package terminal
+
+// SaveModes is only needed on Linux, where servctl sets servers up
+func SaveModes() func() {
+	return func() {}
+}
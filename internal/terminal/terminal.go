@@ -0,0 +1,272 @@
+// Package terminal describes the session servctl runs in (a desktop
+// terminal, the local console, or SSH) and adapts the output to it. A
+// headless server is usually set up over SSH, from a client whose font and
+// emoji widths servctl cannot know, so there emoji are replaced with ASCII
+// of the same width and the boxes still line up.
+package terminal
+
+import (
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// getenv reads the environment and procRoot is where parent processes are
+// looked up; tests replace both
+var (
+	getenv   = os.Getenv
+	procRoot = "/proc"
+)
+
+// Session is where servctl's output is shown
+type Session struct {
+	SSH     bool // Logged in over SSH
+	Console bool // Linux virtual console, which has no emoji glyphs
+	Desktop bool // A graphical session (X11 or Wayland) is available
+	UTF8    bool // The locale uses UTF-8
+
+	// ServerAddr is the server address the SSH client connected to
+	ServerAddr string
+	User       string
+}
+
+// Detect describes the current session from the environment
+func Detect() Session {
+	s := Session{
+		SSH:     getenv("SSH_TTY") != "" || getenv("SSH_CLIENT") != "",
+		Console: getenv("TERM") == "linux",
+		Desktop: getenv("DISPLAY") != "" || getenv("WAYLAND_DISPLAY") != "",
+		UTF8:    isUTF8Locale(),
+		User:    getenv("USER"),
+	}
+	if sudoUser := getenv("SUDO_USER"); sudoUser != "" {
+		s.User = sudoUser
+	}
+
+	// sudo drops the SSH variables; the login shell that ran it still has them
+	connection := getenv("SSH_CONNECTION")
+	if connection == "" {
+		connection = ancestorEnv(os.Getppid(), "SSH_CONNECTION")
+	}
+	// SSH_CONNECTION is "client-ip client-port server-ip server-port"
+	if fields := strings.Fields(connection); len(fields) == 4 {
+		s.SSH = true
+		s.ServerAddr = fields[2]
+	}
+	return s
+}
+
+// ancestorEnv looks up an environment variable in pid and its parents
+func ancestorEnv(pid int, key string) string {
+	for depth := 0; pid > 1 && depth < 32; depth++ {
+		if environ, err := os.ReadFile(filepath.Join(procRoot, strconv.Itoa(pid), "environ")); err == nil {
+			for _, entry := range strings.Split(string(environ), "\x00") {
+				if value, ok := strings.CutPrefix(entry, key+"="); ok {
+					return value
+				}
+			}
+		}
+		pid = parentPID(pid)
+	}
+	return ""
+}
+
+// parentPID reads a process's parent from /proc/PID/stat, 0 when unknown
+func parentPID(pid int) int {
+	stat, err := os.ReadFile(filepath.Join(procRoot, strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return 0
+	}
+	// "pid (comm) state ppid ...", and comm may contain spaces or parentheses
+	i := strings.LastIndexByte(string(stat), ')')
+	if i < 0 {
+		return 0
+	}
+	fields := strings.Fields(string(stat[i+1:]))
+	if len(fields) < 2 {
+		return 0
+	}
+	ppid, _ := strconv.Atoi(fields[1])
+	return ppid
+}
+
+// isUTF8Locale applies the usual precedence: LC_ALL, then LC_CTYPE, then
+// LANG. With none set the C locale is ASCII.
+func isUTF8Locale() bool {
+	for _, name := range []string{"LC_ALL", "LC_CTYPE", "LANG"} {
+		if v := getenv(name); v != "" {
+			v = strings.ToLower(v)
+			return strings.Contains(v, "utf-8") || strings.Contains(v, "utf8")
+		}
+	}
+	return false
+}
+
+// Plain reports whether output should avoid emoji: over SSH, on the Linux
+// console and without a UTF-8 locale
+func (s Session) Plain() bool {
+	return s.SSH || s.Console || !s.UTF8
+}
+
+// Kind describes the session in a few words
+func (s Session) Kind() string {
+	switch {
+	case s.SSH && s.ServerAddr != "":
+		return "SSH to " + s.ServerAddr
+	case s.SSH:
+		return "SSH"
+	case s.Console:
+		return "local console"
+	case s.Desktop:
+		return "desktop terminal"
+	}
+	return "terminal"
+}
+
+// CopyCommand returns the scp command that copies a file on the server to
+// the SSH client, empty when not connected over SSH. There is no clipboard
+// to rely on, so files are handed over this way.
+func (s Session) CopyCommand(path string) string {
+	if !s.SSH || s.ServerAddr == "" {
+		return ""
+	}
+	host := s.ServerAddr
+	if ip := net.ParseIP(host); ip != nil && ip.To4() == nil {
+		host = "[" + host + "]"
+	}
+	if s.User != "" {
+		host = s.User + "@" + host
+	}
+	return "scp " + host + ":" + path + " ."
+}
+
+// Runes that join or modify an emoji into one glyph
+const (
+	variationSelector = '\uFE0F' // Emoji presentation
+	zeroWidthJoiner   = '\u200D'
+)
+
+// plainSymbols replace the emoji servctl prints most, by meaning; any
+// other emoji becomes "*"
+var plainSymbols = map[rune]string{
+	'✅': "+", '✔': "+", '❌': "x", '✖': "x", '⚠': "!", '❗': "!",
+	'🔐': "#", '🔒': "#", '🔑': "#", 'ℹ': "i", '💡': "i", '🎉': "*",
+}
+
+// emojiRange reports whether r is in a block whose characters may be drawn
+// as emoji
+func emojiRange(r rune) bool {
+	return r >= 0x1F000 && r <= 0x1FAFF || r >= 0x2300 && r <= 0x23FF ||
+		r >= 0x2600 && r <= 0x27BF || r >= 0x2B00 && r <= 0x2BFF || r == 'ℹ'
+}
+
+// clusterPart reports whether r continues the emoji before it
+func clusterPart(r rune) bool {
+	return r == variationSelector || r == zeroWidthJoiner || r >= 0x1F3FB && r <= 0x1F3FF
+}
+
+// PlainSymbols replaces emoji with ASCII of the width lipgloss measured
+// them at, so boxes drawn around them keep their shape. Symbols drawn one
+// cell wide without emoji presentation, like ✓ and ✗, are kept.
+func PlainSymbols(s string) string {
+	if !strings.ContainsFunc(s, emojiRange) {
+		return s
+	}
+	runes := []rune(s)
+	var b strings.Builder
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		if !emojiRange(r) {
+			b.WriteRune(r)
+			continue
+		}
+		j := i + 1
+		for j < len(runes) && (clusterPart(runes[j]) || runes[j-1] == zeroWidthJoiner) {
+			j++
+		}
+		cluster := string(runes[i:j])
+		width := lipgloss.Width(cluster)
+		if width < 2 && !strings.ContainsRune(cluster, variationSelector) {
+			b.WriteString(cluster)
+		} else {
+			symbol, ok := plainSymbols[r]
+			if !ok {
+				symbol = "*"
+			}
+			b.WriteString(symbol + strings.Repeat(" ", max(0, width-len(symbol))))
+		}
+		i = j - 1
+	}
+	return b.String()
+}
+
+// safeCut returns how much of data can be converted now: a chunk may end
+// inside a character or before the modifiers of its last emoji
+func safeCut(data []byte) int {
+	cut := len(data)
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				cut = i
+			}
+			break
+		}
+	}
+	for cut > 0 {
+		r, size := utf8.DecodeLastRune(data[:cut])
+		if !emojiRange(r) && !clusterPart(r) {
+			break
+		}
+		cut -= size
+	}
+	return cut
+}
+
+// UsePlainOutput routes os.Stdout through PlainSymbols. The returned
+// function restores it and waits until everything written is shown.
+func UsePlainOutput() (func(), error) {
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout := os.Stdout
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		copyPlain(stdout, reader)
+	}()
+	os.Stdout = writer
+	return func() {
+		os.Stdout = stdout
+		writer.Close()
+		<-done
+		reader.Close()
+	}, nil
+}
+
+// copyPlain copies r to w through PlainSymbols until r ends
+func copyPlain(w io.Writer, r io.Reader) {
+	buf := make([]byte, 32*1024)
+	var pending []byte
+	for {
+		n, err := r.Read(buf)
+		data := append(pending, buf[:n]...)
+		cut := safeCut(data)
+		if err != nil {
+			cut = len(data)
+		}
+		if cut > 0 {
+			io.WriteString(w, PlainSymbols(string(data[:cut])))
+		}
+		pending = append([]byte(nil), data[cut:]...)
+		if err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package terminal
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// fakeEnv replaces the environment with env and /proc with an empty tree
+func fakeEnv(t *testing.T, env map[string]string) {
+	t.Helper()
+	oldGetenv, oldProc := getenv, procRoot
+	getenv = func(key string) string { return env[key] }
+	procRoot = t.TempDir()
+	t.Cleanup(func() { getenv, procRoot = oldGetenv, oldProc })
+}
+
+func TestDetect(t *testing.T) {
+	fakeEnv(t, map[string]string{
+		"SSH_CONNECTION": "192.168.1.20 51234 192.168.1.10 22",
+		"USER":           "root",
+		"SUDO_USER":      "madhav",
+		"LANG":           "en_US.UTF-8",
+		"TERM":           "xterm-256color",
+	})
+	s := Detect()
+	if !s.SSH || s.ServerAddr != "192.168.1.10" || s.User != "madhav" {
+		t.Errorf("Detect() = %+v, want SSH to 192.168.1.10 as madhav", s)
+	}
+	if !s.UTF8 || s.Console || s.Desktop {
+		t.Errorf("Detect() = %+v, want UTF-8 only", s)
+	}
+	if !s.Plain() {
+		t.Error("Plain() = false over SSH")
+	}
+	if got := s.Kind(); got != "SSH to 192.168.1.10" {
+		t.Errorf("Kind() = %q", got)
+	}
+}
+
+func TestDetect_Local(t *testing.T) {
+	fakeEnv(t, map[string]string{"DISPLAY": ":0", "LC_ALL": "C.utf8", "LANG": "C"})
+	s := Detect()
+	if s.SSH || !s.Desktop || !s.UTF8 || s.Plain() {
+		t.Errorf("Detect() = %+v, want a UTF-8 desktop terminal", s)
+	}
+
+	fakeEnv(t, map[string]string{"TERM": "linux", "LANG": "en_US.UTF-8"})
+	if s := Detect(); !s.Console || !s.Plain() || s.Kind() != "local console" {
+		t.Errorf("Detect() = %+v, want the plain local console", s)
+	}
+
+	fakeEnv(t, map[string]string{})
+	if s := Detect(); s.UTF8 || !s.Plain() {
+		t.Errorf("Detect() without a locale = %+v, want plain ASCII", s)
+	}
+}
+
+func TestDetect_SudoKeepsSSH(t *testing.T) {
+	fakeEnv(t, map[string]string{})
+	// sudo (pid 300) started by a login shell (pid 200) that has the SSH variables
+	write := func(path, content string) {
+		full := filepath.Join(procRoot, path)
+		os.MkdirAll(filepath.Dir(full), 0755)
+		os.WriteFile(full, []byte(content), 0644)
+	}
+	write("300/stat", "300 (sudo) S 200 300 200 0")
+	write("300/environ", "HOME=/root\x00")
+	write("200/stat", "200 (bash (login)) S 100 200 200 0")
+	write("200/environ", "USER=madhav\x00SSH_CONNECTION=10.0.0.5 40000 10.0.0.2 22\x00")
+
+	if got := ancestorEnv(300, "SSH_CONNECTION"); got != "10.0.0.5 40000 10.0.0.2 22" {
+		t.Errorf("ancestorEnv() = %q", got)
+	}
+	if got := ancestorEnv(300, "MISSING"); got != "" {
+		t.Errorf("ancestorEnv(MISSING) = %q, want empty", got)
+	}
+}
+
+func TestCopyCommand(t *testing.T) {
+	tests := []struct {
+		session Session
+		want    string
+	}{
+		{Session{SSH: true, ServerAddr: "192.168.1.10", User: "madhav"}, "scp madhav@192.168.1.10:/home/madhav/infra/credentials.enc ."},
+		{Session{SSH: true, ServerAddr: "fe80::1", User: "madhav"}, "scp madhav@[fe80::1]:/home/madhav/infra/credentials.enc ."},
+		{Session{Desktop: true}, ""},
+	}
+	for _, tt := range tests {
+		if got := tt.session.CopyCommand("/home/madhav/infra/credentials.enc"); got != tt.want {
+			t.Errorf("CopyCommand() = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestPlainSymbols(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"📋 Phase 1: System Preparation", "*  Phase 1: System Preparation"},
+		{"⚠️ Warning", "!  Warning"},
+		{"✅ Done", "+  Done"},
+		{"🔐 CREDENTIALS", "#  CREDENTIALS"},
+		{"  ✓ Installed  ✗ Failed  • item", "  ✓ Installed  ✗ Failed  • item"},
+		{"no emoji here", "no emoji here"},
+	}
+	for _, tt := range tests {
+		got := PlainSymbols(tt.in)
+		if got != tt.want {
+			t.Errorf("PlainSymbols(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+		if lipgloss.Width(got) != lipgloss.Width(tt.in) {
+			t.Errorf("PlainSymbols(%q) changed the width from %d to %d", tt.in, lipgloss.Width(tt.in), lipgloss.Width(got))
+		}
+	}
+}
+
+func TestPlainSymbols_Box(t *testing.T) {
+	box := lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).Render("⚡ Power: ~12 W\n🎉 Done")
+	lines := strings.Split(PlainSymbols(box), "\n")
+	for _, line := range lines {
+		if lipgloss.Width(line) != lipgloss.Width(lines[0]) {
+			t.Errorf("box lines differ in width after PlainSymbols:\n%s", strings.Join(lines, "\n"))
+			break
+		}
+	}
+}
+
+func TestCopyPlain_SplitWrites(t *testing.T) {
+	// An emoji and its variation selector arriving in separate reads
+	text := "⚠️ Warning\n"
+	r := &chunkReader{chunks: [][]byte{[]byte(text[:2]), []byte(text[2:4]), []byte(text[4:])}}
+	var out bytes.Buffer
+	copyPlain(&out, r)
+	if out.String() != "!  Warning\n" {
+		t.Errorf("copyPlain() = %q", out.String())
+	}
+}
+
+// chunkReader returns one chunk per Read
+type chunkReader struct {
+	chunks [][]byte
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	if len(r.chunks) == 0 {
+		return 0, os.ErrClosed
+	}
+	n := copy(p, r.chunks[0])
+	r.chunks = r.chunks[1:]
+	return n, nil
+}
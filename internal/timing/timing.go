@@ -0,0 +1,193 @@
+// Package timing records how long the setup phases and the slow privileged
+// commands (package installs, formatting, image pulls) take. The entries
+// stay on the server, in the state file; servctl -status compares them with
+// typical durations to point at causes such as a slow apt mirror.
+package timing
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kind tells phases from the commands run within them
+type Kind string
+
+const (
+	KindPhase   Kind = "phase"
+	KindCommand Kind = "command"
+)
+
+// Entry is one timed step of a setup run
+type Entry struct {
+	Kind    Kind
+	Name    string
+	Started time.Time
+	Seconds float64
+	// Waited is the part of a phase spent waiting for answers to prompts
+	Waited float64 `json:",omitempty"`
+	Failed bool    `json:",omitempty"`
+}
+
+// Duration is how long the step took
+func (e Entry) Duration() time.Duration {
+	return time.Duration(e.Seconds * float64(time.Second))
+}
+
+// Working is how long the step took without the time spent waiting for
+// answers; it is what is compared with the typical durations
+func (e Entry) Working() time.Duration {
+	return time.Duration((e.Seconds - e.Waited) * float64(time.Second))
+}
+
+// Recorder collects the entries of one run. Its methods may be called from
+// any goroutine.
+type Recorder struct {
+	mu      sync.Mutex
+	entries []Entry
+	phase   *Entry // The phase being timed, if any
+	waited  time.Duration
+}
+
+// BeginPhase ends the current phase, if any, and starts timing the next
+func (r *Recorder) BeginPhase(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.endPhase()
+	r.phase = &Entry{Kind: KindPhase, Name: name, Started: time.Now()}
+	r.waited = 0
+}
+
+// EndPhase ends the current phase
+func (r *Recorder) EndPhase() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.endPhase()
+}
+
+func (r *Recorder) endPhase() {
+	if r.phase == nil {
+		return
+	}
+	r.phase.Seconds = time.Since(r.phase.Started).Seconds()
+	r.phase.Waited = r.waited.Seconds()
+	r.entries = append(r.entries, *r.phase)
+	r.phase = nil
+}
+
+// Phase returns the name of the phase being timed, empty between phases
+func (r *Recorder) Phase() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.phase == nil {
+		return ""
+	}
+	return r.phase.Name
+}
+
+// Waited adds time spent waiting for the owner to the current phase
+func (r *Recorder) Waited(d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.waited += d
+}
+
+// Command records a command that started at started and has just ended
+func (r *Recorder) Command(name string, started time.Time, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries = append(r.entries, Entry{
+		Kind:    KindCommand,
+		Name:    name,
+		Started: started,
+		Seconds: time.Since(started).Seconds(),
+		Failed:  err != nil,
+	})
+}
+
+// Entries returns what has been recorded, in the order steps ended
+func (r *Recorder) Entries() []Entry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Entry(nil), r.entries...)
+}
+
+// limit is how long a kind of step normally takes at most, and what to
+// look at when it took longer
+type limit struct {
+	prefix string
+	max    time.Duration
+	hint   string
+}
+
+// commandLimits are matched by name prefix, first match wins
+var commandLimits = []limit{
+	{"apt-get update", 3 * time.Minute, "a slow or distant apt mirror; pick one near you in /etc/apt/sources.list"},
+	{"apt-get upgrade", 20 * time.Minute, "a slow apt mirror, or a slow disk for the root filesystem"},
+	{"apt-get install", 10 * time.Minute, "a slow or distant apt mirror; pick one near you in /etc/apt/sources.list"},
+	{"Format and mount", 10 * time.Minute, "a failing or SMR drive; check it with smartctl -a"},
+	{"Start services", 30 * time.Minute, "a slow connection to the container registries"},
+}
+
+// phaseLimits apply to a phase's working time
+var phaseLimits = map[string]time.Duration{
+	"System Preparation":    30 * time.Minute,
+	"Storage Configuration": 15 * time.Minute,
+	"Directory Structure":   2 * time.Minute,
+	"Service Configuration": 5 * time.Minute,
+	"Maintenance Scripts":   10 * time.Minute,
+	"Service Bootstrap":     40 * time.Minute,
+}
+
+// Abnormal lists the steps that took much longer than usual, with what is
+// likely behind each
+func Abnormal(entries []Entry) []string {
+	var findings []string
+	for _, e := range entries {
+		switch e.Kind {
+		case KindCommand:
+			for _, l := range commandLimits {
+				if strings.HasPrefix(e.Name, l.prefix) {
+					if e.Duration() > l.max {
+						findings = append(findings, fmt.Sprintf("%s took %s (usually under %s): check for %s",
+							e.Name, Round(e.Duration()), Round(l.max), l.hint))
+					}
+					break
+				}
+			}
+		case KindPhase:
+			if max, ok := phaseLimits[e.Name]; ok && e.Working() > max {
+				findings = append(findings, fmt.Sprintf("%s took %s without prompts (usually under %s)",
+					e.Name, Round(e.Working()), Round(max)))
+			}
+		}
+	}
+	return findings
+}
+
+// Total is the time from the first phase's start to the last step's end
+func Total(entries []Entry) time.Duration {
+	var first, last time.Time
+	for _, e := range entries {
+		if first.IsZero() || e.Started.Before(first) {
+			first = e.Started
+		}
+		if end := e.Started.Add(e.Duration()); end.After(last) {
+			last = end
+		}
+	}
+	return last.Sub(first)
+}
+
+// Round shortens a duration for display: seconds under a minute, whole
+// seconds under an hour, minutes above
+func Round(d time.Duration) time.Duration {
+	switch {
+	case d < time.Minute:
+		return d.Round(100 * time.Millisecond)
+	case d < time.Hour:
+		return d.Round(time.Second)
+	}
+	return d.Round(time.Minute)
+}
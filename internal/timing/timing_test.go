@@ -0,0 +1,112 @@
+package timing
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecorder(t *testing.T) {
+	r := &Recorder{}
+	r.BeginPhase("System Preparation")
+	r.Command("apt-get update", time.Now(), nil)
+	r.Waited(0)
+	r.BeginPhase("Storage Configuration")
+	r.Command("Format and mount disks", time.Now(), errors.New("mkfs failed"))
+	if r.Phase() != "Storage Configuration" {
+		t.Errorf("Phase() = %q, want the open phase", r.Phase())
+	}
+	r.EndPhase()
+	if r.Phase() != "" {
+		t.Errorf("Phase() = %q after EndPhase, want empty", r.Phase())
+	}
+	r.EndPhase() // No phase open: nothing more is recorded
+
+	entries := r.Entries()
+	want := []struct {
+		kind   Kind
+		name   string
+		failed bool
+	}{
+		{KindCommand, "apt-get update", false},
+		{KindPhase, "System Preparation", false},
+		{KindCommand, "Format and mount disks", true},
+		{KindPhase, "Storage Configuration", false},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("Entries() = %+v, want %d entries", entries, len(want))
+	}
+	for i, w := range want {
+		if entries[i].Kind != w.kind || entries[i].Name != w.name || entries[i].Failed != w.failed {
+			t.Errorf("entries[%d] = %+v, want %+v", i, entries[i], w)
+		}
+	}
+}
+
+func TestRecorder_WaitedIsPerPhase(t *testing.T) {
+	r := &Recorder{}
+	r.BeginPhase("Service Configuration")
+	r.Waited(3 * time.Second)
+	r.BeginPhase("Maintenance Scripts")
+	r.Waited(time.Second)
+	r.EndPhase()
+
+	entries := r.Entries()
+	if entries[0].Waited != 3 || entries[1].Waited != 1 {
+		t.Errorf("Waited = %v, %v; want 3, 1", entries[0].Waited, entries[1].Waited)
+	}
+}
+
+func TestAbnormal(t *testing.T) {
+	start := time.Date(2026, 5, 1, 10, 0, 0, 0, time.UTC)
+	entries := []Entry{
+		{Kind: KindCommand, Name: "apt-get update", Started: start, Seconds: 20 * 60},
+		{Kind: KindCommand, Name: "apt-get install curl", Started: start, Seconds: 30},
+		// An hour in the phase, but nearly all of it reading prompts
+		{Kind: KindPhase, Name: "Service Configuration", Started: start, Seconds: 3600, Waited: 3500},
+		{Kind: KindPhase, Name: "Directory Structure", Started: start, Seconds: 600, Waited: 60},
+		{Kind: KindCommand, Name: "something unknown", Started: start, Seconds: 99999},
+	}
+
+	findings := Abnormal(entries)
+	if len(findings) != 2 {
+		t.Fatalf("Abnormal() = %q, want 2 findings", findings)
+	}
+	if !strings.Contains(findings[0], "apt-get update took 20m0s") || !strings.Contains(findings[0], "mirror") {
+		t.Errorf("findings[0] = %q, want the slow apt mirror", findings[0])
+	}
+	if !strings.Contains(findings[1], "Directory Structure took 9m0s") {
+		t.Errorf("findings[1] = %q, want the slow directory phase", findings[1])
+	}
+}
+
+func TestTotal(t *testing.T) {
+	start := time.Date(2026, 5, 1, 10, 0, 0, 0, time.UTC)
+	entries := []Entry{
+		{Kind: KindCommand, Name: "apt-get update", Started: start.Add(time.Minute), Seconds: 60},
+		{Kind: KindPhase, Name: "System Preparation", Started: start, Seconds: 300},
+		{Kind: KindPhase, Name: "Storage Configuration", Started: start.Add(5 * time.Minute), Seconds: 120},
+	}
+	if got := Total(entries); got != 7*time.Minute {
+		t.Errorf("Total() = %v, want 7m", got)
+	}
+	if got := Total(nil); got != 0 {
+		t.Errorf("Total(nil) = %v, want 0", got)
+	}
+}
+
+func TestRound(t *testing.T) {
+	tests := []struct {
+		in, want time.Duration
+	}{
+		{1234 * time.Millisecond, 1200 * time.Millisecond},
+		{90*time.Second + 400*time.Millisecond, 90 * time.Second},
+		{2*time.Hour + 10*time.Minute + 40*time.Second, 2*time.Hour + 11*time.Minute},
+	}
+	for _, tt := range tests {
+		if got := Round(tt.in); got != tt.want {
+			t.Errorf("Round(%v) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,281 @@
+// Package trash keeps what servctl deletes or overwrites under ~/infra and
+// the data root, so a regeneration or cleanup can be undone. Each entry is a
+// timestamped directory in the root's .trash holding the item and a small
+// metadata file; entries older than Retention are purged.
+package trash
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/madhav/servctl/internal/utils"
+)
+
+// DirName is the trash directory created inside each root
+const DirName = ".trash"
+
+// metaFile records where an entry came from
+const metaFile = "trash.json"
+
+// Retention is how long entries are kept before being purged
+var Retention = 14 * 24 * time.Hour
+
+// Roots are the trees whose deletions and overwrites go through the trash,
+// set by main to ~/infra and the data root. Paths outside them are deleted
+// or overwritten directly.
+var Roots []string
+
+// Entry is one trashed item
+type Entry struct {
+	ID        string    `json:"-"`
+	Root      string    `json:"-"`
+	Original  string    `json:"original"`
+	TrashedAt time.Time `json:"trashed_at"`
+	Size      int64     `json:"size"`
+}
+
+// itemPath is where the trashed item itself is stored
+func (e Entry) itemPath() string {
+	return filepath.Join(e.Root, DirName, e.ID, filepath.Base(e.Original))
+}
+
+// Expired reports whether the entry is past the retention window
+func (e Entry) Expired(now time.Time) bool {
+	return now.Sub(e.TrashedAt) > Retention
+}
+
+// rootFor returns the registered root containing path
+func rootFor(path string) (string, bool) {
+	best := ""
+	for _, root := range Roots {
+		root = filepath.Clean(root)
+		rel, err := filepath.Rel(root, path)
+		if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		// Never trash the trash
+		if rel == DirName || strings.HasPrefix(rel, DirName+string(filepath.Separator)) {
+			return "", false
+		}
+		if len(root) > len(best) {
+			best = root
+		}
+	}
+	return best, best != ""
+}
+
+// treeSize sums the sizes of regular files under path
+func treeSize(path string) int64 {
+	var size int64
+	filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
+
+// Move puts path into the trash of the root containing it. A path outside
+// every root, or one that does not exist, is reported with ok=false and
+// left alone.
+func Move(path string) (entry Entry, ok bool, err error) {
+	return trashItem(path, os.Rename)
+}
+
+// keep puts a copy of the file at path into the trash and leaves path
+// alone, for a write that replaces it atomically. A hard link shares the
+// old contents without copying them; the rename then unlinks path from them.
+func keep(path string) (Entry, bool, error) {
+	return trashItem(path, func(src, dst string) error {
+		if err := os.Link(src, dst); err == nil {
+			return nil
+		}
+		data, err := os.ReadFile(src)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(dst, data, 0600)
+	})
+}
+
+// trashItem creates a trash entry for path and places the item in it
+func trashItem(path string, place func(src, dst string) error) (entry Entry, ok bool, err error) {
+	path, err = filepath.Abs(path)
+	if err != nil {
+		return Entry{}, false, err
+	}
+	root, inRoot := rootFor(path)
+	if !inRoot {
+		return Entry{}, false, nil
+	}
+	if _, err := os.Lstat(path); err != nil {
+		if os.IsNotExist(err) {
+			return Entry{}, false, nil
+		}
+		return Entry{}, false, err
+	}
+
+	now := time.Now()
+	entry = Entry{
+		ID:        now.Format("20060102-150405.000000") + "-" + filepath.Base(path),
+		Root:      root,
+		Original:  path,
+		TrashedAt: now,
+		Size:      treeSize(path),
+	}
+
+	dir := filepath.Join(root, DirName, entry.ID)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return Entry{}, false, fmt.Errorf("failed to create trash entry: %w", err)
+	}
+	meta, _ := json.MarshalIndent(entry, "", "  ")
+	if err := os.WriteFile(filepath.Join(dir, metaFile), meta, 0600); err != nil {
+		os.RemoveAll(dir)
+		return Entry{}, false, fmt.Errorf("failed to write trash metadata: %w", err)
+	}
+	if err := place(path, entry.itemPath()); err != nil {
+		os.RemoveAll(dir)
+		return Entry{}, false, fmt.Errorf("failed to move %s to trash: %w", path, err)
+	}
+
+	Purge(root, now)
+	return entry, true, nil
+}
+
+// Remove deletes path, through the trash when it is under a root
+func Remove(path string) error {
+	if _, ok, err := Move(path); ok || err != nil {
+		return err
+	}
+	if err := os.RemoveAll(path); err != nil {
+		return fmt.Errorf("failed to remove %s: %w", path, err)
+	}
+	return nil
+}
+
+// BeforeWrite keeps the current contents of path in the trash when content
+// would change them. Writing identical content keeps nothing, so
+// regenerating unchanged files does not fill the trash.
+func BeforeWrite(path string, content []byte) error {
+	current, err := os.ReadFile(path)
+	if err != nil || bytes.Equal(current, content) {
+		return nil
+	}
+	_, _, err = keep(path)
+	return err
+}
+
+// WriteFile is utils.AtomicWrite with the previous contents kept in the
+// trash
+func WriteFile(path string, content []byte, perm os.FileMode) error {
+	if err := BeforeWrite(path, content); err != nil {
+		return err
+	}
+	return utils.AtomicWrite(path, content, perm)
+}
+
+// List returns the entries under root, newest first
+func List(root string) ([]Entry, error) {
+	dirs, err := os.ReadDir(filepath.Join(root, DirName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []Entry
+	for _, d := range dirs {
+		data, err := os.ReadFile(filepath.Join(root, DirName, d.Name(), metaFile))
+		if err != nil {
+			continue
+		}
+		var e Entry
+		if json.Unmarshal(data, &e) != nil {
+			continue
+		}
+		e.ID, e.Root = d.Name(), root
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].TrashedAt.After(entries[j].TrashedAt) })
+	return entries, nil
+}
+
+// ListAll returns the entries of every root, newest first
+func ListAll() ([]Entry, error) {
+	var all []Entry
+	for _, root := range Roots {
+		entries, err := List(root)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, entries...)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].TrashedAt.After(all[j].TrashedAt) })
+	return all, nil
+}
+
+// Find returns the entry with the given ID from any root
+func Find(id string) (Entry, error) {
+	entries, err := ListAll()
+	if err != nil {
+		return Entry{}, err
+	}
+	for _, e := range entries {
+		if e.ID == id {
+			return e, nil
+		}
+	}
+	return Entry{}, fmt.Errorf("no trash entry %q", id)
+}
+
+// Restore moves an entry back to its original path. Whatever is there now
+// is trashed first, so a restore can itself be undone.
+func Restore(entry Entry) error {
+	if _, err := os.Lstat(entry.Original); err == nil {
+		if _, _, err := Move(entry.Original); err != nil {
+			return fmt.Errorf("failed to trash current %s: %w", entry.Original, err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(entry.Original), 0755); err != nil {
+		return err
+	}
+	if err := os.Rename(entry.itemPath(), entry.Original); err != nil {
+		return fmt.Errorf("failed to restore %s: %w", entry.Original, err)
+	}
+	return os.RemoveAll(filepath.Join(entry.Root, DirName, entry.ID))
+}
+
+// Delete permanently removes an entry
+func Delete(entry Entry) error {
+	return os.RemoveAll(filepath.Join(entry.Root, DirName, entry.ID))
+}
+
+// Purge permanently removes entries under root past the retention window
+func Purge(root string, now time.Time) (int, error) {
+	entries, err := List(root)
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	var errs []error
+	for _, e := range entries {
+		if !e.Expired(now) {
+			continue
+		}
+		if err := Delete(e); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		removed++
+	}
+	return removed, errors.Join(errs...)
+}
@@ -0,0 +1,119 @@
+package trash
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// withRoot registers a temporary root for the duration of a test
+func withRoot(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	old := Roots
+	Roots = []string{root}
+	t.Cleanup(func() { Roots = old })
+	return root
+}
+
+func TestWriteFile_KeepsPreviousVersion(t *testing.T) {
+	root := withRoot(t)
+	path := filepath.Join(root, "compose", ".env")
+	os.MkdirAll(filepath.Dir(path), 0755)
+
+	if err := WriteFile(path, []byte("v1"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := List(root); len(entries) != 0 {
+		t.Fatalf("first write trashed %d entries, want 0", len(entries))
+	}
+
+	// Identical content is not worth keeping
+	WriteFile(path, []byte("v1"), 0600)
+	if entries, _ := List(root); len(entries) != 0 {
+		t.Fatalf("unchanged write trashed %d entries, want 0", len(entries))
+	}
+
+	WriteFile(path, []byte("v2"), 0600)
+	entries, _ := List(root)
+	if len(entries) != 1 || entries[0].Original != path {
+		t.Fatalf("entries = %+v, want one for %s", entries, path)
+	}
+
+	if err := Restore(entries[0]); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "v1" {
+		t.Errorf("restored content = %q, want v1", data)
+	}
+	// The version the restore replaced is itself kept
+	entries, _ = List(root)
+	if len(entries) != 1 {
+		t.Fatalf("after restore %d entries, want 1", len(entries))
+	}
+	if data, _ := os.ReadFile(entries[0].itemPath()); string(data) != "v2" {
+		t.Errorf("trashed content = %q, want v2", data)
+	}
+}
+
+func TestRemove(t *testing.T) {
+	root := withRoot(t)
+	dir := filepath.Join(root, "scripts")
+	os.MkdirAll(dir, 0755)
+	os.WriteFile(filepath.Join(dir, "a.sh"), []byte("echo"), 0755)
+
+	if err := Remove(dir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Error("directory still present after Remove")
+	}
+	entries, _ := List(root)
+	if len(entries) != 1 || entries[0].Size != 4 {
+		t.Fatalf("entries = %+v, want one of 4 bytes", entries)
+	}
+
+	// Outside every root nothing is kept
+	outside := filepath.Join(t.TempDir(), "x")
+	os.WriteFile(outside, []byte("x"), 0644)
+	if err := Remove(outside); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(outside); !os.IsNotExist(err) {
+		t.Error("file outside the roots was not removed")
+	}
+	if entries, _ := ListAll(); len(entries) != 1 {
+		t.Errorf("ListAll = %d entries, want 1", len(entries))
+	}
+}
+
+func TestPurge(t *testing.T) {
+	root := withRoot(t)
+	path := filepath.Join(root, "old.txt")
+	os.WriteFile(path, []byte("x"), 0644)
+	entry, ok, err := Move(path)
+	if !ok || err != nil {
+		t.Fatalf("Move = %v, %v", ok, err)
+	}
+
+	if n, _ := Purge(root, time.Now()); n != 0 {
+		t.Errorf("Purge removed %d fresh entries", n)
+	}
+	if n, _ := Purge(root, entry.TrashedAt.Add(Retention+time.Hour)); n != 1 {
+		t.Errorf("Purge removed %d expired entries, want 1", n)
+	}
+	if entries, _ := List(root); len(entries) != 0 {
+		t.Errorf("%d entries remain after purge", len(entries))
+	}
+}
+
+func TestRootFor_SkipsTrash(t *testing.T) {
+	root := withRoot(t)
+	if _, ok := rootFor(filepath.Join(root, DirName, "x")); ok {
+		t.Error("paths inside the trash must not be trashed again")
+	}
+	if _, ok := rootFor(root); ok {
+		t.Error("a root itself must not be trashed")
+	}
+}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/charmbracelet/lipgloss"
 	"github.com/madhav/servctl/internal/directory"
+	"github.com/madhav/servctl/internal/paths"
 )
 
 // Directory-specific styles
@@ -132,8 +133,9 @@ func RenderDirectoryPlan(specs []directory.DirectorySpec) string {
 	return b.String()
 }
 
-// RenderDirectoryTree renders a tree view of directories
-func RenderDirectoryTree(homeDir, dataRoot string) string {
+// RenderDirectoryTree renders a tree view of directories. Services kept
+// under a root of their own are marked with where they live.
+func RenderDirectoryTree(homeDir, dataRoot string, roots paths.Roots) string {
 	var b strings.Builder
 
 	b.WriteString(SectionStyle.Render("📂 Directory Tree") + "\n\n")
@@ -148,20 +150,33 @@ func RenderDirectoryTree(homeDir, dataRoot string) string {
 	b.WriteString("\n")
 
 	// Data space tree
-	b.WriteString(TitleStyle.Render("/mnt/data/") + "\n")
-	b.WriteString("├── " + ImmichBadgeStyle.Render("gallery/") + "\n")
+	tops := roots.TopDirs()
+	movedTo := func(dir string) string {
+		if root, ok := tops[dir]; ok {
+			return "  → " + DirStyle.Render(root+"/"+dir+"/")
+		}
+		return ""
+	}
+	b.WriteString(TitleStyle.Render(strings.TrimSuffix(dataRoot, "/")+"/") + "\n")
+	b.WriteString("├── " + ImmichBadgeStyle.Render("gallery/") + movedTo("gallery") + "\n")
 	b.WriteString("│   ├── library/         # Photo storage\n")
 	b.WriteString("│   ├── upload/          # Upload staging\n")
 	b.WriteString("│   ├── profile/         # User profiles\n")
-	b.WriteString("│   ├── video/           # Video transcodes\n")
+	b.WriteString("│   ├── encoded-video/   # Video transcodes\n")
 	b.WriteString("│   └── thumbs/          # Thumbnails\n")
-	b.WriteString("├── " + NextcloudBadgeStyle.Render("cloud/") + "\n")
+	b.WriteString("├── " + NextcloudBadgeStyle.Render("cloud/") + movedTo("cloud") + "\n")
 	b.WriteString("│   ├── data/            # User files\n")
-	b.WriteString("│   └── config/          # NC config\n")
+	b.WriteString("│   ├── config/          # NC config\n")
+	b.WriteString("│   └── export/          # Calendars & contacts\n")
 	b.WriteString("├── " + DatabaseBadgeStyle.Render("databases/") + "\n")
 	b.WriteString("│   ├── immich-postgres/ # Immich DB\n")
 	b.WriteString("│   └── nextcloud-mariadb/ # NC DB\n")
 	b.WriteString("└── cache/               # Redis data\n")
+	for _, dir := range []string{"media", "downloads", "books"} {
+		if root, ok := tops[dir]; ok {
+			b.WriteString("\n" + TitleStyle.Render(root+"/"+dir+"/") + "  # Kept off the data root\n")
+		}
+	}
 
 	return DirectoryTreeStyle.Render(b.String())
 }
@@ -0,0 +1,56 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/madhav/servctl/internal/pkgmgr"
+	"github.com/madhav/servctl/internal/storage"
+)
+
+// progressBarWidth is the number of cells in package progress bars
+const progressBarWidth = 20
+
+// renderBar draws a fixed-width bar for a 0-100 percentage
+func renderBar(percent float64) string {
+	filled := int(percent / 100 * progressBarWidth)
+	if filled < 0 {
+		filled = 0
+	}
+	if filled > progressBarWidth {
+		filled = progressBarWidth
+	}
+	return "[" + strings.Repeat("█", filled) + strings.Repeat("░", progressBarWidth-filled) + "]"
+}
+
+// RenderPackageProgress renders a single-line status for a package
+// operation, meant to be redrawn in place with a carriage return
+func RenderPackageProgress(p pkgmgr.Progress) string {
+	switch p.Phase {
+	case pkgmgr.PhaseUpdate:
+		return fmt.Sprintf("    ↻ Refreshing package lists %s", DetailStyle.UnsetPaddingLeft().Render(p.Item))
+	case pkgmgr.PhaseDownload:
+		line := fmt.Sprintf("    ↓ %s %3.0f%%", renderBar(p.Percent), p.Percent)
+		if p.Total > 0 {
+			line += fmt.Sprintf(" file %d/%d", p.Current, p.Total)
+		}
+		if p.Bytes > 0 {
+			line += " of " + storage.FormatBytes(p.Bytes)
+		}
+		return line
+	case pkgmgr.PhaseInstall:
+		return fmt.Sprintf("    ⚙ %s %3.0f%% %s", renderBar(p.Percent), p.Percent, p.Item)
+	case pkgmgr.PhaseRetry:
+		return WarnStyle.Render(fmt.Sprintf("    ⟳ Attempt %d: %s", p.Attempt, p.Message))
+	case pkgmgr.PhaseDone:
+		if p.Upgraded == 0 && p.Installed == 0 {
+			return "    " + PassStyle.Render("✓") + " Done"
+		}
+		summary := fmt.Sprintf("%d upgraded, %d newly installed", p.Upgraded, p.Installed)
+		if p.Bytes > 0 {
+			summary += ", " + storage.FormatBytes(p.Bytes) + " downloaded"
+		}
+		return "    " + PassStyle.Render("✓") + " " + summary
+	}
+	return ""
+}
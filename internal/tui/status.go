@@ -0,0 +1,137 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/madhav/servctl/internal/status"
+	"github.com/madhav/servctl/internal/storage"
+)
+
+// statusTable lays out rows in columns padded to the widest cell. Cells
+// are padded before styling so ANSI codes do not throw the widths off.
+type statusTable struct {
+	header []string
+	rows   [][]string
+	styles [][]func(...string) string
+}
+
+func (t *statusTable) add(cells []string, styles []func(...string) string) {
+	t.rows = append(t.rows, cells)
+	t.styles = append(t.styles, styles)
+}
+
+func (t *statusTable) render() string {
+	widths := make([]int, len(t.header))
+	for _, row := range append([][]string{t.header}, t.rows...) {
+		for i, cell := range row {
+			widths[i] = max(widths[i], len([]rune(cell)))
+		}
+	}
+	pad := func(s string, w int) string {
+		return s + strings.Repeat(" ", w-len([]rune(s)))
+	}
+
+	var b strings.Builder
+	header := make([]string, len(t.header))
+	for i, h := range t.header {
+		header[i] = SkipStyle.Render(pad(h, widths[i]))
+	}
+	b.WriteString("  " + strings.TrimRight(strings.Join(header, "  "), " ") + "\n")
+	for r, row := range t.rows {
+		cells := make([]string, len(row))
+		for i, cell := range row {
+			cells[i] = pad(cell, widths[i])
+			if t.styles[r][i] != nil {
+				cells[i] = t.styles[r][i](cells[i])
+			}
+		}
+		b.WriteString("  " + strings.TrimRight(strings.Join(cells, "  "), " ") + "\n")
+	}
+	return b.String()
+}
+
+// RenderStatus renders a status report as compact tables of services,
+// storage and drives
+func RenderStatus(r status.Report) string {
+	var b strings.Builder
+
+	b.WriteString(SectionStyle.Render("Services") + "\n")
+	switch {
+	case r.DockerError != "":
+		b.WriteString(WarnStyle.Render("  "+r.DockerError) + "\n")
+	case len(r.Services) == 0:
+		b.WriteString(DetailStyle.Render("No containers") + "\n")
+	default:
+		t := statusTable{header: []string{"SERVICE", "STATE", "HEALTH", "UPTIME", "PORTS"}}
+		for _, s := range r.Services {
+			style := PassStyle.Render
+			if !s.OK() {
+				style = FailStyle.Render
+			} else if s.Health == "starting" {
+				style = WarnStyle.Render
+			}
+			health := s.Health
+			if health == "" {
+				health = "-"
+			}
+			t.add([]string{s.Name, s.State, health, s.Uptime, strings.Join(s.Ports, ", ")},
+				[]func(...string) string{nil, style, style, nil, nil})
+		}
+		b.WriteString(t.render())
+	}
+
+	b.WriteString(SectionStyle.Render("Storage") + "\n")
+	if len(r.Disks) == 0 {
+		b.WriteString(DetailStyle.Render("No storage paths found") + "\n")
+	} else {
+		t := statusTable{header: []string{"PATH", "FS", "USED", "SIZE", "USE", ""}}
+		for _, d := range r.Disks {
+			percent := d.UsedPercent()
+			style := PassStyle.Render
+			if percent >= 90 {
+				style = FailStyle.Render
+			} else if percent >= 75 {
+				style = WarnStyle.Render
+			}
+			path := d.Path
+			if !d.Mounted {
+				path += " (not mounted)"
+			}
+			t.add([]string{path, d.FSType, storage.FormatBytes(d.Used), storage.FormatBytes(d.Total),
+				fmt.Sprintf("%3.0f%%", percent), renderBar(percent)},
+				[]func(...string) string{nil, nil, nil, nil, style, style})
+		}
+		b.WriteString(t.render())
+	}
+
+	if len(r.Drives) > 0 {
+		b.WriteString(SectionStyle.Render("Drives") + "\n")
+		t := statusTable{header: []string{"DEVICE", "MODEL", "SMART", "TEMP"}}
+		for _, d := range r.Drives {
+			style := SkipStyle.Render
+			switch d.Health {
+			case "PASSED":
+				style = PassStyle.Render
+			case "FAILED":
+				style = FailStyle.Render
+			}
+			temp, tempStyle := "-", SkipStyle.Render
+			if d.TempC > 0 {
+				temp = fmt.Sprintf("%d°C", d.TempC)
+			}
+			switch d.TempLevel() {
+			case "ok":
+				tempStyle = PassStyle.Render
+			case "warm":
+				tempStyle = WarnStyle.Render
+			case "hot":
+				tempStyle = FailStyle.Render
+			}
+			t.add([]string{d.Device, d.Model, d.Health, temp}, []func(...string) string{nil, nil, style, tempStyle})
+		}
+		b.WriteString(t.render())
+	}
+
+	return b.String()
+}
@@ -455,3 +455,19 @@ func RenderStrategies(strategies []storage.Strategy) string {
 func RenderStrategyPrompt(count int) string {
 	return fmt.Sprintf("Select strategy [1-%d]: ", count)
 }
+
+// RenderPlacement renders where the storage layout puts each kind of data
+func RenderPlacement(p storage.Placement) string {
+	var b strings.Builder
+	b.WriteString(SectionStyle.Render("Service Placement:") + "\n")
+	b.WriteString(fmt.Sprintf("  • Photos, files & media → %s\n", p.DataRoot))
+	if p.FastRoot != "" {
+		b.WriteString(fmt.Sprintf("  • Databases & caches    → %s (fast tier)\n", p.FastRoot))
+	} else {
+		b.WriteString(fmt.Sprintf("  • Databases & caches    → %s\n", p.DataRoot))
+	}
+	if p.ScratchRoot != "" {
+		b.WriteString(fmt.Sprintf("  • Downloads             → %s (scratch)\n", p.ScratchRoot))
+	}
+	return b.String()
+}
@@ -0,0 +1,292 @@
+// Package ups sets up Network UPS Tools (NUT) for a USB-connected UPS: it
+// detects the UPS, writes a standalone NUT configuration whose shutdown
+// stops the containers before powering off, and reads the battery status
+// for 'servctl -status'.
+package ups
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/madhav/servctl/internal/ops"
+	"github.com/madhav/servctl/templates"
+)
+
+// Name is the name the UPS is configured under in NUT
+const Name = "servctl-ups"
+
+// Address is how NUT clients (upsc, upsmon) reach the UPS
+const Address = Name + "@localhost"
+
+// ShutdownScript is the command upsmon runs when the battery is nearly empty
+const ShutdownScript = "/usr/local/sbin/servctl-ups-shutdown"
+
+// Device is a UPS found on the USB bus
+type Device struct {
+	VendorID  string // e.g. "051d"
+	ProductID string
+	Vendor    string // Vendor name (from the vendor table, else the device)
+	Product   string // Product string reported by the device, if any
+	Driver    string // NUT driver that speaks its protocol
+}
+
+// String describes the device for prompts
+func (d Device) String() string {
+	name := strings.TrimSpace(d.Vendor + " " + d.Product)
+	return fmt.Sprintf("%s (%s:%s, %s)", name, d.VendorID, d.ProductID, d.Driver)
+}
+
+// usbVendors are USB vendor IDs used by UPS makers and the NUT driver for
+// them. Most speak the USB HID power device class; the cheap "Megatec/Q1"
+// units behind generic USB-serial bridges need nutdrv_qx.
+var usbVendors = map[string]struct{ name, driver string }{
+	"051d": {"APC", "usbhid-ups"},
+	"0764": {"CyberPower", "usbhid-ups"},
+	"0463": {"Eaton", "usbhid-ups"},
+	"09ae": {"Tripp Lite", "usbhid-ups"},
+	"0d9f": {"Powercom", "usbhid-ups"},
+	"10af": {"Liebert", "usbhid-ups"},
+	"050d": {"Belkin", "usbhid-ups"},
+	"2b2d": {"Salicru", "usbhid-ups"},
+	"0665": {"Cypress-based (Megatec)", "nutdrv_qx"},
+	"06da": {"Phoenixtec (Megatec)", "nutdrv_qx"},
+	"0001": {"Fry's (Megatec)", "nutdrv_qx"},
+}
+
+// usbRoot is where the kernel lists USB devices; tests point it at a fake tree
+var usbRoot = "/sys/bus/usb/devices"
+
+// readAttr returns a sysfs attribute without its trailing newline
+func readAttr(dir, name string) string {
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// Detect lists the USB devices made by known UPS vendors. Belkin also makes
+// hubs and Cypress bridges appear in other gadgets, so those only count when
+// the device calls itself a UPS.
+func Detect() []Device {
+	dirs, _ := filepath.Glob(filepath.Join(usbRoot, "*"))
+	sort.Strings(dirs)
+
+	var devices []Device
+	for _, dir := range dirs {
+		vendorID := strings.ToLower(readAttr(dir, "idVendor"))
+		known, ok := usbVendors[vendorID]
+		if !ok {
+			continue
+		}
+		product := readAttr(dir, "product")
+		if (vendorID == "050d" || vendorID == "0665" || vendorID == "0001") && !looksLikeUPS(product) {
+			continue
+		}
+		devices = append(devices, Device{
+			VendorID:  vendorID,
+			ProductID: strings.ToLower(readAttr(dir, "idProduct")),
+			Vendor:    known.name,
+			Product:   product,
+			Driver:    known.driver,
+		})
+	}
+	return devices
+}
+
+// looksLikeUPS reports whether a USB product string names a UPS
+func looksLikeUPS(product string) bool {
+	p := strings.ToLower(product)
+	return strings.Contains(p, "ups") || strings.Contains(p, "uninterruptible")
+}
+
+// Options are the settings the NUT configuration is generated from
+type Options struct {
+	Device      Device
+	MonPassword string // Password of the local upsmon user
+}
+
+// descEscaper escapes a product string for a quoted ups.conf value, which
+// NUT reads with backslash escapes
+var descEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// configTemplates are the templates each NUT configuration file is
+// rendered from, by path
+var configTemplates = map[string]string{
+	"/etc/nut/nut.conf":    "system/nut.conf.tmpl",
+	"/etc/nut/ups.conf":    "system/nut-ups.conf.tmpl",
+	"/etc/nut/upsd.conf":   "system/nut-upsd.conf.tmpl",
+	"/etc/nut/upsd.users":  "system/nut-upsd.users.tmpl",
+	"/etc/nut/upsmon.conf": "system/nut-upsmon.conf.tmpl",
+	ShutdownScript:         "system/ups-shutdown.sh.tmpl",
+}
+
+// GenerateConfigs returns NUT's configuration files, by path. upsd only
+// listens on localhost: this is a standalone setup for one server.
+//
+// The shutdown script stops the containers by stopping the Docker daemon
+// rather than with 'docker compose stop': containers stopped by hand stay
+// down at the next boot under restart: unless-stopped, and nobody is around
+// to start them when the power comes back.
+func GenerateConfigs(opts Options) map[string]string {
+	data := struct {
+		Options
+		Name, Address, ShutdownScript, Desc string
+	}{opts, Name, Address, ShutdownScript, descEscaper.Replace(strings.TrimSpace(opts.Device.Vendor + " " + opts.Device.Product))}
+
+	files := make(map[string]string, len(configTemplates))
+	for path, name := range configTemplates {
+		files[path] = templates.MustRender(name, data, nil)
+	}
+	return files
+}
+
+// fileMode is the mode and group each generated file is installed with;
+// files holding the upsmon password are readable by root and the nut group
+// only
+func fileMode(path string) (os.FileMode, string) {
+	switch {
+	case path == ShutdownScript:
+		return 0755, "root"
+	case strings.HasSuffix(path, "upsd.users") || strings.HasSuffix(path, "upsmon.conf"):
+		return 0640, "nut"
+	}
+	return 0644, "root"
+}
+
+// Configure installs nut, writes the configuration and (re)starts the NUT
+// driver, server and monitor
+func Configure(opts Options, install func(packages []string) error, dryRun bool) error {
+	files := GenerateConfigs(opts)
+	paths := make([]string, 0, len(files))
+	for p := range files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	var steps []ops.Operation
+	if _, err := exec.LookPath("upsc"); err != nil {
+		steps = append(steps, ops.Func{Description: "install nut", Fn: func() error { return install([]string{"nut"}) }})
+	}
+	for _, p := range paths {
+		mode, group := fileMode(p)
+		steps = append(steps,
+			ops.WriteFile{Path: p, Content: []byte(files[p]), Mode: mode, Secret: group == "nut", Sudo: true},
+			ops.Command{Args: []string{"sudo", "chown", "root:" + group, p}})
+	}
+	return ops.Execute(dryRun, append(steps,
+		// Stopping fails when no driver was running yet
+		ops.Command{Args: []string{"sudo", "upsdrvctl", "stop"}, MayFail: true},
+		ops.Command{Args: []string{"sudo", "upsdrvctl", "start"}},
+		ops.Command{Args: []string{"sudo", "systemctl", "enable", "nut-server", "nut-monitor"}},
+		ops.Command{Args: []string{"sudo", "systemctl", "restart", "nut-server", "nut-monitor"}},
+	)...)
+}
+
+// Status is the state of the UPS as reported by upsc
+type Status struct {
+	Flags      []string `json:"flags"`              // ups.status words: OL, OB, LB, CHRG, RB, ...
+	ChargePct  int      `json:"charge_pct"`         // battery.charge
+	RuntimeSec int      `json:"runtime_sec"`        // battery.runtime
+	LoadPct    int      `json:"load_pct,omitempty"` // ups.load
+	Model      string   `json:"model,omitempty"`    // ups.model or device.model
+	Error      string   `json:"error,omitempty"`    // Why the status could not be read
+}
+
+// has reports whether the UPS reports a status flag
+func (s Status) has(flag string) bool {
+	for _, f := range s.Flags {
+		if f == flag {
+			return true
+		}
+	}
+	return false
+}
+
+// OnBattery reports whether mains power is out
+func (s Status) OnBattery() bool { return s.has("OB") }
+
+// LowBattery reports whether the UPS says the battery is nearly empty;
+// upsmon starts the shutdown at this point
+func (s Status) LowBattery() bool { return s.has("LB") }
+
+// ReplaceBattery reports whether the UPS's self-test failed its battery
+func (s Status) ReplaceBattery() bool { return s.has("RB") }
+
+// Summary is a one-line description such as "online, 100%, 24 min left"
+func (s Status) Summary() string {
+	if s.Error != "" {
+		return s.Error
+	}
+	state := "online"
+	switch {
+	case s.LowBattery():
+		state = "LOW BATTERY"
+	case s.OnBattery():
+		state = "on battery"
+	case s.has("CHRG"):
+		state = "online, charging"
+	}
+	summary := fmt.Sprintf("%s, %d%%, %d min left", state, s.ChargePct, s.RuntimeSec/60)
+	if s.LoadPct > 0 {
+		summary += fmt.Sprintf(", load %d%%", s.LoadPct)
+	}
+	if s.ReplaceBattery() {
+		summary += ", replace battery"
+	}
+	return summary
+}
+
+// ParseUPSC reads 'upsc <ups>' output ("battery.charge: 100" lines)
+func ParseUPSC(output string) Status {
+	var s Status
+	atoi := func(v string) int {
+		f, _ := strconv.ParseFloat(v, 64)
+		return int(f)
+	}
+	for _, line := range strings.Split(output, "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch strings.TrimSpace(key) {
+		case "ups.status":
+			s.Flags = strings.Fields(value)
+		case "battery.charge":
+			s.ChargePct = atoi(value)
+		case "battery.runtime":
+			s.RuntimeSec = atoi(value)
+		case "ups.load":
+			s.LoadPct = atoi(value)
+		case "ups.model", "device.model":
+			if s.Model == "" {
+				s.Model = value
+			}
+		}
+	}
+	return s
+}
+
+// runUPSC runs upsc; tests replace it
+var runUPSC = func(address string) ([]byte, error) {
+	return exec.Command("upsc", address).Output()
+}
+
+// Query reads the UPS status from the local NUT server
+func Query(address string) Status {
+	output, err := runUPSC(address)
+	if err != nil {
+		return Status{Error: fmt.Sprintf("cannot read %s: %v (is nut-server running?)", address, err)}
+	}
+	s := ParseUPSC(string(output))
+	if len(s.Flags) == 0 {
+		s.Error = fmt.Sprintf("%s reports no status (is the UPS connected?)", address)
+	}
+	return s
+}
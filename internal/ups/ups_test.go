@@ -0,0 +1,153 @@
+package ups
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeUSB builds a /sys/bus/usb/devices-like tree
+func fakeUSB(t *testing.T, devices map[string][3]string) string {
+	t.Helper()
+	root := t.TempDir()
+	for name, attrs := range devices {
+		dir := filepath.Join(root, name)
+		os.MkdirAll(dir, 0755)
+		for i, file := range []string{"idVendor", "idProduct", "product"} {
+			if attrs[i] == "" {
+				continue
+			}
+			if err := os.WriteFile(filepath.Join(dir, file), []byte(attrs[i]+"\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return root
+}
+
+func TestDetect(t *testing.T) {
+	old := usbRoot
+	defer func() { usbRoot = old }()
+	usbRoot = fakeUSB(t, map[string][3]string{
+		"1-1":   {"051d", "0002", "Back-UPS ES 700 FW:871.O4 .I USB FW:O4"},
+		"1-2":   {"046d", "c52b", "USB Receiver"},
+		"1-3":   {"050d", "0234", "F5U234 USB 2.0 4-Port Hub"},
+		"1-5":   {"050d", "0a09", "USB Power Strip"},
+		"2-1":   {"0665", "5161", "USB to Serial"},
+		"usb1":  {"1d6b", "0002", "xHCI Host Controller"},
+		"1-1:1": {"", "", ""},
+	})
+
+	devices := Detect()
+	if len(devices) != 1 {
+		t.Fatalf("Detect() = %+v, want the APC unit only", devices)
+	}
+	d := devices[0]
+	if d.Vendor != "APC" || d.Driver != "usbhid-ups" || d.ProductID != "0002" {
+		t.Errorf("Detect() = %+v", d)
+	}
+}
+
+func TestDetect_Megatec(t *testing.T) {
+	old := usbRoot
+	defer func() { usbRoot = old }()
+	usbRoot = fakeUSB(t, map[string][3]string{
+		"1-4": {"0665", "5161", "USB UPS"},
+	})
+
+	devices := Detect()
+	if len(devices) != 1 || devices[0].Driver != "nutdrv_qx" {
+		t.Errorf("Detect() = %+v, want one nutdrv_qx device", devices)
+	}
+}
+
+func TestGenerateConfigs(t *testing.T) {
+	files := GenerateConfigs(Options{
+		Device:      Device{VendorID: "0764", ProductID: "0501", Vendor: "CyberPower", Product: `CP1500 "Pro" \ 2`, Driver: "usbhid-ups"},
+		MonPassword: "s3cret",
+	})
+
+	checks := map[string][]string{
+		"/etc/nut/nut.conf":    {"MODE=standalone"},
+		"/etc/nut/ups.conf":    {"[servctl-ups]", "driver = usbhid-ups", "vendorid = 0764", "productid = 0501", `desc = "CyberPower CP1500 \"Pro\" \\ 2"`},
+		"/etc/nut/upsd.conf":   {"LISTEN 127.0.0.1 3493"},
+		"/etc/nut/upsd.users":  {"password = s3cret", "upsmon master"},
+		"/etc/nut/upsmon.conf": {"MONITOR servctl-ups@localhost 1 upsmon s3cret master", `SHUTDOWNCMD "` + ShutdownScript + `"`},
+	}
+	for path, wants := range checks {
+		content, ok := files[path]
+		if !ok {
+			t.Errorf("missing %s", path)
+			continue
+		}
+		for _, want := range wants {
+			if !strings.Contains(content, want) {
+				t.Errorf("%s missing %q:\n%s", path, want, content)
+			}
+		}
+	}
+
+	// Containers stop before the filesystems sync, and both before poweroff
+	script := files[ShutdownScript]
+	stop := strings.Index(script, "systemctl stop docker.socket docker.service")
+	sync := strings.Index(script, "\nsync\n")
+	poweroff := strings.Index(script, "shutdown -h")
+	if stop < 0 || sync < 0 || poweroff < 0 || !(stop < sync && sync < poweroff) {
+		t.Errorf("shutdown order wrong (stop %d, sync %d, poweroff %d):\n%s", stop, sync, poweroff, script)
+	}
+}
+
+func TestGenerateConfigs_UPSConf(t *testing.T) {
+	files := GenerateConfigs(Options{Device: Device{VendorID: "051d", ProductID: "0002", Vendor: "APC", Driver: "usbhid-ups"}})
+	want := `# Generated by servctl
+[servctl-ups]
+    driver = usbhid-ups
+    port = auto
+    vendorid = 051d
+    productid = 0002
+    desc = "APC"
+`
+	if got := files["/etc/nut/ups.conf"]; got != want {
+		t.Errorf("ups.conf =\n%s\nwant\n%s", got, want)
+	}
+	if got := files["/etc/nut/nut.conf"]; got != "# Generated by servctl\nMODE=standalone\n" {
+		t.Errorf("nut.conf = %q", got)
+	}
+	if script := files[ShutdownScript]; !strings.HasPrefix(script, "#!/bin/sh\n") {
+		t.Errorf("shutdown script must start with its interpreter:\n%s", script)
+	}
+}
+
+func TestParseUPSC(t *testing.T) {
+	output := `battery.charge: 87
+battery.runtime: 1520
+device.model: Back-UPS ES 700G
+ups.load: 23
+ups.model: Back-UPS ES 700G
+ups.status: OB DISCHRG
+`
+	s := ParseUPSC(output)
+	if !s.OnBattery() || s.LowBattery() || s.ChargePct != 87 || s.RuntimeSec != 1520 || s.LoadPct != 23 {
+		t.Errorf("ParseUPSC() = %+v", s)
+	}
+	if got, want := s.Summary(), "on battery, 87%, 25 min left, load 23%"; got != want {
+		t.Errorf("Summary() = %q, want %q", got, want)
+	}
+}
+
+func TestQuery(t *testing.T) {
+	old := runUPSC
+	defer func() { runUPSC = old }()
+
+	runUPSC = func(string) ([]byte, error) { return nil, errors.New("exit status 1") }
+	if s := Query(Address); s.Error == "" {
+		t.Error("Query() should report an unreachable NUT server")
+	}
+
+	runUPSC = func(string) ([]byte, error) { return []byte("battery.charge: 100\nups.status: OL\n"), nil }
+	if s := Query(Address); s.Error != "" || s.Summary() != "online, 100%, 0 min left" {
+		t.Errorf("Query() = %+v", s)
+	}
+}
@@ -0,0 +1,114 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// AtomicWrite replaces path with content so that readers, a crash or a
+// power cut see either the old file or the new one, never a mix: the
+// content goes to a temporary file in the same directory, is synced to disk
+// and renamed over path. An existing file keeps its mode and owner; a new
+// one gets perm. A symlink is followed and its target replaced.
+func AtomicWrite(path string, content []byte, perm os.FileMode) error {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	mode, uid, gid := perm, -1, -1
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+		uid, gid = FileOwner(info)
+	}
+
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return Atomic(func() error {
+		if _, err := tmp.Write(content); err != nil {
+			return fmt.Errorf("failed to write %s: %w", path, err)
+		}
+		if err := tmp.Chmod(mode); err != nil {
+			return fmt.Errorf("failed to set the mode of %s: %w", path, err)
+		}
+		// Under sudo a file in the owner's home must stay theirs; without
+		// root the new file is ours, as the old one almost always was
+		if uid >= 0 && os.Geteuid() == 0 {
+			if err := tmp.Chown(uid, gid); err != nil {
+				return fmt.Errorf("failed to set the owner of %s: %w", path, err)
+			}
+		}
+		if err := tmp.Sync(); err != nil {
+			return fmt.Errorf("failed to sync %s: %w", path, err)
+		}
+		if err := tmp.Close(); err != nil {
+			return fmt.Errorf("failed to write %s: %w", path, err)
+		}
+		if err := os.Rename(tmp.Name(), path); err != nil {
+			return fmt.Errorf("failed to replace %s: %w", path, err)
+		}
+		syncDir(dir)
+		return nil
+	}, func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	})
+}
+
+// AtomicWriteSudo is AtomicWrite for system files such as fstab or netplan.
+// Without permission to write them it goes through sudo, with the same
+// temporary file, sync and rename.
+func AtomicWriteSudo(path string, content []byte, perm os.FileMode) error {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	err := AtomicWrite(path, content, perm)
+	if err == nil || !errors.Is(err, os.ErrPermission) || os.Geteuid() == 0 {
+		return err
+	}
+
+	// The suffix keeps cron, apt and the *.conf directories from reading
+	// the temporary file
+	tmp := path + ".servctl-tmp"
+	sudo := func(stdin string, args ...string) error {
+		cmd := exec.Command("sudo", args...)
+		cmd.Stdin = strings.NewReader(stdin)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("%s: %s: %w", strings.Join(args, " "), strings.TrimSpace(string(output)), err)
+		}
+		return nil
+	}
+	return Atomic(func() error {
+		// dd syncs what it wrote before exiting
+		if err := sudo(string(content), "dd", "of="+tmp, "conv=fsync", "status=none"); err != nil {
+			return fmt.Errorf("failed to write %s: %w", path, err)
+		}
+		if FileExists(path) {
+			if err := sudo("", "chmod", "--reference="+path, tmp); err != nil {
+				return err
+			}
+			if err := sudo("", "chown", "--reference="+path, tmp); err != nil {
+				return err
+			}
+		} else if err := sudo("", "chmod", fmt.Sprintf("%o", perm), tmp); err != nil {
+			return err
+		}
+		return sudo("", "mv", "-f", tmp, path)
+	}, func() {
+		exec.Command("sudo", "rm", "-f", tmp).Run()
+	})
+}
+
+// syncDir makes a rename in dir durable. Not every platform can sync a
+// directory, so failures are ignored.
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+}
@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAtomicWrite_NewFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, ".env")
+	if err := AtomicWrite(path, []byte("TZ=UTC\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("New file mode = %o, want 600", info.Mode().Perm())
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("No temporary file should be left behind, got %d entries", len(entries))
+	}
+}
+
+func TestAtomicWrite_KeepsMode(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "daily-backup.sh")
+	os.WriteFile(path, []byte("old"), 0750)
+	os.Chmod(path, 0750)
+
+	if err := AtomicWrite(path, []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	info, _ := os.Stat(path)
+	if info.Mode().Perm() != 0750 {
+		t.Errorf("Mode = %o, want the existing 750", info.Mode().Perm())
+	}
+	if data, _ := os.ReadFile(path); string(data) != "new" {
+		t.Errorf("Content = %q, want new", data)
+	}
+}
+
+func TestAtomicWrite_FollowsSymlink(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "docker-compose.real.yml")
+	link := filepath.Join(dir, "docker-compose.yml")
+	os.WriteFile(target, []byte("old"), 0644)
+	if err := os.Symlink(target, link); err != nil {
+		t.Skip("symlinks not supported")
+	}
+
+	if err := AtomicWrite(link, []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := os.Lstat(link); info.Mode()&os.ModeSymlink == 0 {
+		t.Error("The symlink should stay a symlink")
+	}
+	if data, _ := os.ReadFile(target); string(data) != "new" {
+		t.Errorf("The link target should be replaced, got %q", data)
+	}
+}
+
+func TestAtomicWrite_MissingDirectory(t *testing.T) {
+	err := AtomicWrite(filepath.Join(t.TempDir(), "missing", "state.json"), []byte("{}"), 0600)
+	if err == nil || !strings.Contains(err.Error(), "state.json") {
+		t.Errorf("Expected an error naming the file, got %v", err)
+	}
+}
@@ -0,0 +1,79 @@
+package utils
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// atomicActive counts the running Atomic operations, nested ones included.
+// The interrupt handler sets interrupting and waits on atomicIdle until
+// none is left. A read-write lock cannot do this: AtomicWrite inside an
+// Atomic operation would take a second read lock, which blocks behind the
+// handler's pending write lock and never lets the outer one finish.
+var (
+	atomicMu     sync.Mutex
+	atomicIdle   = sync.NewCond(&atomicMu)
+	atomicActive int
+	interrupting bool
+)
+
+// Atomic runs an operation that must not be left half done, such as
+// rewriting fstab or netplan. An interrupt arriving meanwhile waits until
+// it has finished. When do fails, undo puts back what it changed: Ctrl+C
+// also reaches the commands do runs, so failing is how an interrupted
+// operation usually ends. undo may be nil.
+func Atomic(do func() error, undo func()) error {
+	atomicMu.Lock()
+	// Once interrupted nothing new starts, but operations still running
+	// may nest, such as an undo that writes back a file with AtomicWrite
+	for interrupting && atomicActive == 0 {
+		atomicIdle.Wait()
+	}
+	atomicActive++
+	atomicMu.Unlock()
+	defer func() {
+		atomicMu.Lock()
+		atomicActive--
+		if atomicActive == 0 {
+			atomicIdle.Broadcast()
+		}
+		atomicMu.Unlock()
+	}()
+
+	if err := do(); err != nil {
+		if undo != nil {
+			undo()
+		}
+		return err
+	}
+	return nil
+}
+
+// HandleInterrupts calls onInterrupt when servctl is interrupted (Ctrl+C,
+// kill, a closed SSH session) and then exits with ExitInterrupted. Atomic
+// operations in flight finish, or are undone, first; onInterrupt restores
+// the terminal and says how to pick the work up again.
+func HandleInterrupts(onInterrupt func(os.Signal)) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	go func() {
+		sig := <-signals
+		// A second Ctrl+C while waiting ends servctl at once
+		signal.Reset(os.Interrupt)
+		stopAtomic()
+		onInterrupt(sig)
+		os.Exit(ExitInterrupted)
+	}()
+}
+
+// stopAtomic keeps new Atomic operations from starting and returns, still
+// holding atomicMu, once those running have finished
+func stopAtomic() {
+	atomicMu.Lock()
+	interrupting = true
+	for atomicActive > 0 {
+		atomicIdle.Wait()
+	}
+}
@@ -0,0 +1,97 @@
+package utils
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// resumeAtomic undoes stopAtomic, for the next test
+func resumeAtomic() {
+	interrupting = false
+	atomicMu.Unlock()
+}
+
+func TestAtomic_UndoesOnFailure(t *testing.T) {
+	undone := false
+	err := Atomic(func() error { return errors.New("netplan apply: signal: interrupt") }, func() { undone = true })
+	if err == nil || !undone {
+		t.Errorf("A failed operation should be undone: err=%v undone=%v", err, undone)
+	}
+
+	undone = false
+	if err := Atomic(func() error { return nil }, func() { undone = true }); err != nil || undone {
+		t.Errorf("A finished operation must not be undone: err=%v undone=%v", err, undone)
+	}
+	if err := Atomic(func() error { return errors.New("failed") }, nil); err == nil {
+		t.Error("The error should be returned without an undo")
+	}
+}
+
+func TestAtomic_InterruptWaits(t *testing.T) {
+	started := make(chan struct{})
+	finished := false
+	go Atomic(func() error {
+		close(started)
+		time.Sleep(50 * time.Millisecond)
+		finished = true
+		return nil
+	}, nil)
+	<-started
+
+	// What the interrupt handler does before cleaning up
+	stopAtomic()
+	defer resumeAtomic()
+	if !finished {
+		t.Error("An interrupt should wait for the operation in flight")
+	}
+}
+
+func TestAtomic_InterruptDuringDoFinishesUndo(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "01-servctl.yaml")
+	os.WriteFile(path, []byte("old"), 0644)
+
+	// applyStaticIPConfig: write the file, then netplan apply is interrupted
+	done := make(chan error, 1)
+	stopped := make(chan struct{})
+	go func() {
+		done <- Atomic(func() error {
+			if err := AtomicWrite(path, []byte("new"), 0644); err != nil {
+				return err
+			}
+			go func() {
+				stopAtomic()
+				close(stopped)
+			}()
+			// Wait until the handler is waiting for this operation
+			for {
+				atomicMu.Lock()
+				waiting := interrupting
+				atomicMu.Unlock()
+				if waiting {
+					break
+				}
+				time.Sleep(time.Millisecond)
+			}
+			return errors.New("netplan apply: signal: interrupt")
+		}, func() {
+			AtomicWrite(path, []byte("old"), 0644)
+		})
+	}()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("The interrupted operation should fail")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("The undo deadlocked behind the interrupt handler")
+	}
+	<-stopped
+	defer resumeAtomic()
+	if content, _ := os.ReadFile(path); string(content) != "old" {
+		t.Errorf("Content = %q after the undo, want %q", content, "old")
+	}
+}
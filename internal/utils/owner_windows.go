@@ -0,0 +1,8 @@
+package utils
+
+import "os"
+
+// FileOwner reports no owner: Windows files have no numeric owner to keep
+func FileOwner(os.FileInfo) (int, int) {
+	return -1, -1
+}
@@ -141,8 +141,8 @@ func SafeWriteFile(path string, content []byte, perm os.FileMode, backup bool) e
 		}
 	}
 
-	if err := os.WriteFile(path, content, perm); err != nil {
-		return fmt.Errorf("failed to write file: %w", err)
+	if err := AtomicWrite(path, content, perm); err != nil {
+		return err
 	}
 
 	return nil
@@ -206,6 +206,26 @@ func CheckFstabEntry(device, mountPoint string) (bool, error) {
 	return ContainsLine("/etc/fstab", device)
 }
 
+// Exit codes, one per failure class, so scripts wrapping servctl can tell
+// a preflight blocker from a cancelled prompt from a failed disk format.
+// They are part of the command-line interface: add new ones, never renumber.
+const (
+	ExitOK            = 0
+	ExitError         = 1   // Unexpected failure not covered below
+	ExitUsage         = 2   // Bad flag, action or argument (as the flag package)
+	ExitCancelled     = 3   // The user declined a confirmation prompt
+	ExitPreflight     = 4   // Preflight blockers or sudo unavailable
+	ExitStorage       = 5   // Disk formatting, mounting or snapshot rollback failed
+	ExitFilesystem    = 6   // Files, directories or permissions could not be written or fixed
+	ExitNotConfigured = 7   // No saved setup yet: run -start-setup first
+	ExitDocker        = 8   // Docker unreachable or a container operation failed
+	ExitBackup        = 9   // A backup run or prune failed
+	ExitNetwork       = 10  // Host IP detection or a remote push failed
+	ExitPartial       = 11  // Finished, but some non-critical steps failed
+	ExitInvalidConfig = 12  // A hand-edited configuration file failed validation
+	ExitInterrupted   = 130 // Interrupted by Ctrl+C or a signal (128 + SIGINT, as shells report it)
+)
+
 // ServctlError represents a servctl-specific error with context
 type ServctlError struct {
 	Phase       string   // Which phase failed
@@ -265,6 +285,56 @@ func FormatError(err *ServctlError) string {
 	return b.String()
 }
 
+// Failures collects the errors of a multi-phase run, so the run can carry
+// on past non-critical ones and list everything that needs fixing at the end
+type Failures []*ServctlError
+
+// Add records a failure and reports whether it is critical, i.e. whether
+// the run must stop here
+func (f *Failures) Add(err *ServctlError) bool {
+	*f = append(*f, err)
+	return err.IsCritical
+}
+
+// Critical returns the first critical failure, or nil
+func (f Failures) Critical() *ServctlError {
+	for _, err := range f {
+		if err.IsCritical {
+			return err
+		}
+	}
+	return nil
+}
+
+// FormatSummary lists failures with their fixes, followed by the command
+// that resumes the run once they are fixed
+func FormatSummary(failures Failures, resume string) string {
+	var b strings.Builder
+
+	if critical := failures.Critical(); critical != nil {
+		b.WriteString(fmt.Sprintf("🚨 Stopped in %s\n", critical.Phase))
+	} else {
+		b.WriteString(fmt.Sprintf("⚠️  Finished with %d problem(s) - everything else is in place\n", len(failures)))
+	}
+
+	b.WriteString("\nTo fix:\n")
+	for i, err := range failures {
+		marker := ""
+		if err.IsCritical {
+			marker = " (blocking)"
+		}
+		b.WriteString(fmt.Sprintf("  %d. [%s] %s: %v%s\n", i+1, err.Phase, err.Operation, err.Err, marker))
+		for _, step := range err.Remediation {
+			b.WriteString(fmt.Sprintf("     → %s\n", step))
+		}
+	}
+
+	if resume != "" {
+		b.WriteString(fmt.Sprintf("\nThen resume with: %s\n", resume))
+	}
+	return b.String()
+}
+
 // IsRoot checks if running as root
 func IsRoot() bool {
 	return os.Geteuid() == 0
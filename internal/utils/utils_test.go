@@ -229,6 +229,53 @@ func TestWarningError(t *testing.T) {
 	}
 }
 
+func TestFailures(t *testing.T) {
+	var failures Failures
+	if failures.Critical() != nil {
+		t.Error("No failures should have no critical failure")
+	}
+
+	if failures.Add(NewWarningError("Maintenance Scripts", "Write cron file", os.ErrPermission, "Run with sudo")) {
+		t.Error("A warning should not stop the run")
+	}
+	summary := FormatSummary(failures, "sudo servctl -start-setup")
+	if !containsString(summary, "1 problem") || containsString(summary, "Stopped") {
+		t.Errorf("Summary should report a partial success:\n%s", summary)
+	}
+	if !containsString(summary, "Run with sudo") || !containsString(summary, "sudo servctl -start-setup") {
+		t.Errorf("Summary should list the fix and the resume command:\n%s", summary)
+	}
+
+	if !failures.Add(NewCriticalError("Service Configuration", "Write compose files", os.ErrExist)) {
+		t.Error("A critical error should stop the run")
+	}
+	if c := failures.Critical(); c == nil || c.Phase != "Service Configuration" {
+		t.Errorf("Critical() = %v", c)
+	}
+	summary = FormatSummary(failures, "")
+	if !containsString(summary, "Stopped in Service Configuration") || !containsString(summary, "(blocking)") {
+		t.Errorf("Summary should name the blocking phase:\n%s", summary)
+	}
+	if !containsString(summary, "Write cron file") {
+		t.Errorf("Summary should still list earlier warnings:\n%s", summary)
+	}
+}
+
+func TestExitCodesDistinct(t *testing.T) {
+	codes := []int{ExitOK, ExitError, ExitUsage, ExitCancelled, ExitPreflight, ExitStorage,
+		ExitFilesystem, ExitNotConfigured, ExitDocker, ExitBackup, ExitNetwork, ExitPartial, ExitInvalidConfig, ExitInterrupted}
+	seen := make(map[int]bool)
+	for _, c := range codes {
+		if seen[c] {
+			t.Errorf("Exit code %d used twice", c)
+		}
+		seen[c] = true
+	}
+	if ExitUsage != 2 {
+		t.Error("ExitUsage should match the flag package's exit code 2")
+	}
+}
+
 func containsString(s, substr string) bool {
 	for i := 0; i <= len(s)-len(substr); i++ {
 		if s[i:i+len(substr)] == substr {
@@ -0,0 +1,150 @@
+// Package templates holds every file servctl generates from a template:
+// docker-compose.yml and .env, the maintenance scripts, the configs placed
+// next to the stack (services/), and the system files (cron, logrotate,
+// systemd units, netplan, mail, DNS). They are embedded in the binary and
+// rendered with text/template and a shared set of helpers.
+//
+// A template may use the partials (files starting with "_") in its own
+// directory, through {{ template "name" . }}.
+package templates
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+//go:embed *.tmpl scripts/*.tmpl services/*.tmpl system/*.tmpl
+var files embed.FS
+
+// FS returns the embedded templates, for tests that check all of them
+func FS() fs.FS {
+	return files
+}
+
+// Funcs are the helpers every template can call. Packages add their own
+// (mostly constants shared with Go code) when rendering.
+var Funcs = template.FuncMap{
+	"quote":       func(s string) string { return fmt.Sprintf("%q", s) },
+	"shellQuote":  ShellQuote,
+	"shellEscape": ShellEscape,
+	"envQuote":    EnvQuote,
+	"indent":      Indent,
+	"nindent":     func(n int, s string) string { return "\n" + Indent(n, s) },
+	"join":        func(sep string, list []string) string { return strings.Join(list, sep) },
+	"list":        func(items ...string) []string { return items },
+	"default":     Default,
+	"trim":        strings.TrimSpace,
+	"lower":       strings.ToLower,
+	"upper":       strings.ToUpper,
+	"secretRef":   SecretRef,
+}
+
+// ShellQuote quotes s for a POSIX shell, so it reaches the command as one
+// word whatever it contains
+func ShellQuote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789@%+=:,./-_") == "" {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// ShellEscape escapes v for use inside double quotes in a shell script,
+// where ", $, ` and \ would otherwise end the string or expand. Numbers and
+// other values are printed first.
+func ShellEscape(v any) string {
+	return shellEscaper.Replace(fmt.Sprint(v))
+}
+
+var shellEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "`", "\\`")
+
+// EnvQuote double-quotes v for a .env file. Docker Compose and a shell that
+// sources the file both read the escapes ShellEscape writes, so a password
+// with $, # or spaces arrives unchanged instead of expanded or cut short.
+func EnvQuote(v any) string {
+	return `"` + ShellEscape(v) + `"`
+}
+
+// Indent puts n spaces before every non-empty line of s
+func Indent(n int, s string) string {
+	pad := strings.Repeat(" ", n)
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = pad + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Default returns value, or def when value is empty. Pipelines pass the
+// value last: {{ .Timezone | default "UTC" }}.
+func Default(def string, value string) string {
+	if value == "" {
+		return def
+	}
+	return value
+}
+
+// SecretRef refers to a secret in .env by name, so compose substitutes it
+// and the secret itself stays out of docker-compose.yml
+func SecretRef(name string) string {
+	return "${" + name + "}"
+}
+
+// secretRefPattern matches ${SECRET:name}, a request for a named secret
+var secretRefPattern = regexp.MustCompile(`\$\{SECRET:([a-z0-9_]+)\}`)
+
+// ResolveSecrets replaces every ${SECRET:name} in rendered content with
+// what resolve returns for the name. Templates ask for credentials by name
+// this way and never hold them; resolve decides whether the output gets
+// the value or a reference to where it is kept.
+func ResolveSecrets(content string, resolve func(name string) (string, error)) (string, error) {
+	var firstErr error
+	resolved := secretRefPattern.ReplaceAllStringFunc(content, func(ref string) string {
+		value, err := resolve(secretRefPattern.FindStringSubmatch(ref)[1])
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		return value
+	})
+	if firstErr != nil {
+		return "", firstErr
+	}
+	return resolved, nil
+}
+
+// Render executes the named template (a path such as
+// "scripts/daily_backup.sh.tmpl") with data. funcs adds to, or overrides,
+// the shared helpers.
+func Render(name string, data any, funcs template.FuncMap) (string, error) {
+	tmpl := template.New(path.Base(name)).Funcs(Funcs).Funcs(funcs)
+	partials, err := fs.Glob(files, path.Join(path.Dir(name), "_*.tmpl"))
+	if err != nil {
+		return "", fmt.Errorf("failed to parse template %s: %w", name, err)
+	}
+	if _, err := tmpl.ParseFS(files, append([]string{name}, partials...)...); err != nil {
+		return "", fmt.Errorf("failed to parse template %s: %w", name, err)
+	}
+
+	var buf strings.Builder
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to execute template %s: %w", name, err)
+	}
+	return buf.String(), nil
+}
+
+// MustRender is Render for templates whose data cannot make them fail, so
+// their generators can keep returning a plain string. It panics on a broken
+// template, which the template's tests catch first.
+func MustRender(name string, data any, funcs template.FuncMap) string {
+	content, err := Render(name, data, funcs)
+	if err != nil {
+		panic(err)
+	}
+	return content
+}
@@ -0,0 +1,125 @@
+package templates
+
+import (
+	"fmt"
+	"io/fs"
+	"strings"
+	"testing"
+	"text/template"
+	"text/template/parse"
+)
+
+func TestShellQuote(t *testing.T) {
+	cases := map[string]string{
+		"/mnt/data":       "/mnt/data",
+		"":                "''",
+		"My Photos":       "'My Photos'",
+		"it's":            `'it'\''s'`,
+		"$HOME; rm -rf /": "'$HOME; rm -rf /'",
+	}
+	for in, want := range cases {
+		if got := ShellQuote(in); got != want {
+			t.Errorf("ShellQuote(%q) = %s, want %s", in, got, want)
+		}
+	}
+}
+
+func TestShellEscape(t *testing.T) {
+	cases := map[string]string{
+		"/mnt/my data": "/mnt/my data",
+		`say "hi"`:     `say \"hi\"`,
+		"$HOME":        `\$HOME`,
+		"`id`":         "\\`id\\`",
+		`C:\path`:      `C:\\path`,
+	}
+	for in, want := range cases {
+		if got := ShellEscape(in); got != want {
+			t.Errorf("ShellEscape(%q) = %s, want %s", in, got, want)
+		}
+	}
+}
+
+func TestIndent(t *testing.T) {
+	if got := Indent(4, "a:\n  b\n\nc"); got != "    a:\n      b\n\n    c" {
+		t.Errorf("Indent should pad non-empty lines only, got %q", got)
+	}
+}
+
+func TestHelpers(t *testing.T) {
+	tmpl := template.Must(template.New("t").Funcs(Funcs).Parse(
+		`{{ quote .A }} {{ shellQuote .A }} {{ .Empty | default "none" }} {{ secretRef "DB_PASSWORD" }} {{ join "," (list "a" "b") }}{{ nindent 2 "x" }}`))
+	var b strings.Builder
+	if err := tmpl.Execute(&b, map[string]string{"A": `say "hi"`, "Empty": ""}); err != nil {
+		t.Fatal(err)
+	}
+	want := `"say \"hi\"" 'say "hi"' none ${DB_PASSWORD} a,b` + "\n  x"
+	if b.String() != want {
+		t.Errorf("got %q, want %q", b.String(), want)
+	}
+}
+
+func TestResolveSecrets(t *testing.T) {
+	resolve := func(name string) (string, error) {
+		if name == "db" {
+			return "${DB_PASSWORD}", nil
+		}
+		return "", fmt.Errorf("unknown secret %q", name)
+	}
+	got, err := ResolveSecrets("a=${SECRET:db}\nb=${SECRET:db}_root\nc=${OTHER}", resolve)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "a=${DB_PASSWORD}\nb=${DB_PASSWORD}_root\nc=${OTHER}"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if _, err := ResolveSecrets("x=${SECRET:nope}", resolve); err == nil {
+		t.Error("an unknown secret should fail")
+	}
+}
+
+// TestAllTemplatesParse parses every embedded template, including the
+// helpers packages add at render time
+func TestAllTemplatesParse(t *testing.T) {
+	count := 0
+	err := fs.WalkDir(files, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := fs.ReadFile(files, path)
+		if err != nil {
+			return err
+		}
+		tree := parse.New(path)
+		tree.Mode = parse.SkipFuncCheck
+		if _, err := tree.Parse(string(data), "", "", map[string]*parse.Tree{}); err != nil {
+			t.Errorf("%s: %v", path, err)
+		}
+		count++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count < 20 {
+		t.Errorf("Expected every template to be embedded, found %d", count)
+	}
+}
+
+func TestRender_UsesPartials(t *testing.T) {
+	out, err := Render("scripts/_run_lock.sh.tmpl", nil, template.FuncMap{
+		"runLockFile": func() string { return "" },
+		"maxLogBytes": func() int { return 0 },
+
+		"diskEmergencyFile":    func() string { return "" },
+		"diskEmergencyPercent": func() int { return 0 },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(out) != "" {
+		t.Errorf("A partial only defines a template, got %q", out)
+	}
+	if _, err := Render("missing.tmpl", nil, nil); err == nil {
+		t.Error("Rendering a missing template should fail")
+	}
+}